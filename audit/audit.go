@@ -0,0 +1,32 @@
+// Package audit provides some sinks for the audit trail of the server: a file with rotation, syslog and a webhook.
+// The file sink can also record the transcripts of the sessions.
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// ErrorHandler receives the errors of the sinks, which can't be returned to the server
+type ErrorHandler func(err error)
+
+// multiSink sends the events to several sinks
+type multiSink []server.AuditSink
+
+// Multi creates a sink sending the events to several sinks
+func Multi(sinks ...server.AuditSink) server.AuditSink {
+	return multiSink(sinks)
+}
+
+func (sinks multiSink) Audit(event *server.AuditEvent) {
+	for _, sink := range sinks {
+		sink.Audit(event)
+	}
+}
+
+// encode encodes an event or a transcript entry as a JSON line
+func encode(event interface{}) []byte {
+	line, _ := json.Marshal(event) // The events and entries can always be encoded
+	return append(line, '\n')
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	sink, err := NewFileSink(path, 300, 2)
+	if err != nil {
+		t.Fatal("Couldn't create the sink:", err)
+	}
+	for i := 0; i < 10; i++ {
+		sink.Audit(&server.AuditEvent{Type: server.AuditLogin, User: "user"})
+	}
+	sink.Close()
+
+	for _, name := range []string{"audit.log", "audit.log.1", "audit.log.2"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil || len(content) > 300 {
+			t.Fatal("Bad file", name, ":", len(content), err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("Only 2 backups should be kept")
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	var event server.AuditEvent
+	if err := json.Unmarshal([]byte(strings.SplitN(string(content), "\n", 2)[0]), &event); err != nil ||
+		event.Type != server.AuditLogin {
+		t.Fatal("Bad event:", event, err)
+	}
+}
+
+func TestFileSinkRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "transcript.log")
+	sink, err := NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatal("Couldn't create the sink:", err)
+	}
+	sink.Record(&server.TranscriptEntry{Type: server.TranscriptCommand, Line: "PASS ****"})
+	sink.Close()
+
+	content, _ := ioutil.ReadFile(path)
+	var entry server.TranscriptEntry
+	if err := json.Unmarshal(content, &entry); err != nil || entry.Type != server.TranscriptCommand ||
+		entry.Line != "PASS ****" {
+		t.Fatal("Bad entry:", entry, err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan server.AuditEvent, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event server.AuditEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		if r.Header.Get("Authorization") == "Bearer secret" {
+			received <- event
+		}
+	}))
+	defer hook.Close()
+
+	sink := NewWebhookSink(hook.URL, 10)
+	sink.Header = http.Header{"Authorization": []string{"Bearer secret"}}
+	sink.Audit(&server.AuditEvent{Type: server.AuditDelete, Path: "/file"})
+	sink.Close()
+
+	select {
+	case event := <-received:
+		if event.Type != server.AuditDelete || event.Path != "/file" {
+			t.Fatal("Bad event:", event)
+		}
+	default:
+		t.Fatal("The event should have been posted")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var count int
+	counter := sinkFunc(func(event *server.AuditEvent) { count++ })
+	Multi(counter, counter).Audit(&server.AuditEvent{})
+	if count != 2 {
+		t.Fatal("The event should reach all the sinks:", count)
+	}
+}
+
+type sinkFunc func(event *server.AuditEvent)
+
+func (f sinkFunc) Audit(event *server.AuditEvent) {
+	f(event)
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// FileSink writes the events (or the entries of the session transcripts) as JSON lines to a file. When the file reaches its maximum size, it's renamed to
+// "file.1" (the previous "file.1" becoming "file.2" and so on) and a new one is started.
+type FileSink struct {
+	OnError ErrorHandler // Receives the write errors (optional)
+
+	path       string     // Path of the file
+	maxSize    int64      // Maximum size of the file, 0 for no rotation
+	maxBackups int        // Number of rotated files kept
+	mutex      sync.Mutex // Protects the following fields
+	file       *os.File   // Current file
+	size       int64      // Size of the current file
+}
+
+// NewFileSink creates a sink writing to a file, rotated when it reaches maxSize bytes
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	sink := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *FileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	sink.file, sink.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the current file and opens a new one
+func (sink *FileSink) rotate() error {
+	sink.file.Close()
+	sink.file = nil
+
+	if sink.maxBackups < 1 {
+		os.Remove(sink.path)
+	} else {
+		for i := sink.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", sink.path, i), fmt.Sprintf("%s.%d", sink.path, i+1))
+		}
+		if err := os.Rename(sink.path, sink.path+".1"); err != nil {
+			return err
+		}
+	}
+	return sink.open()
+}
+
+// Audit writes an event
+func (sink *FileSink) Audit(event *server.AuditEvent) {
+	sink.write(encode(event))
+}
+
+// Record writes an entry of a session transcript, the sink can then record the transcripts in another file than the
+// audit trail
+func (sink *FileSink) Record(entry *server.TranscriptEntry) {
+	sink.write(encode(entry))
+}
+
+// write writes a line to the file, rotating it first if it would exceed its maximum size
+func (sink *FileSink) write(line []byte) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	var err error
+	if sink.file == nil {
+		err = sink.open()
+	} else if sink.maxSize > 0 && sink.size > 0 && sink.size+int64(len(line)) > sink.maxSize {
+		err = sink.rotate()
+	}
+	if err == nil {
+		var n int
+		n, err = sink.file.Write(line)
+		sink.size += int64(n)
+	}
+	if err != nil && sink.OnError != nil {
+		sink.OnError(err)
+	}
+}
+
+// Close closes the file
+func (sink *FileSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.file == nil {
+		return nil
+	}
+	err := sink.file.Close()
+	sink.file = nil
+	return err
+}
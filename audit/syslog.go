@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package audit
+
+import (
+	"log/syslog"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// SyslogSink sends the events as JSON messages to syslog
+type SyslogSink struct {
+	OnError ErrorHandler // Receives the write errors (optional)
+
+	writer *syslog.Writer
+}
+
+// NewSyslogSink creates a sink sending to the syslog daemon at raddr over network, or to the local one if network
+// is empty
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Audit sends an event, the denials, the failed logins and the bounce attempts are sent as warnings
+func (sink *SyslogSink) Audit(event *server.AuditEvent) {
+	line := string(encode(event))
+
+	var err error
+	switch event.Type {
+	case server.AuditLoginFailed, server.AuditPermissionDenied, server.AuditBounceAttempt:
+		err = sink.writer.Warning(line)
+	default:
+		err = sink.writer.Notice(line)
+	}
+	if err != nil && sink.OnError != nil {
+		sink.OnError(err)
+	}
+}
+
+// Close closes the connection to syslog
+func (sink *SyslogSink) Close() error {
+	return sink.writer.Close()
+}
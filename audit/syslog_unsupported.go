@@ -0,0 +1,29 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package audit
+
+import (
+	"errors"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// SyslogSink isn't supported on this system
+type SyslogSink struct {
+	OnError ErrorHandler // Receives the write errors (optional)
+}
+
+// NewSyslogSink always fails: syslog isn't supported on this system
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	return nil, errors.New("syslog isn't supported on this system")
+}
+
+// Audit does nothing
+func (sink *SyslogSink) Audit(event *server.AuditEvent) {
+}
+
+// Close does nothing
+func (sink *SyslogSink) Close() error {
+	return nil
+}
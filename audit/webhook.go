@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// ErrQueueFull is reported when an event is dropped because the webhook can't keep up
+var ErrQueueFull = errors.New("the audit webhook queue is full, event dropped")
+
+// WebhookSink posts each event as JSON to a URL. The events are queued and posted in the background so that a slow
+// webhook doesn't slow down the clients; when the queue is full the events are dropped.
+type WebhookSink struct {
+	URL     string       // URL receiving the events
+	Header  http.Header  // Additional headers (like an authorization), optional
+	Client  *http.Client // HTTP client, a client with a 10s timeout is used by default
+	OnError ErrorHandler // Receives the post errors (optional)
+
+	queue chan *server.AuditEvent
+	done  sync.WaitGroup
+}
+
+// NewWebhookSink creates a sink posting to url, with a queue of queueSize events
+func NewWebhookSink(url string, queueSize int) *WebhookSink {
+	sink := &WebhookSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *server.AuditEvent, queueSize),
+	}
+	sink.done.Add(1)
+	go sink.run()
+	return sink
+}
+
+func (sink *WebhookSink) run() {
+	defer sink.done.Done()
+	for event := range sink.queue {
+		if err := sink.post(event); err != nil && sink.OnError != nil {
+			sink.OnError(err)
+		}
+	}
+}
+
+func (sink *WebhookSink) post(event *server.AuditEvent) error {
+	request, err := http.NewRequest(http.MethodPost, sink.URL, bytes.NewReader(encode(event)))
+	if err != nil {
+		return err
+	}
+	for key, values := range sink.Header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := sink.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("the audit webhook replied %s", response.Status)
+	}
+	return nil
+}
+
+// Audit queues an event
+func (sink *WebhookSink) Audit(event *server.AuditEvent) {
+	select {
+	case sink.queue <- event:
+	default:
+		if sink.OnError != nil {
+			sink.OnError(ErrQueueFull)
+		}
+	}
+}
+
+// Close posts the queued events and stops the sink
+func (sink *WebhookSink) Close() error {
+	close(sink.queue)
+	sink.done.Wait()
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package client is a minimal FTP and FTPS client: login, explicit TLS (AUTH TLS), passive data connections (EPSV or
+// PASV), listings (LIST and MLSD) and transfers (RETR and STOR). It's used by the tests of the server, and it can be
+// used by the applications talking to other FTP servers.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config defines how to connect to a server
+type Config struct {
+	Timeout     time.Duration // Timeout of the connections and of each reply, 30s by default
+	TLSConfig   *tls.Config   // TLS config used by AuthTLS (and the protected data connections)
+	DisableEPSV bool          // Use PASV instead of EPSV for the data connections
+}
+
+// Reply is a reply of the server
+type Reply struct {
+	Code    int      // Reply code
+	Message string   // Message of the last line
+	Lines   []string // All the lines, with their code
+}
+
+func (r *Reply) String() string {
+	return strings.Join(r.Lines, "\n")
+}
+
+// Error is returned when the server doesn't reply with the expected code
+type Error struct {
+	Command string // Command sent, the password of PASS is redacted
+	Reply   *Reply // Reply of the server
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: unexpected reply %s", e.Command, e.Reply)
+}
+
+// Conn is a connection to a server, it must only be used by one goroutine at a time
+type Conn struct {
+	config    Config
+	conn      net.Conn
+	reader    *bufio.Reader
+	protected bool // The data connections are protected (PROT P)
+}
+
+// Dial connects to a server (host:port) and reads its welcome message
+func Dial(address string, config *Config) (*Conn, error) {
+	c := &Conn{}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.Timeout <= 0 {
+		c.config.Timeout = 30 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", address, c.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.setConn(conn)
+
+	reply, err := c.ReadReply()
+	if err == nil && reply.Code != 220 {
+		err = &Error{Command: "connect", Reply: reply}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) setConn(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+}
+
+// ReadReply reads the next reply of the server, multi-line ones included
+func (c *Conn) ReadReply() (*Reply, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
+	reply := &Reply{}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		reply.Lines = append(reply.Lines, line)
+
+		// The last line starts with the code followed by a space, the first one of a multi-line reply with a dash
+		if len(line) >= 4 && line[3] == ' ' && (len(reply.Lines) == 1 || line[:3] == reply.Lines[0][:3]) {
+			if reply.Code, err = strconv.Atoi(line[:3]); err != nil {
+				return nil, fmt.Errorf("bad reply line: %q", line)
+			}
+			reply.Message = line[4:]
+			return reply, nil
+		}
+		if len(reply.Lines) == 1 && (len(line) < 4 || line[3] != '-') {
+			return nil, fmt.Errorf("bad reply line: %q", line)
+		}
+	}
+}
+
+// Cmd sends a raw command and returns the reply of the server, whatever its code
+func (c *Conn) Cmd(command string) (*Reply, error) {
+	c.conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", command); err != nil {
+		return nil, err
+	}
+	return c.ReadReply()
+}
+
+// expect sends a command and checks the code of the reply
+func (c *Conn) expect(command string, codes ...int) (*Reply, error) {
+	reply, err := c.Cmd(command)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if reply.Code == code {
+			return reply, nil
+		}
+	}
+	if strings.HasPrefix(command, "PASS ") {
+		command = "PASS ****"
+	}
+	return reply, &Error{Command: command, Reply: reply}
+}
+
+// Login logs the user in
+func (c *Conn) Login(user, pass string) error {
+	reply, err := c.expect("USER "+user, 230, 331)
+	if err != nil || reply.Code == 230 {
+		return err
+	}
+	_, err = c.expect("PASS "+pass, 230, 202)
+	return err
+}
+
+// AuthTLS protects the control connection with TLS, and the data connections once they're open (PBSZ 0 and PROT P)
+func (c *Conn) AuthTLS() error {
+	if _, err := c.expect("AUTH TLS", 234); err != nil {
+		return err
+	}
+
+	config := c.tlsConfig()
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(c.conn.RemoteAddr().String())
+	}
+	c.config.TLSConfig = config
+	tlsConn := tls.Client(c.conn, config)
+	tlsConn.SetDeadline(time.Now().Add(c.config.Timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.setConn(tlsConn)
+
+	if _, err := c.expect("PBSZ 0", 200); err != nil {
+		return err
+	}
+	if _, err := c.expect("PROT P", 200); err != nil {
+		return err
+	}
+	c.protected = true
+	return nil
+}
+
+// tlsConfig returns a copy of the TLS config with a session cache, so that the data connections can resume the TLS
+// session of the control connection (required by many servers)
+func (c *Conn) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if c.config.TLSConfig != nil {
+		config = c.config.TLSConfig.Clone()
+	}
+	if config.ClientSessionCache == nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	return config
+}
+
+// Quit ends the session and closes the connection
+func (c *Conn) Quit() error {
+	_, err := c.expect("QUIT", 221)
+	c.conn.Close()
+	return err
+}
+
+// Close closes the connection without ending the session
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
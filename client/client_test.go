@@ -0,0 +1,122 @@
+package client_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/client"
+	"github.com/fclairamb/ftpserver/ftptest"
+	"github.com/fclairamb/ftpserver/sample"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// tlsDriver serves a temporary directory, with TLS
+type tlsDriver struct {
+	dir       string
+	tlsConfig *tls.Config
+}
+
+func (d *tlsDriver) GetSettings() *server.Settings {
+	return &server.Settings{TLSSessionReuseRequired: true}
+}
+
+func (d *tlsDriver) GetTLSConfig() (*tls.Config, error) {
+	return d.tlsConfig, nil
+}
+
+func (d *tlsDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return "Test server", nil
+}
+
+func (d *tlsDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	if pass != "test" {
+		return nil, errors.New("bad password")
+	}
+	return &sample.ClientDriver{BaseDir: d.dir}, nil
+}
+
+func (d *tlsDriver) UserLeft(cc server.ClientContext) {}
+
+// selfSignedConfig creates a TLS config with a throwaway certificate
+func selfSignedConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Couldn't generate the key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Couldn't create the certificate:", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := ftptest.NewServer(t, &tlsDriver{dir: dir, tlsConfig: selfSignedConfig(t)})
+	defer s.Close()
+
+	for _, disableEPSV := range []bool{false, true} {
+		conn, err := client.Dial(s.Addr(), &client.Config{
+			TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableEPSV: disableEPSV,
+		})
+		if err != nil {
+			t.Fatal("Couldn't connect:", err)
+		}
+		if err = conn.AuthTLS(); err != nil {
+			t.Fatal("Couldn't negotiate TLS:", err)
+		}
+		if err = conn.Login("test", "test"); err != nil {
+			t.Fatal("Couldn't log in:", err)
+		}
+
+		data := bytes.Repeat([]byte("0123456789"), 10000)
+		if size, err := conn.Store("/file.bin", bytes.NewReader(data)); err != nil || size != int64(len(data)) {
+			t.Fatal("Couldn't upload:", size, err)
+		}
+		var downloaded bytes.Buffer
+		if _, err = conn.Retrieve("/file.bin", &downloaded); err != nil || !bytes.Equal(downloaded.Bytes(), data) {
+			t.Fatal("Couldn't download:", downloaded.Len(), err)
+		}
+
+		entries, err := conn.MLSD("/")
+		if err != nil {
+			t.Fatal("Couldn't list:", err)
+		}
+		found := false
+		for _, entry := range entries {
+			found = found || (entry.Name == "file.bin" && entry.Size == int64(len(data)) && !entry.IsDir())
+		}
+		if !found {
+			t.Fatal("The file should be listed")
+		}
+
+		_, err = conn.Retrieve("/missing", &downloaded)
+		if replyErr, ok := err.(*client.Error); !ok || replyErr.Reply.Code != 550 {
+			t.Fatal("The download of a missing file should fail:", err)
+		}
+		if err = conn.Quit(); err != nil {
+			t.Fatal("Couldn't quit:", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is an entry of a directory listing
+type Entry struct {
+	Name    string            // Name of the file or the directory
+	Type    string            // "file", "dir" or "link" for LIST, the Type fact for MLSD ("cdir", "pdir"...)
+	Size    int64             // Size in bytes
+	ModTime time.Time         // Last modification time (UTC for MLSD)
+	Facts   map[string]string // Facts of the MLSD listings, with lower case names
+}
+
+// IsDir tells if the entry is a directory
+func (e *Entry) IsDir() bool {
+	return e.Type == "dir" || e.Type == "cdir" || e.Type == "pdir"
+}
+
+// ParseListLine parses a line of a LIST listing in the "ls -l" format, like
+// "-rw-r--r-- 1 ftp ftp 1024 Jan  2 15:04 file.txt"
+func ParseListLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 9 || len(fields[0]) != 10 {
+		return nil, fmt.Errorf("unsupported LIST line: %q", line)
+	}
+
+	entry := &Entry{Type: "file"}
+	switch fields[0][0] {
+	case 'd':
+		entry.Type = "dir"
+	case 'l':
+		entry.Type = "link"
+	}
+
+	var err error
+	if entry.Size, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("bad size in LIST line: %q", line)
+	}
+	if entry.ModTime, err = parseListTime(fields[5], fields[6], fields[7]); err != nil {
+		return nil, fmt.Errorf("bad date in LIST line: %q", line)
+	}
+
+	// The name is what's after the date, it can contain spaces
+	name := line
+	for i := 0; i < 8; i++ {
+		name = strings.TrimLeft(name, " ")
+		name = name[strings.Index(name, " "):]
+	}
+	entry.Name = strings.TrimLeft(name, " ")
+	if entry.Type == "link" {
+		if arrow := strings.Index(entry.Name, " -> "); arrow >= 0 {
+			entry.Name = entry.Name[:arrow]
+		}
+	}
+	return entry, nil
+}
+
+// parseListTime parses the date of a LIST line, with a time for the last 6 months or a year otherwise
+func parseListTime(month, day, timeOrYear string) (time.Time, error) {
+	if strings.Contains(timeOrYear, ":") {
+		date, err := time.Parse("Jan 2 15:04", month+" "+day+" "+timeOrYear)
+		if err != nil {
+			return date, err
+		}
+		// The year is the one putting the date in the last 12 months
+		now := time.Now().UTC()
+		date = date.AddDate(now.Year(), 0, 0)
+		if date.After(now.AddDate(0, 0, 1)) {
+			date = date.AddDate(-1, 0, 0)
+		}
+		return date, nil
+	}
+	return time.Parse("Jan 2 2006", month+" "+day+" "+timeOrYear)
+}
+
+// ParseMLSDLine parses a line of a MLSD listing, like "Type=file;Size=1024;Modify=20060102150405; file.txt"
+func ParseMLSDLine(line string) (*Entry, error) {
+	separator := strings.Index(line, " ")
+	if separator < 0 {
+		return nil, fmt.Errorf("bad MLSD line: %q", line)
+	}
+
+	entry := &Entry{Name: line[separator+1:], Facts: make(map[string]string)}
+	for _, fact := range strings.Split(line[:separator], ";") {
+		if fact == "" {
+			continue
+		}
+		equal := strings.Index(fact, "=")
+		if equal < 0 {
+			return nil, fmt.Errorf("bad fact in MLSD line: %q", line)
+		}
+		entry.Facts[strings.ToLower(fact[:equal])] = fact[equal+1:]
+	}
+
+	entry.Type = strings.ToLower(entry.Facts["type"])
+	var err error
+	if size, ok := entry.Facts["size"]; ok {
+		if entry.Size, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return nil, fmt.Errorf("bad size in MLSD line: %q", line)
+		}
+	}
+	if modify, ok := entry.Facts["modify"]; ok {
+		// The fractions of seconds are optional
+		if dot := strings.Index(modify, "."); dot >= 0 {
+			modify = modify[:dot]
+		}
+		if entry.ModTime, err = time.Parse("20060102150405", modify); err != nil {
+			return nil, fmt.Errorf("bad date in MLSD line: %q", line)
+		}
+	}
+	return entry, nil
+}
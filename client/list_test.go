@@ -0,0 +1,61 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseListLine(t *testing.T) {
+	entry, err := ParseListLine("-rw-r--r-- 1 ftp ftp         1024 Jan  2  2006 my file.txt")
+	if err != nil {
+		t.Fatal("Couldn't parse:", err)
+	}
+	if entry.Name != "my file.txt" || entry.Type != "file" || entry.Size != 1024 ||
+		!entry.ModTime.Equal(time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Wrong entry: %+v", entry)
+	}
+
+	entry, err = ParseListLine("drwxr-xr-x 1 ftp ftp 4096 Mar 10 15:04 dir")
+	if err != nil || entry.Name != "dir" || !entry.IsDir() || entry.ModTime.Hour() != 15 {
+		t.Fatalf("Wrong entry: %+v %v", entry, err)
+	}
+	if entry.ModTime.After(time.Now().AddDate(0, 0, 1)) {
+		t.Fatal("The date should be in the last 12 months:", entry.ModTime)
+	}
+
+	entry, err = ParseListLine("lrwxrwxrwx 1 ftp ftp 4 Mar 10 15:04 link -> target")
+	if err != nil || entry.Name != "link" || entry.Type != "link" {
+		t.Fatalf("Wrong entry: %+v %v", entry, err)
+	}
+
+	if _, err = ParseListLine("total 12"); err == nil {
+		t.Fatal("The line shouldn't be parsed")
+	}
+}
+
+func TestParseMLSDLine(t *testing.T) {
+	entry, err := ParseMLSDLine("Type=file;Size=42;Modify=20060102150405.123;UNIX.mode=0644; my file.txt")
+	if err != nil {
+		t.Fatal("Couldn't parse:", err)
+	}
+	if entry.Name != "my file.txt" || entry.Type != "file" || entry.Size != 42 || entry.Facts["unix.mode"] != "0644" ||
+		!entry.ModTime.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Wrong entry: %+v", entry)
+	}
+
+	if _, err = ParseMLSDLine("Type=file;Size=x; file"); err == nil {
+		t.Fatal("The bad size should be refused")
+	}
+}
+
+func TestParsePassive(t *testing.T) {
+	if port, err := parseEPSV("Entering Extended Passive Mode (|||2122|)"); err != nil || port != "2122" {
+		t.Fatal("Wrong EPSV port:", port, err)
+	}
+	if address, err := parsePASV("Entering Passive Mode (10,0,0,1,8,74)"); err != nil || address != "10.0.0.1:2122" {
+		t.Fatal("Wrong PASV address:", address, err)
+	}
+	if _, err := parsePASV("Entering Passive Mode (10,0,0,1,8)"); err == nil {
+		t.Fatal("The bad PASV reply should be refused")
+	}
+}
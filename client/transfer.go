@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retrieve downloads a file (RETR) to w
+func (c *Conn) Retrieve(path string, w io.Writer) (int64, error) {
+	return c.receive("RETR "+path, w)
+}
+
+// Store uploads a file (STOR) from r
+func (c *Conn) Store(path string, r io.Reader) (int64, error) {
+	conn, err := c.openData("STOR " + path)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(&deadlineWriter{conn: conn, timeout: c.config.Timeout}, r)
+	if closeErr := c.closeUpload(conn); err == nil {
+		err = closeErr
+	}
+	if replyErr := c.transferReply("STOR " + path); err == nil {
+		err = replyErr
+	}
+	return size, err
+}
+
+// List lists a directory (LIST), path can be empty for the current directory
+func (c *Conn) List(path string) ([]*Entry, error) {
+	lines, err := c.listLines(strings.TrimSpace("LIST " + path))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(lines))
+	for _, line := range lines {
+		if entry, err := ParseListLine(line); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// MLSD lists a directory with its machine-readable listing (MLSD), path can be empty for the current directory
+func (c *Conn) MLSD(path string) ([]*Entry, error) {
+	lines, err := c.listLines(strings.TrimSpace("MLSD " + path))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(lines))
+	for _, line := range lines {
+		entry, err := ParseMLSDLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Type != "cdir" && entry.Type != "pdir" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (c *Conn) listLines(command string) ([]string, error) {
+	var listing strings.Builder
+	if _, err := c.receive(command, &listing); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(listing.String()))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// receive sends a command and copies the data it receives to w
+func (c *Conn) receive(command string, w io.Writer) (int64, error) {
+	conn, err := c.openData(command)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(w, &deadlineReader{conn: conn, timeout: c.config.Timeout})
+	conn.Close()
+	if replyErr := c.transferReply(command); err == nil {
+		err = replyErr
+	}
+	return size, err
+}
+
+// openData opens a passive data connection and sends the command using it
+func (c *Conn) openData(command string) (net.Conn, error) {
+	address, err := c.passive()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", address, c.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = c.expect(command, 125, 150); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if c.protected {
+		tlsConn := tls.Client(conn, c.config.TLSConfig)
+		tlsConn.SetDeadline(time.Now().Add(c.config.Timeout))
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			c.transferReply(command)
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// closeUpload ends the data connection of an upload. A TLS one is only half-closed first, and drained until the
+// server closes it: closing a socket while some data (like the TLS 1.3 session tickets) hasn't been read resets the
+// connection, and the server could then lose the end of the file.
+func (c *Conn) closeUpload(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return conn.Close()
+	}
+	if err := tlsConn.CloseWrite(); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
+	io.Copy(ioutil.Discard, conn)
+	return conn.Close()
+}
+
+// transferReply checks the reply sent at the end of a transfer
+func (c *Conn) transferReply(command string) error {
+	reply, err := c.ReadReply()
+	if err != nil {
+		return err
+	}
+	if reply.Code != 226 && reply.Code != 250 {
+		return &Error{Command: command, Reply: reply}
+	}
+	return nil
+}
+
+// passive returns the address of a new passive data connection (EPSV, or PASV if EPSV isn't supported)
+func (c *Conn) passive() (string, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if !c.config.DisableEPSV {
+		reply, err := c.Cmd("EPSV")
+		if err != nil {
+			return "", err
+		}
+		if reply.Code == 229 {
+			port, err := parseEPSV(reply.Message)
+			return net.JoinHostPort(host, port), err
+		}
+		if reply.Code != 500 && reply.Code != 502 {
+			return "", &Error{Command: "EPSV", Reply: reply}
+		}
+	}
+
+	reply, err := c.expect("PASV", 227)
+	if err != nil {
+		return "", err
+	}
+	return parsePASV(reply.Message)
+}
+
+// parseEPSV returns the port of an EPSV reply: "Entering Extended Passive Mode (|||port|)"
+func parseEPSV(message string) (string, error) {
+	start, end := strings.Index(message, "(|||"), strings.LastIndex(message, "|)")
+	if start < 0 || end < start+4 {
+		return "", fmt.Errorf("bad EPSV reply: %s", message)
+	}
+	port := message[start+4 : end]
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("bad EPSV port: %s", port)
+	}
+	return port, nil
+}
+
+// parsePASV returns the address of a PASV reply: "Entering Passive Mode (h1,h2,h3,h4,p1,p2)"
+func parsePASV(message string) (string, error) {
+	start, end := strings.Index(message, "("), strings.LastIndex(message, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("bad PASV reply: %s", message)
+	}
+	fields := strings.Split(message[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("bad PASV reply: %s", message)
+	}
+	numbers := make([]int, 6)
+	for i, field := range fields {
+		n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad PASV reply: %s", message)
+		}
+		numbers[i] = int(n)
+	}
+	host := fmt.Sprintf("%d.%d.%d.%d", numbers[0], numbers[1], numbers[2], numbers[3])
+	return net.JoinHostPort(host, strconv.Itoa(numbers[4]*256+numbers[5])), nil
+}
+
+// deadlineReader renews the deadline of a data connection before each read
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// deadlineWriter renews the deadline of a data connection before each write
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.conn.Write(p)
+}
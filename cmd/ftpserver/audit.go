@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/fclairamb/ftpserver/audit"
+	"github.com/fclairamb/ftpserver/log/syslog"
+	"github.com/fclairamb/ftpserver/server"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// newAuditSink creates the audit trail described by the configuration, nil is returned when there's none
+func newAuditSink(config *AuditConfig, logger log.Logger) (server.AuditSink, error) {
+	onError := func(err error) {
+		level.Error(logger).Log("msg", "Couldn't record an audit event", "err", err)
+	}
+
+	var sinks []server.AuditSink
+	if config.File != "" {
+		sink, err := audit.NewFileSink(config.File, int64(config.MaxSizeMB)*1024*1024, config.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink.OnError = onError
+		sinks = append(sinks, sink)
+	}
+	if config.Syslog {
+		sink, err := audit.NewSyslogSink("", "", "ftpserver")
+		if err != nil {
+			return nil, err
+		}
+		sink.OnError = onError
+		sinks = append(sinks, sink)
+	}
+	if config.SyslogAddr != "" {
+		sink, err := syslog.Open(config.SyslogAddr, syslog.FacilityAuth, "ftpserver")
+		if err != nil {
+			return nil, err
+		}
+		sink.OnError = onError
+		sinks = append(sinks, sink)
+	}
+	if config.Webhook != "" {
+		sink := audit.NewWebhookSink(config.Webhook, 1000)
+		sink.OnError = onError
+		sinks = append(sinks, sink)
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	default:
+		return audit.Multi(sinks...), nil
+	}
+}
+
+// newTranscriptSink creates the recorder of the session transcripts described by the configuration, nil is returned
+// when there's none
+func newTranscriptSink(config *TranscriptConfig, logger log.Logger) (server.TranscriptSink, error) {
+	if config.File == "" {
+		return nil, nil
+	}
+	sink, err := audit.NewFileSink(config.File, int64(config.MaxSizeMB)*1024*1024, config.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	sink.OnError = func(err error) {
+		level.Error(logger).Log("msg", "Couldn't record a transcript entry", "err", err)
+	}
+	return sink, nil
+}
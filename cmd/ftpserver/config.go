@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	ftpconfig "github.com/fclairamb/ftpserver/config"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Config is the content of the configuration file
+type Config struct {
+	Welcome    string           `toml:"welcome"`    // Welcome message
+	Server     server.Settings  `toml:"server"`     // Server settings
+	TLS        TLSConfig        `toml:"tls"`        // TLS setup
+	Log        LogConfig        `toml:"log"`        // Logging setup
+	Audit      AuditConfig      `toml:"audit"`      // Audit trail of the security-relevant events
+	Transcript TranscriptConfig `toml:"transcript"` // Transcripts of the sessions
+	Uploads    UploadsConfig    `toml:"uploads"`    // Notification of the uploads
+	Events     EventsConfig     `toml:"events"`     // Publication of the session and transfer events
+	Metrics    MetricsConfig    `toml:"metrics"`    // Publication of the metrics
+	PublicIP   PublicIPConfig   `toml:"public_ip"`  // Public IP resolution
+	Privileges PrivilegesConfig `toml:"privileges"` // Privileges dropped once the listeners are bound
+	Users      []UserConfig     `toml:"users"`      // Users allowed to connect
+	UsersFile  string           `toml:"users_file"` // Virtual users file (TOML, JSON or YAML), in addition to the users
+	Listeners  []ListenerConfig `toml:"listeners"`  // Additional listeners, with their own settings and users
+}
+
+// ListenerConfig defines an additional listener of the process, like an internal one more permissive than the one
+// facing the internet. Its settings don't inherit the main ones, the other parts of the configuration do when they
+// aren't defined.
+type ListenerConfig struct {
+	Name      string          `toml:"name"`       // Name of the listener, in the logs and the handoffs
+	Welcome   string          `toml:"welcome"`    // Welcome message (the main one if empty)
+	Server    server.Settings `toml:"server"`     // Server settings of the listener
+	TLS       TLSConfig       `toml:"tls"`        // TLS setup (the main one if not defined)
+	Users     []UserConfig    `toml:"users"`      // Users allowed to connect (the main ones if neither them nor a users file is defined)
+	UsersFile string          `toml:"users_file"` // Virtual users file
+}
+
+// PrivilegesConfig defines the identity the process switches to once its listeners are bound, so that it only runs as
+// root to bind the ports below 1024. The files opened afterwards (users file, home directories, rotated logs) must be
+// accessible to it, with their paths relative to the chroot if there's one.
+type PrivilegesConfig struct {
+	User   string `toml:"user"`   // User to run as (name or uid)
+	Group  string `toml:"group"`  // Group to run as (name or gid), the primary group of the user if empty
+	Chroot string `toml:"chroot"` // Directory the process is confined to (optional)
+}
+
+// PublicIPConfig defines how the public IP advertised for passive connections is found when it isn't set
+type PublicIPConfig struct {
+	// Resolver: "aws" or "gcp" for the instance metadata, an http(s) URL returning the IP as text,
+	// "stun:host:port" for a STUN server or a static IP address
+	Resolver string `toml:"resolver"`
+}
+
+// TLSConfig defines the certificate to use for TLS connections
+type TLSConfig struct {
+	CertFile     string `toml:"cert_file"`      // Certificate file (PEM)
+	KeyFile      string `toml:"key_file"`       // Private key file (PEM)
+	DataCertFile string `toml:"data_cert_file"` // Certificate file of the data connections (the main one if not defined)
+	DataKeyFile  string `toml:"data_key_file"`  // Private key file of the data connections
+}
+
+// LogConfig defines where and how to log
+type LogConfig struct {
+	Destination string `toml:"destination"` // "stdout", "stderr" or a file path
+	Format      string `toml:"format"`      // "logfmt" or "json"
+	Level       string `toml:"level"`       // "debug", "info", "warn" or "error"
+	Syslog      string `toml:"syslog"`      // Syslog destination used instead: "local", "udp://host:port" or "tcp://host:port"
+}
+
+// AuditConfig defines where the audit trail goes, the events are written as JSON
+type AuditConfig struct {
+	File       string `toml:"file"`        // File, rotated when it reaches max_size_mb
+	MaxSizeMB  int    `toml:"max_size_mb"` // Max size of the file in MB (no rotation if 0)
+	MaxBackups int    `toml:"max_backups"` // Number of rotated files kept
+	Syslog     bool   `toml:"syslog"`      // Send the events to the local syslog
+	SyslogAddr string `toml:"syslog_addr"` // Send the events as RFC 5424 messages to "local", "udp://host:port" or "tcp://host:port"
+	Webhook    string `toml:"webhook"`     // URL receiving each event in a POST
+}
+
+// TranscriptConfig defines where the transcripts of the sessions (commands, replies and transfer manifests) go, the
+// entries are written as JSON
+type TranscriptConfig struct {
+	File       string `toml:"file"`        // File, rotated when it reaches max_size_mb
+	MaxSizeMB  int    `toml:"max_size_mb"` // Max size of the file in MB (no rotation if 0)
+	MaxBackups int    `toml:"max_backups"` // Number of rotated files kept
+}
+
+// UploadsConfig defines where the successful uploads are notified
+type UploadsConfig struct {
+	Webhook string `toml:"webhook"` // URL receiving a JSON payload after each upload
+	Secret  string `toml:"secret"`  // Key of the HMAC-SHA256 signature of the payloads (optional)
+	Retries int    `toml:"retries"` // Number of retries of the failed notifications
+}
+
+// EventsConfig defines where the session and transfer events are published
+type EventsConfig struct {
+	NATS      string `toml:"nats"`       // Address (host:port) of the NATS server
+	NATSToken string `toml:"nats_token"` // Authentication token of the NATS server (optional)
+	Syslog    string `toml:"syslog"`     // Syslog destination used instead of NATS: "local", "udp://host:port"...
+	Prefix    string `toml:"prefix"`     // Prefix of the subjects, "ftp" by default
+}
+
+// MetricsConfig defines where the metrics are published
+type MetricsConfig struct {
+	Statsd     string   `toml:"statsd"`      // Address (host:port) of the statsd agent
+	Prefix     string   `toml:"prefix"`      // Prefix of the metrics names, "ftp" by default
+	StatsdTags []string `toml:"statsd_tags"` // Tags ("key:value") added to all the metrics
+	Expvar     bool     `toml:"expvar"`      // Publish the metrics with expvar
+}
+
+// UserConfig defines a user and its home directory
+type UserConfig struct {
+	User string `toml:"user"` // User name
+	Pass string `toml:"pass"` // Password, in clear or as a crypt hash ($2b$, $argon2id$, $6$...)
+	Dir  string `toml:"dir"`  // Home directory, the data directory is used if not specified
+}
+
+// loadConfig reads the configuration file (TOML, JSON or YAML), an empty file name gives the default configuration
+func loadConfig(fileName string) (*Config, error) {
+	config := &Config{}
+
+	if fileName != "" {
+		if err := ftpconfig.DecodeFile(fileName, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// The server settings can be overridden by the environment (FTPSERVER_LISTEN_PORT, FTPSERVER_DATA_PORT_RANGE...)
+	if err := ftpconfig.ApplySettingsEnv(&config.Server); err != nil {
+		return nil, err
+	}
+
+	if config.Welcome == "" {
+		config.Welcome = "Welcome on ftpserver"
+	}
+
+	return config, nil
+}
+
+// applyOptions overrides the configuration with the command line options
+func (config *Config) applyOptions(opt *options) error {
+	if opt.listen != "" {
+		host, port, err := splitHostPort(opt.listen)
+		if err != nil {
+			return err
+		}
+		config.Server.ListenHost = host
+		config.Server.ListenPort = port
+	}
+
+	if opt.publicHost != "" {
+		config.Server.PublicHost = opt.publicHost
+	}
+
+	if opt.tlsCert != "" {
+		config.TLS.CertFile = opt.tlsCert
+	}
+	if opt.tlsKey != "" {
+		config.TLS.KeyFile = opt.tlsKey
+	}
+
+	if opt.log != "" {
+		config.Log.Destination = opt.log
+	}
+	if opt.logFormat != "" {
+		config.Log.Format = opt.logFormat
+	}
+	if opt.logLevel != "" {
+		config.Log.Level = opt.logLevel
+	}
+
+	if opt.user != "" {
+		config.Users = append(config.Users, UserConfig{User: opt.user, Pass: opt.pass})
+	}
+
+	for i := range config.Users {
+		if config.Users[i].Dir == "" {
+			config.Users[i].Dir = opt.dataDir
+		}
+	}
+	for _, listener := range config.Listeners {
+		for i := range listener.Users {
+			if listener.Users[i].Dir == "" {
+				listener.Users[i].Dir = opt.dataDir
+			}
+		}
+	}
+
+	return config.check()
+}
+
+// listenerConfigs returns the configuration of each listener: the main one, then the additional ones
+func (config *Config) listenerConfigs() []*Config {
+	configs := []*Config{config}
+	for _, listener := range config.Listeners {
+		c := *config
+		c.Listeners = nil
+		c.Server = listener.Server
+		if listener.Welcome != "" {
+			c.Welcome = listener.Welcome
+		}
+		if listener.TLS.CertFile != "" {
+			c.TLS = listener.TLS
+		}
+		if len(listener.Users) > 0 || listener.UsersFile != "" {
+			c.Users, c.UsersFile = listener.Users, listener.UsersFile
+		}
+		configs = append(configs, &c)
+	}
+	return configs
+}
+
+// check makes sure the configuration can be used
+func (config *Config) check() error {
+	if len(config.Users) == 0 && config.UsersFile == "" {
+		return errors.New("no user is defined, use the config file or the -user and -pass options")
+	}
+
+	for _, u := range config.Users {
+		if u.User == "" {
+			return errors.New("a user has no name")
+		}
+		if u.Dir == "" {
+			return fmt.Errorf("user %s has no directory, use the -data option", u.User)
+		}
+	}
+
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		return errors.New("both the TLS certificate and key files must be specified")
+	}
+	if (config.TLS.DataCertFile == "") != (config.TLS.DataKeyFile == "") {
+		return errors.New("both the data TLS certificate and key files must be specified")
+	}
+
+	if _, err := newPublicIPResolver(config.PublicIP.Resolver); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for i, listener := range config.Listeners {
+		if listener.Name == "" || names[listener.Name] {
+			return fmt.Errorf("listener %d must have a unique name", i+1)
+		}
+		names[listener.Name] = true
+	}
+	for i, c := range config.listenerConfigs()[1:] {
+		if err := c.check(); err != nil {
+			return fmt.Errorf("listener %s: %v", config.Listeners[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// newPublicIPResolver creates the public IP resolver of the configuration, nil if none is defined
+func newPublicIPResolver(resolver string) (server.PublicIPResolver, error) {
+	switch {
+	case resolver == "":
+		return nil, nil
+	case resolver == "aws":
+		return server.NewAWSIPResolver(), nil
+	case resolver == "gcp":
+		return server.NewGCPIPResolver(), nil
+	case strings.HasPrefix(resolver, "http://") || strings.HasPrefix(resolver, "https://"):
+		return &server.HTTPIPResolver{URL: resolver}, nil
+	case strings.HasPrefix(resolver, "stun:"):
+		return &server.STUNIPResolver{Server: strings.TrimPrefix(resolver, "stun:")}, nil
+	}
+
+	if ip := net.ParseIP(resolver); ip != nil {
+		return server.StaticIPResolver(ip), nil
+	}
+	return nil, fmt.Errorf("bad public IP resolver: %s", resolver)
+}
+
+// splitHostPort parses a "host:port" listening address
+func splitHostPort(address string) (string, int, error) {
+	i := strings.LastIndex(address, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("bad listening address %s, host:port is expected", address)
+	}
+
+	port, err := strconv.Atoi(address[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("bad listening port in %s: %v", address, err)
+	}
+
+	return address[:i], port, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func TestSampleConfig(t *testing.T) {
+	config, err := loadConfig("ftpserver.toml")
+	if err != nil {
+		t.Fatal("Couldn't load the config:", err)
+	}
+
+	if config.Server.DataPortRange == nil || config.Server.DataPortRange.Start != 2122 {
+		t.Fatal("Bad data port range:", config.Server.DataPortRange)
+	}
+
+	if err := config.applyOptions(&options{user: "test", pass: "test", dataDir: "/data", listen: "127.0.0.1:21"}); err != nil {
+		t.Fatal("Couldn't apply the options:", err)
+	}
+
+	if config.Server.ListenHost != "127.0.0.1" || config.Server.ListenPort != 21 {
+		t.Fatal("Bad listening address:", config.Server.ListenHost, config.Server.ListenPort)
+	}
+
+	if len(config.Users) != 1 || config.Users[0].Dir != "/data" {
+		t.Fatal("Bad users:", config.Users)
+	}
+}
+
+func TestListenersConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ftpserver.toml")
+	if err := ioutil.WriteFile(file, []byte(`
+welcome = "Public"
+
+[server]
+listen_port = 2121
+
+[[users]]
+user = "guest"
+pass = "guest"
+
+[[listeners]]
+name = "internal"
+[listeners.server]
+listen_port = 2221
+[[listeners.users]]
+user = "admin"
+pass = "admin"
+
+[[listeners]]
+name = "backup"
+welcome = "Backup"
+[listeners.server]
+listen_port = 2321
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(file)
+	if err != nil {
+		t.Fatal("Couldn't load the config:", err)
+	}
+	if err := config.applyOptions(&options{dataDir: "/data"}); err != nil {
+		t.Fatal("Couldn't apply the options:", err)
+	}
+
+	configs := config.listenerConfigs()
+	if len(configs) != 3 {
+		t.Fatal("Bad number of listeners:", len(configs))
+	}
+	if internal := configs[1]; internal.Server.ListenPort != 2221 || internal.Welcome != "Public" ||
+		len(internal.Users) != 1 || internal.Users[0].User != "admin" || internal.Users[0].Dir != "/data" {
+		t.Fatalf("Bad internal listener: %+v", internal)
+	}
+	if backup := configs[2]; backup.Server.ListenPort != 2321 || backup.Welcome != "Backup" ||
+		len(backup.Users) != 1 || backup.Users[0].User != "guest" {
+		t.Fatalf("Bad backup listener: %+v", backup)
+	}
+
+	config.Listeners[1].Name = "internal"
+	if err := config.check(); err == nil {
+		t.Fatal("Listeners with the same name should be refused")
+	}
+}
+
+func TestConfigWithoutUser(t *testing.T) {
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal("Couldn't load the default config:", err)
+	}
+
+	if err := config.applyOptions(&options{}); err == nil {
+		t.Fatal("A config without user should be refused")
+	}
+}
+
+func TestRealPath(t *testing.T) {
+	driver := &clientDriver{root: "/data/user"}
+	for p, expected := range map[string]string{
+		"/":              "/data/user",
+		"/dir/file":      "/data/user/dir/file",
+		"/../../etc":     "/data/user/etc",
+		"dir/../../file": "/data/user/file",
+	} {
+		if real := driver.realPath(p); real != expected {
+			t.Fatal("Bad path for", p, ":", real)
+		}
+	}
+}
+
+// pathContext is a client in a directory
+type pathContext struct {
+	server.ClientContext
+	path string
+}
+
+func (cc *pathContext) Path() string { return cc.path }
+
+func TestIterateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i := 0; i < dirBatchSize+10; i++ {
+		ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), nil, 0644)
+	}
+
+	files, err := (&clientDriver{root: dir}).IterateFiles(&pathContext{path: "/"})
+	if err != nil {
+		t.Fatal("Couldn't list the directory:", err)
+	}
+	defer files.Close()
+	nb := 0
+	for {
+		if _, err = files.Next(); err != nil {
+			break
+		}
+		nb++
+	}
+	if err != io.EOF || nb != dirBatchSize+10 {
+		t.Fatal("Wrong listing:", nb, err)
+	}
+}
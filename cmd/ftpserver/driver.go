@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fclairamb/ftpserver/credentials"
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// mainDriver authenticates the users of the configuration
+type mainDriver struct {
+	config    *Config         // Configuration
+	users     vusers.Database // Virtual users (if a users file is defined)
+	tlsConfig *tls.Config     // TLS config (if the certificate is defined)
+	dataTLS   *tls.Config     // TLS config of the data connections (if their certificate is defined)
+	tlsMutex  sync.Mutex      // TLS config loading sync
+}
+
+// newMainDriver creates the main driver
+func newMainDriver(config *Config) (*mainDriver, error) {
+	driver := &mainDriver{config: config}
+	if config.UsersFile != "" {
+		users, err := vusers.NewFileDatabase(config.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		driver.users = users
+	}
+	return driver, nil
+}
+
+// GetSettings returns the server settings of the configuration
+func (driver *mainDriver) GetSettings() *server.Settings {
+	return &driver.config.Server
+}
+
+// WelcomeUser sends the welcome message of the configuration
+func (driver *mainDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return driver.config.Welcome, nil
+}
+
+// UserLeft is called when the user disconnects
+func (driver *mainDriver) UserLeft(cc server.ClientContext) {
+}
+
+// checkPass compares a password with the one of a configured user, which can be a crypt hash
+func checkPass(expected, pass string) bool {
+	if credentials.Supported(expected) {
+		ok, err := credentials.Verify(expected, pass)
+		return ok && err == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) == 1
+}
+
+// AuthUser authenticates the user against the users of the configuration, then the virtual users
+func (driver *mainDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	for _, u := range driver.config.Users {
+		if u.User == user && checkPass(u.Pass, pass) {
+			if err := os.MkdirAll(u.Dir, 0755); err != nil {
+				return nil, fmt.Errorf("couldn't create the home directory: %v", err)
+			}
+			return &clientDriver{root: u.Dir}, nil
+		}
+	}
+
+	if driver.users != nil {
+		u, err := vusers.Authenticate(driver.users, user, pass)
+		if err != nil {
+			return nil, err
+		}
+		return vusers.NewClientDriver(u)
+	}
+
+	return nil, errors.New("bad username or password")
+}
+
+// GetTLSConfig loads the certificate of the configuration
+func (driver *mainDriver) GetTLSConfig() (*tls.Config, error) {
+	driver.tlsMutex.Lock()
+	defer driver.tlsMutex.Unlock()
+
+	if driver.tlsConfig == nil {
+		if driver.config.TLS.CertFile == "" {
+			return nil, errors.New("TLS isn't configured")
+		}
+
+		cert, err := tls.LoadX509KeyPair(driver.config.TLS.CertFile, driver.config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		driver.tlsConfig = &tls.Config{
+			NextProtos:   []string{"ftp"},
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+	return driver.tlsConfig, nil
+}
+
+// loadCertificates loads the TLS certificates of the configuration ahead of their first use, while they are still
+// readable by the process
+func (driver *mainDriver) loadCertificates() error {
+	if driver.config.TLS.CertFile != "" {
+		if _, err := driver.GetTLSConfig(); err != nil {
+			return err
+		}
+	}
+	if driver.config.TLS.DataCertFile != "" {
+		if _, err := driver.GetDataTLSConfig(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDataTLSConfig loads the certificate of the data connections, the main one is used if it isn't defined
+func (driver *mainDriver) GetDataTLSConfig(cc server.ClientContext) (*tls.Config, error) {
+	if driver.config.TLS.DataCertFile == "" {
+		return driver.GetTLSConfig()
+	}
+
+	driver.tlsMutex.Lock()
+	defer driver.tlsMutex.Unlock()
+
+	if driver.dataTLS == nil {
+		cert, err := tls.LoadX509KeyPair(driver.config.TLS.DataCertFile, driver.config.TLS.DataKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		driver.dataTLS = &tls.Config{
+			NextProtos:   []string{"ftp"},
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+	return driver.dataTLS, nil
+}
+
+// clientDriver gives access to the home directory of a user
+type clientDriver struct {
+	root string // Home directory
+}
+
+// realPath converts an FTP path to a path in the home directory, it can't get out of it
+func (driver *clientDriver) realPath(p string) string {
+	if filepath.Separator == '\\' {
+		// Backslashes are separators here: they are translated before cleaning the path so that "..\" can't escape
+		p = strings.Replace(p, "\\", "/", -1)
+	}
+	return filepath.Join(driver.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *clientDriver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	info, err := os.Stat(driver.realPath(directory))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+	return nil
+}
+
+// MakeDirectory creates a directory
+func (driver *clientDriver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return os.Mkdir(driver.realPath(directory), 0755)
+}
+
+// ListFiles lists the files of the current directory
+func (driver *clientDriver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(driver.realPath(cc.Path()))
+}
+
+// IterateFiles reads the files of the current directory by batches, as the listing is sent
+func (driver *clientDriver) IterateFiles(cc server.ClientContext) (server.FileIterator, error) {
+	dir, err := os.Open(driver.realPath(cc.Path()))
+	if err != nil {
+		return nil, err
+	}
+	return &dirIterator{dir: dir}, nil
+}
+
+// dirIterator iterates over the files of a directory
+type dirIterator struct {
+	dir   *os.File      // Directory being read
+	files []os.FileInfo // Files read and not returned yet
+}
+
+// dirBatchSize is the number of files read at once by a dirIterator
+const dirBatchSize = 256
+
+// Next returns the next file of the directory
+func (it *dirIterator) Next() (os.FileInfo, error) {
+	if len(it.files) == 0 {
+		files, err := it.dir.Readdir(dirBatchSize)
+		if err != nil {
+			return nil, err // io.EOF at the end
+		}
+		it.files = files
+	}
+	file := it.files[0]
+	it.files = it.files[1:]
+	return file, nil
+}
+
+// Close closes the directory
+func (it *dirIterator) Close() error {
+	return it.dir.Close()
+}
+
+// OpenFile opens a file in 3 possible modes: read, write, appending write
+func (driver *clientDriver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
+	if (flag & os.O_WRONLY) != 0 {
+		flag |= os.O_CREATE
+		if (flag & os.O_APPEND) == 0 {
+			flag |= os.O_TRUNC
+		}
+	}
+
+	return openFile(driver.realPath(path), flag, 0644)
+}
+
+// DeleteFile deletes a file or a directory
+func (driver *clientDriver) DeleteFile(cc server.ClientContext, path string) error {
+	return os.Remove(driver.realPath(path))
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *clientDriver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+	return os.Stat(driver.realPath(path))
+}
+
+// RenameFile renames a file or a directory
+func (driver *clientDriver) RenameFile(cc server.ClientContext, from, to string) error {
+	return os.Rename(driver.realPath(from), driver.realPath(to))
+}
+
+// CanAllocate gives the approval to allocate some data
+func (driver *clientDriver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return true, nil
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *clientDriver) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
+	return os.Chmod(driver.realPath(path), mode)
+}
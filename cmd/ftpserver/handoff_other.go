@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyHandoff sends the SIGUSR2 signals, which start a new process taking over the listeners, to ch
+func notifyHandoff(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGUSR2)
+}
@@ -0,0 +1,8 @@
+package main
+
+import (
+	"os"
+)
+
+// notifyHandoff does nothing, the listeners can't be passed to another process on Windows
+func notifyHandoff(ch chan<- os.Signal) {}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fclairamb/ftpserver/log/syslog"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// newLogger creates the logger described by the configuration
+func newLogger(config *LogConfig) (log.Logger, error) {
+	var w io.Writer
+	switch {
+	case config.Syslog != "":
+		writer, err := syslog.Open(config.Syslog, syslog.FacilityDaemon, "ftpserver")
+		if err != nil {
+			return nil, err
+		}
+		w = writer
+	case config.Destination == "", config.Destination == "stdout":
+		w = os.Stdout
+	case config.Destination == "stderr":
+		w = os.Stderr
+	default:
+		file, err := os.OpenFile(config.Destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+	w = log.NewSyncWriter(w)
+
+	var logger log.Logger
+	switch config.Format {
+	case "", "logfmt":
+		logger = log.NewLogfmtLogger(w)
+	case "json":
+		logger = log.NewJSONLogger(w)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", config.Format)
+	}
+
+	switch config.Level {
+	case "debug":
+		logger = level.NewFilter(logger, level.AllowDebug())
+	case "", "info":
+		logger = level.NewFilter(logger, level.AllowInfo())
+	case "warn":
+		logger = level.NewFilter(logger, level.AllowWarn())
+	case "error":
+		logger = level.NewFilter(logger, level.AllowError())
+	default:
+		return nil, fmt.Errorf("unknown log level: %s", config.Level)
+	}
+
+	return log.With(logger, "ts", log.DefaultTimestampUTC), nil
+}
@@ -0,0 +1,345 @@
+// ftpserver is a ready to use FTP(S) server serving local directories.
+//
+// Its configuration comes from a TOML, JSON or YAML file (see ftpserver.toml), overridden by the command line options.
+// Each option can also be provided with an FTPSERVER_ prefixed environment variable (FTPSERVER_USER for -user).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fclairamb/ftpserver/events"
+	"github.com/fclairamb/ftpserver/log/gokit"
+	"github.com/fclairamb/ftpserver/log/syslog"
+	"github.com/fclairamb/ftpserver/metrics"
+	"github.com/fclairamb/ftpserver/notify"
+	"github.com/fclairamb/ftpserver/server"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// envPrefix is the prefix of the environment variables providing the options
+const envPrefix = "FTPSERVER_"
+
+// options are the command line options
+type options struct {
+	conf       string
+	dataDir    string
+	listen     string
+	publicHost string
+	user       string
+	pass       string
+	tlsCert    string
+	tlsKey     string
+	log        string
+	logFormat  string
+	logLevel   string
+	service    string
+	check      bool
+}
+
+func parseOptions() (*options, error) {
+	opt := &options{}
+	fs := flag.NewFlagSet("ftpserver", flag.ExitOnError)
+	fs.StringVar(&opt.conf, "conf", "", "Configuration file")
+	fs.StringVar(&opt.dataDir, "data", "", "Data directory of the users that don't define one")
+	fs.StringVar(&opt.listen, "listen", "", "Listening address (host:port)")
+	fs.StringVar(&opt.publicHost, "public-host", "", "Public IP or host name to expose for passive connections")
+	fs.StringVar(&opt.user, "user", "", "Additional user")
+	fs.StringVar(&opt.pass, "pass", "", "Password of the additional user")
+	fs.StringVar(&opt.tlsCert, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&opt.tlsKey, "tls-key", "", "TLS private key file")
+	fs.StringVar(&opt.log, "log", "", "Log destination: stdout, stderr or a file")
+	fs.StringVar(&opt.logFormat, "log-format", "", "Log format: logfmt or json")
+	fs.StringVar(&opt.logLevel, "log-level", "", "Log level: debug, info, warn or error")
+	fs.StringVar(&opt.service, "service", "", "Windows service setup: install or uninstall")
+	fs.BoolVar(&opt.check, "check", false, "Check the configuration and exit, without listening")
+
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+
+	// Options that weren't set on the command line can come from the environment
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if value, ok := os.LookupEnv(name); ok && !set[f.Name] && err == nil {
+			if err = f.Value.Set(value); err != nil {
+				err = fmt.Errorf("bad value for %s: %v", name, err)
+			}
+		}
+	})
+
+	return opt, err
+}
+
+func main() {
+	opt, err := parseOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if opt.service != "" {
+		if err := controlService(opt.service); err != nil {
+			fmt.Fprintln(os.Stderr, "Couldn't", opt.service, "the service:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	config, err := loadConfig(opt.conf)
+	if err == nil {
+		err = config.applyOptions(opt)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad configuration:", err)
+		os.Exit(2)
+	}
+
+	privileges, err := newPrivileges(&config.Privileges)
+	if err == nil {
+		err = privileges.checkActivePort(config)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad configuration:", err)
+		os.Exit(2)
+	}
+
+	logger, err := newLogger(&config.Log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't setup logging:", err)
+		os.Exit(2)
+	}
+
+	auditSink, err := newAuditSink(&config.Audit, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't setup the audit trail:", err)
+		os.Exit(2)
+	}
+
+	transcript, err := newTranscriptSink(&config.Transcript, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't setup the session transcripts:", err)
+		os.Exit(2)
+	}
+
+	var (
+		uploadNotifier server.UploadNotifier
+		eventListener  server.EventListener
+		collector      metrics.Collector
+	)
+	if config.Uploads.Webhook != "" {
+		notifier := notify.NewWebhookNotifier(config.Uploads.Webhook, []byte(config.Uploads.Secret),
+			config.Uploads.Retries, 1000)
+		notifier.OnError = func(err error) {
+			level.Error(logger).Log("msg", "Couldn't notify an upload", "err", err)
+		}
+		uploadNotifier = notifier
+	}
+	if config.Events.NATS != "" || config.Events.Syslog != "" {
+		prefix := config.Events.Prefix
+		if prefix == "" {
+			prefix = "ftp"
+		}
+		var publisher events.Publisher = &events.NATSPublisher{Address: config.Events.NATS, Token: config.Events.NATSToken}
+		if config.Events.NATS == "" {
+			if publisher, err = syslog.Open(config.Events.Syslog, syslog.FacilityDaemon, "ftpserver"); err != nil {
+				fmt.Fprintln(os.Stderr, "Couldn't setup the events:", err)
+				os.Exit(2)
+			}
+		}
+		exporter := events.NewExporter(publisher, prefix, 10000)
+		exporter.OnError = func(err error) {
+			level.Error(logger).Log("msg", "Couldn't publish an event", "err", err)
+		}
+		eventListener = exporter
+	}
+	var collectors []metrics.Collector
+	if config.Metrics.Statsd != "" {
+		prefix := config.Metrics.Prefix
+		if prefix == "" {
+			prefix = "ftp"
+		}
+		statsd, err := metrics.NewStatsd(config.Metrics.Statsd, prefix, config.Metrics.StatsdTags...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Couldn't setup the metrics:", err)
+			os.Exit(2)
+		}
+		statsd.OnError = func(err error) {
+			level.Debug(logger).Log("msg", "Couldn't send a metric", "err", err)
+		}
+		collectors = append(collectors, statsd)
+	}
+	if config.Metrics.Expvar {
+		collectors = append(collectors, metrics.NewExpvar("ftpserver"))
+	}
+	if len(collectors) > 0 {
+		collector = metrics.Multi(collectors...)
+	}
+
+	// The main listener, then the additional ones with their own settings and users
+	var (
+		servers []*server.FtpServer
+		drivers []*mainDriver
+	)
+	for i, listenerConfig := range config.listenerConfigs() {
+		driver, err := newMainDriver(listenerConfig)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Couldn't load the users:", err)
+			os.Exit(2)
+		}
+		drivers = append(drivers, driver)
+
+		ftpServer := server.NewFtpServer(driver)
+		serverLogger := log.With(logger, "component", "server")
+		if i > 0 {
+			ftpServer.Name = config.Listeners[i-1].Name
+			serverLogger = log.With(serverLogger, "listener", ftpServer.Name)
+		}
+		ftpServer.Logger = gokit.New(serverLogger)
+		ftpServer.PublicIPResolver, _ = newPublicIPResolver(config.PublicIP.Resolver) // Already checked
+		ftpServer.AuditSink = auditSink
+		ftpServer.Transcript = transcript
+		ftpServer.UploadNotifier = uploadNotifier
+		ftpServer.EventListener = eventListener
+		ftpServer.Metrics = collector
+		servers = append(servers, ftpServer)
+	}
+
+	if opt.check {
+		if !checkServers(servers, drivers) {
+			os.Exit(1)
+		}
+		fmt.Println("Configuration OK")
+		return
+	}
+
+	if isService, err := runService(servers); isService || err != nil {
+		if err != nil {
+			level.Error(logger).Log("msg", "Problem running the service", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// All the listeners are bound before the privileges are dropped
+	for _, ftpServer := range servers {
+		if err := ftpServer.Listen(); err != nil {
+			level.Error(logger).Log("msg", "Problem listening", "err", err)
+			os.Exit(1)
+		}
+	}
+	if privileges != nil {
+		for _, driver := range drivers {
+			if err := driver.loadCertificates(); err != nil {
+				level.Error(logger).Log("msg", "Couldn't load the TLS certificates", "err", err)
+				os.Exit(1)
+			}
+		}
+		if err := privileges.drop(); err != nil {
+			level.Error(logger).Log("msg", "Couldn't drop the privileges", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Privileges dropped", "uid", os.Getuid(), "gid", os.Getgid())
+	}
+
+	go signalHandler(servers, logger)
+
+	var serving sync.WaitGroup
+	for _, ftpServer := range servers {
+		serving.Add(1)
+		go func(ftpServer *server.FtpServer) {
+			defer serving.Done()
+			ftpServer.Serve()
+		}(ftpServer)
+	}
+	serving.Wait()
+	draining.Wait()
+}
+
+// checkServers validates the settings and the certificates of the servers, for a dry run of the configuration. The
+// problems are reported on stderr.
+func checkServers(servers []*server.FtpServer, drivers []*mainDriver) bool {
+	ok := true
+	for i, ftpServer := range servers {
+		name := ftpServer.Name
+		if name == "" {
+			name = "main"
+		}
+		var problems []string
+		if err := ftpServer.Validate(); err != nil {
+			if configErr, isConfigErr := err.(*server.ConfigError); isConfigErr {
+				problems = configErr.Problems
+			} else {
+				problems = []string{err.Error()}
+			}
+		}
+		if err := drivers[i].loadCertificates(); err != nil {
+			problems = append(problems, fmt.Sprintf("TLS certificates: %v", err))
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Listener %s: %s\n", name, problem)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// draining is done once the sessions handed off to a new process are over
+var draining sync.WaitGroup
+
+// signalHandler stops the servers on SIGTERM and SIGINT. On SIGUSR2, the binary is started again to take over the
+// listeners, and the servers wait for the end of their sessions (or another signal) before exiting.
+func signalHandler(servers []*server.FtpServer, logger log.Logger) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	notifyHandoff(ch)
+	for sig := range ch {
+		if sig == syscall.SIGTERM || sig == syscall.SIGINT {
+			for _, ftpServer := range servers {
+				ftpServer.Stop()
+			}
+			return
+		}
+
+		draining.Add(1)
+		if err := handoff(servers); err != nil {
+			level.Error(logger).Log("msg", "Couldn't hand off the listeners", "err", err)
+			draining.Done()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-ch
+			cancel()
+		}()
+		for _, ftpServer := range servers {
+			ftpServer.Drain(ctx)
+		}
+		draining.Done()
+		return
+	}
+}
+
+// handoff starts the binary again with the same arguments, taking over the listeners of the servers
+func handoff(servers []*server.FtpServer) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return server.HandoffAll(cmd, servers...)
+}
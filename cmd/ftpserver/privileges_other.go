@@ -0,0 +1,125 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// privileges are the identity the process switches to once its listeners are bound
+type privileges struct {
+	uid    int    // User ID, -1 to keep the current one
+	gid    int    // Group ID, -1 to keep the current one
+	chroot string // Directory the process is confined to (none if empty)
+}
+
+// newPrivileges resolves the user and group of the configuration, nil if there're no privileges to drop. The names
+// are looked up at startup, while the user database is still reachable.
+func newPrivileges(config *PrivilegesConfig) (*privileges, error) {
+	if *config == (PrivilegesConfig{}) {
+		return nil, nil
+	}
+
+	p := &privileges{uid: -1, gid: -1, chroot: config.Chroot}
+	if config.User != "" {
+		u, err := user.Lookup(config.User)
+		if _, errID := strconv.Atoi(config.User); err != nil && errID == nil {
+			u, err = user.LookupId(config.User)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %s: %v", config.User, err)
+		}
+		p.uid, _ = strconv.Atoi(u.Uid)
+		p.gid, _ = strconv.Atoi(u.Gid)
+	}
+	if config.Group != "" {
+		g, err := user.LookupGroup(config.Group)
+		if _, errID := strconv.Atoi(config.Group); err != nil && errID == nil {
+			g, err = user.LookupGroupId(config.Group)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unknown group %s: %v", config.Group, err)
+		}
+		p.gid, _ = strconv.Atoi(g.Gid)
+	}
+	return p, nil
+}
+
+// checkActivePort refuses the listeners whose active transfers connect from port 20 when the process switches to
+// another user than root, as they would all fail once the privileges are dropped
+func (p *privileges) checkActivePort(config *Config) error {
+	if p == nil || p.uid <= 0 {
+		return nil
+	}
+	names, settings := []string{"main"}, []*server.Settings{&config.Server}
+	for i := range config.Listeners {
+		names = append(names, config.Listeners[i].Name)
+		settings = append(settings, &config.Listeners[i].Server)
+	}
+	for i, s := range settings {
+		if !s.NonStandardActiveDataPort && !activeDisabled(s.DisabledCommands) {
+			return fmt.Errorf("the active transfers of the %s listener connect from port 20, which needs root: set "+
+				"non_standard_active_data_port or disable PORT and EPRT to drop the privileges", names[i])
+		}
+	}
+	return nil
+}
+
+// activeDisabled tells if the active transfers are disabled: both PORT and EPRT are
+func activeDisabled(commands []string) bool {
+	port, eprt := false, false
+	for _, command := range commands {
+		switch strings.ToUpper(strings.TrimSpace(command)) {
+		case "PORT":
+			port = true
+		case "EPRT":
+			eprt = true
+		}
+	}
+	return port && eprt
+}
+
+// drop confines the process to the chroot, then switches to the group and the user. A process that isn't running as
+// root must already have them, like the one started by a handoff.
+func (p *privileges) drop() error {
+	if p.chroot != "" {
+		if err := syscall.Chroot(p.chroot); err != nil {
+			return fmt.Errorf("couldn't chroot to %s: %v", p.chroot, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return err
+		}
+	}
+
+	if os.Getuid() != 0 {
+		if (p.uid >= 0 && p.uid != os.Getuid()) || (p.gid >= 0 && p.gid != os.Getgid()) {
+			return errors.New("the privileges can only be dropped by root")
+		}
+		return nil
+	}
+
+	// The supplementary groups of root are dropped too
+	if p.gid >= 0 {
+		if err := syscall.Setgroups([]int{p.gid}); err != nil {
+			return fmt.Errorf("couldn't set the groups: %v", err)
+		}
+		if err := syscall.Setgid(p.gid); err != nil {
+			return fmt.Errorf("couldn't set the group: %v", err)
+		}
+	}
+	if p.uid >= 0 {
+		if err := syscall.Setuid(p.uid); err != nil {
+			return fmt.Errorf("couldn't set the user: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNewPrivileges(t *testing.T) {
+	if p, err := newPrivileges(&PrivilegesConfig{}); p != nil || err != nil {
+		t.Fatal("There should be no privileges to drop:", p, err)
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("No current user:", err)
+	}
+	for _, name := range []string{current.Username, current.Uid} {
+		p, err := newPrivileges(&PrivilegesConfig{User: name})
+		if err != nil || strconv.Itoa(p.uid) != current.Uid || strconv.Itoa(p.gid) != current.Gid {
+			t.Fatal("Wrong privileges of", name, p, err)
+		}
+	}
+
+	if p, err := newPrivileges(&PrivilegesConfig{Group: strconv.Itoa(os.Getgid())}); err != nil || p.uid != -1 || p.gid != os.Getgid() {
+		t.Fatal("Wrong privileges of the group:", p, err)
+	}
+	if _, err := newPrivileges(&PrivilegesConfig{User: "no-such-user-ftpserver"}); err == nil {
+		t.Fatal("An unknown user should be refused")
+	}
+
+	// Dropping the current identity does nothing
+	if p, _ := newPrivileges(&PrivilegesConfig{User: current.Uid}); os.Getuid() != 0 && p.drop() != nil {
+		t.Fatal("The current identity should be kept")
+	}
+}
+
+func TestCheckActivePort(t *testing.T) {
+	config := &Config{Listeners: []ListenerConfig{{Name: "internal"}}}
+	config.Server.NonStandardActiveDataPort = true
+	if err := (&privileges{uid: 0, gid: -1}).checkActivePort(config); err != nil {
+		t.Fatal("Root can connect from port 20:", err)
+	}
+
+	p := &privileges{uid: 1000, gid: -1}
+	if err := p.checkActivePort(config); err == nil || !strings.Contains(err.Error(), "internal listener") {
+		t.Fatal("The active transfers from port 20 should be refused:", err)
+	}
+	config.Listeners[0].Server.DisabledCommands = []string{"port", "EPRT"}
+	if err := p.checkActivePort(config); err != nil {
+		t.Fatal("The active transfers are disabled:", err)
+	}
+	var none *privileges
+	if err := none.checkActivePort(&Config{}); err != nil {
+		t.Fatal("There are no privileges to drop:", err)
+	}
+}
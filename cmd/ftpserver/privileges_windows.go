@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+)
+
+// privileges can't be dropped on Windows, the service account defines them
+type privileges struct{}
+
+// newPrivileges refuses the privileges of the configuration
+func newPrivileges(config *PrivilegesConfig) (*privileges, error) {
+	if *config == (PrivilegesConfig{}) {
+		return nil, nil
+	}
+	return nil, errors.New("the privileges can only be dropped on Unix systems")
+}
+
+// checkActivePort does nothing, there are no privileges to drop
+func (p *privileges) checkActivePort(config *Config) error {
+	return nil
+}
+
+// drop does nothing
+func (p *privileges) drop() error {
+	return nil
+}
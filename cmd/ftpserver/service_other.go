@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// runService never runs the servers, there's no service manager to integrate with
+func runService(servers []*server.FtpServer) (bool, error) {
+	return false, nil
+}
+
+// controlService can't install services on these systems
+func controlService(action string) error {
+	return errors.New("services can only be installed on Windows")
+}
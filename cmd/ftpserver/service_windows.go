@@ -0,0 +1,139 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fclairamb/ftpserver/server"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name of the Windows service
+const serviceName = "ftpserver"
+
+// runService runs the servers under the service control manager when the process was started by it. It returns
+// false if the process is interactive.
+func runService(servers []*server.FtpServer) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	return true, svc.Run(serviceName, &ftpService{servers: servers})
+}
+
+// ftpService handles the requests of the service control manager
+type ftpService struct {
+	servers []*server.FtpServer
+}
+
+// Execute starts the servers and stops them when the service is stopped
+func (s *ftpService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	for i, ftpServer := range s.servers {
+		if err := ftpServer.Listen(); err != nil {
+			for _, started := range s.servers[:i] {
+				started.Stop()
+			}
+			return false, 1
+		}
+	}
+
+	// done is closed as soon as one of the listeners stops
+	done := make(chan struct{})
+	var once sync.Once
+	for _, ftpServer := range s.servers {
+		go func(ftpServer *server.FtpServer) {
+			ftpServer.Serve()
+			once.Do(func() { close(done) })
+		}(ftpServer)
+	}
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			// A listener failed
+			for _, ftpServer := range s.servers {
+				ftpServer.Stop()
+			}
+			return false, 1
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				for _, ftpServer := range s.servers {
+					ftpServer.Stop()
+				}
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// controlService installs or uninstalls the Windows service. The installed service is started with the arguments
+// of the current command line, except the -service one.
+func controlService(action string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	switch action {
+	case "install":
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.Abs(exe); err != nil {
+			return err
+		}
+
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "FTP server",
+			StartType:   mgr.StartAutomatic,
+		}, serviceArgs(os.Args[1:])...)
+		if err != nil {
+			return err
+		}
+		return s.Close()
+
+	case "uninstall":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		return s.Delete()
+	}
+
+	return fmt.Errorf("unknown service action: %s", action)
+}
+
+// serviceArgs removes the -service option from the command line arguments
+func serviceArgs(args []string) []string {
+	filtered := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		switch {
+		case name == "service" && args[i] != name:
+			i++ // The value is the next argument
+		case strings.HasPrefix(name, "service=") && args[i] != name:
+		default:
+			filtered = append(filtered, args[i])
+		}
+	}
+	return filtered
+}
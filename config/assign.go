@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// normalizeKey makes keys written in any case convention comparable
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// Assign stores generic values (maps, slices and scalars, as produced by JSON or YAML decoders) in v, which must be a
+// pointer. Unknown keys are reported as errors.
+func Assign(v interface{}, content interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("a non-nil pointer is expected, got %T", v)
+	}
+	return assign(rv.Elem(), content, "")
+}
+
+// fieldName returns the name of a struct field as used in the configurations
+func fieldName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("toml"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return field.Name
+}
+
+func assign(dst reflect.Value, src interface{}, path string) error {
+	if src == nil {
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src, path)
+
+	case reflect.Struct:
+		values, ok := src.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: a table is expected, got %v", path, src)
+		}
+		fields := make(map[string]int)
+		for i := 0; i < dst.NumField(); i++ {
+			if field := dst.Type().Field(i); field.PkgPath == "" {
+				fields[normalizeKey(fieldName(field))] = i
+			}
+		}
+		for key, value := range values {
+			i, ok := fields[normalizeKey(key)]
+			if !ok {
+				return fmt.Errorf("%s: unknown key", joinPath(path, key))
+			}
+			if err := assign(dst.Field(i), value, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		values, ok := src.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: a list is expected, got %v", path, src)
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := assign(slice.Index(i), value, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+
+	case reflect.Map:
+		values, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%s: a table is expected, got %v", path, src)
+		}
+		m := reflect.MakeMap(dst.Type())
+		for key, value := range values {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, value, joinPath(path, key)); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+		return nil
+
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	return assignScalar(dst, src, path)
+}
+
+func assignScalar(dst reflect.Value, src interface{}, path string) error {
+	var text string
+	switch s := src.(type) {
+	case string:
+		text = s
+	case json.Number:
+		text = s.String()
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("%s: a value is expected, got %v", path, src)
+	default:
+		text = fmt.Sprint(s)
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dst.Type() == durationType {
+			if _, isText := src.(string); isText {
+				d, err := time.ParseDuration(text)
+				if err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				dst.SetInt(int64(d))
+				return nil
+			}
+		}
+		i, err := strconv.ParseInt(text, 0, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 0, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		dst.SetFloat(f)
+	default:
+		return fmt.Errorf("%s: can't set a %s", path, dst.Type())
+	}
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,110 @@
+// Package config loads the server settings (or any other configuration structure) from TOML, JSON or YAML.
+//
+// Whatever the format, the keys are matched against the field names (or their toml tag) without considering the case,
+// the underscores and the dashes: "listen_host", "listenHost" and "ListenHost" all define Settings.ListenHost.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+	"github.com/naoina/toml"
+)
+
+// Format is the format of a configuration
+type Format string
+
+const (
+	// FormatTOML is the TOML format
+	FormatTOML Format = "toml"
+	// FormatJSON is the JSON format
+	FormatJSON Format = "json"
+	// FormatYAML is the (commonly used subset of the) YAML format
+	FormatYAML Format = "yaml"
+)
+
+// FormatOf returns the format of a configuration file from its extension
+func FormatOf(fileName string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".toml", ".conf":
+		return FormatTOML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unknown configuration format for %s", fileName)
+}
+
+// Decode reads a configuration in the specified format and stores it in v (a pointer to a struct)
+func Decode(r io.Reader, format Format, v interface{}) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var content map[string]interface{}
+
+	switch format {
+	case FormatTOML:
+		return toml.Unmarshal(buf, v)
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(buf))
+		decoder.UseNumber()
+		if err := decoder.Decode(&content); err != nil {
+			return err
+		}
+	case FormatYAML:
+		if content, err = parseYAML(buf); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown configuration format: %s", format)
+	}
+
+	return Assign(v, content)
+}
+
+// DecodeFile reads a configuration file whose format is defined by its extension
+func DecodeFile(fileName string, v interface{}) error {
+	format, err := FormatOf(fileName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := Decode(file, format, v); err != nil {
+		return fmt.Errorf("couldn't parse %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// LoadSettings reads server settings in the specified format
+func LoadSettings(r io.Reader, format Format) (*server.Settings, error) {
+	settings := &server.Settings{}
+	if err := Decode(r, format, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// LoadSettingsFile reads server settings from a file whose format is defined by its extension
+func LoadSettingsFile(fileName string) (*server.Settings, error) {
+	settings := &server.Settings{}
+	if err := DecodeFile(fileName, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
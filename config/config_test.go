@@ -0,0 +1,129 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const settingsTOML = `
+listen_host = "127.0.0.1"
+listen_port = 2121
+disable_mlsd = true
+
+[dataPortRange]
+start = 2122
+end = 2200
+`
+
+const settingsJSON = `{
+	"listenHost": "127.0.0.1",
+	"listen_port": 2121,
+	"DisableMLSD": true,
+	"data_port_range": {"start": 2122, "end": 2200}
+}`
+
+const settingsYAML = `
+# Server settings
+listen_host: 127.0.0.1
+listen_port: 2121 # The default one
+disable-mlsd: true
+data_port_range:
+  start: 2122
+  end: 2200
+`
+
+func TestLoadSettings(t *testing.T) {
+	for format, content := range map[Format]string{
+		FormatTOML: settingsTOML,
+		FormatJSON: settingsJSON,
+		FormatYAML: settingsYAML,
+	} {
+		settings, err := LoadSettings(strings.NewReader(content), format)
+		if err != nil {
+			t.Fatal("Couldn't load", format, "settings:", err)
+		}
+		if settings.ListenHost != "127.0.0.1" || settings.ListenPort != 2121 || !settings.DisableMLSD {
+			t.Fatal("Bad", format, "settings:", settings)
+		}
+		if settings.DataPortRange == nil || settings.DataPortRange.Start != 2122 || settings.DataPortRange.End != 2200 {
+			t.Fatal("Bad", format, "port range:", settings.DataPortRange)
+		}
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	if _, err := LoadSettings(strings.NewReader(`{"listen_hots": "127.0.0.1"}`), FormatJSON); err == nil {
+		t.Fatal("Unknown keys should be reported")
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	content, err := parseYAML([]byte(`
+welcome: "Hello # world"
+timeout: 30s
+ratio: 0.5
+empty:
+tags: [a, 'b c', 3]
+users:
+- user: alice
+  pass: 'it''s'
+  dirs:
+    - /a
+    - /b
+-   user: bob
+nested:
+  list:
+  - 1
+  - 2
+`))
+	if err != nil {
+		t.Fatal("Couldn't parse:", err)
+	}
+
+	expected := map[string]interface{}{
+		"welcome": "Hello # world",
+		"timeout": "30s",
+		"ratio":   0.5,
+		"empty":   nil,
+		"tags":    []interface{}{"a", "b c", int64(3)},
+		"users": []interface{}{
+			map[string]interface{}{"user": "alice", "pass": "it's", "dirs": []interface{}{"/a", "/b"}},
+			map[string]interface{}{"user": "bob"},
+		},
+		"nested": map[string]interface{}{"list": []interface{}{int64(1), int64(2)}},
+	}
+
+	if !reflect.DeepEqual(content, expected) {
+		t.Fatalf("Bad content: %#v", content)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, content := range []string{
+		"a: 1\n  b: 2",
+		"a: 1\na: 2",
+		"- a",
+		"a: [1, 2",
+		"just text",
+	} {
+		if _, err := parseYAML([]byte(content)); err == nil {
+			t.Fatal("This should have failed:", content)
+		}
+	}
+}
+
+func TestAssignDuration(t *testing.T) {
+	var v struct {
+		Timeout time.Duration
+		Count   int
+		Names   []string
+	}
+	if err := Assign(&v, map[string]interface{}{"timeout": "1m", "count": int64(3), "names": []interface{}{"a"}}); err != nil {
+		t.Fatal("Couldn't assign:", err)
+	}
+	if v.Timeout != time.Minute || v.Count != 3 || len(v.Names) != 1 {
+		t.Fatal("Bad values:", v)
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the server settings
+const EnvPrefix = "FTPSERVER_"
+
+var portRangeType = reflect.TypeOf(server.PortRange{})
+
+// ApplyEnv overrides the fields of v (a pointer to a struct) with the environment variables named after them. With
+// the "FTPSERVER_" prefix, ListenHost is defined by FTPSERVER_LISTEN_HOST and DataPortRange.Start by
+// FTPSERVER_DATA_PORT_RANGE_START. A port range can also be defined at once (FTPSERVER_DATA_PORT_RANGE=2122-2200) and
+// lists are comma separated (FTPSERVER_PASSIVE_PORTS=2122,2123).
+func ApplyEnv(v interface{}, prefix string) error {
+	return applyEnv(v, prefix, os.LookupEnv)
+}
+
+// ApplySettingsEnv overrides the server settings with the FTPSERVER_ prefixed environment variables
+func ApplySettingsEnv(settings *server.Settings) error {
+	return ApplyEnv(settings, EnvPrefix)
+}
+
+func applyEnv(v interface{}, prefix string, lookup func(string) (string, bool)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("a non-nil pointer to a struct is expected, got %T", v)
+	}
+	return applyEnvStruct(rv.Elem(), prefix, lookup)
+}
+
+func applyEnvStruct(dst reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := prefix + envName(fieldName(field))
+		if err := applyEnvValue(dst.Field(i), name, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEnvValue(dst reflect.Value, name string, lookup func(string) (string, bool)) error {
+	t := dst.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		value, ok := lookup(name)
+		if !ok || t.Kind() == reflect.Map {
+			return nil
+		}
+		if t.Kind() == reflect.Slice {
+			// Lists are comma separated: FTPSERVER_PASSIVE_PORTS=2122,2123
+			var values []interface{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+			return assign(dst, values, name)
+		}
+		return assign(dst, value, name)
+	}
+
+	// The struct is only allocated when one of its fields is defined
+	target := reflect.New(t)
+	if dst.Kind() == reflect.Ptr {
+		if !dst.IsNil() {
+			target.Elem().Set(dst.Elem())
+		}
+	} else {
+		target.Elem().Set(dst)
+	}
+	before := target.Elem().Interface()
+
+	if t == portRangeType {
+		if value, ok := lookup(name); ok {
+			if err := parsePortRange(target.Interface().(*server.PortRange), value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+
+	if err := applyEnvStruct(target.Elem(), name+"_", lookup); err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(before, target.Elem().Interface()) {
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		dst.Set(target)
+	} else {
+		dst.Set(target.Elem())
+	}
+	return nil
+}
+
+// parsePortRange parses a "start-end" port range
+func parsePortRange(portRange *server.PortRange, value string) error {
+	if _, err := fmt.Sscanf(value, "%d-%d", &portRange.Start, &portRange.End); err != nil {
+		return fmt.Errorf("a \"start-end\" port range is expected, got %s", value)
+	}
+	return nil
+}
+
+// envName converts a field name (ListenHost, DisableMLSD, cert_file) to an environment variable name (LISTEN_HOST,
+// DISABLE_MLSD, CERT_FILE)
+func envName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if r == '-' {
+			r = '_'
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
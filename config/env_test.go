@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func TestEnvName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"ListenHost":                "LISTEN_HOST",
+		"DisableMLSD":               "DISABLE_MLSD",
+		"TLSSessionReuseRequired":   "TLS_SESSION_REUSE_REQUIRED",
+		"NonStandardActiveDataPort": "NON_STANDARD_ACTIVE_DATA_PORT",
+		"cert_file":                 "CERT_FILE",
+	} {
+		if actual := envName(name); actual != expected {
+			t.Fatal("Bad name for", name, ":", actual)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"FTPSERVER_LISTEN_HOST":       "0.0.0.0",
+		"FTPSERVER_LISTEN_PORT":       "2121",
+		"FTPSERVER_TLS_REQUIRED":      "true",
+		"FTPSERVER_DATA_PORT_RANGE":   "2122-2200",
+		"FTPSERVER_PUBLIC_HOST":       "1.2.3.4",
+		"FTPSERVER_PASSIVE_PORTS":     "2122, 2123",
+		"FTPSERVER_UNRELATED_SETTING": "whatever",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	settings := &server.Settings{ListenHost: "127.0.0.1", MaxConnections: 10}
+	if err := applyEnv(settings, EnvPrefix, lookup); err != nil {
+		t.Fatal("Couldn't apply the environment:", err)
+	}
+
+	if settings.ListenHost != "0.0.0.0" || settings.ListenPort != 2121 || !settings.TLSRequired ||
+		settings.PublicHost != "1.2.3.4" || settings.MaxConnections != 10 || len(settings.PassivePorts) != 2 {
+		t.Fatal("Bad settings:", settings)
+	}
+	if settings.DataPortRange == nil || settings.DataPortRange.Start != 2122 || settings.DataPortRange.End != 2200 {
+		t.Fatal("Bad port range:", settings.DataPortRange)
+	}
+
+	env = map[string]string{"FTPSERVER_DATA_PORT_RANGE_END": "2300"}
+	if err := applyEnv(settings, EnvPrefix, lookup); err != nil {
+		t.Fatal("Couldn't apply the environment:", err)
+	}
+	if settings.DataPortRange.Start != 2122 || settings.DataPortRange.End != 2300 {
+		t.Fatal("Bad port range:", settings.DataPortRange)
+	}
+
+	settings = &server.Settings{}
+	env = map[string]string{}
+	if err := applyEnv(settings, EnvPrefix, lookup); err != nil || settings.DataPortRange != nil {
+		t.Fatal("Nothing should have been defined:", settings, err)
+	}
+
+	env = map[string]string{"FTPSERVER_LISTEN_PORT": "twenty-one"}
+	if err := applyEnv(settings, EnvPrefix, lookup); err == nil {
+		t.Fatal("Bad values should be reported")
+	}
+}
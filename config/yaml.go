@@ -0,0 +1,295 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This is a parser for the subset of YAML that is commonly used in configuration files: block mappings and sequences,
+// flow sequences of scalars, plain and quoted scalars and comments. Anchors, tags, flow mappings and multi-line
+// scalars aren't supported.
+
+type yamlLine struct {
+	number int    // Line number (starting at 1)
+	indent int    // Indentation
+	text   string // Content without the indentation and the comments
+}
+
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+}
+
+// parseYAML parses a YAML document whose root is a mapping
+func parseYAML(buf []byte) (map[string]interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(buf), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if strings.Contains(raw, "\t") && strings.TrimLeft(raw, " ") != strings.TrimLeft(raw, " \t") {
+			return nil, fmt.Errorf("line %d: tabs can't be used for indentation", i+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " ")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		p.lines = append(p.lines, &yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	if len(p.lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	value, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: bad indentation", p.lines[p.pos].number)
+	}
+
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the document must be a mapping")
+	}
+	return root, nil
+}
+
+// stripYAMLComment removes the comment at the end of a line
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock parses the mapping or the sequence starting at the current line
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseNested parses the value defined on the lines following a "key:" or a "-"
+func (p *yamlParser) parseNested(parentIndent int, allowSameIndentSequence bool) (interface{}, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > parentIndent || (allowSameIndentSequence && next.indent == parentIndent && isSequenceItem(next.text)) {
+		return p.parseBlock(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent || isSequenceItem(line.text) {
+			return nil, fmt.Errorf("line %d: bad indentation", line.number)
+		}
+
+		key, rest, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line.number, key)
+		}
+		p.pos++
+
+		var value interface{}
+		if rest == "" {
+			value, err = p.parseNested(indent, true)
+		} else {
+			value, err = parseYAMLValue(rest, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+	return mapping, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := make([]interface{}, 0)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && !isSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: bad indentation", line.number)
+		}
+
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		var value interface{}
+		var err error
+		switch {
+		case content == "":
+			p.pos++
+			value, err = p.parseNested(indent, false)
+		case isSequenceItem(content) || isYAMLMappingEntry(content):
+			// The item is a block starting on the same line: it's handled as if it started on its own line
+			line.indent += len(line.text) - len(content)
+			line.text = content
+			value, err = p.parseBlock(line.indent)
+		default:
+			p.pos++
+			value, err = parseYAMLValue(content, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+	return sequence, nil
+}
+
+// splitYAMLKey splits a "key: value" line
+func splitYAMLKey(line *yamlLine) (string, string, error) {
+	i := yamlKeySeparator(line.text)
+	if i < 0 {
+		return "", "", fmt.Errorf("line %d: a \"key: value\" entry is expected", line.number)
+	}
+
+	key := strings.TrimSpace(line.text[:i])
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') {
+		unquoted, err := parseYAMLScalar(key, line.number)
+		if err != nil {
+			return "", "", err
+		}
+		key = fmt.Sprint(unquoted)
+	}
+
+	return key, strings.TrimSpace(line.text[i+1:]), nil
+}
+
+// yamlKeySeparator returns the position of the colon ending the key of a mapping entry, -1 if there's none
+func yamlKeySeparator(text string) int {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case i == 0 && (r == '"' || r == '\''):
+			quote = r
+		case r == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func isYAMLMappingEntry(text string) bool {
+	return yamlKeySeparator(text) > 0
+}
+
+// parseYAMLValue parses an inline value: a scalar or a flow sequence of scalars
+func parseYAMLValue(text string, number int) (interface{}, error) {
+	if strings.HasPrefix(text, "[") {
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated sequence", number)
+		}
+		values := make([]interface{}, 0)
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return values, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			value, err := parseYAMLScalar(strings.TrimSpace(item), number)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	if strings.HasPrefix(text, "{") {
+		if text == "{}" {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("line %d: flow mappings aren't supported", number)
+	}
+	return parseYAMLScalar(text, number)
+}
+
+// splitYAMLFlow splits the items of a flow sequence
+func splitYAMLFlow(text string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+// parseYAMLScalar converts a scalar to a string, an integer, a float, a boolean or nil
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	if len(text) >= 1 && text[0] == '"' {
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad quoted string %s", number, text)
+		}
+		return s, nil
+	}
+	if len(text) >= 1 && text[0] == '\'' {
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, fmt.Errorf("line %d: bad quoted string %s", number, text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+
+	if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+
+	return text, nil
+}
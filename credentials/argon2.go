@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Version is the version of Argon2 of the hashes, the first one (0x10, whose hashes have no "v=") isn't
+// supported
+const argon2Version = 0x13
+
+// verifyArgon2 verifies an Argon2 hash in the PHC format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<checksum>, with
+// the salt and the checksum in base64 without padding
+func verifyArgon2(hash, password string) (bool, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2Version {
+		return false, ErrMalformedHash
+	}
+	var memory, passes, parallelism uint32
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &passes, &parallelism); err != nil {
+		return false, ErrMalformedHash
+	}
+	if passes < 1 || parallelism < 1 || parallelism > 255 || memory < 8*parallelism {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	checksum, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(checksum) < 4 {
+		return false, ErrMalformedHash
+	}
+
+	key := argon2.IDKey
+	if fields[1] == "argon2i" {
+		key = argon2.Key
+	}
+	computed := key([]byte(password), salt, passes, memory, uint8(parallelism), uint32(len(checksum)))
+	return equal(string(computed), string(checksum)), nil
+}
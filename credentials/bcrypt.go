@@ -0,0 +1,18 @@
+package credentials
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// verifyBcrypt verifies a bcrypt hash: $2b$<cost>$<22 characters of salt><31 characters of checksum>. The $2a$ and
+// $2y$ variants are the same.
+func verifyBcrypt(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	return true, nil
+}
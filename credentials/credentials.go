@@ -0,0 +1,62 @@
+// Package credentials verifies the passwords of the users against the hashes the drivers store, so that they never
+// have to keep them in clear. The common formats of the password files and databases are supported: bcrypt
+// ($2a$, $2b$, $2y$), Argon2 version 19 ($argon2id$, $argon2i$), SHA-crypt ($5$, $6$) and the legacy MD5-crypt ($1$).
+//
+// The bcrypt and Argon2 hashes are computed with golang.org/x/crypto, the crypt ones with the standard library, and
+// they're all compared in constant time.
+package credentials
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnknownFormat is returned for the hashes in none of the supported formats
+	ErrUnknownFormat = errors.New("unknown password hash format")
+
+	// ErrMalformedHash is returned for the hashes whose parameters can't be parsed
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// formats are the supported hash formats, by prefix
+var formats = []struct {
+	prefix string
+	verify func(hash, password string) (bool, error)
+}{
+	{"$2a$", verifyBcrypt},
+	{"$2b$", verifyBcrypt},
+	{"$2y$", verifyBcrypt},
+	{"$argon2id$", verifyArgon2},
+	{"$argon2i$", verifyArgon2},
+	{"$6$", verifySHACrypt},
+	{"$5$", verifySHACrypt},
+	{"$1$", verifyMD5Crypt},
+}
+
+// Verify tells if a password matches a hash, whose format is found from its prefix. An error is returned if the
+// format isn't supported or if the hash is malformed.
+func Verify(hash, password string) (bool, error) {
+	for _, format := range formats {
+		if strings.HasPrefix(hash, format.prefix) {
+			return format.verify(hash, password)
+		}
+	}
+	return false, ErrUnknownFormat
+}
+
+// Supported tells if a hash is in one of the supported formats
+func Supported(hash string) bool {
+	for _, format := range formats {
+		if strings.HasPrefix(hash, format.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares the computed and the expected checksums of a hash in constant time
+func equal(computed, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(expected)) == 1
+}
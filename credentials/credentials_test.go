@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	for _, tc := range []struct {
+		hash, password string
+	}{
+		{"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", "password"},
+		{"$1$abc$Or2rbeUYTvt12aiVzMuS/.", ""},
+		{"$1$12345678$yLppq.aqtfjKiej5RWDLq/", "a much longer password than sixteen bytes"},
+		{"$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC.", "password"},
+		{"$5$rounds=1000$toolongsaltstrin$UNjqhQ96UOQ1pfRsmWYMqXAHJJ6J3XVtiQcd5ZbcilB", "password"},
+		{"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/", "password"},
+		{"$6$rounds=10$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+			"the minimum number is still observed"},
+		{"$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", "password"},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy", ""},
+		{"$2y$04$abcdefghijklmnopqrstuubzadhGtS2zEF.gu0yd0opP6cVzb.e0i", long},
+		{"$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "password"},
+		{"$argon2id$v=19$m=64,t=2,p=2$c29tZXNhbHQ$06Fg+NIOVokX4kDZhuwsHA", "password"},
+	} {
+		ok, err := Verify(tc.hash, tc.password)
+		if err != nil || !ok {
+			t.Fatal("The password should match:", tc.hash, ok, err)
+		}
+		if ok, err = Verify(tc.hash, "!"+tc.password); err != nil || ok {
+			t.Fatal("Another password shouldn't match:", tc.hash, ok, err)
+		}
+	}
+
+	// Only the first 72 bytes of the passwords are hashed by bcrypt
+	if ok, _ := Verify("$2y$04$abcdefghijklmnopqrstuubzadhGtS2zEF.gu0yd0opP6cVzb.e0i", long[:72]); !ok {
+		t.Fatal("The password should be truncated")
+	}
+}
+
+func TestHash(t *testing.T) {
+	hash, err := Hash("password")
+	if err != nil || !strings.HasPrefix(hash, "$6$") {
+		t.Fatal("Couldn't hash the password:", hash, err)
+	}
+	if ok, err := Verify(hash, "password"); err != nil || !ok {
+		t.Fatal("The password should match its hash:", hash, err)
+	}
+	if other, _ := Hash("password"); other == hash {
+		t.Fatal("The hashes should be salted")
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for hash, expected := range map[string]error{
+		"password":        ErrUnknownFormat,
+		"$3$abc":          ErrUnknownFormat,
+		"$1$nohash":       ErrMalformedHash,
+		"$6$rounds=x$a$b": ErrMalformedHash,
+		"$2b$04$short":    ErrMalformedHash,
+		"$2b$99$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm":   ErrMalformedHash,
+		"$argon2id$v=19$m=1,t=2,p=2$c29tZXNhbHQ$bEsO94lFQb2C9xWxpm8YGg":  ErrMalformedHash,
+		"$argon2id$v=42$m=64,t=2,p=2$c29tZXNhbHQ$bEsO94lFQb2C9xWxpm8YGg": ErrMalformedHash,
+		"$argon2id$m=64,t=2,p=2$c29tZXNhbHQ":                             ErrMalformedHash,
+		"$argon2id$m=64,t=2,p=2$c29tZXNhbHQ$bEsO94lFQb2C9xWxpm8YGg":      ErrMalformedHash,
+	} {
+		if _, err := Verify(hash, "password"); err != expected {
+			t.Fatal("Wrong error:", hash, err)
+		}
+	}
+	if !Supported("$2b$04$x") || Supported("sha256:abc") {
+		t.Fatal("Bad detection of the formats")
+	}
+}
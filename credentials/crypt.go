@@ -0,0 +1,249 @@
+package credentials
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// cryptAlphabet is the alphabet of the crypt(3) checksums
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// The rounds of SHA-crypt, "rounds=N$" is optional in the hashes
+const (
+	shaCryptRoundsDefault = 5000
+	shaCryptRoundsMin     = 1000
+	shaCryptRoundsMax     = 999999999
+)
+
+// shaCryptOrders are the orders of the digest bytes in the SHA-crypt checksums, by groups of 3 (the last group is
+// shorter)
+var shaCryptOrders = map[string][]int{
+	"$5$": {
+		0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29,
+		31, 30,
+	},
+	"$6$": {
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60,
+		40, 61, 19, 62, 20, 41, 63,
+	},
+}
+
+// md5CryptOrder is the order of the digest bytes in the MD5-crypt checksums
+var md5CryptOrder = []int{0, 6, 12, 1, 7, 13, 2, 8, 14, 3, 9, 15, 4, 10, 5, 11}
+
+// cryptEncode encodes the bytes of a digest in the order of a checksum, by groups of 3 bytes written as 4 characters
+// (the last group is written with as many characters as needed)
+func cryptEncode(digest []byte, order []int) string {
+	var b strings.Builder
+	for i := 0; i < len(order); i += 3 {
+		var value uint
+		group := order[i:]
+		if len(group) > 3 {
+			group = group[:3]
+		}
+		for _, index := range group {
+			value = value<<8 | uint(digest[index])
+		}
+		for n := (len(group)*8 + 5) / 6; n > 0; n-- {
+			b.WriteByte(cryptAlphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	return b.String()
+}
+
+// cryptFields splits a crypt(3) hash after its prefix: the parameters, the salt and the checksum
+func cryptFields(hash, prefix string) ([]string, error) {
+	fields := strings.Split(strings.TrimPrefix(hash, prefix), "$")
+	if len(fields) < 2 || len(fields) > 3 || fields[len(fields)-1] == "" {
+		return nil, ErrMalformedHash
+	}
+	return fields, nil
+}
+
+// repeat returns n bytes of the repetition of a block
+func repeat(block []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, block[:min(len(block), n-len(out))]...)
+	}
+	return out
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// verifySHACrypt verifies a SHA-crypt hash: $5$ (SHA-256) or $6$ (SHA-512), with the "rounds=N$" option
+func verifySHACrypt(hash, password string) (bool, error) {
+	prefix := hash[:3]
+	fields, err := cryptFields(hash, prefix)
+	if err != nil {
+		return false, err
+	}
+	rounds := shaCryptRoundsDefault
+	if len(fields) == 3 {
+		if !strings.HasPrefix(fields[0], "rounds=") {
+			return false, ErrMalformedHash
+		}
+		if rounds, err = strconv.Atoi(strings.TrimPrefix(fields[0], "rounds=")); err != nil {
+			return false, ErrMalformedHash
+		}
+		if rounds < shaCryptRoundsMin {
+			rounds = shaCryptRoundsMin
+		} else if rounds > shaCryptRoundsMax {
+			rounds = shaCryptRoundsMax
+		}
+		fields = fields[1:]
+	}
+	salt := fields[0]
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	newHash := sha512.New
+	if prefix == "$5$" {
+		newHash = sha256.New
+	}
+	digest := shaCrypt(newHash, []byte(password), []byte(salt), rounds)
+	return equal(cryptEncode(digest, shaCryptOrders[prefix]), fields[1]), nil
+}
+
+// Hash hashes a password with SHA-512 crypt ($6$) and a random salt, to be stored by the drivers instead of the clear
+// password
+func Hash(password string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	salt := make([]byte, len(random))
+	for i, b := range random {
+		salt[i] = cryptAlphabet[b&0x3f]
+	}
+	digest := shaCrypt(sha512.New, []byte(password), salt, shaCryptRoundsDefault)
+	return "$6$" + string(salt) + "$" + cryptEncode(digest, shaCryptOrders["$6$"]), nil
+}
+
+// shaCrypt computes the digest of SHA-crypt
+func shaCrypt(newHash func() hash.Hash, password, salt []byte, rounds int) []byte {
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	alternate := h.Sum(nil)
+
+	h.Reset()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(repeat(alternate, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(alternate)
+		} else {
+			h.Write(password)
+		}
+	}
+	digest := h.Sum(nil)
+
+	h.Reset()
+	for i := 0; i < len(password); i++ {
+		h.Write(password)
+	}
+	p := repeat(h.Sum(nil), len(password))
+
+	h.Reset()
+	for i := 0; i < 16+int(digest[0]); i++ {
+		h.Write(salt)
+	}
+	s := repeat(h.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(digest)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(digest)
+		} else {
+			h.Write(p)
+		}
+		digest = h.Sum(digest[:0])
+	}
+	return digest
+}
+
+// verifyMD5Crypt verifies a MD5-crypt hash ($1$), only for the legacy password files: it's weak
+func verifyMD5Crypt(hash, password string) (bool, error) {
+	fields, err := cryptFields(hash, "$1$")
+	if err != nil || len(fields) != 2 {
+		return false, ErrMalformedHash
+	}
+	salt := fields[0]
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	digest := md5Crypt([]byte(password), []byte(salt))
+	return equal(cryptEncode(digest, md5CryptOrder), fields[1]), nil
+}
+
+// md5Crypt computes the digest of MD5-crypt
+func md5Crypt(password, salt []byte) []byte {
+	h := md5.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	alternate := h.Sum(nil)
+
+	h.Reset()
+	h.Write(password)
+	h.Write([]byte("$1$"))
+	h.Write(salt)
+	h.Write(repeat(alternate, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(password[:1])
+		}
+	}
+	digest := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(password)
+		} else {
+			h.Write(digest)
+		}
+		if i%3 != 0 {
+			h.Write(salt)
+		}
+		if i%7 != 0 {
+			h.Write(password)
+		}
+		if i&1 != 0 {
+			h.Write(digest)
+		} else {
+			h.Write(password)
+		}
+		digest = h.Sum(digest[:0])
+	}
+	return digest
+}
@@ -0,0 +1,216 @@
+// Package archive is a read-only driver exposing the content of a zip, tar or tar.gz archive. The archive is indexed
+// when it's opened and the files are streamed from it when they are downloaded.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned for every modification attempt
+var ErrReadOnly = errors.New("read-only archive")
+
+// entry is a file or a directory of the archive
+type entry struct {
+	name    string      // Base name
+	size    int64       // Size of the content
+	mode    os.FileMode // Mode (with os.ModeDir for directories)
+	modTime time.Time   // Modification time
+	zipFile *zip.File   // Zip entry (zip archives only)
+	tarName string      // Name of the tar header (tar archives only)
+}
+
+func (e *entry) Name() string       { return e.name }
+func (e *entry) Size() int64        { return e.size }
+func (e *entry) Mode() os.FileMode  { return e.mode }
+func (e *entry) ModTime() time.Time { return e.modTime }
+func (e *entry) IsDir() bool        { return e.mode.IsDir() }
+func (e *entry) Sys() interface{}   { return nil }
+
+// Archive is an indexed archive
+type Archive struct {
+	fileName string              // Archive file
+	zip      *zip.ReadCloser     // Opened zip archive (zip archives only)
+	gzipped  bool                // The tar archive is compressed
+	entries  map[string]*entry   // Entries by absolute path ("/dir/file")
+	children map[string][]*entry // Entries of each directory
+}
+
+// Open indexes an archive, its format is defined by its extension: .zip, .tar, .tar.gz or .tgz
+func Open(fileName string) (*Archive, error) {
+	a := &Archive{
+		fileName: fileName,
+		entries:  map[string]*entry{"/": {name: "/", mode: os.ModeDir | 0555}},
+		children: make(map[string][]*entry),
+	}
+
+	lower := strings.ToLower(fileName)
+	var err error
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = a.indexZip()
+	case strings.HasSuffix(lower, ".tar"):
+		err = a.indexTar()
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		a.gzipped = true
+		err = a.indexTar()
+	default:
+		err = fmt.Errorf("unknown archive format: %s", fileName)
+	}
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+
+	for _, children := range a.children {
+		sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	}
+	return a, nil
+}
+
+// Close releases the archive
+func (a *Archive) Close() error {
+	if a.zip != nil {
+		return a.zip.Close()
+	}
+	return nil
+}
+
+func (a *Archive) indexZip() error {
+	var err error
+	if a.zip, err = zip.OpenReader(a.fileName); err != nil {
+		return err
+	}
+	for _, f := range a.zip.File {
+		info := f.FileInfo()
+		e := &entry{size: info.Size(), mode: info.Mode(), modTime: info.ModTime(), zipFile: f}
+		if info.IsDir() {
+			e.mode = os.ModeDir | 0555
+		}
+		a.add(f.Name, e)
+	}
+	return nil
+}
+
+func (a *Archive) indexTar() error {
+	return a.readTar(func(header *tar.Header, r *tar.Reader) (bool, error) {
+		e := &entry{size: header.Size, mode: header.FileInfo().Mode(), modTime: header.ModTime, tarName: header.Name}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			e.mode = os.ModeDir | 0555
+			e.size = 0
+		case tar.TypeReg:
+		default:
+			// Links and special files aren't exposed
+			return true, nil
+		}
+		a.add(header.Name, e)
+		return true, nil
+	})
+}
+
+// readTar calls the callback for each header of the tar archive until it returns false
+func (a *Archive) readTar(callback func(*tar.Header, *tar.Reader) (bool, error)) error {
+	file, err := os.Open(a.fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if a.gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if next, err := callback(header, tr); err != nil || !next {
+			return err
+		}
+	}
+}
+
+// add registers an entry and its parent directories
+func (a *Archive) add(name string, e *entry) {
+	p := path.Clean("/" + name)
+	if p == "/" {
+		return
+	}
+
+	if existing, ok := a.entries[p]; ok {
+		// A directory can be declared after one of its files
+		if existing.IsDir() && e.IsDir() {
+			existing.modTime = e.modTime
+		}
+		return
+	}
+
+	parent, base := path.Split(p)
+	parent = path.Clean(parent)
+	if _, ok := a.entries[parent]; !ok {
+		a.add(parent, &entry{mode: os.ModeDir | 0555, modTime: e.modTime})
+	}
+
+	e.name = base
+	e.mode = e.mode&os.ModeDir | e.mode.Perm()&0555
+	if e.mode.Perm() == 0 {
+		e.mode |= 0444
+	}
+	a.entries[p] = e
+	a.children[parent] = append(a.children[parent], e)
+}
+
+// lookup returns the entry of a path
+func (a *Archive) lookup(p string) (*entry, error) {
+	if e, ok := a.entries[path.Clean("/"+p)]; ok {
+		return e, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// open opens the content of a file entry
+func (a *Archive) open(e *entry) (io.ReadCloser, error) {
+	if e.zipFile != nil {
+		return e.zipFile.Open()
+	}
+
+	// The tar archive is read again up to the file, the reader is handed over through a pipe
+	pr, pw := io.Pipe()
+	go func() {
+		found := false
+		err := a.readTar(func(header *tar.Header, tr *tar.Reader) (bool, error) {
+			if header.Name != e.tarName {
+				return true, nil
+			}
+			found = true
+			_, err := io.Copy(pw, tr)
+			return false, err
+		})
+		if err == nil && !found {
+			err = os.ErrNotExist
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// testContext is a client context in a directory
+type testContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *testContext) Path() string {
+	return c.path
+}
+
+var testFiles = map[string]string{
+	"firmware/v1/image.bin": "0123456789",
+	"firmware/README":       "Read me",
+	"LICENSE":               "Do what you want",
+}
+
+func createZip(t *testing.T, fileName string) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal("Couldn't create the archive:", err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for name, content := range testFiles {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal("Couldn't add a file:", err)
+		}
+		io.WriteString(f, content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Couldn't write the archive:", err)
+	}
+}
+
+func createTarGz(t *testing.T, fileName string) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal("Couldn't create the archive:", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	w := tar.NewWriter(gz)
+	for name, content := range testFiles {
+		if err := w.WriteHeader(&tar.Header{Name: name, Size: int64(len(content)), Mode: 0644}); err != nil {
+			t.Fatal("Couldn't add a file:", err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Couldn't write the archive:", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal("Couldn't compress the archive:", err)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, create := range map[string]func(*testing.T, string){
+		"test.zip":    createZip,
+		"test.tar.gz": createTarGz,
+	} {
+		fileName := filepath.Join(dir, name)
+		create(t, fileName)
+
+		a, err := Open(fileName)
+		if err != nil {
+			t.Fatal("Couldn't open", name, ":", err)
+		}
+		testArchive(t, a)
+		a.Close()
+	}
+}
+
+func testArchive(t *testing.T, a *Archive) {
+	files, err := a.ListFiles(&testContext{path: "/firmware"})
+	if err != nil {
+		t.Fatal("Couldn't list the files:", err)
+	}
+	if len(files) != 2 || files[0].Name() != "README" || files[1].Name() != "v1" || !files[1].IsDir() {
+		t.Fatal("Bad files:", files)
+	}
+
+	if err := a.ChangeDirectory(nil, "/firmware/v1"); err != nil {
+		t.Fatal("The implicit directory should exist:", err)
+	}
+
+	file, err := a.OpenFile(nil, "/firmware/v1/image.bin", os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open the file:", err)
+	}
+	defer file.Close()
+
+	// Resuming a download
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+	if content, err := ioutil.ReadAll(file); err != nil || string(content) != "456789" {
+		t.Fatal("Bad content:", string(content), err)
+	}
+
+	// Starting again
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+	if content, err := ioutil.ReadAll(file); err != nil || string(content) != "0123456789" {
+		t.Fatal("Bad content:", string(content), err)
+	}
+
+	if _, err := a.OpenFile(nil, "/LICENSE", os.O_WRONLY); err != ErrReadOnly {
+		t.Fatal("Writing should be refused:", err)
+	}
+	if _, err := a.GetFileInfo(nil, "/missing"); !os.IsNotExist(err) {
+		t.Fatal("Missing files should be reported:", err)
+	}
+}
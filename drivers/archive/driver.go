@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// MainDriver serves an archive to the users
+type MainDriver struct {
+	Archive   *Archive          // Served archive
+	Settings  *server.Settings  // Server settings
+	Users     map[string]string // Passwords by user name, anyone can log in if nil
+	TLSConfig *tls.Config       // TLS config, AUTH TLS is refused if it's not defined
+}
+
+// GetSettings returns the server settings
+func (driver *MainDriver) GetSettings() *server.Settings {
+	if driver.Settings == nil {
+		return &server.Settings{}
+	}
+	return driver.Settings
+}
+
+// WelcomeUser returns the welcome message
+func (driver *MainDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return "Welcome, this is a read-only server", nil
+}
+
+// UserLeft is called when the user disconnects
+func (driver *MainDriver) UserLeft(cc server.ClientContext) {
+}
+
+// AuthUser authenticates the user
+func (driver *MainDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	if driver.Users != nil {
+		expected, ok := driver.Users[user]
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) != 1 {
+			return nil, errors.New("bad username or password")
+		}
+	}
+	return driver.Archive, nil
+}
+
+// GetTLSConfig returns the TLS config
+func (driver *MainDriver) GetTLSConfig() (*tls.Config, error) {
+	if driver.TLSConfig == nil {
+		return nil, errors.New("TLS isn't configured")
+	}
+	return driver.TLSConfig, nil
+}
+
+// ChangeDirectory changes the current working directory
+func (a *Archive) ChangeDirectory(cc server.ClientContext, directory string) error {
+	e, err := a.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if !e.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+	return nil
+}
+
+// MakeDirectory always fails
+func (a *Archive) MakeDirectory(cc server.ClientContext, directory string) error {
+	return ErrReadOnly
+}
+
+// ListFiles lists the files of the current directory
+func (a *Archive) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	if err := a.ChangeDirectory(cc, cc.Path()); err != nil {
+		return nil, err
+	}
+
+	children := a.children[path.Clean("/"+cc.Path())]
+	files := make([]os.FileInfo, len(children))
+	for i, child := range children {
+		files[i] = child
+	}
+	return files, nil
+}
+
+// OpenFile opens a file for reading, writing is refused
+func (a *Archive) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, ErrReadOnly
+	}
+
+	e, err := a.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	return &entryStream{archive: a, entry: e}, nil
+}
+
+// DeleteFile always fails
+func (a *Archive) DeleteFile(cc server.ClientContext, path string) error {
+	return ErrReadOnly
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (a *Archive) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+	return a.lookup(path)
+}
+
+// RenameFile always fails
+func (a *Archive) RenameFile(cc server.ClientContext, from, to string) error {
+	return ErrReadOnly
+}
+
+// CanAllocate always refuses
+func (a *Archive) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return false, ErrReadOnly
+}
+
+// ChmodFile always fails
+func (a *Archive) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// errSeek is returned for the seeks that can't be performed on an archive entry
+var errSeek = errors.New("this seek isn't supported on an archive entry")
+
+// entryStream is the content of an archive entry. Compressed entries can't be accessed randomly: seeking forward
+// skips some content and seeking backward reads the entry again from its start.
+type entryStream struct {
+	archive *Archive
+	entry   *entry
+	reader  io.ReadCloser // Content, opened on the first read
+	pos     int64         // Current position
+}
+
+func (s *entryStream) Read(p []byte) (int, error) {
+	if s.reader == nil {
+		var err error
+		if s.reader, err = s.archive.open(s.entry); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.reader.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *entryStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.entry.size
+	}
+	if offset < 0 {
+		return s.pos, errSeek
+	}
+
+	if offset < s.pos {
+		s.Close()
+		s.pos = 0
+	}
+	if offset > s.pos {
+		if _, err := io.CopyN(ioutil.Discard, s, offset-s.pos); err != nil && err != io.EOF {
+			return s.pos, err
+		}
+	}
+	return s.pos, nil
+}
+
+// Write always fails: archives are read-only
+func (s *entryStream) Write(p []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (s *entryStream) Close() error {
+	if s.reader == nil {
+		return nil
+	}
+	err := s.reader.Close()
+	s.reader = nil
+	return err
+}
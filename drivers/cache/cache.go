@@ -0,0 +1,300 @@
+// Package cache is a driver wrapper keeping the downloaded files in a local directory, so that the hot files of slow
+// remote drivers aren't downloaded from them on every RETR. The cache is bounded in size (the least recently used
+// files are evicted first) and its entries expire after a TTL. Uploads are written through: they reach the wrapped
+// driver and the cache at the same time.
+package cache
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Cache is the local storage of the files, it can be shared by all the sessions
+type Cache struct {
+	dir     string                   // Directory of the cached files
+	maxSize int64                    // Maximum size of the cached files
+	ttl     time.Duration            // Lifetime of the entries, 0 for no expiry
+	mutex   sync.Mutex               // Protects the following fields
+	entries map[string]*list.Element // Entries by key
+	lru     *list.List               // Entries, the most recently used first
+	size    int64                    // Size of the cached files
+	now     func() time.Time         // Current time, replaced in tests
+}
+
+// entry is a cached file
+type entry struct {
+	key     string
+	file    string    // Local file
+	size    int64     // Size of the file
+	expires time.Time // Expiry of the entry
+}
+
+// New creates a cache storing up to maxSize bytes in dir
+func New(dir string, maxSize int64, ttl time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}, nil
+}
+
+// Size returns the size of the cached files
+func (cache *Cache) Size() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.size
+}
+
+// open opens a cached file, it returns nil if it isn't cached or expired
+func (cache *Cache) open(key string) *os.File {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	e := element.Value.(*entry)
+	if cache.ttl > 0 && cache.now().After(e.expires) {
+		cache.remove(element)
+		return nil
+	}
+
+	file, err := os.Open(e.file)
+	if err != nil {
+		cache.remove(element)
+		return nil
+	}
+	cache.lru.MoveToFront(element)
+	return file
+}
+
+// insert adds a local file to the cache, evicting the least recently used files to make some room for it
+func (cache *Cache) insert(key, file string, size int64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+	if size > cache.maxSize {
+		os.Remove(file)
+		return
+	}
+	for cache.size+size > cache.maxSize {
+		cache.remove(cache.lru.Back())
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&entry{
+		key:     key,
+		file:    file,
+		size:    size,
+		expires: cache.now().Add(cache.ttl),
+	})
+	cache.size += size
+}
+
+// invalidate removes the entries of a file, or of everything below a directory
+func (cache *Cache) invalidate(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for k, element := range cache.entries {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			cache.remove(element)
+		}
+	}
+}
+
+// remove removes an entry, the mutex must be held
+func (cache *Cache) remove(element *list.Element) {
+	e := element.Value.(*entry)
+	cache.lru.Remove(element)
+	delete(cache.entries, e.key)
+	cache.size -= e.size
+	os.Remove(e.file)
+}
+
+// Wrap wraps the driver of a session. The sessions sharing the same files (like the ones of the same user) should
+// use the same namespace.
+func (cache *Cache) Wrap(inner server.ClientHandlingDriver, namespace string) *Driver {
+	return &Driver{inner: inner, cache: cache, namespace: namespace}
+}
+
+// Driver serves the downloads of another driver from a cache
+type Driver struct {
+	inner     server.ClientHandlingDriver // Wrapped driver
+	cache     *Cache                      // Cache of the files
+	namespace string                      // Namespace of the files in the cache
+}
+
+func (driver *Driver) key(p string) string {
+	return driver.namespace + ":" + path.Clean("/"+p)
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.ChangeDirectory(cc, directory)
+}
+
+// MakeDirectory creates a directory
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.MakeDirectory(cc, directory)
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	return driver.inner.ListFiles(cc)
+}
+
+// OpenFile opens a file. The files opened for reading are served from the cache, they are downloaded entirely from
+// the wrapped driver when they aren't cached yet. The files opened for writing are written through.
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	key := driver.key(p)
+
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		driver.cache.invalidate(key)
+		file, err := driver.inner.OpenFile(cc, p, flag)
+		if err != nil || flag&os.O_APPEND != 0 {
+			return file, err
+		}
+		local, errLocal := ioutil.TempFile(driver.cache.dir, "file")
+		if errLocal != nil {
+			return file, nil
+		}
+		return &writeThrough{FileStream: file, cache: driver.cache, key: key, local: local}, nil
+	}
+
+	if file := driver.cache.open(key); file != nil {
+		return file, nil
+	}
+
+	file, err := driver.inner.OpenFile(cc, p, flag)
+	if err != nil {
+		return nil, err
+	}
+	if info, errInfo := driver.inner.GetFileInfo(cc, p); errInfo != nil || info.Size() > driver.cache.maxSize {
+		return file, nil
+	}
+
+	defer file.Close()
+	local, err := driver.fetch(key, file)
+	if err != nil {
+		return nil, err
+	}
+	return local, nil
+}
+
+// fetch copies a file to the cache and opens the cached copy
+func (driver *Driver) fetch(key string, file io.Reader) (*os.File, error) {
+	local, err := ioutil.TempFile(driver.cache.dir, "file")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(local, file)
+	if err == nil {
+		_, err = local.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		local.Close()
+		os.Remove(local.Name())
+		return nil, err
+	}
+	driver.cache.insert(key, local.Name(), size)
+	return local, nil
+}
+
+// DeleteFile deletes a file or a directory
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	driver.cache.invalidate(driver.key(p))
+	return driver.inner.DeleteFile(cc, p)
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	return driver.inner.GetFileInfo(cc, p)
+}
+
+// RenameFile renames a file or a directory
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	driver.cache.invalidate(driver.key(from))
+	driver.cache.invalidate(driver.key(to))
+	return driver.inner.RenameFile(cc, from, to)
+}
+
+// CanAllocate gives the approval to allocate some data
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.inner.CanAllocate(cc, size)
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.inner.ChmodFile(cc, p, mode)
+}
+
+// writeThrough writes a file to the wrapped driver and to the cache, the cached copy is only kept if the whole file
+// was written sequentially without error
+type writeThrough struct {
+	server.FileStream
+	cache *Cache
+	key   string
+	local *os.File // Cached copy, nil once given up
+	size  int64    // Size of the cached copy
+}
+
+func (w *writeThrough) Write(p []byte) (int, error) {
+	n, err := w.FileStream.Write(p)
+	if w.local != nil {
+		if _, errLocal := w.local.Write(p[:n]); errLocal != nil || w.size+int64(n) > w.cache.maxSize {
+			w.discard()
+		} else {
+			w.size += int64(n)
+		}
+	}
+	return n, err
+}
+
+func (w *writeThrough) Seek(offset int64, whence int) (int64, error) {
+	pos, err := w.FileStream.Seek(offset, whence)
+	if err != nil || pos != w.size {
+		w.discard()
+	}
+	return pos, err
+}
+
+// discard gives up the cached copy
+func (w *writeThrough) discard() {
+	if w.local != nil {
+		w.local.Close()
+		os.Remove(w.local.Name())
+		w.local = nil
+	}
+}
+
+func (w *writeThrough) Close() error {
+	err := w.FileStream.Close()
+	if err != nil || w.local == nil {
+		w.discard()
+		return err
+	}
+	if errLocal := w.local.Close(); errLocal != nil {
+		os.Remove(w.local.Name())
+		return nil
+	}
+	w.cache.insert(w.key, w.local.Name(), w.size)
+	return nil
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// countingDriver counts the files opened for reading
+type countingDriver struct {
+	server.ClientHandlingDriver
+	reads int
+}
+
+func (d *countingDriver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	if flag&os.O_WRONLY == 0 {
+		d.reads++
+	}
+	return d.ClientHandlingDriver.OpenFile(cc, p, flag)
+}
+
+func newTestDriver(t *testing.T, maxSize int64, ttl time.Duration) (*Driver, *countingDriver, string) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	inner, err := vusers.NewClientDriver(&vusers.User{Home: filepath.Join(dir, "origin")})
+	if err != nil {
+		t.Fatal("Couldn't create the inner driver:", err)
+	}
+	cache, err := New(filepath.Join(dir, "cache"), maxSize, ttl)
+	if err != nil {
+		t.Fatal("Couldn't create the cache:", err)
+	}
+	counting := &countingDriver{ClientHandlingDriver: inner}
+	return cache.Wrap(counting, "test"), counting, dir
+}
+
+func writeOrigin(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "origin", name), []byte(content), 0644); err != nil {
+		t.Fatal("Couldn't write", name, ":", err)
+	}
+}
+
+func readFile(t *testing.T, driver *Driver, p string) string {
+	file, err := driver.OpenFile(nil, p, os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal("Couldn't read", p, ":", err)
+	}
+	return string(content)
+}
+
+func TestHits(t *testing.T) {
+	driver, origin, dir := newTestDriver(t, 1000, 0)
+	defer os.RemoveAll(dir)
+
+	writeOrigin(t, dir, "hot.txt", "hot")
+	for i := 0; i < 3; i++ {
+		if content := readFile(t, driver, "/hot.txt"); content != "hot" {
+			t.Fatal("Bad content:", content)
+		}
+	}
+	if origin.reads != 1 {
+		t.Fatal("The file should be downloaded once:", origin.reads)
+	}
+
+	// Deleting the file invalidates its cached copy
+	if err := driver.DeleteFile(nil, "/hot.txt"); err != nil {
+		t.Fatal("Couldn't delete the file:", err)
+	}
+	if _, err := driver.OpenFile(nil, "/hot.txt", os.O_RDONLY); err == nil {
+		t.Fatal("The deleted file shouldn't be served")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	driver, origin, dir := newTestDriver(t, 10, 0)
+	defer os.RemoveAll(dir)
+
+	writeOrigin(t, dir, "a.txt", "aaaa")
+	writeOrigin(t, dir, "b.txt", "bbbb")
+	writeOrigin(t, dir, "c.txt", "cccc")
+	writeOrigin(t, dir, "big.txt", strings.Repeat("x", 20))
+
+	readFile(t, driver, "/a.txt")
+	readFile(t, driver, "/b.txt")
+	readFile(t, driver, "/a.txt")
+	readFile(t, driver, "/c.txt") // Evicts b, the least recently used
+	if origin.reads != 3 || driver.cache.Size() != 8 {
+		t.Fatal("Bad cache state:", origin.reads, driver.cache.Size())
+	}
+
+	readFile(t, driver, "/a.txt")
+	readFile(t, driver, "/b.txt")
+	if origin.reads != 4 {
+		t.Fatal("Only b should have been downloaded again:", origin.reads)
+	}
+
+	// The files bigger than the cache are served directly
+	if content := readFile(t, driver, "/big.txt"); len(content) != 20 || driver.cache.Size() > 10 {
+		t.Fatal("Bad big file:", content, driver.cache.Size())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	driver, origin, dir := newTestDriver(t, 1000, time.Minute)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	driver.cache.now = func() time.Time { return now }
+
+	writeOrigin(t, dir, "file.txt", "old")
+	readFile(t, driver, "/file.txt")
+	writeOrigin(t, dir, "file.txt", "new")
+
+	if content := readFile(t, driver, "/file.txt"); content != "old" {
+		t.Fatal("The cached copy should be served:", content)
+	}
+	now = now.Add(2 * time.Minute)
+	if content := readFile(t, driver, "/file.txt"); content != "new" || origin.reads != 2 {
+		t.Fatal("The expired copy shouldn't be served:", content, origin.reads)
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	driver, origin, dir := newTestDriver(t, 1000, 0)
+	defer os.RemoveAll(dir)
+
+	file, err := driver.OpenFile(nil, "/up.txt", os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't open the file:", err)
+	}
+	file.Write([]byte("uploaded"))
+	if err := file.Close(); err != nil {
+		t.Fatal("Couldn't close the file:", err)
+	}
+
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "origin", "up.txt")); string(content) != "uploaded" {
+		t.Fatal("The file should reach the origin:", string(content))
+	}
+	if content := readFile(t, driver, "/up.txt"); content != "uploaded" || origin.reads != 0 {
+		t.Fatal("The uploaded file should be cached:", content, origin.reads)
+	}
+}
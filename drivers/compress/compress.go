@@ -0,0 +1,220 @@
+// Package compress is a driver wrapper storing the files compressed on the wrapped driver and serving them
+// decompressed. The size of the decompressed content of each file is stored in a metadata file next to it, so that
+// listings and SIZE report the sizes seen by the clients.
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// metaPrefix prefixes the names of the metadata files, they are hidden from the clients
+const metaPrefix = ".size."
+
+// Codec compresses and decompresses the files. Appending writes a new compressed stream at the end of the file, so
+// the readers must accept concatenated streams (like gzip and zstd ones).
+type Codec interface {
+	// NewWriter creates a writer compressing to w
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader creates a reader decompressing r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCodec compresses with gzip
+type GzipCodec struct {
+	Level int // Compression level, gzip.DefaultCompression when 0
+}
+
+// NewWriter creates a gzip writer
+func (c GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+// NewReader creates a gzip reader
+func (c GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ErrSeek is returned for the seeks that can't be performed on a compressed file
+var ErrSeek = errors.New("this seek isn't supported on a compressed file")
+
+// Driver compresses the files of another driver
+type Driver struct {
+	inner server.ClientHandlingDriver // Wrapped driver
+	codec Codec                       // Codec of the files
+}
+
+// New wraps a driver, the files are compressed with gzip if no codec is given
+func New(inner server.ClientHandlingDriver, codec Codec) *Driver {
+	if codec == nil {
+		codec = GzipCodec{}
+	}
+	return &Driver{inner: inner, codec: codec}
+}
+
+func metaPath(p string) string {
+	return path.Join(path.Dir(p), metaPrefix+path.Base(p))
+}
+
+// readSize reads the size of the decompressed content of a file from its metadata file
+func (driver *Driver) readSize(cc server.ClientContext, p string) (int64, error) {
+	file, err := driver.inner.OpenFile(cc, metaPath(p), os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(file, 32))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
+
+func (driver *Driver) writeSize(cc server.ClientContext, p string, size int64) error {
+	file, err := driver.inner.OpenFile(cc, metaPath(p), os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte(strconv.FormatInt(size, 10)))
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// fileInfo is the info of a file with the size of its decompressed content
+type fileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (f *fileInfo) Size() int64 {
+	return f.size
+}
+
+func (driver *Driver) outerInfo(cc server.ClientContext, p string, info os.FileInfo) os.FileInfo {
+	if info.IsDir() {
+		return info
+	}
+	size, err := driver.readSize(cc, p)
+	if err != nil {
+		return info
+	}
+	return &fileInfo{FileInfo: info, size: size}
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.ChangeDirectory(cc, directory)
+}
+
+// MakeDirectory creates a directory
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.MakeDirectory(cc, directory)
+}
+
+// ListFiles lists the files of the current directory, without the metadata files
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	files, err := driver.inner.ListFiles(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make(map[string]bool)
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), metaPrefix) {
+			metas[strings.TrimPrefix(file.Name(), metaPrefix)] = true
+		}
+	}
+
+	outer := make([]os.FileInfo, 0, len(files)-len(metas))
+	for _, file := range files {
+		switch {
+		case strings.HasPrefix(file.Name(), metaPrefix):
+		case metas[file.Name()]:
+			outer = append(outer, driver.outerInfo(cc, path.Join(cc.Path(), file.Name()), file))
+		default:
+			outer = append(outer, file)
+		}
+	}
+	return outer, nil
+}
+
+// OpenFile opens a file, its content is compressed and decompressed on the fly
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	if strings.HasPrefix(path.Base(p), metaPrefix) {
+		return nil, os.ErrPermission
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		if _, err := driver.inner.GetFileInfo(cc, p); err != nil {
+			return nil, err
+		}
+		return &readStream{driver: driver, cc: cc, path: p}, nil
+	}
+
+	var base int64
+	if flag&os.O_APPEND != 0 {
+		base, _ = driver.readSize(cc, p)
+	}
+
+	file, err := driver.inner.OpenFile(cc, p, flag)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := driver.codec.NewWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &writeStream{driver: driver, cc: cc, path: p, file: file, writer: writer, size: base}, nil
+}
+
+// DeleteFile deletes a file or a directory, with its metadata
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	if err := driver.inner.DeleteFile(cc, p); err != nil {
+		return err
+	}
+	driver.inner.DeleteFile(cc, metaPath(p))
+	return nil
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	info, err := driver.inner.GetFileInfo(cc, p)
+	if err != nil {
+		return nil, err
+	}
+	return driver.outerInfo(cc, p, info), nil
+}
+
+// RenameFile renames a file or a directory, with its metadata
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	if err := driver.inner.RenameFile(cc, from, to); err != nil {
+		return err
+	}
+	driver.inner.RenameFile(cc, metaPath(from), metaPath(to))
+	return nil
+}
+
+// CanAllocate gives the approval to allocate some data
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.inner.CanAllocate(cc, size)
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.inner.ChmodFile(cc, p, mode)
+}
@@ -0,0 +1,130 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// testContext is a client context in a directory
+type testContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *testContext) Path() string {
+	return c.path
+}
+
+func newTestDriver(t *testing.T) (*Driver, string) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	inner, err := vusers.NewClientDriver(&vusers.User{Home: dir})
+	if err != nil {
+		t.Fatal("Couldn't create the inner driver:", err)
+	}
+	return New(inner, nil), dir
+}
+
+func writeFile(t *testing.T, driver *Driver, p string, flag int, content string) {
+	file, err := driver.OpenFile(nil, p, os.O_WRONLY|flag)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatal("Couldn't write", p, ":", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal("Couldn't close", p, ":", err)
+	}
+}
+
+func readFile(t *testing.T, driver *Driver, p string, offset int64) string {
+	file, err := driver.OpenFile(nil, p, os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek", p, ":", err)
+	}
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal("Couldn't read", p, ":", err)
+	}
+	return string(content)
+}
+
+func TestCompression(t *testing.T) {
+	driver, dir := newTestDriver(t)
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("compressible ", 1000)
+	writeFile(t, driver, "/file.txt", 0, content[:5000])
+	writeFile(t, driver, "/file.txt", os.O_APPEND, content[5000:])
+
+	if read := readFile(t, driver, "/file.txt", 0); read != content {
+		t.Fatal("Bad content:", len(read))
+	}
+	if read := readFile(t, driver, "/file.txt", 6000); read != content[6000:] {
+		t.Fatal("Bad content after seeking:", len(read))
+	}
+
+	stored, err := ioutil.ReadFile(filepath.Join(dir, "file.txt"))
+	if err != nil || len(stored) >= len(content) || bytes.Contains(stored, []byte("compressible")) {
+		t.Fatal("The file should be stored compressed:", len(stored), err)
+	}
+
+	info, err := driver.GetFileInfo(nil, "/file.txt")
+	if err != nil || info.Size() != int64(len(content)) {
+		t.Fatal("Bad file info:", info, err)
+	}
+
+	files, err := driver.ListFiles(&testContext{path: "/"})
+	if err != nil || len(files) != 1 || files[0].Name() != "file.txt" || files[0].Size() != int64(len(content)) {
+		t.Fatal("Bad listing:", files, err)
+	}
+}
+
+func TestRenameAndDelete(t *testing.T) {
+	driver, dir := newTestDriver(t)
+	defer os.RemoveAll(dir)
+
+	writeFile(t, driver, "/a.txt", 0, "content")
+	if err := driver.RenameFile(nil, "/a.txt", "/b.txt"); err != nil {
+		t.Fatal("Couldn't rename:", err)
+	}
+	if info, err := driver.GetFileInfo(nil, "/b.txt"); err != nil || info.Size() != 7 {
+		t.Fatal("The metadata should follow the file:", info, err)
+	}
+
+	if err := driver.DeleteFile(nil, "/b.txt"); err != nil {
+		t.Fatal("Couldn't delete:", err)
+	}
+	if stored, _ := ioutil.ReadDir(dir); len(stored) != 0 {
+		t.Fatal("The metadata should be deleted:", stored)
+	}
+}
+
+func TestWriteSeek(t *testing.T) {
+	driver, dir := newTestDriver(t)
+	defer os.RemoveAll(dir)
+
+	file, err := driver.OpenFile(nil, "/file.txt", os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't open:", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(10, io.SeekStart); err != ErrSeek {
+		t.Fatal("Compressed files can't be written randomly:", err)
+	}
+}
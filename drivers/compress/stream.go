@@ -0,0 +1,127 @@
+package compress
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// readStream is the decompressed content of a file. Compressed files can't be accessed randomly: seeking forward
+// skips some content and seeking backward decompresses the file again from its start.
+type readStream struct {
+	driver *Driver
+	cc     server.ClientContext
+	path   string
+	file   server.FileStream // Compressed file, opened on the first read
+	reader io.ReadCloser     // Decompressed content
+	pos    int64             // Current position
+}
+
+func (s *readStream) open() error {
+	file, err := s.driver.inner.OpenFile(s.cc, s.path, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	reader, err := s.driver.codec.NewReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.reader = file, reader
+	return nil
+}
+
+func (s *readStream) Read(p []byte) (int, error) {
+	if s.reader == nil {
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.reader.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *readStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		size, err := s.driver.readSize(s.cc, s.path)
+		if err != nil {
+			return s.pos, ErrSeek
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return s.pos, ErrSeek
+	}
+
+	if offset < s.pos {
+		s.Close()
+		s.pos = 0
+	}
+	if offset > s.pos {
+		if _, err := io.CopyN(ioutil.Discard, s, offset-s.pos); err != nil && err != io.EOF {
+			return s.pos, err
+		}
+	}
+	return s.pos, nil
+}
+
+// Write always fails: the file was opened for reading
+func (s *readStream) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (s *readStream) Close() error {
+	if s.reader == nil {
+		return nil
+	}
+	s.reader.Close()
+	err := s.file.Close()
+	s.file, s.reader = nil, nil
+	return err
+}
+
+// writeStream compresses what is written, the size of the content is saved when it's closed
+type writeStream struct {
+	driver *Driver
+	cc     server.ClientContext
+	path   string
+	file   server.FileStream // Compressed file
+	writer io.WriteCloser    // Compressing writer
+	size   int64             // Size of the content
+}
+
+func (s *writeStream) Write(p []byte) (int, error) {
+	n, err := s.writer.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Seek can only keep the current position: a compressed file can't be written randomly
+func (s *writeStream) Seek(offset int64, whence int) (int64, error) {
+	if (whence == io.SeekCurrent && offset == 0) || (whence == io.SeekStart && offset == s.size) {
+		return s.size, nil
+	}
+	return s.size, ErrSeek
+}
+
+// Read always fails: the file was opened for writing
+func (s *writeStream) Read(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (s *writeStream) Close() error {
+	err := s.writer.Close()
+	if errClose := s.file.Close(); err == nil {
+		err = errClose
+	}
+	if errSize := s.driver.writeSize(s.cc, s.path, s.size); err == nil {
+		err = errSize
+	}
+	return err
+}
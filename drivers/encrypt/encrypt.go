@@ -0,0 +1,256 @@
+// Package encrypt is a driver wrapper encrypting the content (and optionally the names) of the files before they
+// reach the wrapped driver. Clients see plain files while the backend only stores encrypted data.
+//
+// The contents are encrypted with AES-256 in CTR mode with a random IV stored in a header at the beginning of each
+// file, which keeps downloads resumable and uploads appendable. This protects the confidentiality of the stored data,
+// not its integrity. The names are encrypted deterministically (the IV is derived from the name) so that they can be
+// looked up.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// KeySize is the size of the keys
+const KeySize = 32
+
+// Options defines what is encrypted besides the contents
+type Options struct {
+	EncryptNames bool // Encrypt the names of the files and directories
+}
+
+// Driver encrypts the files of another driver
+type Driver struct {
+	inner        server.ClientHandlingDriver // Wrapped driver
+	contentBlock cipher.Block                // Cipher of the contents
+	nameBlock    cipher.Block                // Cipher of the names
+	nameKey      []byte                      // Key of the names IV derivation
+	options      Options                     // Options
+}
+
+// DeriveKey derives a user key from a master key, so that every user has its own key
+func DeriveKey(master []byte, user string) []byte {
+	return deriveKey(master, "user:"+user)
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// New wraps a driver with a KeySize bytes key
+func New(inner server.ClientHandlingDriver, key []byte, options Options) (*Driver, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the key must be %d bytes long", KeySize)
+	}
+
+	contentBlock, err := aes.NewCipher(deriveKey(key, "content"))
+	if err != nil {
+		return nil, err
+	}
+	nameBlock, err := aes.NewCipher(deriveKey(key, "name"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		inner:        inner,
+		contentBlock: contentBlock,
+		nameBlock:    nameBlock,
+		nameKey:      deriveKey(key, "name-iv"),
+		options:      options,
+	}, nil
+}
+
+// encryptName encrypts a file name: the IV derived from the name is followed by the encrypted name
+func (driver *Driver) encryptName(name string) string {
+	mac := hmac.New(sha256.New, driver.nameKey)
+	mac.Write([]byte(name))
+	iv := mac.Sum(nil)[:aes.BlockSize]
+
+	buf := make([]byte, aes.BlockSize+len(name))
+	copy(buf, iv)
+	cipher.NewCTR(driver.nameBlock, iv).XORKeyStream(buf[aes.BlockSize:], []byte(name))
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// errBadName is returned for the names that weren't encrypted by the driver
+var errBadName = errors.New("not an encrypted name")
+
+// decryptName decrypts a file name
+func (driver *Driver) decryptName(encrypted string) (string, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil || len(buf) < aes.BlockSize {
+		return "", errBadName
+	}
+	name := make([]byte, len(buf)-aes.BlockSize)
+	cipher.NewCTR(driver.nameBlock, buf[:aes.BlockSize]).XORKeyStream(name, buf[aes.BlockSize:])
+	return string(name), nil
+}
+
+// innerPath converts a path to the one of the wrapped driver
+func (driver *Driver) innerPath(p string) string {
+	p = path.Clean("/" + p)
+	if !driver.options.EncryptNames || p == "/" {
+		return p
+	}
+	parts := strings.Split(p[1:], "/")
+	for i, part := range parts {
+		parts[i] = driver.encryptName(part)
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// innerContext is the client context seen by the wrapped driver, its path is the encrypted one
+type innerContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *innerContext) Path() string {
+	return c.path
+}
+
+func (driver *Driver) innerContext(cc server.ClientContext) server.ClientContext {
+	if !driver.options.EncryptNames || cc == nil {
+		return cc
+	}
+	return &innerContext{ClientContext: cc, path: driver.innerPath(cc.Path())}
+}
+
+// fileInfo is the info of a file as seen by the clients
+type fileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f *fileInfo) Name() string {
+	return f.name
+}
+
+func (f *fileInfo) Size() int64 {
+	if f.IsDir() {
+		return f.FileInfo.Size()
+	}
+	if size := f.FileInfo.Size() - int64(headerSize); size > 0 {
+		return size
+	}
+	return 0
+}
+
+// outerInfo converts the info of the wrapped driver, false is returned for the files that should be ignored
+func (driver *Driver) outerInfo(info os.FileInfo) (os.FileInfo, bool) {
+	name := info.Name()
+	if driver.options.EncryptNames {
+		var err error
+		if name, err = driver.decryptName(name); err != nil {
+			return nil, false
+		}
+	}
+	return &fileInfo{FileInfo: info, name: name}, true
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.ChangeDirectory(driver.innerContext(cc), driver.innerPath(directory))
+}
+
+// MakeDirectory creates a directory
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.MakeDirectory(driver.innerContext(cc), driver.innerPath(directory))
+}
+
+// ListFiles lists the files of the current directory, the files whose name can't be decrypted are ignored
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	files, err := driver.inner.ListFiles(driver.innerContext(cc))
+	if err != nil {
+		return nil, err
+	}
+	outer := make([]os.FileInfo, 0, len(files))
+	for _, file := range files {
+		if info, ok := driver.outerInfo(file); ok {
+			outer = append(outer, info)
+		}
+	}
+	return outer, nil
+}
+
+// OpenFile opens a file, its content is encrypted and decrypted on the fly
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	icc, ip := driver.innerContext(cc), driver.innerPath(p)
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		file, err := driver.inner.OpenFile(icc, ip, flag)
+		if err != nil {
+			return nil, err
+		}
+		return newReadStream(driver.contentBlock, file)
+	}
+
+	if flag&os.O_APPEND != 0 {
+		if info, err := driver.inner.GetFileInfo(icc, ip); err == nil && info.Size() > 0 {
+			// The IV of the file is required to append to it
+			file, err := driver.inner.OpenFile(icc, ip, os.O_RDONLY)
+			if err != nil {
+				return nil, err
+			}
+			iv, err := readHeader(file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			if file, err = driver.inner.OpenFile(icc, ip, flag); err != nil {
+				return nil, err
+			}
+			return newAppendStream(driver.contentBlock, file, iv, info.Size()-int64(headerSize)), nil
+		}
+	}
+
+	file, err := driver.inner.OpenFile(icc, ip, flag)
+	if err != nil {
+		return nil, err
+	}
+	return newWriteStream(driver.contentBlock, file)
+}
+
+// DeleteFile deletes a file or a directory
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	return driver.inner.DeleteFile(driver.innerContext(cc), driver.innerPath(p))
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	info, err := driver.inner.GetFileInfo(driver.innerContext(cc), driver.innerPath(p))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{FileInfo: info, name: path.Base(path.Clean("/" + p))}, nil
+}
+
+// RenameFile renames a file or a directory
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	return driver.inner.RenameFile(driver.innerContext(cc), driver.innerPath(from), driver.innerPath(to))
+}
+
+// CanAllocate gives the approval to allocate some data, including the header of the file
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.inner.CanAllocate(driver.innerContext(cc), size+headerSize)
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.inner.ChmodFile(driver.innerContext(cc), driver.innerPath(p), mode)
+}
@@ -0,0 +1,145 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// testContext is a client context in a directory
+type testContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *testContext) Path() string {
+	return c.path
+}
+
+func newTestDriver(t *testing.T, options Options) (*Driver, string) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	inner, err := vusers.NewClientDriver(&vusers.User{Home: dir})
+	if err != nil {
+		t.Fatal("Couldn't create the inner driver:", err)
+	}
+	driver, err := New(inner, DeriveKey(bytes.Repeat([]byte{1}, KeySize), "test"), options)
+	if err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+	return driver, dir
+}
+
+func writeFile(t *testing.T, driver *Driver, p string, flag int, content string) {
+	file, err := driver.OpenFile(nil, p, os.O_WRONLY|flag)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatal("Couldn't write", p, ":", err)
+	}
+	file.Close()
+}
+
+func readFile(t *testing.T, driver *Driver, p string, offset int64) string {
+	file, err := driver.OpenFile(nil, p, os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek", p, ":", err)
+	}
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal("Couldn't read", p, ":", err)
+	}
+	return string(content)
+}
+
+func TestContent(t *testing.T) {
+	driver, dir := newTestDriver(t, Options{})
+	defer os.RemoveAll(dir)
+
+	content := "The quick brown fox jumps over the lazy dog"
+	writeFile(t, driver, "/fox.txt", 0, content[:20])
+	writeFile(t, driver, "/fox.txt", os.O_APPEND, content[20:])
+
+	if read := readFile(t, driver, "/fox.txt", 0); read != content {
+		t.Fatal("Bad content:", read)
+	}
+	if read := readFile(t, driver, "/fox.txt", 17); read != content[17:] {
+		t.Fatal("Bad content after seeking:", read)
+	}
+
+	// The backend only stores the encrypted content
+	stored, err := ioutil.ReadFile(filepath.Join(dir, "fox.txt"))
+	if err != nil {
+		t.Fatal("Couldn't read the stored file:", err)
+	}
+	if bytes.Contains(stored, []byte("fox")) || len(stored) != len(content)+headerSize {
+		t.Fatal("Bad stored content:", stored)
+	}
+
+	info, err := driver.GetFileInfo(nil, "/fox.txt")
+	if err != nil || info.Size() != int64(len(content)) {
+		t.Fatal("Bad file info:", info, err)
+	}
+}
+
+func TestNotEncrypted(t *testing.T) {
+	driver, dir := newTestDriver(t, Options{})
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "plain.txt"), []byte("plain"), 0644)
+	if _, err := driver.OpenFile(nil, "/plain.txt", os.O_RDONLY); err != ErrNotEncrypted {
+		t.Fatal("Plain files shouldn't be readable:", err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	driver, dir := newTestDriver(t, Options{EncryptNames: true})
+	defer os.RemoveAll(dir)
+
+	if err := driver.MakeDirectory(nil, "/secret"); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	writeFile(t, driver, "/secret/plans.txt", 0, "plans")
+	if err := driver.RenameFile(nil, "/secret/plans.txt", "/secret/ideas.txt"); err != nil {
+		t.Fatal("Couldn't rename the file:", err)
+	}
+
+	files, err := driver.ListFiles(&testContext{path: "/secret"})
+	if err != nil || len(files) != 1 || files[0].Name() != "ideas.txt" || files[0].Size() != 5 {
+		t.Fatal("Bad listing:", files, err)
+	}
+	if read := readFile(t, driver, "/secret/ideas.txt", 0); read != "plans" {
+		t.Fatal("Bad content:", read)
+	}
+
+	// The names are encrypted on the backend
+	stored, _ := ioutil.ReadDir(dir)
+	if len(stored) != 1 || stored[0].Name() == "secret" {
+		t.Fatal("Bad stored names:", stored)
+	}
+
+	// The names depend on the key of the user
+	other, _ := New(nil, DeriveKey(bytes.Repeat([]byte{1}, KeySize), "other"), Options{EncryptNames: true})
+	if other.encryptName("secret") == driver.encryptName("secret") {
+		t.Fatal("The users should have different keys")
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	if _, err := New(nil, []byte("short"), Options{}); err == nil {
+		t.Fatal("Short keys should be refused")
+	}
+}
@@ -0,0 +1,146 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// magic starts the header of the encrypted files, it's followed by the IV of the file
+const magic = "FTPENC1\x00"
+
+const headerSize = len(magic) + aes.BlockSize
+
+// ErrNotEncrypted is returned when reading a file that wasn't encrypted by the driver
+var ErrNotEncrypted = errors.New("the file isn't encrypted")
+
+// errSeek is returned for the seeks before the beginning of the file
+var errSeek = errors.New("can't seek before the beginning of the file")
+
+// readHeader reads the header of a file and returns its IV
+func readHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	return header[len(magic):], nil
+}
+
+// cryptStream encrypts what is written and decrypts what is read. As the contents are encrypted in CTR mode, the
+// key stream can be started at any position of the file.
+type cryptStream struct {
+	block  cipher.Block
+	file   server.FileStream // Encrypted file
+	iv     []byte            // IV of the file
+	pos    int64             // Current position in the plain content
+	stream cipher.Stream     // Key stream at the current position
+}
+
+func newCryptStream(block cipher.Block, file server.FileStream, iv []byte, pos int64) *cryptStream {
+	s := &cryptStream{block: block, file: file, iv: iv}
+	s.reset(pos)
+	return s
+}
+
+func newReadStream(block cipher.Block, file server.FileStream) (*cryptStream, error) {
+	iv, err := readHeader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return newCryptStream(block, file, iv, 0), nil
+}
+
+func newWriteStream(block cipher.Block, file server.FileStream) (*cryptStream, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(append([]byte(magic), iv...)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return newCryptStream(block, file, iv, 0), nil
+}
+
+func newAppendStream(block cipher.Block, file server.FileStream, iv []byte, pos int64) *cryptStream {
+	return newCryptStream(block, file, iv, pos)
+}
+
+// reset starts the key stream at a position of the plain content
+func (s *cryptStream) reset(pos int64) {
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, s.iv)
+
+	// The counter is the IV incremented by the number of blocks before the position
+	low := binary.BigEndian.Uint64(counter[8:])
+	blocks := uint64(pos / aes.BlockSize)
+	binary.BigEndian.PutUint64(counter[8:], low+blocks)
+	if low+blocks < low {
+		binary.BigEndian.PutUint64(counter[:8], binary.BigEndian.Uint64(counter[:8])+1)
+	}
+
+	s.stream = cipher.NewCTR(s.block, counter)
+	if skip := int(pos % aes.BlockSize); skip > 0 {
+		discard := make([]byte, skip)
+		s.stream.XORKeyStream(discard, discard)
+	}
+	s.pos = pos
+}
+
+func (s *cryptStream) Read(p []byte) (int, error) {
+	n, err := s.file.Read(p)
+	s.stream.XORKeyStream(p[:n], p[:n])
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *cryptStream) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	s.stream.XORKeyStream(buf, p)
+	n, err := s.file.Write(buf)
+	if n < len(p) {
+		s.reset(s.pos + int64(n))
+	} else {
+		s.pos += int64(n)
+	}
+	return n, err
+}
+
+func (s *cryptStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		end, err := s.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return s.pos, err
+		}
+		offset += end - int64(headerSize)
+	}
+	if offset < 0 {
+		return s.pos, errSeek
+	}
+
+	if _, err := s.file.Seek(offset+int64(headerSize), io.SeekStart); err != nil {
+		return s.pos, err
+	}
+	s.reset(offset)
+	return s.pos, nil
+}
+
+func (s *cryptStream) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,254 @@
+// Package iofs is a read-only driver serving any io/fs.FS, like an embed.FS, an os.DirFS or a testing/fstest.MapFS:
+//
+//	//go:embed assets
+//	var assets embed.FS
+//
+//	ftpServer := server.NewFtpServer(&iofs.MainDriver{FS: assets})
+//
+// The paths of the clients are the ones of the file system, "/assets/logo.png" is the "assets/logo.png" file.
+package iofs
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// ErrReadOnly is returned for every modification attempt
+var ErrReadOnly = errors.New("read-only file system")
+
+// errSeek is returned for the seeks that can't be performed on a file
+var errSeek = errors.New("this seek isn't supported on this file")
+
+// MainDriver serves a file system to the users
+type MainDriver struct {
+	FS        fs.FS             // Served file system
+	Settings  *server.Settings  // Server settings
+	Users     map[string]string // Passwords by user name, anyone can log in if nil
+	TLSConfig *tls.Config       // TLS config, AUTH TLS is refused if it's not defined
+}
+
+// GetSettings returns the server settings
+func (driver *MainDriver) GetSettings() *server.Settings {
+	if driver.Settings == nil {
+		return &server.Settings{}
+	}
+	return driver.Settings
+}
+
+// WelcomeUser returns the welcome message
+func (driver *MainDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return "Welcome, this is a read-only server", nil
+}
+
+// UserLeft is called when the user disconnects
+func (driver *MainDriver) UserLeft(cc server.ClientContext) {
+}
+
+// AuthUser authenticates the user
+func (driver *MainDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	if driver.Users != nil {
+		expected, ok := driver.Users[user]
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) != 1 {
+			return nil, errors.New("bad username or password")
+		}
+	}
+	return New(driver.FS), nil
+}
+
+// GetTLSConfig returns the TLS config
+func (driver *MainDriver) GetTLSConfig() (*tls.Config, error) {
+	if driver.TLSConfig == nil {
+		return nil, errors.New("TLS isn't configured")
+	}
+	return driver.TLSConfig, nil
+}
+
+// Driver serves the files of a file system
+type Driver struct {
+	fsys fs.FS
+}
+
+// New creates a driver serving a file system
+func New(fsys fs.FS) *Driver {
+	return &Driver{fsys: fsys}
+}
+
+// name converts the path of a client to the name of a file of the file system
+func name(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+// fileInfo is the info of a file, without the write permissions
+type fileInfo struct {
+	fs.FileInfo
+}
+
+func (f *fileInfo) Mode() os.FileMode {
+	return f.FileInfo.Mode() &^ 0222
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	info, err := fs.Stat(driver.fsys, name(directory))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+	return nil
+}
+
+// MakeDirectory always fails
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return ErrReadOnly
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(driver.fsys, name(cc.Path()))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The file was removed since the directory was read
+			continue
+		}
+		files = append(files, &fileInfo{info})
+	}
+	return files, nil
+}
+
+// OpenFile opens a file for reading, writing is refused
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, ErrReadOnly
+	}
+
+	file, err := driver.fsys.Open(name(p))
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("%s is a directory", p)
+	}
+	return &fileStream{fsys: driver.fsys, name: name(p), size: info.Size(), file: file}, nil
+}
+
+// DeleteFile always fails
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	return ErrReadOnly
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	info, err := fs.Stat(driver.fsys, name(p))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{info}, nil
+}
+
+// RenameFile always fails
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	return ErrReadOnly
+}
+
+// CanAllocate always refuses
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return false, ErrReadOnly
+}
+
+// ChmodFile always fails
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return ErrReadOnly
+}
+
+// fileStream is the content of a file. The files that can't seek (fs.File only requires Read) are read again from
+// their start to seek backward, and some content is skipped to seek forward.
+type fileStream struct {
+	fsys fs.FS
+	name string
+	size int64   // Size of the file
+	file fs.File // Opened file
+	pos  int64   // Current position
+}
+
+func (s *fileStream) Read(p []byte) (int, error) {
+	if s.file == nil {
+		var err error
+		if s.file, err = s.fsys.Open(s.name); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.file.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *fileStream) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := s.file.(io.Seeker); ok {
+		pos, err := seeker.Seek(offset, whence)
+		if err == nil {
+			s.pos = pos
+		}
+		return pos, err
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return s.pos, errSeek
+	}
+
+	if offset < s.pos {
+		s.Close()
+		s.pos = 0
+	}
+	if offset > s.pos {
+		if _, err := io.CopyN(ioutil.Discard, s, offset-s.pos); err != nil && err != io.EOF {
+			return s.pos, err
+		}
+	}
+	return s.pos, nil
+}
+
+// Write always fails: the file system is read-only
+func (s *fileStream) Write(p []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (s *fileStream) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,111 @@
+package iofs
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fclairamb/ftpserver/drivertest"
+)
+
+var testFS = fstest.MapFS{
+	"firmware/v1/image.bin": {Data: []byte("0123456789"), Mode: 0644},
+	"firmware/README":       {Data: []byte("Read me"), Mode: 0644},
+	"LICENSE":               {Data: []byte("Do what you want"), Mode: 0644},
+}
+
+// streamFile hides the Seek method of a file
+type streamFile struct{ fs.File }
+
+// streamFS serves files that can't seek, in directories that can be read
+type streamFS struct{ fs.FS }
+
+func (f streamFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return file, nil
+	}
+	return streamFile{file}, nil
+}
+
+func TestFS(t *testing.T) {
+	for name, fsys := range map[string]fs.FS{"seekable": testFS, "stream": streamFS{testFS}} {
+		t.Run(name, func(t *testing.T) {
+			testDriver(t, New(fsys))
+		})
+	}
+}
+
+func testDriver(t *testing.T, driver *Driver) {
+	cc := drivertest.NewContext(1, "anonymous")
+	cc.SetPath("/firmware")
+	files, err := driver.ListFiles(cc)
+	if err != nil {
+		t.Fatal("Couldn't list the files:", err)
+	}
+	if len(files) != 2 || files[0].Name() != "README" || files[1].Name() != "v1" || !files[1].IsDir() {
+		t.Fatal("Bad files:", files)
+	}
+	if files[0].Mode().Perm() != 0444 {
+		t.Fatal("The files should be read-only:", files[0].Mode())
+	}
+
+	if err := driver.ChangeDirectory(cc, "/firmware/v1"); err != nil {
+		t.Fatal("The directory should exist:", err)
+	}
+	if err := driver.ChangeDirectory(cc, "/LICENSE"); err == nil {
+		t.Fatal("A file isn't a directory")
+	}
+
+	file, err := driver.OpenFile(cc, "/firmware/v1/image.bin", os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open the file:", err)
+	}
+	defer file.Close()
+
+	// Resuming a download
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+	if content, err := ioutil.ReadAll(file); err != nil || string(content) != "456789" {
+		t.Fatal("Bad content:", string(content), err)
+	}
+
+	// Starting again
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+	if content, err := ioutil.ReadAll(file); err != nil || string(content) != "0123456789" {
+		t.Fatal("Bad content:", string(content), err)
+	}
+
+	if _, err := driver.OpenFile(cc, "/LICENSE", os.O_WRONLY); err != ErrReadOnly {
+		t.Fatal("Writing should be refused:", err)
+	}
+	if err := driver.DeleteFile(cc, "/LICENSE"); err != ErrReadOnly {
+		t.Fatal("Deleting should be refused:", err)
+	}
+	if _, err := driver.GetFileInfo(cc, "/missing"); !os.IsNotExist(err) {
+		t.Fatal("Missing files should be reported:", err)
+	}
+	if info, err := driver.GetFileInfo(cc, "/"); err != nil || !info.IsDir() {
+		t.Fatal("The root should be a directory:", info, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	driver := &MainDriver{FS: testFS, Users: map[string]string{"john": "secret"}}
+	cc := drivertest.NewContext(1, "john")
+	if _, err := driver.AuthUser(cc, "john", "bad"); err == nil {
+		t.Fatal("A bad password should be refused")
+	}
+	if _, err := driver.AuthUser(cc, "john", "secret"); err != nil {
+		t.Fatal("The user should log in:", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package mirror is a driver combinator replicating the changes made to a primary driver on some replicas, for a
+// cheap redundancy across sites. The reads are only served by the primary driver.
+package mirror
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Consistency defines how the failures of the replicas are handled
+type Consistency int
+
+const (
+	// BestEffort only requires the primary driver to succeed, the failures of the replicas are reported to OnError
+	BestEffort Consistency = iota
+	// AllMustSucceed fails the commands when any driver fails. Nothing is rolled back on the drivers that succeeded.
+	AllMustSucceed
+)
+
+// ReplicaError is the error of a replica
+type ReplicaError struct {
+	Replica int   // Index of the replica, starting at 1 (0 is the primary driver)
+	Err     error // Error of the replica
+}
+
+func (e *ReplicaError) Error() string {
+	return fmt.Sprintf("replica %d: %v", e.Replica, e.Err)
+}
+
+// Driver replicates the changes made to a primary driver
+type Driver struct {
+	drivers     []server.ClientHandlingDriver // Primary driver followed by the replicas
+	consistency Consistency                   // Handling of the failures of the replicas
+
+	// OnError is called with the errors of the replicas that didn't fail the commands
+	OnError func(err *ReplicaError)
+}
+
+// New creates a driver replicating the changes made to primary on the replicas
+func New(consistency Consistency, primary server.ClientHandlingDriver, replicas ...server.ClientHandlingDriver) *Driver {
+	return &Driver{
+		drivers:     append([]server.ClientHandlingDriver{primary}, replicas...),
+		consistency: consistency,
+	}
+}
+
+// replicate applies a change to all the drivers
+func (driver *Driver) replicate(change func(d server.ClientHandlingDriver) error) error {
+	if err := change(driver.drivers[0]); err != nil {
+		return err
+	}
+	var failure error
+	for i, d := range driver.drivers[1:] {
+		if err := change(d); err != nil {
+			replicaErr := &ReplicaError{Replica: i + 1, Err: err}
+			if driver.consistency == AllMustSucceed && failure == nil {
+				failure = replicaErr
+			} else {
+				driver.reportError(replicaErr)
+			}
+		}
+	}
+	return failure
+}
+
+func (driver *Driver) reportError(err *ReplicaError) {
+	if driver.OnError != nil {
+		driver.OnError(err)
+	}
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.drivers[0].ChangeDirectory(cc, directory)
+}
+
+// MakeDirectory creates a directory on all the drivers
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.replicate(func(d server.ClientHandlingDriver) error {
+		return d.MakeDirectory(cc, directory)
+	})
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	return driver.drivers[0].ListFiles(cc)
+}
+
+// OpenFile opens a file. The files opened for writing are written to all the drivers.
+func (driver *Driver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
+	primary, err := driver.drivers[0].OpenFile(cc, path, flag)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return primary, err
+	}
+
+	stream := &mirrorStream{driver: driver, files: []server.FileStream{primary}, replicas: []int{0}}
+	for i, d := range driver.drivers[1:] {
+		file, err := d.OpenFile(cc, path, flag)
+		if err != nil {
+			replicaErr := &ReplicaError{Replica: i + 1, Err: err}
+			if driver.consistency == AllMustSucceed {
+				stream.Close()
+				return nil, replicaErr
+			}
+			driver.reportError(replicaErr)
+			continue
+		}
+		stream.files = append(stream.files, file)
+		stream.replicas = append(stream.replicas, i+1)
+	}
+	return stream, nil
+}
+
+// DeleteFile deletes a file or a directory on all the drivers
+func (driver *Driver) DeleteFile(cc server.ClientContext, path string) error {
+	return driver.replicate(func(d server.ClientHandlingDriver) error {
+		return d.DeleteFile(cc, path)
+	})
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+	return driver.drivers[0].GetFileInfo(cc, path)
+}
+
+// RenameFile renames a file or a directory on all the drivers
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	return driver.replicate(func(d server.ClientHandlingDriver) error {
+		return d.RenameFile(cc, from, to)
+	})
+}
+
+// CanAllocate gives the approval to allocate some data
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.drivers[0].CanAllocate(cc, size)
+}
+
+// ChmodFile changes the attributes of the file on all the drivers
+func (driver *Driver) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
+	return driver.replicate(func(d server.ClientHandlingDriver) error {
+		return d.ChmodFile(cc, path, mode)
+	})
+}
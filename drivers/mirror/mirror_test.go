@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func newTestDrivers(t *testing.T, permissions ...string) ([]server.ClientHandlingDriver, string) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	drivers := make([]server.ClientHandlingDriver, len(permissions))
+	for i, perms := range permissions {
+		if drivers[i], err = vusers.NewClientDriver(&vusers.User{
+			Home:        filepath.Join(dir, string(rune('a'+i))),
+			Permissions: perms,
+		}); err != nil {
+			t.Fatal("Couldn't create a driver:", err)
+		}
+	}
+	return drivers, dir
+}
+
+func writeFile(driver *Driver, p, content string) error {
+	file, err := driver.OpenFile(nil, p, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func TestReplication(t *testing.T) {
+	drivers, dir := newTestDrivers(t, "", "")
+	defer os.RemoveAll(dir)
+	driver := New(AllMustSucceed, drivers[0], drivers[1])
+
+	if err := driver.MakeDirectory(nil, "/docs"); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	if err := writeFile(driver, "/docs/file.txt", "content"); err != nil {
+		t.Fatal("Couldn't write the file:", err)
+	}
+	if err := driver.RenameFile(nil, "/docs/file.txt", "/docs/renamed.txt"); err != nil {
+		t.Fatal("Couldn't rename the file:", err)
+	}
+
+	for _, site := range []string{"a", "b"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, site, "docs", "renamed.txt"))
+		if err != nil || string(content) != "content" {
+			t.Fatal("The file should be replicated on", site, ":", string(content), err)
+		}
+	}
+
+	if err := driver.DeleteFile(nil, "/docs/renamed.txt"); err != nil {
+		t.Fatal("Couldn't delete the file:", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b", "docs", "renamed.txt")); !os.IsNotExist(err) {
+		t.Fatal("The deletion should be replicated:", err)
+	}
+}
+
+func TestBestEffort(t *testing.T) {
+	drivers, dir := newTestDrivers(t, "", "lr")
+	defer os.RemoveAll(dir)
+	driver := New(BestEffort, drivers[0], drivers[1])
+
+	var failures []*ReplicaError
+	driver.OnError = func(err *ReplicaError) {
+		failures = append(failures, err)
+	}
+
+	if err := writeFile(driver, "/file.txt", "content"); err != nil {
+		t.Fatal("The failure of the replica shouldn't fail the upload:", err)
+	}
+	if len(failures) != 1 || failures[0].Replica != 1 {
+		t.Fatal("The failure of the replica should be reported:", failures)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "file.txt")); err != nil {
+		t.Fatal("The file should be on the primary driver:", err)
+	}
+}
+
+func TestAllMustSucceed(t *testing.T) {
+	drivers, dir := newTestDrivers(t, "", "lr")
+	defer os.RemoveAll(dir)
+	driver := New(AllMustSucceed, drivers[0], drivers[1])
+
+	err := writeFile(driver, "/file.txt", "content")
+	if replicaErr, ok := err.(*ReplicaError); !ok || replicaErr.Replica != 1 {
+		t.Fatal("The failure of the replica should fail the upload:", err)
+	}
+	if err := driver.MakeDirectory(nil, "/docs"); err == nil {
+		t.Fatal("The failure of the replica should fail the command")
+	}
+}
@@ -0,0 +1,78 @@
+package mirror
+
+import (
+	"io"
+	"os"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// mirrorStream writes a file to several drivers. With the BestEffort consistency, the replicas failing during the
+// transfer are dropped from it.
+type mirrorStream struct {
+	driver   *Driver
+	files    []server.FileStream // Files of the primary driver (first) and of the replicas
+	replicas []int               // Index of the driver of each file
+}
+
+// apply applies an operation to all the files, it returns the error failing the operation
+func (s *mirrorStream) apply(operation func(i int, file server.FileStream) error) error {
+	var failure error
+	files, replicas := make([]server.FileStream, 0, len(s.files)), make([]int, 0, len(s.files))
+	for i, file := range s.files {
+		err := operation(i, file)
+		switch {
+		case err == nil:
+		case i == 0:
+			failure = err
+		case s.driver.consistency == AllMustSucceed:
+			if failure == nil {
+				failure = &ReplicaError{Replica: s.replicas[i], Err: err}
+			}
+		default:
+			s.driver.reportError(&ReplicaError{Replica: s.replicas[i], Err: err})
+			file.Close()
+			continue
+		}
+		files, replicas = append(files, file), append(replicas, s.replicas[i])
+	}
+	s.files, s.replicas = files, replicas
+	return failure
+}
+
+func (s *mirrorStream) Write(p []byte) (int, error) {
+	err := s.apply(func(i int, file server.FileStream) error {
+		n, err := file.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *mirrorStream) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	err := s.apply(func(i int, file server.FileStream) error {
+		p, err := file.Seek(offset, whence)
+		if i == 0 {
+			pos = p
+		}
+		return err
+	})
+	return pos, err
+}
+
+// Read always fails: the file was opened for writing
+func (s *mirrorStream) Read(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (s *mirrorStream) Close() error {
+	return s.apply(func(i int, file server.FileStream) error {
+		return file.Close()
+	})
+}
@@ -0,0 +1,398 @@
+// Package overlay is a driver merging several drivers (the layers) into one view, like a union filesystem. A
+// typical setup is a read-only base directory shared by everyone under a writable per-user layer.
+//
+// A file is read from the first layer containing it. Modifications only happen on the first writable layer (the
+// upper one): the files of the layers below are copied to it before being modified and deleted files of these layers
+// are hidden by whiteout markers (".wh." prefixed empty files) stored in the upper layer. A directory created again
+// after being deleted hides the content it had in the lower layers.
+package overlay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+const (
+	whiteoutPrefix = ".wh."     // Prefix of the markers hiding the files of the lower layers
+	opaqueMarker   = ".wh..opq" // Marker hiding the whole content of a directory in the lower layers
+)
+
+// ErrReadOnly is returned for modifications when no layer is writable
+var ErrReadOnly = errors.New("no writable layer")
+
+// Layer is one of the drivers of the overlay
+type Layer struct {
+	Driver   server.ClientHandlingDriver // Driver of the layer
+	ReadOnly bool                        // The layer is never modified
+}
+
+// Driver merges its layers, the first ones have the priority
+type Driver struct {
+	layers []Layer // Layers, by decreasing priority
+	upper  int     // Index of the writable layer, -1 if there's none
+}
+
+// New creates an overlay of layers, given by decreasing priority
+func New(layers ...Layer) *Driver {
+	driver := &Driver{layers: layers, upper: -1}
+	for i, layer := range layers {
+		if !layer.ReadOnly {
+			driver.upper = i
+			break
+		}
+	}
+	return driver
+}
+
+// writable returns the driver of the upper layer
+func (driver *Driver) writable() (server.ClientHandlingDriver, error) {
+	if driver.upper < 0 {
+		return nil, ErrReadOnly
+	}
+	return driver.layers[driver.upper].Driver, nil
+}
+
+// cleanPath makes the paths comparable
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// whiteoutPath returns the path of the marker hiding a file
+func whiteoutPath(p string) string {
+	dir, name := path.Split(cleanPath(p))
+	return path.Join(dir, whiteoutPrefix+name)
+}
+
+// hidden tells if a file or one of its parents was deleted from the lower layers
+func (driver *Driver) hidden(cc server.ClientContext, p string) bool {
+	for p = cleanPath(p); p != "/"; p = path.Dir(p) {
+		if driver.upperHas(cc, whiteoutPath(p)) || driver.upperHas(cc, path.Join(path.Dir(p), opaqueMarker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the first layer containing a file along with its info. Hidden files only exist if they were
+// created again on the upper layer.
+func (driver *Driver) lookup(cc server.ClientContext, p string) (int, os.FileInfo, error) {
+	hidden := driver.hidden(cc, p)
+	for i, layer := range driver.layers {
+		if hidden && i != driver.upper {
+			continue
+		}
+		if info, err := layer.Driver.GetFileInfo(cc, p); err == nil {
+			return i, info, nil
+		}
+	}
+	return -1, nil, os.ErrNotExist
+}
+
+// exists tells if a file exists in one of the layers
+func (driver *Driver) exists(cc server.ClientContext, p string) bool {
+	_, _, err := driver.lookup(cc, p)
+	return err == nil
+}
+
+// existsBelow tells if a file exists in a layer that isn't the upper one, a whiteout is then required to delete it
+func (driver *Driver) existsBelow(cc server.ClientContext, p string) bool {
+	for i, layer := range driver.layers {
+		if i == driver.upper {
+			continue
+		}
+		if _, err := layer.Driver.GetFileInfo(cc, p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareUpper creates the parent directories of a path on the upper layer and removes its whiteout
+func (driver *Driver) prepareUpper(cc server.ClientContext, upper server.ClientHandlingDriver, p string) error {
+	dir := path.Dir(cleanPath(p))
+	if dir != "/" {
+		if _, err := upper.GetFileInfo(cc, dir); err != nil {
+			if !driver.exists(cc, dir) {
+				return fmt.Errorf("%s: %v", dir, os.ErrNotExist)
+			}
+			if err := driver.prepareUpper(cc, upper, dir); err != nil {
+				return err
+			}
+			if err := upper.MakeDirectory(cc, dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := upper.GetFileInfo(cc, whiteoutPath(p)); err == nil {
+		return upper.DeleteFile(cc, whiteoutPath(p))
+	}
+	return nil
+}
+
+// copyUp copies a file of a lower layer to the upper one before it's modified
+func (driver *Driver) copyUp(cc server.ClientContext, p string) (server.ClientHandlingDriver, error) {
+	upper, err := driver.writable()
+	if err != nil {
+		return nil, err
+	}
+
+	layer, info, err := driver.lookup(cc, p)
+	if err != nil || layer == driver.upper {
+		return upper, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory of a read-only layer", p)
+	}
+
+	if err := driver.prepareUpper(cc, upper, p); err != nil {
+		return nil, err
+	}
+
+	src, err := driver.layers[layer].Driver.OpenFile(cc, p, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dst, err := upper.OpenFile(cc, p, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+
+	// Keeping the mode is nice but not required
+	upper.ChmodFile(cc, p, info.Mode().Perm())
+
+	return upper, nil
+}
+
+// whiteout hides a file of the lower layers
+func (driver *Driver) whiteout(cc server.ClientContext, upper server.ClientHandlingDriver, p string) error {
+	if err := driver.prepareUpper(cc, upper, p); err != nil {
+		return err
+	}
+	marker, err := upper.OpenFile(cc, whiteoutPath(p), os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	return marker.Close()
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	_, info, err := driver.lookup(cc, directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+	return nil
+}
+
+// MakeDirectory creates a directory on the upper layer
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	upper, err := driver.writable()
+	if err != nil {
+		return err
+	}
+	if driver.exists(cc, directory) {
+		return fmt.Errorf("%s: %v", directory, os.ErrExist)
+	}
+
+	// The directory was deleted from the lower layers, their content shouldn't come back
+	deleted := driver.existsBelow(cc, directory)
+
+	if err := driver.prepareUpper(cc, upper, directory); err != nil {
+		return err
+	}
+	if err := upper.MakeDirectory(cc, directory); err != nil {
+		return err
+	}
+
+	if deleted {
+		marker, err := upper.OpenFile(cc, path.Join(cleanPath(directory), opaqueMarker), os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		return marker.Close()
+	}
+	return nil
+}
+
+// ListFiles merges the files of the current directory of all the layers
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	dir := cleanPath(cc.Path())
+	if err := driver.ChangeDirectory(cc, dir); err != nil {
+		return nil, err
+	}
+
+	hidden := driver.hidden(cc, dir) || driver.upperHas(cc, path.Join(dir, opaqueMarker))
+
+	listings := make([][]os.FileInfo, len(driver.layers))
+	for i, layer := range driver.layers {
+		if hidden && i != driver.upper {
+			continue
+		}
+		if info, err := layer.Driver.GetFileInfo(cc, dir); err != nil || !info.IsDir() {
+			continue
+		}
+		files, err := layer.Driver.ListFiles(cc)
+		if err != nil {
+			return nil, err
+		}
+		listings[i] = files
+	}
+
+	whiteouts := make(map[string]bool)
+	if driver.upper >= 0 {
+		for _, file := range listings[driver.upper] {
+			if name := file.Name(); strings.HasPrefix(name, whiteoutPrefix) {
+				whiteouts[strings.TrimPrefix(name, whiteoutPrefix)] = true
+			}
+		}
+	}
+
+	byName := make(map[string]os.FileInfo)
+	for i, files := range listings {
+		for _, file := range files {
+			name := file.Name()
+			if _, ok := byName[name]; ok || strings.HasPrefix(name, whiteoutPrefix) {
+				continue
+			}
+			if whiteouts[name] && i != driver.upper {
+				continue
+			}
+			byName[name] = file
+		}
+	}
+
+	files := make([]os.FileInfo, 0, len(byName))
+	for _, file := range byName {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// upperHas tells if the upper layer has a file
+func (driver *Driver) upperHas(cc server.ClientContext, p string) bool {
+	if driver.upper < 0 {
+		return false
+	}
+	_, err := driver.layers[driver.upper].Driver.GetFileInfo(cc, p)
+	return err == nil
+}
+
+// OpenFile opens a file from the first layer containing it, written files are always opened on the upper layer
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		layer, info, err := driver.lookup(cc, p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", p)
+		}
+		return driver.layers[layer].Driver.OpenFile(cc, p, flag)
+	}
+
+	var upper server.ClientHandlingDriver
+	var err error
+	if flag&os.O_APPEND != 0 {
+		// The content is required to append to it
+		upper, err = driver.copyUp(cc, p)
+		if os.IsNotExist(err) {
+			upper, err = driver.writable()
+		}
+	} else {
+		upper, err = driver.writable()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := driver.prepareUpper(cc, upper, p); err != nil {
+		return nil, err
+	}
+	return upper.OpenFile(cc, p, flag)
+}
+
+// DeleteFile deletes a file from the upper layer and hides it in the other ones
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	upper, err := driver.writable()
+	if err != nil {
+		return err
+	}
+
+	layer, _, err := driver.lookup(cc, p)
+	if err != nil {
+		return err
+	}
+	if layer == driver.upper {
+		if err := upper.DeleteFile(cc, p); err != nil {
+			return err
+		}
+	}
+
+	if driver.existsBelow(cc, p) && !driver.hidden(cc, p) {
+		return driver.whiteout(cc, upper, p)
+	}
+	return nil
+}
+
+// GetFileInfo gets some info around a file or a directory from the first layer containing it
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	_, info, err := driver.lookup(cc, p)
+	return info, err
+}
+
+// RenameFile renames a file on the upper layer (after copying it there if needed) and hides the original one
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	upper, err := driver.copyUp(cc, from)
+	if err != nil {
+		return err
+	}
+	if err := driver.prepareUpper(cc, upper, to); err != nil {
+		return err
+	}
+	if err := upper.RenameFile(cc, from, to); err != nil {
+		return err
+	}
+	if driver.existsBelow(cc, from) && !driver.hidden(cc, from) {
+		return driver.whiteout(cc, upper, from)
+	}
+	return nil
+}
+
+// CanAllocate asks the upper layer
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	upper, err := driver.writable()
+	if err != nil {
+		return false, err
+	}
+	return upper.CanAllocate(cc, size)
+}
+
+// ChmodFile changes the attributes of the file, after copying it to the upper layer
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	upper, err := driver.copyUp(cc, p)
+	if err != nil {
+		return err
+	}
+	return upper.ChmodFile(cc, p, mode)
+}
@@ -0,0 +1,142 @@
+package overlay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// testContext is a client context in a directory
+type testContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *testContext) Path() string {
+	return c.path
+}
+
+func newTestOverlay(t *testing.T) (*Driver, string) {
+	dir, err := ioutil.TempDir("", "overlay")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+
+	base := filepath.Join(dir, "base")
+	os.MkdirAll(filepath.Join(base, "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(base, "docs", "manual.txt"), []byte("manual"), 0644)
+	ioutil.WriteFile(filepath.Join(base, "docs", "notes.txt"), []byte("notes"), 0644)
+
+	baseDriver, err := vusers.NewClientDriver(&vusers.User{Home: base, Permissions: "lr"})
+	if err != nil {
+		t.Fatal("Couldn't create the base layer:", err)
+	}
+	userDriver, err := vusers.NewClientDriver(&vusers.User{Home: filepath.Join(dir, "user")})
+	if err != nil {
+		t.Fatal("Couldn't create the user layer:", err)
+	}
+
+	return New(Layer{Driver: userDriver}, Layer{Driver: baseDriver, ReadOnly: true}), dir
+}
+
+func listNames(t *testing.T, driver *Driver, dir string) []string {
+	files, err := driver.ListFiles(&testContext{path: dir})
+	if err != nil {
+		t.Fatal("Couldn't list", dir, ":", err)
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name()
+	}
+	return names
+}
+
+func readFile(t *testing.T, driver *Driver, p string) string {
+	file, err := driver.OpenFile(nil, p, os.O_RDONLY)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal("Couldn't read", p, ":", err)
+	}
+	return string(content)
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	driver, dir := newTestOverlay(t)
+	defer os.RemoveAll(dir)
+
+	if content := readFile(t, driver, "/docs/manual.txt"); content != "manual" {
+		t.Fatal("Bad content:", content)
+	}
+
+	// Appending copies the file to the user layer first
+	file, err := driver.OpenFile(nil, "/docs/manual.txt", os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		t.Fatal("Couldn't open the file for appending:", err)
+	}
+	file.Write([]byte(" v2"))
+	file.Close()
+
+	if content := readFile(t, driver, "/docs/manual.txt"); content != "manual v2" {
+		t.Fatal("Bad content:", content)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "base", "docs", "manual.txt")); string(content) != "manual" {
+		t.Fatal("The base layer shouldn't have been modified:", string(content))
+	}
+}
+
+func TestDeleteAndRename(t *testing.T) {
+	driver, dir := newTestOverlay(t)
+	defer os.RemoveAll(dir)
+
+	if err := driver.DeleteFile(nil, "/docs/notes.txt"); err != nil {
+		t.Fatal("Couldn't delete:", err)
+	}
+	if _, err := driver.GetFileInfo(nil, "/docs/notes.txt"); !os.IsNotExist(err) {
+		t.Fatal("The file should be hidden:", err)
+	}
+
+	if err := driver.RenameFile(nil, "/docs/manual.txt", "/docs/guide.txt"); err != nil {
+		t.Fatal("Couldn't rename:", err)
+	}
+	if names := listNames(t, driver, "/docs"); len(names) != 1 || names[0] != "guide.txt" {
+		t.Fatal("Bad files:", names)
+	}
+
+	// A file created again is visible
+	file, err := driver.OpenFile(nil, "/docs/notes.txt", os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't create the file:", err)
+	}
+	file.Write([]byte("new notes"))
+	file.Close()
+	if content := readFile(t, driver, "/docs/notes.txt"); content != "new notes" {
+		t.Fatal("Bad content:", content)
+	}
+}
+
+func TestDirectoryRecreated(t *testing.T) {
+	driver, dir := newTestOverlay(t)
+	defer os.RemoveAll(dir)
+
+	if err := driver.DeleteFile(nil, "/docs"); err != nil {
+		t.Fatal("Couldn't delete the directory:", err)
+	}
+	if names := listNames(t, driver, "/"); len(names) != 0 {
+		t.Fatal("The directory should be hidden:", names)
+	}
+
+	if err := driver.MakeDirectory(nil, "/docs"); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	if names := listNames(t, driver, "/docs"); len(names) != 0 {
+		t.Fatal("The content of the base layer shouldn't come back:", names)
+	}
+}
@@ -0,0 +1,212 @@
+// Package retry is a driver wrapper retrying the calls failing with a transient error of the backend (like the 503 of
+// an object store), after an exponential backoff, so that they don't surface to the clients as 550 replies.
+//
+// The calls are retried by class, each with its own policy. The reads and the writes are idempotent, while the
+// creations, deletions and renames aren't: an attempt reported as failed might have been done, so their retries are
+// reconciled with what the previous attempts did (a directory already there was created, a file already gone was
+// deleted, a source gone with its target there was renamed).
+package retry
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Class is a class of calls of the driver sharing a retry policy
+type Class int
+
+const (
+	// Read are the calls reading the storage: ChangeDirectory, ListFiles, GetFileInfo, CanAllocate and the OpenFile of
+	// the downloads
+	Read Class = iota
+	// Write are the calls writing the storage idempotently: the OpenFile of the uploads and ChmodFile
+	Write
+	// Namespace are the calls changing the tree, which aren't idempotent: MakeDirectory, DeleteFile and RenameFile
+	Namespace
+)
+
+// Policy is the retry policy of a class of calls
+type Policy struct {
+	Attempts   int           // Max attempts of a call, it isn't retried if < 2
+	Backoff    time.Duration // Delay before the first retry, doubled before each next one
+	MaxBackoff time.Duration // Max delay between two attempts (unbounded if 0)
+}
+
+// Options are the options of the retries
+type Options struct {
+	Policies  map[Class]Policy                               // Policies of the classes, the calls of the missing ones aren't retried
+	Transient func(err error) bool                           // Tells if an error is worth retrying, IsTransient if nil
+	OnRetry   func(operation string, attempt int, err error) // Called before each retry, for the logs (optional)
+}
+
+// temporary is implemented by the network errors that can be retried
+type temporary interface {
+	Temporary() bool
+}
+
+// timeout is implemented by the network errors of the calls that took too long
+type timeout interface {
+	Timeout() bool
+}
+
+// IsTransient tells if an error is a transient failure of the backend: server.ErrFileUnavailable, or a temporary or
+// timed out network error
+func IsTransient(err error) bool {
+	if errors.Is(err, server.ErrFileUnavailable) {
+		return true
+	}
+	var t temporary
+	if errors.As(err, &t) && t.Temporary() {
+		return true
+	}
+	var to timeout
+	return errors.As(err, &to) && to.Timeout()
+}
+
+// Driver retries the failed calls of another driver
+type Driver struct {
+	inner     server.ClientHandlingDriver                    // Wrapped driver
+	policies  map[Class]Policy                               // Policies by class
+	transient func(err error) bool                           // Errors worth retrying
+	onRetry   func(operation string, attempt int, err error) // Called before each retry (optional)
+	sleep     func(time.Duration)                            // Waits between the attempts, replaced in tests
+}
+
+// New wraps a driver
+func New(inner server.ClientHandlingDriver, options *Options) *Driver {
+	driver := &Driver{inner: inner, transient: IsTransient, sleep: time.Sleep}
+	if options != nil {
+		driver.policies = options.Policies
+		if options.Transient != nil {
+			driver.transient = options.Transient
+		}
+		driver.onRetry = options.OnRetry
+	}
+	return driver
+}
+
+// do calls fn until it succeeds, fails with an error that isn't transient, or the attempts of the class are over. The
+// attempts after the first one get the error of the previous one, for the reconciliation of the calls that aren't
+// idempotent.
+func (driver *Driver) do(class Class, operation string, fn func(previous error) error) error {
+	policy := driver.policies[class]
+	delay := policy.Backoff
+	err := fn(nil)
+	for attempt := 2; attempt <= policy.Attempts && err != nil && driver.transient(err); attempt++ {
+		if driver.onRetry != nil {
+			driver.onRetry(operation, attempt, err)
+		}
+		driver.sleep(delay)
+		if delay *= 2; policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+		err = fn(err)
+	}
+	return err
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.do(Read, "ChangeDirectory", func(error) error {
+		return driver.inner.ChangeDirectory(cc, directory)
+	})
+}
+
+// MakeDirectory creates a directory, a retry finding it was created by a previous attempt succeeds
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.do(Namespace, "MakeDirectory", func(previous error) error {
+		err := driver.inner.MakeDirectory(cc, directory)
+		if previous != nil && err != nil && os.IsExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	err := driver.do(Read, "ListFiles", func(error) error {
+		var err error
+		files, err = driver.inner.ListFiles(cc)
+		return err
+	})
+	return files, err
+}
+
+// OpenFile opens a file, the downloads are retried as reads and the uploads as writes. Only the opening is retried,
+// the reads and writes of the stream aren't.
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	class := Read
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		class = Write
+	}
+	var file server.FileStream
+	err := driver.do(class, "OpenFile", func(error) error {
+		var err error
+		file, err = driver.inner.OpenFile(cc, p, flag)
+		return err
+	})
+	return file, err
+}
+
+// DeleteFile deletes a file or a directory, a retry finding it was deleted by a previous attempt succeeds
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	return driver.do(Namespace, "DeleteFile", func(previous error) error {
+		err := driver.inner.DeleteFile(cc, p)
+		if previous != nil && err != nil && isNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := driver.do(Read, "GetFileInfo", func(error) error {
+		var err error
+		info, err = driver.inner.GetFileInfo(cc, p)
+		return err
+	})
+	return info, err
+}
+
+// RenameFile renames a file or a directory, a retry finding the source gone and the target there succeeds
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	return driver.do(Namespace, "RenameFile", func(previous error) error {
+		err := driver.inner.RenameFile(cc, from, to)
+		if previous != nil && err != nil && isNotExist(err) {
+			if _, errTo := driver.inner.GetFileInfo(cc, to); errTo == nil {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// CanAllocate gives the approval to allocate some data
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	var ok bool
+	err := driver.do(Read, "CanAllocate", func(error) error {
+		var err error
+		ok, err = driver.inner.CanAllocate(cc, size)
+		return err
+	})
+	return ok, err
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.do(Write, "ChmodFile", func(error) error {
+		return driver.inner.ChmodFile(cc, p, mode)
+	})
+}
+
+// isNotExist tells if an error reports a missing file
+func isNotExist(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, server.ErrNotFound)
+}
@@ -0,0 +1,123 @@
+package retry
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// flakyDriver fails its first calls with an error, the deletions and creations are done even when they fail
+type flakyDriver struct {
+	server.ClientHandlingDriver
+	failures int   // Calls still failing
+	err      error // Error of the failing calls
+	calls    int
+	deleted  bool
+}
+
+func (d *flakyDriver) fail() error {
+	d.calls++
+	if d.failures > 0 {
+		d.failures--
+		return d.err
+	}
+	return nil
+}
+
+func (d *flakyDriver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (d *flakyDriver) DeleteFile(cc server.ClientContext, p string) error {
+	if d.deleted {
+		d.calls++
+		return os.ErrNotExist
+	}
+	d.deleted = true
+	return d.fail()
+}
+
+func (d *flakyDriver) MakeDirectory(cc server.ClientContext, p string) error {
+	return d.fail()
+}
+
+func newTestDriver(inner *flakyDriver, policies map[Class]Policy) (*Driver, *[]time.Duration) {
+	var delays []time.Duration
+	driver := New(inner, &Options{Policies: policies})
+	driver.sleep = func(delay time.Duration) { delays = append(delays, delay) }
+	return driver, &delays
+}
+
+func TestRetryReads(t *testing.T) {
+	inner := &flakyDriver{failures: 3, err: server.ErrFileUnavailable}
+	driver, delays := newTestDriver(inner, map[Class]Policy{
+		Read: {Attempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond},
+	})
+
+	if _, err := driver.GetFileInfo(nil, "/file"); err != nil || inner.calls != 4 {
+		t.Fatal("The call should succeed on the 4th attempt:", inner.calls, err)
+	}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	if len(*delays) != len(expected) {
+		t.Fatal("Wrong delays:", *delays)
+	}
+	for i, delay := range *delays {
+		if delay != expected[i] {
+			t.Fatal("Wrong delays:", *delays)
+		}
+	}
+
+	inner.failures, inner.calls = 10, 0
+	if _, err := driver.GetFileInfo(nil, "/file"); err != server.ErrFileUnavailable || inner.calls != 5 {
+		t.Fatal("The call should fail after 5 attempts:", inner.calls, err)
+	}
+}
+
+func TestRetryErrors(t *testing.T) {
+	inner := &flakyDriver{failures: 1, err: server.ErrPermissionDenied}
+	driver, _ := newTestDriver(inner, map[Class]Policy{Read: {Attempts: 3}})
+	if _, err := driver.GetFileInfo(nil, "/file"); err != server.ErrPermissionDenied || inner.calls != 1 {
+		t.Fatal("The errors that aren't transient shouldn't be retried:", inner.calls, err)
+	}
+
+	inner = &flakyDriver{failures: 1, err: server.ErrFileUnavailable}
+	driver, _ = newTestDriver(inner, map[Class]Policy{Read: {Attempts: 3}})
+	if err := driver.MakeDirectory(nil, "/dir"); err != server.ErrFileUnavailable || inner.calls != 1 {
+		t.Fatal("The classes without a policy shouldn't be retried:", inner.calls, err)
+	}
+}
+
+func TestRetryNamespace(t *testing.T) {
+	// The first deletion is done but reported as failed, the retry doesn't find the file anymore
+	inner := &flakyDriver{failures: 1, err: server.ErrFileUnavailable}
+	driver, _ := newTestDriver(inner, map[Class]Policy{Namespace: {Attempts: 3}})
+	if err := driver.DeleteFile(nil, "/file"); err != nil || inner.calls != 2 {
+		t.Fatal("The deletion done by the first attempt should succeed:", inner.calls, err)
+	}
+
+	// Without a previous failure, the missing file is an error
+	inner.calls = 0
+	if err := driver.DeleteFile(nil, "/file"); !os.IsNotExist(err) || inner.calls != 1 {
+		t.Fatal("The deletion of a missing file should fail:", inner.calls, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for err, transient := range map[error]bool{
+		server.ErrFileUnavailable:                  true,
+		os.ErrDeadlineExceeded:                     true,
+		server.ErrNotFound:                         false,
+		errors.New("bad request"):                  false,
+		&os.PathError{Err: os.ErrDeadlineExceeded}: true,
+	} {
+		if IsTransient(err) != transient {
+			t.Fatal("Wrong transience of", err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package router serves several tenants under one server, each with its own MainDriver (tenant A on an object store,
+// tenant B on a local disk...): the listeners, the settings and the metrics are shared, the authentication and the
+// files are handled by the driver of the tenant.
+//
+// The tenant of a session comes from the virtual host the client selected with HOST (RFC 7151), or else from the
+// name it logs in with, "user@tenant" being authenticated as "user" by the driver of the tenant. The sessions without
+// a known tenant go to the default driver, if there's one.
+package router
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// tenantKey is the session value storing the tenant of the session
+const tenantKey = "router.tenant"
+
+// ErrUnknownTenant is returned when the tenant of a session has no driver
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Router is a MainDriver routing each session to the driver of its tenant. Only the methods of server.MainDriver
+// and server.ChallengeAuthenticator are routed, the welcome message and the TLS config are the ones of the router.
+type Router struct {
+	Settings  *server.Settings             // Server settings
+	Welcome   string                       // Welcome message
+	TLSConfig *tls.Config                  // TLS config, AUTH TLS is refused if it's not defined
+	Tenants   map[string]server.MainDriver // Drivers of the tenants, by name
+	Hosts     map[string]string            // Tenants of the virtual hosts (lower case), a host not there is a tenant name
+	Default   server.MainDriver            // Driver of the sessions without a known tenant (optional)
+}
+
+// GetSettings returns the server settings
+func (r *Router) GetSettings() *server.Settings {
+	if r.Settings == nil {
+		return &server.Settings{}
+	}
+	return r.Settings
+}
+
+// WelcomeUser returns the welcome message
+func (r *Router) WelcomeUser(cc server.ClientContext) (string, error) {
+	if r.Welcome == "" {
+		return "Welcome on ftpserver", nil
+	}
+	return r.Welcome, nil
+}
+
+// SelectHost refuses the virtual hosts without a tenant, unless there's a default driver
+func (r *Router) SelectHost(cc server.ClientContext, host string) error {
+	if _, ok := r.Tenants[r.hostTenant(host)]; !ok && r.Default == nil {
+		return ErrUnknownTenant
+	}
+	return nil
+}
+
+// hostTenant returns the tenant of a virtual host
+func (r *Router) hostTenant(host string) string {
+	if tenant, ok := r.Hosts[host]; ok {
+		return tenant
+	}
+	return host
+}
+
+// route returns the tenant of a session and the driver it's routed to, with the user name to authenticate
+func (r *Router) route(cc server.ClientContext, user string) (string, server.MainDriver, string) {
+	if host := cc.Host(); host != "" {
+		tenant := r.hostTenant(host)
+		if driver, ok := r.Tenants[tenant]; ok {
+			return tenant, driver, user
+		}
+	} else if i := strings.LastIndexByte(user, '@'); i >= 0 {
+		if driver, ok := r.Tenants[user[i+1:]]; ok {
+			return user[i+1:], driver, user[:i]
+		}
+	}
+	return "", r.Default, user
+}
+
+// AuthUser authenticates the user with the driver of its tenant
+func (r *Router) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	tenant, driver, user := r.route(cc, user)
+	if driver == nil {
+		return nil, ErrUnknownTenant
+	}
+	r.enter(cc, tenant, driver)
+	return driver.AuthUser(cc, user, pass)
+}
+
+// AuthChallengeResponse completes the login with the driver of the tenant, if it supports the challenges
+func (r *Router) AuthChallengeResponse(cc server.ClientContext, user, response string) (server.ClientHandlingDriver,
+	error) {
+	tenant, driver, user := r.route(cc, user)
+	authenticator, ok := driver.(server.ChallengeAuthenticator)
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	r.enter(cc, tenant, driver)
+	return authenticator.AuthChallengeResponse(cc, user, response)
+}
+
+// enter routes a session to a tenant, the previous driver of the session is told that the user left if it changes
+func (r *Router) enter(cc server.ClientContext, tenant string, driver server.MainDriver) {
+	if previous := r.driver(cc); previous != nil && previous != driver {
+		previous.UserLeft(cc)
+	}
+	cc.SetValue(tenantKey, tenant)
+}
+
+// driver returns the driver a session was routed to, nil if it wasn't routed yet
+func (r *Router) driver(cc server.ClientContext) server.MainDriver {
+	tenant, ok := cc.GetValue(tenantKey).(string)
+	if !ok {
+		return nil
+	}
+	if tenant == "" {
+		return r.Default
+	}
+	return r.Tenants[tenant]
+}
+
+// UserLeft tells the driver of the tenant that the user left
+func (r *Router) UserLeft(cc server.ClientContext) {
+	if driver := r.driver(cc); driver != nil {
+		driver.UserLeft(cc)
+	}
+}
+
+// GetTLSConfig returns the TLS config
+func (r *Router) GetTLSConfig() (*tls.Config, error) {
+	if r.TLSConfig == nil {
+		return nil, errors.New("TLS isn't configured")
+	}
+	return r.TLSConfig, nil
+}
+
+// Tenant returns the tenant a session was routed to, empty for the default driver or before the authentication. It
+// can label the metrics or the logs of the sessions.
+func Tenant(cc server.ClientContext) string {
+	tenant, _ := cc.GetValue(tenantKey).(string)
+	return tenant
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivertest"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// tenantDriver records the users it authenticates and the ones who left
+type tenantDriver struct {
+	server.MainDriver
+	users []string
+	left  int
+}
+
+func (d *tenantDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	d.users = append(d.users, user)
+	return nil, nil
+}
+
+func (d *tenantDriver) UserLeft(cc server.ClientContext) {
+	d.left++
+}
+
+func TestRouting(t *testing.T) {
+	a, b, fallback := &tenantDriver{}, &tenantDriver{}, &tenantDriver{}
+	r := &Router{
+		Tenants: map[string]server.MainDriver{"a": a, "b": b},
+		Hosts:   map[string]string{"ftp.a.example.com": "a"},
+		Default: fallback,
+	}
+
+	for _, tc := range []struct {
+		host, user, tenant string
+		driver             *tenantDriver
+		login              string
+	}{
+		{"ftp.a.example.com", "john@b", "a", a, "john@b"},
+		{"b", "john", "b", b, "john"},
+		{"", "john@b", "b", b, "john"},
+		{"", "john@example.com", "", fallback, "john@example.com"},
+		{"unknown.example.com", "john@a", "", fallback, "john@a"},
+	} {
+		cc := drivertest.NewContext(1, tc.user)
+		cc.SetHost(tc.host)
+		if _, err := r.AuthUser(cc, tc.user, "pass"); err != nil {
+			t.Fatal("Couldn't authenticate:", err)
+		}
+		if Tenant(cc) != tc.tenant || tc.driver.users[len(tc.driver.users)-1] != tc.login {
+			t.Fatal("Bad routing:", tc.host, tc.user, Tenant(cc), tc.driver.users)
+		}
+		left := tc.driver.left
+		r.UserLeft(cc)
+		if tc.driver.left != left+1 {
+			t.Fatal("The driver of the tenant should be told that the user left")
+		}
+	}
+}
+
+func TestUnknownTenant(t *testing.T) {
+	a := &tenantDriver{}
+	r := &Router{Tenants: map[string]server.MainDriver{"a": a}}
+	cc := drivertest.NewContext(1, "john@b")
+
+	if err := r.SelectHost(cc, "b"); err != ErrUnknownTenant {
+		t.Fatal("The unknown hosts should be refused:", err)
+	}
+	if err := r.SelectHost(cc, "a"); err != nil {
+		t.Fatal("The host of a tenant should be accepted:", err)
+	}
+	if _, err := r.AuthUser(cc, "john@b", "pass"); err != ErrUnknownTenant {
+		t.Fatal("The users without a tenant should be refused:", err)
+	}
+	r.UserLeft(cc)
+	if a.left != 0 || Tenant(cc) != "" {
+		t.Fatal("The session wasn't routed")
+	}
+
+	// The session leaves its tenant when it authenticates again with another one
+	r.Tenants["b"] = &tenantDriver{}
+	r.AuthUser(cc, "john@a", "pass")
+	r.AuthUser(cc, "john@b", "pass")
+	if a.left != 1 || Tenant(cc) != "b" {
+		t.Fatal("The previous tenant should be told that the user left:", a.left, Tenant(cc))
+	}
+}
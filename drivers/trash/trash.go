@@ -0,0 +1,263 @@
+// Package trash is a driver wrapper moving the deleted files to a trash directory instead of removing them. The trash
+// keeps the tree of the deleted files, their names get the time of their deletion ("report.pdf~20060102T150405Z"),
+// and the clients can restore them by renaming them back. The trash of a session driver is the one of its user.
+//
+// The files are removed for good when they are deleted from the trash, once their retention has expired, or with the
+// SITE EMPTYTRASH command. The directories are removed as usual, there's nothing to keep of an empty directory.
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// DefaultDir is the trash directory when none is given
+const DefaultDir = "/.trash"
+
+// timeFormat is the format of the deletion times appended to the names
+const timeFormat = "20060102T150405Z"
+
+// purgeInterval is the min time between two purges of the expired files
+const purgeInterval = time.Hour
+
+// Options are the options of the trash
+type Options struct {
+	Dir       string        // Trash directory, DefaultDir if empty
+	Retention time.Duration // Time the deleted files are kept, forever if 0
+}
+
+// Driver moves the files deleted on another driver to a trash directory
+type Driver struct {
+	inner     server.ClientHandlingDriver // Wrapped driver
+	dir       string                      // Trash directory
+	retention time.Duration               // Time the deleted files are kept
+	mutex     sync.Mutex                  // Protects lastPurge
+	lastPurge time.Time                   // Time of the last purge
+}
+
+// New wraps a driver
+func New(inner server.ClientHandlingDriver, options *Options) *Driver {
+	driver := &Driver{inner: inner, dir: DefaultDir}
+	if options != nil {
+		if options.Dir != "" {
+			driver.dir = path.Clean("/" + options.Dir)
+		}
+		driver.retention = options.Retention
+	}
+	return driver
+}
+
+// inTrash tells if a path is the trash directory or one of its files
+func (driver *Driver) inTrash(p string) bool {
+	return p == driver.dir || strings.HasPrefix(p, driver.dir+"/")
+}
+
+// dirContext is a client context in another directory, to list it
+type dirContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *dirContext) Path() string {
+	return c.path
+}
+
+// deletedAt returns the deletion time of a file of the trash, its modification time if its name doesn't have one
+func deletedAt(info os.FileInfo) time.Time {
+	name := info.Name()
+	if i := strings.LastIndexByte(name, '~'); i >= 0 && len(name)-i > len(timeFormat) {
+		if deleted, err := time.Parse(timeFormat, name[i+1:i+1+len(timeFormat)]); err == nil {
+			return deleted
+		}
+	}
+	return info.ModTime()
+}
+
+// makeDirs creates a directory of the trash and its missing parents
+func (driver *Driver) makeDirs(cc server.ClientContext, dir string) error {
+	if _, err := driver.inner.GetFileInfo(cc, dir); err == nil {
+		return nil
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := driver.makeDirs(cc, parent); err != nil {
+			return err
+		}
+	}
+	return driver.inner.MakeDirectory(cc, dir)
+}
+
+// trashPath returns a free path of the trash for a file deleted now
+func (driver *Driver) trashPath(cc server.ClientContext, p string) string {
+	target := path.Join(driver.dir, p) + "~" + time.Now().UTC().Format(timeFormat)
+	for i, free := 2, target; ; i++ {
+		if _, err := driver.inner.GetFileInfo(cc, free); err != nil {
+			return free
+		}
+		free = fmt.Sprintf("%s-%d", target, i)
+	}
+}
+
+// removeFiles removes the files of a directory of the trash matching a condition, and the directories it empties. It
+// returns the number of removed files, and if the directory is now empty.
+func (driver *Driver) removeFiles(cc server.ClientContext, dir string, match func(os.FileInfo) bool) (int, bool, error) {
+	files, err := driver.inner.ListFiles(&dirContext{ClientContext: cc, path: dir})
+	if err != nil {
+		return 0, false, err
+	}
+	removed, kept := 0, 0
+	for _, file := range files {
+		p := path.Join(dir, file.Name())
+		if file.IsDir() {
+			n, empty, err := driver.removeFiles(cc, p, match)
+			removed += n
+			if err != nil {
+				return removed, false, err
+			}
+			if !empty {
+				kept++
+			} else if err = driver.inner.DeleteFile(cc, p); err != nil {
+				return removed, false, err
+			}
+			continue
+		}
+		if !match(file) {
+			kept++
+			continue
+		}
+		if err = driver.inner.DeleteFile(cc, p); err != nil {
+			return removed, false, err
+		}
+		removed++
+	}
+	return removed, kept == 0, nil
+}
+
+// Purge removes the files whose retention has expired, it returns the number of removed files
+func (driver *Driver) Purge(cc server.ClientContext) (int, error) {
+	if driver.retention <= 0 {
+		return 0, nil
+	}
+	if _, err := driver.inner.GetFileInfo(cc, driver.dir); err != nil {
+		return 0, nil
+	}
+	expiry := time.Now().Add(-driver.retention)
+	removed, _, err := driver.removeFiles(cc, driver.dir, func(info os.FileInfo) bool {
+		return deletedAt(info).Before(expiry)
+	})
+	return removed, err
+}
+
+// Empty removes all the files of the trash, it returns the number of removed files
+func (driver *Driver) Empty(cc server.ClientContext) (int, error) {
+	if _, err := driver.inner.GetFileInfo(cc, driver.dir); err != nil {
+		return 0, nil
+	}
+	removed, _, err := driver.removeFiles(cc, driver.dir, func(os.FileInfo) bool { return true })
+	return removed, err
+}
+
+// purgeExpired purges the expired files, at most once per purgeInterval. Its failures don't prevent the deletions.
+func (driver *Driver) purgeExpired(cc server.ClientContext) {
+	driver.mutex.Lock()
+	if time.Since(driver.lastPurge) < purgeInterval {
+		driver.mutex.Unlock()
+		return
+	}
+	driver.lastPurge = time.Now()
+	driver.mutex.Unlock()
+	driver.Purge(cc) // The next purge will try again if it fails
+}
+
+// SiteCommand executes SITE EMPTYTRASH, the other subcommands are passed to the wrapped driver
+func (driver *Driver) SiteCommand(cc server.ClientContext, command, param string) (string, error) {
+	if command != "EMPTYTRASH" {
+		if handler, ok := driver.inner.(server.SiteCommandHandler); ok {
+			return handler.SiteCommand(cc, command, param)
+		}
+		return "", server.ErrUnknownSiteCommand
+	}
+	removed, err := driver.Empty(cc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Removed %d files from the trash", removed), nil
+}
+
+// SiteCommands returns SITE EMPTYTRASH and the subcommands of the wrapped driver
+func (driver *Driver) SiteCommands(cc server.ClientContext) map[string]string {
+	commands := map[string]string{"EMPTYTRASH": ""}
+	if handler, ok := driver.inner.(server.SiteCommandHandler); ok {
+		for command, syntax := range handler.SiteCommands(cc) {
+			commands[command] = syntax
+		}
+	}
+	return commands
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.ChangeDirectory(cc, directory)
+}
+
+// MakeDirectory creates a directory
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.MakeDirectory(cc, directory)
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	return driver.inner.ListFiles(cc)
+}
+
+// OpenFile opens a file
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	return driver.inner.OpenFile(cc, p, flag)
+}
+
+// DeleteFile moves a file to the trash, the directories and the files of the trash are removed
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	p = path.Clean("/" + p)
+	if driver.inTrash(p) {
+		return driver.inner.DeleteFile(cc, p)
+	}
+	info, err := driver.inner.GetFileInfo(cc, p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return driver.inner.DeleteFile(cc, p)
+	}
+
+	driver.purgeExpired(cc)
+	target := driver.trashPath(cc, p)
+	if err = driver.makeDirs(cc, path.Dir(target)); err != nil {
+		return err
+	}
+	return driver.inner.RenameFile(cc, p, target)
+}
+
+// GetFileInfo gets the info of a file
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	return driver.inner.GetFileInfo(cc, p)
+}
+
+// RenameFile renames a file, the files of the trash are restored this way
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	return driver.inner.RenameFile(cc, from, to)
+}
+
+// CanAllocate checks that a file can be stored
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.inner.CanAllocate(cc, size)
+}
+
+// ChmodFile changes the mode of a file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.inner.ChmodFile(cc, p, mode)
+}
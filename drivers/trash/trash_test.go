@@ -0,0 +1,149 @@
+package trash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/drivertest"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func newTestDriver(t *testing.T, options *Options) (*Driver, string) {
+	dir, err := ioutil.TempDir("", "trash")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	inner, err := vusers.NewClientDriver(&vusers.User{Home: dir})
+	if err != nil {
+		t.Fatal("Couldn't create the inner driver:", err)
+	}
+	return New(inner, options), dir
+}
+
+func writeFile(t *testing.T, dir, name string) {
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+		t.Fatal("Couldn't create the directory of", name, ":", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+		t.Fatal("Couldn't write", name, ":", err)
+	}
+}
+
+// trashFiles returns the files of the trash, relative to it
+func trashFiles(t *testing.T, dir string) []string {
+	var files []string
+	root := filepath.Join(dir, ".trash")
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(root, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files
+}
+
+func TestDeleteToTrash(t *testing.T) {
+	driver, dir := newTestDriver(t, nil)
+	defer os.RemoveAll(dir)
+	cc := drivertest.NewContext(1, "john")
+	writeFile(t, dir, "docs/report.pdf")
+
+	if err := driver.DeleteFile(cc, "/docs/report.pdf"); err != nil {
+		t.Fatal("Couldn't delete the file:", err)
+	}
+	if err := driver.DeleteFile(cc, "/docs/missing"); err == nil {
+		t.Fatal("A missing file can't be deleted")
+	}
+	files := trashFiles(t, dir)
+	if len(files) != 1 || !strings.HasPrefix(files[0], "docs/report.pdf~") {
+		t.Fatal("The file should be moved to the trash:", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "report.pdf")); !os.IsNotExist(err) {
+		t.Fatal("The file should be gone:", err)
+	}
+
+	// The same file deleted twice in the same second doesn't overwrite the first one
+	writeFile(t, dir, "docs/report.pdf")
+	if err := driver.DeleteFile(cc, "/docs/report.pdf"); err != nil {
+		t.Fatal("Couldn't delete the file again:", err)
+	}
+	if files = trashFiles(t, dir); len(files) != 2 {
+		t.Fatal("Both versions should be in the trash:", files)
+	}
+
+	// The files are restored by renaming them back
+	if err := driver.RenameFile(cc, "/.trash/"+files[0], "/docs/report.pdf"); err != nil {
+		t.Fatal("Couldn't restore the file:", err)
+	}
+
+	// The files deleted from the trash and the directories are removed
+	if err := driver.DeleteFile(cc, "/.trash/"+files[1]); err != nil {
+		t.Fatal("Couldn't delete the file of the trash:", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	if err := driver.DeleteFile(cc, "/empty"); err != nil {
+		t.Fatal("Couldn't delete the directory:", err)
+	}
+	if files = trashFiles(t, dir); len(files) != 0 {
+		t.Fatal("Nothing should be left in the trash:", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "empty")); !os.IsNotExist(err) {
+		t.Fatal("The directory should be removed:", err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	driver, dir := newTestDriver(t, &Options{Retention: 24 * time.Hour})
+	defer os.RemoveAll(dir)
+	cc := drivertest.NewContext(1, "john")
+
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(timeFormat)
+	writeFile(t, dir, ".trash/a/old.txt~"+old)
+	writeFile(t, dir, ".trash/recent.txt~"+time.Now().UTC().Format(timeFormat))
+	writeFile(t, dir, "file.txt")
+
+	// The expired files are purged by the deletions
+	if err := driver.DeleteFile(cc, "/file.txt"); err != nil {
+		t.Fatal("Couldn't delete the file:", err)
+	}
+	if files := trashFiles(t, dir); len(files) != 2 || strings.HasPrefix(files[0], "a/") {
+		t.Fatal("Only the expired files should be purged:", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".trash", "a")); !os.IsNotExist(err) {
+		t.Fatal("The emptied directories should be removed:", err)
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	driver, dir := newTestDriver(t, nil)
+	defer os.RemoveAll(dir)
+	cc := drivertest.NewContext(1, "john")
+
+	if message, err := driver.SiteCommand(cc, "EMPTYTRASH", ""); err != nil || message != "Removed 0 files from the trash" {
+		t.Fatal("An empty trash should be emptied:", message, err)
+	}
+	writeFile(t, dir, "a.txt")
+	writeFile(t, dir, "b/c.txt")
+	for _, p := range []string{"/a.txt", "/b/c.txt"} {
+		if err := driver.DeleteFile(cc, p); err != nil {
+			t.Fatal("Couldn't delete", p, ":", err)
+		}
+	}
+	if message, err := driver.SiteCommand(cc, "EMPTYTRASH", ""); err != nil || message != "Removed 2 files from the trash" {
+		t.Fatal("The trash should be emptied:", message, err)
+	}
+	if files := trashFiles(t, dir); len(files) != 0 {
+		t.Fatal("Nothing should be left in the trash:", files)
+	}
+	if _, err := driver.SiteCommand(cc, "OTHER", ""); err != server.ErrUnknownSiteCommand {
+		t.Fatal("The other subcommands should be unknown:", err)
+	}
+}
@@ -0,0 +1,382 @@
+// Package versions is a driver wrapper keeping the previous versions of the files when they're overwritten, replaced
+// by a rename or deleted. The versions are stored in a versions directory keeping the tree of the files, their names
+// get the time they were replaced at ("report.pdf~20060102T150405Z").
+//
+// The clients list the versions of a file with SITE VERSIONS <path> and recover one with SITE RESTORE <path>
+// [<version>], the latest one by default. The content replaced by a restoration becomes a version too.
+package versions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// DefaultDir is the versions directory when none is given
+const DefaultDir = "/.versions"
+
+// DefaultKeep is the number of versions kept per file when none is given
+const DefaultKeep = 5
+
+// timeFormat is the format of the times appended to the names of the versions
+const timeFormat = "20060102T150405Z"
+
+// ErrNoVersion is returned when a file has no version to restore
+var ErrNoVersion = errors.New("no such version")
+
+// Options are the options of the versioning
+type Options struct {
+	Dir  string // Versions directory, DefaultDir if empty
+	Keep int    // Number of versions kept per file, DefaultKeep if 0
+}
+
+// Driver keeps the previous versions of the files of another driver
+type Driver struct {
+	inner server.ClientHandlingDriver // Wrapped driver
+	dir   string                      // Versions directory
+	keep  int                         // Number of versions kept per file
+}
+
+// New wraps a driver
+func New(inner server.ClientHandlingDriver, options *Options) *Driver {
+	driver := &Driver{inner: inner, dir: DefaultDir, keep: DefaultKeep}
+	if options != nil {
+		if options.Dir != "" {
+			driver.dir = path.Clean("/" + options.Dir)
+		}
+		if options.Keep > 0 {
+			driver.keep = options.Keep
+		}
+	}
+	return driver
+}
+
+// Version is a previous version of a file
+type Version struct {
+	ID       string    // Identifier of the version, the suffix of its name
+	Path     string    // Path of the version in the versions directory
+	Replaced time.Time // Time the version was replaced at
+	Size     int64     // Size of the version
+}
+
+// inVersions tells if a path is the versions directory or one of its files
+func (driver *Driver) inVersions(p string) bool {
+	return p == driver.dir || strings.HasPrefix(p, driver.dir+"/")
+}
+
+// dirContext is a client context in another directory, to list it
+type dirContext struct {
+	server.ClientContext
+	path string
+}
+
+func (c *dirContext) Path() string {
+	return c.path
+}
+
+// versionID returns the identifier of a version of a file from its name, an empty string if it isn't one
+func versionID(name, base string) string {
+	if !strings.HasPrefix(name, base+"~") {
+		return ""
+	}
+	id := name[len(base)+1:]
+	if len(id) < len(timeFormat) {
+		return ""
+	}
+	if _, err := time.Parse(timeFormat, id[:len(timeFormat)]); err != nil {
+		return ""
+	}
+	if suffix := id[len(timeFormat):]; suffix != "" && !strings.HasPrefix(suffix, "-") {
+		return ""
+	}
+	return id
+}
+
+// versionCounter returns the counter of the versions replaced in the same second ("-2" suffix of the identifier)
+func versionCounter(id string) int {
+	counter, _ := strconv.Atoi(strings.TrimPrefix(id[len(timeFormat):], "-"))
+	return counter
+}
+
+// Versions returns the versions of a file, the oldest first
+func (driver *Driver) Versions(cc server.ClientContext, p string) ([]*Version, error) {
+	p = path.Clean("/" + p)
+	dir := path.Join(driver.dir, path.Dir(p))
+	if _, err := driver.inner.GetFileInfo(cc, dir); err != nil {
+		return nil, nil
+	}
+	files, err := driver.inner.ListFiles(&dirContext{ClientContext: cc, path: dir})
+	if err != nil {
+		return nil, err
+	}
+	var versions []*Version
+	for _, file := range files {
+		id := versionID(file.Name(), path.Base(p))
+		if id == "" || file.IsDir() {
+			continue
+		}
+		replaced, _ := time.Parse(timeFormat, id[:len(timeFormat)])
+		versions = append(versions, &Version{
+			ID:       id,
+			Path:     path.Join(dir, file.Name()),
+			Replaced: replaced,
+			Size:     file.Size(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].Replaced.Equal(versions[j].Replaced) {
+			return versions[i].Replaced.Before(versions[j].Replaced)
+		}
+		return versionCounter(versions[i].ID) < versionCounter(versions[j].ID)
+	})
+	return versions, nil
+}
+
+// makeDirs creates a directory and its missing parents
+func (driver *Driver) makeDirs(cc server.ClientContext, dir string) error {
+	if _, err := driver.inner.GetFileInfo(cc, dir); err == nil {
+		return nil
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := driver.makeDirs(cc, parent); err != nil {
+			return err
+		}
+	}
+	return driver.inner.MakeDirectory(cc, dir)
+}
+
+// versionPath returns a free path in the versions directory for a file replaced now
+func (driver *Driver) versionPath(cc server.ClientContext, p string) string {
+	target := path.Join(driver.dir, p) + "~" + time.Now().UTC().Format(timeFormat)
+	for i, free := 2, target; ; i++ {
+		if _, err := driver.inner.GetFileInfo(cc, free); err != nil {
+			return free
+		}
+		free = fmt.Sprintf("%s-%d", target, i)
+	}
+}
+
+// saveVersion keeps the current content of a file as a version, by moving or copying it. Nothing is done for the
+// missing files and the directories.
+func (driver *Driver) saveVersion(cc server.ClientContext, p string, move bool) error {
+	info, err := driver.inner.GetFileInfo(cc, p)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	target := driver.versionPath(cc, p)
+	if err = driver.makeDirs(cc, path.Dir(target)); err != nil {
+		return err
+	}
+	if move {
+		return driver.inner.RenameFile(cc, p, target)
+	}
+	return driver.copyFile(cc, p, target)
+}
+
+// keepVersion saves a version of a file and removes its oldest ones
+func (driver *Driver) keepVersion(cc server.ClientContext, p string, move bool) error {
+	if err := driver.saveVersion(cc, p, move); err != nil {
+		return err
+	}
+	return driver.prune(cc, p)
+}
+
+// copyFile copies the content of a file
+func (driver *Driver) copyFile(cc server.ClientContext, from, to string) error {
+	src, err := driver.inner.OpenFile(cc, from, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := driver.inner.OpenFile(cc, to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		driver.inner.DeleteFile(cc, to)
+		return err
+	}
+	return dst.Close()
+}
+
+// prune removes the oldest versions of a file beyond the number of kept ones
+func (driver *Driver) prune(cc server.ClientContext, p string) error {
+	versions, err := driver.Versions(cc, p)
+	if err != nil {
+		return err
+	}
+	for len(versions) > driver.keep {
+		if err = driver.inner.DeleteFile(cc, versions[0].Path); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// Restore recovers a version of a file (the latest one if id is empty), the current content becomes a version
+func (driver *Driver) Restore(cc server.ClientContext, p, id string) (*Version, error) {
+	p = path.Clean("/" + p)
+	versions, err := driver.Versions(cc, p)
+	if err != nil {
+		return nil, err
+	}
+	var version *Version
+	for _, v := range versions {
+		if id == "" || v.ID == id {
+			version = v
+		}
+	}
+	if version == nil {
+		return nil, ErrNoVersion
+	}
+	if err = driver.saveVersion(cc, p, true); err != nil {
+		return nil, err
+	}
+	if err = driver.makeDirs(cc, path.Dir(p)); err != nil {
+		return nil, err
+	}
+	if err = driver.inner.RenameFile(cc, version.Path, p); err != nil {
+		return nil, err
+	}
+	return version, driver.prune(cc, p)
+}
+
+// SiteCommand executes SITE VERSIONS and SITE RESTORE, the other subcommands are passed to the wrapped driver
+func (driver *Driver) SiteCommand(cc server.ClientContext, command, param string) (string, error) {
+	switch command {
+	case "VERSIONS":
+		return driver.listVersions(cc, param)
+	case "RESTORE":
+		fields := strings.Fields(param)
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", errors.New("expected a path and an optional version")
+		}
+		id := ""
+		if len(fields) == 2 {
+			id = fields[1]
+		}
+		version, err := driver.Restore(cc, absPath(cc, fields[0]), id)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Restored version %s of %s", version.ID, fields[0]), nil
+	}
+	if handler, ok := driver.inner.(server.SiteCommandHandler); ok {
+		return handler.SiteCommand(cc, command, param)
+	}
+	return "", server.ErrUnknownSiteCommand
+}
+
+// listVersions returns the message of SITE VERSIONS, one line per version
+func (driver *Driver) listVersions(cc server.ClientContext, p string) (string, error) {
+	if p == "" {
+		return "", errors.New("expected a path")
+	}
+	versions, err := driver.Versions(cc, absPath(cc, p))
+	if err != nil {
+		return "", err
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "%d versions of %s", len(versions), p)
+	for _, version := range versions {
+		fmt.Fprintf(&message, "\n %s %d bytes", version.ID, version.Size)
+	}
+	return message.String(), nil
+}
+
+// absPath returns the absolute path of a SITE parameter
+func absPath(cc server.ClientContext, p string) string {
+	if path.IsAbs(p) || cc == nil {
+		return path.Clean("/" + p)
+	}
+	return path.Join(cc.Path(), p)
+}
+
+// SiteCommands returns SITE VERSIONS and SITE RESTORE, and the subcommands of the wrapped driver
+func (driver *Driver) SiteCommands(cc server.ClientContext) map[string]string {
+	commands := map[string]string{"VERSIONS": "<path>", "RESTORE": "<path> [<version>]"}
+	if handler, ok := driver.inner.(server.SiteCommandHandler); ok {
+		for command, syntax := range handler.SiteCommands(cc) {
+			commands[command] = syntax
+		}
+	}
+	return commands
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *Driver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.ChangeDirectory(cc, directory)
+}
+
+// MakeDirectory creates a directory
+func (driver *Driver) MakeDirectory(cc server.ClientContext, directory string) error {
+	return driver.inner.MakeDirectory(cc, directory)
+}
+
+// ListFiles lists the files of the current directory
+func (driver *Driver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	return driver.inner.ListFiles(cc)
+}
+
+// OpenFile opens a file, the content of a file about to be overwritten is kept as a version first
+func (driver *Driver) OpenFile(cc server.ClientContext, p string, flag int) (server.FileStream, error) {
+	p = path.Clean("/" + p)
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 && flag&os.O_APPEND == 0 && !driver.inVersions(p) {
+		if err := driver.keepVersion(cc, p, false); err != nil {
+			return nil, err
+		}
+	}
+	return driver.inner.OpenFile(cc, p, flag)
+}
+
+// DeleteFile moves a file to its versions, the directories and the files of the versions directory are removed
+func (driver *Driver) DeleteFile(cc server.ClientContext, p string) error {
+	p = path.Clean("/" + p)
+	if driver.inVersions(p) {
+		return driver.inner.DeleteFile(cc, p)
+	}
+	info, err := driver.inner.GetFileInfo(cc, p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return driver.inner.DeleteFile(cc, p)
+	}
+	return driver.keepVersion(cc, p, true)
+}
+
+// GetFileInfo gets the info of a file
+func (driver *Driver) GetFileInfo(cc server.ClientContext, p string) (os.FileInfo, error) {
+	return driver.inner.GetFileInfo(cc, p)
+}
+
+// RenameFile renames a file, the file it replaces is kept as a version
+func (driver *Driver) RenameFile(cc server.ClientContext, from, to string) error {
+	to = path.Clean("/" + to)
+	if !driver.inVersions(to) {
+		if err := driver.keepVersion(cc, to, true); err != nil {
+			return err
+		}
+	}
+	return driver.inner.RenameFile(cc, from, to)
+}
+
+// CanAllocate checks that a file can be stored
+func (driver *Driver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	return driver.inner.CanAllocate(cc, size)
+}
+
+// ChmodFile changes the mode of a file
+func (driver *Driver) ChmodFile(cc server.ClientContext, p string, mode os.FileMode) error {
+	return driver.inner.ChmodFile(cc, p, mode)
+}
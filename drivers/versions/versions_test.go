@@ -0,0 +1,135 @@
+package versions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+	"github.com/fclairamb/ftpserver/drivertest"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func newTestDriver(t *testing.T, options *Options) (*Driver, string) {
+	dir, err := ioutil.TempDir("", "versions")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+	inner, err := vusers.NewClientDriver(&vusers.User{Home: dir})
+	if err != nil {
+		t.Fatal("Couldn't create the inner driver:", err)
+	}
+	return New(inner, options), dir
+}
+
+func writeFile(t *testing.T, driver *Driver, p, content string) {
+	file, err := driver.OpenFile(nil, p, os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't open", p, ":", err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatal("Couldn't write", p, ":", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal("Couldn't close", p, ":", err)
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	content, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal("Couldn't read", name, ":", err)
+	}
+	return string(content)
+}
+
+// versionContents returns the contents of the versions of a file, the oldest first
+func versionContents(t *testing.T, driver *Driver, dir, p string) []string {
+	versions, err := driver.Versions(nil, p)
+	if err != nil {
+		t.Fatal("Couldn't list the versions:", err)
+	}
+	contents := make([]string, len(versions))
+	for i, version := range versions {
+		contents[i] = readFile(t, dir, version.Path)
+	}
+	return contents
+}
+
+func TestVersions(t *testing.T) {
+	driver, dir := newTestDriver(t, &Options{Keep: 2})
+	defer os.RemoveAll(dir)
+
+	// Overwritten, replaced by a rename and deleted
+	writeFile(t, driver, "/file.txt", "v1")
+	writeFile(t, driver, "/file.txt", "v2")
+	writeFile(t, driver, "/upload.part", "v3")
+	if err := driver.RenameFile(nil, "/upload.part", "/file.txt"); err != nil {
+		t.Fatal("Couldn't rename:", err)
+	}
+	if contents := versionContents(t, driver, dir, "/file.txt"); strings.Join(contents, ",") != "v1,v2" {
+		t.Fatal("Bad versions:", contents)
+	}
+	if err := driver.DeleteFile(nil, "/file.txt"); err != nil {
+		t.Fatal("Couldn't delete:", err)
+	}
+	if contents := versionContents(t, driver, dir, "/file.txt"); strings.Join(contents, ",") != "v2,v3" {
+		t.Fatal("Only the latest versions should be kept:", contents)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.txt")); !os.IsNotExist(err) {
+		t.Fatal("The file should be deleted:", err)
+	}
+
+	// Restoring the latest version, then an older one
+	if _, err := driver.Restore(nil, "/file.txt", ""); err != nil {
+		t.Fatal("Couldn't restore:", err)
+	}
+	if content := readFile(t, dir, "file.txt"); content != "v3" {
+		t.Fatal("The latest version should be restored:", content)
+	}
+	versions, _ := driver.Versions(nil, "/file.txt")
+	if _, err := driver.Restore(nil, "/file.txt", versions[0].ID); err != nil {
+		t.Fatal("Couldn't restore:", err)
+	}
+	if content := readFile(t, dir, "file.txt"); content != "v2" {
+		t.Fatal("The chosen version should be restored:", content)
+	}
+	if contents := versionContents(t, driver, dir, "/file.txt"); strings.Join(contents, ",") != "v3" {
+		t.Fatal("The replaced content should be a version:", contents)
+	}
+	if _, err := driver.Restore(nil, "/file.txt", "20060102T150405Z"); err != ErrNoVersion {
+		t.Fatal("An unknown version can't be restored:", err)
+	}
+}
+
+func TestSiteCommands(t *testing.T) {
+	driver, dir := newTestDriver(t, nil)
+	defer os.RemoveAll(dir)
+	cc := drivertest.NewContext(1, "john")
+	cc.SetPath("/docs")
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+
+	writeFile(t, driver, "/docs/a.txt", "old")
+	writeFile(t, driver, "/docs/a.txt", "new")
+	message, err := driver.SiteCommand(cc, "VERSIONS", "a.txt")
+	if err != nil || !strings.HasPrefix(message, "1 versions of a.txt\n ") || !strings.HasSuffix(message, " 3 bytes") {
+		t.Fatalf("Bad versions: %q %v", message, err)
+	}
+	if message, err = driver.SiteCommand(cc, "RESTORE", "/docs/a.txt"); err != nil ||
+		!strings.HasPrefix(message, "Restored version ") {
+		t.Fatal("Couldn't restore:", message, err)
+	}
+	if content := readFile(t, dir, "docs/a.txt"); content != "old" {
+		t.Fatal("The version should be restored:", content)
+	}
+	if _, err = driver.SiteCommand(cc, "RESTORE", ""); err == nil {
+		t.Fatal("A path is expected")
+	}
+	if _, err = driver.SiteCommand(cc, "OTHER", ""); err != server.ErrUnknownSiteCommand {
+		t.Fatal("The other subcommands should be unknown:", err)
+	}
+}
@@ -0,0 +1,123 @@
+package vusers
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/config"
+)
+
+// MemoryDatabase is a database of users defined in the code, indexed by name
+type MemoryDatabase map[string]*User
+
+// User returns a user by name
+func (db MemoryDatabase) User(name string) (*User, error) {
+	return db[name], nil
+}
+
+// NewMemoryDatabase creates a database from a list of users
+func NewMemoryDatabase(users []*User) MemoryDatabase {
+	db := make(MemoryDatabase, len(users))
+	for _, user := range users {
+		db[user.Name] = user
+	}
+	return db
+}
+
+// usersFile is the content of a users file
+type usersFile struct {
+	Users []*User `toml:"users"`
+}
+
+// FileDatabase is a database of users stored in a TOML, JSON or YAML file. The file is loaded again when it's
+// modified, so users can be added or disabled without restarting the server.
+type FileDatabase struct {
+	fileName string         // Users file
+	mutex    sync.Mutex     // Users sync
+	users    MemoryDatabase // Users loaded from the file
+	modTime  time.Time      // Modification time of the file when it was loaded
+}
+
+// NewFileDatabase loads a users file
+func NewFileDatabase(fileName string) (*FileDatabase, error) {
+	db := &FileDatabase{fileName: fileName}
+	if err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// reload loads the file again if it was modified
+func (db *FileDatabase) reload() error {
+	info, err := os.Stat(db.fileName)
+	if err != nil {
+		return err
+	}
+	if db.users != nil && info.ModTime().Equal(db.modTime) {
+		return nil
+	}
+
+	content := &usersFile{}
+	if err := config.DecodeFile(db.fileName, content); err != nil {
+		return err
+	}
+
+	for i, user := range content.Users {
+		if user.Name == "" || user.Home == "" {
+			return fmt.Errorf("%s: user %d must have a name and a home", db.fileName, i+1)
+		}
+	}
+
+	db.users = NewMemoryDatabase(content.Users)
+	db.modTime = info.ModTime()
+	return nil
+}
+
+// User returns a user by name, the users of the last valid version of the file are used if it can't be loaded
+func (db *FileDatabase) User(name string) (*User, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// A broken file shouldn't prevent everyone from logging in
+	db.reload()
+
+	return db.users.User(name)
+}
+
+// DefaultSQLQuery is the query used by SQLDatabase if none is specified
+const DefaultSQLQuery = "SELECT password, home, permissions, quota, disabled FROM users WHERE name = ?"
+
+// SQLDatabase is a database of users stored in an SQL table
+type SQLDatabase struct {
+	DB    *sql.DB // Database, opened with any database/sql driver
+	Query string  // Query returning the password, home, permissions, quota and disabled columns of a user
+}
+
+// User returns a user by name
+func (db *SQLDatabase) User(name string) (*User, error) {
+	query := db.Query
+	if query == "" {
+		query = DefaultSQLQuery
+	}
+
+	user := &User{Name: name}
+	var permissions sql.NullString
+	var quota sql.NullInt64
+	var disabled sql.NullBool
+
+	err := db.DB.QueryRow(query, name).Scan(&user.Password, &user.Home, &permissions, &quota, &disabled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.Permissions = permissions.String
+	user.Quota = quota.Int64
+	user.Disabled = disabled.Bool
+	return user, nil
+}
@@ -0,0 +1,297 @@
+package vusers
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// MainDriver authenticates the users of a database and gives them access to their home directory
+type MainDriver struct {
+	Database  Database         // Users database
+	Settings  *server.Settings // Server settings
+	Welcome   string           // Welcome message
+	TLSConfig *tls.Config      // TLS config, AUTH TLS is refused if it's not defined
+}
+
+// GetSettings returns the server settings
+func (driver *MainDriver) GetSettings() *server.Settings {
+	if driver.Settings == nil {
+		return &server.Settings{}
+	}
+	return driver.Settings
+}
+
+// WelcomeUser returns the welcome message
+func (driver *MainDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	if driver.Welcome == "" {
+		return "Welcome on ftpserver", nil
+	}
+	return driver.Welcome, nil
+}
+
+// UserLeft is called when the user disconnects
+func (driver *MainDriver) UserLeft(cc server.ClientContext) {
+}
+
+// AuthUser authenticates the user against the database
+func (driver *MainDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	u, err := Authenticate(driver.Database, user, pass)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientDriver(u)
+}
+
+// GetTLSConfig returns the TLS config
+func (driver *MainDriver) GetTLSConfig() (*tls.Config, error) {
+	if driver.TLSConfig == nil {
+		return nil, errors.New("TLS isn't configured")
+	}
+	return driver.TLSConfig, nil
+}
+
+// ClientDriver gives access to the home directory of a user, within the limits of its permissions and quota
+type ClientDriver struct {
+	user *User // Authenticated user
+}
+
+// NewClientDriver creates the driver of a user session, the home directory is created if it doesn't exist
+func NewClientDriver(user *User) (*ClientDriver, error) {
+	if err := os.MkdirAll(user.Home, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create the home directory: %v", err)
+	}
+	return &ClientDriver{user: user}, nil
+}
+
+// realPath converts an FTP path to a path in the home directory, it can't get out of it
+func (driver *ClientDriver) realPath(p string) string {
+	if filepath.Separator == '\\' {
+		p = strings.Replace(p, "\\", "/", -1)
+	}
+	return filepath.Join(driver.user.Home, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// check returns ErrPermissionDenied if the user doesn't have one of the permissions
+func (driver *ClientDriver) check(perms ...Permission) error {
+	for _, perm := range perms {
+		if driver.user.Can(perm) {
+			return nil
+		}
+	}
+	return ErrPermissionDenied
+}
+
+// ChangeDirectory changes the current working directory
+func (driver *ClientDriver) ChangeDirectory(cc server.ClientContext, directory string) error {
+	if err := driver.check(PermList, PermRead, PermWrite); err != nil {
+		return err
+	}
+	info, err := os.Stat(driver.realPath(directory))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", directory)
+	}
+	return nil
+}
+
+// MakeDirectory creates a directory
+func (driver *ClientDriver) MakeDirectory(cc server.ClientContext, directory string) error {
+	if err := driver.check(PermWrite); err != nil {
+		return err
+	}
+	return os.Mkdir(driver.realPath(directory), 0755)
+}
+
+// ListFiles lists the files of the current directory
+func (driver *ClientDriver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	if err := driver.check(PermList); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(driver.realPath(cc.Path()))
+}
+
+// OpenFile opens a file in 3 possible modes: read, write, appending write
+func (driver *ClientDriver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		if err := driver.check(PermRead); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(driver.realPath(path), flag, 0)
+	}
+
+	if err := driver.check(PermWrite); err != nil {
+		return nil, err
+	}
+
+	flag |= os.O_CREATE
+	if (flag & os.O_APPEND) == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	realPath := driver.realPath(path)
+
+	// The size of the file being replaced doesn't count in the quota
+	var available int64 = -1
+	if driver.user.Quota > 0 {
+		usage, err := driver.usage()
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(realPath); err == nil && (flag&os.O_APPEND) == 0 {
+			usage -= info.Size()
+		}
+		if available = driver.user.Quota - usage; available <= 0 {
+			return nil, server.ErrQuotaExceeded
+		}
+	}
+
+	file, err := os.OpenFile(realPath, flag, 0644)
+	if err != nil || available < 0 {
+		return file, err
+	}
+	return &quotaFile{File: file, available: available}, nil
+}
+
+// DeleteFile deletes a file or a directory
+func (driver *ClientDriver) DeleteFile(cc server.ClientContext, path string) error {
+	if err := driver.check(PermDelete); err != nil {
+		return err
+	}
+	return os.Remove(driver.realPath(path))
+}
+
+// GetFileInfo gets some info around a file or a directory
+func (driver *ClientDriver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+	if err := driver.check(PermList, PermRead); err != nil {
+		return nil, err
+	}
+	return os.Stat(driver.realPath(path))
+}
+
+// RenameFile renames a file or a directory
+func (driver *ClientDriver) RenameFile(cc server.ClientContext, from, to string) error {
+	if err := driver.check(PermWrite); err != nil {
+		return err
+	}
+	return os.Rename(driver.realPath(from), driver.realPath(to))
+}
+
+// CanAllocate checks that the allocated size fits in the quota
+func (driver *ClientDriver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+	if err := driver.check(PermWrite); err != nil {
+		return false, err
+	}
+	if driver.user.Quota > 0 {
+		usage, err := driver.usage()
+		if err != nil {
+			return false, err
+		}
+		return usage+int64(size) <= driver.user.Quota, nil
+	}
+	return true, nil
+}
+
+// ChmodFile changes the attributes of the file
+func (driver *ClientDriver) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
+	if err := driver.check(PermWrite); err != nil {
+		return err
+	}
+	return os.Chmod(driver.realPath(path), mode)
+}
+
+// Chtimes changes the access and modification times of a file
+func (driver *ClientDriver) Chtimes(cc server.ClientContext, path string, atime, mtime time.Time) error {
+	if err := driver.check(PermWrite); err != nil {
+		return err
+	}
+	return os.Chtimes(driver.realPath(path), atime, mtime)
+}
+
+// PreTransfer refuses the uploads that are declared (ALLO) bigger than the space left
+func (driver *ClientDriver) PreTransfer(cc server.ClientContext, request *server.TransferRequest) error {
+	if request.Direction != server.TransferUpload || request.DeclaredSize == 0 || driver.user.Quota == 0 {
+		return nil
+	}
+	usage, err := driver.usage()
+	if err != nil {
+		return err
+	}
+	if usage+request.DeclaredSize > driver.user.Quota {
+		return server.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// AvailableSpace returns the space left in the quota of the user, bounded by the free space of the file system
+func (driver *ClientDriver) AvailableSpace(cc server.ClientContext, path string) (int64, error) {
+	if err := driver.check(PermWrite); err != nil {
+		return 0, err
+	}
+	available, err := diskFree(driver.realPath(path))
+	if err != nil && driver.user.Quota <= 0 {
+		return 0, err
+	}
+	if driver.user.Quota > 0 {
+		usage, errUsage := driver.usage()
+		if errUsage != nil {
+			return 0, errUsage
+		}
+		left := driver.user.Quota - usage
+		if left < 0 {
+			left = 0
+		}
+		if err != nil || left < available {
+			available = left
+		}
+	}
+	return available, nil
+}
+
+// usage returns the size of the home directory content
+func (driver *ClientDriver) usage() (int64, error) {
+	var size int64
+	err := filepath.Walk(driver.user.Home, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// quotaFile is a file being uploaded that can't get bigger than the space left in the quota
+type quotaFile struct {
+	*os.File
+	available int64 // Bytes that can still be written
+}
+
+// ReadFrom hides the one of os.File, which would write without checking the quota
+func (f *quotaFile) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	if int64(len(p)) > f.available {
+		n, _ := f.File.Write(p[:f.available])
+		f.available -= int64(n)
+		return n, server.ErrQuotaExceeded
+	}
+	n, err := f.File.Write(p)
+	f.available -= int64(n)
+	return n, err
+}
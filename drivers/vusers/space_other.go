@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!openbsd,!dragonfly
+
+package vusers
+
+import "errors"
+
+// diskFree isn't supported on this system, only the quotas are reported
+func diskFree(path string) (int64, error) {
+	return 0, errors.New("free space unknown on this system")
+}
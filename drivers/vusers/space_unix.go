@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || openbsd || dragonfly
+// +build linux darwin freebsd openbsd dragonfly
+
+package vusers
+
+import "syscall"
+
+// diskFree returns the space available to the unprivileged users on the file system of a path
+func diskFree(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,91 @@
+// Package vusers is a driver serving local directories to virtual users. The users are defined in a database (a
+// TOML, JSON or YAML file, or an SQL table) with their home directory, permissions, quota and enabled flag.
+package vusers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/credentials"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Permission is an action a user can be allowed to perform
+type Permission byte
+
+// These are the permissions, they are written as a string of letters in the databases: "lr" for read-only access
+const (
+	PermList   Permission = 'l' // List the directories
+	PermRead   Permission = 'r' // Download the files
+	PermWrite  Permission = 'w' // Upload files, create directories, rename and chmod
+	PermDelete Permission = 'd' // Delete files and directories
+)
+
+// User is a virtual user
+type User struct {
+	Name        string `toml:"name"`        // Name used to log in
+	Password    string `toml:"password"`    // Password: in clear, "sha256:" and the hex hash, or a crypt hash ($2b$...)
+	Home        string `toml:"home"`        // Home directory
+	Permissions string `toml:"permissions"` // Permissions letters (see Permission), "lrwd" if empty
+	Quota       int64  `toml:"quota"`       // Max size in bytes of the home directory content (unlimited if 0)
+	Disabled    bool   `toml:"disabled"`    // The user can't log in
+}
+
+// Can tells if the user has a permission
+func (user *User) Can(perm Permission) bool {
+	if user.Permissions == "" {
+		return true
+	}
+	return strings.IndexByte(user.Permissions, byte(perm)) >= 0
+}
+
+// checkPassword compares a password with the user one in constant time, the crypt hashes (bcrypt, Argon2, SHA-crypt,
+// MD5-crypt) are verified by the credentials package
+func (user *User) checkPassword(password string) bool {
+	expected := user.Password
+	if credentials.Supported(expected) {
+		ok, err := credentials.Verify(expected, password)
+		return ok && err == nil
+	}
+	if strings.HasPrefix(expected, "sha256:") {
+		sum := sha256.Sum256([]byte(password))
+		expected = strings.ToLower(strings.TrimPrefix(expected, "sha256:"))
+		password = hex.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// Database provides the users
+type Database interface {
+	// User returns a user by name, nil if it doesn't exist
+	User(name string) (*User, error)
+}
+
+var (
+	// ErrBadCredentials is returned when the user doesn't exist or the password doesn't match
+	ErrBadCredentials = errors.New("bad username or password")
+
+	// ErrUserDisabled is returned when a disabled user tries to log in
+	ErrUserDisabled = errors.New("user disabled")
+
+	// ErrPermissionDenied is returned when the user doesn't have the permission to perform an action
+	ErrPermissionDenied = server.ErrPermissionDenied
+)
+
+// Authenticate checks the credentials of a user of the database
+func Authenticate(db Database, name, password string) (*User, error) {
+	user, err := db.User(name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.checkPassword(password) {
+		return nil, ErrBadCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
@@ -0,0 +1,174 @@
+package vusers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+const usersTOML = `
+[[users]]
+name = "alice"
+password = "sha256:2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90"
+home = "%s/alice"
+quota = 10
+
+[[users]]
+name = "bob"
+password = "bob"
+home = "%s/bob"
+permissions = "lr"
+
+[[users]]
+name = "carol"
+password = "carol"
+home = "%s/carol"
+disabled = true
+`
+
+func newTestDatabase(t *testing.T) (*FileDatabase, string) {
+	dir, err := ioutil.TempDir("", "vusers")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory:", err)
+	}
+
+	fileName := filepath.Join(dir, "users.toml")
+	content := []byte(fmt.Sprintf(usersTOML, dir, dir, dir))
+	if err := ioutil.WriteFile(fileName, content, 0600); err != nil {
+		t.Fatal("Couldn't write the users file:", err)
+	}
+
+	db, err := NewFileDatabase(fileName)
+	if err != nil {
+		t.Fatal("Couldn't load the users:", err)
+	}
+	return db, dir
+}
+
+func TestAuthenticate(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := Authenticate(db, "alice", "alice"); err != nil {
+		t.Fatal("Alice should be authenticated:", err)
+	}
+	if _, err := Authenticate(db, "alice", "bob"); err != ErrBadCredentials {
+		t.Fatal("Bad password:", err)
+	}
+	if _, err := Authenticate(db, "dave", "dave"); err != ErrBadCredentials {
+		t.Fatal("Unknown user:", err)
+	}
+	if _, err := Authenticate(db, "carol", "carol"); err != ErrUserDisabled {
+		t.Fatal("Carol is disabled:", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+
+	bob, _ := db.User("bob")
+	driver, err := NewClientDriver(bob)
+	if err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+
+	if _, err := driver.OpenFile(nil, "/file", os.O_WRONLY); err != ErrPermissionDenied {
+		t.Fatal("Bob can't write:", err)
+	}
+	if _, err := driver.OpenFile(nil, "/file", os.O_RDWR); err != ErrPermissionDenied {
+		t.Fatal("Bob can't open files for reading and writing:", err)
+	}
+	if err := driver.MakeDirectory(nil, "/dir"); err != ErrPermissionDenied {
+		t.Fatal("Bob can't create directories:", err)
+	}
+	if _, err := driver.GetFileInfo(nil, "/"); err != nil {
+		t.Fatal("Bob can stat:", err)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+
+	alice, _ := db.User("alice")
+	driver, err := NewClientDriver(alice)
+	if err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+
+	file, err := driver.OpenFile(nil, "/file", os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't open the file:", err)
+	}
+	if n, err := file.Write(make([]byte, 12)); err != server.ErrQuotaExceeded || n != 10 {
+		t.Fatal("The quota should have been reached:", n, err)
+	}
+	file.Close()
+
+	// The quota is also checked when the server lets the file read the transfer connection
+	file, _ = driver.OpenFile(nil, "/file", os.O_WRONLY)
+	if _, err := file.(io.ReaderFrom).ReadFrom(bytes.NewReader(make([]byte, 12))); err != server.ErrQuotaExceeded {
+		t.Fatal("The quota should have been reached:", err)
+	}
+	file.Close()
+
+	if _, err := driver.OpenFile(nil, "/other", os.O_WRONLY); err != server.ErrQuotaExceeded {
+		t.Fatal("There's no space left:", err)
+	}
+
+	// Replacing the file frees its space
+	if file, err = driver.OpenFile(nil, "/file", os.O_WRONLY); err != nil {
+		t.Fatal("The file can be replaced:", err)
+	}
+	file.Close()
+}
+
+func TestAvailableSpace(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+
+	alice, _ := db.User("alice")
+	driver, err := NewClientDriver(alice)
+	if err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+	file, err := driver.OpenFile(nil, "/file", os.O_WRONLY)
+	if err != nil {
+		t.Fatal("Couldn't open the file:", err)
+	}
+	file.Write(make([]byte, 4))
+	file.Close()
+
+	if available, err := driver.AvailableSpace(nil, "/"); err != nil || available != 6 {
+		t.Fatal("The space left in the quota should be reported:", available, err)
+	}
+
+	// Bob can't write
+	bob, _ := db.User("bob")
+	if driver, err = NewClientDriver(bob); err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+	if _, err = driver.AvailableSpace(nil, "/"); err != ErrPermissionDenied {
+		t.Fatal("The space should only be reported to the users who can write:", err)
+	}
+}
+
+func TestCryptPassword(t *testing.T) {
+	user := &User{Password: "$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm"}
+	if !user.checkPassword("password") || user.checkPassword("bad") {
+		t.Fatal("The bcrypt hash should be verified")
+	}
+
+	// A malformed hash isn't a password in clear
+	user.Password = "$2b$04$short"
+	if user.checkPassword(user.Password) {
+		t.Fatal("The malformed hashes should never match")
+	}
+}
@@ -0,0 +1,144 @@
+package drivertest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Context is a server.ClientContext for the driver tests, outside of any connection
+type Context struct {
+	path      string
+	id        uint32
+	user      string
+	host      string
+	verbosity server.LogVerbosity
+	mutex     sync.Mutex
+	values    map[string]interface{}
+	closed    string
+}
+
+// NewContext creates the context of a session
+func NewContext(id uint32, user string) *Context {
+	return &Context{path: "/", id: id, user: user, values: make(map[string]interface{})}
+}
+
+var _ server.ClientContext = (*Context)(nil)
+
+// Path returns the current directory
+func (c *Context) Path() string { return c.path }
+
+// SetPath changes the current directory
+func (c *Context) SetPath(path string) { c.path = path }
+
+// ID returns the ID of the session
+func (c *Context) ID() uint32 { return c.id }
+
+// SessionUID returns the unique ID of the session, derived from its ID
+func (c *Context) SessionUID() string { return fmt.Sprintf("drivertest-%d", c.id) }
+
+// User returns the user of the session
+func (c *Context) User() string { return c.user }
+
+// Host returns the virtual host of the session, empty unless SetHost was called
+func (c *Context) Host() string { return c.host }
+
+// SetHost changes the virtual host of the session
+func (c *Context) SetHost(host string) { c.host = host }
+
+// Account returns an empty account
+func (c *Context) Account() string { return "" }
+
+// ClientVersion returns an empty client version
+func (c *Context) ClientVersion() string { return "" }
+
+// TLSFingerprint returns an empty fingerprint
+func (c *Context) TLSFingerprint() string { return "" }
+
+// SetDebug changes the logging of the session
+func (c *Context) SetDebug(debug bool) {
+	if debug {
+		c.verbosity = server.LogCommandsAndReplies
+	} else {
+		c.verbosity = server.LogNothing
+	}
+}
+
+// Debug returns the logging of the session
+func (c *Context) Debug() bool { return c.verbosity == server.LogCommandsAndReplies }
+
+// SetLogVerbosity changes the logging of the session
+func (c *Context) SetLogVerbosity(verbosity server.LogVerbosity) { c.verbosity = verbosity }
+
+// LogVerbosity returns the logging of the session
+func (c *Context) LogVerbosity() server.LogVerbosity { return c.verbosity }
+
+// SetProtectedDataRequired does nothing
+func (c *Context) SetProtectedDataRequired(required bool) {}
+
+// TransferContext returns a context that is never cancelled
+func (c *Context) TransferContext() context.Context { return context.Background() }
+
+// RemoteAddr returns the loopback address
+func (c *Context) RemoteAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+// RemoteHost returns no host name, the reverse lookups aren't done
+func (c *Context) RemoteHost() string { return "" }
+
+// LocalAddr returns the loopback address
+func (c *Context) LocalAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 21} }
+
+// HasTLSForControl returns false
+func (c *Context) HasTLSForControl() bool { return false }
+
+// TLSConnectionState returns nil
+func (c *Context) TLSConnectionState() *tls.ConnectionState { return nil }
+
+// DataProtection returns the clear protection level
+func (c *Context) DataProtection() string { return "C" }
+
+// DataTLSConnectionState returns nil
+func (c *Context) DataTLSConnectionState() *tls.ConnectionState { return nil }
+
+// Stats returns empty statistics
+func (c *Context) Stats() *server.SessionStats { return &server.SessionStats{} }
+
+// UserSessions returns 0, the context has no other session
+func (c *Context) UserSessions() int { return 0 }
+
+// SetValue stores a value for the session
+func (c *Context) SetValue(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if value == nil {
+		delete(c.values, key)
+	} else {
+		c.values[key] = value
+	}
+}
+
+// GetValue returns a value stored for the session
+func (c *Context) GetValue(key string) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[key]
+}
+
+// Close records the reply closing the session, see Closed
+func (c *Context) Close(code int, message string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = fmt.Sprintf("%d %s", code, message)
+	return nil
+}
+
+// Closed returns the reply given to Close, empty if the session wasn't closed
+func (c *Context) Closed() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
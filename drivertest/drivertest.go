@@ -0,0 +1,351 @@
+// Package drivertest is a conformance test suite for the drivers. It runs the operations of the FTP commands on a
+// driver (authentication, listing, uploads and downloads, appends, resumes, renames, deletions and concurrent
+// sessions) and checks their results, so that the third-party drivers can be verified like the ones of this
+// repository:
+//
+//	func TestConformance(t *testing.T) {
+//		drivertest.Run(t, &drivertest.Config{Driver: newDriver(), User: "test", Pass: "test", BadPass: "bad"})
+//	}
+package drivertest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Config defines the driver to test
+type Config struct {
+	Driver  server.MainDriver // Driver to test
+	User    string            // User allowed to log in
+	Pass    string            // Password of the user
+	BadPass string            // Password refused for the user (the refusal isn't tested if empty)
+	Dir     string            // Directory created for the tests and removed after them ("/drivertest" by default)
+	Clients int               // Number of concurrent sessions (10 by default)
+}
+
+// suite runs the tests of a config
+type suite struct {
+	*Config
+	sessions uint32
+	mutex    sync.Mutex
+}
+
+// Run runs the conformance tests of a driver, as subtests of t
+func Run(t *testing.T, config *Config) {
+	s := &suite{Config: config}
+	if s.Dir == "" {
+		s.Dir = "/drivertest"
+	}
+	if s.Clients <= 0 {
+		s.Clients = 10
+	}
+
+	if !t.Run("Auth", s.testAuth) {
+		return
+	}
+
+	cc, driver := s.login(t)
+	if err := driver.MakeDirectory(cc, s.Dir); err != nil {
+		t.Fatal("Couldn't create the test directory:", err)
+	}
+	defer s.remove(t, cc, driver, s.Dir)
+
+	t.Run("Directories", s.testDirectories)
+	t.Run("RoundTrip", s.testRoundTrip)
+	t.Run("Append", s.testAppend)
+	t.Run("Resume", s.testResume)
+	t.Run("Rename", s.testRename)
+	t.Run("Delete", s.testDelete)
+	t.Run("ConcurrentClients", s.testConcurrentClients)
+}
+
+// login opens a new session
+func (s *suite) login(t testing.TB) (*Context, server.ClientHandlingDriver) {
+	s.mutex.Lock()
+	s.sessions++
+	cc := NewContext(s.sessions, s.User)
+	s.mutex.Unlock()
+
+	driver, err := s.Driver.AuthUser(cc, s.User, s.Pass)
+	if err != nil {
+		t.Fatal("Couldn't log in:", err)
+	}
+	if driver == nil {
+		t.Fatal("No driver returned for the session")
+	}
+	return cc, driver
+}
+
+func (s *suite) testAuth(t *testing.T) {
+	s.login(t)
+
+	if s.BadPass != "" {
+		if driver, err := s.Driver.AuthUser(NewContext(0, s.User), s.User, s.BadPass); err == nil {
+			t.Fatal("The bad password should be refused, got a driver:", driver)
+		}
+	}
+}
+
+func (s *suite) testDirectories(t *testing.T) {
+	cc, driver := s.login(t)
+	dir := path.Join(s.Dir, "dir")
+	if err := driver.MakeDirectory(cc, dir); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	if info, err := driver.GetFileInfo(cc, dir); err != nil || !info.IsDir() {
+		t.Fatal("The directory should exist:", info, err)
+	}
+	s.upload(t, cc, driver, path.Join(dir, "file"), []byte("content"), false)
+
+	if err := driver.ChangeDirectory(cc, dir); err != nil {
+		t.Fatal("Couldn't change directory:", err)
+	}
+	cc.SetPath(dir)
+	files, err := driver.ListFiles(cc)
+	if err != nil {
+		t.Fatal("Couldn't list the directory:", err)
+	}
+	if len(files) != 1 || files[0].Name() != "file" || files[0].Size() != 7 || files[0].IsDir() {
+		t.Fatal("The directory should only contain the file:", names(files))
+	}
+
+	if err := driver.ChangeDirectory(cc, path.Join(s.Dir, "missing")); err == nil {
+		t.Fatal("Changing to a missing directory should fail")
+	}
+}
+
+func (s *suite) testRoundTrip(t *testing.T) {
+	cc, driver := s.login(t)
+	file := path.Join(s.Dir, "roundtrip")
+	data := content(256 * 1024)
+	s.upload(t, cc, driver, file, data, false)
+
+	if info, err := driver.GetFileInfo(cc, file); err != nil || info.Size() != int64(len(data)) || info.IsDir() {
+		t.Fatal("Wrong info after the upload:", info, err)
+	}
+	if downloaded := s.download(t, cc, driver, file, 0); !bytes.Equal(downloaded, data) {
+		t.Fatalf("The downloaded file differs from the uploaded one (%d bytes instead of %d)", len(downloaded),
+			len(data))
+	}
+
+	// Uploading again replaces the file
+	s.upload(t, cc, driver, file, []byte("short"), false)
+	if downloaded := s.download(t, cc, driver, file, 0); string(downloaded) != "short" {
+		t.Fatalf("The file should be replaced: %q", downloaded)
+	}
+}
+
+func (s *suite) testAppend(t *testing.T) {
+	cc, driver := s.login(t)
+	file := path.Join(s.Dir, "append")
+	s.upload(t, cc, driver, file, []byte("hello"), false)
+	s.upload(t, cc, driver, file, []byte(" world"), true)
+
+	if downloaded := s.download(t, cc, driver, file, 0); string(downloaded) != "hello world" {
+		t.Fatalf("Wrong content after the append: %q", downloaded)
+	}
+}
+
+func (s *suite) testResume(t *testing.T) {
+	cc, driver := s.login(t)
+	file := path.Join(s.Dir, "resume")
+	data := content(10000)
+	s.upload(t, cc, driver, file, data, false)
+
+	if downloaded := s.download(t, cc, driver, file, 4000); !bytes.Equal(downloaded, data[4000:]) {
+		t.Fatalf("Wrong resumed download (%d bytes instead of %d)", len(downloaded), len(data)-4000)
+	}
+}
+
+func (s *suite) testRename(t *testing.T) {
+	cc, driver := s.login(t)
+	from, to := path.Join(s.Dir, "from"), path.Join(s.Dir, "to")
+	s.upload(t, cc, driver, from, []byte("renamed"), false)
+
+	if err := driver.RenameFile(cc, from, to); err != nil {
+		t.Fatal("Couldn't rename the file:", err)
+	}
+	if _, err := driver.GetFileInfo(cc, from); err == nil {
+		t.Fatal("The old name shouldn't exist anymore")
+	}
+	if downloaded := s.download(t, cc, driver, to, 0); string(downloaded) != "renamed" {
+		t.Fatalf("Wrong content after the rename: %q", downloaded)
+	}
+
+	dir, renamedDir := path.Join(s.Dir, "renameDir"), path.Join(s.Dir, "renamedDir")
+	if err := driver.MakeDirectory(cc, dir); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	if err := driver.RenameFile(cc, dir, renamedDir); err != nil {
+		t.Fatal("Couldn't rename the directory:", err)
+	}
+	if info, err := driver.GetFileInfo(cc, renamedDir); err != nil || !info.IsDir() {
+		t.Fatal("The renamed directory should exist:", info, err)
+	}
+}
+
+func (s *suite) testDelete(t *testing.T) {
+	cc, driver := s.login(t)
+	dir := path.Join(s.Dir, "delete")
+	file := path.Join(dir, "file")
+	if err := driver.MakeDirectory(cc, dir); err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	s.upload(t, cc, driver, file, []byte("deleted"), false)
+
+	if err := driver.DeleteFile(cc, file); err != nil {
+		t.Fatal("Couldn't delete the file:", err)
+	}
+	if _, err := driver.GetFileInfo(cc, file); err == nil {
+		t.Fatal("The deleted file shouldn't exist anymore")
+	}
+	if _, err := driver.OpenFile(cc, file, os.O_RDONLY); err == nil {
+		t.Fatal("Opening the deleted file should fail")
+	}
+	if err := driver.DeleteFile(cc, dir); err != nil {
+		t.Fatal("Couldn't delete the directory:", err)
+	}
+	if _, err := driver.GetFileInfo(cc, dir); err == nil {
+		t.Fatal("The deleted directory shouldn't exist anymore")
+	}
+}
+
+func (s *suite) testConcurrentClients(t *testing.T) {
+	errs := make(chan error, s.Clients)
+	var wg sync.WaitGroup
+	for i := 0; i < s.Clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.concurrentClient(i)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// concurrentClient uploads and downloads its own file in its session, it can't call t.Fatal from its goroutine
+func (s *suite) concurrentClient(i int) error {
+	s.mutex.Lock()
+	s.sessions++
+	cc := NewContext(s.sessions, s.User)
+	s.mutex.Unlock()
+
+	driver, err := s.Driver.AuthUser(cc, s.User, s.Pass)
+	if err != nil {
+		return fmt.Errorf("client %d couldn't log in: %v", i, err)
+	}
+
+	file := path.Join(s.Dir, fmt.Sprintf("client-%d", i))
+	data := append(content(32*1024), byte(i))
+	if err := write(cc, driver, file, data, false); err != nil {
+		return fmt.Errorf("client %d couldn't upload: %v", i, err)
+	}
+	downloaded, err := read(cc, driver, file, 0)
+	if err != nil {
+		return fmt.Errorf("client %d couldn't download: %v", i, err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		return fmt.Errorf("client %d downloaded another content", i)
+	}
+	return nil
+}
+
+// upload writes a file the way STOR (or APPE) does
+func (s *suite) upload(t *testing.T, cc server.ClientContext, driver server.ClientHandlingDriver, file string,
+	data []byte, append bool) {
+	if err := write(cc, driver, file, data, append); err != nil {
+		t.Fatal("Couldn't upload", file, err)
+	}
+}
+
+// download reads a file from an offset the way RETR (after a REST) does
+func (s *suite) download(t *testing.T, cc server.ClientContext, driver server.ClientHandlingDriver, file string,
+	offset int64) []byte {
+	data, err := read(cc, driver, file, offset)
+	if err != nil {
+		t.Fatal("Couldn't download", file, err)
+	}
+	return data
+}
+
+func write(cc server.ClientContext, driver server.ClientHandlingDriver, file string, data []byte, append bool) error {
+	flag := os.O_WRONLY
+	if append {
+		flag |= os.O_APPEND
+	}
+	stream, err := driver.OpenFile(cc, file, flag)
+	if err != nil {
+		return err
+	}
+	if _, err = stream.Write(data); err != nil {
+		stream.Close()
+		return err
+	}
+	return stream.Close()
+}
+
+func read(cc server.ClientContext, driver server.ClientHandlingDriver, file string, offset int64) ([]byte, error) {
+	stream, err := driver.OpenFile(cc, file, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if offset != 0 {
+		if _, err = stream.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(stream)
+}
+
+// remove deletes a file or a directory with its content
+func (s *suite) remove(t *testing.T, cc *Context, driver server.ClientHandlingDriver, name string) {
+	if info, err := driver.GetFileInfo(cc, name); err == nil && info.IsDir() {
+		previous := cc.Path()
+		cc.SetPath(name)
+		files, err := driver.ListFiles(cc)
+		cc.SetPath(previous)
+		if err != nil {
+			t.Error("Couldn't list", name, err)
+			return
+		}
+		for _, file := range files {
+			s.remove(t, cc, driver, path.Join(name, file.Name()))
+		}
+	}
+	if err := driver.DeleteFile(cc, name); err != nil {
+		t.Error("Couldn't delete", name, err)
+	}
+}
+
+// content returns some data that isn't only made of zeros
+func content(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func names(files []os.FileInfo) []string {
+	list := make([]string, len(files))
+	for i, file := range files {
+		list[i] = file.Name()
+	}
+	return list
+}
@@ -0,0 +1,18 @@
+package drivertest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/sample"
+)
+
+func TestSampleDriver(t *testing.T) {
+	driver, err := sample.NewSampleDriver()
+	if err != nil {
+		t.Fatal("Couldn't create the driver:", err)
+	}
+	defer os.RemoveAll(driver.BaseDir)
+
+	Run(t, &Config{Driver: driver, User: "test", Pass: "test", BadPass: "bad"})
+}
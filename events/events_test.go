@@ -0,0 +1,112 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// message is a message received by the fake NATS server
+type message struct {
+	subject string
+	data    string
+}
+
+// fakeNATS accepts one connection and forwards the published messages
+func fakeNATS(t *testing.T) (string, chan message, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	messages, connects := make(chan message, 10), make(chan string, 1)
+
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT "))
+			case strings.TrimSpace(line) == "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case len(fields) == 3 && fields[0] == "PUB":
+				var size int
+				fmt.Sscan(fields[2], &size)
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, data); err != nil {
+					return
+				}
+				messages <- message{subject: fields[1], data: string(data[:size])}
+			}
+		}
+	}()
+
+	return listener.Addr().String(), messages, connects
+}
+
+func TestNATSExport(t *testing.T) {
+	address, messages, connects := fakeNATS(t)
+
+	publisher := &NATSPublisher{Address: address, Token: "secret"}
+	defer publisher.Close()
+	exporter := NewExporter(publisher, "ftp", 10)
+	exporter.Event(&server.Event{Type: server.EventLogin, User: "alice", SessionID: 1})
+	exporter.Event(&server.Event{Type: server.EventUpload, User: "alice", Path: "/file.txt", Size: 42})
+	exporter.Close()
+
+	var connect natsConnect
+	if err := json.Unmarshal([]byte(<-connects), &connect); err != nil || connect.Token != "secret" {
+		t.Fatal("Bad CONNECT:", connect, err)
+	}
+
+	for _, expected := range []string{"ftp.session.login", "ftp.transfer.upload"} {
+		select {
+		case msg := <-messages:
+			var event server.Event
+			if err := json.Unmarshal([]byte(msg.data), &event); err != nil || msg.subject != expected ||
+				event.User != "alice" {
+				t.Fatal("Bad message:", msg, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("The event should have been published to", expected)
+		}
+	}
+}
+
+// failingPublisher can't publish anything
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(subject string, data []byte) error {
+	return fmt.Errorf("can't publish to %s", subject)
+}
+
+func TestExporterErrors(t *testing.T) {
+	var failures []error
+	exporter := NewExporter(failingPublisher{}, "", 10)
+	exporter.OnError = func(err error) { failures = append(failures, err) }
+	exporter.Event(&server.Event{Type: server.EventConnected})
+	exporter.Close()
+
+	if len(failures) != 1 || failures[0].Error() != "can't publish to session.connected" {
+		t.Fatal("The failure should have been reported:", failures)
+	}
+}
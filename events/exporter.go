@@ -0,0 +1,85 @@
+// Package events exports the session and transfer events of the server to a streaming infrastructure. The events
+// are published as JSON to a subject per event type, like "ftp.session.login" or "ftp.transfer.upload".
+//
+// A NATS publisher is provided. Kafka (or any other system) can be used through a Publisher writing to its client,
+// with the subjects as topics.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// ErrQueueFull is reported when an event is dropped because the publisher can't keep up
+var ErrQueueFull = errors.New("the events queue is full, event dropped")
+
+// Publisher publishes a message to a subject (or topic)
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// Exporter publishes the events of the server, it's a server.EventListener. The events are queued and published in
+// the background so that a slow publisher doesn't slow down the clients.
+type Exporter struct {
+	OnError func(err error) // Receives the publication errors (optional)
+
+	publisher Publisher
+	prefix    string // Prefix of the subjects
+	queue     chan *server.Event
+	done      sync.WaitGroup
+}
+
+// NewExporter creates an exporter publishing to the subjects starting with prefix, with a queue of queueSize events
+func NewExporter(publisher Publisher, prefix string, queueSize int) *Exporter {
+	exporter := &Exporter{
+		publisher: publisher,
+		prefix:    prefix,
+		queue:     make(chan *server.Event, queueSize),
+	}
+	exporter.done.Add(1)
+	go exporter.run()
+	return exporter
+}
+
+// Subject returns the subject of an event type
+func (exporter *Exporter) Subject(eventType server.EventType) string {
+	if exporter.prefix == "" {
+		return string(eventType)
+	}
+	return exporter.prefix + "." + string(eventType)
+}
+
+// Event queues an event
+func (exporter *Exporter) Event(event *server.Event) {
+	select {
+	case exporter.queue <- event:
+	default:
+		exporter.reportError(ErrQueueFull)
+	}
+}
+
+func (exporter *Exporter) run() {
+	defer exporter.done.Done()
+	for event := range exporter.queue {
+		data, _ := json.Marshal(event) // The events can always be encoded
+		if err := exporter.publisher.Publish(exporter.Subject(event.Type), data); err != nil {
+			exporter.reportError(err)
+		}
+	}
+}
+
+func (exporter *Exporter) reportError(err error) {
+	if exporter.OnError != nil {
+		exporter.OnError(err)
+	}
+}
+
+// Close publishes the queued events and stops the exporter, the publisher isn't closed
+func (exporter *Exporter) Close() error {
+	close(exporter.queue)
+	exporter.done.Wait()
+	return nil
+}
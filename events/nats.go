@@ -0,0 +1,177 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher publishes to a NATS server with its text protocol. It connects on the first publication and
+// reconnects after the connection errors.
+type NATSPublisher struct {
+	Address string        // Address of the server (host:port)
+	User    string        // User (optional)
+	Pass    string        // Password (optional)
+	Token   string        // Authentication token (optional)
+	Timeout time.Duration // Connection and write timeout, 5s by default
+
+	mutex sync.Mutex // Protects the connection
+	conn  net.Conn   // Current connection, nil when disconnected
+	err   error      // Last error sent by the server
+}
+
+// natsConnect is the CONNECT message of the protocol
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+func (p *NATSPublisher) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 5 * time.Second
+}
+
+// connect opens the connection, the mutex must be held
+func (p *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.Address, p.timeout())
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout()))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting: %s", strings.TrimSpace(line))
+	}
+
+	connect, _ := json.Marshal(&natsConnect{
+		Name:    "ftpserver",
+		Lang:    "go",
+		Version: "1",
+		User:    p.User,
+		Pass:    p.Pass,
+		Token:   p.Token,
+	})
+	// The PING makes sure the server accepted the connection before publishing
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return err
+	}
+	for {
+		if line, err = reader.ReadString('\n'); err != nil {
+			conn.Close()
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return fmt.Errorf("NATS connection refused: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+	p.conn, p.err = conn, nil
+	go p.read(conn, reader)
+	return nil
+}
+
+// read answers the PINGs of the server and keeps its errors
+func (p *NATSPublisher) read(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			p.disconnect(conn, err)
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			p.mutex.Lock()
+			conn.SetWriteDeadline(time.Now().Add(p.timeout()))
+			_, err = conn.Write([]byte("PONG\r\n"))
+			p.mutex.Unlock()
+			if err != nil {
+				p.disconnect(conn, err)
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			p.mutex.Lock()
+			p.err = errors.New("NATS error: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+			p.mutex.Unlock()
+		}
+	}
+}
+
+// disconnect forgets a connection that failed
+func (p *NATSPublisher) disconnect(conn net.Conn, err error) {
+	conn.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == conn {
+		p.conn = nil
+		if p.err == nil {
+			p.err = err
+		}
+	}
+}
+
+// Publish publishes a message to a subject
+func (p *NATSPublisher) Publish(subject string, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	p.conn.SetWriteDeadline(time.Now().Add(p.timeout()))
+	if _, err := fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\n", subject, len(data), data); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Err returns the last error sent by the server, NATS doesn't acknowledge the publications
+func (p *NATSPublisher) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+// Close closes the connection
+func (p *NATSPublisher) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
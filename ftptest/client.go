@@ -0,0 +1,89 @@
+package ftptest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/client"
+)
+
+// Timeout is the max duration of each operation of the clients
+var Timeout = 10 * time.Second
+
+// Client is a scriptable client, its methods fail the test when the server doesn't reply as expected
+type Client struct {
+	*client.Conn // Connection to the server, for the operations that are expected to fail
+
+	t testing.TB
+}
+
+// Dial connects to a server and checks its welcome message
+func Dial(t testing.TB, address string) (*Client, error) {
+	conn, err := client.Dial(address, &client.Config{Timeout: Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Conn: conn, t: t}, nil
+}
+
+// Send sends a raw command and returns the reply of the server
+func (c *Client) Send(command string) *client.Reply {
+	c.t.Helper()
+	reply, err := c.Cmd(command)
+	if err != nil {
+		c.t.Fatalf("No reply to %q: %v", command, err)
+	}
+	return reply
+}
+
+// Expect sends a raw command and checks the reply code
+func (c *Client) Expect(command string, code int) *client.Reply {
+	c.t.Helper()
+	reply := c.Send(command)
+	if reply.Code != code {
+		c.t.Fatalf("Unexpected reply to %q (%d expected): %s", command, code, reply)
+	}
+	return reply
+}
+
+// Login logs the user in
+func (c *Client) Login(user, pass string) {
+	c.t.Helper()
+	if err := c.Conn.Login(user, pass); err != nil {
+		c.t.Fatal("Couldn't log in:", err)
+	}
+}
+
+// Download downloads a file (RETR)
+func (c *Client) Download(path string) []byte {
+	c.t.Helper()
+	var data bytes.Buffer
+	if _, err := c.Retrieve(path, &data); err != nil {
+		c.t.Fatal("Couldn't download", path, err)
+	}
+	return data.Bytes()
+}
+
+// List returns the listing of a directory (LIST)
+func (c *Client) List(path string) []*client.Entry {
+	c.t.Helper()
+	entries, err := c.Conn.List(path)
+	if err != nil {
+		c.t.Fatal("Couldn't list", path, err)
+	}
+	return entries
+}
+
+// Upload uploads a file (STOR)
+func (c *Client) Upload(path string, data []byte) {
+	c.t.Helper()
+	if _, err := c.Store(path, bytes.NewReader(data)); err != nil {
+		c.t.Fatal("Couldn't upload", path, err)
+	}
+}
+
+// Close quits and closes the connection
+func (c *Client) Close() error {
+	return c.Quit()
+}
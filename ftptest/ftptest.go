@@ -0,0 +1,66 @@
+// Package ftptest runs the server in the tests of the drivers. It starts a server on an ephemeral port of the loopback
+// interface, and provides a scriptable client sending raw commands, checking the reply codes and performing the
+// transfers:
+//
+//	func TestUpload(t *testing.T) {
+//		s := ftptest.NewServer(t, newDriver())
+//		defer s.Close()
+//
+//		c := s.Connect(t)
+//		defer c.Close()
+//		c.Login("test", "test")
+//		c.Upload("/file.txt", []byte("hello"))
+//		c.Expect("SIZE /file.txt", 213)
+//	}
+package ftptest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Server is a server running for some tests
+type Server struct {
+	*server.FtpServer
+}
+
+// NewServer starts a server with a driver, on an ephemeral port of the loopback interface. The other settings of the
+// driver are used as they are.
+func NewServer(t testing.TB, driver server.MainDriver) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+
+	s := server.NewFtpServer(driver)
+	s.Listener = listener
+	if err := s.Listen(); err != nil {
+		listener.Close()
+		t.Fatal("Couldn't start the server:", err)
+	}
+	go s.Serve()
+	return &Server{FtpServer: s}
+}
+
+// Addr returns the address of the server
+func (s *Server) Addr() string {
+	return s.Listener.Addr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.Stop()
+}
+
+// Connect opens a client connection to the server and checks its welcome message
+func (s *Server) Connect(t testing.TB) *Client {
+	t.Helper()
+	c, err := Dial(t, s.Addr())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	return c
+}
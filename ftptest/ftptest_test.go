@@ -0,0 +1,83 @@
+package ftptest
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/sample"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// testDriver serves a temporary directory
+type testDriver struct {
+	dir string
+}
+
+func (d *testDriver) GetSettings() *server.Settings {
+	return &server.Settings{}
+}
+
+func (d *testDriver) GetTLSConfig() (*tls.Config, error) {
+	return nil, errors.New("no TLS")
+}
+
+func (d *testDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return "Test server", nil
+}
+
+func (d *testDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	if pass != "test" {
+		return nil, errors.New("bad password")
+	}
+	return &sample.ClientDriver{BaseDir: d.dir}, nil
+}
+
+func (d *testDriver) UserLeft(cc server.ClientContext) {}
+
+func TestHarness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftptest")
+	if err != nil {
+		t.Fatal("Couldn't create the directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewServer(t, &testDriver{dir: dir})
+	defer s.Close()
+
+	c := s.Connect(t)
+	defer c.Close()
+
+	c.Expect("NOOP", 200)
+	c.Expect("LIST", 530)
+	c.Login("test", "test")
+
+	c.Upload("/file.txt", []byte("hello world"))
+	if data := c.Download("/file.txt"); string(data) != "hello world" {
+		t.Fatalf("Wrong content: %q", data)
+	}
+	if reply := c.Expect("SIZE /file.txt", 213); reply.Message != "11" {
+		t.Fatal("Wrong size:", reply)
+	}
+	listed := false
+	for _, entry := range c.List("/") {
+		listed = listed || (entry.Name == "file.txt" && entry.Size == 11)
+	}
+	if !listed {
+		t.Fatal("The file should be listed")
+	}
+
+	if reply := c.Expect("FEAT", 211); len(reply.Lines) < 3 || !strings.HasPrefix(reply.Lines[0], "211-") {
+		t.Fatal("Bad multi-line reply:", reply)
+	}
+
+	// Several clients can be connected at the same time
+	other := s.Connect(t)
+	defer other.Close()
+	if err := other.Conn.Login("test", "bad"); err == nil {
+		t.Fatal("The bad password should be refused")
+	}
+}
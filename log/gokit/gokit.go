@@ -0,0 +1,41 @@
+// Package gokit provides a go-kit adapter for the server logger
+package gokit
+
+import (
+	"github.com/fclairamb/ftpserver/server"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+type gkLogger struct {
+	logger log.Logger
+}
+
+// New creates a server logger writing to a go-kit logger
+func New(logger log.Logger) server.Logger {
+	return &gkLogger{logger: logger}
+}
+
+func (l *gkLogger) log(logger log.Logger, msg string, keyvals ...interface{}) {
+	logger.Log(append([]interface{}{"msg", msg}, keyvals...)...)
+}
+
+func (l *gkLogger) Debug(msg string, keyvals ...interface{}) {
+	l.log(level.Debug(l.logger), msg, keyvals...)
+}
+
+func (l *gkLogger) Info(msg string, keyvals ...interface{}) {
+	l.log(level.Info(l.logger), msg, keyvals...)
+}
+
+func (l *gkLogger) Warn(msg string, keyvals ...interface{}) {
+	l.log(level.Warn(l.logger), msg, keyvals...)
+}
+
+func (l *gkLogger) Error(msg string, keyvals ...interface{}) {
+	l.log(level.Error(l.logger), msg, keyvals...)
+}
+
+func (l *gkLogger) With(keyvals ...interface{}) server.Logger {
+	return &gkLogger{logger: log.With(l.logger, keyvals...)}
+}
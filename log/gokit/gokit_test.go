@@ -0,0 +1,21 @@
+package gokit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(log.NewLogfmtLogger(&buf)).With("clientId", 1)
+
+	logger.Warn("Transfer aborted", "path", "/file")
+	logger.Debug("FTP RECV", "command", "NOOP")
+	expected := "level=warn clientId=1 msg=\"Transfer aborted\" path=/file\n" +
+		"level=debug clientId=1 msg=\"FTP RECV\" command=NOOP\n"
+	if buf.String() != expected {
+		t.Fatalf("Wrong logs: %q", buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+//go:build go1.21
+// +build go1.21
+
+// Package slog provides a log/slog adapter for the server logger
+package slog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// New creates a server logger writing to a slog logger
+func New(logger *slog.Logger) server.Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (l *slogLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (l *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (l *slogLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+func (l *slogLogger) With(keyvals ...interface{}) server.Logger {
+	return &slogLogger{logger: l.logger.With(keyvals...)}
+}
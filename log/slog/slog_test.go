@@ -0,0 +1,32 @@
+//go:build go1.21
+// +build go1.21
+
+package slog
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	logger := New(slog.New(handler)).With("clientId", 1)
+
+	logger.Warn("Transfer aborted", "path", "/file")
+	logger.Debug("FTP RECV", "command", "NOOP")
+	expected := "level=WARN msg=\"Transfer aborted\" clientId=1 path=/file\n" +
+		"level=DEBUG msg=\"FTP RECV\" clientId=1 command=NOOP\n"
+	if buf.String() != expected {
+		t.Fatalf("Wrong logs: %q", buf.String())
+	}
+}
@@ -0,0 +1,78 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+type syslogLogger struct {
+	writer  *Writer
+	level   Severity
+	keyvals []interface{}
+}
+
+// New creates a server logger sending the messages up to a severity (SeverityInfo drops the debugging ones) to a
+// writer. The messages are formatted as logfmt, their "action" key is the message ID.
+func New(writer *Writer, level Severity) server.Logger {
+	return &syslogLogger{writer: writer, level: level}
+}
+
+func (l *syslogLogger) log(severity Severity, msg string, keyvals []interface{}) {
+	if severity > l.level {
+		return
+	}
+	keyvals = append(append([]interface{}{}, l.keyvals...), keyvals...)
+
+	var b strings.Builder
+	b.WriteString(msg)
+	msgID := "-"
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		if key == "action" {
+			msgID = fmt.Sprint(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, logfmtValue(value))
+	}
+	// The logger has no way to report the errors
+	l.writer.Send(severity, msgID, b.String())
+}
+
+// logfmtValue formats a value, quoted if it's empty or has some spaces, quotes or equal signs
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (l *syslogLogger) Debug(msg string, keyvals ...interface{}) {
+	l.log(SeverityDebug, msg, keyvals)
+}
+
+func (l *syslogLogger) Info(msg string, keyvals ...interface{}) {
+	l.log(SeverityInfo, msg, keyvals)
+}
+
+func (l *syslogLogger) Warn(msg string, keyvals ...interface{}) {
+	l.log(SeverityWarning, msg, keyvals)
+}
+
+func (l *syslogLogger) Error(msg string, keyvals ...interface{}) {
+	l.log(SeverityError, msg, keyvals)
+}
+
+func (l *syslogLogger) With(keyvals ...interface{}) server.Logger {
+	return &syslogLogger{
+		writer:  l.writer,
+		level:   l.level,
+		keyvals: append(append([]interface{}{}, l.keyvals...), keyvals...),
+	}
+}
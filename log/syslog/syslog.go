@@ -0,0 +1,251 @@
+// Package syslog sends the logs, the events and the audit trail of the server to syslog, as RFC 5424 messages. The
+// local daemon is reached on its unix socket, the remote ones over UDP or TCP (with the octet counting framing of
+// RFC 6587).
+//
+// A Writer is an io.Writer for the text loggers, and New adapts it to a server.Logger. It's also a server.AuditSink
+// and an events.Publisher, sending the events as JSON.
+package syslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Facility is the syslog facility of the messages
+type Facility int
+
+// These are the facilities a server would use
+const (
+	FacilityDaemon   Facility = 3
+	FacilityAuth     Facility = 4
+	FacilityAuthpriv Facility = 10
+	FacilityLocal0   Facility = 16
+	FacilityLocal1   Facility = 17
+	FacilityLocal2   Facility = 18
+	FacilityLocal3   Facility = 19
+	FacilityLocal4   Facility = 20
+	FacilityLocal5   Facility = 21
+	FacilityLocal6   Facility = 22
+	FacilityLocal7   Facility = 23
+)
+
+// Severity is the syslog severity of a message
+type Severity int
+
+// These are the severities of the messages sent by the server
+const (
+	SeverityError   Severity = 3
+	SeverityWarning Severity = 4
+	SeverityNotice  Severity = 5
+	SeverityInfo    Severity = 6
+	SeverityDebug   Severity = 7
+)
+
+// writeTimeout is the max time a message takes to be sent to a remote daemon
+const writeTimeout = 5 * time.Second
+
+// localSockets are the sockets the local daemons listen on
+var localSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// ErrNoLocalSyslog is returned when no local syslog daemon could be reached
+var ErrNoLocalSyslog = errors.New("no local syslog daemon found")
+
+// Writer sends RFC 5424 messages to a syslog daemon
+type Writer struct {
+	OnError func(err error) // Receives the errors of the audit messages (optional)
+
+	network  string
+	raddr    string
+	facility Facility
+	hostname string
+	appName  string
+	procID   string
+	mutex    sync.Mutex // Protects conn and closed
+	conn     net.Conn
+	closed   bool
+}
+
+// Open creates a writer sending to a destination: "local" (or empty) for the local daemon, "udp://host:port" or
+// "tcp://host:port" for a remote one
+func Open(destination string, facility Facility, appName string) (*Writer, error) {
+	if destination == "" || destination == "local" {
+		return Dial("", "", facility, appName)
+	}
+	spl := strings.SplitN(destination, "://", 2)
+	if len(spl) != 2 || (spl[0] != "udp" && spl[0] != "tcp") {
+		return nil, fmt.Errorf("bad syslog destination %q, expected local, udp://host:port or tcp://host:port",
+			destination)
+	}
+	return Dial(spl[0], spl[1], facility, appName)
+}
+
+// Dial creates a writer sending to the daemon at raddr over network ("udp" or "tcp"), or to the local one if network
+// is empty
+func Dial(network, raddr string, facility Facility, appName string) (*Writer, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &Writer{
+		network:  network,
+		raddr:    raddr,
+		facility: facility,
+		hostname: hostname,
+		appName:  header(appName, 48),
+		procID:   fmt.Sprint(os.Getpid()),
+	}
+	if w.conn, err = w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect opens the connection to the daemon
+func (w *Writer) connect() (net.Conn, error) {
+	if w.network != "" {
+		return net.DialTimeout(w.network, w.raddr, writeTimeout)
+	}
+	for _, path := range localSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, ErrNoLocalSyslog
+}
+
+// header returns a valid header field of a message: printable ASCII without spaces, at most max characters
+func header(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if field == "" {
+		return "-"
+	}
+	if len(field) > max {
+		field = field[:max]
+	}
+	return field
+}
+
+// format formats a message
+func (w *Writer) format(severity Severity, msgID, msg string) string {
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s", int(w.facility)*8+int(severity), timestamp, w.hostname,
+		w.appName, w.procID, header(msgID, 32), msg)
+}
+
+// Send sends a message, identified by msgID (its type, "-" if it has none). A failed connection is opened again
+// once.
+func (w *Writer) Send(severity Severity, msgID, msg string) error {
+	line := w.format(severity, msgID, msg)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+	err := w.write(line)
+	if err == nil {
+		return nil
+	}
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	if w.conn, err = w.connect(); err != nil {
+		return err
+	}
+	return w.write(line)
+}
+
+// write writes a message with the framing of the connection
+func (w *Writer) write(line string) error {
+	if w.conn == nil {
+		return net.ErrClosed
+	}
+	switch w.conn.(type) {
+	case *net.TCPConn:
+		line = fmt.Sprintf("%d %s", len(line), line)
+	case *net.UnixConn:
+		// The stream sockets of the local daemons split the messages on the line feeds
+		if w.conn.RemoteAddr() != nil && w.conn.RemoteAddr().Network() == "unix" {
+			line += "\n"
+		}
+	}
+	if w.network != "" {
+		w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	}
+	_, err := w.conn.Write([]byte(line))
+	return err
+}
+
+// Write sends a line of a text logger, its severity is found from its "level=" key (info if it has none)
+func (w *Writer) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\r\n")
+	if err := w.Send(lineSeverity(line), "-", line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lineSeverity finds the severity of a logfmt or JSON line
+func lineSeverity(line string) Severity {
+	for _, level := range []struct {
+		name     string
+		severity Severity
+	}{
+		{"error", SeverityError},
+		{"warn", SeverityWarning},
+		{"debug", SeverityDebug},
+	} {
+		if strings.Contains(line, "level="+level.name) || strings.Contains(line, `"level":"`+level.name) {
+			return level.severity
+		}
+	}
+	return SeverityInfo
+}
+
+// Publish sends a message of an events.Exporter, the subject is the message ID
+func (w *Writer) Publish(subject string, data []byte) error {
+	return w.Send(SeverityInfo, subject, string(data))
+}
+
+// Audit sends an event of the audit trail, the denials, the failed logins, the bounce attempts, the refused
+// connections and the WORM violations are warnings
+func (w *Writer) Audit(event *server.AuditEvent) {
+	severity := SeverityNotice
+	switch event.Type {
+	case server.AuditLoginFailed, server.AuditPermissionDenied, server.AuditBounceAttempt,
+		server.AuditConnectionRefused, server.AuditWORMViolation:
+		severity = SeverityWarning
+	}
+	data, _ := json.Marshal(event) // The events can always be encoded
+	if err := w.Send(severity, "audit."+string(event.Type), string(data)); err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// Close closes the connection to the daemon
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,118 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// message matches an RFC 5424 message
+var message = regexp.MustCompile(`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z \S+ (\S+) \d+ (\S+) - (.*)$`)
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer conn.Close()
+
+	w, err := Open("udp://"+conn.LocalAddr().String(), FacilityLocal0, "ftp server")
+	if err != nil {
+		t.Fatal("Couldn't open:", err)
+	}
+	defer w.Close()
+
+	receive := func() []string {
+		buf := make([]byte, 2048)
+		n, _, errRead := conn.ReadFrom(buf)
+		if errRead != nil {
+			t.Fatal("Couldn't receive:", errRead)
+		}
+		fields := message.FindStringSubmatch(string(buf[:n]))
+		if fields == nil {
+			t.Fatalf("Bad message: %q", buf[:n])
+		}
+		return fields[1:]
+	}
+
+	logger := New(w, SeverityInfo).With("clientId", 3)
+	logger.Debug("Dropped")
+	logger.Warn("Transfer aborted", "action", "ftp.transfer_abort", "path", "/my file")
+	if fields := receive(); strings.Join(fields, "|") !=
+		`132|ftp_server|ftp.transfer_abort|Transfer aborted clientId=3 action=ftp.transfer_abort path="/my file"` {
+		t.Fatal("Bad log message:", fields)
+	}
+
+	if err = w.Publish("ftp.transfer.upload", []byte(`{"path":"/file"}`)); err != nil {
+		t.Fatal("Couldn't publish:", err)
+	}
+	if fields := receive(); fields[0] != "134" || fields[2] != "ftp.transfer.upload" || fields[3] != `{"path":"/file"}` {
+		t.Fatal("Bad event message:", fields)
+	}
+
+	w.Audit(&server.AuditEvent{Type: server.AuditLogin, User: "user"})
+	if fields := receive(); fields[0] != "133" || fields[2] != "audit.login" {
+		t.Fatal("Bad audit message:", fields)
+	}
+
+	if _, err = w.Write([]byte("level=error msg=failed\n")); err != nil {
+		t.Fatal("Couldn't write:", err)
+	}
+	if fields := receive(); fields[0] != "131" || fields[3] != "level=error msg=failed" {
+		t.Fatal("Bad text message:", fields)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	w, err := Open("tcp://"+listener.Addr().String(), FacilityDaemon, "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't open:", err)
+	}
+	defer w.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal("Couldn't accept:", err)
+	}
+	defer conn.Close()
+
+	// The messages are framed by their length
+	if err = w.Send(SeverityInfo, "-", "hello"); err != nil {
+		t.Fatal("Couldn't send:", err)
+	}
+	reader := bufio.NewReader(conn)
+	prefix, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal("Couldn't read:", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(prefix))
+	if err != nil {
+		t.Fatalf("Bad frame length: %q", prefix)
+	}
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(reader, buf); err != nil {
+		t.Fatal("Couldn't read the message:", err)
+	}
+	if fields := message.FindStringSubmatch(string(buf)); fields == nil || fields[1] != "30" || fields[4] != "hello" {
+		t.Fatalf("Bad message: %q", buf)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, destination := range []string{"http://host", "udp:host"} {
+		if _, err := Open(destination, FacilityDaemon, "ftpserver"); err == nil {
+			t.Fatal("The destination should be refused:", destination)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/fclairamb/ftpserver/log/gokit"
 	"github.com/fclairamb/ftpserver/sample"
 	"github.com/fclairamb/ftpserver/server"
 	"github.com/go-kit/kit/log"
@@ -48,7 +49,9 @@ func main() {
 	driver.Logger = log.With(logger, "component", "driver")
 
 	ftpServer = server.NewFtpServer(driver)
-	ftpServer.Logger = log.With(logger, "component", "server")
+	ftpServer.Logger = gokit.New(log.With(logger, "component", "server"))
+	// If you need to take a bet, amazon is about as reliable & sustainable a service as you can get
+	ftpServer.PublicIPResolver = &server.HTTPIPResolver{URL: "http://checkip.amazonaws.com"}
 
 	go signalHandler()
 
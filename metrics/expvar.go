@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Expvar publishes the metrics with the expvar package, they're served as JSON on /debug/vars by the HTTP servers
+// using http.DefaultServeMux (or expvar.Handler). The published map contains:
+//   - commands and command_errors: the commands executed and the ones with an error reply, by command
+//   - transfers and transfer_errors, bytes: the transfers and their bytes, by direction
+//   - connections, sessions: the accepted connections and the connected clients
+//   - unsupported_commands: the unknown and disabled commands received, by command
+type Expvar struct {
+	commands       *expvar.Map
+	commandErrors  *expvar.Map
+	transfers      *expvar.Map
+	transferErrors *expvar.Map
+	bytes          *expvar.Map
+	connections    *expvar.Int
+	sessions       *expvar.Int
+	unsupported    *expvar.Map
+}
+
+// NewExpvar creates an expvar collector publishing its metrics under name. Like expvar.Publish, it panics if the name
+// is already used.
+func NewExpvar(name string) *Expvar {
+	e := &Expvar{
+		commands:       new(expvar.Map).Init(),
+		commandErrors:  new(expvar.Map).Init(),
+		transfers:      new(expvar.Map).Init(),
+		transferErrors: new(expvar.Map).Init(),
+		bytes:          new(expvar.Map).Init(),
+		connections:    new(expvar.Int),
+		sessions:       new(expvar.Int),
+		unsupported:    new(expvar.Map).Init(),
+	}
+
+	vars := expvar.NewMap(name)
+	vars.Set("commands", e.commands)
+	vars.Set("command_errors", e.commandErrors)
+	vars.Set("transfers", e.transfers)
+	vars.Set("transfer_errors", e.transferErrors)
+	vars.Set("bytes", e.bytes)
+	vars.Set("connections", e.connections)
+	vars.Set("sessions", e.sessions)
+	vars.Set("unsupported_commands", e.unsupported)
+	return e
+}
+
+// CommandExecuted counts the commands
+func (e *Expvar) CommandExecuted(command string, duration time.Duration, code int) {
+	e.commands.Add(command, 1)
+	if code >= 400 {
+		e.commandErrors.Add(command, 1)
+	}
+}
+
+// TransferDone counts the transfers and their bytes
+func (e *Expvar) TransferDone(dir server.TransferDirection, size int64, duration time.Duration, err error) {
+	name := direction(dir)
+	e.transfers.Add(name, 1)
+	e.bytes.Add(name, size)
+	if err != nil {
+		e.transferErrors.Add(name, 1)
+	}
+}
+
+// ClientConnected counts the connections
+func (e *Expvar) ClientConnected(sessions int) {
+	e.connections.Add(1)
+	e.sessions.Set(int64(sessions))
+}
+
+// ClientDisconnected updates the connected clients
+func (e *Expvar) ClientDisconnected(sessions int, duration time.Duration) {
+	e.sessions.Set(int64(sessions))
+}
+
+// UnsupportedCommand counts the unsupported commands
+func (e *Expvar) UnsupportedCommand(command string) {
+	e.unsupported.Add(command, 1)
+}
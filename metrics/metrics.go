@@ -0,0 +1,73 @@
+// Package metrics publishes the activity of the server (commands, transfers and connections) to the monitoring
+// systems: a statsd agent (with the DogStatsD tags) or expvar. The publishers are server.Metrics, and they also
+// implement server.TransferMetrics, server.ConnectionMetrics and server.UnsupportedCommandMetrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Collector collects all the metrics of the server
+type Collector interface {
+	server.Metrics
+	server.TransferMetrics
+	server.ConnectionMetrics
+	server.UnsupportedCommandMetrics
+}
+
+// multiCollector sends the metrics to several collectors
+type multiCollector []Collector
+
+// Multi creates a collector sending the metrics to several collectors
+func Multi(collectors ...Collector) Collector {
+	return multiCollector(collectors)
+}
+
+func (collectors multiCollector) CommandExecuted(command string, duration time.Duration, code int) {
+	for _, collector := range collectors {
+		collector.CommandExecuted(command, duration, code)
+	}
+}
+
+func (collectors multiCollector) TransferDone(direction server.TransferDirection, size int64,
+	duration time.Duration, err error) {
+	for _, collector := range collectors {
+		collector.TransferDone(direction, size, duration, err)
+	}
+}
+
+func (collectors multiCollector) ClientConnected(sessions int) {
+	for _, collector := range collectors {
+		collector.ClientConnected(sessions)
+	}
+}
+
+func (collectors multiCollector) ClientDisconnected(sessions int, duration time.Duration) {
+	for _, collector := range collectors {
+		collector.ClientDisconnected(sessions, duration)
+	}
+}
+
+func (collectors multiCollector) UnsupportedCommand(command string) {
+	for _, collector := range collectors {
+		collector.UnsupportedCommand(command)
+	}
+}
+
+// direction returns the name of a transfer direction
+func direction(direction server.TransferDirection) string {
+	if direction == server.TransferUpload {
+		return "upload"
+	}
+	return "download"
+}
+
+// status returns the status of a transfer
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
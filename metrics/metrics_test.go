@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"errors"
+	"expvar"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func TestStatsd(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer agent.Close()
+
+	statsd, err := NewStatsd(agent.LocalAddr().String(), "ftp", "env:test")
+	if err != nil {
+		t.Fatal("Couldn't create the collector:", err)
+	}
+	defer statsd.Close()
+
+	statsd.CommandExecuted("RETR", 1500*time.Microsecond, 226)
+	statsd.TransferDone(server.TransferUpload, 42, time.Second, errors.New("broken"))
+	statsd.ClientConnected(3)
+	statsd.UnsupportedCommand("SITE QUOTA")
+
+	expected := []string{
+		"ftp.commands:1|c|#env:test,command:RETR,code:226",
+		"ftp.command.duration:1.5|ms|#env:test,command:RETR,code:226",
+		"ftp.transfers:1|c|#env:test,direction:upload,status:error",
+		"ftp.transfer.bytes:42|c|#env:test,direction:upload,status:error",
+		"ftp.transfer.duration:1000|ms|#env:test,direction:upload,status:error",
+		"ftp.connections:1|c|#env:test",
+		"ftp.sessions:3|g|#env:test",
+		"ftp.commands.unsupported:1|c|#env:test,command:SITE_QUOTA",
+	}
+	agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for _, line := range expected {
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			t.Fatal("Couldn't receive the metric:", err)
+		}
+		if string(buf[:n]) != line {
+			t.Fatalf("Wrong metric %q instead of %q", buf[:n], line)
+		}
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	collector := Multi(NewExpvar("ftptest"))
+	collector.CommandExecuted("RETR", time.Millisecond, 226)
+	collector.CommandExecuted("RETR", time.Millisecond, 550)
+	collector.TransferDone(server.TransferDownload, 100, time.Second, nil)
+	collector.TransferDone(server.TransferDownload, 20, time.Second, errors.New("broken"))
+	collector.ClientConnected(2)
+	collector.ClientDisconnected(1, time.Minute)
+	collector.UnsupportedCommand("XCRC")
+
+	vars := expvar.Get("ftptest").(*expvar.Map)
+	for name, expected := range map[string]string{
+		"commands":             `{"RETR": 2}`,
+		"command_errors":       `{"RETR": 1}`,
+		"transfers":            `{"download": 2}`,
+		"transfer_errors":      `{"download": 1}`,
+		"bytes":                `{"download": 120}`,
+		"connections":          "1",
+		"sessions":             "1",
+		"unsupported_commands": `{"XCRC": 1}`,
+	} {
+		if value := strings.TrimSpace(vars.Get(name).String()); value != expected {
+			t.Fatalf("Wrong %s: %s", name, value)
+		}
+	}
+}
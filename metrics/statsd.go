@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// Statsd sends the metrics to a statsd agent over UDP, with the DogStatsD tags. The metrics are:
+//   - <prefix>.commands (counter) and <prefix>.command.duration (timer), tagged with the command and the reply code
+//   - <prefix>.transfers (counter), <prefix>.transfer.bytes (counter) and <prefix>.transfer.duration (timer), tagged
+//     with the direction and the status of the transfer
+//   - <prefix>.connections (counter), <prefix>.sessions (gauge) and <prefix>.session.duration (timer)
+//   - <prefix>.commands.unsupported (counter), tagged with the unknown or disabled command (SITE_QUOTA
+//     for SITE QUOTA)
+//
+// The packets are sent without waiting for the agent, the lost ones are only reported to OnError.
+type Statsd struct {
+	OnError func(err error) // Receives the sending errors (optional)
+
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// NewStatsd creates a statsd collector sending to the agent at address (host:port), the metrics names start with
+// prefix and are tagged with tags ("key:value") in addition to their own tags
+func NewStatsd(address, prefix string, tags ...string) (*Statsd, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Statsd{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// CommandExecuted counts and times the commands
+func (s *Statsd) CommandExecuted(command string, duration time.Duration, code int) {
+	tags := []string{"command:" + command, "code:" + strconv.Itoa(code)}
+	s.send("commands", "1", "c", tags)
+	s.send("command.duration", milliseconds(duration), "ms", tags)
+}
+
+// TransferDone counts the transfers and their bytes
+func (s *Statsd) TransferDone(dir server.TransferDirection, size int64, duration time.Duration, err error) {
+	tags := []string{"direction:" + direction(dir), "status:" + status(err)}
+	s.send("transfers", "1", "c", tags)
+	s.send("transfer.bytes", strconv.FormatInt(size, 10), "c", tags)
+	s.send("transfer.duration", milliseconds(duration), "ms", tags)
+}
+
+// ClientConnected counts the connections
+func (s *Statsd) ClientConnected(sessions int) {
+	s.send("connections", "1", "c", nil)
+	s.send("sessions", strconv.Itoa(sessions), "g", nil)
+}
+
+// ClientDisconnected times the sessions
+func (s *Statsd) ClientDisconnected(sessions int, duration time.Duration) {
+	s.send("sessions", strconv.Itoa(sessions), "g", nil)
+	s.send("session.duration", milliseconds(duration), "ms", nil)
+}
+
+// UnsupportedCommand counts the unsupported commands
+func (s *Statsd) UnsupportedCommand(command string) {
+	s.send("commands.unsupported", "1", "c", []string{"command:" + strings.Replace(command, " ", "_", -1)})
+}
+
+// Close closes the connection to the agent
+func (s *Statsd) Close() error {
+	return s.conn.Close()
+}
+
+// send sends a metric as a "name:value|type|#tags" packet
+func (s *Statsd) send(name, value, metricType string, tags []string) {
+	var packet strings.Builder
+	if s.prefix != "" {
+		packet.WriteString(s.prefix)
+		packet.WriteByte('.')
+	}
+	fmt.Fprintf(&packet, "%s:%s|%s", name, value, metricType)
+	if all := append(append([]string(nil), s.tags...), tags...); len(all) > 0 {
+		packet.WriteString("|#")
+		packet.WriteString(strings.Join(all, ","))
+	}
+
+	if _, err := s.conn.Write([]byte(packet.String())); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// milliseconds formats a duration for the timers
+func milliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds()*1000, 'f', -1, 64)
+}
@@ -0,0 +1,148 @@
+// Package notify provides some notifiers of the uploads, to let other systems react to them without polling
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// SignatureHeader is the header of the HMAC-SHA256 signature of the payloads: "sha256=" followed by its hex value
+const SignatureHeader = "X-Ftpserver-Signature"
+
+// ErrQueueFull is reported when a notification is dropped because the webhook can't keep up
+var ErrQueueFull = errors.New("the upload webhook queue is full, notification dropped")
+
+// Payload is the JSON payload posted to the webhook
+type Payload struct {
+	Time       time.Time `json:"time"`        // End of the upload
+	Session    uint32    `json:"session"`     // ID of the client session
+	SessionUID string    `json:"session_uid"` // Unique ID of the client session
+	User       string    `json:"user"`        // User
+	RemoteAddr string    `json:"remote_addr"` // Address of the client
+	Path       string    `json:"path"`        // Path of the file
+	Size       int64     `json:"size"`        // Number of bytes received
+	Append     bool      `json:"append"`      // The data was appended to the file
+	Algorithm  string    `json:"algorithm"`   // Hash algorithm of the checksum
+	Checksum   string    `json:"checksum"`    // Checksum of the received data (hex)
+	DurationMs int64     `json:"duration_ms"` // Duration of the transfer in milliseconds
+}
+
+// WebhookNotifier posts a JSON payload to a URL after each upload. The notifications are queued and posted in the
+// background, the failed posts are retried with an exponential backoff.
+type WebhookNotifier struct {
+	URL     string          // URL receiving the notifications
+	Secret  []byte          // Key of the HMAC signature of the payloads, no signature if empty
+	Retries int             // Number of retries of the failed posts
+	Backoff time.Duration   // Delay before the first retry, doubled on each retry (1s by default)
+	Client  *http.Client    // HTTP client, a client with a 10s timeout is used by default
+	OnError func(err error) // Receives the notifications given up on (optional)
+
+	queue chan *Payload
+	done  sync.WaitGroup
+}
+
+// NewWebhookNotifier creates a notifier posting to url, with a queue of queueSize notifications
+func NewWebhookNotifier(url string, secret []byte, retries, queueSize int) *WebhookNotifier {
+	notifier := &WebhookNotifier{
+		URL:     url,
+		Secret:  secret,
+		Retries: retries,
+		Backoff: time.Second,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *Payload, queueSize),
+	}
+	notifier.done.Add(1)
+	go notifier.run()
+	return notifier
+}
+
+// UploadSucceeded queues the notification of an upload
+func (notifier *WebhookNotifier) UploadSucceeded(event *server.UploadEvent) {
+	payload := &Payload{
+		Time:       event.Time,
+		Session:    event.SessionID,
+		SessionUID: event.SessionUID,
+		User:       event.User,
+		RemoteAddr: event.RemoteAddr,
+		Path:       event.Path,
+		Size:       event.Size,
+		Append:     event.Append,
+		Algorithm:  event.Algorithm,
+		Checksum:   event.Checksum,
+		DurationMs: int64(event.Duration / time.Millisecond),
+	}
+	select {
+	case notifier.queue <- payload:
+	default:
+		notifier.reportError(ErrQueueFull)
+	}
+}
+
+func (notifier *WebhookNotifier) run() {
+	defer notifier.done.Done()
+	for payload := range notifier.queue {
+		body, _ := json.Marshal(payload) // The payloads can always be encoded
+
+		backoff := notifier.Backoff
+		err := notifier.post(body)
+		for retry := 0; err != nil && retry < notifier.Retries; retry++ {
+			time.Sleep(backoff)
+			backoff *= 2
+			err = notifier.post(body)
+		}
+		if err != nil {
+			notifier.reportError(fmt.Errorf("couldn't notify the upload of %s: %v", payload.Path, err))
+		}
+	}
+}
+
+// Sign computes the signature of a payload, the receivers can check it the same way
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (notifier *WebhookNotifier) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, notifier.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(notifier.Secret) > 0 {
+		request.Header.Set(SignatureHeader, Sign(notifier.Secret, body))
+	}
+
+	response, err := notifier.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("the webhook replied %s", response.Status)
+	}
+	return nil
+}
+
+func (notifier *WebhookNotifier) reportError(err error) {
+	if notifier.OnError != nil {
+		notifier.OnError(err)
+	}
+}
+
+// Close posts the queued notifications and stops the notifier
+func (notifier *WebhookNotifier) Close() error {
+	close(notifier.queue)
+	notifier.done.Wait()
+	return nil
+}
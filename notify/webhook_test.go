@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/server"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("secret")
+	var attempts int
+	received := make(chan Payload, 1)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign(secret, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload Payload
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer hook.Close()
+
+	notifier := NewWebhookNotifier(hook.URL, secret, 3, 10)
+	notifier.Backoff = time.Millisecond
+	notifier.UploadSucceeded(&server.UploadEvent{
+		User:      "alice",
+		Path:      "/file.txt",
+		Size:      42,
+		Algorithm: "sha256",
+		Checksum:  "abcd",
+		Duration:  1500 * time.Millisecond,
+	})
+	notifier.Close()
+
+	select {
+	case payload := <-received:
+		if payload.User != "alice" || payload.Path != "/file.txt" || payload.Size != 42 || payload.Checksum != "abcd" ||
+			payload.DurationMs != 1500 {
+			t.Fatal("Bad payload:", payload)
+		}
+	default:
+		t.Fatal("The upload should have been notified after the retries")
+	}
+}
+
+func TestWebhookNotifierGivesUp(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	var failures []error
+	notifier := NewWebhookNotifier(hook.URL, nil, 1, 10)
+	notifier.Backoff = time.Millisecond
+	notifier.OnError = func(err error) { failures = append(failures, err) }
+	notifier.UploadSucceeded(&server.UploadEvent{Path: "/file.txt"})
+	notifier.Close()
+
+	if len(failures) != 1 {
+		t.Fatal("The failure should have been reported:", failures)
+	}
+}
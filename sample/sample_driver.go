@@ -2,20 +2,18 @@
 package sample
 
 import (
-	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"time"
 
+	ftpconfig "github.com/fclairamb/ftpserver/config"
 	"github.com/fclairamb/ftpserver/server"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/naoina/toml"
 )
 
 // MainDriver defines a very basic serverftp driver
@@ -28,7 +26,7 @@ type MainDriver struct {
 
 // WelcomeUser is called to send the very first welcome message
 func (driver *MainDriver) WelcomeUser(cc server.ClientContext) (string, error) {
-	cc.SetDebug(true)
+	cc.SetLogVerbosity(server.LogCommandsAndReplies)
 	// This will remain the official name for now
 	return fmt.Sprintf("Welcome on ftpserver, you're on dir %s", driver.BaseDir), nil
 }
@@ -39,7 +37,17 @@ func (driver *MainDriver) AuthUser(cc server.ClientContext, user, pass string) (
 		return nil, errors.New("bad username or password")
 	}
 
-	return driver, nil
+	return &ClientDriver{BaseDir: driver.BaseDir}, nil
+}
+
+// ClientDriver handles the file access of a client session
+type ClientDriver struct {
+	BaseDir string // Base directory from which to serve file
+}
+
+// Close is called when the client disconnects
+func (driver *ClientDriver) Close(cc server.ClientContext) error {
+	return nil
 }
 
 // GetTLSConfig returns a TLS Certificate to use
@@ -59,11 +67,13 @@ func (driver *MainDriver) GetTLSConfig() (*tls.Config, error) {
 }
 
 // ChangeDirectory changes the current working directory
-func (driver *MainDriver) ChangeDirectory(cc server.ClientContext, directory string) error {
+func (driver *ClientDriver) ChangeDirectory(cc server.ClientContext, directory string) error {
 	if directory == "/debug" {
-		cc.SetDebug(!cc.Debug())
-		return nil
-	} else if directory == "/virtual" {
+		if cc.LogVerbosity() == server.LogNothing {
+			cc.SetLogVerbosity(server.LogCommandsAndReplies)
+		} else {
+			cc.SetLogVerbosity(server.LogNothing)
+		}
 		return nil
 	}
 	_, err := os.Stat(driver.BaseDir + directory)
@@ -71,44 +81,30 @@ func (driver *MainDriver) ChangeDirectory(cc server.ClientContext, directory str
 }
 
 // MakeDirectory creates a directory
-func (driver *MainDriver) MakeDirectory(cc server.ClientContext, directory string) error {
+func (driver *ClientDriver) MakeDirectory(cc server.ClientContext, directory string) error {
 	return os.Mkdir(driver.BaseDir+directory, 0777)
 }
 
 // ListFiles lists the files of a directory
-func (driver *MainDriver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
-
-	if cc.Path() == "/virtual" {
-		files := make([]os.FileInfo, 0)
-		files = append(files,
-			virtualFileInfo{
-				name: "localpath.txt",
-				mode: os.FileMode(0666),
-				size: 1024,
-			},
-			virtualFileInfo{
-				name: "file2.txt",
-				mode: os.FileMode(0666),
-				size: 2048,
-			},
-		)
-		return files, nil
-	}
-
+func (driver *ClientDriver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
 	path := driver.BaseDir + cc.Path()
 
-	files, err := ioutil.ReadDir(path)
+	return ioutil.ReadDir(path)
+}
 
-	// We add a virtual dir
-	if cc.Path() == "/" && err == nil {
-		files = append(files, virtualFileInfo{
-			name: "virtual",
-			mode: os.FileMode(0666) | os.ModeDir,
-			size: 4096,
-		})
+// VirtualEntries adds a virtual directory, whose files aren't in the base directory
+func (driver *ClientDriver) VirtualEntries(cc server.ClientContext) []*server.VirtualEntry {
+	return []*server.VirtualEntry{
+		{Path: "/virtual", Mode: os.FileMode(0555) | os.ModeDir},
+		{Path: "/virtual/localpath.txt", Mode: os.FileMode(0444), Size: int64(len(driver.BaseDir)),
+			Open: func(cc server.ClientContext) (server.FileStream, error) {
+				return &virtualFile{content: []byte(driver.BaseDir)}, nil
+			}},
+		{Path: "/virtual/file2.txt", Mode: os.FileMode(0444), Size: 2048,
+			Open: func(cc server.ClientContext) (server.FileStream, error) {
+				return &virtualFile{content: make([]byte, 2048)}, nil
+			}},
 	}
-
-	return files, err
 }
 
 // UserLeft is called when the user disconnects, even if he never authenticated
@@ -117,12 +113,7 @@ func (driver *MainDriver) UserLeft(cc server.ClientContext) {
 }
 
 // OpenFile opens a file in 3 possible modes: read, write, appending write (use appropriate flags)
-func (driver *MainDriver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
-
-	if path == "/virtual/localpath.txt" {
-		return &virtualFile{content: []byte(driver.BaseDir)}, nil
-	}
-
+func (driver *ClientDriver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
 	path = driver.BaseDir + path
 
 	// If we are writing and we are not in append mode, we should remove the file
@@ -137,33 +128,38 @@ func (driver *MainDriver) OpenFile(cc server.ClientContext, path string, flag in
 }
 
 // GetFileInfo gets some info around a file or a directory
-func (driver *MainDriver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+func (driver *ClientDriver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
 	path = driver.BaseDir + path
 
 	return os.Stat(path)
 }
 
 // CanAllocate gives the approval to allocate some data
-func (driver *MainDriver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
+func (driver *ClientDriver) CanAllocate(cc server.ClientContext, size int) (bool, error) {
 	return true, nil
 }
 
 // ChmodFile changes the attributes of the file
-func (driver *MainDriver) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
+func (driver *ClientDriver) ChmodFile(cc server.ClientContext, path string, mode os.FileMode) error {
 	path = driver.BaseDir + path
 
 	return os.Chmod(path, mode)
 }
 
+// Chtimes changes the access and modification times of a file
+func (driver *ClientDriver) Chtimes(cc server.ClientContext, path string, atime, mtime time.Time) error {
+	return os.Chtimes(driver.BaseDir+path, atime, mtime)
+}
+
 // DeleteFile deletes a file or a directory
-func (driver *MainDriver) DeleteFile(cc server.ClientContext, path string) error {
+func (driver *ClientDriver) DeleteFile(cc server.ClientContext, path string) error {
 	path = driver.BaseDir + path
 
 	return os.Remove(path)
 }
 
 // RenameFile renames a file or a directory
-func (driver *MainDriver) RenameFile(cc server.ClientContext, from, to string) error {
+func (driver *ClientDriver) RenameFile(cc server.ClientContext, from, to string) error {
 	from = driver.BaseDir + from
 	to = driver.BaseDir + to
 
@@ -172,31 +168,12 @@ func (driver *MainDriver) RenameFile(cc server.ClientContext, from, to string) e
 
 // GetSettings returns some general settings around the server setup
 func (driver *MainDriver) GetSettings() *server.Settings {
-	f, err := os.Open(driver.SettingsFile)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-	buf, err := ioutil.ReadAll(f)
+	config, err := ftpconfig.LoadSettingsFile(driver.SettingsFile)
 	if err != nil {
 		panic(err)
 	}
-	var config server.Settings
-	if err := toml.Unmarshal(buf, &config); err != nil {
-		panic(err)
-	}
-
-	// This is the new IP loading change coming from Ray
-	if config.PublicHost == "" {
-		level.Debug(driver.Logger).Log("msg", "Fetching our external IP address...")
-		if config.PublicHost, err = externalIP(); err != nil {
-			level.Warn(driver.Logger).Log("msg", "Couldn't fetch an external IP", "err", err)
-		} else {
-			level.Debug(driver.Logger).Log("msg", "Fetched our external IP address", "ipAddress", config.PublicHost)
-		}
-	}
 
-	return &config
+	return config
 }
 
 // NewSampleDriver creates a sample driver
@@ -246,49 +223,3 @@ func (f *virtualFile) Seek(n int64, w int) (int64, error) {
 func (f *virtualFile) Write(buffer []byte) (int, error) {
 	return 0, nil
 }
-
-type virtualFileInfo struct {
-	name string
-	size int64
-	mode os.FileMode
-}
-
-func (f virtualFileInfo) Name() string {
-	return f.name
-}
-
-func (f virtualFileInfo) Size() int64 {
-	return f.size
-}
-
-func (f virtualFileInfo) Mode() os.FileMode {
-	return f.mode
-}
-
-func (f virtualFileInfo) IsDir() bool {
-	return f.mode.IsDir()
-}
-
-func (f virtualFileInfo) ModTime() time.Time {
-	return time.Now().UTC()
-}
-
-func (f virtualFileInfo) Sys() interface{} {
-	return nil
-}
-
-func externalIP() (string, error) {
-	// If you need to take a bet, amazon is about as reliable & sustainable a service as you can get
-	rsp, err := http.Get("http://checkip.amazonaws.com")
-	if err != nil {
-		return "", err
-	}
-	defer rsp.Body.Close()
-
-	buf, err := ioutil.ReadAll(rsp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(bytes.TrimSpace(buf)), nil
-}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"hash"
+	"path"
+)
+
+// uploadTempName returns the name a STOR is written to: a temporary one for the atomic and the deduplicated uploads,
+// renamed to path once the transfer succeeds. The resumed uploads are written in place, as their first part is already in the file.
+func (c *clientHandler) uploadTempName(filePath string, append bool) string {
+	if append || c.ctxRest != 0 {
+		return filePath
+	}
+	if namer, ok := c.driver.(UploadTempNamer); ok {
+		if name := namer.UploadTempName(c, filePath); name != "" {
+			return name
+		}
+		return filePath
+	}
+	_, dedup := c.driver.(UploadDeduplicator)
+	if settings := c.daddy.Settings; !dedup && (settings == nil || !settings.AtomicUploads) {
+		return filePath
+	}
+	// A dotfile next to the final one, on the same file system, hidden by the HiddenFiles policies. It's named after
+	// the unique ID of the session, as the other servers of the storage and the next runs count the sessions again.
+	dir, name := path.Split(filePath)
+	return path.Join(dir, fmt.Sprintf(".%s.%s.part", name, c.uid))
+}
+
+// completeUpload renames the temporary file of an atomic upload to its final name, or deletes it if the transfer
+// failed. It returns the error of the transfer, or the one of the rename.
+func (c *clientHandler) completeUpload(tempName, filePath string, size int64, err error) error {
+	if err == nil {
+		if err = c.driver.RenameFile(c, tempName, filePath); err == nil {
+			return nil
+		}
+	}
+	if errDelete := c.driver.DeleteFile(c, tempName); errDelete != nil {
+		c.logger.Warn("Couldn't delete the temporary file of an upload", logKeyAction, "ftp.upload_cleanup",
+			"path", tempName, "err", errDelete)
+		c.trackPartialUpload(tempName, size, err)
+	}
+	return err
+}
+
+// preCommit asks the UploadDeduplicator of the driver if it already has the content of an upload, before its
+// temporary file is renamed
+func (c *clientHandler) preCommit(tempName, filePath string, size int64, algorithm string, hasher hash.Hash) (bool,
+	error) {
+	dedup, ok := c.driver.(UploadDeduplicator)
+	if !ok || hasher == nil {
+		return false, nil
+	}
+	duplicate, err := dedup.PreCommit(c, &UploadCommit{
+		Path:      filePath,
+		TempPath:  tempName,
+		Size:      size,
+		Algorithm: algorithm,
+		Sum:       hasher.Sum(nil),
+	})
+	if duplicate && c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("Duplicate upload", logKeyAction, "ftp.upload_duplicate", "path", filePath, "size", size)
+	}
+	return duplicate && err == nil, err
+}
+
+// discardUpload deletes the temporary file of an upload whose content the driver already had
+func (c *clientHandler) discardUpload(tempName string, size int64) {
+	if err := c.driver.DeleteFile(c, tempName); err != nil {
+		c.logger.Warn("Couldn't delete the temporary file of a duplicate upload", logKeyAction, "ftp.upload_cleanup",
+			"path", tempName, "err", err)
+		c.trackPartialUpload(tempName, size, err)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirDriver stores the files in a directory
+type dirDriver struct {
+	ClientHandlingDriver
+	dir string
+}
+
+func (d *dirDriver) OpenFile(cc ClientContext, path string, flag int) (FileStream, error) {
+	return os.OpenFile(filepath.Join(d.dir, path), flag|os.O_CREATE, 0644)
+}
+
+func (d *dirDriver) RenameFile(cc ClientContext, from, to string) error {
+	return os.Rename(filepath.Join(d.dir, from), filepath.Join(d.dir, to))
+}
+
+func (d *dirDriver) DeleteFile(cc ClientContext, path string) error {
+	return os.Remove(filepath.Join(d.dir, path))
+}
+
+// upload sends some data with a STOR on a pipe
+func upload(c *clientHandler, data []byte) {
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+	c.param = "file"
+	c.handleSTOR()
+}
+
+func TestAtomicUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{AtomicUploads: true}},
+		driver: &dirDriver{dir: dir}, path: "/", id: 7, uid: "c0ffee", logger: nopLogger{}}
+	c.daddy.bufferPool.New = func() interface{} {
+		b := make([]byte, 1024)
+		return &b
+	}
+
+	if name := c.uploadTempName("/dir/file", false); name != "/dir/.file.c0ffee.part" {
+		t.Fatal("Wrong temporary name:", name)
+	}
+	if name := c.uploadTempName("/dir/file", true); name != "/dir/file" {
+		t.Fatal("The appends should be written in place:", name)
+	}
+
+	upload(c, []byte("content"))
+	if data, errRead := ioutil.ReadFile(filepath.Join(dir, "file")); errRead != nil || string(data) != "content" {
+		t.Fatalf("The upload should be renamed to its final name: %q, %v", data, errRead)
+	}
+
+	// A failed upload leaves neither the temporary file nor a partial final one
+	c.session.MaxUploadSize = 4
+	buf.Reset()
+	upload(c, []byte("too large"))
+	if expected := "150 Using transfer connection\r\n552 Transfer aborted: " + ErrUploadSizeExceeded.Error() + "\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "file" {
+		t.Fatal("Only the previous file should remain:", len(files))
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "file")); string(data) != "content" {
+		t.Fatalf("The previous file shouldn't be touched: %q", data)
+	}
+}
+
+// dedupDriver links the uploads to the content it already has
+type dedupDriver struct {
+	dirDriver
+	contents map[string]string // Files by hash of their content
+	commits  []*UploadCommit
+}
+
+func (d *dedupDriver) PreCommit(cc ClientContext, commit *UploadCommit) (bool, error) {
+	d.commits = append(d.commits, commit)
+	existing, ok := d.contents[string(commit.Sum)]
+	if !ok {
+		d.contents[string(commit.Sum)] = commit.Path
+		return false, nil
+	}
+	return true, os.Link(filepath.Join(d.dir, existing), filepath.Join(d.dir, commit.Path))
+}
+
+func TestDeduplicatedUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	driver := &dedupDriver{dirDriver: dirDriver{dir: dir}, contents: make(map[string]string)}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}},
+		driver: driver, path: "/", id: 7, uid: "c0ffee", logger: nopLogger{}}
+	c.daddy.bufferPool.New = func() interface{} {
+		b := make([]byte, 1024)
+		return &b
+	}
+
+	upload(c, []byte("content"))
+	c.param = "copy"
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	go func() {
+		client.Write([]byte("content"))
+		client.Close()
+	}()
+	c.handleSTOR()
+
+	if len(driver.commits) != 2 {
+		t.Fatal("The driver should be asked before each commit:", len(driver.commits))
+	}
+	sum := sha256.Sum256([]byte("content"))
+	if commit := driver.commits[1]; commit.Path != "/copy" || commit.TempPath != "/.copy.c0ffee.part" || commit.Size != 7 ||
+		commit.Algorithm != "sha256" || !bytes.Equal(commit.Sum, sum[:]) {
+		t.Fatal("Bad commit:", commit)
+	}
+	original, _ := os.Stat(filepath.Join(dir, "file"))
+	copied, errStat := os.Stat(filepath.Join(dir, "copy"))
+	if errStat != nil || !os.SameFile(original, copied) {
+		t.Fatal("The duplicate should be linked to the original:", errStat)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatal("The temporary files should be gone:", len(files))
+	}
+	if expected := "150 Using transfer connection\r\n226 Closing transfer connection\r\n"; buf.String() != expected+expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"os"
+	"time"
+)
+
+// AuditEventType is the type of a security-relevant event
+type AuditEventType string
+
+const (
+	// AuditLogin is a successful authentication
+	AuditLogin AuditEventType = "login"
+	// AuditLoginFailed is a failed authentication
+	AuditLoginFailed AuditEventType = "login_failed"
+	// AuditDelete is the deletion of a file or a directory
+	AuditDelete AuditEventType = "delete"
+	// AuditRename is the renaming of a file or a directory
+	AuditRename AuditEventType = "rename"
+	// AuditPermissionDenied is an action refused to the user
+	AuditPermissionDenied AuditEventType = "permission_denied"
+	// AuditBounceAttempt is an active data connection refused because of its target (other host or privileged port)
+	AuditBounceAttempt AuditEventType = "bounce_attempt"
+	// AuditConnectionRefused is a client refused at connection time by a ConnectionChecker
+	AuditConnectionRefused AuditEventType = "connection_refused"
+	// AuditWORMViolation is a modification of a write-once file refused by the WORMPolicy
+	AuditWORMViolation AuditEventType = "worm_violation"
+	// AuditUnsupportedCommand is an unknown or disabled command (Settings.AuditUnsupportedCommands)
+	AuditUnsupportedCommand AuditEventType = "unsupported_command"
+)
+
+// AuditEvent is a security-relevant event
+type AuditEvent struct {
+	Time       time.Time      `json:"time"`             // Time of the event
+	Type       AuditEventType `json:"type"`             // Type of the event
+	SessionID  uint32         `json:"session"`          // ID of the client session
+	SessionUID string         `json:"session_uid"`      // Unique ID of the client session
+	User       string         `json:"user"`             // User, as given by the client
+	RemoteAddr string         `json:"remote_addr"`      // Address of the client
+	Command    string         `json:"command"`          // Command that triggered the event
+	Client     string         `json:"client,omitempty"` // Client software announced with CLNT
+	Path       string         `json:"path,omitempty"`   // Path of the file or directory
+	Target     string         `json:"target,omitempty"` // New path of a renamed file or directory, address of a bounce attempt, unsupported command
+	Error      string         `json:"error,omitempty"`  // Error of the failed actions
+}
+
+// AuditSink is implemented by the audit trails receiving the security-relevant events. The events are reported
+// independently of the logging.
+type AuditSink interface {
+	// Audit records an event
+	Audit(event *AuditEvent)
+}
+
+// isPermissionError tells if an error returned by the driver is a permission denial
+func isPermissionError(err error) bool {
+	return isError(err, ErrPermissionDenied) || os.IsPermission(err)
+}
+
+// audit reports an event of the session to the audit sink
+func (c *clientHandler) audit(eventType AuditEventType, path, target string, err error) {
+	sink := c.daddy.AuditSink
+	if sink == nil {
+		return
+	}
+	event := &AuditEvent{
+		Time:       time.Now(),
+		Type:       eventType,
+		SessionID:  c.id,
+		SessionUID: c.uid,
+		User:       c.User(),
+		RemoteAddr: c.conn.RemoteAddr().String(),
+		Command:    c.command,
+		Client:     c.ClientVersion(),
+		Path:       path,
+		Target:     target,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	sink.Audit(event)
+}
+
+// auditOperation reports an operation of the session, or its denial when the driver refused it for a lack of
+// permission
+func (c *clientHandler) auditOperation(eventType AuditEventType, path, target string, err error) {
+	if err != nil && isPermissionError(err) {
+		eventType = AuditPermissionDenied
+	}
+	c.audit(eventType, path, target, err)
+}
+
+// auditDenial reports the permission denials of the operations not audited otherwise
+func (c *clientHandler) auditDenial(path string, err error) {
+	if err != nil && isPermissionError(err) {
+		c.audit(AuditPermissionDenied, path, "", err)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+// auditRecorder keeps the audited events
+type auditRecorder struct {
+	events []*AuditEvent
+}
+
+func (r *auditRecorder) Audit(event *AuditEvent) {
+	r.events = append(r.events, event)
+}
+
+func TestAuditOperation(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	recorder := &auditRecorder{}
+	c := &clientHandler{daddy: &FtpServer{AuditSink: recorder}, conn: conn, id: 3, command: "DELE"}
+	c.setUser("alice")
+
+	c.auditOperation(AuditDelete, "/file", "", nil)
+	c.auditOperation(AuditDelete, "/other", "", os.ErrPermission)
+	c.auditOperation(AuditDelete, "/missing", "", errors.New("not found"))
+	c.auditDenial("/file", errors.New("not found"))
+
+	if len(recorder.events) != 3 {
+		t.Fatal("Bad number of events:", len(recorder.events))
+	}
+	if e := recorder.events[0]; e.Type != AuditDelete || e.User != "alice" || e.SessionID != 3 || e.Path != "/file" ||
+		e.Command != "DELE" || e.Error != "" {
+		t.Fatal("Bad event:", e)
+	}
+	if e := recorder.events[1]; e.Type != AuditPermissionDenied || e.Error == "" {
+		t.Fatal("The permission error should be audited as a denial:", e)
+	}
+	if e := recorder.events[2]; e.Type != AuditDelete || e.Error != "not found" {
+		t.Fatal("The failed deletion should be audited:", e)
+	}
+}
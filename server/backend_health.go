@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// defaultBackendCheckInterval is the period of the backend checks when Settings.BackendCheckInterval isn't defined
+const defaultBackendCheckInterval = 10 * time.Second
+
+// BackendChecker can be implemented by a MainDriver to report the health of its storage backend (an object store, a
+// network file system...). The server polls it every Settings.BackendCheckInterval: while it fails, the file and
+// transfer commands get a 450 reply instead of hanging until the TCP timeouts, and the server isn't ready.
+type BackendChecker interface {
+	// CheckBackend returns an error if the backend can't be used, it must give up once ctx is done
+	CheckBackend(ctx context.Context) error
+}
+
+// backendState is the result of the last backend check
+type backendState struct {
+	err error // Why the backend is unavailable, nil if it's available
+}
+
+// backendCheckInterval returns the period of the backend checks
+func (server *FtpServer) backendCheckInterval() time.Duration {
+	if server.Settings.BackendCheckInterval > 0 {
+		return time.Duration(server.Settings.BackendCheckInterval) * time.Second
+	}
+	return defaultBackendCheckInterval
+}
+
+// startBackendChecks polls the BackendChecker of the driver, if it has one
+func (server *FtpServer) startBackendChecks() {
+	checker, ok := server.driver.(BackendChecker)
+	if !ok {
+		return
+	}
+
+	done := make(chan struct{})
+	server.backendDone = done
+	interval := server.backendCheckInterval()
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			server.checkBackend(checker, interval)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// checkBackend runs a backend check, the ones taking more than timeout fail
+func (server *FtpServer) checkBackend(checker BackendChecker, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := checker.CheckBackend(ctx)
+
+	previous := server.BackendError()
+	server.backend.Store(&backendState{err: err})
+	switch {
+	case err != nil && previous == nil:
+		server.Logger.Warn("Backend unavailable", logKeyAction, "ftp.backend_down", "err", err)
+		server.setLastError(err)
+	case err == nil && previous != nil:
+		server.Logger.Info("Backend available again", logKeyAction, "ftp.backend_up")
+	}
+}
+
+// BackendError returns why the backend of the driver is unavailable according to its last check, nil if it's
+// available or if the driver isn't a BackendChecker
+func (server *FtpServer) BackendError() error {
+	if state, _ := server.backend.Load().(*backendState); state != nil {
+		return state.err
+	}
+	return nil
+}
+
+// checkBackendAvailable refuses the file and transfer commands while the backend is unavailable. It returns false if
+// the command was refused.
+func (c *clientHandler) checkBackendAvailable() bool {
+	if c.daddy.BackendError() == nil {
+		return true
+	}
+	c.writeMessage(450, "Backend unavailable, try again later")
+	return false
+}
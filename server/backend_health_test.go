@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// backendDriver has a backend failing on demand
+type backendDriver struct {
+	MainDriver
+	err error
+}
+
+func (d *backendDriver) CheckBackend(ctx context.Context) error {
+	return d.err
+}
+
+func TestBackendChecks(t *testing.T) {
+	driver := &backendDriver{err: errors.New("bucket unreachable")}
+	server := &FtpServer{Settings: &Settings{}, driver: driver, Logger: nopLogger{}}
+
+	server.checkBackend(driver, time.Second)
+	if err := server.BackendError(); err != driver.err {
+		t.Fatal("The backend should be unavailable:", err)
+	}
+	if h := server.Health(); h.BackendError != "bucket unreachable" || h.Ready() {
+		t.Fatalf("The server shouldn't be ready: %+v", h)
+	}
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server, driver: &siteDriver{}}
+	c.handleCommand("RETR file\r\n")
+	c.handleCommand("DELE file\r\n")
+	c.handleCommand("NOOP\r\n")
+	if expected := "450 Backend unavailable, try again later\r\n450 Backend unavailable, try again later\r\n200 OK\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+
+	driver.err = nil
+	server.checkBackend(driver, time.Second)
+	if err := server.BackendError(); err != nil {
+		t.Fatal("The backend should be available:", err)
+	}
+	if h := server.Health(); h.BackendError != "" {
+		t.Fatalf("Wrong health: %+v", h)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BandwidthProfile defines the speed of the transfers during a time window of the week, like business hours. The
+// limits of a profile replace the ones of the settings and of the sessions, 0 is unlimited.
+type BandwidthProfile struct {
+	Days              []string // Days of the window, like "Mon" or "saturday" (every day if empty)
+	Start             string   // Start of the window, "HH:MM" in the local time of the server
+	End               string   // End of the window (excluded), before the start for the windows ending the next day
+	DownloadBandwidth int64    // Max download speed of each transfer, in bytes per second (unlimited if 0)
+	UploadBandwidth   int64    // Max upload speed of each transfer, in bytes per second (unlimited if 0)
+}
+
+// BandwidthProvider can be implemented by a ClientHandlingDriver to choose the speed of each transfer when it
+// starts, like from the plan of the user or the load of a backend
+type BandwidthProvider interface {
+	// TransferBandwidth returns the max speed of a transfer in bytes per second (unlimited if 0), or a negative value
+	// to keep the one of the settings, the schedule and the session
+	TransferBandwidth(cc ClientContext, path string, direction TransferDirection) int64
+}
+
+// bandwidthWindow is a parsed BandwidthProfile
+type bandwidthWindow struct {
+	profile *BandwidthProfile
+	days    [7]bool // Days the window starts on, by time.Weekday
+	start   int     // Minutes since midnight
+	end     int     // Minutes since midnight
+}
+
+// bandwidthSchedule is the parsed Settings.BandwidthSchedule, the first matching window applies
+type bandwidthSchedule []*bandwidthWindow
+
+// parseClock parses a "HH:MM" time of the day into minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("bad time of the day %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekday parses the name of a day, its first three letters are enough
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if len(name) >= 3 && strings.HasPrefix(full, name) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("bad day %q", name)
+}
+
+// newBandwidthSchedule parses the profiles of the Settings.BandwidthSchedule, nil if there's none
+func newBandwidthSchedule(profiles []BandwidthProfile) (bandwidthSchedule, error) {
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	schedule := make(bandwidthSchedule, len(profiles))
+	for i := range profiles {
+		profile := &profiles[i]
+		window := &bandwidthWindow{profile: profile}
+		var err error
+		if window.start, err = parseClock(profile.Start); err != nil {
+			return nil, err
+		}
+		if window.end, err = parseClock(profile.End); err != nil {
+			return nil, err
+		}
+		for _, name := range profile.Days {
+			day, err := parseWeekday(name)
+			if err != nil {
+				return nil, err
+			}
+			window.days[day] = true
+		}
+		if len(profile.Days) == 0 {
+			window.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		schedule[i] = window
+	}
+	return schedule, nil
+}
+
+// contains tells if a time is in the window. The part of a window after midnight belongs to the day it started on,
+// a window starting and ending at the same time lasts the whole day.
+func (w *bandwidthWindow) contains(now time.Time) bool {
+	minute, day := now.Hour()*60+now.Minute(), now.Weekday()
+	switch {
+	case w.start < w.end:
+		return w.days[day] && minute >= w.start && minute < w.end
+	case w.start == w.end:
+		return w.days[day]
+	}
+	if minute >= w.start {
+		return w.days[day]
+	}
+	return minute < w.end && w.days[(day+6)%7]
+}
+
+// active returns the profile applying at a time, nil if there's none
+func (s bandwidthSchedule) active(now time.Time) *BandwidthProfile {
+	for _, window := range s {
+		if window.contains(now) {
+			return window.profile
+		}
+	}
+	return nil
+}
+
+// transferBandwidth returns the max speed of a transfer of the session starting now (unlimited if 0): the one of the
+// driver, of the active profile of the schedule, or of the session
+func (c *clientHandler) transferBandwidth(path string, direction TransferDirection) int64 {
+	rate := c.session.DownloadBandwidth
+	if direction == TransferUpload {
+		rate = c.session.UploadBandwidth
+	}
+	if profile := c.daddy.schedule.active(time.Now()); profile != nil {
+		rate = profile.DownloadBandwidth
+		if direction == TransferUpload {
+			rate = profile.UploadBandwidth
+		}
+	}
+	if provider, ok := c.driver.(BandwidthProvider); ok {
+		if custom := provider.TransferBandwidth(c, path, direction); custom >= 0 {
+			rate = custom
+		}
+	}
+	return rate
+}
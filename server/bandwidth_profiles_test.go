@@ -0,0 +1,74 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// bandwidthDriver chooses the speed of the uploads
+type bandwidthDriver struct {
+	ClientHandlingDriver
+	rate int64
+}
+
+func (d *bandwidthDriver) TransferBandwidth(cc ClientContext, path string, direction TransferDirection) int64 {
+	if direction == TransferUpload {
+		return d.rate
+	}
+	return -1
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+	schedule, err := newBandwidthSchedule([]BandwidthProfile{
+		{Days: []string{"Mon", "tuesday"}, Start: "09:00", End: "18:00", DownloadBandwidth: 100},
+		{Days: []string{"Sat"}, Start: "22:00", End: "06:00", DownloadBandwidth: 200},
+		{Start: "00:00", End: "00:00", DownloadBandwidth: 300},
+	})
+	if err != nil {
+		t.Fatal("Couldn't parse the schedule:", err)
+	}
+	// 2024-01-01 is a Monday
+	for date, rate := range map[string]int64{
+		"2024-01-01 09:00": 100,
+		"2024-01-02 17:59": 100,
+		"2024-01-01 18:00": 300,
+		"2024-01-03 10:00": 300,
+		"2024-01-06 23:00": 200,
+		"2024-01-07 05:59": 200,
+		"2024-01-06 05:00": 300,
+	} {
+		now, _ := time.ParseInLocation("2006-01-02 15:04", date, time.Local)
+		if profile := schedule.active(now); profile == nil || profile.DownloadBandwidth != rate {
+			t.Fatal("Wrong profile at", date)
+		}
+	}
+
+	for _, profiles := range [][]BandwidthProfile{
+		{{Start: "9h", End: "18:00"}},
+		{{Start: "09:00", End: "25:00"}},
+		{{Days: []string{"Mo"}, Start: "09:00", End: "18:00"}},
+	} {
+		if _, err := newBandwidthSchedule(profiles); err == nil {
+			t.Fatal("The schedule should be refused:", profiles)
+		}
+	}
+}
+
+func TestTransferBandwidth(t *testing.T) {
+	schedule, _ := newBandwidthSchedule([]BandwidthProfile{{Start: "00:00", End: "00:00", UploadBandwidth: 50}})
+	c := &clientHandler{daddy: &FtpServer{}, driver: &removerDriver{}}
+	c.session.DownloadBandwidth, c.session.UploadBandwidth = 10, 20
+	if c.transferBandwidth("/file", TransferDownload) != 10 || c.transferBandwidth("/file", TransferUpload) != 20 {
+		t.Fatal("The limits of the session should apply")
+	}
+
+	c.daddy.schedule = schedule
+	if c.transferBandwidth("/file", TransferDownload) != 0 || c.transferBandwidth("/file", TransferUpload) != 50 {
+		t.Fatal("The profile should replace the limits of the session")
+	}
+
+	c.driver = &bandwidthDriver{rate: 0}
+	if c.transferBandwidth("/file", TransferDownload) != 0 || c.transferBandwidth("/file", TransferUpload) != 0 {
+		t.Fatal("The driver should choose the upload speed")
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// TransferPriority is the class of a transfer, it decides which transfers are served first when the global bandwidth
+// (Settings.GlobalBandwidth) is saturated
+type TransferPriority int
+
+// These are the priority classes, the drivers set them in the PreTransferHook
+const (
+	PriorityNormal      TransferPriority = iota // Default class
+	PriorityInteractive                         // Small transfers a user is waiting for, served first
+	PriorityBulk                                // Large background transfers, served last
+)
+
+// rank returns the order in which the classes are served
+func (p TransferPriority) rank() int {
+	switch p {
+	case PriorityInteractive:
+		return 0
+	case PriorityBulk:
+		return 2
+	}
+	return 1
+}
+
+// schedulerSlice is how long the transfers wait for the higher priority ones before checking the bandwidth again
+const schedulerSlice = 10 * time.Millisecond
+
+// fairShareIdle is how long a user must have been idle to lose the bandwidth it didn't get, and to be forgotten after
+// a while
+const fairShareIdle = time.Second
+
+// bandwidthScheduler shares a global bandwidth between all the transfers. When it's saturated, the transfers of a
+// priority class wait for the ones of the higher classes to get their data through, and the users of a class are
+// served in turn from the bytes they transferred divided by their weight, whatever their number of transfers.
+type bandwidthScheduler struct {
+	rate    int64                 // Bytes per second
+	mutex   sync.Mutex            // Protects the fields below
+	tokens  float64               // Bytes that can be transferred without waiting, negative when the rate is exceeded
+	updated time.Time             // Last refill of the tokens
+	waiting [3]int                // Transfers waiting for the bandwidth, by rank
+	users   map[string]*fairShare // Accounts of the users, by name
+	pruned  time.Time             // Last cleanup of the accounts of the idle users
+}
+
+// fairShare is the account of a user on the global bandwidth
+type fairShare struct {
+	served  float64   // Bytes transferred divided by the weight of the user
+	waiting [3]int    // Transfers of the user waiting for the bandwidth, by rank
+	active  int       // Transfers of the user waiting for the bandwidth, of any rank
+	seen    time.Time // Last time a transfer of the user was done waiting
+}
+
+// newBandwidthScheduler returns nil without a global rate
+func newBandwidthScheduler(rate int64) *bandwidthScheduler {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthScheduler{rate: rate, updated: time.Now(), users: make(map[string]*fairShare)}
+}
+
+// refill adds the tokens earned since the last refill, the bursts are limited to a tenth of a second of data
+func (s *bandwidthScheduler) refill() {
+	now := time.Now()
+	s.tokens += now.Sub(s.updated).Seconds() * float64(s.rate)
+	if burst := float64(s.rate) / 10; s.tokens > burst {
+		s.tokens = burst
+	}
+	s.updated = now
+}
+
+// higherWaiting tells if some transfers of a higher priority than the rank are waiting for the bandwidth
+func (s *bandwidthScheduler) higherWaiting(rank int) bool {
+	for r := 0; r < rank; r++ {
+		if s.waiting[r] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// aheadWaiting tells if some other users having transfers of the rank waiting for the bandwidth got less of it than a
+// user
+func (s *bandwidthScheduler) aheadWaiting(rank int, share *fairShare) bool {
+	for _, other := range s.users {
+		if other != share && other.waiting[rank] > 0 && other.served < share.served {
+			return true
+		}
+	}
+	return false
+}
+
+// account returns the account of a user starting to wait for the bandwidth. The users coming back from idle start
+// from the least served of the users waiting, they don't get the bandwidth they didn't use.
+func (s *bandwidthScheduler) account(user string) *fairShare {
+	share, ok := s.users[user]
+	if !ok {
+		share = &fairShare{}
+		s.users[user] = share
+	}
+	if share.active == 0 && time.Since(share.seen) > fairShareIdle {
+		least, found := 0.0, false
+		for _, other := range s.users {
+			if other.active > 0 && (!found || other.served < least) {
+				least, found = other.served, true
+			}
+		}
+		if found && least > share.served {
+			share.served = least
+		}
+	}
+	return share
+}
+
+// prune forgets the idle users from time to time
+func (s *bandwidthScheduler) prune() {
+	if time.Since(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = time.Now()
+	for user, share := range s.users {
+		if share.active == 0 && time.Since(share.seen) > fairShareIdle {
+			delete(s.users, user)
+		}
+	}
+}
+
+// transferred waits until the n bytes that were just transferred by a transfer of a user are allowed, the weight is
+// the share of the bandwidth of the user relative to the other ones
+func (s *bandwidthScheduler) transferred(priority TransferPriority, user string, weight int, n int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	rank := priority.rank()
+	s.mutex.Lock()
+	s.prune()
+	share := s.account(user)
+	s.waiting[rank]++
+	share.waiting[rank]++
+	share.active++
+	for {
+		s.refill()
+		if s.tokens > 0 || (!s.higherWaiting(rank) && !s.aheadWaiting(rank, share)) {
+			break
+		}
+		s.mutex.Unlock()
+		time.Sleep(schedulerSlice)
+		s.mutex.Lock()
+	}
+	s.tokens -= float64(n)
+	share.served += float64(n) / float64(weight)
+	var wait time.Duration
+	if s.tokens < 0 {
+		wait = time.Duration(-s.tokens / float64(s.rate) * float64(time.Second))
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(wait)
+
+	s.mutex.Lock()
+	s.waiting[rank]--
+	share.waiting[rank]--
+	share.active--
+	share.seen = time.Now()
+	s.mutex.Unlock()
+}
+
+// bandwidthShare is the throttle of a transfer on the global bandwidth
+type bandwidthShare struct {
+	scheduler *bandwidthScheduler
+	priority  TransferPriority
+	user      string // User whose transfers share the same account
+	weight    int    // Share of the bandwidth of the user relative to the other users
+}
+
+// chunkSize returns a tenth of a second of data, so that the classes are switched often
+func (b *bandwidthShare) chunkSize() int64 {
+	if size := b.scheduler.rate / 10; size > 0 {
+		return size
+	}
+	return 1
+}
+
+func (b *bandwidthShare) transferred(n int) {
+	b.scheduler.transferred(b.priority, b.user, b.weight, n)
+}
+
+// bandwidthShare returns the throttle of the current transfer on the global bandwidth, nil if it isn't limited
+func (c *clientHandler) bandwidthShare() throttle {
+	if c.daddy.bandwidth == nil {
+		return nil
+	}
+	return &bandwidthShare{scheduler: c.daddy.bandwidth, priority: c.xferPrio, user: c.user,
+		weight: c.session.BandwidthWeight}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBandwidthScheduler(t *testing.T) {
+	if newBandwidthScheduler(0) != nil {
+		t.Fatal("There shouldn't be any scheduler without a rate")
+	}
+
+	// The global rate is respected
+	scheduler := newBandwidthScheduler(100 * 1024)
+	var buf bytes.Buffer
+	w := &throttledWriter{writer: &buf, limiter: &bandwidthShare{scheduler: scheduler}}
+	start := time.Now()
+	if _, err := w.Write(make([]byte, 30*1024)); err != nil {
+		t.Fatal("Couldn't write:", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || buf.Len() != 30*1024 {
+		t.Fatal("The write should have been throttled:", elapsed, buf.Len())
+	}
+}
+
+func TestBandwidthPriorities(t *testing.T) {
+	scheduler := newBandwidthScheduler(200 * 1024)
+	var interactive, bulk int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	transfer := func(priority TransferPriority, count *int64) {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			scheduler.transferred(priority, "", 1, 1024)
+			atomic.AddInt64(count, 1024)
+		}
+	}
+
+	wg.Add(2)
+	go transfer(PriorityBulk, &bulk)
+	go transfer(PriorityInteractive, &interactive)
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if interactive <= 2*bulk {
+		t.Fatal("The interactive transfer should be favored:", interactive, bulk)
+	}
+}
+
+func TestBandwidthFairness(t *testing.T) {
+	scheduler := newBandwidthScheduler(200 * 1024)
+	var hog, small, heavy int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	transfer := func(user string, weight int, count *int64) {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			scheduler.transferred(PriorityNormal, user, weight, 1024)
+			atomic.AddInt64(count, 1024)
+		}
+	}
+
+	// A user with many parallel transfers doesn't starve the other ones
+	wg.Add(11)
+	for i := 0; i < 10; i++ {
+		go transfer("hog", 1, &hog)
+	}
+	go transfer("small", 1, &small)
+	time.Sleep(400 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if small*3 < hog {
+		t.Fatal("The users should share the bandwidth:", small, hog)
+	}
+
+	// The users with a heavier weight get more
+	small, stop = 0, make(chan struct{})
+	wg.Add(2)
+	go transfer("heavy", 3, &heavy)
+	go transfer("small", 1, &small)
+	time.Sleep(400 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if heavy < 2*small {
+		t.Fatal("The weights should be observed:", heavy, small)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// neutralWelcome is the welcome message used when the server software shouldn't be disclosed
+const neutralWelcome = "Ready"
+
+// loadBanner returns the banner of the settings, loaded from BannerFile if Banner isn't defined
+func loadBanner(settings *Settings) (string, error) {
+	if settings.Banner != "" || settings.BannerFile == "" {
+		return settings.Banner, nil
+	}
+	content, err := ioutil.ReadFile(settings.BannerFile)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// welcomeMessage returns the 220 reply of the session: the banner with its variables expanded, or the message of
+// the driver. The driver message is replaced with a neutral one when the server software shouldn't be disclosed.
+func (c *clientHandler) welcomeMessage(driverMessage string) string {
+	if c.daddy.banner == "" {
+		if c.daddy.Settings.HideServerInfo {
+			return neutralWelcome
+		}
+		return driverMessage
+	}
+
+	return strings.NewReplacer(
+		"%L", c.conn.LocalAddr().String(),
+		"%R", c.conn.RemoteAddr().String(),
+		"%T", time.Now().UTC().Format(time.RFC1123),
+		"%C", strconv.FormatUint(uint64(c.id), 10),
+		"%%", "%",
+	).Replace(c.daddy.banner)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestLoadBanner(t *testing.T) {
+	file, err := ioutil.TempFile("", "banner")
+	if err != nil {
+		t.Fatal("Couldn't create file:", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("Private server\nSession %C\n")
+	file.Close()
+
+	if banner, err := loadBanner(&Settings{BannerFile: file.Name()}); err != nil || banner != "Private server\nSession %C\n" {
+		t.Fatal("The banner should be loaded from the file:", banner, err)
+	}
+	if banner, _ := loadBanner(&Settings{Banner: "Hello", BannerFile: file.Name()}); banner != "Hello" {
+		t.Fatal("The banner of the settings should be used first:", banner)
+	}
+	if _, err := loadBanner(&Settings{BannerFile: file.Name() + ".missing"}); err == nil {
+		t.Fatal("A missing banner file should be reported")
+	}
+}
+
+func TestWelcomeMessage(t *testing.T) {
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := &clientHandler{
+		id:     42,
+		conn:   server,
+		writer: bufio.NewWriter(&buf),
+		daddy:  &FtpServer{Settings: &Settings{}, banner: "Private server\r\nSession %C (100%%)\n"},
+	}
+	c.writeMultilineMessage(220, c.welcomeMessage("Welcome on ftpserver"))
+	if expected := "220-Private server\r\n220 Session 42 (100%)\r\n"; buf.String() != expected {
+		t.Fatalf("Bad banner: %q", buf.String())
+	}
+
+	c.daddy.banner = ""
+	if msg := c.welcomeMessage("Welcome on ftpserver"); msg != "Welcome on ftpserver" {
+		t.Fatal("The driver message should be used without banner:", msg)
+	}
+	c.daddy.Settings.HideServerInfo = true
+	if msg := c.welcomeMessage("Welcome on ftpserver"); msg != neutralWelcome {
+		t.Fatal("The driver message shouldn't be disclosed:", msg)
+	}
+}
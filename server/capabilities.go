@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability is a set of operations a session can be allowed to perform
+type Capability uint
+
+// These are the capabilities, the commands needing a capability the session doesn't have are refused with a 550
+const (
+	CapDownload Capability = 1 << iota // RETR
+	CapUpload                          // STOR and APPE
+	CapDelete                          // DELE and RMD
+	CapRename                          // RNFR and RNTO
+	CapMkdir                           // MKD
+	CapList                            // LIST, NLST and MLSD
+
+	// CapAll allows every operation
+	CapAll = CapDownload | CapUpload | CapDelete | CapRename | CapMkdir | CapList
+)
+
+// capabilityNames are the names of the capabilities, for the configurations
+var capabilityNames = map[string]Capability{
+	"download": CapDownload,
+	"upload":   CapUpload,
+	"delete":   CapDelete,
+	"rename":   CapRename,
+	"mkdir":    CapMkdir,
+	"list":     CapList,
+	"all":      CapAll,
+}
+
+// commandCapabilities are the capabilities needed by the commands
+var commandCapabilities = map[string]Capability{
+	"RETR": CapDownload,
+	"STOR": CapUpload,
+	"APPE": CapUpload,
+	"DELE": CapDelete,
+	"RMD":  CapDelete,
+	"RNFR": CapRename,
+	"RNTO": CapRename,
+	"MKD":  CapMkdir,
+	"LIST": CapList,
+	"NLST": CapList,
+	"MLSD": CapList,
+}
+
+// ParseCapabilities parses a list of capability names, like "list,download"
+func ParseCapabilities(names string) (Capability, error) {
+	var caps Capability
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		capability, ok := capabilityNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown capability: %s", name)
+		}
+		caps |= capability
+	}
+	return caps, nil
+}
+
+// Has tells if a set contains all the capabilities of another one
+func (caps Capability) Has(other Capability) bool {
+	return caps&other == other
+}
+
+// checkCapability refuses the commands needing a capability the session doesn't have
+func (c *clientHandler) checkCapability() bool {
+	needed, ok := commandCapabilities[c.command]
+	if !ok || c.session.Capabilities == 0 || c.session.Capabilities.Has(needed) {
+		return true
+	}
+	c.writeMessage(550, "Permission denied")
+	return false
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	caps, err := ParseCapabilities("list, Download")
+	if err != nil || caps != CapList|CapDownload {
+		t.Fatal("Bad capabilities:", caps, err)
+	}
+	if caps, err := ParseCapabilities("all"); err != nil || !caps.Has(CapDelete|CapUpload) {
+		t.Fatal("Bad capabilities:", caps, err)
+	}
+	if _, err := ParseCapabilities("list,fly"); err == nil {
+		t.Fatal("Unknown capabilities should be reported")
+	}
+}
+
+func TestCheckCapability(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies)}
+
+	c.command = "DELE"
+	if !c.checkCapability() {
+		t.Fatal("Everything should be allowed by default")
+	}
+
+	c.session.Capabilities = CapList | CapDownload
+	for _, command := range []string{"RETR", "LIST", "MLSD", "PWD", "CWD"} {
+		c.command = command
+		if !c.checkCapability() {
+			t.Fatal(command, "should be allowed")
+		}
+	}
+	for _, command := range []string{"STOR", "APPE", "DELE", "RMD", "RNFR", "MKD"} {
+		c.command = command
+		if c.checkCapability() {
+			t.Fatal(command, "should be refused")
+		}
+	}
+	if reply := replies.String(); !strings.HasPrefix(reply, "550 Permission denied\r\n") {
+		t.Fatal("Bad reply:", reply)
+	}
+}
+
+func TestSTATCapability(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	info, _ := os.Stat(dir)
+
+	// The status of a directory lists it
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}},
+		driver: &dropBoxDriver{info: info}, path: "/", session: SessionSettings{Capabilities: CapDownload}}
+	c.param = "existing"
+	c.handleSTATFile()
+	c.writer.Flush()
+	if reply := replies.String(); reply != "550 Permission denied\r\n" {
+		t.Fatalf("The listing should be refused: %q", reply)
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultCaptureEntries is the number of entries kept by a capture when CaptureOptions.Entries is 0
+	defaultCaptureEntries = 100
+	// defaultCaptureLineLength is the number of bytes kept of each line when CaptureOptions.MaxLineLength is 0
+	defaultCaptureLineLength = 512
+)
+
+// CaptureOptions are the limits of a session capture
+type CaptureOptions struct {
+	Entries       int // Entries kept, the oldest ones are overwritten (100 if 0)
+	MaxLineLength int // Max bytes of each command and reply line, the longer ones are cut and end with "..." (512 if 0)
+	Rate          int // Max entries recorded per second, the next ones are dropped until the next second (unlimited if 0)
+}
+
+// SessionCapture is the content of the capture of a session: its last commands, replies and transfer manifests,
+// the passwords redacted like in the transcripts
+type SessionCapture struct {
+	Started     time.Time          `json:"started"`     // Start of the capture
+	Entries     []*TranscriptEntry `json:"entries"`     // Entries kept, the oldest first
+	Overwritten int64              `json:"overwritten"` // Entries overwritten by the next ones
+	Dropped     int64              `json:"dropped"`     // Entries dropped by the rate limit
+}
+
+// sessionCapture is the ring buffer of a session capture
+type sessionCapture struct {
+	options     CaptureOptions
+	mutex       sync.Mutex
+	started     time.Time
+	ring        []*TranscriptEntry // Entries, the oldest one at next when the ring is full
+	next        int                // Index of the next entry in the ring
+	full        bool               // The ring was filled, the next entries overwrite the oldest ones
+	window      time.Time          // Start of the second of the rate limit
+	inWindow    int                // Entries recorded during this second
+	overwritten int64
+	dropped     int64
+}
+
+func newSessionCapture(options *CaptureOptions) *sessionCapture {
+	capture := &sessionCapture{started: time.Now().UTC()}
+	if options != nil {
+		capture.options = *options
+	}
+	if capture.options.Entries <= 0 {
+		capture.options.Entries = defaultCaptureEntries
+	}
+	if capture.options.MaxLineLength <= 0 {
+		capture.options.MaxLineLength = defaultCaptureLineLength
+	}
+	capture.ring = make([]*TranscriptEntry, capture.options.Entries)
+	return capture
+}
+
+// record adds a copy of an entry to the ring, its line truncated
+func (capture *sessionCapture) record(entry *TranscriptEntry) {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	if capture.options.Rate > 0 {
+		if entry.Time.Sub(capture.window) >= time.Second {
+			capture.window, capture.inWindow = entry.Time, 0
+		}
+		if capture.inWindow >= capture.options.Rate {
+			capture.dropped++
+			return
+		}
+		capture.inWindow++
+	}
+
+	captured := *entry
+	captured.Line = truncateLine(captured.Line, capture.options.MaxLineLength)
+	if capture.full {
+		capture.overwritten++
+	}
+	capture.ring[capture.next] = &captured
+	if capture.next++; capture.next == len(capture.ring) {
+		capture.next, capture.full = 0, true
+	}
+}
+
+// truncateLine cuts a line to max bytes, the marker of its truncation included, without splitting a character
+func truncateLine(line string, max int) string {
+	if len(line) <= max {
+		return line
+	}
+	const marker = "..."
+	cut := max - len(marker)
+	if cut < 0 {
+		cut = max
+	}
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	if cut+len(marker) > max {
+		return line[:cut]
+	}
+	return line[:cut] + marker
+}
+
+// snapshot returns the content of the capture
+func (capture *sessionCapture) snapshot() *SessionCapture {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	snapshot := &SessionCapture{
+		Started:     capture.started,
+		Entries:     make([]*TranscriptEntry, 0, len(capture.ring)),
+		Overwritten: capture.overwritten,
+		Dropped:     capture.dropped,
+	}
+	if capture.full {
+		snapshot.Entries = append(snapshot.Entries, capture.ring[capture.next:]...)
+	}
+	snapshot.Entries = append(snapshot.Entries, capture.ring[:capture.next]...)
+	return snapshot
+}
+
+// getCapture returns the capture of the session, nil if it isn't captured
+func (c *clientHandler) getCapture() *sessionCapture {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.capture
+}
+
+// captureSession returns a live session for its capture
+func (server *FtpServer) captureSession(id uint32) (*clientHandler, error) {
+	server.connectionsMutex.RLock()
+	c, ok := server.connectionsByID[id]
+	server.connectionsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no session with ID %d", id)
+	}
+	return c, nil
+}
+
+// StartCapture starts capturing the commands, replies and transfer manifests of a live session in a ring buffer, to
+// debug a client without the verbose logs of all the sessions. A capture already running is replaced.
+func (server *FtpServer) StartCapture(id uint32, options *CaptureOptions) error {
+	c, err := server.captureSession(id)
+	if err != nil {
+		return err
+	}
+	c.paramsMutex.Lock()
+	c.capture = newSessionCapture(options)
+	c.paramsMutex.Unlock()
+	c.logger.Info("Capture started", logKeyAction, "ftp.capture_start")
+	return nil
+}
+
+// Capture returns the content of the capture of a live session, it returns ErrNoCapture if it isn't captured
+func (server *FtpServer) Capture(id uint32) (*SessionCapture, error) {
+	c, err := server.captureSession(id)
+	if err != nil {
+		return nil, err
+	}
+	capture := c.getCapture()
+	if capture == nil {
+		return nil, ErrNoCapture
+	}
+	return capture.snapshot(), nil
+}
+
+// StopCapture stops the capture of a live session and returns its content, it returns ErrNoCapture if it isn't
+// captured
+func (server *FtpServer) StopCapture(id uint32) (*SessionCapture, error) {
+	c, err := server.captureSession(id)
+	if err != nil {
+		return nil, err
+	}
+	c.paramsMutex.Lock()
+	capture := c.capture
+	c.capture = nil
+	c.paramsMutex.Unlock()
+	if capture == nil {
+		return nil, ErrNoCapture
+	}
+	c.logger.Info("Capture stopped", logKeyAction, "ftp.capture_stop")
+	return capture.snapshot(), nil
+}
+
+// serveCapture manages the captures of the sessions on the debug endpoint
+func (server *FtpServer) serveCapture(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.FormValue("session"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var capture *SessionCapture
+	switch r.Method {
+	case http.MethodGet:
+		capture, err = server.Capture(uint32(id))
+	case http.MethodPost:
+		options := &CaptureOptions{}
+		for param, value := range map[string]*int{
+			"entries":    &options.Entries,
+			"lineLength": &options.MaxLineLength,
+			"rate":       &options.Rate,
+		} {
+			if r.FormValue(param) == "" {
+				continue
+			}
+			if *value, err = strconv.Atoi(r.FormValue(param)); err != nil {
+				http.Error(w, "invalid "+param, http.StatusBadRequest)
+				return
+			}
+		}
+		if err = server.StartCapture(uint32(id), options); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case http.MethodDelete:
+		capture, err = server.StopCapture(uint32(id))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capture)
+}
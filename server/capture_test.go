@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var buf bytes.Buffer
+	server := &FtpServer{Settings: &Settings{}, driver: &factoryDriver{}, connectionsByID: map[uint32]*clientHandler{}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), conn: conn, id: 5, daddy: server, logger: nopLogger{}}
+	server.connectionsByID[c.id] = c
+
+	if _, err := server.Capture(5); err != ErrNoCapture {
+		t.Fatal("The session shouldn't be captured:", err)
+	}
+	if err := server.StartCapture(6, nil); err == nil {
+		t.Fatal("The capture of an unknown session should fail")
+	}
+
+	if err := server.StartCapture(5, &CaptureOptions{Entries: 3, MaxLineLength: 8}); err != nil {
+		t.Fatal("Couldn't start the capture:", err)
+	}
+	c.handleCommand("USER alice\r\n")
+	c.handleCommand("PASS secret\r\n")
+
+	capture, err := server.Capture(5)
+	if err != nil {
+		t.Fatal("Couldn't get the capture:", err)
+	}
+	expected := []string{"331 OK", "PASS ...", "230 P..."}
+	if len(capture.Entries) != len(expected) || capture.Overwritten != 1 {
+		t.Fatalf("Wrong capture: %+v", capture)
+	}
+	for i, entry := range capture.Entries {
+		if entry.Line != expected[i] || len(entry.Line) > 8 || entry.SessionID != 5 {
+			t.Fatalf("Wrong entry %d: %+v", i, entry)
+		}
+	}
+
+	if capture, err = server.StopCapture(5); err != nil || len(capture.Entries) != 3 {
+		t.Fatal("Couldn't stop the capture:", err)
+	}
+	c.handleCommand("USER bob\r\n")
+	if _, err := server.Capture(5); err != ErrNoCapture {
+		t.Fatal("The capture should be stopped:", err)
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		max      int
+		expected string
+	}{
+		{"RETR file", 9, "RETR file"},
+		{"RETR file.txt", 9, "RETR f..."},
+		{"RETR été", 9, "RETR ..."},
+		{"RETR file", 2, "RE"},
+	} {
+		if line := truncateLine(tc.line, tc.max); line != tc.expected {
+			t.Fatalf("Wrong truncation of %q to %d bytes: %q", tc.line, tc.max, line)
+		}
+	}
+}
+
+func TestCaptureRate(t *testing.T) {
+	capture := newSessionCapture(&CaptureOptions{Rate: 2})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		capture.record(&TranscriptEntry{Time: start.Add(time.Duration(i) * 100 * time.Millisecond)})
+	}
+	capture.record(&TranscriptEntry{Time: start.Add(1100 * time.Millisecond)})
+
+	if snapshot := capture.snapshot(); len(snapshot.Entries) != 3 || snapshot.Dropped != 3 {
+		t.Fatalf("Wrong rate limiting: %+v", snapshot)
+	}
+}
+
+func TestCaptureDebugHandler(t *testing.T) {
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{}
+	c := &clientHandler{id: 3, daddy: server, logger: nopLogger{}}
+	server.connectionsByID[c.id] = c
+	handler := server.DebugHandler()
+
+	for _, step := range []struct {
+		method, target string
+		code           int
+	}{
+		{"GET", "/debug/ftp/capture?session=3", http.StatusNotFound},
+		{"POST", "/debug/ftp/capture?session=3&entries=abc", http.StatusBadRequest},
+		{"POST", "/debug/ftp/capture?session=3&entries=10", http.StatusNoContent},
+		{"GET", "/debug/ftp/capture?session=3", http.StatusOK},
+		{"DELETE", "/debug/ftp/capture?session=3", http.StatusOK},
+		{"GET", "/debug/ftp/capture?session=3", http.StatusNotFound},
+		{"GET", "/debug/ftp/capture?session=x", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(step.method, step.target, nil))
+		if rec.Code != step.code {
+			t.Fatal("Bad status for", step.method, step.target, rec.Code)
+		}
+		if rec.Code == http.StatusOK {
+			var capture SessionCapture
+			if err := json.Unmarshal(rec.Body.Bytes(), &capture); err != nil || capture.Started.IsZero() {
+				t.Fatal("Bad capture:", err, rec.Body.String())
+			}
+		}
+	}
+}
@@ -2,53 +2,117 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 )
 
+// closeWriteTimeout is how long Close waits for the last reply to be sent
+const closeWriteTimeout = time.Second
+
 type clientHandler struct {
-	ID          uint32               // ID of the client
-	daddy       *FtpServer           // Server on which the connection was accepted
-	driver      ClientHandlingDriver // Client handling driver
-	conn        net.Conn             // TCP connection
-	writer      *bufio.Writer        // Writer on the TCP connection
-	reader      *bufio.Reader        // Reader on the TCP connection
-	user        string               // Authenticated user
-	path        string               // Current path
-	command     string               // Command received on the connection
-	param       string               // Param of the FTP command
-	connectedAt time.Time            // Date of connection
-	ctxRnfr     string               // Rename from
-	ctxRest     int64                // Restart point
-	debug       bool                 // Show debugging info on the server side
-	transfer    transferHandler      // Transfer connection (only passive is implemented at this stage)
-	transferTLS bool                 // Use TLS for transfer connection
-	logger      log.Logger           // Client handler logging
+	id          uint32                 // ID of the client
+	uid         string                 // Unique ID of the session, across the restarts and the servers
+	daddy       *FtpServer             // Server on which the connection was accepted
+	driver      ClientHandlingDriver   // Client handling driver
+	conn        net.Conn               // TCP connection
+	writer      *bufio.Writer          // Writer on the TCP connection
+	reader      *bufio.Reader          // Reader on the TCP connection
+	user        string                 // Authenticated user
+	host        string                 // Virtual host selected with HOST
+	account     string                 // Account announced with ACCT
+	pendPass    string                 // Password waiting for the account the driver requested to log in
+	challenge   *AuthChallenge         // Authentication challenge waiting for the response of the client
+	clientSoft  string                 // Client software announced with CLNT
+	tlsPrint    string                 // Fingerprint of the TLS ClientHello of the control connection
+	path        string                 // Current path
+	command     string                 // Command received on the connection
+	param       string                 // Param of the FTP command
+	lastCode    int                    // Code of the last reply
+	lastReply   string                 // Message of the last reply
+	connectedAt time.Time              // Date of connection
+	ctxRnfr     string                 // Rename from
+	ctxRnfrInfo os.FileInfo            // Rename from file info
+	ctxRest     int64                  // Restart point
+	ctxRang     int64                  // End of the byte range of the next download, excluded (RANG), 0 if none
+	ctxAllo     int64                  // Size declared for the next upload (ALLO)
+	dataType    string                 // Data representation type (TYPE)
+	lang        string                 // Language selected with LANG (the default one if empty)
+	catalog     Catalog                // Translation of the replies into the language (none if nil)
+	verbosity   int32                  // Logging of the commands and replies (LogVerbosity, atomically accessed)
+	closing     int32                  // The session is being closed by Close (atomically accessed)
+	paramsMutex sync.RWMutex           // Protects the fields accessed from outside the connection goroutine
+	transfer    transferHandler        // Transfer connection (only passive is implemented at this stage)
+	transfers   []transferHandler      // Transfer connections declared and not closed yet
+	transferTLS bool                   // Use TLS for transfer connection
+	dataConn    net.Conn               // Current data connection, nil if none is open (paramsMutex)
+	dataConns   int                    // Number of data connections opened by the session
+	tlsConfig   *tls.Config            // TLS config negotiated on the control connection
+	ticketKey   *[32]byte              // Session ticket key of the client (Settings.TLSSessionReuseRequired), nil if none
+	dataTLS     *tls.Config            // TLS config of the data connections given by a DataTLSConfigProvider
+	controlTLS  bool                   // TLS was negotiated on the control connection
+	tlsDeadline time.Time              // Time the connection is closed at if it isn't secured (Settings.TLSUpgradeTimeout)
+	pbszSet     bool                   // PBSZ was received after the TLS negotiation
+	requirePROT bool                   // Refuse transfers on unprotected data connections
+	session     SessionSettings        // Settings of the session (the server ones overridden by the user ones)
+	allowedCmds map[string]bool        // Commands allowed after the authentication (all of them if nil)
+	cmdLimiter  *commandLimiter        // Rate limiting of the commands (none if nil)
+	loginFails  int                    // Consecutive failed authentications
+	stats       SessionStats           // Activity of the session (paramsMutex)
+	summary     SessionSummary         // Transfers and failures of the session, with a SessionReporter (paramsMutex)
+	tokens      []*DownloadToken       // Download tokens issued by SITE TOKEN (paramsMutex)
+	remoteAddr  string                 // Address of the client (paramsMutex)
+	remoteHost  string                 // Host name of the client found by the reverse lookup (paramsMutex)
+	running     string                 // Command being executed, empty between the commands (paramsMutex)
+	runningAt   time.Time              // Time when the running command started (paramsMutex)
+	dataPorts   []int                  // Passive ports of the declared transfer connections (paramsMutex)
+	xferDone    chan struct{}          // Closed when the last data transfer command ends
+	xferCmd     string                 // Last data transfer command, reported by STAT during the transfer
+	xferCtx     context.Context        // Context of the last data transfer command
+	xferCancel  func()                 // Cancels the context of the last data transfer command
+	xferAbort   error                  // Why the last data transfer was aborted, nil if it wasn't (paramsMutex)
+	xferPrio    TransferPriority       // Priority class of the next data transfer, set by the PreTransferHook
+	xferReq     *TransferRequest       // Next data transfer, described before the transfer connection is opened
+	xferPath    string                 // Path of the file transfer in progress, empty if there's none (paramsMutex)
+	values      map[string]interface{} // Values stored by the driver for the session (paramsMutex)
+	capture     *sessionCapture        // Capture of the session started by FtpServer.StartCapture, nil if none (paramsMutex)
+	loggedIn    bool                   // The user is authenticated (FtpServer.connectionsMutex)
+	writeMutex  sync.Mutex             // Serializes the replies of the control and transfer goroutines
+	logger      Logger                 // Client handler logging
 }
 
 // newClientHandler initializes a client handler when someone connects
 func (server *FtpServer) newClientHandler(connection net.Conn) *clientHandler {
 
-	id := server.clientCounter
-
-	server.clientCounter++
+	id := atomic.AddUint32(&server.clientCounter, 1) - 1
+	uid := newSessionUID()
 
 	p := &clientHandler{
 		daddy:       server,
 		conn:        connection,
-		ID:          id,
+		id:          id,
+		uid:         uid,
 		writer:      bufio.NewWriter(connection),
 		reader:      bufio.NewReader(connection),
 		connectedAt: time.Now().UTC(),
+		remoteAddr:  connection.RemoteAddr().String(),
 		path:        "/",
-		logger:      log.With(server.Logger, "clientId", id),
+		dataType:    "I",
+		requirePROT: server.Settings.ProtectedDataRequired,
+		verbosity:   int32(server.Settings.LogVerbosity),
+		session:     newSessionSettings(server.Settings),
+		cmdLimiter:  newCommandLimiter(server.Settings),
+		logger:      server.Logger.With("clientId", id, "sessionUid", uid),
 	}
 
 	// Just respecting the existing logic here, this could be probably be dropped at some point
@@ -56,94 +120,350 @@ func (server *FtpServer) newClientHandler(connection net.Conn) *clientHandler {
 	return p
 }
 
+// newSessionUID returns a random ID, unique enough to correlate the activity of a session in the aggregated logs of
+// several servers
+func newSessionUID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
 func (c *clientHandler) disconnect() {
 	c.conn.Close()
 }
 
+// Close sends a last reply to the client and closes the connection, see ClientContext.Close
+func (c *clientHandler) Close(code int, message string) error {
+	if code == 0 {
+		code = 421
+	}
+	if code < 400 || code > 599 {
+		return fmt.Errorf("bad reply code to close the session: %d", code)
+	}
+	if message == "" {
+		message = "Closing the connection"
+	}
+	if !atomic.CompareAndSwapInt32(&c.closing, 0, 1) {
+		return nil
+	}
+
+	c.logger.Info("Session closed", logKeyAction, "ftp.session_close", "code", code)
+	// A client not reading its replies can't hold the teardown
+	c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.writeLine(fmt.Sprintf("%d %s", code, strings.NewReplacer("\r", " ", "\n", " ").Replace(message)))
+	c.disconnect()
+	return nil
+}
+
 // Path provides the current working directory of the client
 func (c *clientHandler) Path() string {
 	return c.path
 }
 
-// SetPath changes the current working directory
+// SetPath changes the current working directory, which is kept clean and absolute
 func (c *clientHandler) SetPath(path string) {
-	c.path = path
+	c.path = cleanPath(path)
+}
+
+// ID returns the unique ID of the connection on the server
+func (c *clientHandler) ID() uint32 {
+	return c.id
+}
+
+// SessionUID returns the unique ID of the session
+func (c *clientHandler) SessionUID() string {
+	return c.uid
+}
+
+// dataConnID returns the ID of the last data connection, the session UID followed by its number
+func (c *clientHandler) dataConnID() string {
+	return fmt.Sprintf("%s-%d", c.uid, c.dataConns)
+}
+
+// User returns the user announced on the connection (USER)
+func (c *clientHandler) User() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.user
+}
+
+// Host returns the virtual host selected on the connection (HOST)
+func (c *clientHandler) Host() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.host
+}
+
+// Account returns the account announced on the connection (ACCT)
+func (c *clientHandler) Account() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.account
+}
+
+func (c *clientHandler) setUser(user string) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.user = user
+}
+
+// ClientVersion returns the client software announced with CLNT
+func (c *clientHandler) ClientVersion() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.clientSoft
+}
+
+// TLSFingerprint returns the fingerprint of the TLS ClientHello of the control connection
+func (c *clientHandler) TLSFingerprint() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.tlsPrint
+}
+
+// RemoteAddr returns the address of the client
+func (c *clientHandler) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// clientIP returns the IP of the client, nil if it isn't known
+func (c *clientHandler) clientIP() net.IP {
+	if c.conn == nil {
+		return nil
+	}
+	if addr, ok := c.conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// UserSessions returns the number of the other authenticated sessions of the user
+func (c *clientHandler) UserSessions() int {
+	c.daddy.connectionsMutex.RLock()
+	defer c.daddy.connectionsMutex.RUnlock()
+	return c.daddy.userSessions(c.User(), c)
+}
+
+// LocalAddr returns the address the client connected to
+func (c *clientHandler) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// HasTLSForControl tells if TLS was negotiated on the control connection
+func (c *clientHandler) HasTLSForControl() bool {
+	return c.controlTLS
+}
+
+// TLSConnectionState returns the TLS state of the control connection, nil if there's no TLS handshake yet
+func (c *clientHandler) TLSConnectionState() *tls.ConnectionState {
+	return connectionState(c.conn)
+}
+
+// DataProtection returns the protection level of the data connections
+func (c *clientHandler) DataProtection() string {
+	if c.transferTLS {
+		return "P"
+	}
+	return "C"
+}
+
+// DataTLSConnectionState returns the TLS state of the current data connection, nil if there's none
+func (c *clientHandler) DataTLSConnectionState() *tls.ConnectionState {
+	c.paramsMutex.RLock()
+	conn := c.dataConn
+	c.paramsMutex.RUnlock()
+	return connectionState(conn)
+}
+
+// SetValue stores a value for the session, or deletes it if it's nil
+func (c *clientHandler) SetValue(key string, value interface{}) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	if value == nil {
+		delete(c.values, key)
+		return
+	}
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = value
+}
+
+// GetValue returns the value stored for the session
+func (c *clientHandler) GetValue(key string) interface{} {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.values[key]
 }
 
 // Debug defines if we will list all interaction
 func (c *clientHandler) Debug() bool {
-	return c.debug
+	return c.LogVerbosity() == LogCommandsAndReplies
 }
 
-// SetDebug changes the debug flag
+// SetDebug logs all the commands and replies, or nothing at all
 func (c *clientHandler) SetDebug(debug bool) {
-	c.debug = debug
+	if debug {
+		c.SetLogVerbosity(LogCommandsAndReplies)
+	} else {
+		c.SetLogVerbosity(LogNothing)
+	}
+}
+
+// LogVerbosity returns the logging verbosity of this connection
+func (c *clientHandler) LogVerbosity() LogVerbosity {
+	return LogVerbosity(atomic.LoadInt32(&c.verbosity))
+}
+
+// SetLogVerbosity changes the logging verbosity of this connection.
+// It can be called from any goroutine.
+func (c *clientHandler) SetLogVerbosity(verbosity LogVerbosity) {
+	atomic.StoreInt32(&c.verbosity, int32(verbosity))
+}
+
+// SetProtectedDataRequired changes the data connection protection requirement
+func (c *clientHandler) SetProtectedDataRequired(required bool) {
+	c.requirePROT = required
 }
 
 func (c *clientHandler) end() {
-	if c.transfer != nil {
-		c.transfer.Close()
+	for _, t := range c.transfers {
+		t.Close()
+	}
+	c.transfers = nil
+	c.transfer = nil
+	c.updateDataPorts()
+}
+
+// closeDriver releases the driver of the session
+func (c *clientHandler) closeDriver() {
+	c.daddy.logout(c)
+	closer, ok := c.driver.(ClientDriverCloser)
+	c.driver = nil
+	if !ok {
+		return
+	}
+	if err := closer.Close(c); err != nil {
+		c.logger.Warn("Couldn't close the driver", logKeyAction, "ftp.driver_close", "err", err)
 	}
 }
 
 // HandleCommands reads the stream of commands
 func (c *clientHandler) HandleCommands() {
+	c.labelGoroutine()
 	defer c.daddy.clientDeparture(c)
 	defer c.end()
 
 	if err := c.daddy.clientArrival(c); err != nil {
-		c.writeMessage(500, "Can't accept you - "+err.Error())
+		c.refuseClient(err)
 		return
 	}
 
+	c.lookupRemoteHost()
+	if !c.checkConnection() {
+		return
+	}
+
+	c.emitEvent(EventConnected, "", 0, 0, nil)
+	defer func() {
+		c.emitEvent(EventDisconnected, "", 0, time.Since(c.connectedAt), nil)
+	}()
+
+	defer c.closeDriver()
 	defer c.daddy.driver.UserLeft(c)
+	defer c.revokeDownloadTokens()
+	defer c.reportSession()
+	defer c.endTransfer()
 
 	//fmt.Println(c.id, " Got client on: ", c.ip)
 	if msg, err := c.daddy.driver.WelcomeUser(c); err == nil {
-		c.writeMessage(220, msg)
+		c.writeMultilineMessage(220, c.welcomeMessage(msg))
 	} else {
 		c.writeMessage(500, msg)
 		return
 	}
+	c.startTLSDeadline()
 
 	for {
 		if c.reader == nil {
-			if c.debug {
-				level.Debug(c.logger).Log(logKeyMsg, "Clean disconnect", logKeyAction, "ftp.disconnect", "clean", true)
+			if c.LogVerbosity() >= LogCommands {
+				c.logger.Debug("Clean disconnect", logKeyAction, "ftp.disconnect", "clean", true)
 			}
 			return
 		}
 
-		line, err := c.reader.ReadString('\n')
+		c.setReadDeadline()
+		line, err := readCommandLine(c.reader, c.maxCommandLength())
+
+		if err == ErrCommandTooLong {
+			c.writeMessage(500, "Command line too long")
+			continue
+		}
 
 		if err != nil {
-			if err == io.EOF {
-				if c.debug {
-					level.Debug(c.logger).Log(logKeyMsg, "TCP disconnect", logKeyAction, "ftp.disconnect", "clean", false)
+			if c.isTLSUpgradeTimeout(err) {
+				c.logger.Info("TLS upgrade timeout", logKeyAction, "ftp.tls_timeout", "timeout", c.daddy.Settings.TLSUpgradeTimeout)
+				c.writeMessage(421, "TLS is required, closing the connection")
+			} else if c.isIdleTimeout(err) {
+				c.logger.Info("Idle timeout", logKeyAction, "ftp.idle_timeout", "timeout", c.session.IdleTimeout)
+				c.writeMessage(421, fmt.Sprintf("Closing the connection after %d seconds of inactivity", c.session.IdleTimeout))
+			} else if err == io.EOF {
+				if c.LogVerbosity() >= LogCommands {
+					c.logger.Debug("TCP disconnect", logKeyAction, "ftp.disconnect", "clean", false)
 				}
 			} else {
-				level.Error(c.logger).Log(logKeyMsg, "Read error", logKeyAction, "ftp.read_error", "err", err)
+				c.logger.Error("Read error", logKeyAction, "ftp.read_error", "err", err)
 			}
 			return
 		}
 
-		if c.debug {
-			level.Debug(c.logger).Log(logKeyMsg, "FTP RECV", logKeyAction, "ftp.cmd_recv", "line", line)
-		}
-
 		c.handleCommand(line)
 	}
 }
 
 // handleCommand takes care of executing the received line
 func (c *clientHandler) handleCommand(line string) {
-	command, param := parseLine(line)
-	c.command = strings.ToUpper(command)
+	command, param, err := ParseCommand(line, c.maxCommandLength())
+	if err == ErrCommandTooLong {
+		c.writeMessage(500, "Command line too long")
+		return
+	}
+	if err != nil {
+		c.writeMessage(501, "Illegal character in the command line")
+		return
+	}
+	c.transcriptCommand(command, param)
+
+	if c.transferInProgress() {
+		if c.handleDuringTransfer(command, param) {
+			return
+		}
+		c.waitTransfer()
+	}
+
+	c.command = command
 	c.param = param
 
+	if c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("FTP RECV", logKeyAction, "ftp.cmd_recv", "command", c.command, "param", c.loggableParam())
+	}
+
+	if !c.checkCommandRate() {
+		return
+	}
+
+	if c.daddy.commandDisabled(c.command, c.param) {
+		c.unsupportedCommand(c.command, c.command == "SITE" && !c.daddy.disabledCmds["SITE"])
+		c.writeMessage(502, c.unsupportedReply(true))
+		return
+	}
+
 	cmdDesc := commandsMap[c.command]
 	if cmdDesc == nil {
-		c.writeMessage(500, "Unknown command")
+		c.unsupportedCommand(c.command, false)
+		c.writeMessage(500, c.unsupportedReply(false))
 		return
 	}
 
@@ -152,6 +472,41 @@ func (c *clientHandler) handleCommand(line string) {
 		return
 	}
 
+	if !c.commandAllowed(c.command, cmdDesc) {
+		c.audit(AuditPermissionDenied, "", "", nil)
+		c.writeMessage(550, "Command not allowed")
+		return
+	}
+
+	if !c.checkCapability() || !c.checkDropBox() {
+		c.audit(AuditPermissionDenied, "", "", nil)
+		return
+	}
+
+	if cmdDesc.Path && !c.checkHiddenAccess() {
+		c.audit(AuditPermissionDenied, c.absPath(c.param), "", nil)
+		return
+	}
+
+	if (cmdDesc.Path || cmdDesc.Transfer) && !c.checkBackendAvailable() {
+		return
+	}
+
+	if cmdDesc.Transfer {
+		c.startTransfer(cmdDesc)
+		return
+	}
+
+	c.executeCommand(cmdDesc)
+}
+
+// executeCommand runs the handler of the current command
+func (c *clientHandler) executeCommand(cmdDesc *CommandDescription) {
+	c.setRunning(c.command)
+	defer c.setRunning("")
+	defer c.commandExecuted(time.Now())
+	defer c.invalidateListings()
+
 	// Let's prepare to recover in case there's a command error
 	defer func() {
 		if r := recover(); r != nil {
@@ -161,47 +516,183 @@ func (c *clientHandler) handleCommand(line string) {
 	cmdDesc.Fn(c)
 }
 
+// commandExecuted reports the execution of the current command to the metrics and the driver
+func (c *clientHandler) commandExecuted(start time.Time) {
+	duration := time.Since(start)
+	c.countCommand(c.lastCode)
+	c.recordFailure(c.lastCode, c.lastReply)
+
+	if metrics, ok := c.daddy.Metrics.(SessionMetrics); ok {
+		metrics.SessionCommandExecuted(c.uid, c.command, duration, c.lastCode)
+	} else if metrics := c.daddy.Metrics; metrics != nil {
+		metrics.CommandExecuted(c.command, duration, c.lastCode)
+	}
+
+	if observer, ok := c.daddy.driver.(CommandObserver); ok {
+		observer.CommandExecuted(c, &CommandExecution{
+			Command:  c.command,
+			Param:    c.loggableParam(),
+			Duration: duration,
+			Code:     c.lastCode,
+		})
+	}
+}
+
+// loggableParam returns the param of the current command with the sensitive ones redacted
+func (c *clientHandler) loggableParam() string {
+	if redactedCommands[c.command] && c.param != "" {
+		return "****"
+	}
+	return c.param
+}
+
 func (c *clientHandler) writeLine(line string) {
-	if c.debug {
-		level.Debug(c.logger).Log(logKeyMsg, "FTP SEND", logKeyAction, "ftp.cmd_send", "line", line)
+	if c.LogVerbosity() >= LogCommandsAndReplies {
+		c.logger.Debug("FTP SEND", logKeyAction, "ftp.cmd_send", "line", line)
 	}
+	c.transcript(&TranscriptEntry{Type: TranscriptReply, Line: line})
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
 	c.writer.Write([]byte(line))
 	c.writer.Write([]byte("\r\n"))
 	c.writer.Flush()
 }
 
 func (c *clientHandler) writeMessage(code int, message string) {
+	c.lastCode = code
+	if c.catalog != nil {
+		message = c.catalog.Translate(code, message)
+	}
+	c.lastReply = message
 	c.writeLine(fmt.Sprintf("%d %s", code, message))
 }
 
+// writeMultilineMessage sends a reply of one or more lines, the first ones with "code-" and the last one with "code "
+func (c *clientHandler) writeMultilineMessage(code int, message string) {
+	lines := strings.Split(strings.TrimRight(strings.Replace(message, "\r", "", -1), "\n"), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		c.writeLine(fmt.Sprintf("%d-%s", code, line))
+	}
+	c.writeMessage(code, lines[len(lines)-1])
+}
+
 func (c *clientHandler) TransferOpen() (net.Conn, error) {
 	if c.transfer == nil {
 		c.writeMessage(550, "No passive connection declared")
 		return nil, errors.New("no passive connection declared")
 	}
+	if !c.checkDataProtection() {
+		return nil, errors.New("unprotected data connection refused")
+	}
 	c.writeMessage(150, "Using transfer connection")
 	conn, err := c.transfer.Open()
-	if err == nil && c.debug {
-		level.Debug(c.logger).Log(logKeyMsg, "FTP Transfer connection opened", logKeyAction, "ftp.transfer_open", "remoteAddr", conn.RemoteAddr().String(), "localAddr", conn.LocalAddr().String())
+	if err == nil && c.xferCtx != nil {
+		// Aborting the transfer interrupts the reads and writes on the data connection
+		ctx := c.xferCtx
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+	}
+	if err == nil {
+		c.dataConns++
+		c.daddy.tuneDataConn(conn)
+		c.setDataConn(conn)
+	}
+	if err == nil && c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("FTP Transfer connection opened", logKeyAction, "ftp.transfer_open", "dataConnId", c.dataConnID(), "remoteAddr", conn.RemoteAddr().String(), "localAddr", conn.LocalAddr().String())
+	}
+	if err == nil && c.transferTLS && c.daddy.Settings.TLSSessionReuseRequired {
+		if err = checkTLSSessionReuse(conn); err != nil {
+			c.logger.Warn("TLS session reuse check failed", logKeyAction, "ftp.transfer_tls_reuse", "err", err)
+			c.writeMessage(522, "TLS session reuse required on data connections")
+			c.closeTransfer(c.transfer)
+			return nil, err
+		}
 	}
 	return conn, err
 }
 
+func (c *clientHandler) setDataConn(conn net.Conn) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.dataConn = conn
+}
+
+// checkDataProtection makes sure the data connection is protected if it's required
+func (c *clientHandler) checkDataProtection() bool {
+	if c.requirePROT && !c.transferTLS {
+		c.writeMessage(521, "Data connections must be protected, use PROT P")
+		return false
+	}
+	return true
+}
+
+// checkPathProtection makes sure the data connection is protected if the driver requires it for a path
+func (c *clientHandler) checkPathProtection(path string) bool {
+	if c.transferTLS {
+		return true
+	}
+	if policy, ok := c.driver.(ProtectionPolicy); ok && policy.ProtectedDataRequired(c, path) {
+		c.writeMessage(521, "Data connections must be protected for this path, use PROT P")
+		return false
+	}
+	return true
+}
+
 func (c *clientHandler) TransferClose() {
+	c.transferCloseWith(226, "Closing transfer connection")
+}
+
+// transferCloseWith closes the transfer connection with a specific reply
+func (c *clientHandler) transferCloseWith(code int, message string) {
+	if c.abortCause() != nil {
+		code, message = 426, "Transfer aborted"
+	}
 	if c.transfer != nil {
-		c.writeMessage(226, "Closing transfer connection")
-		c.transfer.Close()
-		c.transfer = nil
-		if c.debug {
-			level.Debug(c.logger).Log(logKeyMsg, "FTP Transfer connection closed", logKeyAction, "ftp.transfer_close")
+		c.writeMessage(code, message)
+		c.closeTransfer(c.transfer)
+		c.setDataConn(nil)
+		if c.LogVerbosity() >= LogCommands {
+			c.logger.Debug("FTP Transfer connection closed", logKeyAction, "ftp.transfer_close")
 		}
 	}
 }
 
-func parseLine(line string) (string, string) {
-	params := strings.SplitN(strings.Trim(line, "\r\n"), " ", 2)
-	if len(params) == 1 {
-		return params[0], ""
+// canDeclareTransfer checks if the session is allowed to declare one more transfer connection
+func (c *clientHandler) canDeclareTransfer() bool {
+	max := c.daddy.Settings.MaxDataConnections
+	if max <= 0 || len(c.transfers) < max {
+		return true
+	}
+
+	if c.daddy.Settings.DataConnectionsPolicy == DataConnectionsCloseOldest {
+		c.closeTransfer(c.transfers[0])
+		return true
+	}
+
+	c.writeMessage(425, fmt.Sprintf("Too many data connections (%d)", max))
+	return false
+}
+
+// declareTransfer defines the transfer connection to use for the next data command
+func (c *clientHandler) declareTransfer(t transferHandler) {
+	c.transfers = append(c.transfers, t)
+	c.transfer = t
+	c.updateDataPorts()
+}
+
+// closeTransfer closes a transfer connection and forgets about it
+func (c *clientHandler) closeTransfer(t transferHandler) {
+	t.Close()
+	for i, declared := range c.transfers {
+		if declared == t {
+			c.transfers = append(c.transfers[:i], c.transfers[i+1:]...)
+			break
+		}
+	}
+	if c.transfer == t {
+		c.transfer = nil
 	}
-	return params[0], params[1]
+	c.updateDataPorts()
 }
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionValues(t *testing.T) {
+	c := &clientHandler{}
+	if c.GetValue("tenant") != nil {
+		t.Fatal("No value should be stored yet")
+	}
+
+	c.SetValue("tenant", "acme")
+	c.SetValue("claims", []string{"read"})
+	if c.GetValue("tenant") != "acme" || len(c.GetValue("claims").([]string)) != 1 {
+		t.Fatal("The values should be stored:", c.values)
+	}
+
+	c.SetValue("tenant", nil)
+	if c.GetValue("tenant") != nil || len(c.values) != 1 {
+		t.Fatal("The value should be deleted:", c.values)
+	}
+}
+
+// sessionMetrics records the sessions of the commands
+type sessionMetrics struct {
+	Metrics
+	sessions []string
+}
+
+func (m *sessionMetrics) SessionCommandExecuted(sessionUID, command string, duration time.Duration, code int) {
+	m.sessions = append(m.sessions, sessionUID)
+}
+
+func TestSessionUID(t *testing.T) {
+	uid := newSessionUID()
+	if len(uid) != 16 || uid == newSessionUID() {
+		t.Fatal("Bad session UID:", uid)
+	}
+
+	metrics := &sessionMetrics{}
+	c := &clientHandler{uid: uid, daddy: &FtpServer{Metrics: metrics}, dataConns: 2}
+	if c.SessionUID() != uid || c.dataConnID() != uid+"-2" {
+		t.Fatal("Bad IDs:", c.SessionUID(), c.dataConnID())
+	}
+	c.commandExecuted(time.Now())
+	if len(metrics.sessions) != 1 || metrics.sessions[0] != uid {
+		t.Fatal("The command should be labeled with the session:", metrics.sessions)
+	}
+}
+
+// selfSignedConfig creates a TLS config with a throwaway certificate
+func selfSignedConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Couldn't generate the key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Couldn't create the certificate:", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// commandMetrics records the executed commands
+type commandMetrics struct {
+	commands []string
+}
+
+func (m *commandMetrics) CommandExecuted(command string, duration time.Duration, code int) {
+	m.commands = append(m.commands, fmt.Sprintf("%s %d", command, code))
+}
+
+// observerDriver records the executed commands
+type observerDriver struct {
+	MainDriver
+	executions []*CommandExecution
+}
+
+func (d *observerDriver) CommandExecuted(cc ClientContext, execution *CommandExecution) {
+	d.executions = append(d.executions, execution)
+}
+
+func TestCommandObserver(t *testing.T) {
+	var buf bytes.Buffer
+	metrics, driver := &commandMetrics{}, &observerDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, Metrics: metrics,
+		driver: driver}, logger: nopLogger{}}
+
+	c.handleCommand("FOO bar\r\n")
+	c.handleCommand("NOOP\r\n")
+	c.handleCommand("noop\r\n")
+	if strings.Join(metrics.commands, ",") != "NOOP 200,NOOP 200" {
+		t.Fatal("The known commands should be measured:", metrics.commands)
+	}
+	if len(driver.executions) != 2 || driver.executions[1].Command != "NOOP" || driver.executions[1].Code != 200 ||
+		driver.executions[1].Duration < 0 {
+		t.Fatal("The driver should observe the known commands:", driver.executions)
+	}
+}
+
+func TestConnectionState(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := &clientHandler{conn: server}
+	if c.RemoteAddr() != server.RemoteAddr() || c.LocalAddr() != server.LocalAddr() {
+		t.Fatal("The addresses of the connection should be returned")
+	}
+	if c.HasTLSForControl() || c.TLSConnectionState() != nil {
+		t.Fatal("There shouldn't be any TLS state")
+	}
+
+	c.conn = tls.Server(server, selfSignedConfig(t))
+	c.controlTLS = true
+	if c.TLSConnectionState() != nil {
+		t.Fatal("There shouldn't be any TLS state before the handshake")
+	}
+
+	tlsClient := tls.Client(client, &tls.Config{InsecureSkipVerify: true})
+	go tlsClient.Handshake()
+	if err := c.conn.(*tls.Conn).Handshake(); err != nil {
+		t.Fatal("Couldn't negotiate TLS:", err)
+	}
+	if state := c.TLSConnectionState(); !c.HasTLSForControl() || state == nil || state.Version == 0 ||
+		state.CipherSuite == 0 {
+		t.Fatal("The TLS state should be returned:", state)
+	}
+}
+
+func TestClose(t *testing.T) {
+	server, client := net.Pipe()
+	c := &clientHandler{conn: server, writer: bufio.NewWriter(server), logger: nopLogger{}}
+
+	if err := c.Close(250, "Bye"); err == nil {
+		t.Fatal("A success code should be refused")
+	}
+
+	go c.Close(530, "Abuse detected\r\nbye")
+	data, err := ioutil.ReadAll(client)
+	if err != nil || string(data) != "530 Abuse detected  bye\r\n" {
+		t.Fatalf("Wrong reply: %q %v", data, err)
+	}
+	if err := c.Close(0, ""); err != nil {
+		t.Fatal("A closed session can be closed again:", err)
+	}
+}
+
+// closableTransfer records its closing
+type closableTransfer struct {
+	closed bool
+}
+
+func (t *closableTransfer) Open() (net.Conn, error) { return nil, errors.New("not connected") }
+
+func (t *closableTransfer) Close() error {
+	t.closed = true
+	return nil
+}
+
+func TestMaxDataConnections(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{MaxDataConnections: 2}}}
+	first, second := &closableTransfer{}, &closableTransfer{}
+	c.declareTransfer(first)
+	c.declareTransfer(second)
+
+	if c.canDeclareTransfer() {
+		t.Fatal("A third data connection should be refused")
+	}
+	c.writer.Flush()
+	if buf.String() != "425 Too many data connections (2)\r\n" || first.closed || second.closed {
+		t.Fatalf("Wrong refusal: %q", buf.String())
+	}
+
+	// The oldest one makes room for the new one
+	c.daddy.Settings.DataConnectionsPolicy = DataConnectionsCloseOldest
+	if !c.canDeclareTransfer() || !first.closed || second.closed || len(c.transfers) != 1 || c.transfer != second {
+		t.Fatal("The oldest data connection should be closed:", first.closed, second.closed, len(c.transfers))
+	}
+
+	c.end()
+	if !second.closed || c.transfers != nil || c.transfer != nil {
+		t.Fatal("The data connections should be closed at the end of the session")
+	}
+}
+
+// recordingLogger records its debugging logs
+type recordingLogger struct {
+	nopLogger
+	logs *[]string
+}
+
+func (l recordingLogger) Debug(msg string, keyvals ...interface{}) {
+	*l.logs = append(*l.logs, fmt.Sprint(append([]interface{}{msg}, keyvals...)...))
+}
+
+func (l recordingLogger) With(...interface{}) Logger {
+	return l
+}
+
+func TestLogVerbosity(t *testing.T) {
+	var buf bytes.Buffer
+	var logs []string
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, driver: &factoryDriver{}},
+		logger: recordingLogger{logs: &logs}}
+
+	c.handleCommand("NOOP\r\n")
+	if len(logs) != 0 {
+		t.Fatal("Nothing should be logged by default:", logs)
+	}
+
+	// The passwords are never logged
+	c.SetLogVerbosity(LogCommands)
+	c.handleCommand("PASS secret\r\n")
+	if len(logs) != 1 || !strings.Contains(logs[0], "FTP RECV") || strings.Contains(logs[0], "secret") ||
+		!strings.Contains(logs[0], "****") {
+		t.Fatal("The command should be logged without its password:", logs)
+	}
+
+	logs = nil
+	c.SetLogVerbosity(LogCommandsAndReplies)
+	c.handleCommand("NOOP\r\n")
+	if len(logs) != 2 || !strings.Contains(logs[0], "FTP RECV") || !strings.Contains(logs[1], "FTP SEND") ||
+		!c.Debug() {
+		t.Fatal("The command and its reply should be logged:", logs)
+	}
+}
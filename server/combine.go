@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseCombineArgs splits the arguments of COMB: paths in double quotes (which can contain spaces) or separated by
+// spaces
+func parseCombineArgs(param string) ([]string, error) {
+	var args []string
+	for param = strings.TrimSpace(param); param != ""; param = strings.TrimSpace(param) {
+		if param[0] != '"' {
+			end := strings.IndexByte(param, ' ')
+			if end < 0 {
+				end = len(param)
+			}
+			args = append(args, param[:end])
+			param = param[end:]
+			continue
+		}
+
+		end := strings.IndexByte(param[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated quote")
+		}
+		args = append(args, param[1:end+1])
+		param = param[end+2:]
+	}
+	return args, nil
+}
+
+// handleCOMB combines the parts of a segmented upload into the target file: COMB <target> <part> [<part>...]
+func (c *clientHandler) handleCOMB() {
+	c.combineFiles(c.param)
+}
+
+// combineFiles is the implementation of COMB and SITE COMBINE
+func (c *clientHandler) combineFiles(param string) {
+	args, err := parseCombineArgs(param)
+	if err == nil && len(args) < 2 {
+		err = errors.New("a target and at least one part are expected")
+	}
+	if err != nil {
+		c.writeMessage(501, fmt.Sprintf("Syntax error: %v", err))
+		return
+	}
+
+	if caps := c.session.Capabilities; caps != 0 && !caps.Has(CapUpload|CapDelete) {
+		c.audit(AuditPermissionDenied, "", "", nil)
+		c.writeMessage(550, "Permission denied")
+		return
+	}
+
+	paths := make([]string, len(args))
+	for i, arg := range args {
+		paths[i] = c.absPath(arg)
+		if !c.checkHiddenPath(paths[i]) || !c.checkUploadManifest(paths[i]) {
+			return
+		}
+	}
+
+	target, parts := paths[0], paths[1:]
+	if !c.checkFileName(target) {
+		return
+	}
+	// The target is overwritten and the parts are deleted
+	for _, p := range paths {
+		if !c.checkWORM(p) || !c.checkUploadLock(p) {
+			return
+		}
+	}
+
+	if combiner, ok := c.driver.(FileCombiner); ok {
+		err = combiner.CombineFiles(c, target, parts)
+	} else {
+		err = c.concatenateFiles(target, parts)
+	}
+
+	if err != nil {
+		c.auditDenial(target, err)
+		c.writeError(550, fmt.Sprintf("Couldn't combine %s: %v", target, err), err)
+		return
+	}
+	c.writeMessage(250, "COMB successful")
+}
+
+// concatenateFiles combines the parts through the server when the driver isn't a FileCombiner. The target can be the
+// first part, the other ones are then appended to it.
+func (c *clientHandler) concatenateFiles(target string, parts []string) error {
+	flag := os.O_WRONLY
+	if parts[0] == target {
+		flag |= os.O_APPEND
+		parts = parts[1:]
+	}
+
+	file, err := c.driver.OpenFile(c, target, flag)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if err = c.appendPart(file, part); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if err = c.driver.DeleteFile(c, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPart copies a part at the end of the target
+func (c *clientHandler) appendPart(target FileStream, part string) error {
+	file, err := c.driver.OpenFile(c, part, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = c.daddy.copyStream(target, file)
+	return err
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseCombineArgs(t *testing.T) {
+	args, err := parseCombineArgs(`"my file.bin" part1  "part 2"`)
+	if err != nil || !reflect.DeepEqual(args, []string{"my file.bin", "part1", "part 2"}) {
+		t.Fatal("Bad args:", args, err)
+	}
+	if _, err = parseCombineArgs(`"file part1`); err == nil {
+		t.Fatal("The unterminated quotes should be refused")
+	}
+}
+
+// bufferFile is a file of a combineDriver
+type bufferFile struct {
+	FileStream
+	*bytes.Buffer
+}
+
+func (f *bufferFile) Read(p []byte) (int, error) { return f.Buffer.Read(p) }
+
+func (f *bufferFile) Write(p []byte) (int, error) { return f.Buffer.Write(p) }
+
+func (f *bufferFile) Close() error { return nil }
+
+// combineDriver keeps its files in memory
+type combineDriver struct {
+	ClientHandlingDriver
+	files map[string]*bytes.Buffer
+}
+
+func (d *combineDriver) OpenFile(cc ClientContext, path string, flag int) (FileStream, error) {
+	if flag == os.O_RDONLY {
+		if content, ok := d.files[path]; ok {
+			return &bufferFile{Buffer: bytes.NewBuffer(content.Bytes())}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	if flag&os.O_APPEND == 0 || d.files[path] == nil {
+		d.files[path] = &bytes.Buffer{}
+	}
+	return &bufferFile{Buffer: d.files[path]}, nil
+}
+
+func (d *combineDriver) DeleteFile(cc ClientContext, path string) error {
+	delete(d.files, path)
+	return nil
+}
+
+func TestCombineFiles(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &combineDriver{files: map[string]*bytes.Buffer{
+		"/part1": bytes.NewBufferString("hello "),
+		"/part2": bytes.NewBufferString("world"),
+	}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), driver: driver, path: "/"}
+
+	c.handleCommand("COMB \"/my file\" part1 part2\r\n")
+	if buf.String() != "250 COMB successful\r\n" {
+		t.Fatalf("Bad reply: %q", buf.String())
+	}
+	if len(driver.files) != 1 || driver.files["/my file"].String() != "hello world" {
+		t.Fatal("The parts should be combined:", driver.files)
+	}
+
+	// The target can be the first part
+	driver.files["/part2"] = bytes.NewBufferString("!")
+	buf.Reset()
+	c.handleCommand("SITE COMBINE \"/my file\" \"/my file\" part2\r\n")
+	if buf.String() != "250 COMB successful\r\n" || driver.files["/my file"].String() != "hello world!" {
+		t.Fatalf("The parts should be appended: %q %v", buf.String(), driver.files)
+	}
+
+	buf.Reset()
+	c.handleCommand("COMB target missing\r\n")
+	if buf.String() != "550 Couldn't combine /target: file does not exist\r\n" {
+		t.Fatalf("Bad reply: %q", buf.String())
+	}
+
+	buf.Reset()
+	c.handleCommand("COMB target\r\n")
+	if buf.String() != "501 Syntax error: a target and at least one part are expected\r\n" {
+		t.Fatalf("Bad reply: %q", buf.String())
+	}
+}
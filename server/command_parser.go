@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"strings"
+)
+
+// DefaultMaxCommandLength is the max length of the command lines when Settings.MaxCommandLength isn't set. It leaves
+// room for the longest paths of the usual file systems (4096).
+const DefaultMaxCommandLength = 4096 + 512
+
+// ParseCommand splits a command line received on the control connection into its command, in upper case, and its
+// param. The line can end with a CRLF or a LF, it's refused with ErrIllegalCharacter if there's any other CR, LF or NUL
+// in it (they could inject a second command or cut a path short in the drivers), or with ErrCommandTooLong if it
+// exceeds max bytes (DefaultMaxCommandLength if 0). The Telnet commands are removed first, like the IP and Synch
+// sequences sent by the clients before ABOR (RFC 959 4.1.3).
+//
+// It doesn't depend on any session, so that it can be tested and fuzzed on its own.
+func ParseCommand(line string, max int) (string, string, error) {
+	if max <= 0 {
+		max = DefaultMaxCommandLength
+	}
+	if len(line) > max {
+		return "", "", ErrCommandTooLong
+	}
+	line = stripTelnet(line)
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	if strings.ContainsAny(line, "\r\n\x00") {
+		return "", "", ErrIllegalCharacter
+	}
+	params := strings.SplitN(line, " ", 2)
+	if len(params) == 1 {
+		return strings.ToUpper(params[0]), "", nil
+	}
+	return strings.ToUpper(params[0]), params[1], nil
+}
+
+const (
+	telnetIAC  = 0xff // Interpret As Command, starting the Telnet commands
+	telnetWILL = 0xfb // First of the option negotiations (WILL, WONT, DO, DONT), followed by an option byte
+	telnetSE   = 0xf0 // First of the Telnet commands (SE, NOP, DM, BRK, IP...)
+)
+
+// stripTelnet removes the Telnet commands from a command line: IAC IP and IAC DM before an ABOR, the option
+// negotiations... IAC IAC is an escaped 0xff byte, and a lone IAC is dropped too, as the kernel might have removed the
+// DM sent as urgent data after it.
+func stripTelnet(line string) string {
+	if strings.IndexByte(line, telnetIAC) < 0 {
+		return line
+	}
+	var stripped strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] != telnetIAC {
+			stripped.WriteByte(line[i])
+			continue
+		}
+		if i+1 == len(line) {
+			break
+		}
+		switch next := line[i+1]; {
+		case next == telnetIAC:
+			stripped.WriteByte(telnetIAC)
+			i++
+		case next >= telnetWILL:
+			i += 2
+		case next >= telnetSE:
+			i++
+		}
+	}
+	return stripped.String()
+}
+
+// readCommandLine reads a line of at most max bytes ending with a LF, without buffering more than that. The rest of
+// the lines too long is skipped, and ErrCommandTooLong is returned, so that the session can go on.
+func readCommandLine(reader *bufio.Reader, max int) (string, error) {
+	if max <= 0 {
+		max = DefaultMaxCommandLength
+	}
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > max {
+			tooLong, line = true, nil
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return string(line), err
+		}
+		if tooLong {
+			return "", ErrCommandTooLong
+		}
+		return string(line), nil
+	}
+}
+
+// maxCommandLength returns the Settings.MaxCommandLength
+func (c *clientHandler) maxCommandLength() int {
+	if settings := c.daddy.Settings; settings != nil {
+		return settings.MaxCommandLength
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	for line, expected := range map[string][2]string{
+		"noop\r\n":                 {"NOOP", ""},
+		"RETR my file.txt\r\n":     {"RETR", "my file.txt"},
+		"STOR  lead\n":             {"STOR", " lead"},
+		"PWD":                      {"PWD", ""},
+		"\r\n":                     {"", ""},
+		"\xff\xf4\xff\xf2ABOR\r\n": {"ABOR", ""},
+		"\xff\xf4\xffABOR\r\n":     {"ABOR", ""},
+		"\xff\xfd\x01NOOP\r\n":     {"NOOP", ""},
+		"RETR a\xff\xffb\r\n":      {"RETR", "a\xffb"},
+	} {
+		command, param, err := ParseCommand(line, 0)
+		if err != nil || command != expected[0] || param != expected[1] {
+			t.Fatalf("Wrong parsing of %q: %q %q %v", line, command, param, err)
+		}
+	}
+
+	for line, expected := range map[string]error{
+		"RETR a\rDELE b\r\n":              ErrIllegalCharacter,
+		"RETR a\nDELE b\r\n":              ErrIllegalCharacter,
+		"RETR secret\x00.txt\r\n":         ErrIllegalCharacter,
+		"RETR a\r\r\n":                    ErrIllegalCharacter,
+		strings.Repeat("x", 101):          ErrCommandTooLong,
+		"RETR " + strings.Repeat("x", 95): nil,
+	} {
+		if _, _, err := ParseCommand(line, 100); err != expected {
+			t.Fatalf("Wrong error for %q: %v", line, err)
+		}
+	}
+}
+
+func TestReadCommandLine(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	reader := bufio.NewReaderSize(strings.NewReader("NOOP\r\nRETR "+long+"\r\nPWD\r\n"), 16)
+	for _, expected := range []string{"NOOP\r\n", "", "PWD\r\n"} {
+		line, err := readCommandLine(reader, 50)
+		if expected == "" && err != ErrCommandTooLong {
+			t.Fatal("The long line should be refused:", line, err)
+		} else if expected != "" && (err != nil || line != expected) {
+			t.Fatalf("Wrong line: %q %v", line, err)
+		}
+	}
+
+	// The lines up to the limit are accepted whatever the size of the buffer
+	reader = bufio.NewReaderSize(strings.NewReader("RETR "+long+"\r\n"), 16)
+	if line, err := readCommandLine(reader, 200); err != nil || line != "RETR "+long+"\r\n" {
+		t.Fatalf("Wrong line: %q %v", line, err)
+	}
+}
+
+func TestCommandInjection(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{MaxCommandLength: 20}}}
+	c.handleCommand("USER a\rPASS b\r\n")
+	c.handleCommand("USER " + strings.Repeat("x", 20) + "\r\n")
+	if expected := "501 Illegal character in the command line\r\n500 Command line too long\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if c.user != "" {
+		t.Fatal("No command should have been executed:", c.user)
+	}
+}
+
+func FuzzParseCommand(f *testing.F) {
+	for _, line := range []string{"NOOP\r\n", "RETR file\r\n", "SITE CHMOD 755 a\n", "A\x00\r\n", "\r\r\n"} {
+		f.Add(line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		command, param, err := ParseCommand(line, 0)
+		if err != nil {
+			return
+		}
+		if strings.ContainsAny(command+param, "\r\n\x00") || strings.Contains(command, " ") {
+			t.Fatalf("Unsafe parsing of %q: %q %q", line, command, param)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net"
+)
+
+// ConnectionRefusal is the refusal of a client connection by a ConnectionChecker
+type ConnectionRefusal struct {
+	Code    int    // Code of the reply, 421 if it's 0
+	Message string // Message of the reply, a default one if it's empty
+	Silent  bool   // The connection is closed without any reply
+}
+
+// ConnectionChecker can be implemented by a MainDriver to accept or refuse the clients before the welcome message,
+// from their IP: GeoIP restrictions, threat feeds, reputation services... Returning nil accepts the client.
+type ConnectionChecker interface {
+	// CheckConnection is called for each new client, before WelcomeUser
+	CheckConnection(cc ClientContext, ip net.IP) *ConnectionRefusal
+}
+
+// checkConnection asks the driver if the client can connect, the refused clients get their reply (unless the refusal
+// is silent) and are disconnected. It returns false if the client was refused.
+func (c *clientHandler) checkConnection() bool {
+	checker, ok := c.daddy.driver.(ConnectionChecker)
+	if !ok {
+		return true
+	}
+	refusal := checker.CheckConnection(c, c.clientIP())
+	if refusal == nil {
+		return true
+	}
+
+	c.logger.Info("Connection refused", logKeyAction, "ftp.connection_refused", "code", refusal.Code,
+		"silent", refusal.Silent)
+	c.audit(AuditConnectionRefused, "", "", nil)
+	if !refusal.Silent {
+		code, message := refusal.Code, refusal.Message
+		if code == 0 {
+			code = 421
+		}
+		if message == "" {
+			message = "Connection refused"
+		}
+		c.writeMessage(code, message)
+	}
+	c.disconnect()
+	return false
+}
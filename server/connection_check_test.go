@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// checkingDriver refuses all the clients
+type checkingDriver struct {
+	MainDriver
+	refusal *ConnectionRefusal
+	checked bool
+}
+
+func (d *checkingDriver) CheckConnection(cc ClientContext, ip net.IP) *ConnectionRefusal {
+	d.checked = true
+	return d.refusal
+}
+
+func TestCheckConnection(t *testing.T) {
+	for expected, refusal := range map[string]*ConnectionRefusal{
+		"":                           nil,
+		"421 Connection refused\r\n": {},
+		"550 Not from here\r\n":      {Code: 550, Message: "Not from here"},
+		"-":                          {Silent: true, Message: "Not sent"},
+	} {
+		var buf bytes.Buffer
+		driver := &checkingDriver{refusal: refusal}
+		server, client := net.Pipe()
+		c := &clientHandler{
+			writer: bufio.NewWriter(&buf),
+			daddy:  &FtpServer{Settings: &Settings{}, driver: driver},
+			conn:   server,
+			logger: nopLogger{},
+		}
+
+		accepted := c.checkConnection()
+		if !driver.checked || accepted != (refusal == nil) {
+			t.Fatal("The connection should only be accepted without a refusal:", expected, accepted)
+		}
+		if expected == "-" {
+			expected = ""
+		}
+		if buf.String() != expected {
+			t.Fatalf("Wrong reply: %q", buf.String())
+		}
+		// Nothing reads the pipe, the writes on an open connection time out
+		client.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+		_, err := client.Write([]byte("x"))
+		if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) != accepted {
+			t.Fatal("Only the refused connections should be closed:", err)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultConnectionQueueTimeout is the time a connection waits for a free slot without Settings.ConnectionQueueTimeout
+const defaultConnectionQueueTimeout = 10 * time.Second
+
+// waitForSlot holds a connection arriving when Settings.MaxConnections is reached, until another one leaves or the
+// Settings.ConnectionQueueTimeout expires. Up to Settings.ConnectionQueueSize connections are held, the other ones are
+// refused at once. It's called with connectionsMutex locked, which is released while waiting.
+func (server *FtpServer) waitForSlot(c *clientHandler) {
+	settings := server.Settings
+	if len(server.connectionsByID) < settings.MaxConnections || server.queued >= settings.ConnectionQueueSize {
+		return
+	}
+
+	timeout := time.Duration(settings.ConnectionQueueTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultConnectionQueueTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	server.queued++
+	defer func() { server.queued-- }()
+	c.logger.Debug("Connection queued", logKeyAction, "ftp.connection_queued", "queued", server.queued)
+
+	for len(server.connectionsByID) >= settings.MaxConnections {
+		if server.slotFreed == nil {
+			server.slotFreed = make(chan struct{})
+		}
+		freed := server.slotFreed
+		server.connectionsMutex.Unlock()
+		select {
+		case <-freed:
+		case <-timer.C:
+			server.connectionsMutex.Lock()
+			return
+		}
+		server.connectionsMutex.Lock()
+	}
+}
+
+// freeSlot wakes up the queued connections once a connection has left, with connectionsMutex locked
+func (server *FtpServer) freeSlot() {
+	if server.slotFreed != nil {
+		close(server.slotFreed)
+		server.slotFreed = nil
+	}
+}
+
+// refuseClient replies to a client refused because of Settings.MaxConnections and closes its connection. With
+// Settings.ConnectionRetryAfter, the 421 reply tells when to try again.
+func (c *clientHandler) refuseClient(err error) {
+	if retry := c.daddy.Settings.ConnectionRetryAfter; retry > 0 {
+		c.writeMessage(421, fmt.Sprintf("Too many clients, try again in %d seconds", retry))
+	} else {
+		c.writeMessage(500, "Can't accept you - "+err.Error())
+	}
+	c.disconnect()
+}
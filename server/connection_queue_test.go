@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// queuedClient creates a client of the server
+func queuedClient(server *FtpServer, id uint32) *clientHandler {
+	conn, _ := net.Pipe()
+	return &clientHandler{id: id, conn: conn, daddy: server, logger: nopLogger{}}
+}
+
+// waitQueued waits for a number of connections to be queued
+func waitQueued(t *testing.T, server *FtpServer, queued int) {
+	for i := 0; i < 100; i++ {
+		server.connectionsMutex.RLock()
+		nb := server.queued
+		server.connectionsMutex.RUnlock()
+		if nb == queued {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The connection should be queued")
+}
+
+func TestConnectionQueue(t *testing.T) {
+	server := &FtpServer{
+		Settings:        &Settings{MaxConnections: 1, ConnectionQueueSize: 1, ConnectionQueueTimeout: 1},
+		connectionsByID: make(map[uint32]*clientHandler),
+		Logger:          nopLogger{},
+	}
+	first := queuedClient(server, 1)
+	if err := server.clientArrival(first); err != nil {
+		t.Fatal("The first client should be accepted:", err)
+	}
+
+	arrived := make(chan error, 1)
+	go func() { arrived <- server.clientArrival(queuedClient(server, 2)) }()
+	waitQueued(t, server, 1)
+
+	// The queue is full, the next client is refused at once
+	third := queuedClient(server, 3)
+	if err := server.clientArrival(third); err == nil {
+		t.Fatal("The third client should be refused")
+	}
+	server.clientDeparture(third)
+
+	select {
+	case err := <-arrived:
+		t.Fatal("The queued client should wait for a free slot:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	server.clientDeparture(first)
+	if err := <-arrived; err != nil {
+		t.Fatal("The queued client should be accepted once the first one left:", err)
+	}
+
+	// Without any free slot, the queued client is refused after the timeout
+	start := time.Now()
+	if err := server.clientArrival(queuedClient(server, 4)); err == nil || time.Since(start) < time.Second {
+		t.Fatal("The client should be refused after the timeout:", err, time.Since(start))
+	}
+}
+
+func TestRefuseClient(t *testing.T) {
+	var buf bytes.Buffer
+	c := queuedClient(&FtpServer{Settings: &Settings{ConnectionRetryAfter: 30}}, 1)
+	c.writer = bufio.NewWriter(&buf)
+
+	c.refuseClient(nil)
+	if buf.String() != "421 Too many clients, try again in 30 seconds\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+	if _, err := c.conn.Write([]byte("x")); err == nil {
+		t.Fatal("The connection should be closed")
+	}
+}
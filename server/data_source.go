@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// dataSourceIP returns the local IP the data connections of a client are bound to, nil for any of them.
+// Settings.DataSourceAddr is either an IP or the name of a network interface, whose first address of the family of the
+// client IP is used (IPv4 if the client IP isn't known).
+func (server *FtpServer) dataSourceIP(client net.IP) (net.IP, error) {
+	source := server.Settings.DataSourceAddr
+	if source == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(source); ip != nil {
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return nil, fmt.Errorf("bad data source %s: %v", source, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the addresses of %s: %v", source, err)
+	}
+
+	ipv4 := client == nil || client.To4() != nil
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && (ipNet.IP.To4() != nil) == ipv4 && !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no address of %s matches the client %s", source, client)
+}
+
+// dataSourceIP returns the local IP the data connections of the session are bound to, nil for any of them
+func (c *clientHandler) dataSourceIP() (net.IP, error) {
+	return c.daddy.dataSourceIP(c.clientIP())
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDataSourceIP(t *testing.T) {
+	server := &FtpServer{Settings: &Settings{}}
+	if ip, err := server.dataSourceIP(nil); ip != nil || err != nil {
+		t.Fatal("There shouldn't be any source:", ip, err)
+	}
+
+	server.Settings.DataSourceAddr = "192.0.2.1"
+	if ip, err := server.dataSourceIP(nil); !ip.Equal(net.IPv4(192, 0, 2, 1)) || err != nil {
+		t.Fatal("Wrong source:", ip, err)
+	}
+
+	server.Settings.DataSourceAddr = "no-such-interface"
+	if _, err := server.dataSourceIP(nil); err == nil {
+		t.Fatal("The unknown interface should be refused")
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal("Couldn't list the interfaces:", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		server.Settings.DataSourceAddr = iface.Name
+		ip, err := server.dataSourceIP(net.IPv4(127, 0, 0, 1))
+		if err != nil || !ip.IsLoopback() || ip.To4() == nil {
+			t.Fatal("The IPv4 address of the interface should be used:", ip, err)
+		}
+		return
+	}
+	t.Skip("No loopback interface")
+}
+
+func TestActiveSource(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	a := &activeTransferHandler{
+		raddr:           listener.Addr().(*net.TCPAddr),
+		source:          net.IPv4(127, 0, 0, 1),
+		nonStandardPort: true,
+	}
+	conn, err := a.Open()
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	defer a.Close()
+
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatal("The connection should come from the source:", ip)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DebugState is a dump of the internals of the server, served by the debug endpoint
+type DebugState struct {
+	StartTime    time.Time            `json:"startTime"`           // Time when the server was started
+	Goroutines   int                  `json:"goroutines"`          // Number of goroutines of the process
+	PassivePorts int                  `json:"passivePorts"`        // Number of configured passive ports (0 for any port)
+	UsedPorts    []int                `json:"usedPorts"`           // Passive ports of the declared data connections
+	Sessions     []*DebugSession      `json:"sessions"`            // Connected clients
+	Unsupported  []UnsupportedCommand `json:"unsupportedCommands"` // Unsupported commands received, the most frequent first
+}
+
+// DebugSession is the state of a session in the DebugState
+type DebugSession struct {
+	ID          uint32    `json:"id"`                    // ID of the session, its goroutines have a "session" label
+	UID         string    `json:"uid"`                   // Unique ID of the session
+	User        string    `json:"user"`                  // User announced on the connection
+	RemoteAddr  string    `json:"remoteAddr"`            // Address of the client
+	RemoteHost  string    `json:"remoteHost,omitempty"`  // Host name of the client, when the reverse lookups are enabled
+	ConnectedAt time.Time `json:"connectedAt"`           // Time of the connection
+	Command     string    `json:"command,omitempty"`     // Command being executed
+	CommandTime time.Time `json:"commandTime,omitempty"` // Time when the command started
+	DataPorts   []int     `json:"dataPorts,omitempty"`   // Passive ports of the declared data connections
+	Captured    bool      `json:"captured,omitempty"`    // The session is captured, see FtpServer.StartCapture
+}
+
+// DebugState returns a dump of the internals of the server
+func (server *FtpServer) DebugState() *DebugState {
+	state := &DebugState{
+		StartTime:   server.StartTime,
+		Goroutines:  runtime.NumGoroutine(),
+		UsedPorts:   []int{},
+		Sessions:    []*DebugSession{},
+		Unsupported: server.UnsupportedCommands(),
+	}
+	if settings := server.Settings; settings != nil {
+		if len(settings.PassivePorts) > 0 {
+			state.PassivePorts = len(settings.PassivePorts)
+		} else if settings.DataPortRange != nil {
+			state.PassivePorts = settings.DataPortRange.End - settings.DataPortRange.Start + 1
+		}
+	}
+
+	server.connectionsMutex.RLock()
+	for _, c := range server.connectionsByID {
+		session := c.debugSession()
+		state.Sessions = append(state.Sessions, session)
+		state.UsedPorts = append(state.UsedPorts, session.DataPorts...)
+	}
+	server.connectionsMutex.RUnlock()
+
+	sort.Slice(state.Sessions, func(i, j int) bool { return state.Sessions[i].ID < state.Sessions[j].ID })
+	sort.Ints(state.UsedPorts)
+	return state
+}
+
+// debugSession returns the state of the session
+func (c *clientHandler) debugSession() *DebugSession {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return &DebugSession{
+		ID:          c.id,
+		UID:         c.uid,
+		User:        c.user,
+		RemoteAddr:  c.remoteAddr,
+		RemoteHost:  c.remoteHost,
+		ConnectedAt: c.connectedAt,
+		Command:     c.running,
+		CommandTime: c.runningAt,
+		DataPorts:   append([]int(nil), c.dataPorts...),
+		Captured:    c.capture != nil,
+	}
+}
+
+// setRunning records the command being executed, for the debug endpoint
+func (c *clientHandler) setRunning(command string) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.running = command
+	c.runningAt = time.Now().UTC()
+}
+
+// updateDataPorts records the passive ports of the declared data connections, for the debug endpoint
+func (c *clientHandler) updateDataPorts() {
+	var ports []int
+	for _, t := range c.transfers {
+		if p, ok := t.(*passiveTransferHandler); ok {
+			ports = append(ports, p.Port)
+		}
+	}
+
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.dataPorts = ports
+}
+
+// labelGoroutine labels the goroutine of the session (and the ones it starts) in the goroutine profiles
+func (c *clientHandler) labelGoroutine() {
+	labels := runtimepprof.Labels("session", strconv.FormatUint(uint64(c.id), 10), "sessionUid", c.uid)
+	runtimepprof.SetGoroutineLabels(runtimepprof.WithLabels(context.Background(), labels))
+}
+
+// DebugHandler returns an HTTP handler serving the pprof profiles on "/debug/pprof/", the expvar variables on
+// "/debug/vars" and the DebugState as JSON on "/debug/ftp". The goroutines of the sessions have a "session" label
+// in the goroutine profiles ("/debug/pprof/goroutine?debug=1"). The captures of the sessions are managed on
+// "/debug/ftp/capture?session=ID": POST starts one (with the optional "entries", "lineLength" and "rate" params of
+// its CaptureOptions), GET returns its SessionCapture as JSON and DELETE stops it and returns it.
+func (server *FtpServer) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/ftp", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(server.DebugState())
+	})
+	mux.HandleFunc("/debug/ftp/capture", server.serveCapture)
+	return mux
+}
+
+// listenDebug starts the HTTP debug endpoint
+func (server *FtpServer) listenDebug() error {
+	listener, err := server.listen("debug", server.Settings.DebugListenAddr)
+	if err != nil {
+		return err
+	}
+	if server.endpoints == nil {
+		server.endpoints = make(map[string]net.Listener)
+	}
+	server.endpoints["debug"] = listener
+
+	server.debugServer = &http.Server{Handler: server.DebugHandler()}
+	go server.debugServer.Serve(listener)
+
+	server.Logger.Info("Debug endpoint listening...", logKeyAction, "ftp.debug_listening", "address", listener.Addr())
+	return nil
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{PassivePorts: []int{2122, 2123}}
+	c := &clientHandler{id: 3, user: "alice", remoteAddr: "10.0.0.1:1234", daddy: server}
+	server.connectionsByID[c.id] = c
+
+	c.declareTransfer(&passiveTransferHandler{Port: 2123})
+	c.setRunning("RETR")
+	handler := server.DebugHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/ftp", nil))
+	var state DebugState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatal("Bad dump:", err)
+	}
+	if state.PassivePorts != 2 || len(state.UsedPorts) != 1 || state.UsedPorts[0] != 2123 || len(state.Sessions) != 1 {
+		t.Fatalf("Wrong server state: %+v", state)
+	}
+	if session := state.Sessions[0]; session.ID != 3 || session.User != "alice" || session.Command != "RETR" ||
+		session.RemoteAddr != "10.0.0.1:1234" {
+		t.Fatalf("Wrong session state: %+v", session)
+	}
+
+	c.end()
+	if state := server.DebugState(); len(state.UsedPorts) != 0 {
+		t.Fatal("The ports should be released:", state.UsedPorts)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatal("Bad status for", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// defaultDirSizeTimeout is the time the server walks a directory for SITE DIRSIZE when Settings.DirSizeTimeout is 0
+const defaultDirSizeTimeout = 10 * time.Second
+
+// errDirSizeTimeout stops the walk of a directory once its time is up
+var errDirSizeTimeout = errors.New("directory walk timed out")
+
+// DirectorySize is the content of a directory subtree
+type DirectorySize struct {
+	Bytes       int64 // Total size of the files
+	Files       int64 // Number of files
+	Directories int64 // Number of subdirectories
+}
+
+// DirectorySizer can be implemented by a ClientHandlingDriver to answer SITE DIRSIZE from its own accounting, like
+// the backends keeping the size of their prefixes. The server walks the subtree with the listings otherwise, for at
+// most Settings.DirSizeTimeout.
+type DirectorySizer interface {
+	// DirectorySize returns the content of a directory (an absolute path) and all its subdirectories
+	DirectorySize(cc ClientContext, directory string) (*DirectorySize, error)
+}
+
+// Handle the "SITE DIRSIZE [<directory>]" command, giving the size of a directory subtree before mirroring it
+func (c *clientHandler) handleDIRSIZE(param string) {
+	c.param = strings.TrimSpace(param)
+	if !c.checkHiddenAccess() {
+		return
+	}
+	directory := c.absPath(c.param)
+
+	var size *DirectorySize
+	var err error
+	if sizer, ok := c.driver.(DirectorySizer); ok {
+		size, err = sizer.DirectorySize(c, directory)
+	} else {
+		size, err = c.walkDirectorySize(directory)
+	}
+	switch {
+	case errors.Is(err, errDirSizeTimeout):
+		c.writeMessage(450, fmt.Sprintf("Directory %s is too large to be measured", directory))
+	case err != nil:
+		c.writeError(550, fmt.Sprintf("Could not measure %s: %v", directory, err), err)
+	default:
+		c.writeMessage(213, fmt.Sprintf("%d bytes in %d files and %d directories", size.Bytes, size.Files,
+			size.Directories))
+	}
+}
+
+// walkDirectorySize adds up the files listed in a directory and its subdirectories, skipping the ones hidden from
+// the listings. The symbolic links are neither followed nor counted. The walk goes through the current directory of
+// the session, which is restored afterwards.
+func (c *clientHandler) walkDirectorySize(directory string) (*DirectorySize, error) {
+	timeout := time.Duration(c.daddy.Settings.DirSizeTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultDirSizeTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	current := c.Path()
+	defer c.SetPath(current)
+
+	size := &DirectorySize{}
+	pending := []string{directory}
+	for len(pending) > 0 {
+		if time.Now().After(deadline) {
+			return nil, errDirSizeTimeout
+		}
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		c.SetPath(dir)
+		filter := c.listingFilter()
+		err := c.walkFiles(func(file os.FileInfo) error {
+			if filter != nil && !filter(file) {
+				return nil
+			}
+			switch {
+			case file.IsDir():
+				// Some drivers list the directory itself and its parent
+				if file.Name() != "." && file.Name() != ".." {
+					size.Directories++
+					pending = append(pending, path.Join(dir, file.Name()))
+				}
+			case file.Mode()&os.ModeSymlink == 0:
+				size.Files++
+				size.Bytes += file.Size()
+			}
+			if time.Now().After(deadline) {
+				return errDirSizeTimeout
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return size, nil
+}
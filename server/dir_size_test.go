@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func (d *dirDriver) ListFiles(cc ClientContext) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(filepath.Join(d.dir, cc.Path()))
+}
+
+// sizingDriver measures the directories itself
+type sizingDriver struct {
+	ClientHandlingDriver
+	measured string
+}
+
+func (d *sizingDriver) DirectorySize(cc ClientContext, directory string) (*DirectorySize, error) {
+	d.measured = directory
+	return &DirectorySize{Bytes: 1 << 40, Files: 1000, Directories: 10}, nil
+}
+
+func TestDIRSIZEWalk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	for name, size := range map[string]int{"a": 3, "sub/b": 4, "sub/deep/c": 2, "other": 10} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}},
+		driver: &dirDriver{dir: dir}, logger: nopLogger{}, path: "/sub"}
+
+	c.handleCommand("SITE DIRSIZE\r\n")
+	if reply := buf.String(); reply != "213 6 bytes in 2 files and 1 directories\r\n" {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+	if c.Path() != "/sub" {
+		t.Fatal("The current directory should be restored:", c.Path())
+	}
+
+	buf.Reset()
+	c.handleCommand("SITE DIRSIZE /\r\n")
+	if reply := buf.String(); reply != "213 19 bytes in 4 files and 2 directories\r\n" {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+
+	buf.Reset()
+	c.handleCommand("SITE DIRSIZE /missing\r\n")
+	if reply := buf.String(); reply[:4] != "550 " {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+}
+
+func TestDIRSIZEDriver(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &sizingDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}}, driver: driver,
+		logger: nopLogger{}, path: "/"}
+
+	c.handleCommand("SITE DIRSIZE data\r\n")
+	if reply := buf.String(); reply != "213 1099511627776 bytes in 1000 files and 10 directories\r\n" {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+	if driver.measured != "/data" {
+		t.Fatal("Wrong directory:", driver.measured)
+	}
+}
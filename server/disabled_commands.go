@@ -0,0 +1,31 @@
+package server
+
+import "strings"
+
+// newDisabledCommands indexes the Settings.DisabledCommands, like "DELE" or "SITE CHMOD"
+func newDisabledCommands(commands []string) map[string]bool {
+	if len(commands) == 0 {
+		return nil
+	}
+	disabled := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		disabled[strings.ToUpper(strings.Join(strings.Fields(command), " "))] = true
+	}
+	return disabled
+}
+
+// commandDisabled tells if a command (or a SITE subcommand) is disabled on the server
+func (server *FtpServer) commandDisabled(command, param string) bool {
+	if server.disabledCmds == nil {
+		return false
+	}
+	if server.disabledCmds[command] {
+		return true
+	}
+	if command == "SITE" {
+		if fields := strings.Fields(param); len(fields) > 0 {
+			return server.disabledCmds["SITE "+strings.ToUpper(fields[0])]
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package server
+
+import "testing"
+
+func TestDisabledCommands(t *testing.T) {
+	server := &FtpServer{disabledCmds: newDisabledCommands([]string{"dele", "site  chmod", "PORT"})}
+
+	for _, disabled := range [][2]string{{"DELE", "file"}, {"SITE", "chmod 644 file"}, {"PORT", "1,2,3,4,5,6"}} {
+		if !server.commandDisabled(disabled[0], disabled[1]) {
+			t.Fatal("The command should be disabled:", disabled)
+		}
+	}
+	for _, enabled := range [][2]string{{"RETR", "file"}, {"SITE", "HELP"}, {"SITE", ""}} {
+		if server.commandDisabled(enabled[0], enabled[1]) {
+			t.Fatal("The command should be enabled:", enabled)
+		}
+	}
+
+	if (&FtpServer{}).commandDisabled("DELE", "file") {
+		t.Fatal("All the commands should be enabled by default")
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxDownloadTokens is the max number of download tokens a session can hold
+const maxDownloadTokens = 100
+
+// defaultDownloadTokenTTL is the validity of the download tokens when Settings.DownloadTokenTTL isn't defined
+const defaultDownloadTokenTTL = 5 * time.Minute
+
+// DownloadToken is a one-time token for the download of a file by another channel, like an HTTP gateway sharing the
+// storage of the driver: SITE TOKEN gives it to the client, which can then hand the download off
+type DownloadToken struct {
+	Token   string    // Token given to the client, it can be a full URL
+	Path    string    // Path of the file
+	Expires time.Time // Time after which the token can't be redeemed
+}
+
+// DownloadTokenIssuer can be implemented by a ClientHandlingDriver to mint the tokens of SITE TOKEN. The driver (or
+// its gateway) keeps them and redeems each one once, the server only checks that the session can download the file
+// and tracks the tokens of the session to revoke them.
+type DownloadTokenIssuer interface {
+	// IssueDownloadToken mints a token for a file, valid until expires
+	IssueDownloadToken(cc ClientContext, path string, expires time.Time) (*DownloadToken, error)
+
+	// RevokeDownloadToken invalidates a token of the session: on SITE TOKEN REVOKE, and when the session ends with
+	// Settings.RevokeDownloadTokens. It's called for the tokens already redeemed or expired too.
+	RevokeDownloadToken(cc ClientContext, token *DownloadToken) error
+}
+
+// handleTOKEN mints a download token: SITE TOKEN <path>, or revokes one: SITE TOKEN REVOKE <token>
+func (c *clientHandler) handleTOKEN(param string) {
+	issuer, ok := c.driver.(DownloadTokenIssuer)
+	if !ok {
+		c.writeMessage(502, "SITE TOKEN not supported")
+		return
+	}
+
+	if spl := strings.SplitN(param, " ", 2); len(spl) == 2 && strings.ToUpper(spl[0]) == "REVOKE" {
+		c.revokeDownloadToken(issuer, strings.TrimSpace(spl[1]))
+		return
+	}
+
+	if caps := c.session.Capabilities; caps != 0 && !caps.Has(CapDownload) {
+		c.audit(AuditPermissionDenied, "", "", nil)
+		c.writeMessage(550, "Permission denied")
+		return
+	}
+
+	path := c.absPath(param)
+	if c.session.HiddenFiles == HiddenFilesDeny && isHiddenPath(path) {
+		c.writeMessage(550, "Access to hidden files is denied")
+		return
+	}
+	if !c.checkUploadLock(path) {
+		return
+	}
+	info, err := c.driver.GetFileInfo(c, path)
+	if err != nil {
+		c.writeError(550, fmt.Sprintf("Could not access file: %v", err), err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		c.writeMessage(550, fmt.Sprintf("%s is not a file", path))
+		return
+	}
+
+	c.paramsMutex.RLock()
+	count := len(c.tokens)
+	c.paramsMutex.RUnlock()
+	if count >= maxDownloadTokens {
+		c.writeMessage(450, "Too many download tokens, revoke some of them first")
+		return
+	}
+
+	ttl := defaultDownloadTokenTTL
+	if c.daddy.Settings.DownloadTokenTTL > 0 {
+		ttl = time.Duration(c.daddy.Settings.DownloadTokenTTL) * time.Second
+	}
+	token, err := issuer.IssueDownloadToken(c, path, time.Now().Add(ttl).UTC())
+	if err != nil {
+		c.writeError(550, fmt.Sprintf("Could not issue a token for %s: %v", path, err), err)
+		return
+	}
+
+	c.paramsMutex.Lock()
+	c.tokens = append(c.tokens, token)
+	c.paramsMutex.Unlock()
+	c.writeMessage(200, fmt.Sprintf("Token %s valid until %s", token.Token, token.Expires.UTC().Format(time.RFC3339)))
+}
+
+// revokeDownloadToken revokes a token the session issued
+func (c *clientHandler) revokeDownloadToken(issuer DownloadTokenIssuer, value string) {
+	c.paramsMutex.Lock()
+	var token *DownloadToken
+	for i, t := range c.tokens {
+		if t.Token == value {
+			token = t
+			c.tokens = append(c.tokens[:i], c.tokens[i+1:]...)
+			break
+		}
+	}
+	c.paramsMutex.Unlock()
+
+	if token == nil {
+		c.writeMessage(550, "Unknown token")
+		return
+	}
+	if err := issuer.RevokeDownloadToken(c, token); err != nil {
+		c.writeError(550, fmt.Sprintf("Could not revoke the token: %v", err), err)
+		return
+	}
+	c.writeMessage(200, "Token revoked")
+}
+
+// revokeDownloadTokens revokes the tokens of the session when it ends, with Settings.RevokeDownloadTokens
+func (c *clientHandler) revokeDownloadTokens() {
+	issuer, ok := c.driver.(DownloadTokenIssuer)
+	if !ok || !c.daddy.Settings.RevokeDownloadTokens {
+		return
+	}
+
+	c.paramsMutex.Lock()
+	tokens := c.tokens
+	c.tokens = nil
+	c.paramsMutex.Unlock()
+
+	for _, token := range tokens {
+		if err := issuer.RevokeDownloadToken(c, token); err != nil {
+			c.logger.Warn("Couldn't revoke a download token", logKeyAction, "ftp.token_revoke", "path", token.Path, "err", err)
+		}
+	}
+}
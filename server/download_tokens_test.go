@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenDriver mints the download tokens of the files of a directory
+type tokenDriver struct {
+	ClientHandlingDriver
+	dir     string
+	issued  int
+	revoked []string
+}
+
+func (d *tokenDriver) GetFileInfo(cc ClientContext, path string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(d.dir, path))
+}
+
+func (d *tokenDriver) IssueDownloadToken(cc ClientContext, path string, expires time.Time) (*DownloadToken, error) {
+	d.issued++
+	return &DownloadToken{Token: fmt.Sprintf("t%d", d.issued), Path: path, Expires: expires}, nil
+}
+
+func (d *tokenDriver) RevokeDownloadToken(cc ClientContext, token *DownloadToken) error {
+	d.revoked = append(d.revoked, token.Token)
+	return nil
+}
+
+func TestDownloadTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	driver := &tokenDriver{dir: dir}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{DownloadTokenTTL: 60,
+		RevokeDownloadTokens: true}}, driver: driver, logger: nopLogger{}}
+
+	c.handleCommand("SITE TOKEN /file\r\n")
+	if reply := buf.String(); !strings.HasPrefix(reply, "200 Token t1 valid until ") {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+	if expires := c.tokens[0].Expires; expires.Before(time.Now().Add(50*time.Second)) ||
+		expires.After(time.Now().Add(time.Minute)) {
+		t.Fatal("Wrong expiry:", expires)
+	}
+
+	buf.Reset()
+	c.handleCommand("SITE TOKEN /\r\n")
+	c.handleCommand("SITE TOKEN /missing\r\n")
+	c.handleCommand("SITE TOKEN REVOKE t2\r\n")
+	if replies := strings.Split(buf.String(), "\r\n"); !strings.HasPrefix(replies[0], "550 / is not a file") ||
+		!strings.HasPrefix(replies[1], "550 Could not access file") || replies[2] != "550 Unknown token" {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+
+	c.handleCommand("SITE TOKEN /file\r\n")
+	buf.Reset()
+	c.handleCommand("SITE TOKEN REVOKE t2\r\n")
+	if buf.String() != "200 Token revoked\r\n" || len(c.tokens) != 1 {
+		t.Fatalf("Wrong reply: %q %d", buf.String(), len(c.tokens))
+	}
+
+	c.revokeDownloadTokens()
+	if strings.Join(driver.revoked, ",") != "t2,t1" || len(c.tokens) != 0 {
+		t.Fatal("Wrong revoked tokens:", driver.revoked)
+	}
+}
+
+func TestDownloadTokensDenied(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}},
+		driver: &tokenDriver{}, session: SessionSettings{Capabilities: CapUpload}}
+
+	c.handleCommand("SITE TOKEN /file\r\n")
+	c.driver = &siteDriver{}
+	c.handleCommand("SITE TOKEN /file\r\n")
+	if expected := "550 Permission denied\r\n502 SITE TOKEN not supported\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
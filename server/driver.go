@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"io"
+	"net"
 	"os"
+	"time"
 )
 
 // This file is the driver part of the server. It must be implemented by anyone wanting to use the server.
@@ -19,7 +22,8 @@ type MainDriver interface {
 	// UserLeft is called when the user disconnects, even if he never authenticated
 	UserLeft(cc ClientContext)
 
-	// AuthUser authenticates the user and selects an handling driver
+	// AuthUser authenticates the user and creates the driver handling its session. It should return a new driver for
+	// each session, so that the state of a session is never shared with the other ones.
 	AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error)
 
 	// GetTLSConfig returns a TLS Certificate to use
@@ -27,7 +31,29 @@ type MainDriver interface {
 	GetTLSConfig() (*tls.Config, error)
 }
 
-// ClientHandlingDriver handles the file system access logic
+// CommandExecution describes the execution of an FTP command
+type CommandExecution struct {
+	Command  string        // Command (always in upper case)
+	Param    string        // Param of the command
+	Duration time.Duration // Time it took to execute the command (including the transfer for data commands)
+	Code     int           // Code of the last reply sent for the command
+}
+
+// CommandObserver can be implemented by a MainDriver to be notified of each command execution
+type CommandObserver interface {
+	// CommandExecuted is called after each command
+	CommandExecuted(cc ClientContext, execution *CommandExecution)
+}
+
+// VirtualHostSelector can be implemented by a MainDriver to accept the virtual hosts selected with HOST (RFC 7151).
+// Returning an error refuses the host, without it all the hosts are accepted.
+type VirtualHostSelector interface {
+	// SelectHost is called for each HOST command, before USER
+	SelectHost(cc ClientContext, host string) error
+}
+
+// ClientHandlingDriver handles the file system access logic. The server resolves the paths of the clients against
+// their working directory, the drivers only get clean absolute paths.
 type ClientHandlingDriver interface {
 	// ChangeDirectory changes the current working directory
 	ChangeDirectory(cc ClientContext, directory string) error
@@ -57,16 +83,395 @@ type ClientHandlingDriver interface {
 	ChmodFile(cc ClientContext, path string, mode os.FileMode) error
 }
 
+// ChallengeAuthenticator can be implemented by a MainDriver for the logins in several steps (one-time passwords, second
+// factors...): AuthUser returns an AuthChallenge with the prompt sent to the user, and the response of the user is
+// passed to AuthChallengeResponse.
+type ChallengeAuthenticator interface {
+	// AuthChallengeResponse completes the login with the response to the challenge, it can return another challenge
+	AuthChallengeResponse(cc ClientContext, user, response string) (ClientHandlingDriver, error)
+}
+
+// ClientDriverCloser can be implemented by the ClientHandlingDriver returned by AuthUser to release the resources of
+// its session (connections to a remote storage, temporary files...). It's called once for each driver, when the
+// client disconnects or authenticates again.
+type ClientDriverCloser interface {
+	// Close is called after UserLeft, or before the AuthUser of a new authentication
+	Close(cc ClientContext) error
+}
+
+// SessionSettings are the settings of an authenticated session. Zero values keep the server Settings.
+type SessionSettings struct {
+	IdleTimeout       int                  // Seconds of inactivity after which the session is closed
+	MaxTransferSize   int64                // Max size of the transferred files, in bytes
+	MaxUploadSize     int64                // Max size of the uploaded files, in bytes
+	AllowedCommands   []string             // Commands allowed after the authentication (all of them if empty)
+	DownloadBandwidth int64                // Max download speed, in bytes per second
+	UploadBandwidth   int64                // Max upload speed, in bytes per second
+	BandwidthWeight   int                  // Share of the global bandwidth of the user relative to the other users (1 if 0)
+	DataPortRange     *PortRange           // Port range of the passive connections
+	HiddenFiles       HiddenFilesPolicy    // Handling of the dotfiles
+	Capabilities      Capability           // Operations allowed to the session, enforced by the server (all of them if 0)
+	AllowFXP          bool                 // Accept the active mode targets other than the client (server-to-server transfers)
+	MaxSessions       int                  // Max number of simultaneous authenticated sessions of the user (421 reply beyond)
+	DuplicateLogins   DuplicateLoginPolicy // What happens when the user logs in again while connected
+	DropBox           bool                 // Upload-only mode: files can't be overwritten, downloaded nor deleted
+	WORMPolicy        *WORMPolicy          // Write-once-read-many files of the user, replacing the ones of the server
+}
+
+// SessionSettingsProvider can be implemented by the ClientHandlingDriver returned by AuthUser to define per-user
+// settings
+type SessionSettingsProvider interface {
+	// SessionSettings is called right after the authentication, nil keeps the server settings
+	SessionSettings(cc ClientContext) *SessionSettings
+}
+
+// FileListStreamer can be implemented by a ClientHandlingDriver to stream the files of a directory instead of
+// returning them all at once. It's used in place of ListFiles when available.
+type FileListStreamer interface {
+	// StreamFiles calls the callback for each file of the current directory and stops at the first error it returns
+	StreamFiles(cc ClientContext, callback func(os.FileInfo) error) error
+}
+
+// FileListIterator can be implemented by a ClientHandlingDriver to provide the files of a directory one by one. The
+// server pulls each file once the previous one is written on the transfer connection: the listing is never held in
+// memory, and a slow client slows the driver down. Unlike with FileListStreamer, the errors of the opening are
+// reported before the transfer connection is opened. It's used in place of ListFiles and FileListStreamer, unless the
+// listings are cached (Settings.ListingCacheTTL).
+type FileListIterator interface {
+	// IterateFiles opens an iterator over the files of the current directory
+	IterateFiles(cc ClientContext) (FileIterator, error)
+}
+
+// FileIterator iterates over the files of a directory, see FileListIterator
+type FileIterator interface {
+	// Next returns the next file, or io.EOF once there are no more
+	Next() (os.FileInfo, error)
+
+	// Close releases the iterator, it's called once the listing is over, even if it stopped early
+	Close() error
+}
+
+// FileListPager can be implemented by a ClientHandlingDriver whose backend returns directory listings by pages (like
+// object stores do). Pages are fetched lazily while the listing is written on the transfer connection.
+type FileListPager interface {
+	// ListFilesPage returns a page of files of the current directory along with the token of the next page.
+	// The first page is requested with an empty token, the last page is returned with an empty next token.
+	ListFilesPage(cc ClientContext, token string) (files []os.FileInfo, nextToken string, err error)
+}
+
+// FileListMatcher can be implemented by a ClientHandlingDriver to list the files matching the glob pattern of a LIST
+// or NLST ("*.csv", "data-2023*") itself, when its backend can filter them. Without it, the server filters the
+// listing of the directory with path.Match.
+type FileListMatcher interface {
+	// ListFilesMatching returns the files of the current directory whose name matches the pattern
+	ListFilesMatching(cc ClientContext, pattern string) ([]os.FileInfo, error)
+}
+
+// TransferDirection is the direction of a file transfer
+type TransferDirection int
+
+const (
+	// TransferDownload is a transfer from the server to the client (RETR)
+	TransferDownload TransferDirection = iota
+	// TransferUpload is a transfer from the client to the server (STOR, APPE)
+	TransferUpload
+)
+
+// TransferRequest describes a transfer that is about to start
+type TransferRequest struct {
+	Path         string            // Path of the file
+	Direction    TransferDirection // Direction of the transfer
+	Append       bool              // The upload will append to the file (APPE)
+	Offset       int64             // Offset the transfer will start at (REST)
+	Length       int64             // Number of bytes requested from the offset (RANG), 0 for the rest of the file
+	DeclaredSize int64             // Size declared by the client (ALLO), 0 if none was declared
+	Type         string            // Data representation type: "I" for binary, "A" for ASCII
+	Mode         string            // Transfer mode (MODE): "S" for stream, the only one supported
+	Protection   string            // Protection level of the data connection (PROT): "P" for private, "C" for clear
+	Priority     TransferPriority  // Priority class of the transfer on the global bandwidth, the hook can change it
+}
+
+// ResumeValidator can be implemented by a ClientHandlingDriver to check the restart offsets (REST) against the stored
+// files, like the objects of a store that could have changed since the interrupted transfer (size, etag...). It can
+// correct the offset the transfer starts at, or refuse the transfer with a 554 reply.
+type ResumeValidator interface {
+	// ValidateResume is called before the RETR, STOR or APPE following a REST, it returns the offset to use
+	ValidateResume(cc ClientContext, path string, direction TransferDirection, offset int64) (int64, error)
+}
+
+// MetadataProvider can be implemented by a ClientHandlingDriver to answer SIZE and MDTM from a cheaper source than
+// GetFileInfo, like the index of a remote store. Returning ErrNoMetadata refuses the command for the entries that
+// have no meaningful size or date (virtual files, generated listings...).
+type MetadataProvider interface {
+	// GetMetadata is called by SIZE and MDTM instead of GetFileInfo
+	GetMetadata(cc ClientContext, path string) (os.FileInfo, error)
+}
+
+// FileTimesChanger can be implemented by a ClientHandlingDriver to let the clients preserve the times of the uploaded
+// files (SITE UTIME, and the Modify fact of MFF)
+type FileTimesChanger interface {
+	// Chtimes changes the access and modification times of a file
+	Chtimes(cc ClientContext, path string, atime, mtime time.Time) error
+}
+
+// CreationTimeChanger can be implemented by a ClientHandlingDriver whose storage keeps the creation times of the
+// files, to let the clients change them (MFCT, and the Create fact of MFF)
+type CreationTimeChanger interface {
+	// SetCreationTime changes the creation time of a file
+	SetCreationTime(cc ClientContext, path string, ctime time.Time) error
+}
+
+// SpaceProvider can be implemented by a ClientHandlingDriver to report the space available to the uploads (AVBL and
+// SITE DF), so that the clients can check it before the large ones
+type SpaceProvider interface {
+	// AvailableSpace returns the number of bytes that can still be stored in a directory
+	AvailableSpace(cc ClientContext, path string) (int64, error)
+}
+
+// PreTransferHook can be implemented by a ClientHandlingDriver to refuse transfers before the transfer connection is
+// opened. Returning ErrQuotaExceeded produces a 552 reply, the errors without a standard reply a 550 one.
+type PreTransferHook interface {
+	// PreTransfer is called before each RETR, STOR or APPE
+	PreTransfer(cc ClientContext, request *TransferRequest) error
+}
+
+// TransferOpener can be implemented by a ClientHandlingDriver to open the files of the transfers knowing what's
+// expected of them, like pre-allocating the declared size (ALLO), choosing the part size of a multipart upload or the
+// storage class of the file. It's called instead of OpenFile by RETR, STOR and APPE, after the PreTransferHook.
+type TransferOpener interface {
+	// OpenTransfer opens a file like OpenFile, the path differs from the one of the request for the uploads written
+	// to a temporary file
+	OpenTransfer(cc ClientContext, path string, flag int, request *TransferRequest) (FileStream, error)
+}
+
+// ProtectionObserver can be implemented by a ClientHandlingDriver to be told about the changes of the data protection
+// level of the authenticated sessions (PROT). Returning an error refuses the new level with a 534 reply.
+type ProtectionObserver interface {
+	// ProtectionChanged is called on PROT P and PROT C with the requested level: "P" for private, "C" for clear
+	ProtectionChanged(cc ClientContext, level string) error
+}
+
+// ProtectionPolicy can be implemented by a ClientHandlingDriver to require protected data connections (PROT P) for
+// some paths only, like a confidential directory. The transfers and listings of these paths on clear data
+// connections are refused with a 521 reply.
+type ProtectionPolicy interface {
+	// ProtectedDataRequired is called before each RETR, STOR and APPE with the path of the file, and before each listing
+	// with the path of the directory
+	ProtectedDataRequired(cc ClientContext, path string) bool
+}
+
+// RenameValidator can be implemented by a ClientHandlingDriver to refuse renames with a 553 reply before RenameFile
+// is called
+type RenameValidator interface {
+	// CanRenameFrom is called on RNFR with the info of the source
+	CanRenameFrom(cc ClientContext, from string, info os.FileInfo) error
+
+	// CanRenameTo is called on RNTO with the info of the source and the destination
+	CanRenameTo(cc ClientContext, from string, info os.FileInfo, to string) error
+}
+
+// UploadDigest describes a file that was just uploaded
+type UploadDigest struct {
+	Path      string // Path of the file
+	Size      int64  // Number of bytes received
+	Algorithm string // Algorithm of the hash ("sha256" or "md5"), empty if none was computed
+	Sum       []byte // Hash of the received bytes
+}
+
+// PostUploadHook can be implemented by a ClientHandlingDriver to verify or register the files once they are uploaded.
+// Returning an error makes the upload fail.
+type PostUploadHook interface {
+	// PostUpload is called after a successful STOR or APPE
+	PostUpload(cc ClientContext, digest *UploadDigest) error
+}
+
+// UploadResult describes the outcome of an upload
+type UploadResult struct {
+	Path     string        // Path of the file
+	Size     int64         // Number of bytes received
+	Duration time.Duration // Duration of the transfer
+	Append   bool          // The file was appended to (APPE)
+	Err      error         // Error that made the upload fail, nil if it succeeded
+}
+
+// UploadCompletionHook can be implemented by a ClientHandlingDriver to process the files after each upload (scan,
+// quarantine, move them to their final location...). It's called for both successful and failed uploads, an error
+// returned for a successful upload is reported to the client instead of the 226 reply.
+type UploadCompletionHook interface {
+	// UploadCompleted is called at the end of each STOR or APPE
+	UploadCompleted(cc ClientContext, result *UploadResult) error
+}
+
+// UploadAborter can be implemented by a ClientHandlingDriver to clean up the partial files of the uploads aborted
+// because they went beyond the max size. Without it, the partial file of a STOR is deleted.
+type UploadAborter interface {
+	// AbortUpload is called once the partial file is closed, with the size error
+	AbortUpload(cc ClientContext, path string, append bool, cause error) error
+}
+
+// UploadTempNamer can be implemented by a ClientHandlingDriver to make its STOR uploads atomic (even without
+// Settings.AtomicUploads) or to choose their temporary names, in a place where the rename is cheap and atomic
+type UploadTempNamer interface {
+	// UploadTempName returns the name the file is written to until the upload succeeds, an empty string to write it in
+	// place
+	UploadTempName(cc ClientContext, path string) string
+}
+
+// UploadCommit describes the content of a STOR that was received, but not stored under its final name yet
+type UploadCommit struct {
+	Path      string // Path of the file
+	TempPath  string // Path of the temporary file holding the content
+	Size      int64  // Number of bytes received
+	Algorithm string // Algorithm of the hash ("sha256" by default, or the Settings.UploadHashAlgorithm)
+	Sum       []byte // Hash of the content
+}
+
+// UploadDeduplicator can be implemented by a ClientHandlingDriver to avoid storing the same content twice. The STOR
+// uploads are then written to a temporary file (see UploadTempNamer) and hashed while they're received, the driver is
+// asked if it already has their content before they're committed. The resumed uploads and the appends aren't
+// deduplicated.
+type UploadDeduplicator interface {
+	// PreCommit returns true if the driver makes the path reference some content it already has (with a hard link,
+	// a reference count...), the temporary file is then deleted instead of being renamed. Returning an error makes
+	// the upload fail.
+	PreCommit(cc ClientContext, commit *UploadCommit) (bool, error)
+}
+
+// ErrorMapper can be implemented by a ClientHandlingDriver to choose the replies sent for its errors, like a 450 for
+// the temporary failures of a remote storage. Returning a 0 code keeps the default reply of the command, an empty
+// message keeps its default message. Drivers can also return a ReplyError for a specific error.
+type ErrorMapper interface {
+	// MapError is called with the command that failed and the error of the driver
+	MapError(cc ClientContext, command string, err error) (code int, message string)
+}
+
+// FileCombiner can be implemented by a ClientHandlingDriver to assemble the parts of the segmented uploads (COMB,
+// SITE COMBINE) without copying them through the server, like with the multipart uploads of an object store.
+// Without it, the parts are copied one after the other into the target and deleted.
+type FileCombiner interface {
+	// CombineFiles concatenates the parts into the target in their order and removes them. The target can be the
+	// first part.
+	CombineFiles(cc ClientContext, target string, parts []string) error
+}
+
+// SiteCommandHandler can be implemented by a ClientHandlingDriver to add its own SITE subcommands (like SITE
+// EMPTYTRASH), the ones of the server come first
+type SiteCommandHandler interface {
+	// SiteCommand executes a SITE subcommand (in upper case) and returns the message of its 200 reply (of one or more
+	// lines), or ErrUnknownSiteCommand if the driver doesn't know it
+	SiteCommand(cc ClientContext, command, param string) (string, error)
+
+	// SiteCommands returns the subcommands of the driver (in upper case) and their arguments, for SITE HELP
+	SiteCommands(cc ClientContext) map[string]string
+}
+
+// AbortedTransfer describes a transfer interrupted by the client
+type AbortedTransfer struct {
+	Path      string            // Path of the file
+	Direction TransferDirection // Direction of the transfer
+	Offset    int64             // Offset the transfer started at (REST)
+	Size      int64             // Number of bytes transferred before the abort
+	Cause     error             // ErrTransferAborted (ABOR), ErrControlConnectionLost or ErrTransferCancelled
+}
+
+// TransferAbortHook can be implemented by a ClientHandlingDriver to be told about the transfers aborted by the client
+// (ABOR), by the loss of the control connection or by FtpServer.CancelTransfer, like to keep or clean up the partial
+// files
+type TransferAbortHook interface {
+	// TransferAborted is called once the file of the aborted RETR, STOR or APPE is closed
+	TransferAborted(cc ClientContext, transfer *AbortedTransfer)
+}
+
 // ClientContext is implemented on the server side to provide some access to few data around the client
 type ClientContext interface {
-	// Path provides the path of the current connection
+	// Path provides the current working directory of the connection, a clean absolute path managed by the server
 	Path() string
 
+	// ID returns the unique ID of the connection on the server
+	ID() uint32
+
+	// SessionUID returns a random ID of the session, unique across the restarts and the servers. It's in the logs, the
+	// events and the audit trail of the session, the data connections are logged with an ID derived from it.
+	SessionUID() string
+
+	// User returns the user announced on the connection
+	User() string
+
+	// Host returns the virtual host selected with HOST before the login, empty if the client didn't send it
+	Host() string
+
+	// Account returns the account announced with ACCT, empty if the client didn't send it. The driver can get it in
+	// AuthUser by returning ErrAccountRequired to ask for it.
+	Account() string
+
+	// ClientVersion returns the client software announced with CLNT, empty if the client didn't send it
+	ClientVersion() string
+
+	// TLSFingerprint returns a fingerprint of the TLS ClientHello of the control connection, which identifies the TLS
+	// stack of the client. It's empty until TLS is negotiated.
+	TLSFingerprint() string
+
 	// SetDebug activates the debugging of this connection commands
+	// Deprecated: Use SetLogVerbosity
 	SetDebug(debug bool)
 
 	// Debug returns the current debugging status of this connection commands
+	// Deprecated: Use LogVerbosity
 	Debug() bool
+
+	// SetLogVerbosity changes the logging of this connection commands and replies
+	SetLogVerbosity(verbosity LogVerbosity)
+
+	// LogVerbosity returns the logging of this connection commands and replies
+	LogVerbosity() LogVerbosity
+
+	// SetProtectedDataRequired defines if transfers on unprotected (PROT C) data connections should be refused
+	SetProtectedDataRequired(required bool)
+
+	// TransferContext returns the context of the current data transfer, cancelled when the client aborts it
+	TransferContext() context.Context
+
+	// RemoteAddr returns the address of the client
+	RemoteAddr() net.Addr
+
+	// RemoteHost returns the host name of the client found by the reverse lookup (Settings.ReverseLookup), empty if
+	// it's disabled or failed. It's known from the ConnectionChecker on.
+	RemoteHost() string
+
+	// LocalAddr returns the address of the server the client connected to
+	LocalAddr() net.Addr
+
+	// HasTLSForControl tells if the control connection is protected with TLS (AUTH TLS)
+	HasTLSForControl() bool
+
+	// TLSConnectionState returns the state of the TLS connection of the control connection: the negotiated version and
+	// cipher suite, and the peer certificates. It's nil until the TLS handshake is complete.
+	TLSConnectionState() *tls.ConnectionState
+
+	// DataProtection returns the protection level of the data connections (PROT): "P" for private, "C" for clear
+	DataProtection() string
+
+	// DataTLSConnectionState returns the state of the TLS connection of the current data connection. It's nil if the
+	// data connection isn't open yet, if it's unprotected or if its TLS handshake isn't complete.
+	DataTLSConnectionState() *tls.ConnectionState
+
+	// Stats returns a snapshot of the activity of the session (transferred bytes and files, executed commands...)
+	Stats() *SessionStats
+
+	// UserSessions returns the number of the other authenticated sessions of the user
+	UserSessions() int
+
+	// SetValue stores a value for the rest of the session, a nil value deletes the key. It can be called from any
+	// goroutine.
+	SetValue(key string, value interface{})
+
+	// GetValue returns the value stored for the key in the session, nil if there's none
+	GetValue(key string) interface{}
+
+	// Close ends the session from any hook or goroutine, like after detecting an abuse: the client gets a reply with
+	// the code (421 if 0, 4xx or 5xx like 530) and the message, then the connection is closed. The transfer in
+	// progress is aborted like when the control connection is lost.
+	Close(code int, message string) error
 }
 
 // FileStream is a read or write closeable stream
@@ -80,16 +485,133 @@ type FileStream interface {
 // PortRange is a range of ports
 type PortRange struct {
 	Start int // Range start
-	End   int // Range end
+	End   int // Range end (included)
 }
 
+// LogVerbosity defines what is logged of the FTP commands and replies.
+// The params of sensitive commands (like PASS) are always redacted.
+type LogVerbosity int
+
+const (
+	// LogNothing doesn't log any command
+	LogNothing LogVerbosity = iota
+	// LogCommands logs the received commands
+	LogCommands
+	// LogCommandsAndReplies logs the received commands and the sent replies
+	LogCommandsAndReplies
+)
+
+// DataConnectionsPolicy defines what happens when a session declares more data connections than allowed
+type DataConnectionsPolicy int
+
+const (
+	// DataConnectionsRefuse refuses the new data connection with a 425 reply
+	DataConnectionsRefuse DataConnectionsPolicy = iota
+	// DataConnectionsCloseOldest closes the oldest data connection of the session to make room for the new one
+	DataConnectionsCloseOldest
+)
+
+// UploadLockPolicy defines the access to the files being uploaded by another session
+type UploadLockPolicy int
+
+const (
+	// UploadLockNone gives access to the files being uploaded
+	UploadLockNone UploadLockPolicy = iota
+	// UploadLockUser refuses the downloads, uploads, deletions and renames of the files being uploaded by another
+	// session of the same user with a 450 reply
+	UploadLockUser
+	// UploadLockShared does the same for the sessions of all the users, for the drivers serving them the same tree
+	UploadLockShared
+)
+
+// DuplicateLoginPolicy defines what happens when a user who is already connected logs in again
+type DuplicateLoginPolicy int
+
+const (
+	// DuplicateLoginAllow accepts the new session next to the other ones, up to SessionSettings.MaxSessions
+	DuplicateLoginAllow DuplicateLoginPolicy = iota
+	// DuplicateLoginReject refuses the new login with a 421 reply once the user has MaxSessions sessions (1 if 0)
+	DuplicateLoginReject
+	// DuplicateLoginReplace accepts the new login and closes the oldest session of the user instead, once the user has
+	// MaxSessions sessions (1 if 0)
+	DuplicateLoginReplace
+)
+
 // Settings define all the server settings
 type Settings struct {
-	ListenHost                string     // Host to receive connections on
-	ListenPort                int        // Port to listen on
-	PublicHost                string     // Public IP to expose (only an IP address is accepted at this stage)
-	MaxConnections            int        // Max number of connections to accept
-	DataPortRange             *PortRange // Port Range for data connections. Random one will be used if not specified
-	DisableMLSD               bool       // Disable MLSD support
-	NonStandardActiveDataPort bool       // Allow to use a non-standard active data port
+	ListenHost                string                // Host to receive connections on
+	ListenPort                int                   // Port to listen on
+	PublicHost                string                // Public IP or host name (resolved on each PASV) to expose
+	PublicHostTTLSeconds      int                   // Cache duration of the PublicHost resolution (30s if 0, none if < 0)
+	ReverseLookup             bool                  // Find the host names of the clients, for the drivers and the logs
+	ReverseLookupTimeout      int                   // Milliseconds a reverse lookup can take (2000 if 0)
+	ReverseLookupCacheTTL     int                   // Seconds the host names of the clients are cached (300 if 0, none if < 0)
+	PublicIPRefreshSeconds    int                   // Period of the FtpServer.PublicIPResolver resolutions (only once if 0)
+	MaxConnections            int                   // Max number of connections to accept
+	ConnectionQueueSize       int                   // Connections held while MaxConnections is reached, waiting for a free slot (none if 0)
+	ConnectionQueueTimeout    int                   // Seconds a queued connection waits for a free slot (10s if 0)
+	ConnectionRetryAfter      int                   // Seconds suggested to the refused clients in a 421 reply (old 500 reply if 0)
+	DataPortRange             *PortRange            // Port Range for data connections. Random one will be used if not specified
+	PassivePorts              []int                 // Fixed set of passive ports, used instead of DataPortRange if defined
+	PassivePortOffset         int                   // Added to the passive ports in the PASV/EPSV replies (NAT remapping)
+	DisableMLSD               bool                  // Disable MLSD support
+	ListingCacheTTL           int                   // Seconds the LIST and MLSD listings are cached by virtual host, user and directory (none if 0)
+	ListRecursionDepth        int                   // Levels of subdirectories listed by LIST -R (the -R option is ignored if 0)
+	ListRecursionEntries      int                   // Max entries of a LIST -R listing, then truncated (10000 if 0)
+	NonStandardActiveDataPort bool                  // Allow to use a non-standard active data port
+	AllowFXP                  bool                  // Accept the PORT and EPRT targets other than the client (server-to-server transfers)
+	AllowPrivilegedTargets    bool                  // Accept the PORT and EPRT targets on the ports below 1024
+	DataSourceAddr            string                // IP or network interface the active dials and passive sockets are bound to (any if not specified)
+	ProtectedDataRequired     bool                  // Refuse transfers on data connections that aren't protected (PROT P)
+	TLSRequired               bool                  // Refuse authentication before the control connection is secured (AUTH TLS)
+	TLSUpgradeTimeout         int                   // Seconds after which the connections not secured are closed when TLS is required (never if 0)
+	TLSSessionReuseRequired   bool                  // Require data connections to resume the TLS session of the control connection
+	TransferBufferSize        int                   // Size of the buffers used for data transfers (32KB if not specified)
+	KeepAlivePeriod           int                   // Seconds between the TCP keepalive probes of all the connections (Go default if 0, none if < 0)
+	ControlSocketBufferSize   int                   // Size of the kernel send and receive buffers of the control connections (system default if 0)
+	DisableControlNoDelay     bool                  // Clear TCP_NODELAY on the control connections
+	DataSocketBufferSize      int                   // Size of the kernel send and receive buffers of the data connections (system default if 0)
+	DisableDataNoDelay        bool                  // Clear TCP_NODELAY on the data connections, letting the kernel merge small segments
+	CoalesceDataWrites        bool                  // Gather the download writes in TransferBufferSize chunks (fewer syscalls and TLS records)
+	UploadQueueSize           int                   // Max bytes of each upload read ahead of the writes of the driver, for the slow backends (written as they're read if 0)
+	TransferSummary           bool                  // Give the size, duration and rate of the file transfers in their 226 replies
+	MaxDataConnections        int                   // Max number of simultaneous data connections per session (unlimited if not specified)
+	DataConnectionsPolicy     DataConnectionsPolicy // What to do when a session reaches MaxDataConnections
+	UploadHashAlgorithm       string                // Hash computed on uploads for the PostUploadHook: "sha256", "md5" or none
+	AtomicUploads             bool                  // Write the STOR uploads to a temporary name, renamed once they succeed
+	UploadManifestSidecar     bool                  // Write a JSON manifest (name, size, checksum, uploader) next to each completed upload, as <name>.manifest.json
+	UploadManifestDir         string                // Local directory receiving the manifests of the completed uploads, mirroring the tree of each user (none if empty)
+	UploadLockPolicy          UploadLockPolicy      // Access of the other sessions to the files being uploaded
+	DuplicateLoginPolicy      DuplicateLoginPolicy  // What happens when a user logs in again while connected (allowed by default)
+	PartialUploadTTL          int                   // Seconds after which the partial files of the failed uploads are cleaned up (kept if 0)
+	BackendCheckInterval      int                   // Seconds between the checks of the backend of a BackendChecker driver (10 if 0)
+	LogVerbosity              LogVerbosity          // Default logging of the commands, it can be changed per connection
+	HealthListenAddr          string                // Address of the HTTP health endpoint (disabled if not specified)
+	DebugListenAddr           string                // Address of the HTTP debug endpoint: pprof and internals (disabled if not specified)
+	IdleTimeout               int                   // Seconds of inactivity after which a session is closed (never if 0)
+	MaxCommandLength          int                   // Max length of the command lines, in bytes (DefaultMaxCommandLength if 0)
+	DownloadTokenTTL          int                   // Seconds the download tokens of SITE TOKEN are valid (300 if 0)
+	RevokeDownloadTokens      bool                  // Revoke the download tokens of a session when it ends
+	DirSizeTimeout            int                   // Seconds the server walks a directory for SITE DIRSIZE without a DirectorySizer driver (10 if 0)
+	MaxTransferSize           int64                 // Max size of the transferred files, in bytes (unlimited if 0)
+	MaxUploadSize             int64                 // Max size of the uploaded files, in bytes (unlimited if 0)
+	DownloadBandwidth         int64                 // Max download speed of each transfer, in bytes per second (unlimited if 0)
+	UploadBandwidth           int64                 // Max upload speed of each transfer, in bytes per second (unlimited if 0)
+	GlobalBandwidth           int64                 // Max total speed of the transfers, shared by priority class and fairly between the users, in bytes per second (unlimited if 0)
+	BandwidthSchedule         []BandwidthProfile    // Limits of the transfers by time window, replacing the ones of the sessions (first match)
+	CommandRate               int                   // Max commands per second of each connection (unlimited if 0)
+	CommandBurst              int                   // Commands accepted in a burst beyond CommandRate (CommandRate if 0)
+	CommandRateWarnings       int                   // Refused commands before the connection is closed with a 421 (3 if 0)
+	MaxLoginFailures          int                   // Failed authentications before the connection is closed (1 if 0)
+	LoginFailureDelay         int                   // Milliseconds before the first 530 reply, doubled on each failure (none if 0)
+	FileNamePolicy            *FileNamePolicy       // Names refused for the uploaded and renamed files (all accepted if nil)
+	WORMPolicy                *WORMPolicy           // Write-once-read-many files, protected until their retention expires (none if nil)
+	HiddenFiles               HiddenFilesPolicy     // Handling of the dotfiles (listed like the other files by default)
+	DisabledCommands          []string              // Commands refused with a 502, like "DELE", "PORT" or "SITE CHMOD"
+	DisabledCommandMessage    string                // Message of the 502 replies to the disabled commands ("Command disabled" if empty)
+	UnknownCommandMessage     string                // Message of the 500 replies to the unknown commands ("Unknown command" if empty)
+	AuditUnsupportedCommands  bool                  // Report the unknown and disabled commands to the AuditSink
+	Banner                    string                // Welcome banner replacing the driver message, multi-line with variables
+	BannerFile                string                // File the Banner is loaded from when it isn't defined
+	HideServerInfo            bool                  // Don't disclose the server software (welcome message, STAT)
 }
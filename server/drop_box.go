@@ -0,0 +1,54 @@
+package server
+
+import "strings"
+
+// The refusals of the drop-box mode, where the files can be uploaded but never overwritten, downloaded nor deleted
+const (
+	dropBoxNoDownload  = "Downloads are not allowed in drop-box mode"
+	dropBoxNoDelete    = "Deletions are not allowed in drop-box mode"
+	dropBoxNoRename    = "Renames are not allowed in drop-box mode"
+	dropBoxNoOverwrite = "Files can't be overwritten in drop-box mode"
+)
+
+// dropBoxRefusals are the commands (and SITE subcommands) refused in drop-box mode, with their reply
+var dropBoxRefusals = map[string]string{
+	"RETR":         dropBoxNoDownload,
+	"SITE TOKEN":   dropBoxNoDownload,
+	"DELE":         dropBoxNoDelete,
+	"RMD":          dropBoxNoDelete,
+	"RNFR":         dropBoxNoRename,
+	"RNTO":         dropBoxNoRename,
+	"APPE":         dropBoxNoOverwrite,
+	"COMB":         dropBoxNoOverwrite,
+	"SITE COMBINE": dropBoxNoOverwrite,
+}
+
+// checkDropBox refuses the commands that would give access to the files of a drop-box session
+func (c *clientHandler) checkDropBox() bool {
+	if !c.session.DropBox {
+		return true
+	}
+	command := c.command
+	if command == "SITE" {
+		if fields := strings.Fields(c.param); len(fields) > 0 {
+			command += " " + strings.ToUpper(fields[0])
+		}
+	}
+	if message, ok := dropBoxRefusals[command]; ok {
+		c.writeMessage(550, message)
+		return false
+	}
+	return true
+}
+
+// checkDropBoxUpload refuses the uploads of a drop-box session that would overwrite a file
+func (c *clientHandler) checkDropBoxUpload(path string) bool {
+	if !c.session.DropBox {
+		return true
+	}
+	if _, err := c.driver.GetFileInfo(c, path); err == nil {
+		c.writeMessage(553, dropBoxNoOverwrite)
+		return false
+	}
+	return true
+}
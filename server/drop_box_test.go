@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+// dropBoxDriver has a single existing file
+type dropBoxDriver struct {
+	ClientHandlingDriver
+	info os.FileInfo
+}
+
+func (d *dropBoxDriver) GetFileInfo(cc ClientContext, path string) (os.FileInfo, error) {
+	if path == "/existing" {
+		return d.info, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (d *dropBoxDriver) OpenFile(cc ClientContext, path string, flag int) (FileStream, error) {
+	return nil, ErrPermissionDenied
+}
+
+func TestDropBox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	info, _ := os.Stat(dir)
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var buf bytes.Buffer
+	recorder := &auditRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, AuditSink: recorder},
+		driver: &dropBoxDriver{info: info}, path: "/", conn: conn, session: SessionSettings{DropBox: true}}
+
+	for _, test := range [][2]string{
+		{"RETR existing", "550 Downloads are not allowed in drop-box mode\r\n"},
+		{"DELE existing", "550 Deletions are not allowed in drop-box mode\r\n"},
+		{"RNFR existing", "550 Renames are not allowed in drop-box mode\r\n"},
+		{"APPE existing", "550 Files can't be overwritten in drop-box mode\r\n"},
+		{"SITE COMBINE a b", "550 Files can't be overwritten in drop-box mode\r\n"},
+		{"SITE TOKEN existing", "550 Downloads are not allowed in drop-box mode\r\n"},
+	} {
+		buf.Reset()
+		c.handleCommand(test[0] + "\r\n")
+		if buf.String() != test[1] {
+			t.Fatalf("Bad reply to %s: %q", test[0], buf.String())
+		}
+	}
+	if len(recorder.events) != 6 || recorder.events[0].Type != AuditPermissionDenied {
+		t.Fatal("The refusals should be audited:", len(recorder.events))
+	}
+
+	// The new files can be uploaded, not the existing ones
+	buf.Reset()
+	c.param = "existing"
+	c.handleSTOR()
+	c.param = "new"
+	c.handleSTOR()
+	if expected := "553 Files can't be overwritten in drop-box mode\r\n550 Could not open file: permission denied\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies to the uploads: %q", buf.String())
+	}
+}
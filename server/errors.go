@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// The errors the drivers can return to get the standard reply of a failure, see errorCodes
+var (
+	// ErrQuotaExceeded can be returned by the driver when there's no space left for the user
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrPermissionDenied can be returned by the driver when the user isn't allowed to perform an action
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrNotFound can be returned by the driver when a file or a directory doesn't exist
+	ErrNotFound = errors.New("no such file or directory")
+
+	// ErrNotDir can be returned by the driver when a directory is expected but the path is a file
+	ErrNotDir = errors.New("not a directory")
+
+	// ErrFileUnavailable can be returned by the driver when a file is temporarily unavailable (locked, busy, storage
+	// unreachable...), the client can try again later
+	ErrFileUnavailable = errors.New("file temporarily unavailable")
+
+	// ErrInsufficientStorage can be returned by the driver when the storage is full (for everyone)
+	ErrInsufficientStorage = errors.New("insufficient storage space")
+
+	// ErrFileNameNotAllowed can be returned by the driver when the name of a file isn't allowed
+	ErrFileNameNotAllowed = errors.New("file name not allowed")
+
+	// ErrNoMetadata can be returned by a MetadataProvider for the entries without a size or a modification date
+	ErrNoMetadata = errors.New("no metadata available")
+
+	// ErrUnknownSiteCommand can be returned by a SiteCommandHandler for the subcommands it doesn't know
+	ErrUnknownSiteCommand = errors.New("unknown SITE subcommand")
+)
+
+var (
+	// ErrAccountRequired can be returned by MainDriver.AuthUser when the user must send an account (ACCT) to log in,
+	// the authentication is attempted again with the same password once it's received
+	ErrAccountRequired = errors.New("account required")
+
+	// ErrTooManySessions can be returned by MainDriver.AuthUser to refuse a login because the user already has too many
+	// sessions (see ClientContext.UserSessions), the connection is closed with a 421 reply
+	ErrTooManySessions = errors.New("too many sessions")
+)
+
+var (
+
+	// ErrTransferSizeExceeded is returned when a transfer goes beyond the max transfer size of the session
+	ErrTransferSizeExceeded = errors.New("max transfer size exceeded")
+
+	// ErrUploadSizeExceeded is returned when an upload goes beyond the max upload size of the session
+	ErrUploadSizeExceeded = errors.New("max upload size exceeded")
+
+	// ErrTransferAborted is reported for the transfers interrupted by the client (ABOR)
+	ErrTransferAborted = errors.New("transfer aborted")
+
+	// ErrControlConnectionLost is reported for the transfers interrupted by the end of the control connection
+	ErrControlConnectionLost = errors.New("control connection lost")
+
+	// ErrTransferCancelled is reported for the transfers interrupted by the server, see FtpServer.CancelTransfer
+	ErrTransferCancelled = errors.New("transfer cancelled")
+
+	// ErrNoTransfer is returned by FtpServer.CancelTransfer when the session isn't transferring the file
+	ErrNoTransfer = errors.New("no such transfer in progress")
+
+	// ErrNoCapture is returned by FtpServer.Capture and FtpServer.StopCapture when the session isn't captured
+	ErrNoCapture = errors.New("the session isn't captured")
+)
+
+var (
+	// ErrCommandTooLong is returned by ParseCommand for the lines longer than the max command length
+	ErrCommandTooLong = errors.New("command line too long")
+
+	// ErrIllegalCharacter is returned by ParseCommand for the lines with a CR, a LF or a NUL before their end
+	ErrIllegalCharacter = errors.New("illegal character in the command line")
+)
+
+// AuthChallenge can be returned by MainDriver.AuthUser to ask the user for one more secret (a one-time password, a
+// second factor...), the response is passed to the ChallengeAuthenticator of the driver
+type AuthChallenge struct {
+	Code   int    // 336 for a response sent with PASS (the default), 332 for one sent with ACCT
+	Prompt string // Challenge shown to the user
+}
+
+func (e *AuthChallenge) Error() string {
+	return "authentication challenge: " + e.Prompt
+}
+
+// ReplyError can be returned by the driver to choose the reply sent to the client, instead of the default code and
+// message of the command
+type ReplyError struct {
+	Code    int    // Reply code, like 450 for a temporary failure or 553 for a name that isn't allowed
+	Message string // Reply message, the default one of the command if empty
+	Err     error  // Underlying error (optional)
+}
+
+func (e *ReplyError) Error() string {
+	if e.Message != "" || e.Err == nil {
+		return e.Message
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ReplyError) Unwrap() error {
+	return e.Err
+}
+
+// mapError returns the reply to send for an error of the driver: the one chosen by its ErrorMapper or the ReplyError,
+// or the default code and message of the command otherwise
+func (c *clientHandler) mapError(code int, message string, err error) (int, string) {
+	if mapper, ok := c.driver.(ErrorMapper); ok {
+		if mappedCode, mappedMessage := mapper.MapError(c, c.command, err); mappedCode != 0 {
+			if mappedMessage == "" {
+				mappedMessage = message
+			}
+			return mappedCode, mappedMessage
+		}
+	}
+
+	if replyErr := findReplyError(err); replyErr != nil && replyErr.Code != 0 {
+		code = replyErr.Code
+		if replyErr.Message != "" {
+			message = replyErr.Message
+		}
+	} else if standardCode := errorCode(err); standardCode != 0 {
+		code = standardCode
+	}
+
+	return code, message
+}
+
+// errorCodes are the RFC 959 replies of the standard failures
+var errorCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrNotFound, 550},
+	{ErrNotDir, 550},
+	{ErrNoMetadata, 550},
+	{ErrPermissionDenied, 550},
+	{ErrQuotaExceeded, 552},
+	{ErrInsufficientStorage, 452},
+	{ErrFileNameNotAllowed, 553},
+	{ErrFileUnavailable, 450},
+}
+
+// errorCode returns the reply code of a standard failure, 0 for the other errors. The errors of the os package are
+// recognized too.
+func errorCode(err error) int {
+	for _, standard := range errorCodes {
+		if isError(err, standard.err) {
+			return standard.code
+		}
+	}
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return 550
+	}
+	return 0
+}
+
+// isError tells if an error is, or wraps, another one
+func isError(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Unwrap()
+	}
+	return false
+}
+
+// findReplyError looks for a ReplyError in a chain of wrapped errors
+func findReplyError(err error) *ReplyError {
+	for err != nil {
+		if replyErr, ok := err.(*ReplyError); ok {
+			return replyErr
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return nil
+		}
+		err = wrapper.Unwrap()
+	}
+	return nil
+}
+
+// writeError replies to a command that failed because of an error of the driver
+func (c *clientHandler) writeError(code int, message string, err error) {
+	c.writeMessage(c.mapError(code, message, err))
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// errorsDriver fails the deletions with its error, and maps the errors with its mapper
+type errorsDriver struct {
+	ClientHandlingDriver
+	err    error
+	mapper func(command string, err error) (int, string)
+}
+
+func (d *errorsDriver) DeleteFile(cc ClientContext, path string) error {
+	return d.err
+}
+
+// wrappedError wraps an error like the layered drivers do
+type wrappedError struct{ err error }
+
+func (e *wrappedError) Error() string { return "wrapped: " + e.err.Error() }
+
+func (e *wrappedError) Unwrap() error { return e.err }
+
+type mappingDriver struct{ *errorsDriver }
+
+func (d mappingDriver) MapError(cc ClientContext, command string, err error) (int, string) {
+	return d.mapper(command, err)
+}
+
+func TestReplyError(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &errorsDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, driver: driver}
+
+	for _, test := range []struct {
+		err   error
+		reply string
+	}{
+		{errors.New("not there"), "550 Couldn't delete /file: not there\r\n"},
+		{&ReplyError{Code: 450, Message: "Storage busy, try again"}, "450 Storage busy, try again\r\n"},
+		{&ReplyError{Code: 553, Err: errors.New("bad name")}, "553 Couldn't delete /file: bad name\r\n"},
+		{&wrappedError{&ReplyError{Code: 450, Message: "Busy"}}, "450 Busy\r\n"},
+	} {
+		buf.Reset()
+		driver.err = test.err
+		c.handleCommand("DELE file\r\n")
+		if buf.String() != test.reply {
+			t.Fatalf("Bad reply for %v: %q", test.err, buf.String())
+		}
+	}
+}
+
+func TestErrorMapper(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &errorsDriver{err: errors.New("timeout")}
+	driver.mapper = func(command string, err error) (int, string) {
+		if command == "DELE" && err.Error() == "timeout" {
+			return 450, ""
+		}
+		return 0, ""
+	}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, driver: mappingDriver{driver}}
+
+	c.handleCommand("DELE file\r\n")
+	if buf.String() != "450 Couldn't delete /file: timeout\r\n" {
+		t.Fatalf("The error should be mapped: %q", buf.String())
+	}
+
+	buf.Reset()
+	driver.err = errors.New("other")
+	c.handleCommand("DELE file\r\n")
+	if buf.String() != "550 Couldn't delete /file: other\r\n" {
+		t.Fatalf("The error should keep its default reply: %q", buf.String())
+	}
+}
+
+func TestStandardErrors(t *testing.T) {
+	c := &clientHandler{driver: &errorsDriver{}}
+
+	_, statErr := os.Stat("/does/not/exist")
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{ErrNotFound, 550},
+		{ErrQuotaExceeded, 552},
+		{ErrInsufficientStorage, 452},
+		{ErrFileNameNotAllowed, 553},
+		{ErrFileUnavailable, 450},
+		{&wrappedError{ErrFileUnavailable}, 450},
+		{statErr, 550},
+		{os.ErrPermission, 550},
+		{errors.New("other"), 451},
+	} {
+		if code, message := c.mapError(451, "Failed", test.err); code != test.code || message != "Failed" {
+			t.Fatal("Bad reply for", test.err, code, message)
+		}
+	}
+}
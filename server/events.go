@@ -0,0 +1,62 @@
+package server
+
+import "time"
+
+// EventType is the type of an activity event
+type EventType string
+
+const (
+	// EventConnected is the connection of a client
+	EventConnected EventType = "session.connected"
+	// EventLogin is the authentication of a client
+	EventLogin EventType = "session.login"
+	// EventDisconnected is the end of a session
+	EventDisconnected EventType = "session.disconnected"
+	// EventUpload is the end of an upload (STOR or APPE), successful or not
+	EventUpload EventType = "transfer.upload"
+	// EventDownload is the end of a download (RETR), successful or not
+	EventDownload EventType = "transfer.download"
+)
+
+// Event is a session or transfer event
+type Event struct {
+	Time       time.Time     `json:"time"`               // Time of the event
+	Type       EventType     `json:"type"`               // Type of the event
+	SessionID  uint32        `json:"session"`            // ID of the client session
+	SessionUID string        `json:"session_uid"`        // Unique ID of the client session
+	User       string        `json:"user,omitempty"`     // User, as given by the client
+	RemoteAddr string        `json:"remote_addr"`        // Address of the client
+	Path       string        `json:"path,omitempty"`     // Path of the transferred file
+	Size       int64         `json:"size,omitempty"`     // Number of bytes transferred
+	Duration   time.Duration `json:"duration,omitempty"` // Duration of the transfer or of the session
+	Error      string        `json:"error,omitempty"`    // Error of the failed transfers
+}
+
+// EventListener receives the activity of the server, to export it to some other systems
+type EventListener interface {
+	// Event is called for each event, it shouldn't block
+	Event(event *Event)
+}
+
+// emitEvent reports an event of the session to the event listener
+func (c *clientHandler) emitEvent(eventType EventType, path string, size int64, duration time.Duration, err error) {
+	listener := c.daddy.EventListener
+	if listener == nil {
+		return
+	}
+	event := &Event{
+		Time:       time.Now(),
+		Type:       eventType,
+		SessionID:  c.id,
+		SessionUID: c.uid,
+		User:       c.User(),
+		RemoteAddr: c.conn.RemoteAddr().String(),
+		Path:       path,
+		Size:       size,
+		Duration:   duration,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	listener.Event(event)
+}
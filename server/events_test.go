@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// eventRecorder keeps the events
+type eventRecorder struct {
+	events []*Event
+}
+
+func (r *eventRecorder) Event(event *Event) {
+	r.events = append(r.events, event)
+}
+
+func TestEmitEvent(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	recorder := &eventRecorder{}
+	c := &clientHandler{daddy: &FtpServer{EventListener: recorder}, conn: conn, id: 7}
+	c.setUser("bob")
+	c.emitEvent(EventDownload, "/file", 12, 0, errors.New("broken pipe"))
+
+	if len(recorder.events) != 1 {
+		t.Fatal("The event should have been emitted")
+	}
+	if e := recorder.events[0]; e.Type != EventDownload || e.SessionID != 7 || e.User != "bob" || e.Path != "/file" ||
+		e.Size != 12 || e.Error != "broken pipe" {
+		t.Fatal("Bad event:", e)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FileNamePolicy defines the names refused for the uploaded and renamed files
+type FileNamePolicy struct {
+	BannedExtensions []string // Refused extensions, like ".exe" (case insensitive)
+	Patterns         []string // Regular expressions matching the refused names
+	MaxNameLength    int      // Max number of characters of a name (unlimited if 0)
+	ForbiddenChars   string   // Characters refused in the names
+}
+
+// fileNameChecker applies a FileNamePolicy
+type fileNameChecker struct {
+	policy     *FileNamePolicy
+	extensions map[string]bool
+	patterns   []*regexp.Regexp
+}
+
+func newFileNameChecker(policy *FileNamePolicy) (*fileNameChecker, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	checker := &fileNameChecker{policy: policy, extensions: make(map[string]bool)}
+	for _, ext := range policy.BannedExtensions {
+		checker.extensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	for _, pattern := range policy.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad file name pattern %q: %v", pattern, err)
+		}
+		checker.patterns = append(checker.patterns, re)
+	}
+	return checker, nil
+}
+
+// check returns why a name is refused, nil if it's accepted
+func (checker *fileNameChecker) check(name string) error {
+	if max := checker.policy.MaxNameLength; max > 0 && utf8.RuneCountInString(name) > max {
+		return fmt.Errorf("names are limited to %d characters", max)
+	}
+	if i := strings.IndexAny(name, checker.policy.ForbiddenChars); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(name[i:])
+		return fmt.Errorf("the %q character is forbidden", r)
+	}
+	if ext := path.Ext(name); ext != "" && checker.extensions[strings.ToLower(ext[1:])] {
+		return fmt.Errorf("the %s extension is banned", ext)
+	}
+	for _, re := range checker.patterns {
+		if re.MatchString(name) {
+			return fmt.Errorf("the name matches the refused pattern %s", re)
+		}
+	}
+	return nil
+}
+
+// FileNameValidator can be implemented by a ClientHandlingDriver to refuse some names for the uploaded (STOR, APPE)
+// and renamed (RNTO) files, in addition to the Settings.FileNamePolicy. It's called before any data is transferred.
+type FileNameValidator interface {
+	// ValidateFileName returns why a path is refused, nil if it's accepted
+	ValidateFileName(cc ClientContext, path string) error
+}
+
+// checkFileName refuses the names rejected by the policy or by the driver with a 553 reply
+func (c *clientHandler) checkFileName(p string) bool {
+	var err error
+	if checker := c.daddy.fileNames; checker != nil {
+		err = checker.check(path.Base(p))
+	}
+	if validator, ok := c.driver.(FileNameValidator); ok && err == nil {
+		err = validator.ValidateFileName(c, p)
+	}
+	if err != nil {
+		c.writeMessage(553, fmt.Sprintf("File name not allowed: %v", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFileNamePolicy(t *testing.T) {
+	checker, err := newFileNameChecker(&FileNamePolicy{
+		BannedExtensions: []string{".exe", "BAT"},
+		Patterns:         []string{`^~\$`, `(?i)^thumbs\.db$`},
+		MaxNameLength:    20,
+		ForbiddenChars:   `:*?"<>|`,
+	})
+	if err != nil {
+		t.Fatal("Couldn't create the checker:", err)
+	}
+
+	for _, name := range []string{"report.pdf", "archive.tar.gz", "exe", "café.txt"} {
+		if err := checker.check(name); err != nil {
+			t.Fatal(name, "should be accepted:", err)
+		}
+	}
+	for _, name := range []string{"setup.EXE", "run.bat", "~$draft.docx", "Thumbs.db", "a:b.txt",
+		strings.Repeat("x", 21)} {
+		if err := checker.check(name); err == nil {
+			t.Fatal(name, "should be refused")
+		}
+	}
+
+	if _, err := newFileNameChecker(&FileNamePolicy{Patterns: []string{"("}}); err == nil {
+		t.Fatal("Bad patterns should be reported")
+	}
+}
+
+// nameDriver refuses the names with spaces
+type nameDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *nameDriver) ValidateFileName(cc ClientContext, path string) error {
+	if strings.Contains(path, " ") {
+		return errors.New("no spaces")
+	}
+	return nil
+}
+
+func TestFileNameValidator(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{daddy: &FtpServer{}, driver: &nameDriver{}, writer: bufio.NewWriter(&replies)}
+
+	if !c.checkFileName("/dir/file.txt") || replies.Len() != 0 {
+		t.Fatal("The driver should accept the path")
+	}
+	if c.checkFileName("/dir with spaces/file.txt") {
+		t.Fatal("The driver should refuse the path")
+	}
+	if reply := replies.String(); reply != "553 File name not allowed: no spaces\r\n" {
+		t.Fatal("Bad reply:", reply)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build gofuzz
+// +build gofuzz
+
+package server
+
+import "strings"
+
+// Fuzz is the go-fuzz entry point of the command parser (go-fuzz-build ./server && go-fuzz). The accepted lines must
+// never carry a line break or a NUL into the command or its param.
+func Fuzz(data []byte) int {
+	command, param, err := ParseCommand(string(data), 0)
+	if err != nil {
+		return 0
+	}
+	if strings.ContainsAny(command+param, "\r\n\x00") || strings.Contains(command, " ") {
+		panic("unsafe command parsed: " + command + " " + param)
+	}
+	return 1
+}
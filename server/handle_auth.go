@@ -1,23 +1,198 @@
 package server
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
-// Handle the "USER" command
+// maxLoginFailureDelay caps the delay before the reply of a failed authentication
+const maxLoginFailureDelay = 30 * time.Second
+
+// Handle the "HOST" command, which selects a virtual host before the login (RFC 7151)
+func (c *clientHandler) handleHOST() {
+	if c.user != "" || c.driver != nil {
+		c.writeMessage(503, "HOST must be sent before USER")
+		return
+	}
+	host := strings.ToLower(strings.TrimSpace(c.param))
+	if host == "" {
+		c.writeMessage(501, "Missing host")
+		return
+	}
+	if selector, ok := c.daddy.driver.(VirtualHostSelector); ok {
+		if err := selector.SelectHost(c, host); err != nil {
+			c.writeMessage(504, fmt.Sprintf("Unknown host %s: %v", host, err))
+			return
+		}
+	}
+
+	c.paramsMutex.Lock()
+	c.host = host
+	c.paramsMutex.Unlock()
+	c.writeMessage(220, "Host accepted")
+}
+
+// Handle the "USER" command, a logged in user is logged out first so that the session never runs under a name that
+// didn't authenticate
 func (c *clientHandler) handleUSER() {
-	c.user = c.param
+	if !c.checkControlProtection() || !c.checkMaintenance() {
+		return
+	}
+	if c.driver != nil {
+		c.closeDriver()
+	}
+	c.setUser(c.param)
+	c.pendPass = ""
+	c.challenge = nil
 	c.writeMessage(331, "OK")
 }
 
 // Handle the "PASS" command
 func (c *clientHandler) handlePASS() {
-	var err error
-	if c.driver, err = c.daddy.driver.AuthUser(c, c.user, c.param); err == nil {
+	if !c.checkControlProtection() {
+		return
+	}
+	if c.challenge != nil && c.challenge.Code != 332 {
+		c.respondChallenge(c.param)
+		return
+	}
+	c.authenticate(c.param)
+}
+
+// Handle the "ACCT" command
+func (c *clientHandler) handleACCT() {
+	if !c.checkControlProtection() {
+		return
+	}
+	if c.param == "" {
+		c.writeMessage(501, "Missing account")
+		return
+	}
+	if c.challenge != nil && c.challenge.Code == 332 {
+		c.respondChallenge(c.param)
+		return
+	}
+	c.paramsMutex.Lock()
+	c.account = c.param
+	c.paramsMutex.Unlock()
+
+	// The account completes the login the driver asked it for
+	if c.pendPass != "" {
+		c.authenticate(c.pendPass)
+		return
+	}
+	c.writeMessage(202, "Account noted")
+}
+
+// authenticate logs the user in with the driver
+func (c *clientHandler) authenticate(pass string) {
+	c.closeDriver()
+	c.pendPass = ""
+	c.challenge = nil
+	// The maintenance might have started after USER
+	if !c.checkMaintenance() {
+		return
+	}
+
+	driver, err := c.daddy.driver.AuthUser(c, c.user, pass)
+	if isError(err, ErrAccountRequired) && c.Account() == "" {
+		c.pendPass = pass
+		c.writeMessage(332, "Need account for login")
+		return
+	}
+	c.authenticated(driver, err)
+}
+
+// respondChallenge passes the response of the client to the challenge of the driver
+func (c *clientHandler) respondChallenge(response string) {
+	c.challenge = nil
+	driver, err := c.daddy.driver.(ChallengeAuthenticator).AuthChallengeResponse(c, c.user, response)
+	c.authenticated(driver, err)
+}
+
+// authenticated replies to an authentication step: the user is logged in, challenged again or refused. The driver is
+// only attached to the session once the authentication succeeded, not with a challenge.
+func (c *clientHandler) authenticated(driver ClientHandlingDriver, err error) {
+	if err == nil {
+		c.driver = driver
+		c.applySessionSettings()
+		if !c.daddy.login(c, c.session.MaxSessions, c.session.DuplicateLogins) {
+			err = ErrTooManySessions
+		}
+	}
+	if err == nil {
+		c.loginFails = 0
+		c.countLogin()
+		c.audit(AuditLogin, "", "", nil)
+		c.emitEvent(EventLogin, "", 0, 0, nil)
 		c.writeMessage(230, "Password ok, continue")
-	} else if err != nil {
-		c.writeMessage(530, fmt.Sprintf("Authentication problem: %v", err))
+		return
+	}
+
+	if isError(err, ErrTooManySessions) {
+		c.closeDriver()
+		c.audit(AuditLoginFailed, "", "", err)
+		c.logger.Warn("Too many sessions", logKeyAction, "ftp.too_many_sessions", "user", c.User())
+		c.writeMessage(421, "Too many sessions for this user, closing the connection")
 		c.disconnect()
-	} else {
-		c.writeMessage(530, "I can't deal with you (nil driver)")
+		c.reader = nil
+		return
+	}
+
+	// The challenges can only be answered with a ChallengeAuthenticator, they're failures otherwise
+	if challenge, ok := err.(*AuthChallenge); ok {
+		if _, ok := c.daddy.driver.(ChallengeAuthenticator); ok {
+			c.challenge = challenge
+			if challenge.Code != 332 {
+				challenge.Code = 336
+			}
+			c.writeMessage(challenge.Code, challenge.Prompt)
+			return
+		}
+	}
+
+	c.audit(AuditLoginFailed, "", "", err)
+	c.loginFailed(err)
+}
+
+// loginFailed replies to a failed authentication after a delay growing with the consecutive failures, the connection
+// is closed once there are too many of them
+func (c *clientHandler) loginFailed(err error) {
+	c.loginFails++
+	if delay := loginFailureDelay(c.daddy.Settings.LoginFailureDelay, c.loginFails); delay > 0 {
+		time.Sleep(delay)
+	}
+	c.writeMessage(530, fmt.Sprintf("Authentication problem: %v", err))
+
+	max := c.daddy.Settings.MaxLoginFailures
+	if max <= 0 {
+		max = 1
+	}
+	if c.loginFails >= max {
+		c.logger.Warn("Too many failed logins", logKeyAction, "ftp.login_failures", "failures", c.loginFails)
 		c.disconnect()
+		c.reader = nil
+	}
+}
+
+// loginFailureDelay returns the delay before the reply of the nth consecutive failed authentication
+func loginFailureDelay(base, failures int) time.Duration {
+	delay := time.Duration(base) * time.Millisecond
+	for i := 1; i < failures && delay < maxLoginFailureDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginFailureDelay {
+		return maxLoginFailureDelay
+	}
+	return delay
+}
+
+// checkControlProtection prevents the credentials from being sent in cleartext when TLS is required
+func (c *clientHandler) checkControlProtection() bool {
+	if c.daddy.Settings.TLSRequired && !c.controlTLS {
+		c.writeMessage(534, "TLS is required, use AUTH TLS first")
+		return false
 	}
+	return true
 }
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closingDriver counts the times it's closed
+type closingDriver struct {
+	ClientHandlingDriver
+	closed int
+}
+
+func (d *closingDriver) Close(cc ClientContext) error {
+	d.closed++
+	return nil
+}
+
+// factoryDriver creates a new closingDriver for each authentication
+type factoryDriver struct {
+	MainDriver
+	drivers []*closingDriver
+}
+
+func (d *factoryDriver) AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error) {
+	driver := &closingDriver{}
+	d.drivers = append(d.drivers, driver)
+	return driver, nil
+}
+
+func TestDriverClosed(t *testing.T) {
+	var buf bytes.Buffer
+	factory := &factoryDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, driver: factory}}
+
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS test\r\n")
+	c.handleCommand("PASS test\r\n")
+	if len(factory.drivers) != 2 || factory.drivers[0] == factory.drivers[1] {
+		t.Fatal("Each authentication should get its own driver")
+	}
+	if factory.drivers[0].closed != 1 || factory.drivers[1].closed != 0 {
+		t.Fatal("The driver of the previous authentication should be closed")
+	}
+
+	c.closeDriver()
+	c.closeDriver()
+	if factory.drivers[1].closed != 1 || c.driver != nil {
+		t.Fatal("The driver should be closed once at the end of the session")
+	}
+}
+
+func TestUSERAfterLogin(t *testing.T) {
+	var buf bytes.Buffer
+	factory := &factoryDriver{}
+	server := &FtpServer{Settings: &Settings{}, driver: factory, connectionsByID: make(map[uint32]*clientHandler)}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server, id: 1, logger: nopLogger{}}
+	server.connectionsByID[c.id] = c
+
+	c.handleCommand("USER alice\r\n")
+	c.handleCommand("PASS test\r\n")
+	if server.UserSessions("alice") != 1 {
+		t.Fatal("Alice should be logged in")
+	}
+
+	// The new user has to authenticate before the session can be used
+	buf.Reset()
+	c.handleCommand("USER bob\r\n")
+	c.handleCommand("PWD\r\n")
+	if buf.String() != "331 OK\r\n530 Please login with USER and PASS\r\n" {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if c.driver != nil || factory.drivers[0].closed != 1 || server.UserSessions("alice") != 0 ||
+		server.UserSessions("bob") != 0 {
+		t.Fatal("The session of alice should be logged out")
+	}
+}
+
+// refusingDriver refuses all the authentications
+type refusingDriver struct{ MainDriver }
+
+func (d *refusingDriver) AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error) {
+	return nil, errors.New("bad password")
+}
+
+func TestLoginFailureDelay(t *testing.T) {
+	for _, tc := range []struct {
+		base, failures int
+		delay          time.Duration
+	}{
+		{0, 3, 0},
+		{100, 1, 100 * time.Millisecond},
+		{100, 3, 400 * time.Millisecond},
+		{1000, 10, maxLoginFailureDelay},
+		{1000, 1000, maxLoginFailureDelay},
+	} {
+		if delay := loginFailureDelay(tc.base, tc.failures); delay != tc.delay {
+			t.Fatalf("Wrong delay for %d failures from %d ms: %v", tc.failures, tc.base, delay)
+		}
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	settings := &Settings{MaxLoginFailures: 3, LoginFailureDelay: 1}
+	c := &clientHandler{
+		writer: bufio.NewWriter(&buf),
+		reader: bufio.NewReader(server),
+		conn:   server,
+		daddy:  &FtpServer{Settings: settings, driver: &refusingDriver{}, Logger: nopLogger{}},
+		logger: nopLogger{},
+	}
+
+	c.handleCommand("PASS bad\r\n")
+	c.handleCommand("PASS bad\r\n")
+	if c.reader == nil || c.loginFails != 2 {
+		t.Fatal("The connection should still be open:", c.loginFails)
+	}
+
+	c.handleCommand("PASS bad\r\n")
+	if c.reader != nil {
+		t.Fatal("The connection should be closed after 3 failures")
+	}
+	expected := "530 Authentication problem: bad password\r\n"
+	if buf.String() != expected+expected+expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
+
+// accountDriver requires an account to log in
+type accountDriver struct {
+	MainDriver
+	pass string
+}
+
+func (d *accountDriver) AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error) {
+	d.pass = pass
+	if cc.Account() == "" {
+		return nil, ErrAccountRequired
+	}
+	return &closingDriver{}, nil
+}
+
+func TestACCT(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &accountDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, driver: driver}}
+
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS secret\r\n")
+	c.handleCommand("ACCT\r\n")
+	c.handleCommand("ACCT dept42\r\n")
+	if expected := "331 OK\r\n332 Need account for login\r\n501 Missing account\r\n230 Password ok, continue\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if c.driver == nil || driver.pass != "secret" || c.Account() != "dept42" || c.pendPass != "" {
+		t.Fatal("The user should be logged in with the password and the account")
+	}
+
+	// Without any pending login, the account is kept for the next one
+	buf.Reset()
+	c.handleCommand("ACCT dept43\r\n")
+	if buf.String() != "202 Account noted\r\n" || c.Account() != "dept43" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+}
+
+// otpDriver asks for a one-time password after the password
+type otpDriver struct{ MainDriver }
+
+func (d *otpDriver) AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error) {
+	if pass != "secret" {
+		return nil, errors.New("bad password")
+	}
+	return nil, &AuthChallenge{Prompt: "Enter the code of your token"}
+}
+
+func (d *otpDriver) AuthChallengeResponse(cc ClientContext, user, response string) (ClientHandlingDriver, error) {
+	if response != "123456" {
+		return nil, errors.New("bad code")
+	}
+	return &closingDriver{}, nil
+}
+
+func TestAuthChallenge(t *testing.T) {
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	c := &clientHandler{
+		writer: bufio.NewWriter(&buf),
+		reader: bufio.NewReader(server),
+		conn:   server,
+		daddy:  &FtpServer{Settings: &Settings{MaxLoginFailures: 2}, driver: &otpDriver{}},
+		logger: nopLogger{},
+	}
+
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS secret\r\n")
+	if c.driver != nil || c.challenge == nil {
+		t.Fatal("The user shouldn't be logged in before the challenge response")
+	}
+	c.handleCommand("PASS 000000\r\n")
+	c.handleCommand("PASS secret\r\n")
+	c.handleCommand("PASS 123456\r\n")
+	expected := "331 OK\r\n336 Enter the code of your token\r\n530 Authentication problem: bad code\r\n" +
+		"336 Enter the code of your token\r\n230 Password ok, continue\r\n"
+	if buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if c.driver == nil || c.challenge != nil || c.loginFails != 0 {
+		t.Fatal("The user should be logged in")
+	}
+
+	// A driver given with a challenge isn't attached to the session before the response
+	c.closeDriver()
+	buf.Reset()
+	c.authenticated(&closingDriver{}, &AuthChallenge{Prompt: "Code?"})
+	if c.driver != nil || c.challenge == nil || buf.String() != "336 Code?\r\n" {
+		t.Fatalf("The session shouldn't get the driver of a challenge: %q", buf.String())
+	}
+
+	// Without a ChallengeAuthenticator, the challenges are failures
+	c.challenge = nil
+	buf.Reset()
+	c.daddy.driver = &accountDriver{}
+	c.authenticated(nil, &AuthChallenge{Prompt: "Code?"})
+	if c.challenge != nil || buf.String() != "530 Authentication problem: authentication challenge: Code?\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+}
+
+// limitedDriver allows a single session per user
+type limitedDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *limitedDriver) SessionSettings(cc ClientContext) *SessionSettings {
+	return &SessionSettings{MaxSessions: 1}
+}
+
+// sessionsDriver limits the sessions of alice with the session settings, and the ones of bob itself
+type sessionsDriver struct {
+	MainDriver
+}
+
+func (d *sessionsDriver) AuthUser(cc ClientContext, user, pass string) (ClientHandlingDriver, error) {
+	if user == "bob" {
+		if cc.UserSessions() >= 2 {
+			return nil, ErrTooManySessions
+		}
+		return &closingDriver{}, nil
+	}
+	return &limitedDriver{}, nil
+}
+
+func TestMaxSessions(t *testing.T) {
+	server := &FtpServer{
+		Settings:        &Settings{},
+		driver:          &sessionsDriver{},
+		connectionsByID: make(map[uint32]*clientHandler),
+		Logger:          nopLogger{},
+	}
+	login := func(id uint32, user string) (*clientHandler, string) {
+		conn, client := net.Pipe()
+		go io.Copy(ioutil.Discard, client)
+		var buf bytes.Buffer
+		c := &clientHandler{writer: bufio.NewWriter(&buf), reader: bufio.NewReader(conn), conn: conn, daddy: server,
+			id: id, logger: nopLogger{}}
+		server.connectionsByID[id] = c
+		c.handleCommand("USER " + user + "\r\n")
+		buf.Reset()
+		c.handleCommand("PASS test\r\n")
+		return c, buf.String()
+	}
+
+	first, reply := login(1, "alice")
+	if reply != "230 Password ok, continue\r\n" {
+		t.Fatalf("The first session should be accepted: %q", reply)
+	}
+	second, reply := login(2, "alice")
+	if reply != "421 Too many sessions for this user, closing the connection\r\n" || second.reader != nil {
+		t.Fatalf("The second session should be refused: %q", reply)
+	}
+	if server.UserSessions("alice") != 1 {
+		t.Fatal("Only the first session should be counted:", server.UserSessions("alice"))
+	}
+
+	// The sessions are released with the driver
+	first.closeDriver()
+	if _, reply = login(3, "alice"); reply != "230 Password ok, continue\r\n" {
+		t.Fatalf("The session should be accepted once the first one is over: %q", reply)
+	}
+
+	// The driver can limit the sessions itself
+	login(4, "bob")
+	login(5, "bob")
+	if _, reply = login(6, "bob"); reply != "421 Too many sessions for this user, closing the connection\r\n" {
+		t.Fatalf("The third session should be refused: %q", reply)
+	}
+	if nb := server.UserSessions("bob"); nb != 2 {
+		t.Fatal("Wrong number of sessions:", nb)
+	}
+}
+
+func TestDuplicateLoginPolicy(t *testing.T) {
+	server := &FtpServer{
+		Settings:        &Settings{DuplicateLoginPolicy: DuplicateLoginReplace},
+		driver:          &sessionsDriver{},
+		connectionsByID: make(map[uint32]*clientHandler),
+		Logger:          nopLogger{},
+	}
+	login := func(id uint32, user string) (*clientHandler, *bytes.Buffer, net.Conn) {
+		conn, client := net.Pipe()
+		go io.Copy(ioutil.Discard, client)
+		var buf bytes.Buffer
+		c := &clientHandler{writer: bufio.NewWriter(&buf), reader: bufio.NewReader(conn), conn: conn, daddy: server,
+			id: id, logger: nopLogger{}, connectedAt: time.Now()}
+		c.session = newSessionSettings(server.Settings)
+		server.connectionsByID[id] = c
+		c.handleCommand("USER " + user + "\r\n")
+		buf.Reset()
+		c.handleCommand("PASS test\r\n")
+		return c, &buf, client
+	}
+
+	_, oldest, oldestClient := login(1, "bob")
+	_, newest, _ := login(2, "bob")
+	if newest.String() != "230 Password ok, continue\r\n" {
+		t.Fatalf("The new session should be accepted: %q", newest.String())
+	}
+	if oldest.String() != "230 Password ok, continue\r\n421 Session replaced by a new login, closing the connection\r\n" {
+		t.Fatalf("The old session should be replaced: %q", oldest.String())
+	}
+	if _, err := oldestClient.Write([]byte("NOOP\r\n")); err == nil {
+		t.Fatal("The connection of the old session should be closed")
+	}
+	if nb := server.UserSessions("bob"); nb != 1 {
+		t.Fatal("Wrong number of sessions:", nb)
+	}
+
+	server.Settings.DuplicateLoginPolicy = DuplicateLoginReject
+	if _, reply, _ := login(3, "bob"); reply.String() != "421 Too many sessions for this user, closing the connection\r\n" {
+		t.Fatalf("The new session should be refused: %q", reply.String())
+	}
+	if nb := server.UserSessions("bob"); nb != 1 {
+		t.Fatal("Wrong number of sessions:", nb)
+	}
+}
+
+// hostDriver only accepts one virtual host
+type hostDriver struct{ factoryDriver }
+
+func (d *hostDriver) SelectHost(cc ClientContext, host string) error {
+	if host != "ftp.example.com" {
+		return errors.New("not served")
+	}
+	return nil
+}
+
+func TestHOST(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, driver: &hostDriver{}}}
+
+	c.handleCommand("HOST\r\n")
+	c.handleCommand("HOST other.example.com\r\n")
+	c.handleCommand("HOST FTP.example.com\r\n")
+	if buf.String() != "501 Missing host\r\n504 Unknown host other.example.com: not served\r\n220 Host accepted\r\n" ||
+		c.Host() != "ftp.example.com" {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+
+	buf.Reset()
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("HOST ftp.example.com\r\n")
+	if buf.String() != "331 OK\r\n503 HOST must be sent before USER\r\n" {
+		t.Fatalf("HOST should be refused after USER: %q", buf.String())
+	}
+}
+
+func TestTLSRequired(t *testing.T) {
+	var buf bytes.Buffer
+	factory := &factoryDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{TLSRequired: true},
+		driver: factory}, logger: nopLogger{}}
+
+	// The credentials are never sent in cleartext
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS test\r\n")
+	c.handleCommand("ACCT test\r\n")
+	if expected := strings.Repeat("534 TLS is required, use AUTH TLS first\r\n", 3); buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if len(factory.drivers) != 0 {
+		t.Fatal("The user shouldn't be authenticated")
+	}
+
+	buf.Reset()
+	c.controlTLS = true
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS test\r\n")
+	if !strings.HasPrefix(buf.String(), "331 OK\r\n230 ") || len(factory.drivers) != 1 {
+		t.Fatalf("The user should be authenticated over TLS: %q", buf.String())
+	}
+}
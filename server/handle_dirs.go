@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -9,23 +10,18 @@ import (
 	"time"
 )
 
+// absPath resolves a path of the client against the current working directory, the drivers only get clean absolute
+// paths (no ".", "..", double or trailing slashes) that can't go above the root
 func (c *clientHandler) absPath(p string) string {
-	p2 := c.Path()
-
-	if strings.HasPrefix(p, "/") {
-		p2 = p
-	} else {
-		if p2 != "/" {
-			p2 += "/"
-		}
-		p2 += p
-	}
-
-	if p2 != "/" && strings.HasSuffix(p2, "/") {
-		p2 = p2[0 : len(p2)-1]
+	if !strings.HasPrefix(p, "/") {
+		p = c.Path() + "/" + p
 	}
+	return cleanPath(p)
+}
 
-	return p2
+// cleanPath normalizes an absolute path, the ".." of the root being the root itself
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
 }
 
 func (c *clientHandler) handleCWD() {
@@ -36,11 +32,11 @@ func (c *clientHandler) handleCWD() {
 
 	p := c.absPath(c.param)
 
-	if err := c.driver.ChangeDirectory(c, p); err == nil {
+	if err := c.changeDirectory(p); err == nil {
 		c.SetPath(p)
 		c.writeMessage(250, fmt.Sprintf("CD worked on %s", p))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("CD issue: %v", err))
+		c.writeError(550, fmt.Sprintf("CD issue: %v", err), err)
 	}
 }
 
@@ -49,29 +45,29 @@ func (c *clientHandler) handleMKD() {
 	if err := c.driver.MakeDirectory(c, p); err == nil {
 		c.writeMessage(257, fmt.Sprintf("Created dir %s", p))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("Could not create %s : %v", p, err))
+		c.auditDenial(p, err)
+		c.writeError(550, fmt.Sprintf("Could not create %s : %v", p, err), err)
 	}
 }
 
 func (c *clientHandler) handleRMD() {
 	p := c.absPath(c.param)
-	if err := c.driver.DeleteFile(c, p); err == nil {
+	err := c.driver.DeleteFile(c, p)
+	c.auditOperation(AuditDelete, p, "", err)
+	if err == nil {
 		c.writeMessage(250, fmt.Sprintf("Deleted dir %s", p))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("Could not delete dir %s: %v", p, err))
+		c.writeError(550, fmt.Sprintf("Could not delete dir %s: %v", p, err), err)
 	}
 }
 
 func (c *clientHandler) handleCDUP() {
-	parent, _ := path.Split(c.Path())
-	if parent != "/" && strings.HasSuffix(parent, "/") {
-		parent = parent[0 : len(parent)-1]
-	}
-	if err := c.driver.ChangeDirectory(c, parent); err == nil {
+	parent := path.Dir(c.Path())
+	if err := c.changeDirectory(parent); err == nil {
 		c.SetPath(parent)
 		c.writeMessage(250, fmt.Sprintf("CDUP worked on %s", parent))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("CDUP issue: %v", err))
+		c.writeError(550, fmt.Sprintf("CDUP issue: %v", err), err)
 	}
 }
 
@@ -80,14 +76,30 @@ func (c *clientHandler) handlePWD() {
 }
 
 func (c *clientHandler) handleLIST() {
-	if files, err := c.driver.ListFiles(c); err == nil {
-		if tr, err := c.TransferOpen(); err == nil {
-			defer c.TransferClose()
-			c.dirTransferLIST(tr, files)
-		}
-	} else {
-		c.writeMessage(500, fmt.Sprintf("Could not list: %v", err))
+	pattern := listPattern(c.param)
+	if _, err := path.Match(pattern, ""); err != nil {
+		c.writeMessage(501, fmt.Sprintf("Bad pattern %s", pattern))
+		return
+	}
+	if pattern == "" && listRecursive(c.param) && c.daddy.Settings.ListRecursionDepth > 0 {
+		c.transferRecursiveList()
+		return
+	}
+	c.transferFileList(pattern, c.dirTransferLIST)
+}
+
+// listPattern returns the glob pattern of a LIST or NLST argument ("*.csv", "-la data-2023*"), an empty string if it
+// has none. The patterns are only supported on the names of the current directory.
+func listPattern(param string) string {
+	fields := strings.Fields(param)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+		fields = fields[1:]
 	}
+	pattern := strings.Join(fields, " ")
+	if !strings.ContainsAny(pattern, "*?[") || strings.Contains(pattern, "/") {
+		return ""
+	}
+	return pattern
 }
 
 func (c *clientHandler) handleMLSD() {
@@ -95,16 +107,220 @@ func (c *clientHandler) handleMLSD() {
 		c.writeMessage(500, "MLSD has been disabled")
 		return
 	}
-	if files, err := c.driver.ListFiles(c); err == nil {
-		if tr, err := c.TransferOpen(); err == nil {
-			defer c.TransferClose()
-			c.dirTransferMLSD(tr, files)
+	c.transferFileList("", c.dirTransferMLSD)
+}
+
+// walkFiles calls the callback for each file of the current directory, streaming them when the driver supports it,
+// then for its virtual entries
+func (c *clientHandler) walkFiles(callback func(os.FileInfo) error) error {
+	virtual := c.virtualListing()
+	if !virtual.directory {
+		err := c.walkDriverFiles(func(file os.FileInfo) error {
+			if virtual.shadows(file) {
+				return nil
+			}
+			return callback(file)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range virtual.files {
+		if err := callback(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDriverFiles calls the callback for each file of the current directory listed by the driver
+func (c *clientHandler) walkDriverFiles(callback func(os.FileInfo) error) error {
+	if iterator, ok := c.fileIterator(); ok {
+		files, err := iterator.IterateFiles(c)
+		if err != nil {
+			return err
+		}
+		defer files.Close()
+		return iterateFiles(files, callback)
+	}
+
+	if streamer, ok := c.driver.(FileListStreamer); ok {
+		return streamer.StreamFiles(c, callback)
+	}
+
+	if pager, ok := c.driver.(FileListPager); ok {
+		return walkFilesPages(c, pager, callback)
+	}
+
+	files, err := c.listFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := callback(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkFilesPages fetches the pages of files one after the other
+func walkFilesPages(cc ClientContext, pager FileListPager, callback func(os.FileInfo) error) error {
+	token := ""
+	for {
+		files, nextToken, err := pager.ListFilesPage(cc, token)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := callback(file); err != nil {
+				return err
+			}
+		}
+
+		if nextToken == "" {
+			return nil
+		}
+		token = nextToken
+	}
+}
+
+// fileIterator returns the FileListIterator of the driver, unless the listings are cached (the cache needs them all)
+func (c *clientHandler) fileIterator() (FileListIterator, bool) {
+	iterator, ok := c.driver.(FileListIterator)
+	return iterator, ok && c.listingCacheTTL() <= 0
+}
+
+// iterateFiles pulls the files of an iterator one after the other
+func iterateFiles(files FileIterator, callback func(os.FileInfo) error) error {
+	for {
+		file, err := files.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := callback(file); err != nil {
+			return err
 		}
-	} else {
-		c.writeMessage(500, fmt.Sprintf("Could not list: %v", err))
 	}
 }
 
+// streamsFiles tells if the driver provides the files progressively, in which case errors can only be reported
+// after the transfer connection is opened
+func (c *clientHandler) streamsFiles() bool {
+	switch c.driver.(type) {
+	case FileListStreamer, FileListPager:
+		return true
+	}
+	return false
+}
+
+// transferFileList sends the files of the current directory matching the pattern (all of them if empty) on the
+// transfer connection with the provided format
+func (c *clientHandler) transferFileList(pattern string, format func(io.Writer, os.FileInfo) error) {
+	if !c.checkPathProtection(c.Path()) {
+		return
+	}
+
+	matcher, matching := c.driver.(FileListMatcher)
+	matching = matching && pattern != ""
+	iterator, iterating := c.fileIterator()
+	iterating = iterating && !matching
+	streaming := !matching && !iterating && c.streamsFiles()
+	virtual := c.virtualListing()
+	if virtual.directory {
+		matching, iterating, streaming = false, false, false
+	}
+
+	var files []os.FileInfo
+	var iterated FileIterator
+	if iterating {
+		// The iterator is opened before the transfer connection to report its errors, the files are pulled later
+		var err error
+		if iterated, err = iterator.IterateFiles(c); err != nil {
+			c.writeError(500, fmt.Sprintf("Could not list: %v", err), err)
+			return
+		}
+		defer iterated.Close()
+	} else if !streaming && !virtual.directory {
+		// When we have everything upfront, errors can be reported before opening the transfer connection
+		var err error
+		if matching {
+			files, err = matcher.ListFilesMatching(c, pattern)
+		} else {
+			files, err = c.listFiles()
+		}
+		if err != nil {
+			c.writeError(500, fmt.Sprintf("Could not list: %v", err), err)
+			return
+		}
+	}
+
+	tr, err := c.TransferOpen()
+	if err != nil {
+		return
+	}
+
+	w := bufio.NewWriter(tr)
+	filter := c.listingFilter()
+	emit := func(file os.FileInfo) error {
+		if filter != nil && !filter(file) {
+			return nil
+		}
+		if pattern != "" && !matching {
+			if ok, _ := path.Match(pattern, file.Name()); !ok {
+				return nil
+			}
+		}
+		return format(w, file)
+	}
+	write := func(file os.FileInfo) error {
+		if virtual.shadows(file) {
+			return nil
+		}
+		return emit(file)
+	}
+
+	switch {
+	case iterating:
+		err = iterateFiles(iterated, write)
+	case streaming:
+		err = c.walkDriverFiles(write)
+	default:
+		for _, file := range files {
+			if err = write(file); err != nil {
+				break
+			}
+		}
+	}
+	// The driver matching the pattern can't match the virtual entries
+	for _, file := range virtual.files {
+		if err != nil {
+			break
+		}
+		if ok, _ := path.Match(pattern, file.Name()); ok || pattern == "" {
+			err = emit(file)
+		}
+	}
+
+	if err == nil {
+		if _, err = fmt.Fprint(w, "\r\n"); err == nil {
+			err = w.Flush()
+		}
+	}
+
+	if err != nil {
+		c.transferCloseWith(c.mapError(451, fmt.Sprintf("Could not list: %v", err), err))
+		return
+	}
+
+	c.TransferClose()
+}
+
 const (
 	dateFormatStatTime      = "Jan _2 15:04"          // LIST date formatting with hour and minute
 	dateFormatStatYear      = "Jan _2  2006"          // LIST date formatting with year
@@ -126,38 +342,53 @@ func (c *clientHandler) fileStat(file os.FileInfo) string {
 
 	return fmt.Sprintf(
 		"%s 1 ftp ftp %12d %s %s",
-		file.Mode(),
+		listMode(file.Mode()),
 		file.Size(),
 		file.ModTime().Format(dateFormat),
 		file.Name(),
 	)
 }
 
-func (c *clientHandler) dirTransferLIST(w io.Writer, files []os.FileInfo) error {
-	for _, file := range files {
-		fmt.Fprintf(w, "%s\r\n", c.fileStat(file))
+// listMode formats a file mode the way "ls -l" does. os.FileMode.String can add some letters that LIST parsers don't
+// expect (like the ones of the Windows specific attributes).
+func listMode(mode os.FileMode) string {
+	fileType := "-"
+	switch {
+	case mode&os.ModeDir != 0:
+		fileType = "d"
+	case mode&os.ModeSymlink != 0:
+		fileType = "l"
+	case mode&os.ModeNamedPipe != 0:
+		fileType = "p"
+	case mode&os.ModeSocket != 0:
+		fileType = "s"
+	case mode&os.ModeCharDevice != 0:
+		fileType = "c"
+	case mode&os.ModeDevice != 0:
+		fileType = "b"
 	}
-	fmt.Fprint(w, "\r\n")
-	return nil
+	return fileType + mode.Perm().String()[1:]
 }
 
-func (c *clientHandler) dirTransferMLSD(w io.Writer, files []os.FileInfo) error {
-	for _, file := range files {
-		var listType string
-		if file.IsDir() {
-			listType = "dir"
-		} else {
-			listType = "file"
-		}
-		fmt.Fprintf(
-			w,
-			"Type=%s;Size=%d;Modify=%s; %s\r\n",
-			listType,
-			file.Size(),
-			file.ModTime().Format(dateFormatMLSD),
-			file.Name(),
-		)
-	}
-	fmt.Fprint(w, "\r\n")
-	return nil
+func (c *clientHandler) dirTransferLIST(w io.Writer, file os.FileInfo) error {
+	_, err := fmt.Fprintf(w, "%s\r\n", c.fileStat(file))
+	return err
+}
+
+func (c *clientHandler) dirTransferMLSD(w io.Writer, file os.FileInfo) error {
+	var listType string
+	if file.IsDir() {
+		listType = "dir"
+	} else {
+		listType = "file"
+	}
+	_, err := fmt.Fprintf(
+		w,
+		"Type=%s;Size=%d;Modify=%s; %s\r\n",
+		listType,
+		file.Size(),
+		file.ModTime().Format(dateFormatMLSD),
+		file.Name(),
+	)
+	return err
 }
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedDriver returns three pages of two files
+type pagedDriver struct {
+	calls int
+}
+
+func (d *pagedDriver) ListFilesPage(cc ClientContext, token string) ([]os.FileInfo, string, error) {
+	d.calls++
+	page := 0
+	if token != "" {
+		var err error
+		if page, err = strconv.Atoi(token); err != nil {
+			return nil, "", errors.New("bad token")
+		}
+	}
+
+	files := []os.FileInfo{nil, nil}
+	if page == 2 {
+		return files, "", nil
+	}
+	return files, strconv.Itoa(page + 1), nil
+}
+
+func TestWalkFilesPages(t *testing.T) {
+	driver := &pagedDriver{}
+	nb := 0
+	if err := walkFilesPages(nil, driver, func(os.FileInfo) error {
+		nb++
+		return nil
+	}); err != nil {
+		t.Fatal("Couldn't walk the pages:", err)
+	}
+	if nb != 6 || driver.calls != 3 {
+		t.Fatal("Bad number of files or pages:", nb, driver.calls)
+	}
+}
+
+func TestWalkFilesPagesStop(t *testing.T) {
+	driver := &pagedDriver{}
+	stop := errors.New("stop")
+	if err := walkFilesPages(nil, driver, func(os.FileInfo) error {
+		return stop
+	}); err != stop {
+		t.Fatal("The callback error should have been returned:", err)
+	}
+	if driver.calls != 1 {
+		t.Fatal("Pages shouldn't have been fetched after the error:", driver.calls)
+	}
+}
+
+func TestListMode(t *testing.T) {
+	for mode, expected := range map[os.FileMode]string{
+		0644:                                 "-rw-r--r--",
+		os.ModeDir | 0755:                    "drwxr-xr-x",
+		os.ModeSymlink | 0777:                "lrwxrwxrwx",
+		os.ModeDir | os.ModeTemporary:        "d---------",
+		os.ModeAppend | os.ModeSetuid | 0600: "-rw-------",
+	} {
+		if actual := listMode(mode); actual != expected {
+			t.Fatal("Bad mode for", mode, ":", actual)
+		}
+	}
+}
+
+func TestListPattern(t *testing.T) {
+	for param, pattern := range map[string]string{
+		"":                 "",
+		"-la":              "",
+		"*.csv":            "*.csv",
+		"-l data-2023*":    "data-2023*",
+		"report [0-9].txt": "report [0-9].txt",
+		"dir":              "",
+		"dir/*.csv":        "",
+	} {
+		if listPattern(param) != pattern {
+			t.Fatalf("Bad pattern for %q: %q", param, listPattern(param))
+		}
+	}
+}
+
+// listingDriver lists some files
+type listingDriver struct {
+	ClientHandlingDriver
+	files []os.FileInfo
+}
+
+func (d *listingDriver) ListFiles(cc ClientContext) ([]os.FileInfo, error) {
+	return d.files, nil
+}
+
+// matchingDriver filters the listings itself
+type matchingDriver struct {
+	listingDriver
+	pattern string
+}
+
+func (d *matchingDriver) ListFilesMatching(cc ClientContext, pattern string) ([]os.FileInfo, error) {
+	d.pattern = pattern
+	return d.files[:1], nil
+}
+
+// list runs a LIST and returns the names of the listed files
+func list(c *clientHandler) []string {
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	listing := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		listing <- data
+	}()
+	c.handleLIST()
+	names := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(<-listing)), "\r\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[len(fields)-1])
+		}
+	}
+	return names
+}
+
+func TestLISTPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.csv", "b.txt", "c.csv"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	files, _ := ioutil.ReadDir(dir)
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, path: "/",
+		driver: &listingDriver{files: files}}
+
+	c.param = "-l *.csv"
+	if names := list(c); strings.Join(names, ",") != "a.csv,c.csv" {
+		t.Fatal("The listing should be filtered by the server:", names)
+	}
+
+	// The drivers supporting the patterns filter the listings themselves
+	matcher := &matchingDriver{listingDriver: listingDriver{files: files}}
+	c.driver = matcher
+	c.param = "*.txt"
+	if names := list(c); len(names) != 1 || matcher.pattern != "*.txt" {
+		t.Fatal("The pattern should be passed to the driver:", names, matcher.pattern)
+	}
+
+	buf.Reset()
+	c.param = "[a-"
+	c.handleLIST()
+	if buf.String() != "501 Bad pattern [a-\r\n" {
+		t.Fatalf("Bad reply to a bad pattern: %q", buf.String())
+	}
+}
+
+// iteratorDriver provides its files one by one
+type iteratorDriver struct {
+	ClientHandlingDriver
+	files  []os.FileInfo
+	err    error
+	closed bool
+}
+
+func (d *iteratorDriver) IterateFiles(cc ClientContext) (FileIterator, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d, nil
+}
+
+func (d *iteratorDriver) Next() (os.FileInfo, error) {
+	if len(d.files) == 0 {
+		return nil, io.EOF
+	}
+	file := d.files[0]
+	d.files = d.files[1:]
+	return file, nil
+}
+
+func (d *iteratorDriver) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestLISTIterator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.csv", "b.txt", "c.csv"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	files, _ := ioutil.ReadDir(dir)
+
+	var buf bytes.Buffer
+	driver := &iteratorDriver{files: files}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, path: "/", driver: driver}
+
+	c.param = "*.csv"
+	if names := list(c); strings.Join(names, ",") != "a.csv,c.csv" || !driver.closed {
+		t.Fatal("Wrong listing:", names, driver.closed)
+	}
+
+	// The errors of the opening are reported before the transfer connection is opened
+	buf.Reset()
+	driver.err = errors.New("bucket unreachable")
+	c.transfer = nil
+	c.handleLIST()
+	if buf.String() != "500 Could not list: bucket unreachable\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+}
+
+// streamerDriver streams its files, then fails with its error
+type streamerDriver struct {
+	ClientHandlingDriver
+	files []os.FileInfo
+	err   error
+}
+
+func (d *streamerDriver) StreamFiles(cc ClientContext, callback func(os.FileInfo) error) error {
+	for _, file := range d.files {
+		if err := callback(file); err != nil {
+			return err
+		}
+	}
+	return d.err
+}
+
+func TestLISTStreamer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.csv", "b.txt", "c.csv"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	files, _ := ioutil.ReadDir(dir)
+
+	var buf bytes.Buffer
+	driver := &streamerDriver{files: files}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, path: "/", driver: driver}
+
+	if names := list(c); strings.Join(names, ",") != "a.csv,b.txt,c.csv" {
+		t.Fatal("Wrong listing:", names)
+	}
+
+	// The errors can only be reported once the files are being sent
+	buf.Reset()
+	driver.err = errors.New("bucket unreachable")
+	list(c)
+	c.writer.Flush()
+	if reply := buf.String(); !strings.HasPrefix(reply, "150 ") || !strings.HasSuffix(reply, "451 Could not list: bucket unreachable\r\n") {
+		t.Fatalf("Wrong replies: %q", reply)
+	}
+}
+
+func TestAbsPath(t *testing.T) {
+	c := &clientHandler{path: "/home/user"}
+	for p, expected := range map[string]string{
+		"":              "/home/user",
+		".":             "/home/user",
+		"docs/":         "/home/user/docs",
+		"../other//a/.": "/home/other/a",
+		"/var/../etc/":  "/etc",
+		"../../../..":   "/",
+		"/..":           "/",
+	} {
+		if abs := c.absPath(p); abs != expected {
+			t.Fatalf("Wrong path of %q: %s", p, abs)
+		}
+	}
+
+	c.SetPath("/data/./reports/")
+	if c.Path() != "/data/reports" {
+		t.Fatal("The working directory should be clean:", c.Path())
+	}
+}
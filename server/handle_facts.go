@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The facts that can be modified with MFF, see modifiableFacts
+const (
+	factModify = "Modify"
+	factCreate = "Create"
+	factMode   = "UNIX.mode"
+)
+
+// factsDriver returns the driver the supported facts are checked on: the one of the session, or the main driver
+// before the authentication (for the ones serving the sessions themselves)
+func (c *clientHandler) factsDriver() interface{} {
+	if c.driver != nil {
+		return c.driver
+	}
+	return c.daddy.driver
+}
+
+// modifiableFacts returns the facts the driver can modify, UNIX.mode is always supported through ChmodFile
+func (c *clientHandler) modifiableFacts() []string {
+	driver := c.factsDriver()
+	facts := []string{}
+	if _, ok := driver.(FileTimesChanger); ok {
+		facts = append(facts, factModify)
+	}
+	if _, ok := driver.(CreationTimeChanger); ok {
+		facts = append(facts, factCreate)
+	}
+	return append(facts, factMode)
+}
+
+// factsFeatures returns the FEAT lines of MFF and MFCT
+func (c *clientHandler) factsFeatures() []string {
+	facts := c.modifiableFacts()
+	features := []string{"MFF " + strings.Join(facts, ";") + ";"}
+	if _, ok := c.factsDriver().(CreationTimeChanger); ok {
+		features = append(features, "MFCT")
+	}
+	return features
+}
+
+// handleMFF modifies some facts of a file: MFF Modify=20060102150405;UNIX.mode=0644; path
+func (c *clientHandler) handleMFF() {
+	spl := strings.SplitN(c.param, " ", 2)
+	if len(spl) != 2 || spl[1] == "" || !strings.HasSuffix(spl[0], ";") {
+		c.writeMessage(501, "Couldn't parse MFF: expected facts and a path")
+		return
+	}
+
+	// All the facts are checked before any of them is applied
+	facts := make(map[string]string)
+	for _, fact := range strings.Split(strings.TrimSuffix(spl[0], ";"), ";") {
+		kv := strings.SplitN(fact, "=", 2)
+		if len(kv) != 2 {
+			c.writeMessage(501, fmt.Sprintf("Couldn't parse MFF fact %q", fact))
+			return
+		}
+		name := c.modifiableFact(kv[0])
+		if name == "" {
+			c.writeMessage(504, fmt.Sprintf("Fact %s can't be modified", kv[0]))
+			return
+		}
+		if err := checkFactValue(name, kv[1]); err != nil {
+			c.writeMessage(501, fmt.Sprintf("Couldn't parse MFF fact %s: %v", kv[0], err))
+			return
+		}
+		facts[name] = kv[1]
+	}
+
+	path := c.absPath(spl[1])
+	if !c.checkHiddenPath(path) || !c.checkUploadManifest(path) || !c.checkWORM(path) {
+		return
+	}
+	names := make([]string, 0, len(facts))
+	for name := range facts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed strings.Builder
+	for _, name := range names {
+		if err := c.modifyFact(path, name, facts[name]); err != nil {
+			c.writeError(550, fmt.Sprintf("Could not modify %s of %s: %v", name, path, err), err)
+			return
+		}
+		fmt.Fprintf(&changed, "%s=%s;", name, facts[name])
+	}
+	c.writeMessage(213, fmt.Sprintf("%s %s", changed.String(), path))
+}
+
+// handleMFCT modifies the creation time of a file: MFCT 20060102150405 path
+func (c *clientHandler) handleMFCT() {
+	changer, ok := c.driver.(CreationTimeChanger)
+	if !ok {
+		c.writeMessage(502, "MFCT not supported")
+		return
+	}
+
+	spl := strings.SplitN(c.param, " ", 2)
+	if len(spl) != 2 || spl[1] == "" {
+		c.writeMessage(501, "Couldn't parse MFCT: expected a time and a path")
+		return
+	}
+	ctime, err := parseFactTime(spl[0])
+	if err != nil {
+		c.writeMessage(501, fmt.Sprintf("Couldn't parse MFCT: %v", err))
+		return
+	}
+
+	path := c.absPath(spl[1])
+	if !c.checkHiddenPath(path) || !c.checkUploadManifest(path) || !c.checkWORM(path) {
+		return
+	}
+	if err = changer.SetCreationTime(c, path, ctime); err != nil {
+		c.writeError(550, fmt.Sprintf("Could not modify the creation time of %s: %v", path, err), err)
+		return
+	}
+	c.writeMessage(213, fmt.Sprintf("%s=%s; %s", factCreate, spl[0], path))
+}
+
+// modifiableFact returns the canonical name of a fact the driver can modify, an empty string otherwise
+func (c *clientHandler) modifiableFact(name string) string {
+	for _, fact := range c.modifiableFacts() {
+		if strings.EqualFold(fact, name) {
+			return fact
+		}
+	}
+	return ""
+}
+
+// checkFactValue checks the value of a fact
+func checkFactValue(name, value string) error {
+	if name == factMode {
+		_, err := strconv.ParseUint(value, 8, 32)
+		return err
+	}
+	_, err := parseFactTime(value)
+	return err
+}
+
+// modifyFact applies a checked fact to a file
+func (c *clientHandler) modifyFact(path, name, value string) error {
+	switch name {
+	case factModify:
+		mtime, _ := parseFactTime(value)
+		return c.driver.(FileTimesChanger).Chtimes(c, path, mtime, mtime)
+	case factCreate:
+		ctime, _ := parseFactTime(value)
+		return c.driver.(CreationTimeChanger).SetCreationTime(c, path, ctime)
+	case factMode:
+		mode, _ := strconv.ParseUint(value, 8, 32)
+		return c.driver.ChmodFile(c, path, os.FileMode(mode))
+	}
+	return errors.New("unknown fact")
+}
+
+// parseFactTime parses the time of a fact (YYYYMMDDHHMMSS, with optional fractions of a second), in UTC
+func parseFactTime(value string) (time.Time, error) {
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value = value[:i]
+	}
+	return time.Parse("20060102150405", value)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// factsRecorder records the modified facts
+type factsRecorder struct {
+	ClientHandlingDriver
+	mtime time.Time
+	ctime time.Time
+	mode  os.FileMode
+}
+
+func (d *factsRecorder) Chtimes(cc ClientContext, path string, atime, mtime time.Time) error {
+	d.mtime = mtime
+	return nil
+}
+
+func (d *factsRecorder) SetCreationTime(cc ClientContext, path string, ctime time.Time) error {
+	d.ctime = ctime
+	return nil
+}
+
+func (d *factsRecorder) ChmodFile(cc ClientContext, path string, mode os.FileMode) error {
+	d.mode = mode
+	return nil
+}
+
+// modeDriver can only change the modes
+type modeDriver struct {
+	ClientHandlingDriver
+}
+
+func TestFactsFeatures(t *testing.T) {
+	c := &clientHandler{daddy: &FtpServer{}, driver: &modeDriver{}}
+	if features := strings.Join(c.factsFeatures(), ","); features != "MFF UNIX.mode;" {
+		t.Fatal("Wrong features:", features)
+	}
+	c.driver = &factsRecorder{}
+	if features := strings.Join(c.factsFeatures(), ","); features != "MFF Modify;Create;UNIX.mode;,MFCT" {
+		t.Fatal("Wrong features:", features)
+	}
+}
+
+func TestMFF(t *testing.T) {
+	var replies bytes.Buffer
+	driver := &factsRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}}, driver: driver,
+		path: "/"}
+
+	c.param = "modify=20060102150405.123;UNIX.mode=0640; file.txt"
+	c.handleMFF()
+	if replies.String() != "213 Modify=20060102150405.123;UNIX.mode=0640; /file.txt\r\n" {
+		t.Fatalf("Wrong reply: %q", replies.String())
+	}
+	if !driver.mtime.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) || driver.mode != 0640 {
+		t.Fatal("The facts should be modified:", driver.mtime, driver.mode)
+	}
+
+	for params, reply := range map[string]string{
+		"file.txt":                "501 Couldn't parse MFF: expected facts and a path",
+		"Size=12; file.txt":       "504 Fact Size can't be modified",
+		"UNIX.mode=999; file.txt": "501 Couldn't parse MFF fact UNIX.mode",
+		"Modify; file.txt":        "501 Couldn't parse MFF fact \"Modify\"",
+	} {
+		replies.Reset()
+		c.param = params
+		c.handleMFF()
+		if !strings.HasPrefix(replies.String(), reply) {
+			t.Fatalf("Wrong reply to %q: %q", params, replies.String())
+		}
+	}
+
+	// Only the mode can be modified without the optional interfaces
+	replies.Reset()
+	c.driver = &modeDriver{}
+	c.param = "Modify=20060102150405; file.txt"
+	c.handleMFF()
+	if replies.String() != "504 Fact Modify can't be modified\r\n" {
+		t.Fatalf("Wrong reply: %q", replies.String())
+	}
+}
+
+func TestMFCT(t *testing.T) {
+	var replies bytes.Buffer
+	driver := &factsRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}}, driver: driver,
+		path: "/dir"}
+
+	c.param = "20060102150405 my file"
+	c.handleMFCT()
+	c.param = "2006 file"
+	c.handleMFCT()
+	c.driver = &modeDriver{}
+	c.handleMFCT()
+	if !strings.HasPrefix(replies.String(), "213 Create=20060102150405; /dir/my file\r\n501 Couldn't parse MFCT: ") ||
+		!strings.HasSuffix(replies.String(), "502 MFCT not supported\r\n") {
+		t.Fatalf("Wrong replies: %q", replies.String())
+	}
+	if !driver.ctime.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatal("The creation time should be modified:", driver.ctime)
+	}
+}
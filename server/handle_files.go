@@ -1,12 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (c *clientHandler) handleSTOR() {
@@ -19,21 +21,232 @@ func (c *clientHandler) handleAPPE() {
 
 // Handles both the "STOR" and "APPE" commands
 func (c *clientHandler) handleStoreAndAppend(append bool) {
-	file, err := c.openFile(c.absPath(c.param), append)
+	if !c.checkDataProtection() {
+		return
+	}
+
+	path := c.absPath(c.param)
+
+	// Ranges only apply to downloads, the upload still starts at the start point
+	c.ctxRang = 0
+
+	if !c.checkFileName(path) || !c.checkUploadManifest(path) || !c.checkDropBoxUpload(path) || !c.checkWORM(path) {
+		c.ctxRest, c.ctxAllo = 0, 0
+		return
+	}
+
+	if !c.lockUpload(path) {
+		return
+	}
+	defer c.unlockUpload(path)
+
+	if !c.preTransfer(path, TransferUpload, append) {
+		return
+	}
+
+	algorithm := c.uploadHashAlgorithm()
+	hasher, err := newUploadHash(algorithm)
+	if err != nil {
+		c.writeMessage(550, "Could not verify upload: "+err.Error())
+		return
+	}
+
+	tempName := c.uploadTempName(path, append)
+	file, err := c.openFile(tempName, append)
 
 	if err != nil {
-		c.writeMessage(550, "Could not open file: "+err.Error())
+		c.auditDenial(path, err)
+		c.writeError(550, "Could not open file: "+err.Error(), err)
 		return
 	}
 
-	if tr, err := c.TransferOpen(); err == nil {
-		defer c.TransferClose()
-		if _, err := c.storeOrAppend(tr, file); err != nil && err != io.EOF {
-			c.writeMessage(550, err.Error())
+	tr, err := c.TransferOpen()
+	if err != nil {
+		file.Close()
+		if tempName != path {
+			c.completeUpload(tempName, path, 0, err)
 		}
-	} else {
 		c.writeMessage(550, "Could not open transfer: "+err.Error())
+		return
+	}
+
+	var src io.Reader = tr
+	if max, errLimit := c.uploadLimit(path, append); errLimit != nil {
+		src = &sizeLimitedReader{reader: src, remaining: max, err: errLimit}
+	}
+	if rate := c.transferBandwidth(path, TransferUpload); rate > 0 {
+		src = &throttledReader{reader: src, limiter: newBandwidthLimiter(rate)}
+	}
+	if share := c.bandwidthShare(); share != nil {
+		src = &throttledReader{reader: src, limiter: share}
+	}
+	if hasher != nil {
+		src = io.TeeReader(src, hasher)
+	}
+
+	start, offset := time.Now(), c.ctxRest
+	size, err := c.storeOrAppend(src, file)
+	if err == io.EOF {
+		err = nil
+	}
+	if cause := c.abortCause(); cause != nil {
+		err = cause
+		c.reportAbort(path, TransferUpload, offset, size, cause)
+	}
+	if tempName != path {
+		var duplicate bool
+		if err == nil {
+			duplicate, err = c.preCommit(tempName, path, size, algorithm, hasher)
+		}
+		if duplicate {
+			c.discardUpload(tempName, size)
+		} else {
+			err = c.completeUpload(tempName, path, size, err)
+		}
+	}
+
+	code, message := 226, "Closing transfer connection"
+	if err == ErrTransferSizeExceeded || err == ErrUploadSizeExceeded {
+		code, message = 552, "Transfer aborted: "+err.Error()
+		if tempName == path {
+			c.cleanUpload(path, append, err)
+		}
+	} else if err != nil {
+		code, message = c.mapError(550, err.Error(), err)
+		if tempName == path {
+			c.trackPartialUpload(path, size, err)
+		}
+	} else if hook, ok := c.driver.(PostUploadHook); ok {
+		digest := &UploadDigest{
+			Path:      path,
+			Size:      size,
+			Algorithm: algorithm,
+		}
+		if hasher != nil {
+			digest.Sum = hasher.Sum(nil)
+		}
+		if err = hook.PostUpload(c, digest); err != nil {
+			code, message = c.mapError(550, "Upload verification failed: "+err.Error(), err)
+		}
+	}
+
+	if hook, ok := c.driver.(UploadCompletionHook); ok {
+		result := &UploadResult{
+			Path:     path,
+			Size:     size,
+			Duration: time.Since(start),
+			Append:   append,
+			Err:      err,
+		}
+		if hookErr := hook.UploadCompleted(c, result); hookErr != nil && err == nil {
+			code, message = c.mapError(550, "Upload rejected: "+hookErr.Error(), hookErr)
+		}
+	}
+
+	var uploadErr error
+	if code == 226 {
+		c.forgetPartialUpload(path)
+		message = c.transferSummary(size, time.Since(start))
+		var sum []byte
+		if hasher != nil {
+			sum = hasher.Sum(nil)
+		}
+		c.notifyUpload(path, size, append, algorithm, sum, time.Since(start))
+		c.writeUploadManifests(path, size, append, algorithm, sum)
+	} else {
+		uploadErr = errors.New(message)
+	}
+	c.emitEvent(EventUpload, path, size, time.Since(start), uploadErr)
+	c.countTransfer(path, TransferUpload, size, time.Since(start), uploadErr)
+
+	c.transferCloseWith(code, message)
+}
+
+// preTransfer gives the driver a chance to refuse a transfer before the transfer connection is opened
+func (c *clientHandler) preTransfer(path string, direction TransferDirection, append bool) bool {
+	declaredSize := c.ctxAllo
+	c.ctxAllo = 0
+	c.xferPrio = PriorityNormal
+
+	if !c.checkPathProtection(path) {
+		c.ctxRest, c.ctxRang = 0, 0
+		return false
+	}
+
+	if c.ctxRest != 0 && !c.validateResume(path, direction) {
+		return false
+	}
+
+	max, errLimit := c.uploadLimit(path, append)
+	size, code := declaredSize, 552
+	if direction == TransferDownload {
+		max, errLimit, code = c.session.MaxTransferSize, nil, 550
+		if max > 0 {
+			errLimit = ErrTransferSizeExceeded
+			if info, err := c.getFileInfo(path); err == nil {
+				size = info.Size() - c.ctxRest
+			}
+			if c.ctxRang != 0 && c.ctxRang-c.ctxRest < size {
+				size = c.ctxRang - c.ctxRest
+			}
+		}
+	}
+	if errLimit != nil && size > max {
+		c.ctxRest, c.ctxRang = 0, 0
+		c.writeMessage(code, "Transfer refused: "+errLimit.Error())
+		return false
+	}
+
+	request := &TransferRequest{
+		Path:         path,
+		Direction:    direction,
+		Append:       append,
+		Offset:       c.ctxRest,
+		Length:       c.rangeLength(),
+		DeclaredSize: declaredSize,
+		Type:         c.dataType,
+		Mode:         "S",
+		Protection:   c.DataProtection(),
+	}
+	c.xferReq = request
+	c.setTransferPath(path)
+
+	hook, ok := c.driver.(PreTransferHook)
+	if !ok {
+		return true
+	}
+
+	if err := hook.PreTransfer(c, request); err != nil {
+		c.ctxRest, c.ctxRang = 0, 0
+		c.writeError(550, "Transfer refused: "+err.Error(), err)
+		return false
+	}
+	c.xferPrio = request.Priority
+
+	return true
+}
+
+// validateResume lets the driver check the restart offset against the stored file, and correct it
+func (c *clientHandler) validateResume(path string, direction TransferDirection) bool {
+	validator, ok := c.driver.(ResumeValidator)
+	if !ok {
+		return true
+	}
+	offset, err := validator.ValidateResume(c, path, direction, c.ctxRest)
+	if err != nil || offset < 0 {
+		c.ctxRest, c.ctxRang = 0, 0
+		if err == nil {
+			err = fmt.Errorf("bad offset %d", offset)
+		}
+		c.writeMessage(554, "Invalid restart offset: "+err.Error())
+		return false
+	}
+	if offset != c.ctxRest && c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("Restart offset corrected", logKeyAction, "ftp.rest_corrected", "path", path,
+			"requested", c.ctxRest, "offset", offset)
 	}
+	c.ctxRest = offset
+	return true
 }
 
 func (c *clientHandler) openFile(path string, append bool) (FileStream, error) {
@@ -42,25 +255,62 @@ func (c *clientHandler) openFile(path string, append bool) (FileStream, error) {
 		flag |= os.O_APPEND
 	}
 
+	return c.openTransfer(path, flag)
+}
+
+// openTransfer opens the file of the transfer described by preTransfer, with the TransferOpener of the driver if it
+// has one
+func (c *clientHandler) openTransfer(path string, flag int) (FileStream, error) {
+	if file, ok, err := c.openVirtual(path, flag); ok {
+		return file, err
+	}
+	if opener, ok := c.driver.(TransferOpener); ok && c.xferReq != nil {
+		return opener.OpenTransfer(c, path, flag, c.xferReq)
+	}
 	return c.driver.OpenFile(c, path, flag)
 }
 
 func (c *clientHandler) handleRETR() {
+	if !c.checkDataProtection() {
+		return
+	}
 
 	path := c.absPath(c.param)
 
-	if tr, err := c.TransferOpen(); err == nil {
-		defer c.TransferClose()
-		if _, err := c.download(tr, path); err != nil && err != io.EOF {
-			c.writeMessage(550, err.Error())
-		}
-	} else {
+	if !c.checkUploadLock(path) || !c.preTransfer(path, TransferDownload, false) {
+		return
+	}
+
+	tr, err := c.TransferOpen()
+	if err != nil {
 		c.writeMessage(550, err.Error())
+		return
 	}
+
+	start, offset := time.Now(), c.ctxRest
+	size, err := c.download(tr, path)
+	if err == io.EOF {
+		err = nil
+	}
+	if cause := c.abortCause(); cause != nil {
+		err = cause
+		c.reportAbort(path, TransferDownload, offset, size, cause)
+	}
+	c.emitEvent(EventDownload, path, size, time.Since(start), err)
+	c.countTransfer(path, TransferDownload, size, time.Since(start), err)
+	if err != nil {
+		c.auditDenial(path, err)
+		c.transferCloseWith(c.mapError(550, err.Error(), err))
+		return
+	}
+	c.transferCloseWith(226, c.transferSummary(size, time.Since(start)))
 }
 
 func (c *clientHandler) download(conn net.Conn, name string) (int64, error) {
-	file, err := c.driver.OpenFile(c, name, os.O_RDONLY)
+	ranged, length := c.ctxRang != 0, c.rangeLength()
+	c.ctxRang = 0
+
+	file, err := c.openTransfer(name, os.O_RDONLY)
 
 	if err != nil {
 		return 0, err
@@ -72,7 +322,28 @@ func (c *clientHandler) download(conn net.Conn, name string) (int64, error) {
 	}
 
 	defer file.Close()
-	return io.Copy(conn, file)
+
+	var src io.Reader = file
+	if ranged {
+		src = io.LimitReader(file, length)
+	}
+	var dst io.Writer = conn
+	if rate := c.transferBandwidth(name, TransferDownload); rate > 0 {
+		dst = &throttledWriter{writer: dst, limiter: newBandwidthLimiter(rate)}
+	}
+	if share := c.bandwidthShare(); share != nil {
+		dst = &throttledWriter{writer: dst, limiter: share}
+	}
+	if dst != io.Writer(conn) {
+		return c.daddy.copyStream(dst, src)
+	}
+	if settings := c.daddy.Settings; settings != nil && settings.CoalesceDataWrites {
+		return c.daddy.coalescedCopy(conn, src)
+	}
+	if ranged {
+		return c.daddy.copyStream(conn, src)
+	}
+	return c.daddy.sendFile(conn, file)
 }
 
 func (c *clientHandler) handleCHMOD(params string) {
@@ -81,80 +352,228 @@ func (c *clientHandler) handleCHMOD(params string) {
 
 	mode := os.FileMode(modeNb)
 	path := c.absPath(spl[1])
+	if !c.checkHiddenPath(path) || !c.checkUploadManifest(path) {
+		return
+	}
 
 	if err == nil {
 		err = c.driver.ChmodFile(c, path, mode)
 	}
 
 	if err != nil {
-		c.writeMessage(550, err.Error())
+		c.writeError(550, err.Error(), err)
 		return
 	}
 
 	c.writeMessage(200, "SITE CHMOD command successful")
 }
 
-func (c *clientHandler) storeOrAppend(conn net.Conn, file FileStream) (int64, error) {
+// handleUTIME changes the times of a file, with the two forms used by the clients:
+//
+//	SITE UTIME 20060102150405 path
+//	SITE UTIME path 20060102150405 20060102150405 20060102150405 UTC
+//
+// The times are UTC ones, the second form gives the access, modification and creation times (the last one can't be
+// changed).
+func (c *clientHandler) handleUTIME(params string) {
+	changer, ok := c.driver.(FileTimesChanger)
+	if !ok {
+		c.writeMessage(502, "SITE UTIME not supported")
+		return
+	}
+
+	name, atime, mtime, err := parseUTIME(params)
+	if err != nil {
+		c.writeMessage(501, fmt.Sprintf("Couldn't parse SITE UTIME: %v", err))
+		return
+	}
+
+	path := c.absPath(name)
+	if !c.checkHiddenPath(path) || !c.checkUploadManifest(path) || !c.checkWORM(path) {
+		return
+	}
+	if err = changer.Chtimes(c, path, atime, mtime); err != nil {
+		c.writeError(550, fmt.Sprintf("Could not change the times of %s: %v", path, err), err)
+		return
+	}
+	c.writeMessage(200, "SITE UTIME command successful")
+}
+
+// parseUTIME parses the params of SITE UTIME, see handleUTIME
+func parseUTIME(params string) (string, time.Time, time.Time, error) {
+	fields := strings.Fields(params)
+	if len(fields) >= 5 && strings.EqualFold(fields[len(fields)-1], "UTC") {
+		atime, errA := parseUTIMETime(fields[len(fields)-4])
+		mtime, errM := parseUTIMETime(fields[len(fields)-3])
+		if errA == nil && errM == nil {
+			name := strings.TrimSpace(params)
+			for i := 0; i < 4; i++ {
+				name = strings.TrimSpace(name[:strings.LastIndex(name, " ")])
+			}
+			return name, atime, mtime, nil
+		}
+	}
+
+	spl := strings.SplitN(params, " ", 2)
+	if len(spl) != 2 || spl[1] == "" {
+		return "", time.Time{}, time.Time{}, errors.New("missing path")
+	}
+	mtime, err := parseUTIMETime(spl[0])
+	if err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
+	return spl[1], mtime, mtime, nil
+}
+
+// parseUTIMETime parses a SITE UTIME time, the seconds are optional
+func parseUTIMETime(value string) (time.Time, error) {
+	if len(value) == 12 {
+		return time.Parse("200601021504", value)
+	}
+	return time.Parse("20060102150405", value)
+}
+
+func (c *clientHandler) storeOrAppend(conn io.Reader, file FileStream) (int64, error) {
 	if c.ctxRest != 0 {
 		file.Seek(c.ctxRest, 0)
 		c.ctxRest = 0
 	}
 
 	defer file.Close()
-	return io.Copy(file, conn)
+	if settings := c.daddy.Settings; settings != nil && settings.UploadQueueSize > 0 {
+		return c.daddy.queuedCopy(file, conn, settings.UploadQueueSize)
+	}
+	return c.daddy.receiveFile(file, conn)
 }
 
 func (c *clientHandler) handleDELE() {
 	path := c.absPath(c.param)
-	if err := c.driver.DeleteFile(c, path); err == nil {
+	if !c.checkUploadManifest(path) || !c.checkWORM(path) || !c.checkUploadLock(path) {
+		return
+	}
+	err := c.driver.DeleteFile(c, path)
+	c.auditOperation(AuditDelete, path, "", err)
+	if err == nil {
+		c.forgetPartialUpload(path)
 		c.writeMessage(250, fmt.Sprintf("Removed file %s", path))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("Couldn't delete %s: %v", path, err))
+		c.writeError(550, fmt.Sprintf("Couldn't delete %s: %v", path, err), err)
 	}
 }
 
 func (c *clientHandler) handleRNFR() {
 	path := c.absPath(c.param)
-	if _, err := c.driver.GetFileInfo(c, path); err == nil {
-		c.writeMessage(350, "Sure, give me a target")
-		c.ctxRnfr = path
-	} else {
-		c.writeMessage(550, fmt.Sprintf("Couldn't access %s: %v", path, err))
+	if !c.checkUploadManifest(path) || !c.checkUploadLock(path) {
+		return
 	}
+	info, err := c.driver.GetFileInfo(c, path)
+	if err != nil {
+		c.writeError(550, fmt.Sprintf("Couldn't access %s: %v", path, err), err)
+		return
+	}
+
+	if !c.checkWORMInfo(path, info) {
+		return
+	}
+
+	if validator, ok := c.driver.(RenameValidator); ok {
+		if err := validator.CanRenameFrom(c, path, info); err != nil {
+			c.writeError(553, fmt.Sprintf("Couldn't rename %s: %v", path, err), err)
+			return
+		}
+	}
+
+	c.writeMessage(350, "Sure, give me a target")
+	c.ctxRnfr = path
+	c.ctxRnfrInfo = info
 }
 
 func (c *clientHandler) handleRNTO() {
 	dst := c.absPath(c.param)
-	if c.ctxRnfr != "" {
-		if err := c.driver.RenameFile(c, c.ctxRnfr, dst); err == nil {
-			c.writeMessage(250, "Done !")
-			c.ctxRnfr = ""
-		} else {
-			c.writeMessage(550, fmt.Sprintf("Couldn't rename %s to %s: %s", c.ctxRnfr, dst, err.Error()))
+	if c.ctxRnfr == "" {
+		c.writeMessage(503, "RNFR is expected before RNTO")
+		return
+	}
+
+	if !c.checkFileName(dst) || !c.checkUploadManifest(dst) || !c.checkWORM(dst) || !c.checkUploadLock(dst) {
+		return
+	}
+
+	if validator, ok := c.driver.(RenameValidator); ok {
+		if err := validator.CanRenameTo(c, c.ctxRnfr, c.ctxRnfrInfo, dst); err != nil {
+			c.auditDenial(c.ctxRnfr, err)
+			c.writeError(553, fmt.Sprintf("Couldn't rename %s to %s: %v", c.ctxRnfr, dst, err), err)
+			return
 		}
 	}
+
+	err := c.driver.RenameFile(c, c.ctxRnfr, dst)
+	c.auditOperation(AuditRename, c.ctxRnfr, dst, err)
+	if err == nil {
+		c.writeMessage(250, "Done !")
+		c.ctxRnfr = ""
+		c.ctxRnfrInfo = nil
+	} else {
+		c.writeError(550, fmt.Sprintf("Couldn't rename %s to %s: %s", c.ctxRnfr, dst, err.Error()), err)
+	}
+}
+
+// fileMetadata returns the info SIZE and MDTM are answered from, without ever opening the file
+func (c *clientHandler) fileMetadata(path string) (os.FileInfo, error) {
+	if entry := c.virtualEntry(path); entry != nil {
+		return virtualFileInfo{entry: entry}, nil
+	}
+	if provider, ok := c.driver.(MetadataProvider); ok {
+		return provider.GetMetadata(c, path)
+	}
+	return c.driver.GetFileInfo(c, path)
 }
 
 func (c *clientHandler) handleSIZE() {
+	// RFC 3659: The size depends on the representation type, the one of an ASCII transfer can't be known without
+	// reading the whole file
+	if c.dataType == "A" {
+		c.writeMessage(550, "SIZE not allowed in ASCII mode")
+		return
+	}
+
 	path := c.absPath(c.param)
-	if info, err := c.driver.GetFileInfo(c, path); err == nil {
-		c.writeMessage(213, fmt.Sprintf("%d", info.Size()))
-	} else {
-		c.writeMessage(550, fmt.Sprintf("Couldn't access %s: %v", path, err))
+	info, err := c.fileMetadata(path)
+	if err != nil {
+		c.writeError(550, fmt.Sprintf("Couldn't access %s: %v", path, err), err)
+		return
+	}
+
+	// RFC 3659: The size of a directory isn't the one of a file transfer
+	if info.IsDir() {
+		c.writeMessage(550, fmt.Sprintf("%s is not a regular file", path))
+		return
 	}
+
+	c.writeMessage(213, fmt.Sprintf("%d", info.Size()))
 }
 
 func (c *clientHandler) handleSTATFile() {
 	path := c.absPath(c.param)
+	info, err := c.getFileInfo(path)
+
+	// The status of a directory is its listing
+	if caps := c.session.Capabilities; err == nil && info.IsDir() && caps != 0 && !caps.Has(CapList) {
+		c.audit(AuditPermissionDenied, path, "", nil)
+		c.writeMessage(550, "Permission denied")
+		return
+	}
 
 	c.writeLine("213-Status follows:")
-	if info, err := c.driver.GetFileInfo(c, path); err == nil {
+	if err == nil {
 		if info.IsDir() {
-			if files, err := c.driver.ListFiles(c); err == nil {
-				for _, f := range files {
+			filter := c.listingFilter()
+			c.walkFiles(func(f os.FileInfo) error {
+				if filter == nil || filter(f) {
 					c.writeLine(c.fileStat(f))
 				}
-			}
+				return nil
+			})
 		} else {
 			c.writeLine(c.fileStat(info))
 		}
@@ -167,32 +586,81 @@ func (c *clientHandler) handleALLO() {
 	if size, err := strconv.Atoi(c.param); err == nil {
 		if ok, err := c.driver.CanAllocate(c, size); err == nil {
 			if ok {
+				c.ctxAllo = int64(size)
 				c.writeMessage(202, "OK, we have the free space")
 			} else {
 				c.writeMessage(550, "NOT OK, we don't have the free space")
 			}
 		} else {
-			c.writeMessage(500, fmt.Sprintf("Driver issue: %v", err))
+			c.writeError(500, fmt.Sprintf("Driver issue: %v", err), err)
 		}
 	} else {
 		c.writeMessage(501, fmt.Sprintf("Couldn't parse size: %v", err))
 	}
 }
 
+// handleAVBL replies with the space available in a directory, the current one if none is specified
+func (c *clientHandler) handleAVBL() {
+	provider, ok := c.driver.(SpaceProvider)
+	if !ok {
+		c.writeMessage(550, "Available space unknown")
+		return
+	}
+
+	available, err := provider.AvailableSpace(c, c.absPath(c.param))
+	if err != nil {
+		c.writeError(550, fmt.Sprintf("Could not get the available space: %v", err), err)
+		return
+	}
+	c.writeMessage(213, strconv.FormatInt(available, 10))
+}
+
 func (c *clientHandler) handleREST() {
 	if size, err := strconv.ParseInt(c.param, 10, 0); err == nil {
-		c.ctxRest = size
+		c.ctxRest, c.ctxRang = size, 0
 		c.writeMessage(350, "OK")
 	} else {
 		c.writeMessage(550, fmt.Sprintf("Couldn't parse size: %v", err))
 	}
 }
 
+// handleRANG defines the byte range of the next RETR (draft-bryan-ftp-range): from the start point to the end point
+// included. "RANG 1 0" resets it.
+func (c *clientHandler) handleRANG() {
+	var start, end int64
+	if _, err := fmt.Sscanf(c.param, "%d %d", &start, &end); err != nil || start < 0 || end < 0 {
+		c.writeMessage(501, "Syntax error: RANG <start-point> <end-point>")
+		return
+	}
+
+	if start == 1 && end == 0 {
+		c.ctxRest, c.ctxRang = 0, 0
+		c.writeMessage(350, "Restarting at 0. End byte range at EOF.")
+		return
+	}
+
+	if end < start {
+		c.writeMessage(501, "The end point must not be before the start point")
+		return
+	}
+
+	c.ctxRest, c.ctxRang = start, end+1
+	c.writeMessage(350, fmt.Sprintf("Restarting at %d. End byte range at %d.", start, end))
+}
+
+// rangeLength returns the number of bytes of the range defined with RANG, 0 without range
+func (c *clientHandler) rangeLength() int64 {
+	if c.ctxRang == 0 {
+		return 0
+	}
+	return c.ctxRang - c.ctxRest
+}
+
 func (c *clientHandler) handleMDTM() {
 	path := c.absPath(c.param)
-	if info, err := c.driver.GetFileInfo(c, path); err == nil {
+	if info, err := c.fileMetadata(path); err == nil {
 		c.writeMessage(250, info.ModTime().UTC().Format(dateFormatMLSD))
 	} else {
-		c.writeMessage(550, fmt.Sprintf("Couldn't access %s: %s", path, err.Error()))
+		c.writeError(550, fmt.Sprintf("Couldn't access %s: %s", path, err.Error()), err)
 	}
 }
@@ -0,0 +1,542 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resumeDriver only accepts the restarts at the end of the stored object
+type resumeDriver struct {
+	ClientHandlingDriver
+	size int64
+}
+
+func (d *resumeDriver) ValidateResume(cc ClientContext, path string, direction TransferDirection,
+	offset int64) (int64, error) {
+	if direction == TransferDownload && offset > d.size {
+		return 0, errors.New("the object is smaller than the offset")
+	}
+	if direction == TransferUpload && offset > d.size {
+		return d.size, nil
+	}
+	return offset, nil
+}
+
+func TestValidateResume(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies), driver: &resumeDriver{size: 100}}
+
+	c.ctxRest = 50
+	if !c.validateResume("/file", TransferDownload) || c.ctxRest != 50 {
+		t.Fatal("The offset should be accepted:", c.ctxRest)
+	}
+
+	c.ctxRest = 150
+	if !c.validateResume("/file", TransferUpload) || c.ctxRest != 100 {
+		t.Fatal("The offset should be corrected:", c.ctxRest)
+	}
+
+	c.ctxRest = 150
+	if c.validateResume("/file", TransferDownload) || c.ctxRest != 0 {
+		t.Fatal("The offset should be refused:", c.ctxRest)
+	}
+	if reply := replies.String(); reply != "554 Invalid restart offset: the object is smaller than the offset\r\n" {
+		t.Fatal("Bad reply:", reply)
+	}
+}
+
+// metadataDriver only answers through its MetadataProvider
+type metadataDriver struct {
+	ClientHandlingDriver
+	infos map[string]os.FileInfo
+}
+
+func (d *metadataDriver) GetMetadata(cc ClientContext, path string) (os.FileInfo, error) {
+	if info, ok := d.infos[path]; ok {
+		return info, nil
+	}
+	return nil, ErrNoMetadata
+}
+
+func TestSizeFromMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0644); err != nil {
+		t.Fatal("Couldn't write file:", err)
+	}
+	fileInfo, _ := os.Stat(filepath.Join(dir, "file"))
+	dirInfo, _ := os.Stat(dir)
+
+	var buf bytes.Buffer
+	driver := &metadataDriver{infos: map[string]os.FileInfo{"/file": fileInfo, "/dir": dirInfo}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, driver: driver, path: "/"}
+
+	for _, test := range [][2]string{
+		{"SIZE file", "213 5\r\n"},
+		{"TYPE A", "200 WARNING: ASCII isn't correctly supported\r\n"},
+		{"SIZE file", "550 SIZE not allowed in ASCII mode\r\n"},
+		{"TYPE I", "200 Type set to binary\r\n"},
+		{"SIZE dir", "550 /dir is not a regular file\r\n"},
+		{"SIZE virtual", "550 Couldn't access /virtual: no metadata available\r\n"},
+		{"MDTM file", "250 " + fileInfo.ModTime().UTC().Format(dateFormatMLSD) + "\r\n"},
+	} {
+		buf.Reset()
+		c.handleCommand(test[0] + "\r\n")
+		if buf.String() != test[1] {
+			t.Fatalf("Bad reply to %s: %q", test[0], buf.String())
+		}
+	}
+}
+
+// memoryFile is a read-only file in memory
+type memoryFile struct {
+	FileStream
+	*bytes.Reader
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) { return f.Reader.Read(p) }
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	return f.Reader.Seek(offset, whence)
+}
+
+func (f *memoryFile) Close() error { return nil }
+
+// memoryDriver serves the same content for all the files
+type memoryDriver struct {
+	ClientHandlingDriver
+	content []byte
+}
+
+func (d *memoryDriver) OpenFile(cc ClientContext, path string, flag int) (FileStream, error) {
+	return &memoryFile{Reader: bytes.NewReader(d.content)}, nil
+}
+
+func TestRANG(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), path: "/",
+		driver: &memoryDriver{content: []byte("0123456789")}}
+
+	for _, test := range [][2]string{
+		{"RANG 5", "501 Syntax error: RANG <start-point> <end-point>\r\n"},
+		{"RANG 5 2", "501 The end point must not be before the start point\r\n"},
+		{"RANG 1 0", "350 Restarting at 0. End byte range at EOF.\r\n"},
+		{"RANG 2 5", "350 Restarting at 2. End byte range at 5.\r\n"},
+	} {
+		buf.Reset()
+		c.handleCommand(test[0] + "\r\n")
+		if buf.String() != test[1] {
+			t.Fatalf("Bad reply to %s: %q", test[0], buf.String())
+		}
+	}
+
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	c.handleCommand("RETR file\r\n")
+	received, err := ioutil.ReadAll(client)
+	c.waitTransfer()
+	if err != nil || string(received) != "2345" {
+		t.Fatalf("Only the range should be sent: %q %v", received, err)
+	}
+	if c.ctxRest != 0 || c.ctxRang != 0 {
+		t.Fatal("The range should only apply to one transfer:", c.ctxRest, c.ctxRang)
+	}
+}
+
+// protectionDriver refuses the unprotected transfers of the secret files
+type protectionDriver struct {
+	ClientHandlingDriver
+	request *TransferRequest
+}
+
+func (d *protectionDriver) PreTransfer(cc ClientContext, request *TransferRequest) error {
+	d.request = request
+	if request.Protection != "P" && request.Path == "/secret" {
+		return errors.New("unprotected transfer of a secret file")
+	}
+	return nil
+}
+
+func TestPreTransferProtection(t *testing.T) {
+	var replies bytes.Buffer
+	driver := &protectionDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{}, driver: driver}
+
+	if c.preTransfer("/secret", TransferDownload, false) || driver.request.Protection != "C" {
+		t.Fatal("The unprotected transfer should be refused:", driver.request)
+	}
+	if c.DataTLSConnectionState() != nil {
+		t.Fatal("There shouldn't be any data connection")
+	}
+
+	c.transferTLS = true
+	if !c.preTransfer("/secret", TransferDownload, false) || c.DataProtection() != "P" {
+		t.Fatal("The protected transfer should be accepted:", driver.request)
+	}
+	if reply := replies.String(); reply != "550 Transfer refused: unprotected transfer of a secret file\r\n" {
+		t.Fatal("Bad reply:", reply)
+	}
+}
+
+// quotaDriver refuses the uploads going beyond its quota
+type quotaDriver struct {
+	ClientHandlingDriver
+	request *TransferRequest
+}
+
+func (d *quotaDriver) PreTransfer(cc ClientContext, request *TransferRequest) error {
+	d.request = request
+	if request.Direction == TransferUpload && request.Offset+request.DeclaredSize > 10 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func TestPreTransferHook(t *testing.T) {
+	var replies bytes.Buffer
+	driver := &quotaDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{}, driver: driver, dataType: "I"}
+
+	c.ctxRest, c.ctxAllo = 4, 5
+	if !c.preTransfer("/file", TransferUpload, true) {
+		t.Fatal("The upload should be accepted")
+	}
+	if request := driver.request; request.Path != "/file" || request.Direction != TransferUpload || !request.Append ||
+		request.Offset != 4 || request.DeclaredSize != 5 || request.Type != "I" {
+		t.Fatal("Wrong request:", request)
+	}
+
+	c.ctxRest, c.ctxAllo = 4, 7
+	if c.preTransfer("/file", TransferUpload, false) || c.ctxRest != 0 {
+		t.Fatal("The upload beyond the quota should be refused")
+	}
+	c.writer.Flush()
+	if reply := replies.String(); reply != "552 Transfer refused: quota exceeded\r\n" {
+		t.Fatalf("Bad reply: %q", reply)
+	}
+}
+
+// hookDriver verifies and processes its uploads
+type hookDriver struct {
+	dirDriver
+	digests      []*UploadDigest
+	results      []*UploadResult
+	verification error
+	processing   error
+}
+
+func (d *hookDriver) PostUpload(cc ClientContext, digest *UploadDigest) error {
+	d.digests = append(d.digests, digest)
+	return d.verification
+}
+
+func (d *hookDriver) UploadCompleted(cc ClientContext, result *UploadResult) error {
+	d.results = append(d.results, result)
+	return d.processing
+}
+
+// newHookHandler returns a session uploading to a hookDriver
+func newHookHandler(t *testing.T, replies *bytes.Buffer) (*clientHandler, *hookDriver, func()) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	driver := &hookDriver{dirDriver: dirDriver{dir: dir}}
+	c := &clientHandler{writer: bufio.NewWriter(replies), daddy: NewFtpServer(nil), driver: driver, path: "/",
+		logger: nopLogger{}}
+	c.daddy.Settings = &Settings{UploadHashAlgorithm: "sha256"}
+	return c, driver, func() { os.RemoveAll(dir) }
+}
+
+func TestPostUploadHook(t *testing.T) {
+	var replies bytes.Buffer
+	c, driver, clean := newHookHandler(t, &replies)
+	defer clean()
+
+	upload(c, []byte("content"))
+	expected := sha256.Sum256([]byte("content"))
+	if len(driver.digests) != 1 || driver.digests[0].Path != "/file" || driver.digests[0].Size != 7 ||
+		driver.digests[0].Algorithm != "sha256" || !bytes.Equal(driver.digests[0].Sum, expected[:]) {
+		t.Fatal("Wrong digest:", driver.digests)
+	}
+	if !strings.Contains(replies.String(), "\r\n226 ") {
+		t.Fatalf("The upload should succeed: %q", replies.String())
+	}
+
+	// The failed verifications make the upload fail
+	replies.Reset()
+	driver.verification = errors.New("checksum mismatch")
+	upload(c, []byte("content"))
+	if !strings.HasSuffix(replies.String(), "\r\n550 Upload verification failed: checksum mismatch\r\n") {
+		t.Fatalf("The upload should fail: %q", replies.String())
+	}
+}
+
+func TestUploadCompletionHook(t *testing.T) {
+	var replies bytes.Buffer
+	c, driver, clean := newHookHandler(t, &replies)
+	defer clean()
+
+	upload(c, []byte("content"))
+	if len(driver.results) != 1 || driver.results[0].Path != "/file" || driver.results[0].Size != 7 ||
+		driver.results[0].Append || driver.results[0].Err != nil {
+		t.Fatal("Wrong result:", driver.results)
+	}
+
+	// The hook is told about the failed uploads too
+	driver.verification = errors.New("checksum mismatch")
+	upload(c, []byte("content"))
+	if len(driver.results) != 2 || driver.results[1].Err != driver.verification {
+		t.Fatal("The failure should be reported:", driver.results)
+	}
+
+	// The hook can reject the successful uploads
+	replies.Reset()
+	driver.verification, driver.processing = nil, errors.New("infected")
+	upload(c, []byte("content"))
+	if !strings.HasSuffix(replies.String(), "\r\n550 Upload rejected: infected\r\n") {
+		t.Fatalf("The upload should be rejected: %q", replies.String())
+	}
+}
+
+// openerDriver records the transfers its files are opened for
+type openerDriver struct {
+	dirDriver
+	paths    []string
+	requests []*TransferRequest
+}
+
+func (d *openerDriver) OpenTransfer(cc ClientContext, path string, flag int, request *TransferRequest) (FileStream,
+	error) {
+	d.paths, d.requests = append(d.paths, path), append(d.requests, request)
+	return d.OpenFile(cc, path, flag)
+}
+
+func TestTransferOpener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	driver := &openerDriver{dirDriver: dirDriver{dir: dir}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{AtomicUploads: true}},
+		driver: driver, path: "/", id: 7, uid: "c0ffee", logger: nopLogger{}, dataType: "I"}
+	c.daddy.bufferPool.New = func() interface{} {
+		b := make([]byte, 1024)
+		return &b
+	}
+
+	c.ctxAllo = 7
+	upload(c, []byte("content"))
+	c.waitTransfer()
+	if len(driver.requests) != 1 || driver.paths[0] != "/.file.c0ffee.part" {
+		t.Fatal("The temporary file should be opened for the upload:", driver.paths)
+	}
+	if request := driver.requests[0]; request.Path != "/file" || request.DeclaredSize != 7 ||
+		request.Direction != TransferUpload || request.Type != "I" || request.Mode != "S" {
+		t.Fatal("Wrong upload request:", request)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ioutil.ReadAll(client)
+	c.transfer = &pipeTransfer{conn: server}
+	c.ctxRest, c.param = 3, "/file"
+	c.handleRETR()
+	c.waitTransfer()
+	if len(driver.requests) != 2 || driver.paths[1] != "/file" {
+		t.Fatal("The file should be opened for the download:", driver.paths)
+	}
+	if request := driver.requests[1]; request.Direction != TransferDownload || request.Offset != 3 ||
+		request.DeclaredSize != 0 {
+		t.Fatal("Wrong download request:", request)
+	}
+}
+
+// confidentialDriver requires protected data connections for the confidential directory
+type confidentialDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *confidentialDriver) ProtectedDataRequired(cc ClientContext, path string) bool {
+	return path == "/confidential" || strings.HasPrefix(path, "/confidential/")
+}
+
+func TestPathProtection(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}},
+		driver: &confidentialDriver{}, path: "/confidential"}
+
+	c.ctxRest = 10
+	if c.preTransfer("/confidential/file", TransferDownload, false) || c.ctxRest != 0 {
+		t.Fatal("The unprotected transfer should be refused")
+	}
+	c.handleLIST()
+	expected := "521 Data connections must be protected for this path, use PROT P\r\n"
+	if replies.String() != expected+expected {
+		t.Fatalf("Wrong replies: %q", replies.String())
+	}
+
+	if !c.preTransfer("/public/file", TransferDownload, false) {
+		t.Fatal("The transfers of the other paths should be accepted")
+	}
+	c.transferTLS = true
+	if !c.preTransfer("/confidential/file", TransferDownload, false) {
+		t.Fatal("The protected transfer should be accepted")
+	}
+}
+
+// spaceDriver reports the available space of some directories
+type spaceDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *spaceDriver) AvailableSpace(cc ClientContext, path string) (int64, error) {
+	if path != "/data" {
+		return 0, ErrNotFound
+	}
+	return 1 << 30, nil
+}
+
+func TestAVBL(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}}, path: "/data"}
+
+	c.handleAVBL()
+	c.driver = &spaceDriver{}
+	c.handleAVBL()
+	c.param = "/other"
+	c.handleAVBL()
+	c.param = "DF"
+	c.handleSITE()
+	expected := "550 Available space unknown\r\n213 1073741824\r\n" +
+		"550 Could not get the available space: no such file or directory\r\n213 1073741824\r\n"
+	if replies.String() != expected {
+		t.Fatalf("Wrong replies: %q", replies.String())
+	}
+}
+
+func TestParseUTIME(t *testing.T) {
+	date := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		params string
+		name   string
+		atime  time.Time
+	}{
+		{"20060102150405 my file.txt", "my file.txt", date},
+		{"200601021504 file", "file", date.Add(-5 * time.Second)},
+		{"my file.txt 20050102150405 20060102150405 20060102150405 UTC", "my file.txt", date.AddDate(-1, 0, 0)},
+		// A name that looks like the second form
+		{"20060102150405 a b c d UTC", "a b c d UTC", date},
+	} {
+		name, atime, mtime, err := parseUTIME(tc.params)
+		if err != nil || name != tc.name || !atime.Equal(tc.atime) || (!mtime.Equal(date) && !mtime.Equal(tc.atime)) {
+			t.Fatalf("Wrong parsing of %q: %q %v %v %v", tc.params, name, atime, mtime, err)
+		}
+	}
+
+	for _, params := range []string{"", "20060102150405", "2006 file", "file 2006 2006 2006 UTC"} {
+		if _, _, _, err := parseUTIME(params); err == nil {
+			t.Fatal("The params should be refused:", params)
+		}
+	}
+}
+
+// timesDriver records the times changes
+type timesDriver struct {
+	ClientHandlingDriver
+	path  string
+	mtime time.Time
+}
+
+func (d *timesDriver) Chtimes(cc ClientContext, path string, atime, mtime time.Time) error {
+	d.path, d.mtime = path, mtime
+	return nil
+}
+
+func TestUTIME(t *testing.T) {
+	var replies bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}}, path: "/dir"}
+
+	c.param = "UTIME 20060102150405 file"
+	c.handleSITE()
+	driver := &timesDriver{}
+	c.driver = driver
+	c.handleSITE()
+	c.param = "UTIME bad file"
+	c.handleSITE()
+	expected := "502 SITE UTIME not supported\r\n200 SITE UTIME command successful\r\n501 Couldn't parse SITE UTIME: "
+	if !strings.HasPrefix(replies.String(), expected) {
+		t.Fatalf("Wrong replies: %q", replies.String())
+	}
+	if driver.path != "/dir/file" || !driver.mtime.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatal("Wrong change:", driver.path, driver.mtime)
+	}
+}
+
+// renameValidatorDriver only moves the files to the archive directory, except the locked one
+type renameValidatorDriver struct {
+	statDriver
+	info os.FileInfo
+}
+
+func (d *renameValidatorDriver) CanRenameFrom(cc ClientContext, from string, info os.FileInfo) error {
+	if from == "/locked" {
+		return errors.New("locked file")
+	}
+	return nil
+}
+
+func (d *renameValidatorDriver) CanRenameTo(cc ClientContext, from string, info os.FileInfo, to string) error {
+	d.info = info
+	if !strings.HasPrefix(to, "/archive/") {
+		return errors.New("only archiving is allowed")
+	}
+	return nil
+}
+
+func TestRenameValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "archive"), 0755)
+	for _, name := range []string{"file", "locked"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("content"), 0644)
+	}
+
+	var replies bytes.Buffer
+	driver := &renameValidatorDriver{statDriver: statDriver{dirDriver{dir: dir}}}
+	c := &clientHandler{writer: bufio.NewWriter(&replies), daddy: &FtpServer{Settings: &Settings{}}, driver: driver,
+		path: "/", logger: nopLogger{}}
+
+	for _, command := range []string{"RNFR locked", "RNFR file", "RNTO other", "RNTO archive/file"} {
+		c.handleCommand(command + "\r\n")
+	}
+	expected := "553 Couldn't rename /locked: locked file\r\n350 Sure, give me a target\r\n" +
+		"553 Couldn't rename /file to /other: only archiving is allowed\r\n250 Done !\r\n"
+	if replies.String() != expected {
+		t.Fatalf("Wrong replies: %q", replies.String())
+	}
+	if driver.info == nil || driver.info.Name() != "file" || driver.info.Size() != 7 {
+		t.Fatal("The validator should get the info of the source:", driver.info)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archive", "file")); err != nil {
+		t.Fatal("The file should be archived:", err)
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// helpColumns is the number of commands per line of the HELP replies
+const helpColumns = 8
+
+// commandSyntaxes are the arguments of the commands, shown by HELP <command>
+var commandSyntaxes = map[string]string{
+	"ABOR": "",
+	"ACCT": "<account>",
+	"ALLO": "<size>",
+	"APPE": "<path>",
+	"AUTH": "TLS",
+	"AVBL": "[<path>]",
+	"CDUP": "",
+	"CLNT": "<client software>",
+	"COMB": "<target> <part> [<part>...]",
+	"CWD":  "<path>",
+	"DELE": "<path>",
+	"EPRT": "|<protocol>|<address>|<port>|",
+	"EPSV": "[ALL]",
+	"FEAT": "",
+	"HELP": "[<command>]",
+	"HOST": "<host>",
+	"LANG": "[<language>]",
+	"LIST": "[<options>]",
+	"MDTM": "<path>",
+	"MFCT": "<time> <path>",
+	"MFF":  "<fact>=<value>;[...] <path>",
+	"MKD":  "<path>",
+	"MLSD": "[<path>]",
+	"NLST": "[<options>]",
+	"NOOP": "",
+	"OPTS": "<option> [<value>]",
+	"PASS": "<password>",
+	"PASV": "",
+	"PBSZ": "0",
+	"PORT": "<h1,h2,h3,h4,p1,p2>",
+	"PROT": "C|P",
+	"PWD":  "",
+	"QUIT": "",
+	"RANG": "<start> <end>",
+	"REST": "<offset>",
+	"RETR": "<path>",
+	"RMD":  "<path>",
+	"RNFR": "<path>",
+	"RNTO": "<path>",
+	"SITE": "<subcommand> [<arguments>] (SITE HELP for the list)",
+	"SIZE": "<path>",
+	"STAT": "[<path>]",
+	"STOR": "<path>",
+	"SYST": "",
+	"TYPE": "A|I",
+	"USER": "<username>",
+}
+
+// siteSyntaxes are the arguments of the SITE subcommands of the server, shown by SITE HELP <subcommand>
+var siteSyntaxes = map[string]string{
+	"CHMOD":   "<mode> <path>",
+	"COMBINE": "<target> <part> [<part>...]",
+	"DF":      "[<path>]",
+	"DIRSIZE": "[<directory>]",
+	"HELP":    "[<subcommand>]",
+	"UTIME":   "<time> <path>",
+}
+
+// helpCommands returns the commands the session can use, from the registry: the disabled ones and the ones the user
+// isn't allowed to send are left out
+func (c *clientHandler) helpCommands() []string {
+	commands := make([]string, 0, len(commandsMap))
+	for command, desc := range commandsMap {
+		if !c.daddy.commandDisabled(command, "") && c.commandAllowed(command, desc) {
+			commands = append(commands, command)
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// siteCommands returns the SITE subcommands of the session and their arguments, the ones of the driver included
+func (c *clientHandler) siteCommands() map[string]string {
+	commands := make(map[string]string, len(siteSyntaxes))
+	if handler, ok := c.driver.(SiteCommandHandler); ok {
+		for command, syntax := range handler.SiteCommands(c) {
+			commands[strings.ToUpper(command)] = syntax
+		}
+	}
+	for command, syntax := range siteSyntaxes {
+		commands[command] = syntax
+	}
+	if _, ok := c.driver.(DownloadTokenIssuer); ok {
+		commands["TOKEN"] = "<path> | REVOKE <token>"
+	}
+	for command := range commands {
+		if c.daddy.commandDisabled("SITE", command) {
+			delete(commands, command)
+		}
+	}
+	return commands
+}
+
+// writeHelp writes a 214 reply listing some commands
+func (c *clientHandler) writeHelp(title string, commands []string) {
+	c.writeLine("214-" + title)
+	for i := 0; i < len(commands); i += helpColumns {
+		end := i + helpColumns
+		if end > len(commands) {
+			end = len(commands)
+		}
+		var line strings.Builder
+		for _, command := range commands[i:end] {
+			fmt.Fprintf(&line, " %-8s", command)
+		}
+		c.writeLine(strings.TrimRight(line.String(), " "))
+	}
+	c.writeMessage(214, "Help OK")
+}
+
+// writeSyntax writes the 214 reply of the syntax of a command
+func (c *clientHandler) writeSyntax(command, syntax string) {
+	c.writeMessage(214, strings.TrimSpace(fmt.Sprintf("Syntax: %s %s", command, syntax)))
+}
+
+// handleHELP lists the commands of the server, or gives the syntax of one of them
+func (c *clientHandler) handleHELP() {
+	commands := c.helpCommands()
+	if c.param == "" {
+		c.writeHelp("The following commands are recognized:", commands)
+		return
+	}
+
+	command := strings.ToUpper(strings.TrimSpace(c.param))
+	for _, known := range commands {
+		if known == command {
+			c.writeSyntax(command, commandSyntaxes[command])
+			return
+		}
+	}
+	c.writeMessage(502, fmt.Sprintf("Unknown command %s", command))
+}
+
+// handleSITEHELP lists the SITE subcommands, or gives the syntax of one of them
+func (c *clientHandler) handleSITEHELP(param string) {
+	commands := c.siteCommands()
+	if param == "" {
+		names := make([]string, 0, len(commands))
+		for command := range commands {
+			names = append(names, command)
+		}
+		sort.Strings(names)
+		c.writeHelp("The following SITE commands are recognized:", names)
+		return
+	}
+
+	command := strings.ToUpper(strings.TrimSpace(param))
+	if syntax, ok := commands[command]; ok {
+		c.writeSyntax("SITE "+command, syntax)
+		return
+	}
+	c.writeMessage(502, fmt.Sprintf("Unknown SITE command %s", command))
+}
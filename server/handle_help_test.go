@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCommandSyntaxes(t *testing.T) {
+	for command := range commandsMap {
+		if _, ok := commandSyntaxes[command]; !ok {
+			t.Error("Missing syntax of", command)
+		}
+	}
+}
+
+func TestHELP(t *testing.T) {
+	var buf bytes.Buffer
+	daddy := &FtpServer{Settings: &Settings{}, disabledCmds: newDisabledCommands([]string{"DELE", "SITE CHMOD"})}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy}
+
+	c.handleCommand("HELP\r\n")
+	reply := buf.String()
+	if !strings.HasPrefix(reply, "214-The following commands are recognized:\r\n ABOR     ACCT ") ||
+		!strings.HasSuffix(reply, "\r\n214 Help OK\r\n") {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+	if !strings.Contains(reply, " RETR ") || strings.Contains(reply, "DELE") {
+		t.Fatalf("The disabled commands shouldn't be listed: %q", reply)
+	}
+
+	buf.Reset()
+	c.handleCommand("HELP retr\r\n")
+	c.handleCommand("HELP DELE\r\n")
+	c.handleCommand("HELP PWD\r\n")
+	if expected := "214 Syntax: RETR <path>\r\n502 Unknown command DELE\r\n214 Syntax: PWD\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
+
+func TestSITEHELP(t *testing.T) {
+	var buf bytes.Buffer
+	daddy := &FtpServer{Settings: &Settings{}, disabledCmds: newDisabledCommands([]string{"SITE CHMOD"})}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy, driver: &siteDriver{}}
+
+	c.handleCommand("SITE HELP\r\n")
+	if expected := "214-The following SITE commands are recognized:\r\n" +
+		" COMBINE  DF       DIRSIZE  FAIL     HELLO    HELP     UTIME\r\n" +
+		"214 Help OK\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+
+	buf.Reset()
+	c.handleCommand("SITE HELP hello\r\n")
+	c.handleCommand("SITE HELP CHMOD\r\n")
+	if expected := "214 Syntax: SITE HELLO <name>\r\n502 Unknown SITE command CHMOD\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
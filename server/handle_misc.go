@@ -3,30 +3,126 @@ package server
 import (
 	"bufio"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// handleAUTH negotiates TLS on the control connection. SSL and TLS-P are the legacy mechanisms, which also protect
+// the data connections as if PBSZ 0 and PROT P were sent.
 func (c *clientHandler) handleAUTH() {
+	mechanism := strings.ToUpper(strings.TrimSpace(c.param))
+	switch mechanism {
+	case "TLS", "TLS-C", "SSL", "TLS-P":
+	default:
+		c.writeMessage(504, fmt.Sprintf("Unsupported security mechanism %s, use AUTH TLS", c.param))
+		return
+	}
+
 	if tlsConfig, err := c.daddy.driver.GetTLSConfig(); err == nil {
+		if c.daddy.Settings.TLSSessionReuseRequired {
+			// Session tickets issued with a key that is specific to this client can't be resumed by anyone else
+			key, errKey := newSessionTicketKey()
+			if errKey != nil {
+				c.writeMessage(550, fmt.Sprintf("Cannot prepare the TLS config: %v", errKey))
+				return
+			}
+			tlsConfig = sessionBoundTLSConfig(tlsConfig, key)
+			c.ticketKey = key
+		}
+		c.tlsConfig = tlsConfig
+		c.dataTLS = nil
 		c.writeMessage(234, "AUTH command ok. Expecting TLS Negotiation.")
-		c.conn = tls.Server(c.conn, tlsConfig)
+		c.conn = tls.Server(c.conn, c.fingerprintingTLSConfig(tlsConfig))
 		c.reader = bufio.NewReader(c.conn)
 		c.writer = bufio.NewWriter(c.conn)
+		c.controlTLS = true
+
+		// RFC 4217: A new security exchange resets the data protection state
+		legacy := mechanism == "SSL" || mechanism == "TLS-P"
+		c.pbszSet = legacy
+		c.transferTLS = legacy
 	} else {
 		c.writeMessage(550, fmt.Sprintf("Cannot get a TLS config: %v", err))
 	}
 }
 
 func (c *clientHandler) handlePROT() {
+	if !c.pbszSet {
+		c.writeMessage(503, "PBSZ must be issued before PROT")
+		return
+	}
+
 	// P for Private, C for Clear
-	c.transferTLS = c.param == "P"
-	c.writeMessage(200, "OK")
+	switch level := strings.ToUpper(c.param); level {
+	case "P":
+		if !c.protectionChanged(level) {
+			return
+		}
+		c.transferTLS = true
+		c.writeMessage(200, "OK")
+	case "C":
+		if c.requirePROT {
+			c.writeMessage(534, "Unprotected data connections are not allowed")
+			return
+		}
+		if !c.protectionChanged(level) {
+			return
+		}
+		c.transferTLS = false
+		c.writeMessage(200, "OK")
+	case "S", "E":
+		c.writeMessage(536, "Protection level not supported")
+	default:
+		c.writeMessage(504, "Unknown protection level")
+	}
+}
+
+// protectionChanged tells the driver about the new data protection level, it replies 534 if the driver refuses it
+func (c *clientHandler) protectionChanged(level string) bool {
+	observer, ok := c.driver.(ProtectionObserver)
+	if !ok {
+		return true
+	}
+	if err := observer.ProtectionChanged(c, level); err != nil {
+		c.writeMessage(534, "Protection level refused: "+err.Error())
+		return false
+	}
+	return true
 }
 
 func (c *clientHandler) handlePBSZ() {
-	c.writeMessage(200, "Whatever")
+	if !c.controlTLS {
+		c.writeMessage(503, "AUTH must be issued before PBSZ")
+		return
+	}
+
+	if _, err := strconv.ParseUint(c.param, 10, 32); err != nil {
+		c.writeMessage(501, "Couldn't parse buffer size")
+		return
+	}
+
+	// TLS is a streaming protocol, the only valid value is 0
+	c.pbszSet = true
+	c.writeMessage(200, "PBSZ=0")
+}
+
+// maxClientVersionLength is the max length of the client software kept from CLNT
+const maxClientVersionLength = 128
+
+func (c *clientHandler) handleCLNT() {
+	software := strings.TrimSpace(c.param)
+	if len(software) > maxClientVersionLength {
+		software = software[:maxClientVersionLength]
+	}
+
+	c.paramsMutex.Lock()
+	c.clientSoft = software
+	c.paramsMutex.Unlock()
+
+	c.writeMessage(200, "Noted")
 }
 
 func (c *clientHandler) handleSYST() {
@@ -45,12 +141,65 @@ func (c *clientHandler) handleSTAT() {
 
 func (c *clientHandler) handleSITE() {
 	spl := strings.SplitN(c.param, " ", 2)
+	if strings.ToUpper(spl[0]) == "DF" {
+		// Alias of AVBL, for the clients sending their unknown commands through SITE
+		c.param = ""
+		if len(spl) > 1 {
+			c.param = spl[1]
+		}
+		if c.checkHiddenAccess() {
+			c.handleAVBL()
+		}
+		return
+	}
+	if strings.ToUpper(spl[0]) == "DIRSIZE" {
+		param := ""
+		if len(spl) > 1 {
+			param = spl[1]
+		}
+		c.handleDIRSIZE(param)
+		return
+	}
+	if strings.ToUpper(spl[0]) == "HELP" {
+		param := ""
+		if len(spl) > 1 {
+			param = spl[1]
+		}
+		c.handleSITEHELP(param)
+		return
+	}
 	if len(spl) > 1 {
-		if strings.ToUpper(spl[0]) == "CHMOD" {
+		switch strings.ToUpper(spl[0]) {
+		case "CHMOD":
 			c.handleCHMOD(spl[1])
 			return
+		case "COMBINE":
+			c.combineFiles(spl[1])
+			return
+		case "UTIME":
+			c.handleUTIME(spl[1])
+			return
+		case "TOKEN":
+			c.handleTOKEN(spl[1])
+			return
 		}
 	}
+	if handler, ok := c.driver.(SiteCommandHandler); ok {
+		command, param := strings.ToUpper(spl[0]), ""
+		if len(spl) > 1 {
+			param = spl[1]
+		}
+		message, err := handler.SiteCommand(c, command, param)
+		if err == nil {
+			c.writeMultilineMessage(200, message)
+			return
+		}
+		if !errors.Is(err, ErrUnknownSiteCommand) {
+			c.writeError(550, fmt.Sprintf("Could not execute SITE %s: %v", command, err), err)
+			return
+		}
+	}
+	c.unsupportedCommand("SITE", true)
 	c.writeMessage(500, "Not understood SITE subcommand")
 }
 
@@ -69,7 +218,9 @@ func (c *clientHandler) handleSTATServer() {
 	} else {
 		c.writeLine("Not logged in yet")
 	}
-	c.writeLine("ftpserver - golang FTP server")
+	if !c.daddy.Settings.HideServerInfo {
+		c.writeLine("ftpserver - golang FTP server")
+	}
 	defer c.writeMessage(213, "End")
 }
 
@@ -86,6 +237,15 @@ func (c *clientHandler) handleNOOP() {
 	c.writeMessage(200, "OK")
 }
 
+// handleABOR is executed once the aborted transfer (if any) has replied 426, it closes the data connection that could
+// still be open
+func (c *clientHandler) handleABOR() {
+	if c.transfer != nil {
+		c.closeTransfer(c.transfer)
+	}
+	c.writeMessage(226, "ABOR successful")
+}
+
 func (c *clientHandler) handleFEAT() {
 	c.writeLine("211- These are my features")
 	defer c.writeMessage(211, "end")
@@ -95,12 +255,26 @@ func (c *clientHandler) handleFEAT() {
 		"SIZE",
 		"MDTM",
 		"REST STREAM",
+		"RANG STREAM",
+		"CLNT",
+		"AVBL",
+		"HOST",
 	}
 
 	if !c.daddy.Settings.DisableMLSD {
 		features = append(features, "MLSD")
 	}
 
+	if _, err := c.daddy.driver.GetTLSConfig(); err == nil {
+		features = append(features, "AUTH TLS;SSL", "PBSZ", "PROT")
+	}
+
+	features = append(features, c.factsFeatures()...)
+
+	if len(c.daddy.catalogs) > 0 {
+		features = append(features, c.languagesFeature())
+	}
+
 	for _, f := range features {
 		c.writeLine(" " + f)
 	}
@@ -109,8 +283,10 @@ func (c *clientHandler) handleFEAT() {
 func (c *clientHandler) handleTYPE() {
 	switch c.param {
 	case "I":
+		c.dataType = c.param
 		c.writeMessage(200, "Type set to binary")
 	case "A":
+		c.dataType = c.param
 		c.writeMessage(200, "WARNING: ASCII isn't correctly supported")
 	default:
 		c.writeMessage(500, "Not understood")
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCLNT(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}}
+
+	c.handleCommand("CLNT FileZilla 3.66.4\r\n")
+	if buf.String() != "200 Noted\r\n" || c.ClientVersion() != "FileZilla 3.66.4" {
+		t.Fatalf("The client software should be noted: %q %q", buf.String(), c.ClientVersion())
+	}
+
+	c.handleCommand("CLNT " + strings.Repeat("x", 500) + "\r\n")
+	if len(c.ClientVersion()) != maxClientVersionLength {
+		t.Fatal("The client software should be truncated:", len(c.ClientVersion()))
+	}
+}
+
+// protObserverDriver records the protection levels, and refuses the clear one
+type protObserverDriver struct {
+	ClientHandlingDriver
+	levels []string
+}
+
+func (d *protObserverDriver) ProtectionChanged(cc ClientContext, level string) error {
+	d.levels = append(d.levels, level)
+	if level == "C" {
+		return errors.New("clear transfers are disabled")
+	}
+	return nil
+}
+
+func TestPROTObserver(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &protObserverDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, driver: driver, pbszSet: true}
+
+	c.handleCommand("PROT P\r\n")
+	c.handleCommand("PROT C\r\n")
+	if expected := "200 OK\r\n534 Protection level refused: clear transfers are disabled\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if !c.transferTLS || strings.Join(driver.levels, ",") != "P,C" {
+		t.Fatal("The refused level shouldn't be applied:", c.transferTLS, driver.levels)
+	}
+}
+
+// siteDriver adds a SITE subcommand
+type siteDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *siteDriver) SiteCommand(cc ClientContext, command, param string) (string, error) {
+	switch command {
+	case "HELLO":
+		return "Hello " + param, nil
+	case "FAIL":
+		return "", errors.New("it failed")
+	}
+	return "", ErrUnknownSiteCommand
+}
+
+func (d *siteDriver) SiteCommands(cc ClientContext) map[string]string {
+	return map[string]string{"HELLO": "<name>", "FAIL": ""}
+}
+
+func TestSiteCommandHandler(t *testing.T) {
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}}, driver: &siteDriver{}}
+
+	c.handleCommand("SITE hello world\r\n")
+	c.handleCommand("SITE FAIL\r\n")
+	c.handleCommand("SITE OTHER\r\n")
+	if expected := "200 Hello world\r\n550 Could not execute SITE FAIL: it failed\r\n500 Not understood SITE subcommand\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
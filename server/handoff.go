@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+)
+
+// HandoffEnv is the environment variable passing the listeners and the state of a server to the process taking over
+// them, see FtpServer.Handoff
+const HandoffEnv = "FTPSERVER_HANDOFF"
+
+// handoffState is the state passed to the new process: the file descriptors of its listeners by endpoint ("ftp",
+// "health", "debug", prefixed by the name of their server), and the counters of the session IDs so that they aren't
+// reused
+type handoffState struct {
+	Listeners      map[string]int    `json:"listeners"`
+	ClientCounter  uint32            `json:"clientCounter"`            // Counter of the server without a name
+	ClientCounters map[string]uint32 `json:"clientCounters,omitempty"` // Counters of the named servers
+}
+
+// pendingHandoff is the state received from the previous process, with the listeners no server has taken yet
+var (
+	pendingHandoff      *handoffState
+	pendingHandoffMutex sync.Mutex
+)
+
+// fileListener is a listener whose file descriptor can be passed to another process
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Handoff starts a new process (usually an upgraded binary with the same settings) taking over the listeners of the
+// server, for the restarts without downtime. The new process gets them in its HandoffEnv variable, and its Listen
+// uses them instead of listening again. The server then stops accepting the clients, but its sessions go on: Drain
+// waits for their end. The listeners can't be passed on Windows.
+func (server *FtpServer) Handoff(cmd *exec.Cmd) error {
+	return HandoffAll(cmd, server)
+}
+
+// HandoffAll is Handoff for all the servers of a process, like the ones of the listeners with distinct settings and
+// drivers. They must have distinct names (FtpServer.Name), so that each server of the new process takes its own
+// listeners back.
+func HandoffAll(cmd *exec.Cmd, servers ...*FtpServer) error {
+	listeners := make(map[string]net.Listener)
+	state := &handoffState{Listeners: make(map[string]int)}
+	for _, server := range servers {
+		if _, ok := listeners[server.endpointName("ftp")]; ok {
+			return fmt.Errorf("two servers are named %q", server.Name)
+		}
+		listeners[server.endpointName("ftp")] = server.Listener
+		for name, listener := range server.endpoints {
+			listeners[server.endpointName(name)] = listener
+		}
+		counter := atomic.LoadUint32(&server.clientCounter)
+		if server.Name == "" {
+			state.ClientCounter = counter
+		} else {
+			if state.ClientCounters == nil {
+				state.ClientCounters = make(map[string]uint32)
+			}
+			state.ClientCounters[server.Name] = counter
+		}
+	}
+
+	var files []*os.File
+	defer func() {
+		// The new process has its own copies
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for name, listener := range listeners {
+		l, ok := listener.(fileListener)
+		if !ok {
+			return fmt.Errorf("the %s listener can't be handed off", name)
+		}
+		file, err := l.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		// The extra files of a process start after stdin, stdout and stderr
+		state.Listeners[name] = 3 + len(cmd.ExtraFiles)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+	}
+
+	value, _ := json.Marshal(state) // The state can always be encoded
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, HandoffEnv+"="+string(value))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		server.Logger.Info("Listeners handed off", logKeyAction, "ftp.handoff", "pid", cmd.Process.Pid)
+		server.Stop()
+	}
+	return nil
+}
+
+// endpointName returns the name of an endpoint of the server in the handoffs
+func (server *FtpServer) endpointName(name string) string {
+	if server.Name == "" {
+		return name
+	}
+	return server.Name + "/" + name
+}
+
+// inheritListeners takes over the listeners of the server passed by the previous process in HandoffEnv, if any. The
+// variable is read by the first server of the process, the next ones take their listeners from what it left.
+func (server *FtpServer) inheritListeners() error {
+	pendingHandoffMutex.Lock()
+	defer pendingHandoffMutex.Unlock()
+
+	if value := os.Getenv(HandoffEnv); value != "" {
+		// The processes started by this one shouldn't inherit them again
+		os.Unsetenv(HandoffEnv)
+
+		state := &handoffState{}
+		if err := json.Unmarshal([]byte(value), state); err != nil {
+			return fmt.Errorf("bad %s: %v", HandoffEnv, err)
+		}
+		pendingHandoff = state
+	}
+	state := pendingHandoff
+	if state == nil {
+		return nil
+	}
+
+	server.inherited = make(map[string]net.Listener)
+	for _, name := range []string{"ftp", "health", "debug"} {
+		fd, ok := state.Listeners[server.endpointName(name)]
+		if !ok {
+			continue
+		}
+		delete(state.Listeners, server.endpointName(name))
+		file := os.NewFile(uintptr(fd), server.endpointName(name))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't inherit the %s listener: %v", server.endpointName(name), err)
+		}
+		server.inherited[name] = listener
+	}
+	counter := state.ClientCounter
+	if server.Name == "" {
+		state.ClientCounter = 0
+	} else {
+		counter = state.ClientCounters[server.Name]
+		delete(state.ClientCounters, server.Name)
+	}
+	atomic.StoreUint32(&server.clientCounter, counter)
+	if len(state.Listeners) == 0 {
+		pendingHandoff = nil
+	}
+
+	server.Logger.Info("Listeners inherited", logKeyAction, "ftp.handoff_inherited", "listeners", len(server.inherited))
+	return nil
+}
+
+// listen returns the listener of an endpoint: the one inherited from the previous process, or a new one on address
+func (server *FtpServer) listen(name, address string) (net.Listener, error) {
+	listener, ok := server.inherited[name]
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	delete(server.inherited, name)
+	return listener, nil
+}
+
+// closeInherited closes the inherited listeners of the endpoints no longer enabled
+func (server *FtpServer) closeInherited() {
+	for name, listener := range server.inherited {
+		listener.Close()
+		delete(server.inherited, name)
+	}
+}
+
+// Drain waits for the end of all the sessions, after a Handoff or a Stop, or until the context is done
+func (server *FtpServer) Drain(ctx context.Context) error {
+	server.connectionsMutex.Lock()
+	defer server.connectionsMutex.Unlock()
+
+	for len(server.connectionsByID) > 0 {
+		if server.slotFreed == nil {
+			server.slotFreed = make(chan struct{})
+		}
+		freed := server.slotFreed
+		server.connectionsMutex.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			server.connectionsMutex.Lock()
+			return ctx.Err()
+		}
+		server.connectionsMutex.Lock()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// inheritableFd returns a duplicate of the descriptor of a listener, owned by nobody like the ones passed by the
+// previous process: the *os.File of the listener is closed, so that its finalizer can't close a reused descriptor
+// after inheritListeners closed this one
+func inheritableFd(t *testing.T, listener net.Listener) int {
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal("Couldn't get the file of the listener:", err)
+	}
+	defer file.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal("Couldn't duplicate the descriptor of the listener:", err)
+	}
+	return fd
+}
+
+func TestInheritListeners(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	// The descriptor is closed by inheritListeners, as in a new process
+	server := &FtpServer{Logger: nopLogger{}}
+	os.Setenv(HandoffEnv, fmt.Sprintf(`{"listeners":{"ftp":%d},"clientCounter":42}`, inheritableFd(t, listener)))
+	if err = server.inheritListeners(); err != nil {
+		t.Fatal("Couldn't inherit the listeners:", err)
+	}
+	if os.Getenv(HandoffEnv) != "" || server.clientCounter != 42 {
+		t.Fatal("The state should be inherited once:", server.clientCounter)
+	}
+
+	inherited, err := server.listen("ftp", "127.0.0.1:1")
+	if err != nil || inherited.Addr().String() != listener.Addr().String() {
+		t.Fatal("The inherited listener should be used:", err)
+	}
+	defer inherited.Close()
+	go func() {
+		if conn, err := inherited.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect to the inherited listener:", err)
+	}
+	conn.Close()
+
+	os.Setenv(HandoffEnv, "{")
+	if err = server.inheritListeners(); err == nil {
+		t.Fatal("A bad state should be refused")
+	}
+}
+
+func TestInheritNamedListeners(t *testing.T) {
+	var fds []int
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal("Couldn't listen:", err)
+		}
+		defer listener.Close()
+		fds = append(fds, inheritableFd(t, listener))
+	}
+
+	os.Setenv(HandoffEnv, fmt.Sprintf(`{"listeners":{"public/ftp":%d,"internal/ftp":%d},`+
+		`"clientCounters":{"public":7,"internal":9}}`, fds[0], fds[1]))
+	public := &FtpServer{Name: "public", Logger: nopLogger{}}
+	internal := &FtpServer{Name: "internal", Logger: nopLogger{}}
+	for _, server := range []*FtpServer{public, internal} {
+		if err := server.inheritListeners(); err != nil {
+			t.Fatal("Couldn't inherit the listeners:", err)
+		}
+		if server.inherited["ftp"] == nil {
+			t.Fatal("Each server should take its own listener:", server.Name)
+		}
+		server.inherited["ftp"].Close()
+	}
+	if public.clientCounter != 7 || internal.clientCounter != 9 || pendingHandoff != nil {
+		t.Fatal("Each server should take its own counter:", public.clientCounter, internal.clientCounter)
+	}
+}
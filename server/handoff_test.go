@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	server := &FtpServer{connectionsByID: make(map[uint32]*clientHandler), Logger: nopLogger{}}
+	if err := server.Drain(context.Background()); err != nil {
+		t.Fatal("There's no session to wait:", err)
+	}
+
+	c := queuedClient(server, 1)
+	server.connectionsByID[c.id] = c
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatal("The drain should time out:", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		server.clientDeparture(c)
+	}()
+	if err := server.Drain(context.Background()); err != nil {
+		t.Fatal("The drain should end with the last session:", err)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Health describes the state of the server
+type Health struct {
+	Listening     bool      `json:"listening"`              // The server is accepting connections
+	Sessions      int       `json:"sessions"`               // Number of connected clients
+	MaxSessions   int       `json:"maxSessions"`            // Max number of connected clients
+	StartTime     time.Time `json:"startTime"`              // Time when the server was started
+	LastError     string    `json:"lastError,omitempty"`    // Last error that happened at the server level
+	LastErrorTime time.Time `json:"lastErrorTime"`          // Time of the last error
+	Maintenance   bool      `json:"maintenance"`            // The server is in maintenance, refusing the new logins
+	BackendError  string    `json:"backendError,omitempty"` // Why the backend of the driver is unavailable (BackendChecker)
+}
+
+// Ready tells if the server can accept new clients, it isn't during the maintenance nor while the backend is
+// unavailable
+func (h *Health) Ready() bool {
+	return h.Listening && !h.Maintenance && h.BackendError == "" && (h.MaxSessions <= 0 || h.Sessions < h.MaxSessions)
+}
+
+// Health returns the current state of the server
+func (server *FtpServer) Health() *Health {
+	h := &Health{
+		Listening:   atomic.LoadInt32(&server.listening) == 1,
+		StartTime:   server.StartTime,
+		Maintenance: server.Maintenance() != nil,
+	}
+
+	if server.Settings != nil {
+		h.MaxSessions = server.Settings.MaxConnections
+	}
+	if err := server.BackendError(); err != nil {
+		h.BackendError = err.Error()
+	}
+
+	server.connectionsMutex.RLock()
+	h.Sessions = len(server.connectionsByID)
+	server.connectionsMutex.RUnlock()
+
+	server.healthMutex.Lock()
+	if server.lastError != nil {
+		h.LastError = server.lastError.Error()
+		h.LastErrorTime = server.lastErrorTime
+	}
+	server.healthMutex.Unlock()
+
+	return h
+}
+
+func (server *FtpServer) setLastError(err error) {
+	server.healthMutex.Lock()
+	defer server.healthMutex.Unlock()
+	server.lastError = err
+	server.lastErrorTime = time.Now().UTC()
+}
+
+// HealthHandler returns an HTTP handler serving the health of the server as JSON:
+// "/healthz" fails when the server isn't listening anymore, "/readyz" also fails when it can't accept new clients.
+func (server *FtpServer) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := server.Health()
+		writeHealth(w, h, h.Listening)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		h := server.Health()
+		writeHealth(w, h, h.Ready())
+	})
+	return mux
+}
+
+func writeHealth(w http.ResponseWriter, h *Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// listenHealth starts the HTTP health endpoint
+func (server *FtpServer) listenHealth() error {
+	listener, err := server.listen("health", server.Settings.HealthListenAddr)
+	if err != nil {
+		return err
+	}
+	if server.endpoints == nil {
+		server.endpoints = make(map[string]net.Listener)
+	}
+	server.endpoints["health"] = listener
+
+	server.healthServer = &http.Server{Handler: server.HealthHandler()}
+	go server.healthServer.Serve(listener)
+
+	server.Logger.Info("Health endpoint listening...", logKeyAction, "ftp.health_listening", "address", listener.Addr())
+	return nil
+}
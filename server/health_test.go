@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{MaxConnections: 1}
+	handler := server.HealthHandler()
+
+	check := func(path string, expected int) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != expected {
+			t.Fatal("Bad status for", path, rec.Code)
+		}
+	}
+
+	// Not listening yet
+	check("/healthz", http.StatusServiceUnavailable)
+	check("/readyz", http.StatusServiceUnavailable)
+
+	server.listening = 1
+	check("/healthz", http.StatusOK)
+	check("/readyz", http.StatusOK)
+
+	// The server is full
+	server.connectionsByID[0] = &clientHandler{}
+	check("/healthz", http.StatusOK)
+	check("/readyz", http.StatusServiceUnavailable)
+
+	server.setLastError(errors.New("accept error"))
+	if h := server.Health(); h.LastError != "accept error" {
+		t.Fatal("Bad last error:", h.LastError)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"os"
+	"strings"
+)
+
+// HiddenFilesPolicy defines how the dotfiles (the files whose name starts with a dot) are handled
+type HiddenFilesPolicy int
+
+const (
+	// HiddenFilesShow lists the dotfiles like the other files. For the SessionSettings, it keeps the server policy.
+	HiddenFilesShow HiddenFilesPolicy = iota
+	// HiddenFilesHide hides the dotfiles from the listings unless the client asks for them (LIST -a)
+	HiddenFilesHide
+	// HiddenFilesDeny hides the dotfiles from all the listings and refuses any access to them
+	HiddenFilesDeny
+	// HiddenFilesShowAll can be used in the SessionSettings to show the dotfiles whatever the server policy
+	HiddenFilesShowAll
+)
+
+// isHiddenName tells if a file name is the one of a dotfile
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// isHiddenPath tells if a path is the one of a dotfile or of a file in a hidden directory
+func isHiddenPath(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if isHiddenName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// listOptionsShowHidden tells if the options of a LIST (like "-la") ask for the dotfiles
+func listOptionsShowHidden(param string) bool {
+	for _, option := range strings.Fields(param) {
+		if strings.HasPrefix(option, "-") && strings.ContainsAny(option, "aA") {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenFilter returns the filter of the listed files, nil when all of them are listed
+func (c *clientHandler) hiddenFilter() func(os.FileInfo) bool {
+	policy := c.session.HiddenFiles
+	if policy != HiddenFilesDeny && (policy != HiddenFilesHide || listOptionsShowHidden(c.param)) {
+		return nil
+	}
+	return func(file os.FileInfo) bool {
+		return !isHiddenName(file.Name())
+	}
+}
+
+// checkHiddenAccess refuses the commands on the hidden paths when their access is denied
+func (c *clientHandler) checkHiddenAccess() bool {
+	return c.checkHiddenPath(c.absPath(c.param))
+}
+
+// checkHiddenPath is checkHiddenAccess for the commands whose path isn't their whole parameter (SITE CHMOD, MFF...)
+func (c *clientHandler) checkHiddenPath(p string) bool {
+	if c.session.HiddenFiles != HiddenFilesDeny || !isHiddenPath(p) {
+		return true
+	}
+	c.writeMessage(550, "Access to hidden files is denied")
+	return false
+}
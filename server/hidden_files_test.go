@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestHiddenPaths(t *testing.T) {
+	for path, hidden := range map[string]bool{
+		"/.ssh":             true,
+		"/home/.git/config": true,
+		"/home/file.txt":    false,
+		"/home/./file":      false,
+		"/":                 false,
+	} {
+		if isHiddenPath(path) != hidden {
+			t.Fatal("Bad hidden status for", path)
+		}
+	}
+
+	for param, show := range map[string]bool{"": false, "-l": false, "-la": true, "-A dir": true, "data": false} {
+		if listOptionsShowHidden(param) != show {
+			t.Fatal("Bad options parsing for", param)
+		}
+	}
+}
+
+func TestHiddenFilesPolicy(t *testing.T) {
+	c := &clientHandler{path: "/"}
+	if c.hiddenFilter() != nil {
+		t.Fatal("The dotfiles should be shown by default")
+	}
+
+	c.session.HiddenFiles = HiddenFilesHide
+	if c.hiddenFilter() == nil {
+		t.Fatal("The dotfiles should be hidden")
+	}
+	c.param = "-la"
+	if c.hiddenFilter() != nil {
+		t.Fatal("The dotfiles should be shown with -a")
+	}
+
+	var replies bytes.Buffer
+	c.writer = bufio.NewWriter(&replies)
+	c.daddy = &FtpServer{}
+	c.param = ".ssh/id_rsa"
+	if !c.checkHiddenAccess() {
+		t.Fatal("The access should only be refused with HiddenFilesDeny")
+	}
+	c.session.HiddenFiles = HiddenFilesDeny
+	if c.hiddenFilter() == nil || c.checkHiddenAccess() {
+		t.Fatal("The dotfiles should be hidden and denied")
+	}
+	if reply := replies.String(); reply != "550 Access to hidden files is denied\r\n" {
+		t.Fatal("Bad reply:", reply)
+	}
+
+	// The commands taking their path from a part of their parameter are refused too
+	driver := &factsRecorder{}
+	c.driver = driver
+	for _, command := range []func(){
+		func() { c.param = "UNIX.mode=0777; .ssh/id_rsa"; c.handleMFF() },
+		func() { c.param = "20060102150405 .ssh/id_rsa"; c.handleMFCT() },
+		func() { c.handleCHMOD("777 .ssh/id_rsa") },
+		func() { c.handleUTIME("20060102150405 .ssh/id_rsa") },
+	} {
+		replies.Reset()
+		command()
+		c.writer.Flush()
+		if reply := replies.String(); reply != "550 Access to hidden files is denied\r\n" {
+			t.Fatal("Bad reply:", reply)
+		}
+	}
+	if driver.mode != 0 || !driver.mtime.IsZero() || !driver.ctime.IsZero() {
+		t.Fatal("The hidden file shouldn't be changed:", driver)
+	}
+}
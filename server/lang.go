@@ -0,0 +1,90 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// defaultLanguage is the language of the replies without catalog
+const defaultLanguage = "EN"
+
+// Catalog translates the replies of the server into a language (LANG, RFC 2640)
+type Catalog interface {
+	// Translate returns the message of a reply in the language of the catalog
+	Translate(code int, message string) string
+}
+
+// MessageCatalog is a Catalog of translated messages indexed by their English version, the messages it doesn't
+// contain are sent in English
+type MessageCatalog map[string]string
+
+// Translate returns the translation of the message, or the message itself if it has none
+func (m MessageCatalog) Translate(code int, message string) string {
+	if translation, ok := m[message]; ok {
+		return translation
+	}
+	return message
+}
+
+// RegisterCatalog adds a language the clients can select with LANG, like "fr" or "pt-BR". It must be called before
+// the server starts.
+func (server *FtpServer) RegisterCatalog(language string, catalog Catalog) {
+	if server.catalogs == nil {
+		server.catalogs = make(map[string]Catalog)
+	}
+	server.catalogs[strings.ToUpper(language)] = catalog
+}
+
+// findCatalog returns the catalog of a language, falling back on its primary language ("FR" for "FR-CA")
+func (server *FtpServer) findCatalog(language string) (string, Catalog) {
+	language = strings.ToUpper(language)
+	if catalog, ok := server.catalogs[language]; ok {
+		return language, catalog
+	}
+	if i := strings.Index(language, "-"); i > 0 {
+		if catalog, ok := server.catalogs[language[:i]]; ok {
+			return language[:i], catalog
+		}
+	}
+	return "", nil
+}
+
+// languagesFeature returns the LANG line of FEAT, with the current language of the session marked with a "*"
+func (c *clientHandler) languagesFeature() string {
+	current := c.lang
+	if current == "" {
+		current = defaultLanguage
+	}
+
+	languages := []string{defaultLanguage}
+	for language := range c.daddy.catalogs {
+		if language != defaultLanguage {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages[1:])
+
+	for i, language := range languages {
+		if language == current {
+			languages[i] += "*"
+		}
+	}
+	return "LANG " + strings.Join(languages, ";")
+}
+
+func (c *clientHandler) handleLANG() {
+	if c.param == "" || strings.EqualFold(c.param, defaultLanguage) {
+		c.lang, c.catalog = "", nil
+		c.writeMessage(200, "Language set to "+defaultLanguage)
+		return
+	}
+
+	language, catalog := c.daddy.findCatalog(c.param)
+	if catalog == nil {
+		c.writeMessage(504, "Unsupported language "+c.param)
+		return
+	}
+
+	c.lang, c.catalog = language, catalog
+	c.writeMessage(200, "Language set to "+language)
+}
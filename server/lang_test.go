@@ -0,0 +1,42 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLANG(t *testing.T) {
+	var buf bytes.Buffer
+	server := &FtpServer{Settings: &Settings{}}
+	server.RegisterCatalog("fr", MessageCatalog{"OK": "D'accord", "Language set to FR": "Langue : FR"})
+	server.RegisterCatalog("de", MessageCatalog{})
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server}
+
+	if feature := c.languagesFeature(); feature != "LANG EN*;DE;FR" {
+		t.Fatal("Bad LANG feature:", feature)
+	}
+
+	c.handleCommand("LANG fr-CA\r\n")
+	c.handleCommand("NOOP\r\n")
+	if buf.String() != "200 Langue : FR\r\n200 D'accord\r\n" {
+		t.Fatalf("The replies should be translated: %q", buf.String())
+	}
+	if feature := c.languagesFeature(); feature != "LANG EN;DE;FR*" {
+		t.Fatal("Bad LANG feature:", feature)
+	}
+
+	buf.Reset()
+	c.handleCommand("LANG es\r\n")
+	if !strings.HasPrefix(buf.String(), "504 ") || c.lang != "FR" {
+		t.Fatalf("The language should be refused: %q", buf.String())
+	}
+
+	buf.Reset()
+	c.handleCommand("LANG\r\n")
+	c.handleCommand("NOOP\r\n")
+	if buf.String() != "200 Language set to EN\r\n200 OK\r\n" {
+		t.Fatalf("The default language should be used: %q", buf.String())
+	}
+}
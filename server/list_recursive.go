@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// defaultListRecursionEntries is the max number of entries of a LIST -R when Settings.ListRecursionEntries is 0
+const defaultListRecursionEntries = 10000
+
+// errListTruncated stops a recursive listing that reached its max number of entries
+var errListTruncated = errors.New("listing truncated")
+
+// listRecursive tells if the options of a LIST argument ("-lR", "-R") ask for a recursive listing
+func listRecursive(param string) bool {
+	for _, field := range strings.Fields(param) {
+		if !strings.HasPrefix(field, "-") {
+			return false
+		}
+		if strings.Contains(field, "R") {
+			return true
+		}
+	}
+	return false
+}
+
+// recursiveDir is a directory waiting to be listed by a LIST -R
+type recursiveDir struct {
+	path  string // Absolute path
+	name  string // Path relative to the listed directory, as in the header of its entries
+	depth int    // Levels below the listed directory
+}
+
+// transferRecursiveList sends the entries of the current directory and its subdirectories (LIST -R) in the format of
+// "ls -lR": the ones of each subdirectory follow a "name:" header. The subdirectories below
+// Settings.ListRecursionDepth levels aren't listed and the listing stops after Settings.ListRecursionEntries entries,
+// both leaving a truncation marker. The walk goes through the current directory of the session, which is restored
+// afterwards.
+func (c *clientHandler) transferRecursiveList() {
+	if !c.checkPathProtection(c.Path()) {
+		return
+	}
+
+	maxDepth := c.daddy.Settings.ListRecursionDepth
+	maxEntries := c.daddy.Settings.ListRecursionEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultListRecursionEntries
+	}
+
+	tr, err := c.TransferOpen()
+	if err != nil {
+		return
+	}
+
+	current := c.Path()
+	defer c.SetPath(current)
+
+	w := bufio.NewWriter(tr)
+	entries := 0
+	pending := []recursiveDir{{path: current}}
+	for len(pending) > 0 && err == nil {
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if dir.depth > 0 {
+			if _, err = fmt.Fprintf(w, "\r\n%s:\r\n", dir.name); err != nil {
+				break
+			}
+			if dir.depth > maxDepth {
+				_, err = fmt.Fprintf(w, "... truncated: deeper than %d levels\r\n", maxDepth)
+				continue
+			}
+		}
+
+		var subdirs []recursiveDir
+		c.SetPath(dir.path)
+		filter := c.listingFilter()
+		err = c.walkFiles(func(file os.FileInfo) error {
+			if filter != nil && !filter(file) {
+				return nil
+			}
+			if entries >= maxEntries {
+				return errListTruncated
+			}
+			entries++
+			// Some drivers list the directory itself and its parent
+			if file.IsDir() && file.Name() != "." && file.Name() != ".." {
+				subdirs = append(subdirs, recursiveDir{
+					path:  path.Join(dir.path, file.Name()),
+					name:  path.Join(dir.name, file.Name()),
+					depth: dir.depth + 1,
+				})
+			}
+			return c.dirTransferLIST(w, file)
+		})
+
+		// The subdirectories that can't be listed don't stop the listing
+		if err != nil && err != errListTruncated && dir.depth > 0 {
+			_, err = fmt.Fprintf(w, "... cannot list: %v\r\n", err)
+		}
+
+		// They are listed in order, each one before the next one
+		for i := len(subdirs) - 1; i >= 0; i-- {
+			pending = append(pending, subdirs[i])
+		}
+	}
+
+	truncated := err == errListTruncated
+	if truncated {
+		_, err = fmt.Fprintf(w, "... truncated: more than %d entries\r\n", maxEntries)
+	}
+	if err == nil {
+		if _, err = fmt.Fprint(w, "\r\n"); err == nil {
+			err = w.Flush()
+		}
+	}
+
+	switch {
+	case err != nil:
+		c.transferCloseWith(c.mapError(451, fmt.Sprintf("Could not list: %v", err), err))
+	case truncated:
+		c.transferCloseWith(226, fmt.Sprintf("Closing transfer connection, listing truncated after %d entries", maxEntries))
+	default:
+		c.TransferClose()
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listLines runs a LIST on a pipe and returns the lines of the listing with only their last field
+func listLines(c *clientHandler) []string {
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	listing := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		listing <- data
+	}()
+	c.handleLIST()
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(<-listing)), "\r\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			line = fields[len(fields)-1]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLISTRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub", "deep", "deeper"), 0755)
+	for _, name := range []string{"a", "sub/b", "sub/deep/c", "sub/deep/deeper/d"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), driver: &dirDriver{dir: dir},
+		path: "/", logger: nopLogger{}}
+	c.daddy.Settings = &Settings{ListRecursionDepth: 2}
+
+	c.param = "-lR"
+	expected := "a sub  sub: b deep  sub/deep: c deeper  sub/deep/deeper: levels"
+	if lines := strings.Join(listLines(c), " "); lines != expected || c.Path() != "/" {
+		t.Fatalf("Wrong recursive listing: %q", lines)
+	}
+
+	c.daddy.Settings.ListRecursionEntries = 3
+	buf.Reset()
+	if lines := strings.Join(listLines(c), " "); lines != "a sub  sub: b entries" {
+		t.Fatalf("Wrong truncated listing: %q", lines)
+	}
+	if !strings.Contains(buf.String(), "226 Closing transfer connection, listing truncated after 3 entries") {
+		t.Fatalf("The truncation should be reported: %q", buf.String())
+	}
+
+	c.daddy.Settings.ListRecursionDepth = 0
+	if lines := strings.Join(listLines(c), " "); lines != "a sub" {
+		t.Fatalf("The -R option should be ignored: %q", lines)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// listingChanges are the commands that can change the listings, the cached listings of the user on its virtual host
+// are invalidated after them
+var listingChanges = map[string]bool{
+	"STOR": true,
+	"APPE": true,
+	"DELE": true,
+	"RMD":  true,
+	"RNTO": true,
+	"MKD":  true,
+	"MFF":  true,
+	"MFCT": true,
+	"SITE": true,
+	"COMB": true,
+}
+
+// listingKey identifies a cached listing: the same user name can be another account on another virtual host (HOST)
+type listingKey struct {
+	host string
+	user string
+	path string
+}
+
+// cachedListing is a listing of a directory, served until it expires
+type cachedListing struct {
+	files   []os.FileInfo
+	expires time.Time
+}
+
+// listingCache keeps the listings of the directories for Settings.ListingCacheTTL, by virtual host, user and path
+type listingCache struct {
+	entries map[listingKey]*cachedListing
+	mutex   sync.Mutex
+}
+
+func (lc *listingCache) get(key listingKey) ([]os.FileInfo, bool) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	entry, ok := lc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.files, true
+}
+
+func (lc *listingCache) put(key listingKey, files []os.FileInfo, ttl time.Duration) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	now := time.Now()
+	if lc.entries == nil {
+		lc.entries = make(map[listingKey]*cachedListing)
+	}
+	for key, entry := range lc.entries {
+		if now.After(entry.expires) {
+			delete(lc.entries, key)
+		}
+	}
+	lc.entries[key] = &cachedListing{files: files, expires: now.Add(ttl)}
+}
+
+// invalidate removes the listings of a user (all of them if empty) and a path (all of them if empty) on all the
+// virtual hosts
+func (lc *listingCache) invalidate(user, path string) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	for key := range lc.entries {
+		if (user == "" || key.user == user) && (path == "" || key.path == path) {
+			delete(lc.entries, key)
+		}
+	}
+}
+
+// invalidateUser removes the listings of a user on a virtual host
+func (lc *listingCache) invalidateUser(host, user string) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	for key := range lc.entries {
+		if key.host == host && key.user == user {
+			delete(lc.entries, key)
+		}
+	}
+}
+
+// InvalidateListings removes some cached listings: the ones of a user (all of them if empty) on all the virtual
+// hosts and a directory (all of them if empty). The drivers call it for the changes made outside of the FTP sessions.
+func (server *FtpServer) InvalidateListings(user, path string) {
+	server.listings.invalidate(user, path)
+}
+
+// listingCacheTTL returns how long the listings are cached, 0 if they aren't
+func (c *clientHandler) listingCacheTTL() time.Duration {
+	if c.daddy.Settings == nil {
+		return 0
+	}
+	return time.Duration(c.daddy.Settings.ListingCacheTTL) * time.Second
+}
+
+// listFiles lists the files of the current directory, from the cache if they were listed recently
+func (c *clientHandler) listFiles() ([]os.FileInfo, error) {
+	ttl := c.listingCacheTTL()
+	if ttl <= 0 {
+		return c.driver.ListFiles(c)
+	}
+
+	key := listingKey{host: c.Host(), user: c.User(), path: c.Path()}
+	if files, ok := c.daddy.listings.get(key); ok {
+		return files, nil
+	}
+	files, err := c.driver.ListFiles(c)
+	if err == nil {
+		c.daddy.listings.put(key, files, ttl)
+	}
+	return files, err
+}
+
+// invalidateListings removes the cached listings of the user on its virtual host after the commands that can change
+// them
+func (c *clientHandler) invalidateListings() {
+	if listingChanges[c.command] && c.listingCacheTTL() > 0 {
+		c.daddy.listings.invalidateUser(c.Host(), c.User())
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"testing"
+)
+
+// countingDriver counts the listings of its directories
+type countingDriver struct {
+	ClientHandlingDriver
+	calls int
+}
+
+func (d *countingDriver) ListFiles(cc ClientContext) ([]os.FileInfo, error) {
+	d.calls++
+	return []os.FileInfo{}, nil
+}
+
+func (d *countingDriver) DeleteFile(cc ClientContext, path string) error {
+	return nil
+}
+
+func TestListingCache(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &countingDriver{}
+	server := &FtpServer{Settings: &Settings{ListingCacheTTL: 60}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server, driver: driver, path: "/", user: "user"}
+	other := &clientHandler{daddy: server, driver: driver, path: "/", user: "other"}
+
+	list := func(c *clientHandler) {
+		if _, err := c.listFiles(); err != nil {
+			t.Fatal("Couldn't list:", err)
+		}
+	}
+
+	list(c)
+	list(c)
+	if driver.calls != 1 {
+		t.Fatal("The second listing should be cached:", driver.calls)
+	}
+	list(other)
+	c.path = "/dir"
+	list(c)
+	if driver.calls != 3 {
+		t.Fatal("The listings should be cached by user and path:", driver.calls)
+	}
+
+	// The changes of a user invalidate its listings
+	c.handleCommand("DELE file\r\n")
+	c.path = "/"
+	list(c)
+	list(other)
+	if driver.calls != 4 {
+		t.Fatal("Only the listings of the user should be invalidated:", driver.calls)
+	}
+
+	// The driver can invalidate the listings changed outside of the sessions
+	server.InvalidateListings("", "/")
+	list(c)
+	list(other)
+	if driver.calls != 6 {
+		t.Fatal("The listings of all the users should be invalidated:", driver.calls)
+	}
+
+	// The same user name on another virtual host is another account
+	tenant := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server, driver: driver, path: "/", user: "user",
+		host: "ftp.example.com"}
+	list(tenant)
+	if driver.calls != 7 {
+		t.Fatal("The listings should be cached by virtual host:", driver.calls)
+	}
+	tenant.handleCommand("DELE file\r\n")
+	list(c)
+	list(tenant)
+	if driver.calls != 8 {
+		t.Fatal("Only the listings of the user on its virtual host should be invalidated:", driver.calls)
+	}
+
+	// Nothing is cached without TTL
+	server.Settings.ListingCacheTTL = 0
+	list(c)
+	if driver.calls != 9 {
+		t.Fatal("The listing shouldn't be cached:", driver.calls)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import "os"
+
+// ListingFilterProvider can be implemented by a ClientHandlingDriver to hide some entries of the listings, like the
+// files the user can't access or the internal metadata files, so that the visibility rules live in one place. The
+// server applies its filters to LIST, NLST, MLSD and STAT, on top of the hidden files policy.
+type ListingFilterProvider interface {
+	// ListingFilter returns the filter of the files of a directory (an absolute path), which keeps the files it
+	// returns true for. A nil filter lists all of them.
+	ListingFilter(cc ClientContext, directory string) func(os.FileInfo) bool
+}
+
+// listingFilter returns the filter of the files listed in the current directory: the hidden files policy, then the
+// filter of the driver. It's nil when all of them are listed.
+func (c *clientHandler) listingFilter() func(os.FileInfo) bool {
+	hidden := c.hiddenFilter()
+	var driver func(os.FileInfo) bool
+	if provider, ok := c.driver.(ListingFilterProvider); ok {
+		driver = provider.ListingFilter(c, c.Path())
+	}
+
+	switch {
+	case driver == nil:
+		return hidden
+	case hidden == nil:
+		return driver
+	}
+	return func(file os.FileInfo) bool {
+		return hidden(file) && driver(file)
+	}
+}
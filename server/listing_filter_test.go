@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// filteringDriver hides its metadata files, and everything in /private
+type filteringDriver struct {
+	listingDriver
+	directories []string
+}
+
+func (d *filteringDriver) ListingFilter(cc ClientContext, directory string) func(os.FileInfo) bool {
+	d.directories = append(d.directories, directory)
+	if directory == "/private" {
+		return func(os.FileInfo) bool { return false }
+	}
+	return func(file os.FileInfo) bool { return !strings.HasSuffix(file.Name(), ".meta") }
+}
+
+func TestListingFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{".profile", "a.csv", "a.csv.meta"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	files, _ := ioutil.ReadDir(dir)
+
+	var buf bytes.Buffer
+	driver := &filteringDriver{listingDriver: listingDriver{files: files}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{}, path: "/", driver: driver,
+		session: SessionSettings{HiddenFiles: HiddenFilesHide}}
+
+	if names := list(c); strings.Join(names, ",") != "a.csv" {
+		t.Fatal("The listing should be filtered by the policy and the driver:", names)
+	}
+	c.param = "-a"
+	if names := list(c); strings.Join(names, ",") != ".profile,a.csv" {
+		t.Fatal("The listing should be filtered by the driver:", names)
+	}
+
+	c.path = "/private"
+	c.param = ""
+	if names := list(c); len(names) != 0 {
+		t.Fatal("The listing should be empty:", names)
+	}
+	if strings.Join(driver.directories, ",") != "/,/,/private" {
+		t.Fatal("Wrong filtered directories:", driver.directories)
+	}
+}
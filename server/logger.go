@@ -0,0 +1,39 @@
+package server
+
+// Logger is the logging interface of the server. The message is the human-readable part of the log, it's followed
+// by alternated keys and values.
+//
+// Adapters are provided for go-kit (log/gokit) and log/slog (log/slog).
+type Logger interface {
+	// Debug logs a debugging message
+	Debug(msg string, keyvals ...interface{})
+
+	// Info logs an informational message
+	Info(msg string, keyvals ...interface{})
+
+	// Warn logs a warning message
+	Warn(msg string, keyvals ...interface{})
+
+	// Error logs an error message
+	Error(msg string, keyvals ...interface{})
+
+	// With returns a logger adding the provided keys and values to all its logs
+	With(keyvals ...interface{}) Logger
+}
+
+// nopLogger discards all the logs
+type nopLogger struct{}
+
+// NopLogger returns a logger that discards all the logs
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+func (l nopLogger) With(...interface{}) Logger {
+	return l
+}
@@ -0,0 +1,51 @@
+package server
+
+// Maintenance describes the maintenance mode of the server: the new logins are refused while the authenticated
+// sessions go on, to drain the server before stopping it
+type Maintenance struct {
+	Code    int    // Code of the reply to the logins: 421 (if 0) closes the connection, 530 keeps it open
+	Message string // Message of the reply, a default one if it's empty
+}
+
+// StartMaintenance puts the server in maintenance mode, or changes the reply of the current one
+func (server *FtpServer) StartMaintenance(maintenance *Maintenance) {
+	m := *maintenance
+	if m.Code == 0 {
+		m.Code = 421
+	}
+	if m.Message == "" {
+		m.Message = "Server under maintenance, try again later"
+	}
+	server.maintenance.Store(&m)
+	server.Logger.Info("Maintenance mode started", logKeyAction, "ftp.maintenance_start", "code", m.Code)
+}
+
+// StopMaintenance ends the maintenance mode, the logins are accepted again
+func (server *FtpServer) StopMaintenance() {
+	if server.Maintenance() == nil {
+		return
+	}
+	server.maintenance.Store((*Maintenance)(nil))
+	server.Logger.Info("Maintenance mode stopped", logKeyAction, "ftp.maintenance_stop")
+}
+
+// Maintenance returns the current maintenance mode, nil if the server isn't in maintenance
+func (server *FtpServer) Maintenance() *Maintenance {
+	m, _ := server.maintenance.Load().(*Maintenance)
+	return m
+}
+
+// checkMaintenance refuses the logins during the maintenance, the 421 replies close the connection. It returns false
+// if the login was refused.
+func (c *clientHandler) checkMaintenance() bool {
+	m := c.daddy.Maintenance()
+	if m == nil {
+		return true
+	}
+	c.writeMessage(m.Code, m.Message)
+	if m.Code == 421 {
+		c.disconnect()
+		c.reader = nil
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	go io.Copy(ioutil.Discard, client)
+	factory := &factoryDriver{}
+	c := &clientHandler{
+		writer: bufio.NewWriter(&buf),
+		reader: bufio.NewReader(server),
+		conn:   server,
+		daddy:  &FtpServer{Settings: &Settings{}, driver: factory, Logger: nopLogger{}},
+		logger: nopLogger{},
+	}
+
+	// The maintenance started after USER also refuses the login
+	c.handleCommand("USER test\r\n")
+	c.daddy.StartMaintenance(&Maintenance{Code: 530, Message: "Draining"})
+	c.handleCommand("PASS test\r\n")
+	c.handleCommand("USER test\r\n")
+	if buf.String() != "331 OK\r\n530 Draining\r\n530 Draining\r\n" || len(factory.drivers) != 0 {
+		t.Fatalf("The logins should be refused: %q", buf.String())
+	}
+	if c.reader == nil || !c.daddy.Health().Maintenance || c.daddy.Health().Ready() {
+		t.Fatal("The 530 replies should keep the connection, and the server shouldn't be ready")
+	}
+
+	// The sessions are accepted again after the maintenance
+	buf.Reset()
+	c.daddy.StopMaintenance()
+	c.handleCommand("USER test\r\n")
+	c.handleCommand("PASS test\r\n")
+	if buf.String() != "331 OK\r\n230 Password ok, continue\r\n" || c.daddy.Maintenance() != nil {
+		t.Fatalf("The login should be accepted: %q", buf.String())
+	}
+
+	// The authenticated sessions go on, the new logins are refused with a 421 closing the connection
+	buf.Reset()
+	c.daddy.StartMaintenance(&Maintenance{})
+	c.handleCommand("NOOP\r\n")
+	c.handleCommand("USER other\r\n")
+	if buf.String() != "200 OK\r\n421 Server under maintenance, try again later\r\n" || c.reader != nil {
+		t.Fatalf("The connection should be closed by the refused login: %q", buf.String())
+	}
+}
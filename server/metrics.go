@@ -0,0 +1,39 @@
+package server
+
+import "time"
+
+// Metrics is implemented by the metrics subsystems to collect the activity of the server
+type Metrics interface {
+	// CommandExecuted is called after each known command with its execution time and the code of its last reply
+	CommandExecuted(command string, duration time.Duration, code int)
+}
+
+// SessionMetrics can be implemented by the Metrics whose labels can have a high cardinality (traces, wide events...)
+// to label the commands with the UID of their session. It's called in place of CommandExecuted.
+type SessionMetrics interface {
+	// SessionCommandExecuted is called after each known command with the UID of its session
+	SessionCommandExecuted(sessionUID, command string, duration time.Duration, code int)
+}
+
+// UnsupportedCommandMetrics can be implemented by the Metrics to collect the commands the server doesn't support
+type UnsupportedCommandMetrics interface {
+	// UnsupportedCommand is called for each unknown or disabled command, like "XCRC" or "SITE QUOTA". The garbage
+	// commands are reported as "OTHER".
+	UnsupportedCommand(command string)
+}
+
+// TransferMetrics can be implemented by the Metrics to collect the file transfers
+type TransferMetrics interface {
+	// TransferDone is called after each upload or download with the transferred bytes, err is nil if it succeeded
+	TransferDone(direction TransferDirection, size int64, duration time.Duration, err error)
+}
+
+// ConnectionMetrics can be implemented by the Metrics to collect the connections
+type ConnectionMetrics interface {
+	// ClientConnected is called when a client connects, with the number of connected clients
+	ClientConnected(sessions int)
+
+	// ClientDisconnected is called when a client disconnects, with the number of clients still connected and the
+	// duration of the session
+	ClientDisconnected(sessions int, duration time.Duration)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+// PartialUpload is an upload that failed (aborted, broken data connection, lost session...) and left a partial file
+// behind. It can still be resumed with a REST, until the janitor cleans it up.
+type PartialUpload struct {
+	Path     string    // Path of the partial file
+	User     string    // User who uploaded it
+	ClientID uint32    // ID of the session
+	Size     int64     // Bytes received before the failure
+	Cause    error     // Why the upload failed
+	Time     time.Time // Time of the failure
+}
+
+// PartialUploadCleaner can be implemented by a MainDriver to handle the expired partial uploads itself: moving them
+// aside, reporting them... Without it, they are deleted with the driver of the session that uploaded them (which is
+// closed if the session is over).
+type PartialUploadCleaner interface {
+	// CleanPartialUpload is called once the partial upload is older than Settings.PartialUploadTTL
+	CleanPartialUpload(upload *PartialUpload) error
+}
+
+// partialUpload is a tracked partial upload, with the session it is cleaned up through
+type partialUpload struct {
+	PartialUpload
+	driver ClientHandlingDriver
+	cc     ClientContext
+}
+
+// partialUploadKey identifies a file of a user, the paths of the users might be in different file systems
+func partialUploadKey(user, path string) string {
+	return user + "\x00" + path
+}
+
+// trackPartialUpload records the partial file left by a failed upload
+func (c *clientHandler) trackPartialUpload(path string, size int64, cause error) {
+	if c.daddy.Settings == nil || c.daddy.Settings.PartialUploadTTL == 0 {
+		return
+	}
+	upload := &partialUpload{
+		PartialUpload: PartialUpload{
+			Path:     path,
+			User:     c.user,
+			ClientID: c.id,
+			Size:     size,
+			Cause:    cause,
+			Time:     time.Now(),
+		},
+		driver: c.driver,
+		cc:     c,
+	}
+
+	c.daddy.partialsMutex.Lock()
+	defer c.daddy.partialsMutex.Unlock()
+	if c.daddy.partials == nil {
+		c.daddy.partials = make(map[string]*partialUpload)
+	}
+	c.daddy.partials[partialUploadKey(c.user, path)] = upload
+}
+
+// forgetPartialUpload stops tracking a file that was completed or deleted
+func (c *clientHandler) forgetPartialUpload(path string) {
+	c.daddy.partialsMutex.Lock()
+	defer c.daddy.partialsMutex.Unlock()
+	delete(c.daddy.partials, partialUploadKey(c.user, path))
+}
+
+// PartialUploads returns the partial uploads that weren't cleaned up yet, the oldest first
+func (server *FtpServer) PartialUploads() []PartialUpload {
+	server.partialsMutex.Lock()
+	defer server.partialsMutex.Unlock()
+	uploads := make([]PartialUpload, 0, len(server.partials))
+	for _, upload := range server.partials {
+		uploads = append(uploads, upload.PartialUpload)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Time.Before(uploads[j].Time) })
+	return uploads
+}
+
+// CleanPartialUploads cleans up the partial uploads older than maxAge, and returns how many were. The ones that
+// couldn't be cleaned up are tried again on the next call.
+func (server *FtpServer) CleanPartialUploads(maxAge time.Duration) int {
+	expired := []*partialUpload{}
+	limit := time.Now().Add(-maxAge)
+	server.partialsMutex.Lock()
+	for key, upload := range server.partials {
+		if upload.Time.Before(limit) {
+			expired = append(expired, upload)
+			delete(server.partials, key)
+		}
+	}
+	server.partialsMutex.Unlock()
+
+	cleaned := 0
+	for _, upload := range expired {
+		var err error
+		if cleaner, ok := server.driver.(PartialUploadCleaner); ok {
+			err = cleaner.CleanPartialUpload(&upload.PartialUpload)
+		} else {
+			err = upload.driver.DeleteFile(upload.cc, upload.Path)
+		}
+		if err != nil {
+			server.Logger.Warn("Couldn't clean up a partial upload", logKeyAction, "ftp.partial_upload_cleanup",
+				"path", upload.Path, "user", upload.User, "err", err)
+			server.retryPartialUpload(upload)
+			continue
+		}
+		server.Logger.Info("Partial upload cleaned up", logKeyAction, "ftp.partial_upload_cleanup",
+			"path", upload.Path, "user", upload.User, "size", upload.Size)
+		cleaned++
+	}
+	return cleaned
+}
+
+// retryPartialUpload tracks again a partial upload that couldn't be cleaned up, unless a newer one replaced it
+func (server *FtpServer) retryPartialUpload(upload *partialUpload) {
+	server.partialsMutex.Lock()
+	defer server.partialsMutex.Unlock()
+	key := partialUploadKey(upload.User, upload.Path)
+	if _, ok := server.partials[key]; !ok {
+		server.partials[key] = upload
+	}
+}
+
+// startUploadJanitor periodically cleans up the partial uploads older than Settings.PartialUploadTTL, until the
+// server is stopped
+func (server *FtpServer) startUploadJanitor() {
+	if server.Settings.PartialUploadTTL <= 0 {
+		return
+	}
+
+	ttl := time.Duration(server.Settings.PartialUploadTTL) * time.Second
+	period := ttl / 4
+	if period < time.Second {
+		period = time.Second
+	}
+
+	done := make(chan struct{})
+	server.janitorDone = done
+	ticker := time.NewTicker(period)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				server.CleanPartialUploads(ttl)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
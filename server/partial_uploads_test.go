@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cleanerDriver reports the expired partial uploads
+type cleanerDriver struct {
+	MainDriver
+	cleaned []PartialUpload
+	err     error
+}
+
+func (d *cleanerDriver) CleanPartialUpload(upload *PartialUpload) error {
+	d.cleaned = append(d.cleaned, *upload)
+	return d.err
+}
+
+func TestPartialUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	server := &FtpServer{Settings: &Settings{PartialUploadTTL: 3600}, Logger: nopLogger{}}
+	server.bufferPool.New = func() interface{} {
+		b := make([]byte, 1024)
+		return &b
+	}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server, driver: &dirDriver{dir: dir}, path: "/",
+		user: "user", logger: nopLogger{}}
+
+	// The aborted uploads are tracked until they are completed
+	c.setAbortCause(ErrTransferAborted)
+	upload(c, []byte("partial"))
+	if uploads := server.PartialUploads(); len(uploads) != 1 || uploads[0].Path != "/file" ||
+		uploads[0].User != "user" || uploads[0].Cause != ErrTransferAborted {
+		t.Fatal("The aborted upload should be tracked:", uploads)
+	}
+	c.setAbortCause(nil)
+	upload(c, []byte("complete"))
+	if uploads := server.PartialUploads(); len(uploads) != 0 {
+		t.Fatal("The completed upload shouldn't be tracked:", uploads)
+	}
+
+	// The expired ones are deleted
+	c.setAbortCause(ErrControlConnectionLost)
+	upload(c, []byte("partial"))
+	if cleaned := server.CleanPartialUploads(time.Hour); cleaned != 0 {
+		t.Fatal("The recent partial uploads should be kept:", cleaned)
+	}
+	if cleaned := server.CleanPartialUploads(0); cleaned != 1 {
+		t.Fatal("The partial upload should be cleaned up:", cleaned)
+	}
+	if _, errStat := os.Stat(filepath.Join(dir, "file")); !os.IsNotExist(errStat) {
+		t.Fatal("The partial file should be deleted:", errStat)
+	}
+
+	// The main driver can handle them itself, the failures are tried again
+	cleaner := &cleanerDriver{err: errors.New("unavailable")}
+	server.driver = cleaner
+	upload(c, []byte("partial"))
+	if cleaned := server.CleanPartialUploads(0); cleaned != 0 || len(cleaner.cleaned) != 1 ||
+		len(server.PartialUploads()) != 1 {
+		t.Fatal("The failed cleanup should be tried again:", cleaned, len(cleaner.cleaned))
+	}
+	cleaner.err = nil
+	if cleaned := server.CleanPartialUploads(0); cleaned != 1 || len(server.PartialUploads()) != 0 {
+		t.Fatal("The partial upload should be cleaned up by the driver:", cleaned)
+	}
+	if _, errStat := os.Stat(filepath.Join(dir, "file")); errStat != nil {
+		t.Fatal("The driver should handle the partial file:", errStat)
+	}
+}
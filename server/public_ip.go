@@ -0,0 +1,337 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PublicIPResolver finds the public IP address advertised in the PASV replies when Settings.PublicHost isn't defined
+type PublicIPResolver interface {
+	// PublicIP returns the current public IP address
+	PublicIP() (net.IP, error)
+}
+
+// StaticIPResolver always returns the same IP address
+type StaticIPResolver net.IP
+
+// PublicIP returns the static IP address
+func (r StaticIPResolver) PublicIP() (net.IP, error) {
+	if r == nil {
+		return nil, errors.New("no static IP address")
+	}
+	return net.IP(r), nil
+}
+
+// HTTPIPResolver fetches the IP address from an HTTP service returning it as plain text, like
+// http://checkip.amazonaws.com or a cloud metadata service
+type HTTPIPResolver struct {
+	URL    string            // URL of the service
+	Header map[string]string // Headers to add to the request
+	Client *http.Client      // HTTP client (a client with a 10s timeout is used if not specified)
+}
+
+// NewAWSIPResolver creates a resolver using the EC2 instance metadata
+func NewAWSIPResolver() *HTTPIPResolver {
+	return &HTTPIPResolver{URL: "http://169.254.169.254/latest/meta-data/public-ipv4"}
+}
+
+// NewGCPIPResolver creates a resolver using the Google Compute Engine instance metadata
+func NewGCPIPResolver() *HTTPIPResolver {
+	return &HTTPIPResolver{
+		URL:    "http://metadata.google.internal/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+		Header: map[string]string{"Metadata-Flavor": "Google"},
+	}
+}
+
+// PublicIP fetches the IP address
+func (r *HTTPIPResolver) PublicIP() (net.IP, error) {
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range r.Header {
+		req.Header.Set(key, value)
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", r.URL, rsp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(string(bytes.TrimSpace(buf)))
+	if ip == nil {
+		return nil, fmt.Errorf("%s didn't return an IP address", r.URL)
+	}
+	return ip, nil
+}
+
+// STUN (RFC 5389) constants
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingResponse  = 0x0101
+	stunMagicCookie      = 0x2112A442
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+	stunHeaderSize       = 20
+)
+
+// STUNIPResolver asks a STUN server the address our UDP packets come from
+type STUNIPResolver struct {
+	Server  string        // STUN server address (host:port), like "stun.l.google.com:19302"
+	Timeout time.Duration // Time to wait for the response (5s if not specified)
+}
+
+// PublicIP sends a STUN binding request and returns the IP address of its response
+func (r *STUNIPResolver) PublicIP() (net.IP, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	conn, err := net.DialTimeout("udp", r.Server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	if _, err = rand.Read(request[8:stunHeaderSize]); err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 1500)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSTUNResponse(response[:n], request[8:stunHeaderSize])
+}
+
+// parseSTUNResponse extracts the mapped address of a binding response
+func parseSTUNResponse(response []byte, transactionID []byte) (net.IP, error) {
+	if len(response) < stunHeaderSize || binary.BigEndian.Uint16(response[0:]) != stunBindingResponse {
+		return nil, errors.New("not a STUN binding response")
+	}
+	if !bytes.Equal(response[8:stunHeaderSize], transactionID) {
+		return nil, errors.New("STUN transaction mismatch")
+	}
+
+	length := int(binary.BigEndian.Uint16(response[2:]))
+	if stunHeaderSize+length > len(response) {
+		return nil, errors.New("truncated STUN response")
+	}
+
+	var mapped net.IP
+	attributes := response[stunHeaderSize : stunHeaderSize+length]
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:]))
+		if 4+attrLength > len(attributes) {
+			break
+		}
+		value := attributes[4 : 4+attrLength]
+
+		switch attrType {
+		case stunXorMappedAddress:
+			if ip := stunAddress(value, response[4:stunHeaderSize]); ip != nil {
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+
+		// Attributes are padded to 4 bytes
+		next := 4 + (attrLength+3)&^3
+		if next > len(attributes) {
+			break
+		}
+		attributes = attributes[next:]
+	}
+
+	if mapped == nil {
+		return nil, errors.New("no address in the STUN response")
+	}
+	return mapped, nil
+}
+
+// stunAddress decodes a (XOR-)MAPPED-ADDRESS attribute, the address is XORed with the key if defined
+func stunAddress(value []byte, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip
+}
+
+// defaultPublicHostTTL is how long a resolved PublicHost name is kept by default
+const defaultPublicHostTTL = 30 * time.Second
+
+// lookupIP resolves host names, it can be replaced by the tests
+var lookupIP = net.LookupIP
+
+// hostCache keeps the last resolution of the PublicHost name
+type hostCache struct {
+	mutex  sync.Mutex // Cache sync
+	name   string     // Resolved name
+	ip     net.IP     // Resolved IP
+	expiry time.Time  // Time after which the name has to be resolved again
+}
+
+// publicHost returns the host to advertise in the PASV replies, an empty string if nothing is known
+func (server *FtpServer) publicHost() string {
+	if host := server.Settings.PublicHost; host != "" {
+		if net.ParseIP(host) != nil {
+			return host
+		}
+		if ip := server.resolvePublicHost(host); ip != nil {
+			return ip.String()
+		}
+		return ""
+	}
+	if ip, ok := server.publicIP.Load().(net.IP); ok {
+		return ip.String()
+	}
+	return ""
+}
+
+// resolvePublicHost resolves the PublicHost name into an IPv4 address. The result is cached for
+// Settings.PublicHostTTLSeconds and the last known address is kept when the resolution fails.
+func (server *FtpServer) resolvePublicHost(name string) net.IP {
+	cache := &server.hostCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	if cache.name == name && now.Before(cache.expiry) {
+		return cache.ip
+	}
+
+	if cache.name != name {
+		cache.name = name
+		cache.ip = nil
+	}
+
+	ttl := defaultPublicHostTTL
+	if server.Settings.PublicHostTTLSeconds != 0 {
+		ttl = time.Duration(server.Settings.PublicHostTTLSeconds) * time.Second
+	}
+
+	ips, err := lookupIP(name)
+	if err != nil {
+		server.Logger.Warn("Couldn't resolve the public host", "host", name, "err", err)
+		return cache.ip
+	}
+
+	var ip net.IP
+	for _, candidate := range ips {
+		if ipv4 := candidate.To4(); ipv4 != nil {
+			ip = ipv4
+			break
+		}
+	}
+	if ip == nil {
+		server.Logger.Warn("The public host has no IPv4 address", "host", name)
+		return cache.ip
+	}
+
+	if !ip.Equal(cache.ip) {
+		server.Logger.Info("Public host resolved", logKeyAction, "ftp.public_host", "host", name, "ip", ip)
+	}
+	cache.ip = ip
+	cache.expiry = now.Add(ttl)
+	return ip
+}
+
+// resolvePublicIP updates the public IP with the PublicIPResolver
+func (server *FtpServer) resolvePublicIP() {
+	ip, err := server.PublicIPResolver.PublicIP()
+	if err != nil {
+		server.Logger.Warn("Couldn't resolve the public IP", "err", err)
+		return
+	}
+
+	if previous, ok := server.publicIP.Load().(net.IP); !ok || !previous.Equal(ip) {
+		server.Logger.Info("Public IP resolved", logKeyAction, "ftp.public_ip", "ip", ip)
+	}
+	server.publicIP.Store(ip)
+}
+
+// startPublicIPResolution resolves the public IP and keeps it up to date until the server is stopped
+func (server *FtpServer) startPublicIPResolution() {
+	if server.PublicIPResolver == nil || server.Settings.PublicHost != "" {
+		return
+	}
+
+	server.resolvePublicIP()
+
+	if server.Settings.PublicIPRefreshSeconds <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	server.resolverDone = done
+	ticker := time.NewTicker(time.Duration(server.Settings.PublicIPRefreshSeconds) * time.Second)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				server.resolvePublicIP()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSTUNResponse(t *testing.T) {
+	transactionID := []byte("0123456789ab")
+
+	response := make([]byte, stunHeaderSize+12)
+	binary.BigEndian.PutUint16(response[0:], stunBindingResponse)
+	binary.BigEndian.PutUint16(response[2:], 12)
+	binary.BigEndian.PutUint32(response[4:], stunMagicCookie)
+	copy(response[8:], transactionID)
+
+	// XOR-MAPPED-ADDRESS of 203.0.113.7:4242
+	attribute := response[stunHeaderSize:]
+	binary.BigEndian.PutUint16(attribute[0:], stunXorMappedAddress)
+	binary.BigEndian.PutUint16(attribute[2:], 8)
+	attribute[5] = 0x01
+	binary.BigEndian.PutUint16(attribute[6:], 4242^(stunMagicCookie>>16))
+	binary.BigEndian.PutUint32(attribute[8:], binary.BigEndian.Uint32(net.ParseIP("203.0.113.7").To4())^stunMagicCookie)
+
+	ip, err := parseSTUNResponse(response, transactionID)
+	if err != nil {
+		t.Fatal("Couldn't parse the response:", err)
+	}
+	if !ip.Equal(net.ParseIP("203.0.113.7")) {
+		t.Fatal("Bad IP:", ip)
+	}
+
+	if _, err := parseSTUNResponse(response, []byte("another-one!")); err == nil {
+		t.Fatal("The transaction ID should be checked")
+	}
+}
+
+func TestHTTPIPResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintln(w, "198.51.100.1")
+	}))
+	defer ts.Close()
+
+	resolver := &HTTPIPResolver{URL: ts.URL}
+	if _, err := resolver.PublicIP(); err == nil {
+		t.Fatal("The error status should be reported")
+	}
+
+	resolver.Header = map[string]string{"Metadata-Flavor": "Google"}
+	ip, err := resolver.PublicIP()
+	if err != nil {
+		t.Fatal("Couldn't resolve:", err)
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.1")) {
+		t.Fatal("Bad IP:", ip)
+	}
+}
+
+func TestPublicHost(t *testing.T) {
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{}
+	server.PublicIPResolver = StaticIPResolver(net.ParseIP("192.0.2.1"))
+
+	if host := server.publicHost(); host != "" {
+		t.Fatal("Nothing should be known yet:", host)
+	}
+
+	server.startPublicIPResolution()
+	if host := server.publicHost(); host != "192.0.2.1" {
+		t.Fatal("Bad resolved host:", host)
+	}
+
+	server.Settings.PublicHost = "192.0.2.2"
+	if host := server.publicHost(); host != "192.0.2.2" {
+		t.Fatal("The settings should have the priority:", host)
+	}
+}
+
+func TestPublicHostName(t *testing.T) {
+	lookups := 0
+	addresses := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.10")}
+	lookupIP = func(host string) ([]net.IP, error) {
+		lookups++
+		if host != "ftp.example.com" || addresses == nil {
+			return nil, errors.New("no such host")
+		}
+		return addresses, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{PublicHost: "ftp.example.com"}
+
+	if host := server.publicHost(); host != "192.0.2.10" {
+		t.Fatal("Bad host:", host)
+	}
+	server.publicHost()
+	if lookups != 1 {
+		t.Fatal("The resolution should have been cached:", lookups)
+	}
+
+	// Without any cache, the last known address is kept if the resolution fails
+	server.Settings.PublicHostTTLSeconds = -1
+	server.hostCache.expiry = time.Time{}
+	addresses = nil
+	if host := server.publicHost(); host != "192.0.2.10" || lookups != 2 {
+		t.Fatal("Bad host:", host, lookups)
+	}
+
+	addresses = []net.IP{net.ParseIP("192.0.2.11")}
+	if host := server.publicHost(); host != "192.0.2.11" {
+		t.Fatal("The new address should be used:", host)
+	}
+}
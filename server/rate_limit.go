@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultCommandRateWarnings is the number of refused commands before the connection is closed
+const defaultCommandRateWarnings = 3
+
+// commandLimiter is the token bucket limiting the commands of a connection
+type commandLimiter struct {
+	rate     float64   // Commands per second
+	burst    float64   // Size of the bucket
+	tokens   float64   // Commands that can be executed now
+	last     time.Time // Last refill of the bucket
+	warnings int       // Commands refused since the bucket was last full
+}
+
+func newCommandLimiter(settings *Settings) *commandLimiter {
+	if settings.CommandRate <= 0 {
+		return nil
+	}
+	burst := settings.CommandBurst
+	if burst <= 0 {
+		burst = settings.CommandRate
+	}
+	return &commandLimiter{
+		rate:   float64(settings.CommandRate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow tells if a command can be executed now
+func (l *commandLimiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+	if l.tokens >= l.burst {
+		l.tokens = l.burst
+		l.warnings = 0
+	}
+	if l.tokens < 1 {
+		l.warnings++
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// checkCommandRate refuses the commands going beyond the command rate, the connection is closed when the client
+// keeps on going after some warnings
+func (c *clientHandler) checkCommandRate() bool {
+	if c.cmdLimiter == nil || c.cmdLimiter.allow(time.Now()) {
+		return true
+	}
+
+	max := c.daddy.Settings.CommandRateWarnings
+	if max <= 0 {
+		max = defaultCommandRateWarnings
+	}
+	if c.cmdLimiter.warnings > max {
+		c.logger.Warn("Command rate exceeded", logKeyAction, "ftp.rate_exceeded", "rate", c.daddy.Settings.CommandRate)
+		c.writeMessage(421, "Too many commands, closing the connection")
+		c.disconnect()
+		c.reader = nil
+		return false
+	}
+
+	c.writeMessage(450, fmt.Sprintf("Too many commands (%d per second allowed), slow down", c.daddy.Settings.CommandRate))
+	return false
+}
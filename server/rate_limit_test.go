@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandLimiter(t *testing.T) {
+	if newCommandLimiter(&Settings{}) != nil {
+		t.Fatal("There should be no limit by default")
+	}
+
+	l := newCommandLimiter(&Settings{CommandRate: 10, CommandBurst: 5})
+	now := l.last
+
+	for i := 0; i < 5; i++ {
+		if !l.allow(now) {
+			t.Fatal("The burst should be accepted:", i)
+		}
+	}
+	if l.allow(now) || l.allow(now) || l.warnings != 2 {
+		t.Fatal("The commands beyond the burst should be refused:", l.warnings)
+	}
+
+	// 100ms later, one more command is accepted
+	now = now.Add(100 * time.Millisecond)
+	if !l.allow(now) || l.allow(now) {
+		t.Fatal("Only one command should be accepted after 100ms")
+	}
+
+	// Slowing down clears the warnings
+	now = now.Add(time.Second)
+	if !l.allow(now) || l.warnings != 0 {
+		t.Fatal("The warnings should be cleared:", l.warnings)
+	}
+}
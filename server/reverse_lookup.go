@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReverseLookupTimeout  = 2 * time.Second // Time a reverse lookup can take when Settings.ReverseLookupTimeout is 0
+	defaultReverseLookupCacheTTL = 5 * time.Minute // Time a host name is kept when Settings.ReverseLookupCacheTTL is 0
+	maxReverseLookupCacheEntries = 10000           // Addresses kept in the cache of the reverse lookups
+)
+
+// ReverseResolver finds the host name of a client, when Settings.ReverseLookup is set. It replaces the DNS lookups
+// to use another source (like an inventory of the partners), or none at all.
+type ReverseResolver interface {
+	// LookupHost returns the host name of an IP address, giving up once the context is done
+	LookupHost(ctx context.Context, ip net.IP) (string, error)
+}
+
+// DNSReverseResolver finds the host names with the PTR records of the system resolver
+type DNSReverseResolver struct{}
+
+// LookupHost returns the first name of the PTR records of the address
+func (DNSReverseResolver) LookupHost(ctx context.Context, ip net.IP) (string, error) {
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", errors.New("no PTR record")
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+// reverseCache keeps the last reverse lookups, the failed ones included
+type reverseCache struct {
+	mutex   sync.Mutex              // Cache sync
+	entries map[string]reverseEntry // Host names by IP address
+}
+
+// reverseEntry is a host name in the reverseCache
+type reverseEntry struct {
+	name   string    // Host name, empty if it couldn't be found
+	expiry time.Time // Time after which the address has to be resolved again
+}
+
+// reverseLookup returns the host name of an IP address, an empty string if it couldn't be found in time
+func (server *FtpServer) reverseLookup(ip net.IP) string {
+	ttl := defaultReverseLookupCacheTTL
+	if server.Settings.ReverseLookupCacheTTL != 0 {
+		ttl = time.Duration(server.Settings.ReverseLookupCacheTTL) * time.Second
+	}
+
+	cache := &server.reverseCache
+	key := ip.String()
+	if ttl > 0 {
+		cache.mutex.Lock()
+		entry, ok := cache.entries[key]
+		cache.mutex.Unlock()
+		if ok && time.Now().Before(entry.expiry) {
+			return entry.name
+		}
+	}
+
+	timeout := defaultReverseLookupTimeout
+	if server.Settings.ReverseLookupTimeout > 0 {
+		timeout = time.Duration(server.Settings.ReverseLookupTimeout) * time.Millisecond
+	}
+	var resolver ReverseResolver = DNSReverseResolver{}
+	if server.ReverseResolver != nil {
+		resolver = server.ReverseResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	name, err := resolver.LookupHost(ctx, ip)
+	if err != nil {
+		server.Logger.Debug("Reverse lookup failed", logKeyAction, "ftp.reverse_lookup_failed", "ip", key, "err", err)
+		name = ""
+	}
+
+	if ttl > 0 {
+		cache.mutex.Lock()
+		now := time.Now()
+		if cache.entries == nil {
+			cache.entries = make(map[string]reverseEntry)
+		}
+		if len(cache.entries) >= maxReverseLookupCacheEntries {
+			for address, entry := range cache.entries {
+				if now.After(entry.expiry) {
+					delete(cache.entries, address)
+				}
+			}
+			// Still full of valid entries: starting over is simpler than tracking the oldest ones
+			if len(cache.entries) >= maxReverseLookupCacheEntries {
+				cache.entries = make(map[string]reverseEntry)
+			}
+		}
+		cache.entries[key] = reverseEntry{name: name, expiry: now.Add(ttl)}
+		cache.mutex.Unlock()
+	}
+	return name
+}
+
+// lookupRemoteHost finds the host name of the client when the reverse lookups are enabled, it's then in RemoteHost
+// and in the logs of the session
+func (c *clientHandler) lookupRemoteHost() {
+	if !c.daddy.Settings.ReverseLookup {
+		return
+	}
+	c.paramsMutex.RLock()
+	host, _, err := net.SplitHostPort(c.remoteAddr)
+	c.paramsMutex.RUnlock()
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil {
+		return
+	}
+
+	name := c.daddy.reverseLookup(ip)
+	if name == "" {
+		return
+	}
+	c.paramsMutex.Lock()
+	c.remoteHost = name
+	c.paramsMutex.Unlock()
+	c.logger = c.logger.With("remoteHost", name)
+}
+
+// RemoteHost returns the host name of the client found by the reverse lookup
+func (c *clientHandler) RemoteHost() string {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.remoteHost
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// stubResolver gives the host names of a map, and blocks on the other addresses until the lookup times out
+type stubResolver struct {
+	names   map[string]string
+	lookups int
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, ip net.IP) (string, error) {
+	r.lookups++
+	if name, ok := r.names[ip.String()]; ok {
+		return name, nil
+	}
+	<-ctx.Done()
+	return "", errors.New("timeout")
+}
+
+func TestReverseLookup(t *testing.T) {
+	resolver := &stubResolver{names: map[string]string{"192.0.2.1": "client.example.com"}}
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{ReverseLookup: true, ReverseLookupTimeout: 10}
+	server.ReverseResolver = resolver
+
+	c := &clientHandler{daddy: server, remoteAddr: "192.0.2.1:4242", logger: nopLogger{}}
+	c.lookupRemoteHost()
+	if c.RemoteHost() != "client.example.com" {
+		t.Fatal("Wrong host name:", c.RemoteHost())
+	}
+	c.lookupRemoteHost()
+	if resolver.lookups != 1 {
+		t.Fatal("The host name should be cached:", resolver.lookups)
+	}
+
+	start := time.Now()
+	other := &clientHandler{daddy: server, remoteAddr: "192.0.2.2:4242", logger: nopLogger{}}
+	other.lookupRemoteHost()
+	if other.RemoteHost() != "" || time.Since(start) > time.Second {
+		t.Fatal("The lookup should time out:", other.RemoteHost(), time.Since(start))
+	}
+	other.lookupRemoteHost()
+	if resolver.lookups != 2 {
+		t.Fatal("The failed lookups should be cached too:", resolver.lookups)
+	}
+
+	server.Settings.ReverseLookupCacheTTL = -1
+	c.lookupRemoteHost()
+	if resolver.lookups != 3 {
+		t.Fatal("The host names shouldn't be cached:", resolver.lookups)
+	}
+
+	server.Settings.ReverseLookup = false
+	disabled := &clientHandler{daddy: server, remoteAddr: "192.0.2.1:4242", logger: nopLogger{}}
+	disabled.lookupRemoteHost()
+	if disabled.RemoteHost() != "" || resolver.lookups != 3 {
+		t.Fatal("The lookups should be disabled")
+	}
+}
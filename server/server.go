@@ -4,24 +4,28 @@ package server
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 )
 
 const (
-	// logKeyMsg is the human-readable part of the log
-	logKeyMsg = "msg"
 	// logKeyAction is the machine-readable part of the log
 	logKeyAction = "action"
 )
 
+// redactedCommands are the commands whose param should never be logged
+var redactedCommands = map[string]bool{
+	"PASS": true,
+}
+
 // CommandDescription defines which function should be used and if it should be open to anyone or only logged in users
 type CommandDescription struct {
-	Open bool                 // Open to clients without auth
-	Fn   func(*clientHandler) // Function to handle it
+	Open     bool                 // Open to clients without auth
+	Path     bool                 // The param is a path
+	Transfer bool                 // Data transfer command, executed while the control connection is still read
+	Fn       func(*clientHandler) // Function to handle it
 }
 
 var commandsMap map[string]*CommandDescription
@@ -33,8 +37,10 @@ func init() {
 	commandsMap = make(map[string]*CommandDescription)
 
 	// Authentication
+	commandsMap["HOST"] = &CommandDescription{Fn: (*clientHandler).handleHOST, Open: true}
 	commandsMap["USER"] = &CommandDescription{Fn: (*clientHandler).handleUSER, Open: true}
 	commandsMap["PASS"] = &CommandDescription{Fn: (*clientHandler).handlePASS, Open: true}
+	commandsMap["ACCT"] = &CommandDescription{Fn: (*clientHandler).handleACCT, Open: true}
 
 	// TLS handling
 	commandsMap["AUTH"] = &CommandDescription{Fn: (*clientHandler).handleAUTH, Open: true}
@@ -46,68 +52,106 @@ func init() {
 	commandsMap["SYST"] = &CommandDescription{Fn: (*clientHandler).handleSYST, Open: true}
 	commandsMap["NOOP"] = &CommandDescription{Fn: (*clientHandler).handleNOOP, Open: true}
 	commandsMap["OPTS"] = &CommandDescription{Fn: (*clientHandler).handleOPTS, Open: true}
+	commandsMap["CLNT"] = &CommandDescription{Fn: (*clientHandler).handleCLNT, Open: true}
+	commandsMap["LANG"] = &CommandDescription{Fn: (*clientHandler).handleLANG, Open: true}
+	commandsMap["HELP"] = &CommandDescription{Fn: (*clientHandler).handleHELP, Open: true}
 
 	// File access
-	commandsMap["SIZE"] = &CommandDescription{Fn: (*clientHandler).handleSIZE}
+	commandsMap["SIZE"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleSIZE}
 	commandsMap["STAT"] = &CommandDescription{Fn: (*clientHandler).handleSTAT}
-	commandsMap["MDTM"] = &CommandDescription{Fn: (*clientHandler).handleMDTM}
-	commandsMap["RETR"] = &CommandDescription{Fn: (*clientHandler).handleRETR}
-	commandsMap["STOR"] = &CommandDescription{Fn: (*clientHandler).handleSTOR}
-	commandsMap["APPE"] = &CommandDescription{Fn: (*clientHandler).handleAPPE}
-	commandsMap["DELE"] = &CommandDescription{Fn: (*clientHandler).handleDELE}
-	commandsMap["RNFR"] = &CommandDescription{Fn: (*clientHandler).handleRNFR}
-	commandsMap["RNTO"] = &CommandDescription{Fn: (*clientHandler).handleRNTO}
+	commandsMap["MDTM"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleMDTM}
+	commandsMap["RETR"] = &CommandDescription{Path: true, Transfer: true, Fn: (*clientHandler).handleRETR}
+	commandsMap["STOR"] = &CommandDescription{Path: true, Transfer: true, Fn: (*clientHandler).handleSTOR}
+	commandsMap["APPE"] = &CommandDescription{Path: true, Transfer: true, Fn: (*clientHandler).handleAPPE}
+	commandsMap["DELE"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleDELE}
+	commandsMap["RNFR"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleRNFR}
+	commandsMap["RNTO"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleRNTO}
 	commandsMap["ALLO"] = &CommandDescription{Fn: (*clientHandler).handleALLO}
+	commandsMap["AVBL"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleAVBL}
+	commandsMap["MFF"] = &CommandDescription{Fn: (*clientHandler).handleMFF}
+	commandsMap["MFCT"] = &CommandDescription{Fn: (*clientHandler).handleMFCT}
 	commandsMap["REST"] = &CommandDescription{Fn: (*clientHandler).handleREST}
+	commandsMap["RANG"] = &CommandDescription{Fn: (*clientHandler).handleRANG}
 	commandsMap["SITE"] = &CommandDescription{Fn: (*clientHandler).handleSITE}
+	commandsMap["COMB"] = &CommandDescription{Fn: (*clientHandler).handleCOMB}
 
 	// Directory handling
-	commandsMap["CWD"] = &CommandDescription{Fn: (*clientHandler).handleCWD}
+	commandsMap["CWD"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleCWD}
 	commandsMap["PWD"] = &CommandDescription{Fn: (*clientHandler).handlePWD}
 	commandsMap["CDUP"] = &CommandDescription{Fn: (*clientHandler).handleCDUP}
-	commandsMap["NLST"] = &CommandDescription{Fn: (*clientHandler).handleLIST}
-	commandsMap["LIST"] = &CommandDescription{Fn: (*clientHandler).handleLIST}
-	commandsMap["MLSD"] = &CommandDescription{Fn: (*clientHandler).handleMLSD}
-	commandsMap["MKD"] = &CommandDescription{Fn: (*clientHandler).handleMKD}
-	commandsMap["RMD"] = &CommandDescription{Fn: (*clientHandler).handleRMD}
+	commandsMap["NLST"] = &CommandDescription{Transfer: true, Fn: (*clientHandler).handleLIST}
+	commandsMap["LIST"] = &CommandDescription{Transfer: true, Fn: (*clientHandler).handleLIST}
+	commandsMap["MLSD"] = &CommandDescription{Transfer: true, Fn: (*clientHandler).handleMLSD}
+	commandsMap["MKD"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleMKD}
+	commandsMap["RMD"] = &CommandDescription{Path: true, Fn: (*clientHandler).handleRMD}
 
 	// Connection handling
 	commandsMap["TYPE"] = &CommandDescription{Fn: (*clientHandler).handleTYPE}
 	commandsMap["PASV"] = &CommandDescription{Fn: (*clientHandler).handlePASV}
 	commandsMap["EPSV"] = &CommandDescription{Fn: (*clientHandler).handlePASV}
 	commandsMap["PORT"] = &CommandDescription{Fn: (*clientHandler).handlePORT}
+	commandsMap["EPRT"] = &CommandDescription{Fn: (*clientHandler).handleEPRT}
+	commandsMap["ABOR"] = &CommandDescription{Fn: (*clientHandler).handleABOR}
 	commandsMap["QUIT"] = &CommandDescription{Fn: (*clientHandler).handleQUIT, Open: true}
 }
 
 // FtpServer is where everything is stored
 // We want to keep it as simple as possible
 type FtpServer struct {
-	Logger           log.Logger                // Go-Kit logger
+	Name             string                    // Name among the servers of the process, for the handoffs (HandoffAll)
+	Logger           Logger                    // Logger (nothing is logged by default)
+	Metrics          Metrics                   // Metrics collector (optional)
+	PublicIPResolver PublicIPResolver          // Public IP resolver, used when Settings.PublicHost isn't defined (optional)
+	ReverseResolver  ReverseResolver           // Resolver of the client host names when Settings.ReverseLookup is set (DNS if nil)
+	AuditSink        AuditSink                 // Audit trail of the security-relevant events (optional)
+	Transcript       TranscriptSink            // Recorder of the transcripts of the sessions (optional)
+	UploadNotifier   UploadNotifier            // Notified of the successful uploads (optional)
+	EventListener    EventListener             // Receives the session and transfer events (optional)
 	Settings         *Settings                 // General settings
-	Listener         net.Listener              // Listener used to receive files
+	Listener         net.Listener              // Listener used to receive files (created by Listen if nil)
 	StartTime        time.Time                 // Time when the server was started
 	connectionsByID  map[uint32]*clientHandler // Connections map
 	connectionsMutex sync.RWMutex              // Connections map sync
 	clientCounter    uint32                    // Clients counter
+	queued           int                       // Connections waiting for a free slot (Settings.ConnectionQueueSize)
+	slotFreed        chan struct{}             // Closed when a connection leaves, for the queued ones and Drain
 	driver           MainDriver                // Driver to handle the client authentication and the file access driver selection
+	bufferPool       sync.Pool                 // Transfer buffers shared by all the connections
+	listening        int32                     // The listener is accepting connections (atomically accessed)
+	lastError        error                     // Last error that happened at the server level
+	lastErrorTime    time.Time                 // Time of the last error
+	healthMutex      sync.Mutex                // Last error sync
+	healthServer     *http.Server              // HTTP health endpoint
+	debugServer      *http.Server              // HTTP debug endpoint
+	endpoints        map[string]net.Listener   // Listeners of the HTTP endpoints, by name (for Handoff)
+	inherited        map[string]net.Listener   // Listeners inherited from the previous process, by endpoint name
+	publicIP         atomic.Value              // Public IP found by the PublicIPResolver (net.IP)
+	hostCache        hostCache                 // Resolution of the PublicHost name
+	reverseCache     reverseCache              // Host names of the clients found by the reverse lookups
+	resolverDone     chan struct{}             // Stops the periodic public IP resolution
+	janitorDone      chan struct{}             // Stops the periodic cleanup of the partial uploads
+	backendDone      chan struct{}             // Stops the periodic backend checks
+	backend          atomic.Value              // Result of the last backend check (*backendState)
+	partials         map[string]*partialUpload // Partial uploads not cleaned up yet, by user and path
+	partialsMutex    sync.Mutex                // Partial uploads sync
+	uploads          map[string]uint32         // Files being uploaded (Settings.UploadLockPolicy), with their session ID
+	uploadsMutex     sync.Mutex                // Files being uploaded sync
+	unsupported      unsupportedTally          // Tallies of the unsupported commands
+	listings         listingCache              // Listings cached for Settings.ListingCacheTTL
+	bandwidth        *bandwidthScheduler       // Settings.GlobalBandwidth scheduler (nil if unlimited)
+	schedule         bandwidthSchedule         // Settings.BandwidthSchedule windows (nil if none)
+	fileNames        *fileNameChecker          // Settings.FileNamePolicy checker (nil without policy)
+	disabledCmds     map[string]bool           // Settings.DisabledCommands index (nil if none)
+	banner           string                    // Settings.Banner, or the content of Settings.BannerFile
+	catalogs         map[string]Catalog        // Catalogs of the languages supported by LANG, by upper case tag
+	maintenance      atomic.Value              // Maintenance mode (*Maintenance, nil if there's none)
+	stats            ServerStats               // Activity of all the sessions
+	statsMutex       sync.Mutex                // Activity sync
 }
 
 func (server *FtpServer) loadSettings() {
 	s := server.driver.GetSettings()
-	if s.ListenHost == "" {
-		s.ListenHost = "0.0.0.0"
-	}
-
-	if s.ListenPort == 0 { // For the default value (0)
-		// We take the default port (2121)
-		s.ListenPort = 2121
-	} else if s.ListenPort == -1 { // For the automatic value
-		// We let the system decide (0)
-		s.ListenPort = 0
-	}
-	if s.MaxConnections == 0 {
-		s.MaxConnections = 10000
-	}
+	applySettingsDefaults(s)
 	server.Settings = s
 }
 
@@ -117,32 +161,97 @@ func (server *FtpServer) Listen() error {
 	server.loadSettings()
 	var err error
 
-	server.Listener, err = net.Listen(
-		"tcp",
-		fmt.Sprintf("%s:%d", server.Settings.ListenHost, server.Settings.ListenPort),
-	)
+	if problems := checkSettings(server.Settings); len(problems) > 0 {
+		err = &ConfigError{Problems: problems}
+		server.Logger.Error("Bad settings", "err", err)
+		server.setLastError(err)
+		return err
+	}
+
+	if server.fileNames, err = newFileNameChecker(server.Settings.FileNamePolicy); err != nil {
+		server.Logger.Error("Bad file name policy", "err", err)
+		server.setLastError(err)
+		return err
+	}
+
+	server.disabledCmds = newDisabledCommands(server.Settings.DisabledCommands)
+	server.bandwidth = newBandwidthScheduler(server.Settings.GlobalBandwidth)
+
+	if server.schedule, err = newBandwidthSchedule(server.Settings.BandwidthSchedule); err != nil {
+		server.Logger.Error("Bad bandwidth schedule", "err", err)
+		server.setLastError(err)
+		return err
+	}
+
+	if server.banner, err = loadBanner(server.Settings); err != nil {
+		server.Logger.Error("Cannot load the banner", "err", err)
+		server.setLastError(err)
+		return err
+	}
+
+	if err = server.inheritListeners(); err != nil {
+		server.Logger.Error("Cannot inherit the listeners", "err", err)
+		server.setLastError(err)
+		return err
+	}
+
+	// A listener can be provided (socket activation, tests on an ephemeral port...) or inherited with a Handoff
+	if server.Listener == nil {
+		server.Listener, err = server.listen(
+			"ftp",
+			fmt.Sprintf("%s:%d", server.Settings.ListenHost, server.Settings.ListenPort),
+		)
+	}
 
 	if err != nil {
-		level.Error(server.Logger).Log(logKeyMsg, "Cannot listen", "err", err)
+		server.Logger.Error("Cannot listen", "err", err)
+		server.setLastError(err)
 		return err
 	}
 
-	level.Info(server.Logger).Log(logKeyMsg, "Listening...", logKeyAction, "ftp.listening", "address", server.Listener.Addr())
+	atomic.StoreInt32(&server.listening, 1)
+	server.Logger.Info("Listening...", logKeyAction, "ftp.listening", "address", server.Listener.Addr())
+
+	server.startPublicIPResolution()
+	server.startUploadJanitor()
+	server.startBackendChecks()
+
+	if server.Settings.HealthListenAddr != "" {
+		if err = server.listenHealth(); err != nil {
+			server.Logger.Error("Cannot listen for health checks", "err", err)
+			server.Stop()
+			return err
+		}
+	}
+
+	if server.Settings.DebugListenAddr != "" {
+		if err = server.listenDebug(); err != nil {
+			server.Logger.Error("Cannot listen for debugging", "err", err)
+			server.Stop()
+			return err
+		}
+	}
+	server.closeInherited()
 
 	return err
 }
 
 // Serve accepts and process any new client coming
 func (server *FtpServer) Serve() {
+	listener := server.Listener
 	for {
-		connection, err := server.Listener.Accept()
+		connection, err := listener.Accept()
 		if err != nil {
-			if server.Listener != nil {
-				level.Error(server.Logger).Log(logKeyMsg, "Accept error", "err", err)
+			// The accept errors caused by Stop aren't reported
+			if atomic.LoadInt32(&server.listening) == 1 {
+				server.Logger.Error("Accept error", "err", err)
+				server.setLastError(err)
 			}
+			atomic.StoreInt32(&server.listening, 0)
 			break
 		}
 
+		server.tuneControlConn(connection)
 		c := server.newClientHandler(connection)
 		go c.HandleCommands()
 	}
@@ -154,7 +263,7 @@ func (server *FtpServer) ListenAndServe() error {
 		return err
 	}
 
-	level.Info(server.Logger).Log(logKeyMsg, "Starting...", logKeyAction, "ftp.starting")
+	server.Logger.Info("Starting...", logKeyAction, "ftp.starting")
 
 	server.Serve()
 
@@ -165,16 +274,43 @@ func (server *FtpServer) ListenAndServe() error {
 
 // NewFtpServer creates a new FtpServer instance
 func NewFtpServer(driver MainDriver) *FtpServer {
-	return &FtpServer{
+	server := &FtpServer{
 		driver:          driver,
 		StartTime:       time.Now().UTC(), // Might make sense to put it in Start method
 		connectionsByID: make(map[uint32]*clientHandler),
-		Logger:          log.NewNopLogger(),
+		Logger:          NopLogger(),
+	}
+	server.bufferPool.New = func() interface{} {
+		buf := make([]byte, server.transferBufferSize())
+		return &buf
 	}
+	return server
 }
 
 // Stop closes the listener
 func (server *FtpServer) Stop() {
+	atomic.StoreInt32(&server.listening, 0)
+	if server.resolverDone != nil {
+		close(server.resolverDone)
+		server.resolverDone = nil
+	}
+	if server.janitorDone != nil {
+		close(server.janitorDone)
+		server.janitorDone = nil
+	}
+	if server.backendDone != nil {
+		close(server.backendDone)
+		server.backendDone = nil
+	}
+	if server.healthServer != nil {
+		server.healthServer.Close()
+		server.healthServer = nil
+	}
+	if server.debugServer != nil {
+		server.debugServer.Close()
+		server.debugServer = nil
+	}
+	server.endpoints = nil
 	if server.Listener != nil {
 		l := server.Listener
 		server.Listener = nil
@@ -187,10 +323,18 @@ func (server *FtpServer) clientArrival(c *clientHandler) error {
 	server.connectionsMutex.Lock()
 	defer server.connectionsMutex.Unlock()
 
-	server.connectionsByID[c.ID] = c
+	server.waitForSlot(c)
+	server.connectionsByID[c.id] = c
 	nb := len(server.connectionsByID)
 
-	level.Info(c.logger).Log(logKeyMsg, "FTP Client connected", logKeyAction, "ftp.connected", "clientIp", c.conn.RemoteAddr(), "total", nb)
+	server.statsMutex.Lock()
+	server.stats.TotalSessions++
+	server.statsMutex.Unlock()
+
+	c.logger.Info("FTP Client connected", logKeyAction, "ftp.connected", "clientIp", c.conn.RemoteAddr(), "total", nb)
+	if metrics, ok := server.Metrics.(ConnectionMetrics); ok {
+		metrics.ClientConnected(nb)
+	}
 
 	if nb > server.Settings.MaxConnections {
 		return fmt.Errorf("too many clients %d > %d", nb, server.Settings.MaxConnections)
@@ -204,7 +348,11 @@ func (server *FtpServer) clientDeparture(c *clientHandler) {
 	server.connectionsMutex.Lock()
 	defer server.connectionsMutex.Unlock()
 
-	delete(server.connectionsByID, c.ID)
+	delete(server.connectionsByID, c.id)
+	server.freeSlot()
 
-	level.Info(c.logger).Log(logKeyMsg, "FTP Client disconnected", logKeyAction, "ftp.disconnected", "clientIp", c.conn.RemoteAddr(), "total", len(server.connectionsByID))
+	c.logger.Info("FTP Client disconnected", logKeyAction, "ftp.disconnected", "clientIp", c.conn.RemoteAddr(), "total", len(server.connectionsByID))
+	if metrics, ok := server.Metrics.(ConnectionMetrics); ok {
+		metrics.ClientDisconnected(len(server.connectionsByID), time.Since(c.connectedAt))
+	}
 }
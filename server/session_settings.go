@@ -0,0 +1,257 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// newSessionSettings returns the session settings defined by the server settings
+func newSessionSettings(settings *Settings) SessionSettings {
+	return SessionSettings{
+		IdleTimeout:       settings.IdleTimeout,
+		MaxTransferSize:   settings.MaxTransferSize,
+		MaxUploadSize:     settings.MaxUploadSize,
+		DownloadBandwidth: settings.DownloadBandwidth,
+		UploadBandwidth:   settings.UploadBandwidth,
+		DataPortRange:     settings.DataPortRange,
+		HiddenFiles:       settings.HiddenFiles,
+		AllowFXP:          settings.AllowFXP,
+		WORMPolicy:        settings.WORMPolicy,
+		DuplicateLogins:   settings.DuplicateLoginPolicy,
+	}
+}
+
+// applySessionSettings overrides the session settings with the ones of the user, once authenticated
+func (c *clientHandler) applySessionSettings() {
+	provider, ok := c.driver.(SessionSettingsProvider)
+	if !ok {
+		return
+	}
+
+	user := provider.SessionSettings(c)
+	if user == nil {
+		return
+	}
+
+	if user.IdleTimeout != 0 {
+		c.session.IdleTimeout = user.IdleTimeout
+	}
+	if user.MaxTransferSize != 0 {
+		c.session.MaxTransferSize = user.MaxTransferSize
+	}
+	if user.MaxUploadSize != 0 {
+		c.session.MaxUploadSize = user.MaxUploadSize
+	}
+	if user.DownloadBandwidth != 0 {
+		c.session.DownloadBandwidth = user.DownloadBandwidth
+	}
+	if user.UploadBandwidth != 0 {
+		c.session.UploadBandwidth = user.UploadBandwidth
+	}
+	if user.BandwidthWeight != 0 {
+		c.session.BandwidthWeight = user.BandwidthWeight
+	}
+	if user.DataPortRange != nil {
+		c.session.DataPortRange = user.DataPortRange
+	}
+	if user.Capabilities != 0 {
+		c.session.Capabilities = user.Capabilities
+	}
+	if user.DropBox {
+		c.session.DropBox = true
+	}
+	if user.WORMPolicy != nil {
+		c.session.WORMPolicy = user.WORMPolicy
+	}
+	if user.MaxSessions != 0 {
+		c.session.MaxSessions = user.MaxSessions
+	}
+	if user.DuplicateLogins != DuplicateLoginAllow {
+		c.session.DuplicateLogins = user.DuplicateLogins
+	}
+	if user.AllowFXP {
+		c.session.AllowFXP = true
+	}
+	if user.HiddenFiles == HiddenFilesShowAll {
+		c.session.HiddenFiles = HiddenFilesShow
+	} else if user.HiddenFiles != HiddenFilesShow {
+		c.session.HiddenFiles = user.HiddenFiles
+	}
+	if len(user.AllowedCommands) > 0 {
+		c.allowedCmds = make(map[string]bool, len(user.AllowedCommands))
+		for _, command := range user.AllowedCommands {
+			c.allowedCmds[strings.ToUpper(command)] = true
+		}
+	}
+}
+
+// commandAllowed tells if the session can use a command, the ones available before the authentication always are
+func (c *clientHandler) commandAllowed(command string, desc *CommandDescription) bool {
+	return c.allowedCmds == nil || desc.Open || c.allowedCmds[command]
+}
+
+// setIdleDeadline makes the next read on the control connection fail if nothing is received before the idle timeout
+func (c *clientHandler) setIdleDeadline() {
+	var deadline time.Time
+	if timeout := c.session.IdleTimeout; timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+	if c.tlsDeadline.IsZero() {
+		if !deadline.IsZero() {
+			c.conn.SetReadDeadline(deadline)
+		}
+		return
+	}
+	// Until the control connection is secured, the session ends at the TLS upgrade deadline
+	if !c.controlTLS && (deadline.IsZero() || c.tlsDeadline.Before(deadline)) {
+		deadline = c.tlsDeadline
+	}
+	c.conn.SetReadDeadline(deadline)
+}
+
+// isIdleTimeout tells if a read error comes from the idle timeout
+func (c *clientHandler) isIdleTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout() && c.session.IdleTimeout > 0
+}
+
+// uploadLimit returns the max number of bytes an upload of a file can transfer and the error reported beyond it, nil
+// when it's unlimited. The max size of the uploaded files counts the part of the file the upload keeps: the data
+// before the REST offset of a STOR, the whole file extended by an APPE.
+func (c *clientHandler) uploadLimit(path string, append bool) (int64, error) {
+	max, err := c.session.MaxTransferSize, ErrTransferSizeExceeded
+	if max <= 0 {
+		max, err = 0, nil
+	}
+	upload := c.session.MaxUploadSize
+	if upload <= 0 {
+		return max, err
+	}
+	if append {
+		if info, errInfo := c.getFileInfo(path); errInfo == nil {
+			upload -= info.Size()
+		}
+	} else {
+		upload -= c.ctxRest
+	}
+	if upload < 0 {
+		upload = 0
+	}
+	if err == nil || upload < max {
+		max, err = upload, ErrUploadSizeExceeded
+	}
+	return max, err
+}
+
+// cleanUpload lets the driver clean up the partial file of an upload aborted for its size. Without UploadAborter,
+// the partial file of a STOR is deleted (the data appended by an APPE can't be removed).
+func (c *clientHandler) cleanUpload(path string, append bool, cause error) {
+	var err error
+	if aborter, ok := c.driver.(UploadAborter); ok {
+		err = aborter.AbortUpload(c, path, append, cause)
+	} else if !append {
+		err = c.driver.DeleteFile(c, path)
+	}
+	if err != nil {
+		c.logger.Warn("Couldn't clean up an aborted upload", logKeyAction, "ftp.upload_cleanup", "path", path, "err", err)
+	}
+}
+
+// sizeLimitedReader fails with err once more than a number of bytes were read
+type sizeLimitedReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, r.err
+	}
+	if int64(len(p)) > r.remaining+1 {
+		// Reading one byte more than allowed is enough to know the limit is exceeded
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, r.err
+	}
+	return n, err
+}
+
+// throttle slows the transfers down
+type throttle interface {
+	// chunkSize returns the max number of bytes to transfer at once
+	chunkSize() int64
+
+	// transferred waits until the n bytes that were just transferred are allowed
+	transferred(n int)
+}
+
+// bandwidthLimiter slows a transfer down to a number of bytes per second
+type bandwidthLimiter struct {
+	rate  int64     // Bytes per second
+	start time.Time // Start of the transfer
+	count int64     // Bytes transferred
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	return &bandwidthLimiter{rate: rate, start: time.Now()}
+}
+
+// chunkSize returns a second worth of data
+func (l *bandwidthLimiter) chunkSize() int64 {
+	return l.rate
+}
+
+// transferred waits until the n bytes that were just transferred are allowed by the rate
+func (l *bandwidthLimiter) transferred(n int) {
+	l.count += int64(n)
+	expected := time.Duration(float64(l.count) / float64(l.rate) * float64(time.Second))
+	if wait := expected - time.Since(l.start); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// throttledReader limits the speed at which a reader is read
+type throttledReader struct {
+	reader  io.Reader
+	limiter throttle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if size := r.limiter.chunkSize(); int64(len(p)) > size {
+		// We don't want to read more than a second worth of data at once
+		p = p[:size]
+	}
+	n, err := r.reader.Read(p)
+	r.limiter.transferred(n)
+	return n, err
+}
+
+// throttledWriter limits the speed at which a writer is written
+type throttledWriter struct {
+	writer  io.Writer
+	limiter throttle
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if size := w.limiter.chunkSize(); int64(len(chunk)) > size {
+			chunk = chunk[:size]
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		w.limiter.transferred(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
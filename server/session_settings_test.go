@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionDriver defines the settings of its sessions
+type sessionDriver struct {
+	ClientHandlingDriver
+	settings *SessionSettings
+}
+
+func (d *sessionDriver) SessionSettings(cc ClientContext) *SessionSettings {
+	return d.settings
+}
+
+func TestApplySessionSettings(t *testing.T) {
+	settings := &Settings{IdleTimeout: 60, MaxTransferSize: 1000, DataPortRange: &PortRange{Start: 2000, End: 2010}}
+	c := &clientHandler{session: newSessionSettings(settings)}
+
+	c.driver = &sessionDriver{settings: &SessionSettings{
+		MaxTransferSize: 10,
+		UploadBandwidth: 100,
+		AllowedCommands: []string{"retr", "LIST"},
+	}}
+	c.applySessionSettings()
+
+	if c.session.IdleTimeout != 60 || c.session.MaxTransferSize != 10 || c.session.UploadBandwidth != 100 {
+		t.Fatal("Bad settings:", c.session)
+	}
+	if c.session.DataPortRange != settings.DataPortRange {
+		t.Fatal("The server port range should have been kept")
+	}
+
+	if !c.commandAllowed("RETR", commandsMap["RETR"]) || c.commandAllowed("STOR", commandsMap["STOR"]) {
+		t.Fatal("Bad allowed commands:", c.allowedCmds)
+	}
+	if !c.commandAllowed("QUIT", commandsMap["QUIT"]) {
+		t.Fatal("QUIT should always be allowed")
+	}
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	r := &sizeLimitedReader{reader: strings.NewReader("0123456789"), remaining: 10, err: ErrTransferSizeExceeded}
+	if data, err := ioutil.ReadAll(r); err != nil || len(data) != 10 {
+		t.Fatal("The whole content should have been read:", len(data), err)
+	}
+
+	r = &sizeLimitedReader{reader: strings.NewReader("0123456789"), remaining: 9, err: ErrTransferSizeExceeded}
+	if _, err := ioutil.ReadAll(r); err != ErrTransferSizeExceeded {
+		t.Fatal("The limit should have been reported:", err)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &throttledWriter{writer: &buf, limiter: newBandwidthLimiter(10 * 1024)}
+
+	start := time.Now()
+	if _, err := w.Write(make([]byte, 3*1024)); err != nil {
+		t.Fatal("Couldn't write:", err)
+	}
+
+	// 3KB at 10KB/s take 300ms
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatal("Bad transfer duration:", elapsed)
+	}
+	if buf.Len() != 3*1024 {
+		t.Fatal("Bad written size:", buf.Len())
+	}
+}
+
+// cleanupDriver records the deleted files
+type cleanupDriver struct {
+	ClientHandlingDriver
+	deleted []string
+}
+
+func (d *cleanupDriver) DeleteFile(cc ClientContext, path string) error {
+	d.deleted = append(d.deleted, path)
+	return nil
+}
+
+// abortingDriver cleans up the aborted uploads by itself
+type abortingDriver struct {
+	cleanupDriver
+	aborted []string
+}
+
+func (d *abortingDriver) AbortUpload(cc ClientContext, path string, appended bool, cause error) error {
+	d.aborted = append(d.aborted, path)
+	return nil
+}
+
+// statDriver gives the info of the files of its directory
+type statDriver struct {
+	dirDriver
+}
+
+func (d *statDriver) GetFileInfo(cc ClientContext, path string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(d.dir, path))
+}
+
+func TestUploadLimit(t *testing.T) {
+	c := &clientHandler{session: SessionSettings{MaxTransferSize: 100, MaxUploadSize: 10}}
+	if max, err := c.uploadLimit("/file", false); max != 10 || err != ErrUploadSizeExceeded {
+		t.Fatal("The smallest limit should apply:", max, err)
+	}
+
+	// The resumed uploads keep the start of the file
+	c.ctxRest = 4
+	if max, err := c.uploadLimit("/file", false); max != 6 || err != ErrUploadSizeExceeded {
+		t.Fatal("The offset should count:", max, err)
+	}
+	c.ctxRest = 12
+	if max, err := c.uploadLimit("/file", false); max != 0 || err != ErrUploadSizeExceeded {
+		t.Fatal("Nothing can be uploaded beyond the limit:", max, err)
+	}
+	c.ctxRest = 0
+
+	c.session.MaxUploadSize = 0
+	if max, err := c.uploadLimit("/file", false); max != 100 || err != ErrTransferSizeExceeded {
+		t.Fatal("The transfer limit should apply:", max, err)
+	}
+	c.session.MaxTransferSize = 0
+	if _, err := c.uploadLimit("/file", false); err != nil {
+		t.Fatal("The uploads should be unlimited:", err)
+	}
+}
+
+func TestUploadLimitAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal("Couldn't write file:", err)
+	}
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), driver: &statDriver{dirDriver{dir: dir}},
+		path: "/", logger: nopLogger{}, session: SessionSettings{MaxUploadSize: 10}}
+	c.daddy.Settings = &Settings{}
+
+	// Each APPE is below the limit, not the file they make
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	go func() {
+		client.Write([]byte("appended"))
+		client.Close()
+	}()
+	c.param = "file"
+	c.handleAPPE()
+	c.writer.Flush()
+	if expected := "150 Using transfer connection\r\n552 Transfer aborted: " + ErrUploadSizeExceeded.Error() + "\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
+
+func TestCleanUpload(t *testing.T) {
+	driver := &cleanupDriver{}
+	c := &clientHandler{driver: driver}
+	c.cleanUpload("/stored", false, ErrUploadSizeExceeded)
+	c.cleanUpload("/appended", true, ErrUploadSizeExceeded)
+	if len(driver.deleted) != 1 || driver.deleted[0] != "/stored" {
+		t.Fatal("Only the partial file of the STOR should be deleted:", driver.deleted)
+	}
+
+	aborting := &abortingDriver{}
+	c.driver = aborting
+	c.cleanUpload("/stored", false, ErrUploadSizeExceeded)
+	if len(aborting.aborted) != 1 || len(aborting.deleted) != 0 {
+		t.Fatal("The driver should clean up by itself:", aborting.aborted, aborting.deleted)
+	}
+}
+
+func TestHiddenFilesOverride(t *testing.T) {
+	c := &clientHandler{session: newSessionSettings(&Settings{HiddenFiles: HiddenFilesDeny})}
+	c.driver = &sessionDriver{settings: &SessionSettings{HiddenFiles: HiddenFilesShowAll}}
+	c.applySessionSettings()
+	if c.session.HiddenFiles != HiddenFilesShow {
+		t.Fatal("The user should see all the files:", c.session.HiddenFiles)
+	}
+}
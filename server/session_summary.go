@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxSummaryEntries is the max number of transfers and of failed commands kept for the summary of a session, the
+// counters of SessionSummary.Stats include the ones beyond
+const maxSummaryEntries = 1000
+
+// SessionSummary is the activity of a session, reported when it ends so that the accounting and billing systems
+// don't have to rebuild it from the logs
+type SessionSummary struct {
+	Duration  time.Duration    // Time the client stayed connected
+	Stats     SessionStats     // Counters of the session
+	Transfers []FileTransfer   // File transfers of the session, in order (the first 1000)
+	Failures  []CommandFailure // Commands ending with an error reply, in order (the first 1000)
+	LastError string           // Last error reply, like "550 Could not access file: ...", empty if there was none
+}
+
+// FileTransfer is a file transfer of a session
+type FileTransfer struct {
+	Path      string            // Path of the file
+	Direction TransferDirection // Direction of the transfer
+	Size      int64             // Bytes transferred
+	Duration  time.Duration     // Time it took
+	Error     string            // Why the transfer failed, empty if it succeeded
+}
+
+// CommandFailure is a command that ended with an error reply
+type CommandFailure struct {
+	Time    time.Time // Time of the reply
+	Command string    // Command (always in upper case)
+	Param   string    // Param of the command, redacted for the sensitive ones
+	Code    int       // Code of the reply (4xx or 5xx)
+	Reply   string    // Message of the reply
+}
+
+// SessionReporter can be implemented by a MainDriver to receive the summary of each session when it ends, right
+// before UserLeft. The sessions are only tracked in details when the driver implements it.
+type SessionReporter interface {
+	// SessionEnded is called once the transfers of the session are over
+	SessionEnded(cc ClientContext, summary *SessionSummary)
+}
+
+// reporter returns the SessionReporter of the driver, nil if it doesn't have one
+func (c *clientHandler) reporter() SessionReporter {
+	if c.daddy == nil {
+		return nil
+	}
+	reporter, _ := c.daddy.driver.(SessionReporter)
+	return reporter
+}
+
+// recordTransfer adds a file transfer to the summary of the session
+func (c *clientHandler) recordTransfer(path string, direction TransferDirection, size int64, duration time.Duration,
+	err error) {
+	if c.reporter() == nil {
+		return
+	}
+	transfer := FileTransfer{Path: path, Direction: direction, Size: size, Duration: duration}
+	if err != nil {
+		transfer.Error = err.Error()
+	}
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	if len(c.summary.Transfers) < maxSummaryEntries {
+		c.summary.Transfers = append(c.summary.Transfers, transfer)
+	}
+}
+
+// recordFailure adds the current command to the summary of the session if it ended with an error reply
+func (c *clientHandler) recordFailure(code int, reply string) {
+	if code < 400 || c.reporter() == nil {
+		return
+	}
+	failure := CommandFailure{Time: time.Now().UTC(), Command: c.command, Param: c.loggableParam(), Code: code,
+		Reply: reply}
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	if len(c.summary.Failures) < maxSummaryEntries {
+		c.summary.Failures = append(c.summary.Failures, failure)
+	}
+	c.summary.LastError = fmt.Sprintf("%d %s", code, reply)
+}
+
+// reportSession gives the summary of the session to the SessionReporter of the driver
+func (c *clientHandler) reportSession() {
+	reporter := c.reporter()
+	if reporter == nil {
+		return
+	}
+	c.paramsMutex.RLock()
+	summary := c.summary
+	c.paramsMutex.RUnlock()
+	summary.Duration = time.Since(c.connectedAt)
+	summary.Stats = *c.Stats()
+	reporter.SessionEnded(c, &summary)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+)
+
+// This file gives the embedding application some control over the live sessions
+
+// Session returns the context of a connected client
+func (server *FtpServer) Session(id uint32) (ClientContext, error) {
+	server.connectionsMutex.RLock()
+	defer server.connectionsMutex.RUnlock()
+
+	if c, ok := server.connectionsByID[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("no session with ID %d", id)
+}
+
+// Sessions returns the contexts of all the connected clients
+func (server *FtpServer) Sessions() []ClientContext {
+	server.connectionsMutex.RLock()
+	defer server.connectionsMutex.RUnlock()
+
+	sessions := make([]ClientContext, 0, len(server.connectionsByID))
+	for _, c := range server.connectionsByID {
+		sessions = append(sessions, c)
+	}
+	return sessions
+}
+
+// UserSessions returns the number of authenticated sessions of a user
+func (server *FtpServer) UserSessions(user string) int {
+	server.connectionsMutex.RLock()
+	defer server.connectionsMutex.RUnlock()
+	return server.userSessions(user, nil)
+}
+
+// userSessions counts the authenticated sessions of a user, except one of them. The connections mutex must be held.
+func (server *FtpServer) userSessions(user string, except *clientHandler) int {
+	nb := 0
+	for _, c := range server.connectionsByID {
+		if c != except && c.loggedIn && c.User() == user {
+			nb++
+		}
+	}
+	return nb
+}
+
+// login marks a session as authenticated, unless its user already has max (unlimited if 0) other sessions. The
+// limit is 1 by default with the DuplicateLoginReject and DuplicateLoginReplace policies, the oldest sessions beyond
+// it are closed with DuplicateLoginReplace.
+func (server *FtpServer) login(c *clientHandler, max int, policy DuplicateLoginPolicy) bool {
+	if max == 0 && policy != DuplicateLoginAllow {
+		max = 1
+	}
+
+	server.connectionsMutex.Lock()
+	others := server.userSessions(c.User(), c)
+	if max > 0 && others >= max && policy != DuplicateLoginReplace {
+		server.connectionsMutex.Unlock()
+		return false
+	}
+	var replaced []*clientHandler
+	if max > 0 && others >= max {
+		replaced = server.oldestSessions(c, others-max+1)
+		for _, old := range replaced {
+			old.loggedIn = false
+		}
+	}
+	c.loggedIn = true
+	server.connectionsMutex.Unlock()
+
+	for _, old := range replaced {
+		old.logger.Info("Session replaced by a new login", logKeyAction, "ftp.session_replaced", "by", c.SessionUID())
+		old.Close(421, "Session replaced by a new login, closing the connection")
+	}
+	return true
+}
+
+// oldestSessions returns the nb oldest authenticated sessions of the user of a session, except this one. The
+// connections mutex must be held.
+func (server *FtpServer) oldestSessions(c *clientHandler, nb int) []*clientHandler {
+	var sessions []*clientHandler
+	for _, other := range server.connectionsByID {
+		if other != c && other.loggedIn && other.User() == c.User() {
+			sessions = append(sessions, other)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].connectedAt.Before(sessions[j].connectedAt) })
+	if len(sessions) > nb {
+		sessions = sessions[:nb]
+	}
+	return sessions
+}
+
+// logout marks a session as no longer authenticated
+func (server *FtpServer) logout(c *clientHandler) {
+	server.connectionsMutex.Lock()
+	defer server.connectionsMutex.Unlock()
+	c.loggedIn = false
+}
+
+// CancelTransfer interrupts the transfer of a file by a live session, like a runaway upload, without closing the
+// session: the client gets a 426 reply and the TransferAbortHook of the driver is called with ErrTransferCancelled. It
+// returns ErrNoTransfer if the session isn't transferring this file (an absolute path, as given to the driver).
+func (server *FtpServer) CancelTransfer(id uint32, path string) error {
+	server.connectionsMutex.RLock()
+	c, ok := server.connectionsByID[id]
+	server.connectionsMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("no session with ID %d", id)
+	}
+	if !c.cancelTransfer(path) {
+		return ErrNoTransfer
+	}
+	c.logger.Info("Transfer cancelled", logKeyAction, "ftp.transfer_cancel", "path", path)
+	return nil
+}
+
+// SetSessionLogVerbosity changes the logging of the commands of a live session
+func (server *FtpServer) SetSessionLogVerbosity(id uint32, verbosity LogVerbosity) error {
+	cc, err := server.Session(id)
+	if err != nil {
+		return err
+	}
+	cc.SetLogVerbosity(verbosity)
+	return nil
+}
+
+// SetUserLogVerbosity changes the logging of the commands of all the live sessions of a user. It returns the number
+// of sessions that were changed.
+func (server *FtpServer) SetUserLogVerbosity(user string, verbosity LogVerbosity) int {
+	nb := 0
+	for _, cc := range server.Sessions() {
+		if cc.User() == user {
+			cc.SetLogVerbosity(verbosity)
+			nb++
+		}
+	}
+	return nb
+}
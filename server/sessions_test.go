@@ -0,0 +1,28 @@
+package server
+
+import "testing"
+
+func TestSetLogVerbosity(t *testing.T) {
+	server := &FtpServer{connectionsByID: map[uint32]*clientHandler{
+		1: {id: 1, user: "alice"},
+		2: {id: 2, user: "alice"},
+		3: {id: 3, user: "bob"},
+	}}
+
+	if err := server.SetSessionLogVerbosity(3, LogCommands); err != nil ||
+		server.connectionsByID[3].LogVerbosity() != LogCommands {
+		t.Fatal("The verbosity of the session should be changed:", err)
+	}
+	if err := server.SetSessionLogVerbosity(4, LogCommands); err == nil {
+		t.Fatal("The unknown sessions should be reported")
+	}
+
+	if nb := server.SetUserLogVerbosity("alice", LogCommandsAndReplies); nb != 2 {
+		t.Fatal("Both sessions of the user should be changed:", nb)
+	}
+	for id, verbosity := range map[uint32]LogVerbosity{1: LogCommandsAndReplies, 2: LogCommandsAndReplies, 3: LogCommands} {
+		if server.connectionsByID[id].LogVerbosity() != verbosity {
+			t.Fatal("Wrong verbosity of session", id, server.connectionsByID[id].LogVerbosity())
+		}
+	}
+}
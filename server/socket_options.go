@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// tuneConn applies the socket settings to a connection, TLS ones are tuned on their TCP connection. The connections
+// that aren't TCP ones (provided by a wrapping listener...) are left untouched.
+func (server *FtpServer) tuneConn(conn net.Conn, disableNoDelay bool, bufferSize int) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if disableNoDelay {
+		tcpConn.SetNoDelay(false)
+	}
+	if bufferSize > 0 {
+		tcpConn.SetReadBuffer(bufferSize)
+		tcpConn.SetWriteBuffer(bufferSize)
+	}
+	// The keepalives keep the stateful firewalls from dropping the idle sessions silently
+	if period := server.Settings.KeepAlivePeriod; period > 0 {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(time.Duration(period) * time.Second)
+	} else if period < 0 {
+		tcpConn.SetKeepAlive(false)
+	}
+}
+
+// tuneControlConn applies the socket settings to a control connection
+func (server *FtpServer) tuneControlConn(conn net.Conn) {
+	server.tuneConn(conn, server.Settings.DisableControlNoDelay, server.Settings.ControlSocketBufferSize)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTuneControlConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	defer conn.Close()
+
+	// Errors can't be observed, but the settings shouldn't break the connection
+	server := NewFtpServer(nil)
+	for _, settings := range []*Settings{
+		{KeepAlivePeriod: 30, DisableControlNoDelay: true, ControlSocketBufferSize: 1 << 16},
+		{KeepAlivePeriod: -1},
+	} {
+		server.Settings = settings
+		server.tuneControlConn(conn)
+		if _, err = conn.Write([]byte("data")); err != nil {
+			t.Fatal("Couldn't write:", err)
+		}
+	}
+
+	// The other connections are left untouched
+	pipe, peer := net.Pipe()
+	defer pipe.Close()
+	defer peer.Close()
+	server.tuneControlConn(pipe)
+}
@@ -0,0 +1,111 @@
+package server
+
+import "time"
+
+// SessionStats is the activity of a session. The bytes and the files are the ones of the file transfers, the
+// listings aren't counted.
+type SessionStats struct {
+	ConnectedAt time.Time // Time of the connection
+	LoginAt     time.Time // Time of the last successful login (zero if the user never logged in)
+	BytesIn     int64     // Bytes received (uploads)
+	BytesOut    int64     // Bytes sent (downloads)
+	FilesIn     int64     // Files uploaded successfully
+	FilesOut    int64     // Files downloaded successfully
+	Commands    int64     // Commands executed
+	Errors      int64     // Commands ending with an error reply (4xx or 5xx)
+}
+
+// ServerStats is the activity of the server since it was started
+type ServerStats struct {
+	StartTime     time.Time // Time when the server was started
+	Sessions      int       // Number of connected clients
+	TotalSessions int64     // Number of accepted connections
+	BytesIn       int64     // Bytes received by all the sessions (uploads)
+	BytesOut      int64     // Bytes sent by all the sessions (downloads)
+	FilesIn       int64     // Files uploaded successfully
+	FilesOut      int64     // Files downloaded successfully
+	Commands      int64     // Commands executed
+	Errors        int64     // Commands ending with an error reply (4xx or 5xx)
+}
+
+// Stats returns a snapshot of the activity of the session
+func (c *clientHandler) Stats() *SessionStats {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	stats := c.stats
+	stats.ConnectedAt = c.connectedAt
+	return &stats
+}
+
+// Stats returns a snapshot of the activity of the server
+func (server *FtpServer) Stats() *ServerStats {
+	server.statsMutex.Lock()
+	stats := server.stats
+	server.statsMutex.Unlock()
+
+	stats.StartTime = server.StartTime
+	server.connectionsMutex.RLock()
+	stats.Sessions = len(server.connectionsByID)
+	server.connectionsMutex.RUnlock()
+	return &stats
+}
+
+// countLogin records the time of a successful login
+func (c *clientHandler) countLogin() {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.stats.LoginAt = time.Now().UTC()
+}
+
+// countCommand records an executed command and its reply code
+func (c *clientHandler) countCommand(code int) {
+	failed := int64(0)
+	if code >= 400 {
+		failed = 1
+	}
+
+	c.paramsMutex.Lock()
+	c.stats.Commands++
+	c.stats.Errors += failed
+	c.paramsMutex.Unlock()
+
+	c.daddy.statsMutex.Lock()
+	c.daddy.stats.Commands++
+	c.daddy.stats.Errors += failed
+	c.daddy.statsMutex.Unlock()
+}
+
+// countTransfer records the bytes of a file transfer, and the file if the transfer succeeded
+func (c *clientHandler) countTransfer(path string, direction TransferDirection, size int64, duration time.Duration,
+	err error) {
+	c.recordTransfer(path, direction, size, duration, err)
+	c.transcriptTransfer(path, direction, size, duration, err)
+	if metrics, ok := c.daddy.Metrics.(TransferMetrics); ok {
+		metrics.TransferDone(direction, size, duration, err)
+	}
+
+	files := int64(0)
+	if err == nil {
+		files = 1
+	}
+
+	c.paramsMutex.Lock()
+	if direction == TransferUpload {
+		c.stats.BytesIn += size
+		c.stats.FilesIn += files
+	} else {
+		c.stats.BytesOut += size
+		c.stats.FilesOut += files
+	}
+	c.paramsMutex.Unlock()
+
+	c.daddy.statsMutex.Lock()
+	defer c.daddy.statsMutex.Unlock()
+	if direction == TransferUpload {
+		c.daddy.stats.BytesIn += size
+		c.daddy.stats.FilesIn += files
+	} else {
+		c.daddy.stats.BytesOut += size
+		c.daddy.stats.FilesOut += files
+	}
+}
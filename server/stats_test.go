@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	var buf bytes.Buffer
+	server := &FtpServer{Settings: &Settings{}, connectionsByID: make(map[uint32]*clientHandler)}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: server}
+	other := &clientHandler{daddy: server}
+	server.connectionsByID[1] = c
+
+	c.handleCommand("NOOP\r\n")
+	c.handleCommand("ACCT\r\n")
+	c.countTransfer("/file", TransferUpload, 100, 0, nil)
+	c.countTransfer("/file", TransferDownload, 50, 0, errors.New("broken connection"))
+	other.countTransfer("/file", TransferDownload, 10, 0, nil)
+
+	if stats := c.Stats(); stats.Commands != 2 || stats.Errors != 1 || stats.BytesIn != 100 || stats.FilesIn != 1 ||
+		stats.BytesOut != 50 || stats.FilesOut != 0 {
+		t.Fatalf("Wrong session stats: %+v", stats)
+	}
+	if stats := server.Stats(); stats.Sessions != 1 || stats.BytesIn != 100 || stats.BytesOut != 60 ||
+		stats.FilesOut != 1 || stats.Commands != 2 || stats.Errors != 1 {
+		t.Fatalf("Wrong server stats: %+v", stats)
+	}
+}
+
+// reporterDriver keeps the summary of the last session
+type reporterDriver struct {
+	MainDriver
+	summary *SessionSummary
+}
+
+func (d *reporterDriver) SessionEnded(cc ClientContext, summary *SessionSummary) {
+	d.summary = summary
+}
+
+func TestSessionSummary(t *testing.T) {
+	var buf bytes.Buffer
+	driver := &reporterDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, driver: driver},
+		connectedAt: time.Now().Add(-time.Minute)}
+
+	c.handleCommand("NOOP\r\n")
+	c.handleCommand("ACCT\r\n")
+	c.countTransfer("/in", TransferUpload, 100, time.Second, nil)
+	c.countTransfer("/out", TransferDownload, 50, time.Second, errors.New("broken connection"))
+	c.reportSession()
+
+	summary := driver.summary
+	if summary == nil || summary.Duration < time.Minute || summary.Stats.Commands != 2 || summary.Stats.BytesIn != 100 {
+		t.Fatalf("Wrong summary: %+v", summary)
+	}
+	if len(summary.Transfers) != 2 || summary.Transfers[0] != (FileTransfer{Path: "/in", Direction: TransferUpload,
+		Size: 100, Duration: time.Second}) || summary.Transfers[1].Error != "broken connection" {
+		t.Fatalf("Wrong transfers: %+v", summary.Transfers)
+	}
+	if len(summary.Failures) != 1 || summary.Failures[0].Command != "ACCT" || summary.Failures[0].Code < 400 {
+		t.Fatalf("Wrong failures: %+v", summary.Failures)
+	}
+	if failure := summary.Failures[0]; summary.LastError != fmt.Sprintf("%d %s", failure.Code, failure.Reply) {
+		t.Fatal("Wrong last error:", summary.LastError)
+	}
+}
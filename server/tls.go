@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DataTLSConfigProvider can be implemented by a MainDriver to secure the data connections with another TLS config
+// than the control connection one (another certificate, session cache or ALPN), when the data traffic is terminated
+// by different infrastructure
+type DataTLSConfigProvider interface {
+	// GetDataTLSConfig returns the TLS config of the data connections of a client, it's called on their first one
+	GetDataTLSConfig(cc ClientContext) (*tls.Config, error)
+}
+
+// newSessionTicketKey generates the session ticket key of a client
+func newSessionTicketKey() (*[32]byte, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// sessionBoundTLSConfig creates a copy of the TLS config with the session ticket key of a client. Only the client
+// that negotiated the control connection with it will then be able to resume its session on the data connections.
+func sessionBoundTLSConfig(config *tls.Config, key *[32]byte) *tls.Config {
+	config = config.Clone()
+	config.SessionTicketsDisabled = false
+	config.SetSessionTicketKeys([][32]byte{*key})
+	return config
+}
+
+// startTLSDeadline arms the Settings.TLSUpgradeTimeout of the connections that must be secured
+func (c *clientHandler) startTLSDeadline() {
+	settings := c.daddy.Settings
+	if settings.TLSRequired && settings.TLSUpgradeTimeout > 0 && !c.controlTLS {
+		c.tlsDeadline = time.Now().Add(time.Duration(settings.TLSUpgradeTimeout) * time.Second)
+	}
+}
+
+// isTLSUpgradeTimeout tells if a read error comes from the TLS upgrade deadline
+func (c *clientHandler) isTLSUpgradeTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout() && !c.controlTLS && !c.tlsDeadline.IsZero() && !time.Now().Before(c.tlsDeadline)
+}
+
+// fingerprintingTLSConfig creates a copy of the control connection TLS config recording the fingerprint of the client
+func (c *clientHandler) fingerprintingTLSConfig(config *tls.Config) *tls.Config {
+	next := config.GetConfigForClient
+	config = config.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		c.paramsMutex.Lock()
+		c.tlsPrint = tlsFingerprint(hello)
+		c.paramsMutex.Unlock()
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	return config
+}
+
+// tlsFingerprint hashes the parameters of a ClientHello that depend on the TLS stack of the client (in the spirit of
+// JA3, but limited to what crypto/tls exposes): versions, cipher suites, curves and point formats. The GREASE values
+// are ignored as clients pick them randomly.
+func tlsFingerprint(hello *tls.ClientHelloInfo) string {
+	var b bytes.Buffer
+	writeList := func(values []uint16) {
+		sep := ""
+		for _, v := range values {
+			if v&0x0f0f == 0x0a0a && v>>8 == v&0xff {
+				continue
+			}
+			fmt.Fprintf(&b, "%s%d", sep, v)
+			sep = "-"
+		}
+		b.WriteByte(',')
+	}
+
+	writeList(hello.SupportedVersions)
+	writeList(hello.CipherSuites)
+	curves := make([]uint16, len(hello.SupportedCurves))
+	for i, curve := range hello.SupportedCurves {
+		curves[i] = uint16(curve)
+	}
+	writeList(curves)
+	points := make([]uint16, len(hello.SupportedPoints))
+	for i, point := range hello.SupportedPoints {
+		points[i] = uint16(point)
+	}
+	writeList(points)
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// dataTLSConfig returns the TLS config to use on data connections: the one of the DataTLSConfigProvider (sharing the
+// session ticket key of the control connection so that its session can be resumed), or the control connection one
+func (c *clientHandler) dataTLSConfig() (*tls.Config, error) {
+	if c.dataTLS != nil {
+		return c.dataTLS, nil
+	}
+	provider, ok := c.daddy.driver.(DataTLSConfigProvider)
+	if !ok {
+		if c.tlsConfig != nil {
+			return c.tlsConfig, nil
+		}
+		return c.daddy.driver.GetTLSConfig()
+	}
+
+	config, err := provider.GetDataTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.ticketKey != nil {
+		config = sessionBoundTLSConfig(config, c.ticketKey)
+	}
+	c.dataTLS = config
+	return config, nil
+}
+
+// connectionState returns the state of a TLS connection, nil if it's not a TLS one or if its handshake isn't complete
+func connectionState(conn net.Conn) *tls.ConnectionState {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if !state.HandshakeComplete {
+		return nil
+	}
+	return &state
+}
+
+// checkTLSSessionReuse makes sure the data connection resumed an existing TLS session
+func checkTLSSessionReuse(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return errors.New("data connection isn't using TLS")
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	if !tlsConn.ConnectionState().DidResume {
+		return errors.New("data connection didn't resume the control connection TLS session")
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSFingerprint(t *testing.T) {
+	hello := &tls.ClientHelloInfo{
+		SupportedVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+		CipherSuites:      []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		SupportedCurves:   []tls.CurveID{tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+	}
+	fingerprint := tlsFingerprint(hello)
+	if len(fingerprint) != 32 {
+		t.Fatal("Bad fingerprint:", fingerprint)
+	}
+
+	// The GREASE values don't change the fingerprint
+	hello.CipherSuites = append([]uint16{0x3a3a}, hello.CipherSuites...)
+	hello.SupportedCurves = append(hello.SupportedCurves, 0xdada)
+	if tlsFingerprint(hello) != fingerprint {
+		t.Fatal("The GREASE values should be ignored")
+	}
+
+	hello.CipherSuites = hello.CipherSuites[:2]
+	if tlsFingerprint(hello) == fingerprint {
+		t.Fatal("Other cipher suites should change the fingerprint")
+	}
+}
+
+func TestFingerprintingTLSConfig(t *testing.T) {
+	c := &clientHandler{}
+	config := c.fingerprintingTLSConfig(&tls.Config{})
+
+	hello := &tls.ClientHelloInfo{CipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256}}
+	if next, err := config.GetConfigForClient(hello); next != nil || err != nil {
+		t.Fatal("The config shouldn't change:", next, err)
+	}
+	if c.TLSFingerprint() != tlsFingerprint(hello) {
+		t.Fatal("The fingerprint should be recorded:", c.TLSFingerprint())
+	}
+}
+
+// tlsDriver provides a TLS config
+type tlsDriver struct {
+	MainDriver
+	config *tls.Config
+}
+
+func (d *tlsDriver) GetTLSConfig() (*tls.Config, error) {
+	return d.config, nil
+}
+
+func TestAUTHMechanisms(t *testing.T) {
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	defer client.Close()
+	daddy := &FtpServer{Settings: &Settings{}, driver: &tlsDriver{config: selfSignedConfig(t)}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy, conn: server}
+
+	c.handleCommand("AUTH KERBEROS\r\n")
+	if buf.String() != "504 Unsupported security mechanism KERBEROS, use AUTH TLS\r\n" || c.controlTLS {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+
+	// The legacy mechanism also protects the data connections
+	buf.Reset()
+	c.handleCommand("AUTH SSL\r\n")
+	if buf.String() != "234 AUTH command ok. Expecting TLS Negotiation.\r\n" || !c.controlTLS || !c.transferTLS || !c.pbszSet {
+		t.Fatalf("Wrong state after AUTH SSL: %q %v %v", buf.String(), c.transferTLS, c.pbszSet)
+	}
+
+	c.writer = bufio.NewWriter(&buf)
+	c.handleCommand("AUTH tls\r\n")
+	if c.transferTLS || c.pbszSet {
+		t.Fatal("AUTH TLS should reset the data protection")
+	}
+}
+
+func TestFEATAuth(t *testing.T) {
+	var buf bytes.Buffer
+	daddy := &FtpServer{Settings: &Settings{}, driver: &tlsDriver{config: &tls.Config{}}}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy}
+
+	c.handleFEAT()
+	if !strings.Contains(buf.String(), "\r\n AUTH TLS;SSL\r\n PBSZ\r\n PROT\r\n") {
+		t.Fatalf("The TLS features should be advertised: %q", buf.String())
+	}
+}
+
+func TestTLSUpgradeTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := &clientHandler{daddy: &FtpServer{Settings: &Settings{TLSRequired: true, TLSUpgradeTimeout: 10}}, conn: server,
+		session: SessionSettings{IdleTimeout: 60}}
+
+	c.startTLSDeadline()
+	if time.Until(c.tlsDeadline) < 9*time.Second {
+		t.Fatal("Wrong TLS deadline:", c.tlsDeadline)
+	}
+
+	c.tlsDeadline = time.Now().Add(50 * time.Millisecond)
+	c.setIdleDeadline()
+	_, err := c.conn.Read(make([]byte, 1))
+	if !c.isTLSUpgradeTimeout(err) {
+		t.Fatal("The read should end at the TLS deadline:", err)
+	}
+
+	// Once secured, only the idle timeout applies
+	c.controlTLS = true
+	if c.isTLSUpgradeTimeout(err) {
+		t.Fatal("The secured connections have no TLS deadline")
+	}
+}
+
+// dataTLSDriver secures the data connections with another TLS config
+type dataTLSDriver struct {
+	tlsDriver
+	dataConfig *tls.Config
+	calls      int
+}
+
+func (d *dataTLSDriver) GetDataTLSConfig(cc ClientContext) (*tls.Config, error) {
+	d.calls++
+	return d.dataConfig, nil
+}
+
+// tlsResumes makes a TLS handshake over a loopback connection and tells if the client resumed a previous session
+func tlsResumes(t *testing.T, config, clientConfig *tls.Config) bool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+	go func() {
+		server, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		conn := tls.Server(server, config)
+		if conn.Handshake() == nil {
+			conn.Write([]byte("x")) // Lets the client receive the session ticket
+		}
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	defer client.Close()
+	conn := tls.Client(client, clientConfig)
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal("Handshake failed:", err)
+	}
+	return conn.ConnectionState().DidResume
+}
+
+func TestDataTLSConfig(t *testing.T) {
+	driver := &dataTLSDriver{tlsDriver: tlsDriver{config: selfSignedConfig(t)}, dataConfig: selfSignedConfig(t)}
+	var buf bytes.Buffer
+	server, client := net.Pipe()
+	defer client.Close()
+	c := &clientHandler{writer: bufio.NewWriter(&buf), conn: server,
+		daddy: &FtpServer{Settings: &Settings{TLSSessionReuseRequired: true}, driver: driver}}
+	c.handleCommand("AUTH TLS\r\n")
+
+	config, err := c.dataTLSConfig()
+	if err != nil || !bytes.Equal(config.Certificates[0].Certificate[0], driver.dataConfig.Certificates[0].Certificate[0]) {
+		t.Fatal("The data TLS config should be the driver one:", err)
+	}
+	if again, _ := c.dataTLSConfig(); again != config || driver.calls != 1 {
+		t.Fatal("The data TLS config should be kept for the session:", driver.calls)
+	}
+
+	// The session of the control connection can be resumed on the data connections
+	clientConfig := &tls.Config{InsecureSkipVerify: true, ServerName: "ftp", ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	if tlsResumes(t, c.tlsConfig, clientConfig) {
+		t.Fatal("The first handshake can't resume a session")
+	}
+	if !tlsResumes(t, config, clientConfig) {
+		t.Fatal("The data connection should resume the control connection session")
+	}
+}
+
+// sessionReuseChecked makes a TLS handshake over a loopback connection and checks on the server side that the client
+// resumed a previous session
+func sessionReuseChecked(t *testing.T, config, clientConfig *tls.Config) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+	errCheck := make(chan error, 1)
+	go func() {
+		server, err := listener.Accept()
+		if err != nil {
+			errCheck <- err
+			return
+		}
+		defer server.Close()
+		conn := tls.Server(server, config)
+		errCheck <- checkTLSSessionReuse(conn)
+		conn.Write([]byte("x")) // Lets the client receive the session ticket
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	defer client.Close()
+	if _, err := tls.Client(client, clientConfig).Read(make([]byte, 1)); err != nil {
+		t.Fatal("Handshake failed:", err)
+	}
+	return <-errCheck
+}
+
+func TestCheckTLSSessionReuse(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	if checkTLSSessionReuse(server) == nil {
+		t.Fatal("The cleartext data connections should be refused")
+	}
+
+	config := selfSignedConfig(t)
+	clientConfig := &tls.Config{InsecureSkipVerify: true, ServerName: "ftp", ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	if sessionReuseChecked(t, config, clientConfig) == nil {
+		t.Fatal("The new TLS sessions should be refused")
+	}
+	if err := sessionReuseChecked(t, config, clientConfig); err != nil {
+		t.Fatal("The resumed TLS session should be accepted:", err)
+	}
+}
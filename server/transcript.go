@@ -0,0 +1,109 @@
+package server
+
+import (
+	"time"
+)
+
+// TranscriptEntryType is the type of an entry of a session transcript
+type TranscriptEntryType string
+
+const (
+	// TranscriptCommand is a command received from the client
+	TranscriptCommand TranscriptEntryType = "command"
+	// TranscriptReply is a reply line sent to the client
+	TranscriptReply TranscriptEntryType = "reply"
+	// TranscriptTransfer is the manifest of a file transfer (never its content)
+	TranscriptTransfer TranscriptEntryType = "transfer"
+)
+
+// TranscriptEntry is an entry of the transcript of a session: a command, a reply line or a transfer manifest
+type TranscriptEntry struct {
+	Time       time.Time           `json:"time"`                // Time of the entry
+	Type       TranscriptEntryType `json:"type"`                // Type of the entry
+	SessionID  uint32              `json:"session"`             // ID of the client session
+	SessionUID string              `json:"session_uid"`         // Unique ID of the client session
+	User       string              `json:"user,omitempty"`      // User, as given by the client
+	RemoteAddr string              `json:"remote_addr"`         // Address of the client
+	Line       string              `json:"line,omitempty"`      // Command (with the sensitive params redacted) or reply line
+	Path       string              `json:"path,omitempty"`      // Path of the transferred file
+	Direction  string              `json:"direction,omitempty"` // Direction of the transfer: "download" or "upload"
+	Size       int64               `json:"size,omitempty"`      // Bytes transferred
+	Duration   time.Duration       `json:"duration,omitempty"`  // Duration of the transfer
+	Error      string              `json:"error,omitempty"`     // Error of the failed transfers
+}
+
+// TranscriptSink is implemented by the recorders of the session transcripts, for the audits requiring everything the
+// clients sent and received. The content of the files isn't recorded, only the manifests of their transfers.
+type TranscriptSink interface {
+	// Record records an entry
+	Record(entry *TranscriptEntry)
+}
+
+// TranscriptSelector can be implemented by the MainDriver to only record the transcripts of some sessions, like the
+// ones of the regulated users. It's checked on each entry, so it can depend on the user once logged in.
+type TranscriptSelector interface {
+	// RecordTranscript tells if the exchanges of the session should be recorded
+	RecordTranscript(cc ClientContext) bool
+}
+
+// recording tells if the entries of the session are recorded, by the transcript sink or a capture
+func (c *clientHandler) recording() bool {
+	return (c.daddy != nil && c.daddy.Transcript != nil) || c.getCapture() != nil
+}
+
+// transcript records an entry of the session to the transcript sink if its session is recorded, and to the capture
+// of the session if there's one
+func (c *clientHandler) transcript(entry *TranscriptEntry) {
+	capture := c.getCapture()
+	record := c.daddy != nil && c.daddy.Transcript != nil
+	if record {
+		if selector, ok := c.daddy.driver.(TranscriptSelector); ok && !selector.RecordTranscript(c) {
+			record = false
+		}
+	}
+	if !record && capture == nil {
+		return
+	}
+	entry.Time = time.Now()
+	entry.SessionID = c.id
+	entry.SessionUID = c.uid
+	entry.User = c.User()
+	entry.RemoteAddr = c.conn.RemoteAddr().String()
+	if capture != nil {
+		capture.record(entry)
+	}
+	if record {
+		c.daddy.Transcript.Record(entry)
+	}
+}
+
+// transcriptCommand records a received command, its param redacted if it's sensitive
+func (c *clientHandler) transcriptCommand(command, param string) {
+	if !c.recording() {
+		return
+	}
+	line := command
+	if redactedCommands[command] && param != "" {
+		line += " ****"
+	} else if param != "" {
+		line += " " + param
+	}
+	c.transcript(&TranscriptEntry{Type: TranscriptCommand, Line: line})
+}
+
+// transcriptTransfer records the manifest of a file transfer
+func (c *clientHandler) transcriptTransfer(path string, direction TransferDirection, size int64,
+	duration time.Duration, err error) {
+	if !c.recording() {
+		return
+	}
+	entry := &TranscriptEntry{Type: TranscriptTransfer, Path: path, Direction: "download", Size: size,
+		Duration: duration}
+	if direction == TransferUpload {
+		entry.Direction = "upload"
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	c.transcript(entry)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// transcriptRecorder keeps the recorded entries
+type transcriptRecorder struct {
+	entries []*TranscriptEntry
+}
+
+func (r *transcriptRecorder) Record(entry *TranscriptEntry) {
+	r.entries = append(r.entries, entry)
+}
+
+// selectingDriver only records the transcripts of one user
+type selectingDriver struct {
+	factoryDriver
+	user string
+}
+
+func (d *selectingDriver) RecordTranscript(cc ClientContext) bool {
+	return cc.User() == d.user
+}
+
+func TestTranscript(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var buf bytes.Buffer
+	recorder := &transcriptRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), conn: conn, id: 5,
+		daddy: &FtpServer{Settings: &Settings{}, driver: &factoryDriver{}, Transcript: recorder}}
+
+	c.handleCommand("USER alice\r\n")
+	c.handleCommand("PASS secret\r\n")
+	c.countTransfer("/file", TransferUpload, 42, time.Second, errors.New("aborted"))
+
+	expected := []TranscriptEntry{
+		{Type: TranscriptCommand, Line: "USER alice"},
+		{Type: TranscriptReply, Line: "331 OK"},
+		{Type: TranscriptCommand, Line: "PASS ****"},
+		{Type: TranscriptReply, Line: "230 Password ok, continue"},
+		{Type: TranscriptTransfer, Path: "/file", Direction: "upload", Size: 42, Duration: time.Second,
+			Error: "aborted"},
+	}
+	if len(recorder.entries) != len(expected) {
+		t.Fatal("Bad number of entries:", len(recorder.entries))
+	}
+	for i, e := range recorder.entries {
+		if e.Type != expected[i].Type || e.Line != expected[i].Line || e.Path != expected[i].Path ||
+			e.Direction != expected[i].Direction || e.Size != expected[i].Size ||
+			e.Duration != expected[i].Duration || e.Error != expected[i].Error {
+			t.Fatal("Bad entry", i, ":", e)
+		}
+		if e.SessionID != 5 || e.Time.IsZero() || e.RemoteAddr == "" {
+			t.Fatal("The entry should identify the session:", e)
+		}
+	}
+	if recorder.entries[2].User != "alice" {
+		t.Fatal("The entries should have the user:", recorder.entries[2])
+	}
+}
+
+func TestTranscriptSelector(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var buf bytes.Buffer
+	recorder := &transcriptRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), conn: conn,
+		daddy: &FtpServer{Settings: &Settings{}, driver: &selectingDriver{user: "bob"}, Transcript: recorder}}
+
+	c.handleCommand("USER alice\r\n")
+	if len(recorder.entries) != 0 {
+		t.Fatal("The session of alice shouldn't be recorded:", recorder.entries[0])
+	}
+	// The selector is checked on each entry: the command was received from alice, its reply is sent to bob
+	c.handleCommand("USER bob\r\n")
+	if len(recorder.entries) != 1 || recorder.entries[0].Line != "331 OK" {
+		t.Fatal("The session of bob should be recorded:", len(recorder.entries))
+	}
+}
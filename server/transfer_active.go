@@ -16,24 +16,82 @@ func (c *clientHandler) handlePORT() {
 		return
 	}
 
-	c.writeMessage(200, "PORT command successful")
+	c.declareActiveTransfer(raddr)
+}
+
+func (c *clientHandler) handleEPRT() {
+	raddr, err := parseExtendedAddr(c.param)
+
+	if err == errUnknownNetworkProtocol {
+		c.writeMessage(522, "Network protocol not supported, use (1,2)")
+		return
+	} else if err != nil {
+		c.writeMessage(500, fmt.Sprintf("Problem parsing EPRT: %v", err))
+		return
+	}
+
+	c.declareActiveTransfer(raddr)
+}
+
+// declareActiveTransfer declares the active data connection of a PORT or EPRT command
+func (c *clientHandler) declareActiveTransfer(raddr *net.TCPAddr) {
+	if !c.checkActiveTarget(raddr) {
+		return
+	}
+
+	if !c.canDeclareTransfer() {
+		return
+	}
+
+	source, err := c.daddy.dataSourceIP(raddr.IP)
+	if err != nil {
+		c.logger.Error("Could not select the data source", "err", err)
+		c.writeMessage(425, "Could not open an active connection: "+err.Error())
+		return
+	}
+
+	c.writeMessage(200, c.command+" command successful")
 
-	c.transfer = &activeTransferHandler{raddr: raddr, nonStandardPort: c.daddy.Settings.NonStandardActiveDataPort}
+	c.declareTransfer(&activeTransferHandler{
+		raddr:           raddr,
+		source:          source,
+		nonStandardPort: c.daddy.Settings.NonStandardActiveDataPort,
+	})
+}
+
+// checkActiveTarget refuses the active data connections that could be used to reach hosts or services the client
+// can't connect to (bounce attacks): the ones to other hosts than the client, unless FXP (server-to-server transfers)
+// is allowed, and the ones to privileged ports. The refused attempts are audited.
+func (c *clientHandler) checkActiveTarget(raddr *net.TCPAddr) bool {
+	var reason string
+	if client := c.clientIP(); !c.session.AllowFXP && client != nil && !client.Equal(raddr.IP) {
+		reason = "Active connections to other hosts are not allowed"
+	} else if raddr.Port < 1024 && !c.daddy.Settings.AllowPrivilegedTargets {
+		reason = "Active connections to privileged ports are not allowed"
+	} else {
+		return true
+	}
+
+	c.logger.Warn("Active connection refused", logKeyAction, "ftp.bounce_attempt", "target", raddr.String(), "reason", reason)
+	c.audit(AuditBounceAttempt, "", raddr.String(), errors.New(reason))
+	c.writeMessage(504, reason)
+	return false
 }
 
 // Active connection
 type activeTransferHandler struct {
 	raddr           *net.TCPAddr // Remote address of the client
+	source          net.IP       // Local address to connect from (any if nil)
 	conn            net.Conn     // Connection used to connect to him
 	nonStandardPort bool         // Allow to use an other port than the 20 one
 }
 
 func (a *activeTransferHandler) Open() (net.Conn, error) {
 	var laddr *net.TCPAddr
-	if a.nonStandardPort {
-		laddr = nil
-	} else {
-		laddr, _ = net.ResolveTCPAddr("tcp", ":20")
+	if !a.nonStandardPort {
+		laddr = &net.TCPAddr{IP: a.source, Port: 20}
+	} else if a.source != nil {
+		laddr = &net.TCPAddr{IP: a.source}
 	}
 	// TODO(mgenov): support dialing with timeout
 	// Issues:
@@ -85,3 +143,44 @@ func parseRemoteAddr(param string) (*net.TCPAddr, error) {
 
 	return net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", ip, port))
 }
+
+// errUnknownNetworkProtocol is returned for the EPRT params with another protocol than IPv4 and IPv6
+var errUnknownNetworkProtocol = errors.New("unknown network protocol")
+
+// parseExtendedAddr parses the address of an EPRT command (RFC 2428). The fields are separated by the first
+// character of the param.
+//
+// Param Format: |1|132.235.1.2|6275| or |2|1080::8:800:200C:417A|5282|
+func parseExtendedAddr(param string) (*net.TCPAddr, error) {
+	if param == "" {
+		return nil, errors.New("empty param")
+	}
+	fields := strings.Split(param, param[:1])
+	if len(fields) != 5 || fields[0] != "" || fields[4] != "" {
+		return nil, errors.New("bad number of fields")
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("bad address %s", fields[2])
+	}
+	switch fields[1] {
+	case "1":
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("bad IPv4 address %s", fields[2])
+		}
+	case "2":
+		if ip.To4() != nil && !strings.Contains(fields[2], ":") {
+			return nil, fmt.Errorf("bad IPv6 address %s", fields[2])
+		}
+	default:
+		return nil, errUnknownNetworkProtocol
+	}
+
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("bad port %s", fields[3])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestParseExtendedAddr(t *testing.T) {
+	if addr, err := parseExtendedAddr("|1|132.235.1.2|6275|"); err != nil || addr.String() != "132.235.1.2:6275" {
+		t.Fatal("Wrong IPv4 address:", addr, err)
+	}
+	if addr, err := parseExtendedAddr("!2!1080::8:800:200C:417A!5282!"); err != nil ||
+		addr.String() != "[1080::8:800:200c:417a]:5282" {
+		t.Fatal("Wrong IPv6 address:", addr, err)
+	}
+	if _, err := parseExtendedAddr("|3|1.2.3.4|80|"); err != errUnknownNetworkProtocol {
+		t.Fatal("The unknown protocol should be reported:", err)
+	}
+	for _, param := range []string{"", "|1|1.2.3.4|", "|1|::1|80|", "|2|1.2.3.4|80|", "|1|1.2.3.4|0|", "|1|host|80|"} {
+		if _, err := parseExtendedAddr(param); err == nil {
+			t.Fatal("The param should be refused:", param)
+		}
+	}
+}
+
+// loopbackConn returns both sides of a connection on the loopback interface
+func loopbackConn(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatal("Couldn't accept:", err)
+	}
+	return conn, client
+}
+
+func TestActiveTarget(t *testing.T) {
+	conn, client := loopbackConn(t)
+	defer conn.Close()
+	defer client.Close()
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}}, conn: conn,
+		logger: nopLogger{}}
+
+	c.command, c.param = "PORT", "127,0,0,1,8,74"
+	c.handlePORT()
+	c.command, c.param = "EPRT", "|1|192.0.2.1|2122|"
+	c.handleEPRT()
+	if expected := "200 PORT command successful\r\n504 Active connections to other hosts are not allowed\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if len(c.transfers) != 1 {
+		t.Fatal("Only the connection to the client should be declared:", len(c.transfers))
+	}
+
+	// FXP can be enabled for the user
+	buf.Reset()
+	c.session.AllowFXP = true
+	c.handleEPRT()
+	if buf.String() != "200 EPRT command successful\r\n" {
+		t.Fatalf("The other host should be accepted: %q", buf.String())
+	}
+}
+
+func TestBounceAttempt(t *testing.T) {
+	conn, client := loopbackConn(t)
+	defer conn.Close()
+	defer client.Close()
+
+	var buf bytes.Buffer
+	recorder := &auditRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: &FtpServer{Settings: &Settings{}, AuditSink: recorder},
+		conn: conn, logger: nopLogger{}}
+
+	c.command, c.param = "PORT", "127,0,0,1,0,25"
+	c.handlePORT()
+	if buf.String() != "504 Active connections to privileged ports are not allowed\r\n" || len(c.transfers) != 0 {
+		t.Fatalf("The privileged port should be refused: %q", buf.String())
+	}
+
+	c.command, c.param = "EPRT", "|1|192.0.2.1|2122|"
+	c.handleEPRT()
+	if len(recorder.events) != 2 {
+		t.Fatal("The attempts should be audited:", len(recorder.events))
+	}
+	if e := recorder.events[1]; e.Type != AuditBounceAttempt || e.Target != "192.0.2.1:2122" || e.Command != "EPRT" {
+		t.Fatal("Bad event:", e)
+	}
+
+	// Even the FXP transfers can't target the privileged ports
+	buf.Reset()
+	c.session.AllowFXP = true
+	c.command, c.param = "EPRT", "|1|192.0.2.1|21|"
+	c.handleEPRT()
+	if buf.String() != "504 Active connections to privileged ports are not allowed\r\n" {
+		t.Fatalf("The privileged port should be refused: %q", buf.String())
+	}
+
+	buf.Reset()
+	c.daddy.Settings.AllowPrivilegedTargets = true
+	c.handleEPRT()
+	if buf.String() != "200 EPRT command successful\r\n" {
+		t.Fatalf("The privileged port should be accepted: %q", buf.String())
+	}
+}
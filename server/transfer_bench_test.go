@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/client"
+	"github.com/fclairamb/ftpserver/ftptest"
+	"github.com/fclairamb/ftpserver/sample"
+	"github.com/fclairamb/ftpserver/server"
+)
+
+// The transfer benchmarks measure the RETR and STOR throughput on the loopback interface, in plaintext and with TLS,
+// for the I/O settings that matter on fast links:
+//
+//	go test -run XXX -bench 'RETR|STOR' ./server/
+
+const benchFileSize = 8 << 20
+
+// benchTuning is a set of transfer settings
+type benchTuning struct {
+	name     string
+	settings server.Settings
+}
+
+var benchTunings = []benchTuning{
+	{name: "default"},
+	{name: "buffer-256k", settings: server.Settings{TransferBufferSize: 256 * 1024}},
+	{name: "socket-4m", settings: server.Settings{DataSocketBufferSize: 4 << 20}},
+	{name: "coalesce", settings: server.Settings{CoalesceDataWrites: true}},
+	{name: "nagle", settings: server.Settings{DisableDataNoDelay: true}},
+}
+
+// benchDriver serves a temporary directory with some settings
+type benchDriver struct {
+	dir       string
+	settings  server.Settings
+	tlsConfig *tls.Config
+}
+
+func (d *benchDriver) GetSettings() *server.Settings {
+	settings := d.settings
+	return &settings
+}
+
+func (d *benchDriver) GetTLSConfig() (*tls.Config, error) {
+	return d.tlsConfig, nil
+}
+
+func (d *benchDriver) WelcomeUser(cc server.ClientContext) (string, error) {
+	return "Benchmark server", nil
+}
+
+func (d *benchDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
+	if pass != "bench" {
+		return nil, errors.New("bad password")
+	}
+	return &sample.ClientDriver{BaseDir: d.dir}, nil
+}
+
+func (d *benchDriver) UserLeft(cc server.ClientContext) {}
+
+// benchCertificate creates a throwaway certificate
+func benchCertificate(b *testing.B) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal("Couldn't generate the key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		b.Fatal("Couldn't create the certificate:", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// benchTransfers runs a benchmark for each transport and tuning, on a logged in connection
+func benchTransfers(b *testing.B, run func(b *testing.B, conn *client.Conn, data []byte)) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), benchFileSize/16)
+	certificate := benchCertificate(b)
+
+	for _, transport := range []string{"plain", "tls"} {
+		for _, tuning := range benchTunings {
+			b.Run(transport+"/"+tuning.name, func(b *testing.B) {
+				dir, err := ioutil.TempDir("", "ftpbench")
+				if err != nil {
+					b.Fatal("Couldn't create the directory:", err)
+				}
+				defer os.RemoveAll(dir)
+
+				driver := &benchDriver{
+					dir:       dir,
+					settings:  tuning.settings,
+					tlsConfig: &tls.Config{Certificates: []tls.Certificate{certificate}},
+				}
+				s := ftptest.NewServer(b, driver)
+				defer s.Close()
+
+				conn, err := client.Dial(s.Addr(), &client.Config{TLSConfig: &tls.Config{InsecureSkipVerify: true}})
+				if err != nil {
+					b.Fatal("Couldn't connect:", err)
+				}
+				defer conn.Close()
+				if transport == "tls" {
+					if err = conn.AuthTLS(); err != nil {
+						b.Fatal("Couldn't negotiate TLS:", err)
+					}
+				}
+				if err = conn.Login("bench", "bench"); err != nil {
+					b.Fatal("Couldn't log in:", err)
+				}
+
+				b.SetBytes(int64(len(data)))
+				run(b, conn, data)
+			})
+		}
+	}
+}
+
+func BenchmarkRETR(b *testing.B) {
+	benchTransfers(b, func(b *testing.B, conn *client.Conn, data []byte) {
+		if _, err := conn.Store("/file.bin", bytes.NewReader(data)); err != nil {
+			b.Fatal("Couldn't upload:", err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := conn.Retrieve("/file.bin", ioutil.Discard); err != nil {
+				b.Fatal("Couldn't download:", err)
+			}
+		}
+	})
+}
+
+func BenchmarkSTOR(b *testing.B) {
+	benchTransfers(b, func(b *testing.B, conn *client.Conn, data []byte) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := conn.Store("/file.bin", bytes.NewReader(data)); err != nil {
+				b.Fatal("Couldn't upload:", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// startTransfer runs a data transfer command in its own goroutine, so that the control connection can still be read
+// while the data is flowing
+func (c *clientHandler) startTransfer(cmdDesc *CommandDescription) {
+	done := make(chan struct{})
+	c.xferDone = done
+	c.xferCmd = strings.TrimSpace(c.command + " " + c.loggableParam())
+	c.xferCtx, c.xferCancel = context.WithCancel(context.Background())
+	c.setAbortCause(nil)
+
+	go func() {
+		defer c.setIdleDeadline()
+		defer close(done)
+		defer c.xferCancel()
+		defer c.setTransferPath("")
+		c.executeCommand(cmdDesc)
+	}()
+}
+
+// TransferContext returns the context of the current data transfer, cancelled when the client aborts it
+func (c *clientHandler) TransferContext() context.Context {
+	if c.xferCtx == nil {
+		return context.Background()
+	}
+	return c.xferCtx
+}
+
+// abortTransfer interrupts the data transfer in progress: its context is cancelled, which closes its data connection
+func (c *clientHandler) abortTransfer(cause error) {
+	c.setAbortCause(cause)
+	c.xferCancel()
+}
+
+// endTransfer waits for the data transfer in progress at the end of the session, those still running when the control
+// connection is lost are aborted
+func (c *clientHandler) endTransfer() {
+	if c.transferInProgress() {
+		c.abortTransfer(ErrControlConnectionLost)
+	}
+	c.waitTransfer()
+}
+
+func (c *clientHandler) setAbortCause(cause error) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.xferAbort = cause
+}
+
+// setTransferPath records the path of the file transfer in progress, for CancelTransfer
+func (c *clientHandler) setTransferPath(path string) {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	c.xferPath = path
+}
+
+// cancelTransfer aborts the file transfer in progress if it's the one of path, it returns false otherwise
+func (c *clientHandler) cancelTransfer(path string) bool {
+	c.paramsMutex.Lock()
+	defer c.paramsMutex.Unlock()
+	if c.xferPath == "" || c.xferPath != path {
+		return false
+	}
+	// The path is cleared before the transfer command ends, xferCancel is still the one of this transfer
+	c.xferAbort = ErrTransferCancelled
+	c.xferCancel()
+	return true
+}
+
+// abortCause returns why the current data transfer was aborted, nil if it wasn't
+func (c *clientHandler) abortCause() error {
+	c.paramsMutex.RLock()
+	defer c.paramsMutex.RUnlock()
+	return c.xferAbort
+}
+
+// reportAbort tells the driver about the partial state of an aborted transfer
+func (c *clientHandler) reportAbort(path string, direction TransferDirection, offset, size int64, cause error) {
+	if c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("Transfer aborted", logKeyAction, "ftp.transfer_abort", "path", path, "size", size, "cause", cause)
+	}
+	if hook, ok := c.driver.(TransferAbortHook); ok {
+		hook.TransferAborted(c, &AbortedTransfer{
+			Path:      path,
+			Direction: direction,
+			Offset:    offset,
+			Size:      size,
+			Cause:     cause,
+		})
+	}
+}
+
+// transferSummary returns the message of the 226 reply of a file transfer, with its size, duration and average rate
+// when Settings.TransferSummary is set, for the logs of the clients: "Closing transfer connection (1048576 bytes in
+// 0.500s, 2.00 MB/s)"
+func (c *clientHandler) transferSummary(size int64, duration time.Duration) string {
+	message := "Closing transfer connection"
+	if settings := c.daddy.Settings; settings == nil || !settings.TransferSummary {
+		return message
+	}
+	return fmt.Sprintf("%s (%d bytes in %.3fs, %s)", message, size, duration.Seconds(), formatRate(size, duration))
+}
+
+// formatRate formats the average rate of a transfer with binary units
+func formatRate(size int64, duration time.Duration) string {
+	if duration <= 0 {
+		duration = time.Millisecond
+	}
+	rate := float64(size) / duration.Seconds()
+	for _, unit := range []string{"B/s", "KB/s", "MB/s"} {
+		if rate < 1024 {
+			return fmt.Sprintf("%.2f %s", rate, unit)
+		}
+		rate /= 1024
+	}
+	return fmt.Sprintf("%.2f GB/s", rate)
+}
+
+// transferInProgress tells if a data transfer command is still being executed
+func (c *clientHandler) transferInProgress() bool {
+	if c.xferDone == nil {
+		return false
+	}
+	select {
+	case <-c.xferDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// waitTransfer waits for the data transfer command in progress (if any) to end
+func (c *clientHandler) waitTransfer() {
+	if c.xferDone != nil {
+		<-c.xferDone
+	}
+}
+
+// setReadDeadline arms the idle timeout, unless a transfer is in progress: the session isn't idle then, and the
+// transfer re-arms it once it ends
+func (c *clientHandler) setReadDeadline() {
+	if !c.transferInProgress() {
+		c.setIdleDeadline()
+		return
+	}
+	c.conn.SetReadDeadline(time.Time{})
+	// The transfer might have ended (and armed the timeout) before we removed it
+	if !c.transferInProgress() {
+		c.setIdleDeadline()
+	}
+}
+
+// handleDuringTransfer answers the commands that can't wait for the transfer in progress to end: the NOOP keepalives
+// sent by many clients and the STAT requests of the transfer status. The replies don't touch the state of the
+// transfer command. It returns false for the other commands, which are executed once the transfer has ended (this
+// includes QUIT, which waits for the transfer result to be sent before closing the connection, as RFC 959 requires).
+// ABOR interrupts the transfer first, so that its 426 reply comes before the 226 one of ABOR.
+func (c *clientHandler) handleDuringTransfer(command, param string) bool {
+	if command == "ABOR" {
+		c.abortTransfer(ErrTransferAborted)
+		return false
+	}
+
+	if command != "NOOP" && (command != "STAT" || param != "") {
+		return false
+	}
+
+	if c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("FTP RECV during transfer", logKeyAction, "ftp.cmd_recv", "command", command, "transfer", c.xferCmd)
+	}
+
+	if command == "NOOP" {
+		c.writeLine("200 OK")
+	} else {
+		c.writeLine(fmt.Sprintf("213-Transfer in progress:\r\n %s\r\n213 End", c.xferCmd))
+	}
+	return true
+}
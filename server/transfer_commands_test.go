@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCommandsDuringTransfer(t *testing.T) {
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	c := &clientHandler{
+		writer:   bufio.NewWriter(&buf),
+		daddy:    &FtpServer{},
+		xferDone: done,
+		xferCmd:  "RETR file",
+		lastCode: 150,
+	}
+
+	c.handleCommand("NOOP\r\n")
+	c.handleCommand("STAT\r\n")
+	if expected := "200 OK\r\n213-Transfer in progress:\r\n RETR file\r\n213 End\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies during the transfer: %q", buf.String())
+	}
+	if c.lastCode != 150 || c.command != "" {
+		t.Fatal("The state of the transfer command shouldn't change:", c.lastCode, c.command)
+	}
+
+	// The other commands wait for the end of the transfer
+	buf.Reset()
+	executed := make(chan struct{})
+	go func() {
+		defer close(executed)
+		c.handleCommand("XYZ\r\n")
+	}()
+
+	select {
+	case <-executed:
+		t.Fatal("The command shouldn't be executed during the transfer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(done)
+	<-executed
+	if buf.String() != "500 Unknown command\r\n" || c.command != "XYZ" {
+		t.Fatalf("The command should be executed after the transfer: %q", buf.String())
+	}
+	if c.transferInProgress() {
+		t.Fatal("The transfer should be over")
+	}
+}
+
+// endlessFile is a file without end
+type endlessFile struct{ FileStream }
+
+func (f *endlessFile) Read(p []byte) (int, error) { return len(p), nil }
+
+func (f *endlessFile) Close() error { return nil }
+
+// abortDriver serves endless files and records the aborted transfers
+type abortDriver struct {
+	ClientHandlingDriver
+	aborted *AbortedTransfer
+}
+
+func (d *abortDriver) OpenFile(cc ClientContext, path string, flag int) (FileStream, error) {
+	return &endlessFile{}, nil
+}
+
+func (d *abortDriver) TransferAborted(cc ClientContext, transfer *AbortedTransfer) {
+	d.aborted = transfer
+}
+
+// pipeTransfer is a data connection on a pipe
+type pipeTransfer struct{ conn net.Conn }
+
+func (t *pipeTransfer) Open() (net.Conn, error) { return t.conn, nil }
+
+func (t *pipeTransfer) Close() error { return t.conn.Close() }
+
+// startEndlessDownload starts a RETR on a pipe and waits for its data to flow
+func startEndlessDownload(t *testing.T, buf *bytes.Buffer) (*clientHandler, *abortDriver) {
+	driver := &abortDriver{}
+	c := &clientHandler{writer: bufio.NewWriter(buf), daddy: &FtpServer{}, driver: driver}
+	c.daddy.bufferPool.New = func() interface{} {
+		b := make([]byte, 1024)
+		return &b
+	}
+
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+
+	c.handleCommand("RETR file\r\n")
+	if !c.transferInProgress() {
+		t.Fatal("The transfer should be in progress")
+	}
+
+	if _, err := io.ReadFull(client, make([]byte, 4096)); err != nil {
+		t.Fatal("Couldn't receive the file:", err)
+	}
+	go io.Copy(ioutil.Discard, client)
+	return c, driver
+}
+
+func TestAbortTransfer(t *testing.T) {
+	var buf bytes.Buffer
+	c, driver := startEndlessDownload(t, &buf)
+
+	c.handleCommand("ABOR\r\n")
+	if expected := "150 Using transfer connection\r\n426 Transfer aborted\r\n226 ABOR successful\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if aborted := driver.aborted; aborted == nil || aborted.Path != "/file" || aborted.Size < 4096 ||
+		aborted.Cause != ErrTransferAborted {
+		t.Fatal("The driver should be told about the aborted transfer:", aborted)
+	}
+	if c.TransferContext().Err() == nil {
+		t.Fatal("The transfer context should be cancelled")
+	}
+
+	// Without any transfer, ABOR only closes the data connection
+	buf.Reset()
+	c.handleCommand("ABOR\r\n")
+	if buf.String() != "226 ABOR successful\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+}
+
+func TestAbortTransferTelnetSynch(t *testing.T) {
+	var buf bytes.Buffer
+	c, _ := startEndlessDownload(t, &buf)
+
+	// The clients interrupt the transfer with the Telnet IP and Synch sequences before ABOR
+	c.handleCommand("\xff\xf4\xff\xf2ABOR\r\n")
+	if expected := "150 Using transfer connection\r\n426 Transfer aborted\r\n226 ABOR successful\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+}
+
+func TestCancelTransfer(t *testing.T) {
+	var buf bytes.Buffer
+	c, driver := startEndlessDownload(t, &buf)
+	c.logger = nopLogger{}
+	c.daddy.connectionsByID = map[uint32]*clientHandler{1: c}
+
+	if err := c.daddy.CancelTransfer(1, "/other"); err != ErrNoTransfer {
+		t.Fatal("Only the transfer of the path should be cancelled:", err)
+	}
+	if err := c.daddy.CancelTransfer(2, "/file"); err == nil {
+		t.Fatal("An unknown session should be reported")
+	}
+	if err := c.daddy.CancelTransfer(1, "/file"); err != nil {
+		t.Fatal("Couldn't cancel the transfer:", err)
+	}
+	c.waitTransfer()
+	if expected := "150 Using transfer connection\r\n426 Transfer aborted\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+	if aborted := driver.aborted; aborted == nil || aborted.Path != "/file" || aborted.Cause != ErrTransferCancelled {
+		t.Fatal("The driver should be told about the cancelled transfer:", aborted)
+	}
+	if err := c.daddy.CancelTransfer(1, "/file"); err != ErrNoTransfer {
+		t.Fatal("The transfer should be over:", err)
+	}
+}
+
+func TestControlConnectionLost(t *testing.T) {
+	var buf bytes.Buffer
+	c, driver := startEndlessDownload(t, &buf)
+
+	c.endTransfer()
+	if c.transferInProgress() {
+		t.Fatal("The transfer should be over")
+	}
+	if aborted := driver.aborted; aborted == nil || aborted.Cause != ErrControlConnectionLost {
+		t.Fatal("The driver should be told about the aborted transfer:", aborted)
+	}
+}
+
+func TestTransferSummary(t *testing.T) {
+	c := &clientHandler{daddy: &FtpServer{Settings: &Settings{}}}
+	if message := c.transferSummary(1024, time.Second); message != "Closing transfer connection" {
+		t.Fatal("The summary should be disabled by default:", message)
+	}
+
+	c.daddy.Settings.TransferSummary = true
+	if message := c.transferSummary(1<<20, 500*time.Millisecond); message !=
+		"Closing transfer connection (1048576 bytes in 0.500s, 2.00 MB/s)" {
+		t.Fatal("Bad summary:", message)
+	}
+
+	for expected, rate := range map[string][2]int64{
+		"100.00 B/s":  {100, int64(time.Second)},
+		"1.50 KB/s":   {1536, int64(time.Second)},
+		"4.00 GB/s":   {4 << 30, int64(time.Second)},
+		"1000.00 B/s": {1, 0},
+	} {
+		if formatted := formatRate(rate[0], time.Duration(rate[1])); formatted != expected {
+			t.Fatal("Bad rate:", formatted, expected)
+		}
+	}
+}
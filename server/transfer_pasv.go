@@ -2,13 +2,12 @@ package server
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
 	"strings"
 	"time"
-
-	"github.com/go-kit/kit/log/level"
 )
 
 // Active/Passive transfer connection handler
@@ -29,39 +28,28 @@ type passiveTransferHandler struct {
 }
 
 func (c *clientHandler) handlePASV() {
-	addr, _ := net.ResolveTCPAddr("tcp", ":0")
-	var tcpListener *net.TCPListener
-	var err error
-
-	portRange := c.daddy.Settings.DataPortRange
-
-	if portRange != nil {
-		for start := portRange.Start; start < portRange.End; start++ {
-			port := portRange.Start + rand.Intn(portRange.End-portRange.Start)
-			laddr, err := net.ResolveTCPAddr("tcp", "0.0.0.0:"+fmt.Sprintf("%d", port))
-			if err != nil {
-				continue
-			}
-
-			tcpListener, err = net.ListenTCP("tcp", laddr)
-			if err == nil {
-				break
-			}
-		}
+	if !c.canDeclareTransfer() {
+		return
+	}
 
-	} else {
-		tcpListener, err = net.ListenTCP("tcp", addr)
+	source, err := c.dataSourceIP()
+	if err != nil {
+		c.logger.Error("Could not select the data source", "err", err)
+		c.writeMessage(425, "Could not open a passive connection: "+err.Error())
+		return
 	}
 
+	tcpListener, err := c.listenPassive(source)
 	if err != nil {
-		level.Error(c.logger).Log(logKeyMsg, "Could not listen", "err", err)
+		c.logger.Error("Could not listen", "err", err)
+		c.writeMessage(425, "Could not open a passive connection: "+err.Error())
 		return
 	}
 
 	// The listener will either be plain TCP or TLS
 	var listener net.Listener
 	if c.transferTLS {
-		if tlsConfig, err := c.daddy.driver.GetTLSConfig(); err == nil {
+		if tlsConfig, err := c.dataTLSConfig(); err == nil {
 			listener = tls.NewListener(tcpListener, tlsConfig)
 		} else {
 			c.writeMessage(550, fmt.Sprintf("Cannot get a TLS config: %v", err))
@@ -77,14 +65,21 @@ func (c *clientHandler) handlePASV() {
 		Port:        tcpListener.Addr().(*net.TCPAddr).Port,
 	}
 
+	// The advertised port can differ from the one we listen on when a NAT remaps it (container port to host port)
+	port := p.Port + c.daddy.Settings.PassivePortOffset
+
 	// We should rewrite this part
 	if c.command == "PASV" {
-		p1 := p.Port / 256
-		p2 := p.Port - (p1 * 256)
+		p1 := port / 256
+		p2 := port - (p1 * 256)
 		// Provide our external IP address so the ftp client can connect back to us
-		ip := c.daddy.Settings.PublicHost
+		ip := c.daddy.publicHost()
 
-		// If we don't have an IP address, we can take the one that was used for the current connection
+		// If we don't have an IP address, we can take the one we listen on or the one that was used for the current
+		// connection
+		if ip == "" && source.To4() != nil {
+			ip = source.String()
+		}
 		if ip == "" {
 			ip = strings.Split(c.conn.LocalAddr().String(), ":")[0]
 		}
@@ -92,10 +87,47 @@ func (c *clientHandler) handlePASV() {
 		quads := strings.Split(ip, ".")
 		c.writeMessage(227, fmt.Sprintf("Entering Passive Mode (%s,%s,%s,%s,%d,%d)", quads[0], quads[1], quads[2], quads[3], p1, p2))
 	} else {
-		c.writeMessage(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", p.Port))
+		c.writeMessage(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+	}
+
+	c.declareTransfer(p)
+}
+
+// listenPassive listens on one of the available passive ports: the PassivePorts if defined, the DataPortRange ones
+// (of the session) otherwise or any port if none of them is defined. The ports are tried from a random one.
+// They are bound to the source IP, or to all the addresses if it's nil.
+func (c *clientHandler) listenPassive(source net.IP) (*net.TCPListener, error) {
+	settings := c.daddy.Settings
+	portRange := c.session.DataPortRange
+
+	var count int
+	var port func(i int) int
+	if len(settings.PassivePorts) > 0 && portRange == settings.DataPortRange {
+		// The passive ports are only ignored when the user defines its own port range
+		count = len(settings.PassivePorts)
+		port = func(i int) int { return settings.PassivePorts[i] }
+	} else if portRange != nil {
+		count = portRange.End - portRange.Start + 1
+		port = func(i int) int { return portRange.Start + i }
+	} else {
+		return net.ListenTCP("tcp", &net.TCPAddr{IP: source})
+	}
+
+	if count <= 0 {
+		return nil, errors.New("no passive port is configured")
+	}
+
+	var lastErr error
+	first := rand.Intn(count)
+	for i := 0; i < count; i++ {
+		tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: source, Port: port((first + i) % count)})
+		if err == nil {
+			return tcpListener, nil
+		}
+		lastErr = err
 	}
 
-	c.transfer = p
+	return nil, lastErr
 }
 
 func (p *passiveTransferHandler) ConnectionWait(wait time.Duration) (net.Conn, error) {
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenPassivePorts(t *testing.T) {
+	// We pick a free port
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{})
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c := &clientHandler{daddy: &FtpServer{Settings: &Settings{PassivePorts: []int{port}}}}
+
+	first, err := c.listenPassive(nil)
+	if err != nil {
+		t.Fatal("Couldn't listen on the passive port:", err)
+	}
+	defer first.Close()
+
+	if actual := first.Addr().(*net.TCPAddr).Port; actual != port {
+		t.Fatal("Bad port:", actual)
+	}
+
+	// The only port is used
+	if second, err := c.listenPassive(nil); err == nil {
+		second.Close()
+		t.Fatal("There shouldn't be any port left")
+	}
+
+	// A range of a single port can be defined as well
+	first.Close()
+	c.daddy.Settings = &Settings{DataPortRange: &PortRange{Start: port, End: port}}
+	c.session = newSessionSettings(c.daddy.Settings)
+	if first, err = c.listenPassive(nil); err != nil {
+		t.Fatal("Couldn't listen on the port range:", err)
+	}
+	if actual := first.Addr().(*net.TCPAddr).Port; actual != port {
+		t.Fatal("Bad port:", actual)
+	}
+	first.Close()
+}
+
+func TestListenPassiveSource(t *testing.T) {
+	c := &clientHandler{daddy: &FtpServer{Settings: &Settings{}}}
+	l, err := c.listenPassive(net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer l.Close()
+
+	if ip := l.Addr().(*net.TCPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatal("The passive socket should be bound to the source:", ip)
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+)
+
+const defaultTransferBufferSize = 32 * 1024 // Default size of the buffers used for transfers
+
+// transferBufferSize returns the size of the buffers used for data transfers
+func (server *FtpServer) transferBufferSize() int {
+	if server.Settings != nil && server.Settings.TransferBufferSize > 0 {
+		return server.Settings.TransferBufferSize
+	}
+	return defaultTransferBufferSize
+}
+
+// copyStream copies everything from src to dst using one of the pooled transfer buffers
+func (server *FtpServer) copyStream(dst io.Writer, src io.Reader) (int64, error) {
+	buf := server.bufferPool.Get().(*[]byte)
+	defer server.bufferPool.Put(buf)
+
+	// Hiding their io.WriterTo and io.ReaderFrom keeps files and connections from copying through a buffer of their own
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// coalescedCopy copies everything from src to dst, gathering the small writes in chunks of the size of the transfer
+// buffers. Streams writing small blocks then don't cost a syscall (and a TLS record) per block.
+func (server *FtpServer) coalescedCopy(dst io.Writer, src io.Reader) (int64, error) {
+	// Hiding the io.ReaderFrom of TCP connections keeps the buffered writer from handing them the copy directly
+	writer := bufio.NewWriterSize(struct{ io.Writer }{dst}, server.transferBufferSize())
+	size, err := server.copyStream(writer, src)
+	if errFlush := writer.Flush(); err == nil {
+		err = errFlush
+	}
+	return size, err
+}
+
+// queuedChunk is a block of an upload read from the data connection, waiting to be written
+type queuedChunk struct {
+	buf  *[]byte // Pooled transfer buffer
+	size int     // Bytes of the buffer read
+}
+
+// queuedCopy copies everything from src to dst through a queue of transfer buffers holding at most maxBytes: a
+// goroutine keeps reading src while dst is busy writing, and stops once the queue is full so that the client is slowed
+// down by TCP instead of the data being buffered without limit. After a write error, the reading goroutine ends with
+// the next read of src, whose connection is closed by the caller.
+func (server *FtpServer) queuedCopy(dst io.Writer, src io.Reader, maxBytes int) (int64, error) {
+	count := maxBytes / server.transferBufferSize()
+	if count < 1 {
+		count = 1
+	}
+	queue := make(chan queuedChunk, count)
+	free := make(chan *[]byte, count)
+	done := make(chan struct{})
+	var errRead error
+
+	go func() {
+		defer close(queue)
+		allocated := 0
+		for {
+			var buf *[]byte
+			select {
+			case buf = <-free:
+			default:
+				if allocated < count {
+					allocated++
+					buf = server.bufferPool.Get().(*[]byte)
+				} else {
+					select {
+					case buf = <-free:
+					case <-done:
+						return
+					}
+				}
+			}
+
+			n, err := src.Read(*buf)
+			if n > 0 {
+				select {
+				case queue <- queuedChunk{buf: buf, size: n}:
+				case <-done:
+					server.bufferPool.Put(buf)
+					return
+				}
+			} else {
+				server.bufferPool.Put(buf)
+			}
+			if err != nil {
+				if err != io.EOF {
+					errRead = err
+				}
+				return
+			}
+		}
+	}()
+
+	var written int64
+	for chunk := range queue {
+		n, err := dst.Write((*chunk.buf)[:chunk.size])
+		written += int64(n)
+		if err == nil && n < chunk.size {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			// Stops the reads, the chunks already queued are left to the garbage collector
+			close(done)
+			return written, err
+		}
+		free <- chunk.buf
+	}
+	// The buffers left once the reads are over
+	for len(free) > 0 {
+		server.bufferPool.Put(<-free)
+	}
+	return written, errRead
+}
+
+// tuneDataConn applies the socket settings to a data connection
+func (server *FtpServer) tuneDataConn(conn net.Conn) {
+	if server.Settings != nil {
+		server.tuneConn(conn, server.Settings.DisableDataNoDelay, server.Settings.DataSocketBufferSize)
+	}
+}
+
+// sendFile copies a file to the data connection.
+// When the file is a local one and the connection is a plain TCP one, the copy is delegated to the kernel (sendfile
+// or splice) and never goes through user space.
+//
+// Streams implementing io.WriterTo are in charge of their own buffering.
+func (server *FtpServer) sendFile(conn net.Conn, file FileStream) (int64, error) {
+	if f, ok := file.(*os.File); ok {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			return tcpConn.ReadFrom(f)
+		}
+	} else if writerTo, ok := file.(io.WriterTo); ok {
+		return writerTo.WriteTo(conn)
+	}
+
+	return server.copyStream(conn, file)
+}
+
+// receiveFile copies the content of the data connection to a file.
+// Streams implementing io.ReaderFrom (like multipart uploaders) are in charge of their own buffering, local files
+// only take this path on plain TCP connections so that the kernel can do the copy.
+func (server *FtpServer) receiveFile(file FileStream, conn io.Reader) (int64, error) {
+	if f, ok := file.(*os.File); ok {
+		if _, ok := conn.(*net.TCPConn); ok {
+			return f.ReadFrom(conn)
+		}
+	} else if readerFrom, ok := file.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(conn)
+	}
+
+	return server.copyStream(file, conn)
+}
+
+// newUploadHash creates the hash computed on uploads, there's none if no algorithm is specified
+func newUploadHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "":
+		return nil, nil
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm: %s", algorithm)
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendFile(t *testing.T) {
+	content := bytes.Repeat([]byte("ftpserver"), 100000)
+
+	file, err := ioutil.TempFile("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create file:", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err = file.Write(content); err != nil {
+		t.Fatal("Couldn't write file:", err)
+	}
+	if _, err = file.Seek(0, 0); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+
+	server := NewFtpServer(nil)
+	n, err := server.sendFile(conn, file)
+	conn.Close()
+	if err != nil {
+		t.Fatal("Couldn't send file:", err)
+	}
+	if n != int64(len(content)) {
+		t.Fatal("Bad number of bytes sent:", n)
+	}
+	if !bytes.Equal(<-received, content) {
+		t.Fatal("Received content doesn't match")
+	}
+}
+
+// writerToStream is a FileStream that keeps track of its WriteTo usage
+type writerToStream struct {
+	*bytes.Reader
+	used bool
+}
+
+func (s *writerToStream) WriteTo(w io.Writer) (int64, error) {
+	s.used = true
+	return s.Reader.WriteTo(w)
+}
+
+func (s *writerToStream) Write(p []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
+
+func (s *writerToStream) Close() error {
+	return nil
+}
+
+func TestSendFileWriterTo(t *testing.T) {
+	server := NewFtpServer(nil)
+	stream := &writerToStream{Reader: bytes.NewReader([]byte("content"))}
+
+	local, remote := net.Pipe()
+	defer local.Close()
+
+	go ioutil.ReadAll(remote)
+
+	if _, err := server.sendFile(local, stream); err != nil {
+		t.Fatal("Couldn't send file:", err)
+	}
+	if !stream.used {
+		t.Fatal("WriteTo should have been used")
+	}
+}
+
+// chunkedReader returns its content in small chunks
+type chunkedReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// countingWriter counts the writes it receives
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestCopyStream(t *testing.T) {
+	content := bytes.Repeat([]byte("ftpserver"), 10000)
+	file, err := ioutil.TempFile("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create file:", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err = file.Write(content); err != nil {
+		t.Fatal("Couldn't write file:", err)
+	}
+	if _, err = file.Seek(0, 0); err != nil {
+		t.Fatal("Couldn't seek:", err)
+	}
+
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{TransferBufferSize: 1000}
+
+	// Files are io.WriterTo and buffers io.ReaderFrom, the copy still goes through the pooled buffers
+	var dst countingWriter
+	n, err := server.copyStream(&dst, file)
+	if err != nil || n != int64(len(content)) || !bytes.Equal(dst.Bytes(), content) {
+		t.Fatal("Bad copy:", n, err)
+	}
+	if expected := len(content) / 1000; dst.writes != expected {
+		t.Fatal("The copy should be done by blocks of the transfer buffers:", dst.writes, expected)
+	}
+}
+
+func TestCoalescedCopy(t *testing.T) {
+	content := bytes.Repeat([]byte("ftpserver"), 10000)
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{TransferBufferSize: 16 * 1024}
+
+	var dst countingWriter
+	n, err := server.coalescedCopy(&dst, &chunkedReader{data: content, chunk: 100})
+	if err != nil || n != int64(len(content)) || !bytes.Equal(dst.Bytes(), content) {
+		t.Fatal("Bad copy:", n, err)
+	}
+	if expected := (len(content) + 16*1024 - 1) / (16 * 1024); dst.writes != expected {
+		t.Fatal("The writes should be gathered:", dst.writes, expected)
+	}
+}
+
+// gatedWriter blocks its writes until its gate is opened
+type gatedWriter struct {
+	bytes.Buffer
+	gate chan struct{}
+	err  error
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+// countedReader counts the bytes read from its reader
+type countedReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func TestQueuedCopy(t *testing.T) {
+	content := bytes.Repeat([]byte("ftpserver"), 10000)
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{TransferBufferSize: 1024}
+
+	dst := &gatedWriter{gate: make(chan struct{})}
+	src := &countedReader{reader: bytes.NewReader(content)}
+	copied := make(chan error)
+	go func() {
+		n, err := server.queuedCopy(dst, src, 4096)
+		if err == nil && n != int64(len(content)) {
+			err = fmt.Errorf("%d bytes copied", n)
+		}
+		copied <- err
+	}()
+
+	// The reads go on while the first write is blocked, until the 4 buffers are used
+	time.Sleep(50 * time.Millisecond)
+	if read := atomic.LoadInt64(&src.read); read != 4096 {
+		t.Fatal("The reads should stop once the queue is full:", read)
+	}
+
+	close(dst.gate)
+	if err := <-copied; err != nil || !bytes.Equal(dst.Bytes(), content) {
+		t.Fatal("Bad copy:", err)
+	}
+}
+
+func TestQueuedCopyWriteError(t *testing.T) {
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{TransferBufferSize: 1024}
+
+	// The reader blocks once its first bytes are read, like a client sending slowly
+	src, client := net.Pipe()
+	defer src.Close()
+	defer client.Close()
+	go client.Write([]byte("data"))
+
+	dst := &gatedWriter{gate: make(chan struct{}), err: errors.New("backend failure")}
+	close(dst.gate)
+	if _, err := server.queuedCopy(dst, src, 4096); err != dst.err {
+		t.Fatal("The write error should be returned:", err)
+	}
+}
+
+func TestSTORQueued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), driver: &dirDriver{dir: dir},
+		path: "/", logger: nopLogger{}}
+	c.daddy.Settings = &Settings{UploadQueueSize: 64 * 1024}
+
+	content := bytes.Repeat([]byte("ftpserver"), 100000)
+	upload(c, content)
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "file")); err != nil || !bytes.Equal(data, content) {
+		t.Fatal("Bad upload:", len(data), err)
+	}
+	if reply := buf.String(); !strings.Contains(reply, "226 ") {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+}
+
+func TestTuneDataConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Couldn't listen:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Couldn't connect:", err)
+	}
+	defer conn.Close()
+
+	// Errors can't be observed, but the settings shouldn't break the connection
+	server := NewFtpServer(nil)
+	server.Settings = &Settings{DisableDataNoDelay: true, DataSocketBufferSize: 1 << 20}
+	server.tuneDataConn(conn)
+	server.tuneDataConn(tls.Client(conn, &tls.Config{}))
+	if _, err = conn.Write([]byte("data")); err != nil {
+		t.Fatal("Couldn't write:", err)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxUnsupportedCommands is the max number of distinct unsupported commands tallied by the server, the next ones
+	// are tallied as unsupportedOther
+	maxUnsupportedCommands = 200
+	// maxUnsupportedVerb is the max length of a tallied command verb
+	maxUnsupportedVerb = 16
+	// unsupportedOther gathers the commands that can't be tallied on their own: garbage verbs, or too many of them
+	unsupportedOther = "OTHER"
+)
+
+// UnsupportedCommand is the tally of a command, or a SITE subcommand, that the server received and doesn't support
+// (unknown or disabled), to see which client features the users need
+type UnsupportedCommand struct {
+	Command  string    `json:"command"`  // Command, like "XCRC" or "SITE QUOTA"
+	Count    int64     `json:"count"`    // Times it was received
+	Client   string    `json:"client"`   // Example client that sent it: the software announced with CLNT, or the address of the client
+	LastSeen time.Time `json:"lastSeen"` // Last time it was received
+}
+
+// unsupportedTally tallies the unsupported commands of a server
+type unsupportedTally struct {
+	commands map[string]*UnsupportedCommand // Tallies by command
+	mutex    sync.Mutex
+}
+
+// unsupportedVerb returns the tallied name of a command verb, unsupportedOther if it doesn't look like a command
+func unsupportedVerb(verb string) string {
+	if verb == "" || len(verb) > maxUnsupportedVerb {
+		return unsupportedOther
+	}
+	for _, r := range verb {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+			return unsupportedOther
+		}
+	}
+	return verb
+}
+
+// countUnsupportedCommand tallies an unsupported command
+func (server *FtpServer) countUnsupportedCommand(command, client string) {
+	unsupported := &server.unsupported
+	unsupported.mutex.Lock()
+	defer unsupported.mutex.Unlock()
+	if unsupported.commands == nil {
+		unsupported.commands = make(map[string]*UnsupportedCommand)
+	}
+	tally := unsupported.commands[command]
+	if tally == nil {
+		if len(unsupported.commands) >= maxUnsupportedCommands {
+			command = unsupportedOther
+			tally = unsupported.commands[command]
+		}
+		if tally == nil {
+			tally = &UnsupportedCommand{Command: command}
+			unsupported.commands[command] = tally
+		}
+	}
+	tally.Count++
+	tally.Client = client
+	tally.LastSeen = time.Now().UTC()
+}
+
+// UnsupportedCommands returns the tallies of the unsupported commands received by the server, the most frequent first
+func (server *FtpServer) UnsupportedCommands() []UnsupportedCommand {
+	unsupported := &server.unsupported
+	unsupported.mutex.Lock()
+	tallies := make([]UnsupportedCommand, 0, len(unsupported.commands))
+	for _, tally := range unsupported.commands {
+		tallies = append(tallies, *tally)
+	}
+	unsupported.mutex.Unlock()
+
+	sort.Slice(tallies, func(i, j int) bool {
+		if tallies[i].Count != tallies[j].Count {
+			return tallies[i].Count > tallies[j].Count
+		}
+		return tallies[i].Command < tallies[j].Command
+	})
+	return tallies
+}
+
+// unsupportedCommand reports an unsupported command of the session (a SITE subcommand if site is set) to the tally of
+// the server, the metrics, and the audit trail if Settings.AuditUnsupportedCommands is set
+func (c *clientHandler) unsupportedCommand(command string, site bool) {
+	if site {
+		fields := strings.Fields(c.param)
+		if len(fields) == 0 {
+			return
+		}
+		command = "SITE " + unsupportedVerb(strings.ToUpper(fields[0]))
+	} else {
+		command = unsupportedVerb(command)
+	}
+
+	client := c.ClientVersion()
+	if client == "" {
+		client, _, _ = net.SplitHostPort(c.remoteAddr)
+	}
+	c.daddy.countUnsupportedCommand(command, client)
+
+	if metrics, ok := c.daddy.Metrics.(UnsupportedCommandMetrics); ok {
+		metrics.UnsupportedCommand(command)
+	}
+	if settings := c.daddy.Settings; settings != nil && settings.AuditUnsupportedCommands {
+		c.audit(AuditUnsupportedCommand, "", command, nil)
+	}
+}
+
+// unsupportedReply returns the message of the replies to the disabled or unknown commands, the default one if the
+// setting isn't defined
+func (c *clientHandler) unsupportedReply(disabled bool) string {
+	message, setting := "Unknown command", ""
+	if disabled {
+		message = "Command disabled"
+	}
+	if settings := c.daddy.Settings; settings != nil {
+		if setting = settings.UnknownCommandMessage; disabled {
+			setting = settings.DisabledCommandMessage
+		}
+	}
+	if setting != "" {
+		return setting
+	}
+	return message
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// unsupportedMetrics keeps the unsupported commands
+type unsupportedMetrics struct {
+	Metrics
+	commands []string
+}
+
+func (m *unsupportedMetrics) UnsupportedCommand(command string) {
+	m.commands = append(m.commands, command)
+}
+
+func TestUnsupportedCommands(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var buf bytes.Buffer
+	metrics, recorder := &unsupportedMetrics{}, &auditRecorder{}
+	daddy := NewFtpServer(nil)
+	daddy.Settings = &Settings{UnknownCommandMessage: "Not supported here", AuditUnsupportedCommands: true}
+	daddy.Metrics, daddy.AuditSink = metrics, recorder
+	daddy.disabledCmds = newDisabledCommands([]string{"SITE CHMOD"})
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy, conn: conn, remoteAddr: "192.0.2.1:4242",
+		logger: nopLogger{}, clientSoft: "FileZilla"}
+
+	c.handleCommand("XCRC file\r\n")
+	if buf.String() != "500 Not supported here\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+	buf.Reset()
+	c.handleCommand("SITE chmod 644 file\r\n")
+	if buf.String() != "502 Command disabled\r\n" {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+	c.clientSoft = ""
+	c.handleCommand("XCRC other\r\n")
+	buf.Reset()
+	c.handleCommand("XCRC" + string(make([]byte, 20)) + "\r\n")
+	if buf.String() != "501 Illegal character in the command line\r\n" {
+		t.Fatalf("The line with NUL bytes should be refused before being tallied: %q", buf.String())
+	}
+	c.handleCommand("XCRC/../..\r\n")
+
+	expected := []string{"XCRC", "SITE CHMOD", "XCRC", "OTHER"}
+	if !reflect.DeepEqual(metrics.commands, expected) {
+		t.Fatal("Wrong metrics:", metrics.commands)
+	}
+	if len(recorder.events) != 4 || recorder.events[1].Type != AuditUnsupportedCommand || recorder.events[1].Target != "SITE CHMOD" {
+		t.Fatal("The unsupported commands should be audited:", len(recorder.events))
+	}
+
+	tallies := daddy.UnsupportedCommands()
+	if len(tallies) != 3 || tallies[0].Command != "XCRC" || tallies[0].Count != 2 || tallies[0].Client != "192.0.2.1" {
+		t.Fatalf("Wrong tallies: %+v", tallies)
+	}
+}
+
+func TestUnsupportedCommandsCap(t *testing.T) {
+	server := &FtpServer{}
+	for i := 0; i < maxUnsupportedCommands+10; i++ {
+		server.countUnsupportedCommand(string(rune('A'+i%26))+string(rune('A'+i/26)), "client")
+	}
+	if tallies := server.UnsupportedCommands(); len(tallies) != maxUnsupportedCommands+1 || tallies[0].Command != unsupportedOther {
+		t.Fatal("The commands beyond the cap should be tallied together:", len(tallies))
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+// uploadLockPolicy returns the Settings.UploadLockPolicy
+func (c *clientHandler) uploadLockPolicy() UploadLockPolicy {
+	if settings := c.daddy.Settings; settings != nil {
+		return settings.UploadLockPolicy
+	}
+	return UploadLockNone
+}
+
+// uploadLockKey returns the key of a file being uploaded, the users share the same tree with UploadLockShared
+func (c *clientHandler) uploadLockKey(path string) string {
+	if c.uploadLockPolicy() == UploadLockShared {
+		return path
+	}
+	return partialUploadKey(c.user, path)
+}
+
+// lockUpload registers a file being uploaded, it's refused with a 450 reply if another session is already uploading
+// it
+func (c *clientHandler) lockUpload(path string) bool {
+	if c.uploadLockPolicy() == UploadLockNone {
+		return true
+	}
+	server, key := c.daddy, c.uploadLockKey(path)
+	server.uploadsMutex.Lock()
+	defer server.uploadsMutex.Unlock()
+	if id, ok := server.uploads[key]; ok && id != c.id {
+		c.ctxRest, c.ctxAllo = 0, 0
+		c.writeMessage(450, "File is being uploaded, try again later")
+		return false
+	}
+	if server.uploads == nil {
+		server.uploads = make(map[string]uint32)
+	}
+	server.uploads[key] = c.id
+	return true
+}
+
+// unlockUpload forgets a file once its upload is over
+func (c *clientHandler) unlockUpload(path string) {
+	if c.uploadLockPolicy() == UploadLockNone {
+		return
+	}
+	server, key := c.daddy, c.uploadLockKey(path)
+	server.uploadsMutex.Lock()
+	defer server.uploadsMutex.Unlock()
+	if server.uploads[key] == c.id {
+		delete(server.uploads, key)
+	}
+}
+
+// checkUploadLock refuses the access to a file being uploaded by another session with a 450 reply, so that its
+// partial content is never downloaded, deleted nor moved
+func (c *clientHandler) checkUploadLock(path string) bool {
+	if c.uploadLockPolicy() == UploadLockNone {
+		return true
+	}
+	server := c.daddy
+	server.uploadsMutex.Lock()
+	id, ok := server.uploads[c.uploadLockKey(path)]
+	server.uploadsMutex.Unlock()
+	if !ok || id == c.id {
+		return true
+	}
+	c.ctxRest, c.ctxRang = 0, 0
+	c.writeMessage(450, "File is being uploaded, try again later")
+	return false
+}
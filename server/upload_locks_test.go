@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+// removerDriver deletes all the files
+type removerDriver struct {
+	ClientHandlingDriver
+}
+
+func (d *removerDriver) DeleteFile(cc ClientContext, path string) error {
+	return nil
+}
+
+func TestUploadLocks(t *testing.T) {
+	daddy := &FtpServer{Settings: &Settings{UploadLockPolicy: UploadLockUser}}
+	uploader := &clientHandler{daddy: daddy, id: 1, user: "john", writer: bufio.NewWriter(&bytes.Buffer{})}
+	if !uploader.lockUpload("/file") {
+		t.Fatal("The upload should be registered")
+	}
+
+	var buf bytes.Buffer
+	other := &clientHandler{writer: bufio.NewWriter(&buf), daddy: daddy, id: 2, user: "john", driver: &removerDriver{},
+		logger: nopLogger{}}
+	for _, command := range []string{"RETR /file", "STOR /file", "DELE /file", "RNFR /file",
+		"COMB /file /part", "COMB /target /part /file"} {
+		buf.Reset()
+		other.handleCommand(command + "\r\n")
+		other.waitTransfer()
+		if buf.String() != "450 File is being uploaded, try again later\r\n" {
+			t.Fatalf("%s should be refused during the upload: %q", command, buf.String())
+		}
+	}
+	if !uploader.checkUploadLock("/file") {
+		t.Fatal("The uploading session can access its file")
+	}
+
+	// The other users have their own files
+	stranger := &clientHandler{daddy: daddy, id: 3, user: "jane", writer: bufio.NewWriter(&bytes.Buffer{})}
+	if !stranger.checkUploadLock("/file") {
+		t.Fatal("The other users shouldn't be refused")
+	}
+	daddy.Settings.UploadLockPolicy = UploadLockShared
+	if uploader.unlockUpload("/file"); !uploader.lockUpload("/file") || stranger.checkUploadLock("/file") {
+		t.Fatal("The users share their files with UploadLockShared")
+	}
+
+	uploader.unlockUpload("/file")
+	buf.Reset()
+	other.handleCommand("DELE /file\r\n")
+	if buf.String() != "250 Removed file /file\r\n" {
+		t.Fatalf("The file should be available after the upload: %q", buf.String())
+	}
+}
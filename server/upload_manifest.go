@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadManifestSuffix is added to the name of an uploaded file to get the one of its manifest
+const uploadManifestSuffix = ".manifest.json"
+
+// UploadManifest is the manifest of a completed upload, written as JSON next to the file (Settings.UploadManifestSidecar)
+// or in a manifest directory (Settings.UploadManifestDir), for the pickup jobs that can't watch the files
+type UploadManifest struct {
+	Name       string    `json:"name"`        // Name of the file
+	Path       string    `json:"path"`        // Path of the file
+	Size       int64     `json:"size"`        // Number of bytes received
+	Append     bool      `json:"append"`      // The data was appended to the file (APPE)
+	Algorithm  string    `json:"algorithm"`   // Hash algorithm of the checksum
+	Checksum   string    `json:"checksum"`    // Checksum of the received data (hex)
+	User       string    `json:"user"`        // Uploader
+	RemoteAddr string    `json:"remote_addr"` // Address of the uploader
+	Time       time.Time `json:"time"`        // End of the upload
+}
+
+// uploadManifests tells if the completed uploads get a manifest
+func (c *clientHandler) uploadManifests() bool {
+	return c.daddy.Settings.UploadManifestSidecar || c.daddy.Settings.UploadManifestDir != ""
+}
+
+// isUploadManifest tells if a file is a sidecar manifest or the temporary file it is written to
+func isUploadManifest(p string) bool {
+	name := path.Base(p)
+	return strings.HasSuffix(name, uploadManifestSuffix) ||
+		(strings.HasPrefix(name, ".") && strings.HasSuffix(name, uploadManifestSuffix+".part"))
+}
+
+// checkUploadManifest refuses the changes of the clients to the sidecar manifests, which only the server writes: the
+// pickup jobs trust them to describe a completed upload
+func (c *clientHandler) checkUploadManifest(p string) bool {
+	if c.daddy.Settings == nil || !c.daddy.Settings.UploadManifestSidecar || !isUploadManifest(p) {
+		return true
+	}
+	c.writeMessage(553, fmt.Sprintf("%s is an upload manifest, only the server writes it", p))
+	return false
+}
+
+// writeUploadManifests writes the manifests of a completed upload. They are written to a temporary name first, so
+// that the pickup jobs never read a partial one. Their failures are only logged, the upload itself succeeded.
+func (c *clientHandler) writeUploadManifests(p string, size int64, append bool, algorithm string, sum []byte) {
+	if !c.uploadManifests() {
+		return
+	}
+	var data bytes.Buffer
+	err := json.NewEncoder(&data).Encode(&UploadManifest{
+		Name:       path.Base(p),
+		Path:       p,
+		Size:       size,
+		Append:     append,
+		Algorithm:  algorithm,
+		Checksum:   hex.EncodeToString(sum),
+		User:       c.User(),
+		RemoteAddr: c.remoteAddr,
+		Time:       time.Now().UTC(),
+	})
+	if err != nil {
+		c.logger.Warn("Couldn't encode the upload manifest", "path", p, "err", err)
+		return
+	}
+
+	if c.daddy.Settings.UploadManifestSidecar {
+		if err := c.writeSidecarManifest(p, data.Bytes()); err != nil {
+			c.logger.Warn("Couldn't write the upload manifest", "path", p, "err", err)
+		}
+	}
+	if dir := c.daddy.Settings.UploadManifestDir; dir != "" {
+		if err := writeManifestFile(c.manifestFileName(dir, p), data.Bytes()); err != nil {
+			c.logger.Warn("Couldn't write the upload manifest", "path", p, "dir", dir, "err", err)
+		}
+	}
+}
+
+// writeSidecarManifest writes the manifest of an upload next to it, through the driver
+func (c *clientHandler) writeSidecarManifest(p string, data []byte) error {
+	dir, name := path.Split(p)
+	tempName := path.Join(dir, "."+name+uploadManifestSuffix+".part")
+	file, err := c.driver.OpenFile(c, tempName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = c.driver.RenameFile(c, tempName, p+uploadManifestSuffix)
+	}
+	if err != nil {
+		c.driver.DeleteFile(c, tempName)
+	}
+	return err
+}
+
+// manifestFileName returns the file of the manifest of an upload in the manifest directory, which mirrors the tree of
+// each user
+func (c *clientHandler) manifestFileName(dir, p string) string {
+	user := url.PathEscape(c.User())
+	if user == "" || user == "." || user == ".." {
+		user = "_"
+	}
+	return filepath.Join(dir, user, filepath.FromSlash(p)) + uploadManifestSuffix
+}
+
+// writeManifestFile writes a manifest file in the manifest directory
+func writeManifestFile(fileName string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	tempName := fileName + ".part"
+	if err := ioutil.WriteFile(tempName, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempName, fileName)
+}
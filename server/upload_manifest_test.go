@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "home"), 0755)
+	manifests := filepath.Join(dir, "manifests")
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil), driver: &dirDriver{dir: filepath.Join(dir, "home")},
+		path: "/", user: "../bob", remoteAddr: "192.0.2.1:4242", logger: nopLogger{}}
+	c.daddy.Settings = &Settings{UploadManifestSidecar: true, UploadManifestDir: manifests}
+
+	upload(c, []byte("content"))
+	for _, fileName := range []string{
+		filepath.Join(dir, "home", "file.manifest.json"),
+		filepath.Join(manifests, "..%2Fbob", "file.manifest.json"),
+	} {
+		data, errRead := ioutil.ReadFile(fileName)
+		if errRead != nil {
+			t.Fatal("The manifest should be written:", errRead)
+		}
+		manifest := &UploadManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			t.Fatal("Bad manifest:", err)
+		}
+		if manifest.Name != "file" || manifest.Path != "/file" || manifest.Size != 7 || manifest.User != "../bob" ||
+			manifest.Algorithm != "sha256" || len(manifest.Checksum) != 64 || manifest.RemoteAddr != "192.0.2.1:4242" {
+			t.Fatalf("Wrong manifest: %+v", manifest)
+		}
+	}
+
+	// The temporary files are gone
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "home"))
+	if len(files) != 2 {
+		t.Fatal("Only the file and its manifest should remain:", len(files))
+	}
+
+	// Only the server writes the sidecar manifests
+	for _, command := range []struct{ name, param string }{
+		{"STOR", "other.manifest.json"},
+		{"APPE", ".other.manifest.json.part"},
+		{"DELE", "file.manifest.json"},
+		{"RNFR", "file.manifest.json"},
+		{"SITE", "COMBINE file.manifest.json file"},
+		{"SITE", "COMBINE other file.manifest.json"},
+	} {
+		buf.Reset()
+		c.command, c.param = command.name, command.param
+		c.ctxRnfr = ""
+		commandsMap[command.name].Fn(c)
+		c.writer.Flush()
+		if !strings.HasPrefix(buf.String(), "553 ") {
+			t.Fatalf("%s %s should be refused: %s", command.name, command.param, buf.String())
+		}
+	}
+	buf.Reset()
+	c.command, c.param, c.ctxRnfr = "RNTO", "other.manifest.json", "/file"
+	c.handleRNTO()
+	c.writer.Flush()
+	if !strings.HasPrefix(buf.String(), "553 ") {
+		t.Fatal("The renames to a manifest should be refused:", buf.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "home", "file.manifest.json")); err != nil {
+		t.Fatal("The manifest should remain:", err)
+	}
+
+	// Nor are their facts modified
+	driver := &factsRecorder{}
+	c.driver = driver
+	for _, command := range []struct{ name, param string }{
+		{"SITE", "CHMOD 600 file.manifest.json"},
+		{"SITE", "UTIME 20060102150405 file.manifest.json"},
+		{"MFF", "UNIX.mode=0600; file.manifest.json"},
+		{"MFCT", "20060102150405 file.manifest.json"},
+	} {
+		buf.Reset()
+		c.command, c.param = command.name, command.param
+		commandsMap[command.name].Fn(c)
+		c.writer.Flush()
+		if !strings.HasPrefix(buf.String(), "553 ") {
+			t.Fatalf("%s %s should be refused: %s", command.name, command.param, buf.String())
+		}
+	}
+	if driver.mode != 0 || !driver.mtime.IsZero() || !driver.ctime.IsZero() {
+		t.Fatal("The manifest shouldn't be modified:", driver)
+	}
+}
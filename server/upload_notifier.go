@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// UploadEvent describes a successful upload
+type UploadEvent struct {
+	Time       time.Time     // End of the upload
+	SessionID  uint32        // ID of the client session
+	SessionUID string        // Unique ID of the client session
+	User       string        // User, as given by the client
+	RemoteAddr string        // Address of the client
+	Path       string        // Path of the file
+	Size       int64         // Number of bytes received
+	Append     bool          // The data was appended to the file (APPE)
+	Algorithm  string        // Hash algorithm of the checksum
+	Checksum   string        // Checksum of the received data (hex), sha256 unless Settings.UploadHashAlgorithm is set
+	Duration   time.Duration // Duration of the transfer
+}
+
+// UploadNotifier is notified of the successful uploads, so that other systems can react to them without polling
+type UploadNotifier interface {
+	// UploadSucceeded is called after each successful STOR or APPE, it shouldn't block
+	UploadSucceeded(event *UploadEvent)
+}
+
+// uploadHashAlgorithm returns the hash algorithm of the uploads, the notifier, the manifests and the
+// UploadDeduplicator need a checksum
+func (c *clientHandler) uploadHashAlgorithm() string {
+	if algorithm := c.daddy.Settings.UploadHashAlgorithm; algorithm != "" {
+		return algorithm
+	}
+	if _, dedup := c.driver.(UploadDeduplicator); dedup || c.daddy.UploadNotifier != nil || c.uploadManifests() {
+		return "sha256"
+	}
+	return ""
+}
+
+// notifyUpload reports a successful upload to the notifier
+func (c *clientHandler) notifyUpload(path string, size int64, append bool, algorithm string, sum []byte,
+	duration time.Duration) {
+	notifier := c.daddy.UploadNotifier
+	if notifier == nil {
+		return
+	}
+	notifier.UploadSucceeded(&UploadEvent{
+		Time:       time.Now(),
+		SessionID:  c.id,
+		SessionUID: c.uid,
+		User:       c.User(),
+		RemoteAddr: c.conn.RemoteAddr().String(),
+		Path:       path,
+		Size:       size,
+		Append:     append,
+		Algorithm:  algorithm,
+		Checksum:   hex.EncodeToString(sum),
+		Duration:   duration,
+	})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+// uploadRecorder keeps the notified uploads
+type uploadRecorder struct {
+	events []*UploadEvent
+}
+
+func (r *uploadRecorder) UploadSucceeded(event *UploadEvent) {
+	r.events = append(r.events, event)
+}
+
+func TestNotifyUpload(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	c := &clientHandler{daddy: &FtpServer{Settings: &Settings{}}, conn: conn}
+	if algorithm := c.uploadHashAlgorithm(); algorithm != "" {
+		t.Fatal("Nothing should be hashed without a notifier:", algorithm)
+	}
+
+	recorder := &uploadRecorder{}
+	c.daddy.UploadNotifier = recorder
+	if algorithm := c.uploadHashAlgorithm(); algorithm != "sha256" {
+		t.Fatal("The notifier needs a checksum:", algorithm)
+	}
+	c.daddy.Settings.UploadHashAlgorithm = "md5"
+	if algorithm := c.uploadHashAlgorithm(); algorithm != "md5" {
+		t.Fatal("The configured algorithm should be kept:", algorithm)
+	}
+
+	c.setUser("alice")
+	c.notifyUpload("/file", 10, true, "md5", []byte{0xab, 0xcd}, 0)
+	if len(recorder.events) != 1 {
+		t.Fatal("The upload should have been notified")
+	}
+	if e := recorder.events[0]; e.User != "alice" || e.Path != "/file" || e.Size != 10 || !e.Append ||
+		e.Checksum != "abcd" {
+		t.Fatal("Bad event:", e)
+	}
+}
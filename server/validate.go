@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ConfigError is returned by Validate and Listen when the settings can't work, with all the problems found
+type ConfigError struct {
+	Problems []string // Problems of the configuration, each naming the setting to fix
+}
+
+func (e *ConfigError) Error() string {
+	return "bad configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// applySettingsDefaults replaces the zero values of the settings by their defaults
+func applySettingsDefaults(s *Settings) {
+	if s.ListenHost == "" {
+		s.ListenHost = "0.0.0.0"
+	}
+
+	if s.ListenPort == 0 { // For the default value (0)
+		// We take the default port (2121)
+		s.ListenPort = 2121
+	} else if s.ListenPort == -1 { // For the automatic value
+		// We let the system decide (0)
+		s.ListenPort = 0
+	}
+	if s.MaxConnections == 0 {
+		s.MaxConnections = 10000
+	}
+}
+
+// validPort tells if a port can be listened on and advertised
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// checkSettings returns the problems of the settings that would only show on the first connections: the ports, the
+// data source and the upload hash. The defaults must have been applied.
+func checkSettings(s *Settings) []string {
+	var problems []string
+	if s.ListenPort < 0 || s.ListenPort > 65535 {
+		problems = append(problems, fmt.Sprintf("ListenPort %d is out of the 1-65535 range (-1 for any port)",
+			s.ListenPort))
+	}
+
+	var passive []int
+	if r := s.DataPortRange; r != nil {
+		switch {
+		case !validPort(r.Start) || !validPort(r.End):
+			problems = append(problems, fmt.Sprintf("DataPortRange %d-%d is out of the 1-65535 range", r.Start, r.End))
+		case r.Start > r.End:
+			problems = append(problems, fmt.Sprintf("DataPortRange %d-%d starts after its end", r.Start, r.End))
+		default:
+			passive = []int{r.Start, r.End}
+		}
+	}
+	if len(s.PassivePorts) > 0 {
+		passive = nil
+		seen := make(map[int]bool, len(s.PassivePorts))
+		for _, port := range s.PassivePorts {
+			if !validPort(port) {
+				problems = append(problems, fmt.Sprintf("PassivePorts: %d is out of the 1-65535 range", port))
+			} else if seen[port] {
+				problems = append(problems, fmt.Sprintf("PassivePorts: %d is listed twice", port))
+			} else {
+				passive = append(passive, port)
+			}
+			seen[port] = true
+		}
+	}
+
+	// The ports advertised through the NAT must exist too, and the control port can't be used for the data
+	for _, port := range passive {
+		if s.PassivePortOffset != 0 && !validPort(port+s.PassivePortOffset) {
+			problems = append(problems, fmt.Sprintf(
+				"PassivePortOffset %d advertises the passive port %d as %d, out of the 1-65535 range",
+				s.PassivePortOffset, port, port+s.PassivePortOffset))
+			break
+		}
+	}
+	if s.ListenPort != 0 && len(passive) > 0 {
+		overlaps := false
+		if len(s.PassivePorts) > 0 {
+			for _, port := range passive {
+				overlaps = overlaps || port == s.ListenPort
+			}
+		} else {
+			overlaps = s.ListenPort >= passive[0] && s.ListenPort <= passive[1]
+		}
+		if overlaps {
+			problems = append(problems, fmt.Sprintf("ListenPort %d is one of the passive ports", s.ListenPort))
+		}
+	}
+
+	if source := s.DataSourceAddr; source != "" && net.ParseIP(source) == nil {
+		if _, err := net.InterfaceByName(source); err != nil {
+			problems = append(problems, fmt.Sprintf("DataSourceAddr %q is neither an IP nor a network interface: %v",
+				source, err))
+		}
+	}
+	if _, err := newUploadHash(s.UploadHashAlgorithm); err != nil {
+		problems = append(problems, fmt.Sprintf("UploadHashAlgorithm: %v (sha256 or md5)", err))
+	}
+	for _, endpoint := range []struct{ name, address string }{
+		{"HealthListenAddr", s.HealthListenAddr},
+		{"DebugListenAddr", s.DebugListenAddr},
+	} {
+		if _, _, err := net.SplitHostPort(endpoint.address); endpoint.address != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q isn't a host:port address: %v", endpoint.name,
+				endpoint.address, err))
+		}
+	}
+	return problems
+}
+
+// Validate checks the driver and its settings without listening, for a dry run of the configuration before starting
+// the server or reloading it. On top of the checks of Listen, it compiles the policies, loads the banner and the TLS
+// config of the driver when TLS is required, and resolves the PublicHost. It returns a
+// *ConfigError with all the problems found.
+func (server *FtpServer) Validate() error {
+	if server.driver == nil {
+		return &ConfigError{Problems: []string{"no MainDriver was given to NewFtpServer"}}
+	}
+	settings := server.driver.GetSettings()
+	if settings == nil {
+		return &ConfigError{Problems: []string{"GetSettings of the driver returned no settings"}}
+	}
+
+	// The settings of the driver are left untouched, Listen applies the defaults itself
+	s := *settings
+	applySettingsDefaults(&s)
+	problems := checkSettings(&s)
+
+	if _, err := newFileNameChecker(s.FileNamePolicy); err != nil {
+		problems = append(problems, fmt.Sprintf("FileNamePolicy: %v", err))
+	}
+	if _, err := newBandwidthSchedule(s.BandwidthSchedule); err != nil {
+		problems = append(problems, fmt.Sprintf("BandwidthSchedule: %v", err))
+	}
+	if _, err := loadBanner(&s); err != nil {
+		problems = append(problems, fmt.Sprintf("BannerFile: %v", err))
+	}
+
+	if s.TLSRequired || s.ProtectedDataRequired || s.TLSSessionReuseRequired {
+		if config, err := server.driver.GetTLSConfig(); err != nil || config == nil {
+			problems = append(problems, fmt.Sprintf(
+				"TLSRequired, ProtectedDataRequired or TLSSessionReuseRequired need the TLS config of the driver: %v",
+				err))
+		}
+	}
+
+	if host := s.PublicHost; host != "" && net.ParseIP(host) == nil {
+		ips, err := lookupIP(host)
+		hasIPv4 := false
+		for _, ip := range ips {
+			hasIPv4 = hasIPv4 || ip.To4() != nil
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("PublicHost %q can't be resolved: %v", host, err))
+		} else if !hasIPv4 {
+			problems = append(problems, fmt.Sprintf("PublicHost %q has no IPv4 address for the PASV replies", host))
+		}
+	}
+
+	// The manifest directory is created with the first manifest, but it can't be a file
+	if dir := s.UploadManifestDir; dir != "" {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("UploadManifestDir %s isn't a directory", dir))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// settingsDriver provides some settings, and a TLS config if it's set
+type settingsDriver struct {
+	tlsDriver
+	settings *Settings
+}
+
+func (d *settingsDriver) GetSettings() *Settings {
+	return d.settings
+}
+
+func TestValidate(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "ftp.example.com" {
+			return []net.IP{net.ParseIP("203.0.113.1")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	settings := &Settings{ListenPort: -1, DataPortRange: &PortRange{Start: 2122, End: 2200}, PublicHost: "ftp.example.com"}
+	server := NewFtpServer(&settingsDriver{settings: settings})
+	if err := server.Validate(); err != nil {
+		t.Fatal("The settings should be valid:", err)
+	}
+	if settings.ListenPort != -1 {
+		t.Fatal("The settings of the driver shouldn't be changed:", settings.ListenPort)
+	}
+
+	settings.ListenPort = 2150
+	settings.DataPortRange = &PortRange{Start: 2200, End: 2100}
+	settings.PassivePorts = []int{2150, 2151, 2151, 70000}
+	settings.PassivePortOffset = 64000
+	settings.PublicHost = "unknown.example.com"
+	settings.UploadHashAlgorithm = "crc32"
+	settings.DebugListenAddr = "localhost"
+	settings.TLSRequired = true
+	err := server.Validate()
+	problems := []string{
+		"DataPortRange 2200-2100 starts after its end",
+		"PassivePorts: 2151 is listed twice",
+		"PassivePorts: 70000 is out of the 1-65535 range",
+		"PassivePortOffset 64000 advertises the passive port 2150 as 66150",
+		"ListenPort 2150 is one of the passive ports",
+		"UploadHashAlgorithm: unknown hash algorithm: crc32",
+		"DebugListenAddr \"localhost\" isn't a host:port address",
+		"TLSRequired, ProtectedDataRequired or TLSSessionReuseRequired need the TLS config",
+		"PublicHost \"unknown.example.com\" can't be resolved",
+	}
+	configErr, ok := err.(*ConfigError)
+	if !ok || len(configErr.Problems) != len(problems) {
+		t.Fatal("Wrong problems:", err)
+	}
+	for i, problem := range problems {
+		if !strings.HasPrefix(configErr.Problems[i], problem) {
+			t.Fatalf("Wrong problem %d: %q", i, configErr.Problems[i])
+		}
+	}
+
+	// Listen refuses the settings that would fail on the first connections
+	settings.PublicHost, settings.TLSRequired = "", false
+	if err := server.Listen(); err == nil || server.Listener != nil {
+		t.Fatal("The server shouldn't listen:", err)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// VirtualEntry is a file or a directory served by the server on behalf of the driver, which doesn't have it in its
+// storage: a report generated on the fly, a README dropped in every home...
+type VirtualEntry struct {
+	Path    string                                     // Absolute path of the entry, in a directory of the driver or a virtual one
+	Size    int64                                      // Size of the file, as listed
+	Mode    os.FileMode                                // Permissions of the entry, with os.ModeDir for the directories
+	ModTime time.Time                                  // Modification time (the time of the listing if zero)
+	Open    func(cc ClientContext) (FileStream, error) // Provides the content of the file, which is read-only
+}
+
+// VirtualEntryProvider can be implemented by a ClientHandlingDriver to add some virtual entries to its tree. The
+// server merges them into the listings (replacing the files of the driver with the same name), enters their
+// directories without calling ChangeDirectory, answers SIZE, MDTM and STAT from them, and opens their files with
+// their content provider instead of OpenFile.
+type VirtualEntryProvider interface {
+	// VirtualEntries returns the virtual entries of the session, it's called on each access
+	VirtualEntries(cc ClientContext) []*VirtualEntry
+}
+
+// virtualFileInfo is the os.FileInfo of a virtual entry
+type virtualFileInfo struct {
+	entry *VirtualEntry
+}
+
+func (f virtualFileInfo) Name() string      { return path.Base(f.entry.Path) }
+func (f virtualFileInfo) Size() int64       { return f.entry.Size }
+func (f virtualFileInfo) Mode() os.FileMode { return f.entry.Mode }
+func (f virtualFileInfo) IsDir() bool       { return f.entry.Mode.IsDir() }
+func (f virtualFileInfo) Sys() interface{}  { return nil }
+func (f virtualFileInfo) ModTime() time.Time {
+	if f.entry.ModTime.IsZero() {
+		return time.Now().UTC()
+	}
+	return f.entry.ModTime
+}
+
+// virtualEntries returns the virtual entries of the driver by path, nil if it has none
+func (c *clientHandler) virtualEntries() map[string]*VirtualEntry {
+	provider, ok := c.driver.(VirtualEntryProvider)
+	if !ok {
+		return nil
+	}
+	list := provider.VirtualEntries(c)
+	if len(list) == 0 {
+		return nil
+	}
+
+	entries := make(map[string]*VirtualEntry, len(list))
+	for _, entry := range list {
+		entries[path.Clean(entry.Path)] = entry
+	}
+	return entries
+}
+
+// virtualEntry returns the virtual entry of a path, nil if it isn't one
+func (c *clientHandler) virtualEntry(p string) *VirtualEntry {
+	return c.virtualEntries()[path.Clean(p)]
+}
+
+// isVirtualDir tells if a path is a virtual directory, unknown to the driver
+func (c *clientHandler) isVirtualDir(p string) bool {
+	entry := c.virtualEntry(p)
+	return entry != nil && entry.Mode.IsDir()
+}
+
+// virtualListing is the virtual part of the listing of a directory
+type virtualListing struct {
+	files     []os.FileInfo   // Virtual entries of the directory
+	names     map[string]bool // Names of the virtual entries, hiding the files of the driver
+	directory bool            // The directory itself is virtual, the driver isn't asked for its files
+}
+
+// shadows tells if a file of the driver is replaced by a virtual entry
+func (l *virtualListing) shadows(file os.FileInfo) bool {
+	return l.names[file.Name()]
+}
+
+// virtualListing returns the virtual entries of the current directory
+func (c *clientHandler) virtualListing() *virtualListing {
+	listing := &virtualListing{}
+	entries := c.virtualEntries()
+	if entries == nil {
+		return listing
+	}
+
+	dir := path.Clean(c.Path())
+	if entry := entries[dir]; entry != nil && entry.Mode.IsDir() {
+		listing.directory = true
+	}
+	listing.names = make(map[string]bool)
+	for p, entry := range entries {
+		if p != "/" && path.Dir(p) == dir {
+			info := virtualFileInfo{entry: entry}
+			listing.files = append(listing.files, info)
+			listing.names[info.Name()] = true
+		}
+	}
+	sort.Slice(listing.files, func(i, j int) bool { return listing.files[i].Name() < listing.files[j].Name() })
+	return listing
+}
+
+// changeDirectory enters a directory, the driver isn't asked for the virtual ones
+func (c *clientHandler) changeDirectory(p string) error {
+	if c.isVirtualDir(p) {
+		return nil
+	}
+	return c.driver.ChangeDirectory(c, p)
+}
+
+// getFileInfo returns the info of a file, from its virtual entry if it's one
+func (c *clientHandler) getFileInfo(p string) (os.FileInfo, error) {
+	if entry := c.virtualEntry(p); entry != nil {
+		return virtualFileInfo{entry: entry}, nil
+	}
+	return c.driver.GetFileInfo(c, p)
+}
+
+// openVirtual opens a virtual file with its content provider, ok is false if the path isn't one
+func (c *clientHandler) openVirtual(p string, flag int) (file FileStream, ok bool, err error) {
+	entry := c.virtualEntry(p)
+	if entry == nil {
+		return nil, false, nil
+	}
+	if entry.Mode.IsDir() || entry.Open == nil || flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, true, ErrPermissionDenied
+	}
+	file, err = entry.Open(c)
+	return file, true, err
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// virtualDriver adds a virtual directory and a virtual README to a local directory
+type virtualDriver struct {
+	dirDriver
+}
+
+func (d *virtualDriver) VirtualEntries(cc ClientContext) []*VirtualEntry {
+	readme := func(cc ClientContext) (FileStream, error) {
+		return os.Open(filepath.Join(d.dir, ".readme"))
+	}
+	return []*VirtualEntry{
+		{Path: "/README", Size: 6, Mode: 0444, Open: readme},
+		{Path: "/reports", Mode: os.ModeDir | 0555},
+		{Path: "/reports/today.csv", Size: 6, Mode: 0444, Open: readme},
+	}
+}
+
+func TestVirtualEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"file": "data", "README": "hidden", ".readme": "virtual"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	var buf bytes.Buffer
+	c := &clientHandler{writer: bufio.NewWriter(&buf), daddy: NewFtpServer(nil),
+		driver: &virtualDriver{dirDriver{dir: dir}}, path: "/", logger: nopLogger{}}
+	c.daddy.Settings = &Settings{}
+
+	// The virtual README replaces the one of the driver
+	if names := list(c); !reflect.DeepEqual(names, []string{".readme", "file", "README", "reports"}) {
+		t.Fatal("Wrong listing:", names)
+	}
+
+	buf.Reset()
+	c.handleCommand("CWD /reports\r\n")
+	if c.Path() != "/reports" {
+		t.Fatalf("The virtual directory should be entered: %q", buf.String())
+	}
+	if names := list(c); !reflect.DeepEqual(names, []string{"today.csv"}) {
+		t.Fatal("Wrong virtual listing:", names)
+	}
+
+	buf.Reset()
+	c.handleCommand("SIZE today.csv\r\n")
+	if reply := buf.String(); reply != "213 6\r\n" {
+		t.Fatalf("Wrong reply: %q", reply)
+	}
+
+	server, client := net.Pipe()
+	c.transfer = &pipeTransfer{conn: server}
+	received := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		received <- data
+	}()
+	buf.Reset()
+	c.param = "/README"
+	c.handleRETR()
+	if data := <-received; string(data) != "virtual" || !strings.Contains(buf.String(), "226 ") {
+		t.Fatalf("The content provider should be read: %q, %q", data, buf.String())
+	}
+
+	if _, err := c.openTransfer("/README", os.O_WRONLY); err != ErrPermissionDenied {
+		t.Fatal("The virtual files should be read-only:", err)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WORMPolicy makes some files write-once-read-many: once uploaded, they can't be overwritten, appended to, renamed,
+// deleted nor have their times changed until their retention expires. The retention starts at the last modification
+// of the files.
+type WORMPolicy struct {
+	Directories []string // Protected directories, with their subdirectories (the whole tree if empty)
+	Retention   int      // Seconds the files are protected after their upload (forever if 0)
+}
+
+// covers tells if a path is in one of the protected directories
+func (p *WORMPolicy) covers(filePath string) bool {
+	if len(p.Directories) == 0 {
+		return true
+	}
+	for _, dir := range p.Directories {
+		if isSubPath(path.Clean("/"+dir), filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// holds tells if a directory holds some protected directories, or is one of them
+func (p *WORMPolicy) holds(dirPath string) bool {
+	if len(p.Directories) == 0 {
+		return true
+	}
+	for _, dir := range p.Directories {
+		dir = path.Clean("/" + dir)
+		if isSubPath(dirPath, dir) || isSubPath(dir, dirPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedUntil returns the end of the retention of a file, and if it's still protected. The zero time is returned
+// for the files protected forever.
+func (p *WORMPolicy) protectedUntil(filePath string, info os.FileInfo) (time.Time, bool) {
+	if info.IsDir() || !p.covers(filePath) {
+		return time.Time{}, false
+	}
+	if p.Retention <= 0 {
+		return time.Time{}, true
+	}
+	until := info.ModTime().Add(time.Duration(p.Retention) * time.Second)
+	return until, time.Now().Before(until)
+}
+
+// isSubPath tells if a path is a directory or one of its descendants
+func isSubPath(dir, filePath string) bool {
+	return dir == "/" || filePath == dir || strings.HasPrefix(filePath, dir+"/")
+}
+
+// refuseWORM audits and refuses an action on a protected file
+func (c *clientHandler) refuseWORM(filePath, message string) {
+	c.audit(AuditWORMViolation, filePath, "", nil)
+	if c.LogVerbosity() >= LogCommands {
+		c.logger.Debug("WORM violation", logKeyAction, "ftp.worm_violation", "path", filePath)
+	}
+	c.writeMessage(550, message)
+}
+
+// checkWORM refuses the modifications of a file protected by the WORM policy of the session, the missing files can
+// be written
+func (c *clientHandler) checkWORM(filePath string) bool {
+	policy := c.session.WORMPolicy
+	if policy == nil || !policy.covers(filePath) {
+		return true
+	}
+	info, err := c.driver.GetFileInfo(c, filePath)
+	if err != nil {
+		return true
+	}
+	return c.checkWORMInfo(filePath, info)
+}
+
+// checkWORMInfo is checkWORM for a file whose info is known. The directories holding some protected directories
+// can't be renamed either.
+func (c *clientHandler) checkWORMInfo(filePath string, info os.FileInfo) bool {
+	policy := c.session.WORMPolicy
+	if policy == nil {
+		return true
+	}
+	if info.IsDir() {
+		if c.command != "RNFR" || !policy.holds(filePath) {
+			return true
+		}
+		c.refuseWORM(filePath, fmt.Sprintf("%s holds write-once files and can't be renamed", filePath))
+		return false
+	}
+	until, protected := policy.protectedUntil(filePath, info)
+	if !protected {
+		return true
+	}
+	if until.IsZero() {
+		c.refuseWORM(filePath, fmt.Sprintf("%s is a write-once file", filePath))
+	} else {
+		c.refuseWORM(filePath, fmt.Sprintf("%s is a write-once file until %s", filePath,
+			until.UTC().Format(time.RFC3339)))
+	}
+	return false
+}
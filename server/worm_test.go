@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statDirDriver is a dirDriver giving the info of its files
+type statDirDriver struct {
+	dirDriver
+}
+
+func (d *statDirDriver) GetFileInfo(cc ClientContext, path string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(d.dir, path))
+}
+
+func TestWORMPolicy(t *testing.T) {
+	policy := &WORMPolicy{Directories: []string{"/archive"}, Retention: 3600}
+	for p, covered := range map[string]bool{"/archive": true, "/archive/a/b": true, "/archived": false, "/": false} {
+		if policy.covers(p) != covered {
+			t.Fatal("Bad coverage of", p)
+		}
+	}
+	for p, holds := range map[string]bool{"/": true, "/archive/a": true, "/other": false} {
+		if policy.holds(p) != holds {
+			t.Fatal("Bad holding of", p)
+		}
+	}
+}
+
+func TestWORM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpserver")
+	if err != nil {
+		t.Fatal("Couldn't create dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"archive/recent", "archive/old", "other"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal("Couldn't write the file:", err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "archive", "old"), old, old)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	var buf bytes.Buffer
+	sink := &auditRecorder{}
+	c := &clientHandler{writer: bufio.NewWriter(&buf), conn: conn, logger: nopLogger{}, path: "/",
+		daddy:  &FtpServer{Settings: &Settings{}, AuditSink: sink},
+		driver: &statDirDriver{dirDriver{dir: dir}}}
+	c.session.WORMPolicy = &WORMPolicy{Directories: []string{"/archive"}, Retention: 3600}
+
+	for _, command := range []string{"DELE /archive/recent", "RNFR /archive/recent", "RNFR /archive", "STOR /archive/recent",
+		"APPE /archive/recent"} {
+		buf.Reset()
+		c.handleCommand(command + "\r\n")
+		c.waitTransfer()
+		if reply := buf.String(); !strings.HasPrefix(reply, "550 ") {
+			t.Fatalf("%s should be refused: %q", command, reply)
+		}
+	}
+	if len(sink.events) != 5 || sink.events[0].Type != AuditWORMViolation || sink.events[0].Path != "/archive/recent" {
+		t.Fatal("The violations should be audited:", len(sink.events))
+	}
+
+	buf.Reset()
+	c.handleCommand("RNFR /other\r\n")
+	c.handleCommand("RNTO /archive/recent\r\n")
+	if expected := "350 Sure, give me a target\r\n550 /archive/recent is a write-once file until "; !strings.HasPrefix(buf.String(), expected) {
+		t.Fatalf("A protected file can't be replaced: %q", buf.String())
+	}
+
+	// The expired and the unprotected files can be deleted
+	buf.Reset()
+	c.handleCommand("DELE /archive/old\r\n")
+	c.handleCommand("DELE /other\r\n")
+	if expected := "250 Removed file /archive/old\r\n250 Removed file /other\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong replies: %q", buf.String())
+	}
+
+	// Forever
+	c.session.WORMPolicy = &WORMPolicy{}
+	buf.Reset()
+	c.handleCommand("DELE /archive/recent\r\n")
+	if expected := "550 /archive/recent is a write-once file\r\n"; buf.String() != expected {
+		t.Fatalf("Wrong reply: %q", buf.String())
+	}
+}
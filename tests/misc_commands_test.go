@@ -40,3 +40,39 @@ func TestSiteCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestDataProtectionOrdering(t *testing.T) {
+	s := NewTestServer(true)
+	defer s.Stop()
+
+	conf := goftp.Config{
+		User:     "test",
+		Password: "test",
+	}
+
+	var err error
+	var c *goftp.Client
+
+	if c, err = goftp.DialConfig(conf, s.Listener.Addr().String()); err != nil {
+		t.Fatal("Couldn't connect", err)
+	}
+	defer c.Close()
+
+	var raw goftp.RawConn
+
+	if raw, err = c.OpenRawConn(); err != nil {
+		t.Fatal("Couldn't open raw connection")
+	}
+
+	if rc, _, err := raw.SendCommand("PBSZ 0"); err != nil {
+		t.Fatal("Command not accepted", err)
+	} else if rc != 503 {
+		t.Fatal("PBSZ should require AUTH first", rc)
+	}
+
+	if rc, _, err := raw.SendCommand("PROT P"); err != nil {
+		t.Fatal("Command not accepted", err)
+	} else if rc != 503 {
+		t.Fatal("PROT should require PBSZ first", rc)
+	}
+}
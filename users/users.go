@@ -0,0 +1,291 @@
+// Package users stores the virtual users of the vusers driver in an SQL database (SQLite, PostgreSQL or MySQL,
+// through any database/sql driver), with the helpers to manage them: the accounts can be created, changed, disabled
+// and deleted while the server is running. A Store is a vusers.Database, so it's plugged in the authentication of the
+// vusers.MainDriver:
+//
+//	store := users.New(db, users.Postgres, &users.Options{CacheTTL: time.Minute})
+//	driver := &vusers.MainDriver{Database: store}
+//
+// The users are cached for Options.CacheTTL, the changes made through the Store apply immediately while the ones
+// made directly in the database apply once the cached users expire.
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fclairamb/ftpserver/credentials"
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+)
+
+// Dialect is the flavor of SQL of a database
+type Dialect int
+
+// These are the supported dialects
+const (
+	SQLite   Dialect = iota // SQLite, "?" placeholders
+	Postgres                // PostgreSQL, "$1" placeholders
+	MySQL                   // MySQL and MariaDB, "?" placeholders
+)
+
+// Schemas create the users table in each dialect, it has the columns read by vusers.SQLDatabase
+var Schemas = map[Dialect]string{
+	SQLite: `CREATE TABLE IF NOT EXISTS users (
+	name TEXT PRIMARY KEY,
+	password TEXT NOT NULL,
+	home TEXT NOT NULL,
+	permissions TEXT NOT NULL DEFAULT '',
+	quota INTEGER NOT NULL DEFAULT 0,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+	Postgres: `CREATE TABLE IF NOT EXISTS users (
+	name VARCHAR(255) PRIMARY KEY,
+	password TEXT NOT NULL,
+	home TEXT NOT NULL,
+	permissions VARCHAR(16) NOT NULL DEFAULT '',
+	quota BIGINT NOT NULL DEFAULT 0,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+	MySQL: `CREATE TABLE IF NOT EXISTS users (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	password VARCHAR(512) NOT NULL,
+	home VARCHAR(4096) NOT NULL,
+	permissions VARCHAR(16) NOT NULL DEFAULT '',
+	quota BIGINT NOT NULL DEFAULT 0,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE
+)`,
+}
+
+// The queries of the store, written with "?" placeholders
+const (
+	queryUser     = vusers.DefaultSQLQuery
+	queryUsers    = "SELECT name, password, home, permissions, quota, disabled FROM users ORDER BY name"
+	queryInsert   = "INSERT INTO users (name, password, home, permissions, quota, disabled) VALUES (?, ?, ?, ?, ?, ?)"
+	queryUpdate   = "UPDATE users SET password = ?, home = ?, permissions = ?, quota = ?, disabled = ? WHERE name = ?"
+	queryPassword = "UPDATE users SET password = ? WHERE name = ?"
+	queryDisabled = "UPDATE users SET disabled = ? WHERE name = ?"
+	queryDelete   = "DELETE FROM users WHERE name = ?"
+)
+
+var (
+	// ErrUserExists is returned when a user is created with the name of an existing one
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrUserNotFound is returned when a missing user is changed or deleted
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrInvalidUser is returned for the users without a name or a home
+	ErrInvalidUser = errors.New("users must have a name and a home")
+)
+
+// Options are the options of a Store
+type Options struct {
+	CacheTTL time.Duration // How long the users and the missing users are cached (not cached if 0)
+}
+
+// cachedUser is a user of the cache, nil for a missing user
+type cachedUser struct {
+	user    *vusers.User
+	expires time.Time
+}
+
+// Store is a database of users stored in the users table of an SQL database
+type Store struct {
+	db      *sql.DB                // Database
+	dialect Dialect                // Flavor of SQL of the database
+	options Options                // Options
+	queries map[string]string      // Queries in the dialect, by their "?" version
+	cache   map[string]*cachedUser // Users looked up, by name
+	mutex   sync.Mutex             // Cache sync
+}
+
+// New creates a store on a database, opened with the database/sql driver of its dialect
+func New(db *sql.DB, dialect Dialect, options *Options) *Store {
+	store := &Store{db: db, dialect: dialect, queries: make(map[string]string), cache: make(map[string]*cachedUser)}
+	if options != nil {
+		store.options = *options
+	}
+	for _, query := range []string{queryUser, queryUsers, queryInsert, queryUpdate, queryPassword, queryDisabled,
+		queryDelete} {
+		store.queries[query] = rebind(query, dialect)
+	}
+	return store
+}
+
+// rebind writes the placeholders of a query in a dialect
+func rebind(query string, dialect Dialect) string {
+	if dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// CreateSchema creates the users table if it doesn't exist
+func (store *Store) CreateSchema() error {
+	schema, ok := Schemas[store.dialect]
+	if !ok {
+		return fmt.Errorf("unknown SQL dialect %d", store.dialect)
+	}
+	_, err := store.db.Exec(schema)
+	return err
+}
+
+// User returns a user by name, nil if it doesn't exist
+func (store *Store) User(name string) (*vusers.User, error) {
+	if store.options.CacheTTL > 0 {
+		store.mutex.Lock()
+		cached, ok := store.cache[name]
+		store.mutex.Unlock()
+		if ok && time.Now().Before(cached.expires) {
+			return cached.user, nil
+		}
+	}
+
+	user, err := store.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if store.options.CacheTTL > 0 {
+		store.mutex.Lock()
+		store.cache[name] = &cachedUser{user: user, expires: time.Now().Add(store.options.CacheTTL)}
+		store.mutex.Unlock()
+	}
+	return user, nil
+}
+
+// lookup reads a user from the database, nil if it doesn't exist
+func (store *Store) lookup(name string) (*vusers.User, error) {
+	user := &vusers.User{Name: name}
+	var permissions sql.NullString
+	var quota sql.NullInt64
+	var disabled sql.NullBool
+
+	err := store.db.QueryRow(store.queries[queryUser], name).Scan(&user.Password, &user.Home, &permissions, &quota,
+		&disabled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.Permissions = permissions.String
+	user.Quota = quota.Int64
+	user.Disabled = disabled.Bool
+	return user, nil
+}
+
+// Users returns all the users, by name
+func (store *Store) Users() ([]*vusers.User, error) {
+	rows, err := store.db.Query(store.queries[queryUsers])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*vusers.User
+	for rows.Next() {
+		user := &vusers.User{}
+		var permissions sql.NullString
+		var quota sql.NullInt64
+		var disabled sql.NullBool
+		if err := rows.Scan(&user.Name, &user.Password, &user.Home, &permissions, &quota, &disabled); err != nil {
+			return nil, err
+		}
+		user.Permissions = permissions.String
+		user.Quota = quota.Int64
+		user.Disabled = disabled.Bool
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Create adds a user. Its password is stored as it is: it should be hashed with credentials.Hash, or set with
+// SetPassword.
+func (store *Store) Create(user *vusers.User) error {
+	if user.Name == "" || user.Home == "" {
+		return ErrInvalidUser
+	}
+	existing, err := store.lookup(user.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrUserExists
+	}
+	_, err = store.db.Exec(store.queries[queryInsert], user.Name, user.Password, user.Home, user.Permissions,
+		user.Quota, user.Disabled)
+	store.Invalidate(user.Name)
+	return err
+}
+
+// Update replaces the password, home, permissions, quota and disabled flag of a user
+func (store *Store) Update(user *vusers.User) error {
+	if user.Name == "" || user.Home == "" {
+		return ErrInvalidUser
+	}
+	return store.change(user.Name, queryUpdate, user.Password, user.Home, user.Permissions, user.Quota,
+		user.Disabled, user.Name)
+}
+
+// SetPassword hashes and stores the password of a user
+func (store *Store) SetPassword(name, password string) error {
+	hash, err := credentials.Hash(password)
+	if err != nil {
+		return err
+	}
+	return store.change(name, queryPassword, hash, name)
+}
+
+// SetDisabled disables a user, or enables it again. The sessions already opened aren't closed.
+func (store *Store) SetDisabled(name string, disabled bool) error {
+	return store.change(name, queryDisabled, disabled, name)
+}
+
+// Delete removes a user. The sessions already opened aren't closed.
+func (store *Store) Delete(name string) error {
+	return store.change(name, queryDelete, name)
+}
+
+// change runs a query changing a user, ErrUserNotFound is returned if it doesn't exist
+func (store *Store) change(name, query string, args ...interface{}) error {
+	defer store.Invalidate(name)
+	result, err := store.db.Exec(store.queries[query], args...)
+	if err != nil {
+		return err
+	}
+	// MySQL only counts the rows actually changed, the ones found with the same values are checked
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return nil
+	}
+	existing, err := store.lookup(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Invalidate forgets the cached version of a user, after it was changed directly in the database
+func (store *Store) Invalidate(name string) {
+	store.mutex.Lock()
+	delete(store.cache, name)
+	store.mutex.Unlock()
+}
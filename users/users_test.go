@@ -0,0 +1,232 @@
+package users
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fclairamb/ftpserver/drivers/vusers"
+)
+
+// memDriver is a database/sql driver running the queries of the store on a table in memory
+type memDriver struct {
+	mutex   sync.Mutex
+	rows    map[string][]driver.Value // Rows of the users table, by name
+	queries int                       // Queries run
+}
+
+func (d *memDriver) Open(name string) (driver.Conn, error) {
+	return &memConn{d}, nil
+}
+
+type memConn struct {
+	driver *memDriver
+}
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) {
+	return &memStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *memConn) Close() error {
+	return nil
+}
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("no transactions")
+}
+
+type memStmt struct {
+	driver *memDriver
+	query  string
+}
+
+func (s *memStmt) Close() error {
+	return nil
+}
+
+func (s *memStmt) NumInput() int {
+	return -1
+}
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.driver
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.queries++
+
+	switch s.query {
+	case Schemas[SQLite]:
+		return driver.RowsAffected(0), nil
+	case queryInsert:
+		d.rows[args[0].(string)] = args
+		return driver.RowsAffected(1), nil
+	case queryDelete:
+		if _, ok := d.rows[args[0].(string)]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		delete(d.rows, args[0].(string))
+		return driver.RowsAffected(1), nil
+	}
+
+	row, ok := d.rows[args[len(args)-1].(string)]
+	if !ok {
+		return driver.RowsAffected(0), nil
+	}
+	switch s.query {
+	case queryUpdate:
+		copy(row[1:], args[:len(args)-1])
+	case queryPassword:
+		row[1] = args[0]
+	case queryDisabled:
+		row[5] = args[0]
+	default:
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.driver
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.queries++
+
+	rows := &memRows{}
+	switch s.query {
+	case queryUser:
+		if row, ok := d.rows[args[0].(string)]; ok {
+			rows.rows = append(rows.rows, row[1:])
+		}
+	case queryUsers:
+		for _, row := range d.rows {
+			rows.rows = append(rows.rows, row)
+		}
+		sort.Slice(rows.rows, func(i, j int) bool { return rows.rows[i][0].(string) < rows.rows[j][0].(string) })
+	default:
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	return rows, nil
+}
+
+type memRows struct {
+	rows [][]driver.Value
+}
+
+func (r *memRows) Columns() []string {
+	columns := []string{"name", "password", "home", "permissions", "quota", "disabled"}
+	if len(r.rows) > 0 && len(r.rows[0]) < len(columns) {
+		return columns[1:]
+	}
+	return columns
+}
+
+func (r *memRows) Close() error {
+	return nil
+}
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var testDriver = &memDriver{rows: make(map[string][]driver.Value)}
+
+func init() {
+	sql.Register("users-test", testDriver)
+}
+
+func TestStore(t *testing.T) {
+	db, err := sql.Open("users-test", "")
+	if err != nil {
+		t.Fatal("Couldn't open the database:", err)
+	}
+	defer db.Close()
+
+	store := New(db, SQLite, &Options{CacheTTL: time.Hour})
+	if err = store.CreateSchema(); err != nil {
+		t.Fatal("Couldn't create the schema:", err)
+	}
+
+	for _, user := range []*vusers.User{
+		{Name: "bob", Password: "bob", Home: "/home/bob", Permissions: "lr"},
+		{Name: "alice", Password: "alice", Home: "/home/alice", Quota: 10},
+	} {
+		if err = store.Create(user); err != nil {
+			t.Fatal("Couldn't create the user:", err)
+		}
+	}
+	if err = store.Create(&vusers.User{Name: "bob", Home: "/tmp"}); err != ErrUserExists {
+		t.Fatal("The existing users can't be created again:", err)
+	}
+	if err = store.Create(&vusers.User{Name: "nobody"}); err != ErrInvalidUser {
+		t.Fatal("The users need a home:", err)
+	}
+
+	users, err := store.Users()
+	if err != nil || len(users) != 2 || users[0].Name != "alice" || users[0].Quota != 10 || users[1].Permissions != "lr" {
+		t.Fatal("Wrong users:", users, err)
+	}
+
+	if user, errAuth := vusers.Authenticate(store, "bob", "bob"); errAuth != nil || user.Home != "/home/bob" {
+		t.Fatal("The user should be authenticated:", errAuth)
+	}
+
+	// The users are cached, the changes made through the store apply immediately
+	queries := testDriver.queries
+	if _, err = vusers.Authenticate(store, "bob", "bob"); err != nil || testDriver.queries != queries {
+		t.Fatal("The user should be cached:", err)
+	}
+	if err = store.SetPassword("bob", "secret"); err != nil {
+		t.Fatal("Couldn't change the password:", err)
+	}
+	if _, err = vusers.Authenticate(store, "bob", "bob"); err != vusers.ErrBadCredentials {
+		t.Fatal("The old password should be refused:", err)
+	}
+	if _, err = vusers.Authenticate(store, "bob", "secret"); err != nil {
+		t.Fatal("The new password should be accepted:", err)
+	}
+	if err = store.SetDisabled("bob", true); err != nil {
+		t.Fatal("Couldn't disable the user:", err)
+	}
+	if _, err = vusers.Authenticate(store, "bob", "secret"); err != vusers.ErrUserDisabled {
+		t.Fatal("The user should be disabled:", err)
+	}
+
+	if err = store.Update(&vusers.User{Name: "alice", Password: "alice", Home: "/data/alice"}); err != nil {
+		t.Fatal("Couldn't update the user:", err)
+	}
+	if user, _ := store.User("alice"); user.Home != "/data/alice" || user.Quota != 0 {
+		t.Fatal("The user should be updated:", user)
+	}
+
+	if err = store.Delete("alice"); err != nil {
+		t.Fatal("Couldn't delete the user:", err)
+	}
+	if user, _ := store.User("alice"); user != nil {
+		t.Fatal("The user should be deleted")
+	}
+	for _, err = range []error{store.Delete("alice"), store.SetPassword("alice", "alice"),
+		store.Update(&vusers.User{Name: "alice", Home: "/tmp"})} {
+		if err != ErrUserNotFound {
+			t.Fatal("The missing users can't be changed:", err)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	if query := rebind(queryPassword, Postgres); query != "UPDATE users SET password = $1 WHERE name = $2" {
+		t.Fatal("Wrong PostgreSQL query:", query)
+	}
+	if query := rebind(queryPassword, MySQL); query != queryPassword {
+		t.Fatal("Wrong MySQL query:", query)
+	}
+}